@@ -0,0 +1,709 @@
+package onet
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// AdminConfig configures the admin interface of a conode, which gives access
+// to runtime operations like changing the log level or entering maintenance.
+// It is only reachable from the local machine.
+type AdminConfig struct {
+	// Socket is the path of the unix socket the interface listens on. Only
+	// the user running the conode can access it.
+	Socket string
+	// Address is a loopback address, like "127.0.0.1:7771", the interface
+	// listens on if Socket is empty.
+	Address string
+	// Token must be given as a bearer token by the clients. It is mandatory
+	// when listening on Address.
+	Token string
+}
+
+// AdminLogLevel is the log level of the conode. If Revert isn't 0 when it
+// is changed, the previous level is restored after this time. In the
+// replies, it is the time left before the level is restored.
+type AdminLogLevel struct {
+	Level  int
+	Revert time.Duration
+}
+
+// AdminPackageLevels are the log levels of some packages or files of the
+// conode, as set by log.SetPackageLevels. If Revert isn't 0 when they are
+// changed, the previous levels are restored after this time. In the replies,
+// it is the time left before the levels are restored.
+type AdminPackageLevels struct {
+	Levels map[string]int
+	Revert time.Duration
+}
+
+// AdminProtocol describes a running protocol instance.
+type AdminProtocol struct {
+	Token    string
+	Protocol string
+	Service  string
+	Root     bool
+}
+
+// AdminDropPeer asks to close the connections to a peer, given by the ID of
+// its ServerIdentity or by the remote address of a connection.
+type AdminDropPeer struct {
+	Peer string
+}
+
+// AdminDropPeerReply holds the number of connections closed.
+type AdminDropPeerReply struct {
+	Closed int
+}
+
+// AdminBackup asks to copy the database of the conode to Path. Filter
+// selects the services copied, all of them if it is empty.
+type AdminBackup struct {
+	Path   string
+	Filter SnapshotFilter
+}
+
+// AdminExport asks to write the buckets of Service to Path, see
+// Context.Export.
+type AdminExport struct {
+	Service string
+	Path    string
+}
+
+// AdminCompact holds the number of bytes reclaimed by the compaction of the
+// database.
+type AdminCompact struct {
+	Reclaimed int64
+}
+
+// AdminMaintenance enters or leaves the maintenance mode. When entering,
+// the reply is sent when the in-flight work is finished, or after Timeout.
+type AdminMaintenance struct {
+	Enable  bool
+	Timeout time.Duration
+	// Idle is set in the reply if no work is in progress.
+	Idle bool
+}
+
+// AdminCapability asks for a capability giving access to the handlers of
+// the service for Validity. The capability is returned in Token.
+type AdminCapability struct {
+	Service  string
+	Handlers []string
+	Validity time.Duration
+	Token    string
+}
+
+// AdminKeyRotation asks the conode to announce the transition of its key to
+// the members of Roster, encoded with protobuf. Sent is set in the reply to
+// the number of conodes reached.
+type AdminKeyRotation struct {
+	Transition KeyTransition
+	Roster     []byte
+	Sent       int
+}
+
+// defaultMaintenanceTimeout is how long the admin interface waits for the
+// in-flight work when entering maintenance.
+const defaultMaintenanceTimeout = time.Minute
+
+// adminServer serves the admin interface of a Server.
+type adminServer struct {
+	cfg      AdminConfig
+	listener net.Listener
+	http     *http.Server
+	// the changes of the log levels to revert
+	levelRevert    adminRevert
+	packagesRevert adminRevert
+}
+
+// adminRevert restores a setting changed for some time by the admin
+// interface.
+type adminRevert struct {
+	sync.Mutex
+	timer   *time.Timer
+	at      time.Time
+	restore func()
+}
+
+// set restores the setting with the function after d, or never if d is 0.
+// If the setting was already changed for some time, it keeps restoring the
+// value from before these changes.
+func (r *adminRevert) set(d time.Duration, restore func()) {
+	r.Lock()
+	defer r.Unlock()
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+		restore = r.restore
+	}
+	if d <= 0 {
+		r.restore = nil
+		return
+	}
+	r.at = time.Now().Add(d)
+	r.restore = restore
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		r.Lock()
+		defer r.Unlock()
+		if r.timer == timer {
+			r.timer = nil
+			r.restore()
+		}
+	})
+	r.timer = timer
+}
+
+// left returns the time left before the setting is restored, or 0.
+func (r *adminRevert) left() time.Duration {
+	r.Lock()
+	defer r.Unlock()
+	if r.timer == nil {
+		return 0
+	}
+	return time.Until(r.at)
+}
+
+// now restores the setting now if it was changed for some time.
+func (r *adminRevert) now() {
+	r.Lock()
+	defer r.Unlock()
+	if r.timer != nil && r.timer.Stop() {
+		r.timer = nil
+		r.restore()
+	}
+}
+
+// adminListen opens the listener of the admin interface.
+func adminListen(cfg AdminConfig) (net.Listener, error) {
+	if cfg.Socket != "" {
+		// remove the socket left by a previous run
+		if err := os.Remove(cfg.Socket); err != nil && !os.IsNotExist(err) {
+			return nil, xerrors.Errorf("removing old socket: %v", err)
+		}
+		return listenPrivateSocket(cfg.Socket)
+	}
+	if cfg.Token == "" {
+		return nil, xerrors.New("a token is needed to listen on an address")
+	}
+	host, _, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		return nil, xerrors.Errorf("admin address: %v", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, xerrors.New("admin address must be a loopback address")
+	}
+	l, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return nil, xerrors.Errorf("listening: %v", err)
+	}
+	return l, nil
+}
+
+// listenPrivateSocket listens on a unix socket only accessible to the user.
+// The socket is created in a directory only the user can enter, so that
+// nobody can connect before its permissions are restricted, and is then moved
+// to path.
+func listenPrivateSocket(path string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".admin")
+	if err != nil {
+		return nil, xerrors.Errorf("creating socket directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "socket")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, xerrors.Errorf("listening: %v", err)
+	}
+	// the socket is removed by close, at its final path
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		l.Close()
+		return nil, xerrors.Errorf("socket permissions: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		l.Close()
+		return nil, xerrors.Errorf("moving socket: %v", err)
+	}
+	return l, nil
+}
+
+func newAdminServer(c *Server, cfg AdminConfig) (*adminServer, error) {
+	l, err := adminListen(cfg)
+	if err != nil {
+		return nil, err
+	}
+	a := &adminServer{cfg: cfg, listener: l}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/loglevel", a.handle(func(r *http.Request) (interface{}, error) {
+		if r.Method == http.MethodPost {
+			req := &AdminLogLevel{}
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+				return nil, xerrors.Errorf("decoding: %v", err)
+			}
+			previous := log.DebugVisible()
+			a.levelRevert.set(req.Revert, func() {
+				log.SetDebugVisible(previous)
+				log.Lvl1("Log level reverted to", previous)
+				c.Publish(Event{Type: EventConfigReloaded,
+					Message: fmt.Sprint("log level reverted to ", previous)})
+			})
+			log.SetDebugVisible(req.Level)
+			c.Publish(Event{Type: EventConfigReloaded,
+				Message: fmt.Sprint("log level set to ", req.Level)})
+			if req.Revert > 0 {
+				log.Lvl1("Log level set to", req.Level, "for", req.Revert,
+					"by the admin interface")
+			} else {
+				log.Lvl1("Log level set to", req.Level, "by the admin interface")
+			}
+		}
+		return &AdminLogLevel{Level: log.DebugVisible(),
+			Revert: a.levelRevert.left()}, nil
+	}))
+	mux.HandleFunc("/loglevel/packages", a.handle(func(r *http.Request) (interface{}, error) {
+		if r.Method == http.MethodPost {
+			req := &AdminPackageLevels{}
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+				return nil, xerrors.Errorf("decoding: %v", err)
+			}
+			previous := log.PackageLevels()
+			a.packagesRevert.set(req.Revert, func() {
+				log.SetPackageLevels(previous)
+				log.Lvl1("Package log levels reverted to",
+					log.FormatPackageLevels(previous))
+				c.Publish(Event{Type: EventConfigReloaded,
+					Message: "package log levels reverted to " +
+						log.FormatPackageLevels(previous)})
+			})
+			log.SetPackageLevels(req.Levels)
+			levels := log.FormatPackageLevels(req.Levels)
+			c.Publish(Event{Type: EventConfigReloaded,
+				Message: "package log levels set to " + levels})
+			if req.Revert > 0 {
+				log.Lvl1("Package log levels set to", levels, "for", req.Revert,
+					"by the admin interface")
+			} else {
+				log.Lvl1("Package log levels set to", levels, "by the admin interface")
+			}
+		}
+		return &AdminPackageLevels{Levels: log.PackageLevels(),
+			Revert: a.packagesRevert.left()}, nil
+	}))
+	mux.HandleFunc("/connections", a.handle(func(r *http.Request) (interface{}, error) {
+		return c.Router.ConnectionsInfo(), nil
+	}))
+	mux.HandleFunc("/protocols", a.handle(func(r *http.Request) (interface{}, error) {
+		return c.overlay.adminProtocols(), nil
+	}))
+	mux.HandleFunc("/status", a.handle(func(r *http.Request) (interface{}, error) {
+		return c.RuntimeStatus(), nil
+	}))
+	mux.HandleFunc("/peers/drop", a.handle(func(r *http.Request) (interface{}, error) {
+		req := &AdminDropPeer{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, xerrors.Errorf("decoding: %v", err)
+		}
+		reply := &AdminDropPeerReply{}
+		for _, info := range c.Router.ConnectionsInfo() {
+			match := info.ID.String() == req.Peer
+			for _, remote := range info.Remotes {
+				match = match || remote.NetworkAddress() == req.Peer ||
+					remote.String() == req.Peer
+			}
+			if match {
+				reply.Closed += c.Router.CloseConnections(info.ID)
+			}
+		}
+		log.Lvl1("Dropped", reply.Closed, "connections to", req.Peer,
+			"by the admin interface")
+		return reply, nil
+	}))
+	mux.HandleFunc("/ipfilter", a.handle(func(r *http.Request) (interface{}, error) {
+		if r.Method == http.MethodPost {
+			req := &network.IPFilterConfig{}
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+				return nil, xerrors.Errorf("decoding: %v", err)
+			}
+			if err := c.SetIPFilter(*req); err != nil {
+				return nil, err
+			}
+			log.Lvl1("IP filter set to allow", req.Allow, "and deny", req.Deny,
+				"by the admin interface")
+		}
+		cfg := c.IPFilter()
+		return &cfg, nil
+	}))
+	mux.HandleFunc("/backup", a.handle(func(r *http.Request) (interface{}, error) {
+		req := &AdminBackup{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, xerrors.Errorf("decoding: %v", err)
+		}
+		if err := c.Snapshot(req.Path, req.Filter); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}))
+	mux.HandleFunc("/export", a.handle(func(r *http.Request) (interface{}, error) {
+		req := &AdminExport{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, xerrors.Errorf("decoding: %v", err)
+		}
+		if err := c.Export(req.Service, req.Path); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}))
+	mux.HandleFunc("/verify", a.handle(func(r *http.Request) (interface{}, error) {
+		return c.VerifyStorage()
+	}))
+	mux.HandleFunc("/compact", a.handle(func(r *http.Request) (interface{}, error) {
+		reclaimed, err := c.Compact()
+		if err != nil {
+			return nil, err
+		}
+		return &AdminCompact{Reclaimed: reclaimed}, nil
+	}))
+	mux.HandleFunc("/maintenance", a.handle(func(r *http.Request) (interface{}, error) {
+		req := &AdminMaintenance{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, xerrors.Errorf("decoding: %v", err)
+		}
+		if !req.Enable {
+			c.LeaveMaintenance()
+			log.Lvl1("Left maintenance mode by the admin interface")
+			return &AdminMaintenance{Idle: true}, nil
+		}
+		log.Lvl1("Entering maintenance mode by the admin interface")
+		timeout := req.Timeout
+		if timeout <= 0 {
+			timeout = defaultMaintenanceTimeout
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		err := c.EnterMaintenance(ctx)
+		return &AdminMaintenance{Enable: true, Idle: err == nil}, nil
+	}))
+	mux.HandleFunc("/capabilities", a.handle(func(r *http.Request) (interface{}, error) {
+		req := &AdminCapability{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, xerrors.Errorf("decoding: %v", err)
+		}
+		if req.Validity <= 0 {
+			return nil, xerrors.New("validity must be positive")
+		}
+		capa, err := c.NewCapability(req.Service, req.Handlers, c.Clock().Now().Add(req.Validity))
+		if err != nil {
+			return nil, err
+		}
+		log.Lvl1("Issued", capa.ID(), "for", req.Service, req.Handlers,
+			"by the admin interface")
+		req.Token = capa.String()
+		return req, nil
+	}))
+	mux.HandleFunc("/keyrotation", a.handle(func(r *http.Request) (interface{}, error) {
+		req := &AdminKeyRotation{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, xerrors.Errorf("decoding: %v", err)
+		}
+		ro := &Roster{}
+		err := protobuf.DecodeWithConstructors(req.Roster, ro,
+			network.DefaultConstructors(c.suite))
+		if err != nil {
+			return nil, xerrors.Errorf("decoding roster: %v", err)
+		}
+		sent, err := c.AnnounceKeyTransition(&req.Transition, ro)
+		if err != nil {
+			return nil, err
+		}
+		log.Lvl1("Announced the key transition to", sent, "conodes by the admin interface")
+		return &AdminKeyRotation{Sent: sent}, nil
+	}))
+	a.http = &http.Server{Handler: mux}
+	return a, nil
+}
+
+// handle checks the token and encodes the reply of f in JSON.
+func (a *adminServer) handle(f func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.cfg.Token != "" {
+			auth := r.Header.Get("Authorization")
+			if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+a.cfg.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		reply, err := f(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reply)
+	}
+}
+
+func (a *adminServer) serve() {
+	err := a.http.Serve(a.listener)
+	if err != nil && err != http.ErrServerClosed {
+		log.Error("admin interface:", err)
+	}
+}
+
+func (a *adminServer) close() error {
+	err := a.http.Close()
+	// the levels don't outlive the conode that changed them
+	a.levelRevert.now()
+	a.packagesRevert.now()
+	// in case the server has not been started
+	a.listener.Close()
+	if a.cfg.Socket != "" {
+		os.Remove(a.cfg.Socket)
+	}
+	return err
+}
+
+// adminProtocols returns the running protocol instances.
+func (o *Overlay) adminProtocols() []AdminProtocol {
+	o.instancesLock.Lock()
+	defer o.instancesLock.Unlock()
+	var ps []AdminProtocol
+	for id, tni := range o.instances {
+		ps = append(ps, AdminProtocol{
+			Token:    id.String(),
+			Protocol: tni.ProtocolName(),
+			Service:  ServiceFactory.Name(tni.Token().ServiceID),
+			Root:     tni.IsRoot(),
+		})
+	}
+	return ps
+}
+
+// Backup writes a consistent copy of the database of the conode to path,
+// while the conode keeps running.
+func (c *Server) Backup(path string) error {
+	return c.Snapshot(path, SnapshotFilter{})
+}
+
+// AdminClient connects to the admin interface of a conode.
+type AdminClient struct {
+	cfg    AdminConfig
+	client *http.Client
+}
+
+// NewAdminClient returns a client for the admin interface described by cfg.
+func NewAdminClient(cfg AdminConfig) *AdminClient {
+	tr := &http.Transport{}
+	if cfg.Socket != "" {
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", cfg.Socket)
+		}
+	}
+	return &AdminClient{cfg: cfg, client: &http.Client{Transport: tr}}
+}
+
+// call sends req, if not nil, to the endpoint and decodes the reply in ret.
+func (a *AdminClient) call(endpoint string, req, ret interface{}) error {
+	host := "admin"
+	if a.cfg.Socket == "" {
+		host = a.cfg.Address
+	}
+	method := http.MethodGet
+	var body []byte
+	if req != nil {
+		method = http.MethodPost
+		var err error
+		body, err = json.Marshal(req)
+		if err != nil {
+			return xerrors.Errorf("encoding: %v", err)
+		}
+	}
+	hr, err := http.NewRequest(method, "http://"+host+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return xerrors.Errorf("request: %v", err)
+	}
+	if a.cfg.Token != "" {
+		hr.Header.Set("Authorization", "Bearer "+a.cfg.Token)
+	}
+	resp, err := a.client.Do(hr)
+	if err != nil {
+		return xerrors.Errorf("sending: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return xerrors.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(ret); err != nil {
+		return xerrors.Errorf("decoding: %v", err)
+	}
+	return nil
+}
+
+// LogLevel returns the log level of the conode.
+func (a *AdminClient) LogLevel() (int, error) {
+	reply := &AdminLogLevel{}
+	err := a.call("/loglevel", nil, reply)
+	return reply.Level, err
+}
+
+// SetLogLevel changes the log level of the conode.
+func (a *AdminClient) SetLogLevel(level int) error {
+	return a.SetLogLevelFor(level, 0)
+}
+
+// SetLogLevelFor changes the log level of the conode, and restores the
+// previous one after the given time.
+func (a *AdminClient) SetLogLevelFor(level int, revert time.Duration) error {
+	return a.call("/loglevel", &AdminLogLevel{Level: level, Revert: revert},
+		&AdminLogLevel{})
+}
+
+// PackageLevels returns the log levels of the packages of the conode.
+func (a *AdminClient) PackageLevels() (map[string]int, error) {
+	reply := &AdminPackageLevels{}
+	err := a.call("/loglevel/packages", nil, reply)
+	return reply.Levels, err
+}
+
+// SetPackageLevels replaces the log levels of the packages of the conode.
+func (a *AdminClient) SetPackageLevels(levels map[string]int) error {
+	return a.SetPackageLevelsFor(levels, 0)
+}
+
+// SetPackageLevelsFor replaces the log levels of the packages of the conode,
+// and restores the previous ones after the given time.
+func (a *AdminClient) SetPackageLevelsFor(levels map[string]int, revert time.Duration) error {
+	return a.call("/loglevel/packages", &AdminPackageLevels{Levels: levels,
+		Revert: revert}, &AdminPackageLevels{})
+}
+
+// Connections returns the open connections of the conode.
+func (a *AdminClient) Connections() ([]network.ConnectionInfo, error) {
+	var reply []network.ConnectionInfo
+	err := a.call("/connections", nil, &reply)
+	return reply, err
+}
+
+// Protocols returns the protocol instances running on the conode.
+func (a *AdminClient) Protocols() ([]AdminProtocol, error) {
+	var reply []AdminProtocol
+	err := a.call("/protocols", nil, &reply)
+	return reply, err
+}
+
+// Status returns the state of the conode.
+func (a *AdminClient) Status() (*RuntimeStatus, error) {
+	reply := &RuntimeStatus{}
+	err := a.call("/status", nil, reply)
+	return reply, err
+}
+
+// DropPeer closes the connections to the peer and returns how many were
+// closed.
+func (a *AdminClient) DropPeer(peer string) (int, error) {
+	reply := &AdminDropPeerReply{}
+	err := a.call("/peers/drop", &AdminDropPeer{Peer: peer}, reply)
+	return reply.Closed, err
+}
+
+// IPFilter returns the networks allowed and denied to connect to the conode.
+func (a *AdminClient) IPFilter() (*network.IPFilterConfig, error) {
+	reply := &network.IPFilterConfig{}
+	err := a.call("/ipfilter", nil, reply)
+	return reply, err
+}
+
+// SetIPFilter replaces the networks allowed and denied to connect to the
+// conode.
+func (a *AdminClient) SetIPFilter(cfg network.IPFilterConfig) error {
+	return a.call("/ipfilter", &cfg, &network.IPFilterConfig{})
+}
+
+// Backup copies the database of the conode to path, on the machine of the
+// conode.
+func (a *AdminClient) Backup(path string) error {
+	return a.Snapshot(path, SnapshotFilter{})
+}
+
+// Snapshot copies the buckets of the services taken by the filter to path,
+// on the machine of the conode.
+func (a *AdminClient) Snapshot(path string, filter SnapshotFilter) error {
+	return a.call("/backup", &AdminBackup{Path: path, Filter: filter}, &AdminBackup{})
+}
+
+// Export writes the buckets of the service to path, on the machine of the
+// conode.
+func (a *AdminClient) Export(service, path string) error {
+	return a.call("/export", &AdminExport{Service: service, Path: path}, &AdminExport{})
+}
+
+// VerifyStorage checks the values of the database of the conode against
+// their checksums.
+func (a *AdminClient) VerifyStorage() (*IntegrityReport, error) {
+	reply := &IntegrityReport{}
+	err := a.call("/verify", &IntegrityReport{}, reply)
+	return reply, err
+}
+
+// Compact compacts the database of the conode and returns the number of bytes
+// reclaimed.
+func (a *AdminClient) Compact() (int64, error) {
+	reply := &AdminCompact{}
+	err := a.call("/compact", &AdminCompact{}, reply)
+	return reply.Reclaimed, err
+}
+
+// SetMaintenance enters or leaves the maintenance mode. When entering, it
+// returns whether the in-flight work finished before the timeout.
+func (a *AdminClient) SetMaintenance(enable bool, timeout time.Duration) (bool, error) {
+	reply := &AdminMaintenance{}
+	err := a.call("/maintenance", &AdminMaintenance{Enable: enable, Timeout: timeout}, reply)
+	return reply.Idle, err
+}
+
+// NewCapability asks the conode for a capability giving access to the
+// handlers of the service for the given duration.
+func (a *AdminClient) NewCapability(service string, handlers []string,
+	validity time.Duration) (*Capability, error) {
+	reply := &AdminCapability{}
+	err := a.call("/capabilities", &AdminCapability{
+		Service:  service,
+		Handlers: handlers,
+		Validity: validity,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCapability(reply.Token)
+}
+
+// AnnounceKeyTransition asks the conode to send the transition of its key to
+// the other members of the roster, and returns the number of conodes reached.
+func (a *AdminClient) AnnounceKeyTransition(kt *KeyTransition, ro *Roster) (int, error) {
+	buf, err := protobuf.Encode(ro)
+	if err != nil {
+		return 0, xerrors.Errorf("encoding roster: %v", err)
+	}
+	reply := &AdminKeyRotation{}
+	err = a.call("/keyrotation", &AdminKeyRotation{Transition: *kt, Roster: buf}, reply)
+	return reply.Sent, err
+}
@@ -0,0 +1,143 @@
+package onet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestAdmin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(2, true)
+	server := servers[0]
+
+	cfg := AdminConfig{Socket: filepath.Join(dir, "admin.sock")}
+	as, err := newAdminServer(server, cfg)
+	require.NoError(t, err)
+	go as.serve()
+	defer as.close()
+	ac := NewAdminClient(cfg)
+	fi, err := os.Stat(cfg.Socket)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(files))
+
+	lvl := log.DebugVisible()
+	defer log.SetDebugVisible(lvl)
+	require.NoError(t, ac.SetLogLevel(lvl+1))
+	level, err := ac.LogLevel()
+	require.NoError(t, err)
+	require.Equal(t, lvl+1, level)
+	defer log.SetPackageLevels(nil)
+	require.NoError(t, ac.SetPackageLevels(map[string]int{"network": 3}))
+	levels, err := ac.PackageLevels()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"network": 3}, levels)
+
+	// the temporary changes are reverted to the levels before them
+	require.NoError(t, ac.SetLogLevelFor(lvl+2, time.Hour))
+	require.NoError(t, ac.SetLogLevelFor(lvl+3, 100*time.Millisecond))
+	require.NoError(t, ac.SetPackageLevelsFor(map[string]int{"overlay": 4},
+		100*time.Millisecond))
+	level, err = ac.LogLevel()
+	require.NoError(t, err)
+	require.Equal(t, lvl+3, level)
+	require.Eventually(t, func() bool {
+		level, err := ac.LogLevel()
+		levels, err2 := ac.PackageLevels()
+		return err == nil && err2 == nil && level == lvl+1 &&
+			levels["network"] == 3 && len(levels) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	pi, err := local.CreateProtocol(pingPongProtoName, tree)
+	require.NoError(t, err)
+	ps, err := ac.Protocols()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(ps))
+	require.Equal(t, pingPongProtoName, ps[0].Protocol)
+	require.True(t, ps[0].Root)
+	st, err := ac.Status()
+	require.NoError(t, err)
+	require.Equal(t, 1, st.Protocols[pingPongProtoName])
+	require.Equal(t, tSuite.String(), st.Suites["conode"])
+	require.NoError(t, pi.Start())
+	<-pi.(*pingPongProto).done
+
+	conns, err := ac.Connections()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(conns))
+	require.Equal(t, servers[1].ServerIdentity.ID, conns[0].ID)
+	n, err := ac.DropPeer(servers[1].ServerIdentity.ID.String())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	n, err = ac.DropPeer("unknown")
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	filter := network.IPFilterConfig{Allow: []string{"10.0.0.0/8"}}
+	require.NoError(t, ac.SetIPFilter(filter))
+	got, err := ac.IPFilter()
+	require.NoError(t, err)
+	require.Equal(t, &filter, got)
+	require.Equal(t, filter, server.IPFilter())
+	require.Error(t, ac.SetIPFilter(network.IPFilterConfig{Deny: []string{"10.0.0.0/33"}}))
+	require.NoError(t, ac.SetIPFilter(network.IPFilterConfig{}))
+
+	backup := filepath.Join(dir, "backup.db")
+	require.NoError(t, ac.Backup(backup))
+	_, err = os.Stat(backup)
+	require.NoError(t, err)
+	export := filepath.Join(dir, "export")
+	require.NoError(t, ac.Export(serviceWebSocket, export))
+	f, err := os.Open(export)
+	require.NoError(t, err)
+	require.NoError(t, ReadExport(f, func(bucket, key, value []byte) error { return nil }))
+	require.NoError(t, f.Close())
+	require.Error(t, ac.Export("unknown", export))
+
+	idle, err := ac.SetMaintenance(true, 0)
+	require.NoError(t, err)
+	require.True(t, idle)
+	require.True(t, server.InMaintenance())
+	_, err = ac.SetMaintenance(false, 0)
+	require.NoError(t, err)
+	require.False(t, server.InMaintenance())
+}
+
+func TestAdmin_Address(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+
+	_, err := newAdminServer(server, AdminConfig{Address: "127.0.0.1:0"})
+	require.Error(t, err)
+	_, err = newAdminServer(server, AdminConfig{Address: "0.0.0.0:0", Token: "secret"})
+	require.Error(t, err)
+
+	as, err := newAdminServer(server, AdminConfig{Address: "127.0.0.1:0", Token: "secret"})
+	require.NoError(t, err)
+	go as.serve()
+	defer as.close()
+	addr := as.listener.Addr().String()
+
+	_, err = NewAdminClient(AdminConfig{Address: addr, Token: "wrong"}).LogLevel()
+	require.Error(t, err)
+	_, err = NewAdminClient(AdminConfig{Address: addr}).LogLevel()
+	require.Error(t, err)
+	level, err := NewAdminClient(AdminConfig{Address: addr, Token: "secret"}).LogLevel()
+	require.NoError(t, err)
+	require.Equal(t, log.DebugVisible(), level)
+}
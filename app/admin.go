@@ -0,0 +1,442 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// ConodeCommands are the commands provided to conode binaries: "setup" to
+// configure a conode, "server" to run the conodes, "admin" to manage them,
+// "restore" to get their backups back, "mnemonic" to write their key down,
+// "passphrase" to encrypt it, "check" to verify the conodes of a group, and
+// "service" to run them as a Windows service.
+var ConodeCommands = []cli.Command{SetupCommand, ServerCommand, AdminCommand,
+	RestoreCommand, MnemonicCommand, PassphraseCommand, CheckCommand,
+	ServiceCommand}
+
+// AdminCommand is the command line interface to the admin interface of a
+// running conode. It is part of ConodeCommands.
+var AdminCommand = cli.Command{
+	Name:  "admin",
+	Usage: "manage a running conode through its admin interface",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "socket",
+			Usage: "unix socket of the admin interface",
+		},
+		cli.StringFlag{
+			Name:  "address",
+			Usage: "loopback address of the admin interface, if there is no socket",
+		},
+		cli.StringFlag{
+			Name:   "token",
+			Usage:  "token of the admin interface",
+			EnvVar: "CONODE_ADMIN_TOKEN",
+		},
+	},
+	Subcommands: []cli.Command{
+		{
+			Name:      "loglevel",
+			Usage:     "show or change the log level",
+			ArgsUsage: "[level]",
+			Action:    adminLogLevel,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "packages",
+					Usage: "replace the levels of some packages or files, like network=3,overlay=1",
+				},
+				cli.DurationFlag{
+					Name:  "revert",
+					Usage: "restore the previous levels after this time",
+				},
+			},
+		},
+		{
+			Name:   "connections",
+			Usage:  "list the open connections",
+			Action: adminConnections,
+		},
+		{
+			Name:   "protocols",
+			Usage:  "list the running protocol instances",
+			Action: adminProtocols,
+		},
+		{
+			Name:   "status",
+			Usage:  "print the state of the conode as JSON",
+			Action: adminStatus,
+		},
+		{
+			Name:      "drop",
+			Usage:     "close the connections to a peer",
+			ArgsUsage: "id|address",
+			Action:    adminDrop,
+		},
+		{
+			Name:   "ipfilter",
+			Usage:  "show or replace the networks allowed and denied to connect",
+			Action: adminIPFilter,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "allow",
+					Usage: "only network accepted, as a CIDR or an IP, can be repeated",
+				},
+				cli.StringSliceFlag{
+					Name:  "deny",
+					Usage: "network refused, as a CIDR or an IP, can be repeated",
+				},
+				cli.BoolFlag{
+					Name:  "clear",
+					Usage: "accept every network",
+				},
+			},
+		},
+		{
+			Name:      "backup",
+			Usage:     "copy the database of the conode",
+			ArgsUsage: "path",
+			Action:    adminBackup,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "include",
+					Usage: "service to copy, can be repeated; all of them by default",
+				},
+				cli.StringSliceFlag{
+					Name:  "exclude",
+					Usage: "service not to copy, can be repeated",
+				},
+			},
+		},
+		{
+			Name:      "export",
+			Usage:     "dump the buckets of a service for offline analysis",
+			ArgsUsage: "service path",
+			Action:    adminExport,
+		},
+		{
+			Name:   "verify",
+			Usage:  "check the database of the conode against its checksums",
+			Action: adminVerify,
+		},
+		{
+			Name:   "compact",
+			Usage:  "compact the database of the conode",
+			Action: adminCompact,
+		},
+		{
+			Name:      "maintenance",
+			Usage:     "enter or leave the maintenance mode",
+			ArgsUsage: "on|off",
+			Action:    adminMaintenance,
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "timeout",
+					Usage: "how long to wait for the in-flight work",
+				},
+			},
+		},
+		{
+			Name:      "capability",
+			Usage:     "issue a capability giving access to some handlers of a service",
+			ArgsUsage: "service handler...",
+			Action:    adminCapability,
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "validity",
+					Usage: "how long the capability is valid",
+					Value: 24 * time.Hour,
+				},
+			},
+		},
+		{
+			Name:   "rotatekey",
+			Usage:  "give a new key to the conode and announce it to its group",
+			Action: adminRotateKey,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "config, c",
+					Value: DefaultServerConfig,
+					Usage: "config file of the conode, replaced with the new key",
+				},
+				cli.StringFlag{
+					Name:  "group, g",
+					Usage: "group definition receiving the announcement, updated with the new key",
+				},
+			},
+		},
+	},
+}
+
+func adminClient(c *cli.Context) (*onet.AdminClient, error) {
+	cfg := onet.AdminConfig{
+		Socket:  c.Parent().String("socket"),
+		Address: c.Parent().String("address"),
+		Token:   c.Parent().String("token"),
+	}
+	if cfg.Socket == "" && cfg.Address == "" {
+		return nil, xerrors.New("need --socket or --address")
+	}
+	return onet.NewAdminClient(cfg), nil
+}
+
+func adminLogLevel(c *cli.Context) error {
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() > 0 {
+		level, err := strconv.Atoi(c.Args().First())
+		if err != nil {
+			return xerrors.Errorf("invalid level: %v", err)
+		}
+		if err := ac.SetLogLevelFor(level, c.Duration("revert")); err != nil {
+			return xerrors.Errorf("setting log level: %v", err)
+		}
+	}
+	if c.IsSet("packages") {
+		levels, err := log.ParsePackageLevels(c.String("packages"))
+		if err != nil {
+			return xerrors.Errorf("invalid packages: %v", err)
+		}
+		if err := ac.SetPackageLevelsFor(levels, c.Duration("revert")); err != nil {
+			return xerrors.Errorf("setting package levels: %v", err)
+		}
+	}
+	level, err := ac.LogLevel()
+	if err != nil {
+		return xerrors.Errorf("getting log level: %v", err)
+	}
+	levels, err := ac.PackageLevels()
+	if err != nil {
+		return xerrors.Errorf("getting package levels: %v", err)
+	}
+	fmt.Fprintln(out, "Log level:", level)
+	if len(levels) > 0 {
+		fmt.Fprintln(out, "Package levels:", log.FormatPackageLevels(levels))
+	}
+	if revert := c.Duration("revert"); revert > 0 && (c.NArg() > 0 || c.IsSet("packages")) {
+		fmt.Fprintln(out, "Reverted in", revert)
+	}
+	return nil
+}
+
+func adminConnections(c *cli.Context) error {
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	conns, err := ac.Connections()
+	if err != nil {
+		return xerrors.Errorf("getting connections: %v", err)
+	}
+	for _, conn := range conns {
+		var remotes []string
+		for _, r := range conn.Remotes {
+			remotes = append(remotes, r.String())
+		}
+		fmt.Fprintf(out, "%s\t%s\ttx=%d\trx=%d\n", conn.ID,
+			strings.Join(remotes, ","), conn.Tx, conn.Rx)
+	}
+	return nil
+}
+
+func adminStatus(c *cli.Context) error {
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	st, err := ac.Status()
+	if err != nil {
+		return xerrors.Errorf("getting status: %v", err)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(st)
+}
+
+func adminProtocols(c *cli.Context) error {
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	ps, err := ac.Protocols()
+	if err != nil {
+		return xerrors.Errorf("getting protocols: %v", err)
+	}
+	for _, p := range ps {
+		fmt.Fprintf(out, "%s\t%s\tservice=%s\troot=%t\n", p.Token, p.Protocol,
+			p.Service, p.Root)
+	}
+	return nil
+}
+
+func adminDrop(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("need the id or the address of the peer")
+	}
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	n, err := ac.DropPeer(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("dropping peer: %v", err)
+	}
+	fmt.Fprintln(out, "Closed connections:", n)
+	return nil
+}
+
+func adminIPFilter(c *cli.Context) error {
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	if c.Bool("clear") || c.IsSet("allow") || c.IsSet("deny") {
+		cfg := network.IPFilterConfig{
+			Allow: c.StringSlice("allow"),
+			Deny:  c.StringSlice("deny"),
+		}
+		if err := ac.SetIPFilter(cfg); err != nil {
+			return xerrors.Errorf("setting IP filter: %v", err)
+		}
+	}
+	cfg, err := ac.IPFilter()
+	if err != nil {
+		return xerrors.Errorf("getting IP filter: %v", err)
+	}
+	fmt.Fprintln(out, "Allowed:", strings.Join(cfg.Allow, ","))
+	fmt.Fprintln(out, "Denied:", strings.Join(cfg.Deny, ","))
+	return nil
+}
+
+func adminBackup(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("need the path of the backup")
+	}
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	filter := onet.SnapshotFilter{
+		Include: c.StringSlice("include"),
+		Exclude: c.StringSlice("exclude"),
+	}
+	if err := ac.Snapshot(c.Args().First(), filter); err != nil {
+		return xerrors.Errorf("backup: %v", err)
+	}
+	fmt.Fprintln(out, "Database copied to", c.Args().First())
+	return nil
+}
+
+func adminExport(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("need the service and the path of the export")
+	}
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	if err := ac.Export(c.Args().Get(0), c.Args().Get(1)); err != nil {
+		return xerrors.Errorf("export: %v", err)
+	}
+	fmt.Fprintln(out, "Service exported to", c.Args().Get(1))
+	return nil
+}
+
+func adminVerify(c *cli.Context) error {
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	report, err := ac.VerifyStorage()
+	if err != nil {
+		return xerrors.Errorf("verify: %v", err)
+	}
+	for _, e := range report.Corrupted {
+		fmt.Fprintf(out, "%s %s: %s\n", e.Bucket, e.Key, e.Problem)
+	}
+	fmt.Fprintln(out, "Verified", report.Keys, "keys in", report.Buckets, "buckets")
+	if len(report.Corrupted) > 0 {
+		return xerrors.Errorf("%d corrupted keys", len(report.Corrupted))
+	}
+	return nil
+}
+
+func adminCompact(c *cli.Context) error {
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	reclaimed, err := ac.Compact()
+	if err != nil {
+		return xerrors.Errorf("compact: %v", err)
+	}
+	fmt.Fprintln(out, "Reclaimed bytes:", reclaimed)
+	return nil
+}
+
+func adminMaintenance(c *cli.Context) error {
+	var enable bool
+	switch c.Args().First() {
+	case "on":
+		enable = true
+	case "off":
+	default:
+		return xerrors.New("need on or off")
+	}
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	idle, err := ac.SetMaintenance(enable, c.Duration("timeout"))
+	if err != nil {
+		return xerrors.Errorf("maintenance: %v", err)
+	}
+	switch {
+	case !enable:
+		fmt.Fprintln(out, "Left maintenance mode")
+	case idle:
+		fmt.Fprintln(out, "In maintenance mode, no work in progress")
+	default:
+		fmt.Fprintln(out, "In maintenance mode, but work is still in progress")
+	}
+	return nil
+}
+
+func adminCapability(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return xerrors.New("need the service and at least one handler")
+	}
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	capa, err := ac.NewCapability(c.Args().First(), c.Args().Tail(), c.Duration("validity"))
+	if err != nil {
+		return xerrors.Errorf("capability: %v", err)
+	}
+	fmt.Fprintln(out, capa)
+	return nil
+}
+
+func adminRotateKey(c *cli.Context) error {
+	ac, err := adminClient(c)
+	if err != nil {
+		return err
+	}
+	_, sent, err := RotateKey(ac, c.String("config"), c.String("group"))
+	if err != nil {
+		return xerrors.Errorf("rotating key: %v", err)
+	}
+	fmt.Fprintln(out, "Key rotated and announced to", sent, "conodes, restart the conode to use it")
+	return nil
+}
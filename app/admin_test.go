@@ -0,0 +1,75 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestConodeCommands(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "admin")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// a free port for the websocket
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	suite := suites.MustFind("Ed25519")
+	priv, pub := createKeyPair(suite)
+	socket := path.Join(tmp, "admin.sock")
+	hc := &CothorityConfig{
+		Suite:         suite.String(),
+		Public:        pub,
+		Private:       priv,
+		Address:       network.NewAddress(network.PlainTCP, fmt.Sprintf("127.0.0.1:%d", port-1)),
+		ListenAddress: "127.0.0.1:0",
+		Admin:         &onet.AdminConfig{Socket: socket},
+	}
+	file := path.Join(tmp, "private.toml")
+	require.NoError(t, hc.Save(file))
+	_, srv, err := ParseCothority(file)
+	require.NoError(t, err)
+	// closing the server reverts the temporary levels
+	defer log.SetPackageLevels(nil)
+	go srv.Start()
+	defer srv.Close()
+	srv.WaitStartup()
+
+	app := cli.NewApp()
+	app.Commands = ConodeCommands
+	o.Reset()
+	require.NoError(t, app.Run([]string{"conode", "admin", "--socket", socket, "loglevel"}))
+	require.Contains(t, o.String(), "Log level:")
+	o.Reset()
+	require.NoError(t, app.Run([]string{"conode", "admin", "--socket", socket, "loglevel",
+		"--packages", "overlay=1,network=3"}))
+	require.Contains(t, o.String(), "Package levels: network=3,overlay=1")
+	o.Reset()
+	require.NoError(t, app.Run([]string{"conode", "admin", "--socket", socket, "loglevel",
+		"--packages", "network=4", "--revert", "1h"}))
+	require.Contains(t, o.String(), "Package levels: network=4\nReverted in 1h0m0s")
+	o.Reset()
+	require.NoError(t, app.Run([]string{"conode", "admin", "--socket", socket, "ipfilter",
+		"--allow", "10.0.0.0/8", "--allow", "127.0.0.1", "--deny", "10.1.0.0/16"}))
+	require.Contains(t, o.String(), "Allowed: 10.0.0.0/8,127.0.0.1\nDenied: 10.1.0.0/16")
+	o.Reset()
+	require.NoError(t, app.Run([]string{"conode", "admin", "--socket", socket, "ipfilter", "--clear"}))
+	require.Contains(t, o.String(), "Allowed: \nDenied: \n")
+	require.Error(t, app.Run([]string{"conode", "admin", "--socket", socket, "ipfilter",
+		"--deny", "10.1.0.0/33"}))
+	require.Error(t, app.Run([]string{"conode", "admin", "--socket", path.Join(tmp, "none"),
+		"loglevel"}))
+}
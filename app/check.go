@@ -0,0 +1,314 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// CheckOptions tells CheckRoster what to check.
+type CheckOptions struct {
+	// Deep also checks the TLS identity of the conodes, their version, their
+	// clock and the roundtrip latency to them. Else only the reachability of
+	// both ports is checked.
+	Deep bool
+	// Timeout of each connection and request.
+	Timeout time.Duration
+	// MaxClockSkew is the largest difference between the clock of a conode
+	// and the local one that is accepted. 0 accepts any.
+	MaxClockSkew time.Duration
+}
+
+// CheckResult is what CheckRoster found about a member of the roster. The
+// durations are in nanoseconds in JSON.
+type CheckResult struct {
+	Address     network.Address `json:"address"`
+	Public      string          `json:"public"`
+	Description string          `json:"description,omitempty"`
+	// Router and WebSocket tell if the ports of the conode accept
+	// connections.
+	Router    bool `json:"router"`
+	WebSocket bool `json:"websocket"`
+	// TLS is "ok" if the conode proved it holds the key of the roster on its
+	// TLS connection, "failed" if it didn't, and "skipped" if it doesn't use
+	// TLS or the check isn't deep.
+	TLS       string        `json:"tls"`
+	Version   string        `json:"version,omitempty"`
+	Go        string        `json:"go,omitempty"`
+	ClockSkew time.Duration `json:"clock_skew"`
+	RoundTrip time.Duration `json:"round_trip"`
+	Errors    []string      `json:"errors,omitempty"`
+}
+
+// OK returns true if all the checks of the conode passed.
+func (r *CheckResult) OK() bool {
+	return len(r.Errors) == 0
+}
+
+func (r *CheckResult) fail(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// CheckRoster checks all the members of the roster in parallel and returns
+// one result per member, in the order of the roster. The suite is the one of
+// the keys of the roster.
+func CheckRoster(ro *onet.Roster, suite network.Suite, opts CheckOptions) []*CheckResult {
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	// an identity of our own for the TLS connections
+	priv := suite.Scalar().Pick(suite.RandomStream())
+	us := network.NewServerIdentity(suite.Point().Mul(priv, nil),
+		network.NewTLSAddress("127.0.0.1:0"))
+	us.SetPrivate(priv)
+
+	results := make([]*CheckResult, len(ro.List))
+	var wg sync.WaitGroup
+	for i, si := range ro.List {
+		wg.Add(1)
+		go func(i int, si *network.ServerIdentity) {
+			defer wg.Done()
+			results[i] = checkConode(si, us, suite, opts)
+		}(i, si)
+	}
+	wg.Wait()
+	return results
+}
+
+// checkConode runs the checks of a member of the roster.
+func checkConode(si, us *network.ServerIdentity, suite network.Suite,
+	opts CheckOptions) *CheckResult {
+	r := &CheckResult{
+		Address:     si.Address,
+		Public:      si.Public.String(),
+		Description: si.Description,
+		TLS:         "skipped",
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", si.Address.NetworkAddress(), opts.Timeout)
+	if err != nil {
+		r.fail("router: %v", err)
+	} else {
+		r.RoundTrip = time.Since(start)
+		r.Router = true
+		conn.Close()
+	}
+
+	wsURL, err := webSocketURL(si)
+	if err != nil {
+		r.fail("websocket: %v", err)
+		return r
+	}
+	conn, err = net.DialTimeout("tcp", wsURL.Host, opts.Timeout)
+	if err != nil {
+		r.fail("websocket: %v", err)
+	} else {
+		r.WebSocket = true
+		conn.Close()
+	}
+
+	if !opts.Deep {
+		return r
+	}
+	if r.Router && si.Address.ConnType() == network.TLS {
+		if err := checkTLS(si, us, suite, opts.Timeout); err != nil {
+			r.TLS = "failed"
+			r.fail("tls: %v", err)
+		} else {
+			r.TLS = "ok"
+		}
+	}
+	if r.WebSocket {
+		if err := checkVersion(r, wsURL, opts); err != nil {
+			r.fail("version: %v", err)
+		}
+	}
+	return r
+}
+
+// checkTLS makes sure the conode proves it holds the key of si during the
+// TLS handshake.
+func checkTLS(si, us *network.ServerIdentity, suite network.Suite, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		conn, err := network.NewTLSConn(us, si, suite)
+		if err == nil {
+			conn.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return xerrors.New("timeout")
+	}
+}
+
+// checkVersion asks the version and the time of the conode on its
+// WebSocket. The clock skew is measured from the middle of the request.
+func checkVersion(r *CheckResult, wsURL *url.URL, opts CheckOptions) error {
+	client := &http.Client{Timeout: opts.Timeout}
+	u := *wsURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/version"
+	start := time.Now()
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	rtt := time.Since(start)
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("%s", resp.Status)
+	}
+	var vi onet.VersionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&vi); err != nil {
+		return xerrors.Errorf("decoding: %v", err)
+	}
+	r.Version = vi.Version
+	r.Go = vi.Go
+	r.ClockSkew = time.Unix(0, vi.Time).Sub(start.Add(rtt / 2))
+	if opts.MaxClockSkew > 0 && (r.ClockSkew > opts.MaxClockSkew ||
+		r.ClockSkew < -opts.MaxClockSkew) {
+		r.fail("clock skew of %v", r.ClockSkew)
+	}
+	return nil
+}
+
+// webSocketURL returns the URL of the WebSocket of the conode: its URL if it
+// has one, else the port after the one of the router.
+func webSocketURL(si *network.ServerIdentity) (*url.URL, error) {
+	if si.URL != "" {
+		u, err := url.Parse(si.URL)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing url: %v", err)
+		}
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			u.Host = net.JoinHostPort(u.Hostname(), port)
+		}
+		return u, nil
+	}
+	p, err := strconv.Atoi(si.Address.Port())
+	if err != nil {
+		return nil, xerrors.Errorf("parsing port: %v", err)
+	}
+	return &url.URL{Scheme: "http",
+		Host: net.JoinHostPort(si.Address.Host(), strconv.Itoa(p+1))}, nil
+}
+
+// CheckCommand checks the conodes of a group file, for monitoring scripts
+// with --json. It fails if any check failed. It is part of ConodeCommands.
+var CheckCommand = cli.Command{
+	Name:      "check",
+	Usage:     "check that the conodes of a group are reachable and well configured",
+	ArgsUsage: "group.toml",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "deep",
+			Usage: "also check the TLS identity, version, clock and latency of the conodes",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the results as JSON",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: 5 * time.Second,
+			Usage: "timeout of each connection",
+		},
+		cli.DurationFlag{
+			Name:  "max-skew",
+			Value: 5 * time.Second,
+			Usage: "largest clock skew accepted, 0 for any",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return xerrors.New("please give the group file")
+		}
+		f, err := os.Open(c.Args().First())
+		if err != nil {
+			return xerrors.Errorf("opening group: %v", err)
+		}
+		defer f.Close()
+		gt := &GroupToml{}
+		if _, err := toml.DecodeReader(f, gt); err != nil {
+			return xerrors.Errorf("reading group: %v", err)
+		}
+		group, err := ReadGroupDescToml(strings.NewReader(gt.String()))
+		if err != nil {
+			return xerrors.Errorf("reading group: %v", err)
+		}
+		suiteName := "Ed25519"
+		if len(gt.Servers) > 0 && gt.Servers[0].Suite != "" {
+			suiteName = gt.Servers[0].Suite
+		}
+		suite, err := suites.Find(suiteName)
+		if err != nil {
+			return xerrors.Errorf("kyber suite: %v", err)
+		}
+
+		results := CheckRoster(group.Roster, suite, CheckOptions{
+			Deep:         c.Bool("deep"),
+			Timeout:      c.Duration("timeout"),
+			MaxClockSkew: c.Duration("max-skew"),
+		})
+		failed := 0
+		for _, r := range results {
+			if !r.OK() {
+				failed++
+			}
+		}
+		if c.Bool("json") {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(results); err != nil {
+				return xerrors.Errorf("encoding: %v", err)
+			}
+		} else {
+			for _, r := range results {
+				printCheckResult(r, c.Bool("deep"))
+			}
+		}
+		if failed > 0 {
+			return xerrors.Errorf("%d out of %d conodes failed the check", failed, len(results))
+		}
+		return nil
+	},
+}
+
+// printCheckResult writes the result in a human readable way.
+func printCheckResult(r *CheckResult, deep bool) {
+	status := "ok"
+	if !r.OK() {
+		status = "FAILED"
+	}
+	fmt.Fprintf(out, "%s %s: router %v, websocket %v", r.Address, status, r.Router, r.WebSocket)
+	if deep {
+		fmt.Fprintf(out, ", tls %s, version %s, clock skew %v, roundtrip %v",
+			r.TLS, r.Version, r.ClockSkew, r.RoundTrip)
+	}
+	fmt.Fprintln(out)
+	for _, e := range r.Errors {
+		fmt.Fprintln(out, "  -", e)
+	}
+}
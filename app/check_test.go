@@ -0,0 +1,130 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestCheckRoster(t *testing.T) {
+	suite := suites.MustFind("Ed25519")
+	local := onet.NewTCPTest(suite)
+	defer local.CloseAll()
+	servers, ro, _ := local.GenTree(2, false)
+
+	results := CheckRoster(ro, suite, CheckOptions{Timeout: time.Second})
+	require.Len(t, results, 2)
+	for _, r := range results {
+		require.True(t, r.OK(), r.Errors)
+		require.True(t, r.Router)
+		require.True(t, r.WebSocket)
+		require.Equal(t, "skipped", r.TLS)
+		require.Empty(t, r.Version)
+	}
+
+	results = CheckRoster(ro, suite, CheckOptions{Deep: true, Timeout: time.Second,
+		MaxClockSkew: time.Second})
+	for _, r := range results {
+		require.True(t, r.OK(), r.Errors)
+		require.Equal(t, "skipped", r.TLS)
+		require.NotEmpty(t, r.Version)
+		require.NotEmpty(t, r.Go)
+		require.True(t, r.RoundTrip > 0)
+	}
+
+	require.NoError(t, servers[1].Close())
+	results = CheckRoster(ro, suite, CheckOptions{Deep: true, Timeout: time.Second})
+	require.True(t, results[0].OK())
+	require.False(t, results[1].OK())
+	require.False(t, results[1].Router)
+	require.False(t, results[1].WebSocket)
+}
+
+// newTLSServer starts a conode with a key of the suite on a TLS address.
+func newTLSServer(t *testing.T, suite suites.Suite) *onet.Server {
+	// a free port for the websocket
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	kp := suite.Scalar().Pick(suite.RandomStream())
+	si := network.NewServerIdentity(suite.Point().Mul(kp, nil),
+		network.NewTLSAddress(fmt.Sprintf("127.0.0.1:%d", port-1)))
+	si.SetPrivate(kp)
+	srv := onet.NewServerTCP(si, suite)
+	srv.StartInBackground()
+	return srv
+}
+
+func TestCheckRoster_TLS(t *testing.T) {
+	suite := suites.MustFind("Ed25519")
+	bn := suites.MustFind("bn256.g2")
+	srv := newTLSServer(t, suite)
+	defer srv.Close()
+	srvBn := newTLSServer(t, bn)
+	defer srvBn.Close()
+
+	opts := CheckOptions{Deep: true, Timeout: time.Second}
+	results := CheckRoster(onet.NewRoster([]*network.ServerIdentity{srv.ServerIdentity}),
+		suite, opts)
+	require.Equal(t, "ok", results[0].TLS, "%v", results[0].Errors)
+	// a roster of BLS keys
+	results = CheckRoster(onet.NewRoster([]*network.ServerIdentity{srvBn.ServerIdentity}),
+		bn, opts)
+	require.Equal(t, "ok", results[0].TLS, "%v", results[0].Errors)
+
+	// a roster with another key for the conode: the handshake can't prove
+	// the conode holds it
+	other := network.NewServerIdentity(suite.Point().Pick(suite.RandomStream()),
+		srv.ServerIdentity.Address)
+	results = CheckRoster(onet.NewRoster([]*network.ServerIdentity{other}), suite, opts)
+	require.False(t, results[0].OK())
+	require.Equal(t, "failed", results[0].TLS)
+}
+
+func TestCheckCommand(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "check")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	suite := suites.MustFind("Ed25519")
+	local := onet.NewTCPTest(suite)
+	defer local.CloseAll()
+	_, ro, _ := local.GenTree(2, false)
+	groupFile := path.Join(tmp, "group.toml")
+	var servers []*ServerToml
+	for _, si := range ro.List {
+		servers = append(servers, NewServerToml(suite, si.Public, si.Address, "", nil))
+	}
+	require.NoError(t, NewGroupToml(servers...).Save(groupFile))
+
+	o.Reset()
+	require.NoError(t, runCheck("--json", "--deep", groupFile))
+	var results []*CheckResult
+	require.NoError(t, json.Unmarshal(o.Bytes(), &results))
+	require.Len(t, results, 2)
+	require.True(t, results[1].OK())
+	require.Equal(t, ro.List[1].Address, results[1].Address)
+
+	o.Reset()
+	require.NoError(t, runCheck(groupFile))
+	require.Contains(t, o.String(), ro.List[0].Address.String()+" ok: router true")
+}
+
+func runCheck(args ...string) error {
+	app := cli.NewApp()
+	app.Commands = ConodeCommands
+	return app.Run(append([]string{"conode", "check"}, args...))
+}
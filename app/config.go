@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"go.dedis.ch/kyber/v3"
@@ -17,6 +21,7 @@ import (
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/onet/v3/plugin"
 	"golang.org/x/xerrors"
 )
 
@@ -24,23 +29,90 @@ import (
 // - Suite: The cryptographic suite
 // - Public: The public key
 // - Private: The Private key
+// - EncryptedPrivate: The Private key encrypted with a passphrase, see SetPassphrase
+// - PrivateURL: URL of the Private key in a key provider, like vault://secret/data/conode#private
 // - Address: The external address of the conode, used by others to connect to this one
 // - ListenAddress: The address this conode is listening on
 // - Description: The description
 // - URL: The URL where this server can be contacted externally.
 // - WebSocketTLSCertificate: TLS certificate for the WebSocket
 // - WebSocketTLSCertificateKey: TLS certificate key for the WebSocket
+// - KeyRefresh: how often the TLS certificate and key of key providers are fetched again, like "10m"
+// - Plugins: directory holding the binaries of external service plugins
+// - Config: configuration sections of the services, indexed by service name
+// - StorageQuotas: maximum bytes each service may store, indexed by service name
+// - StorageBackend: database of the services, "bbolt" (default), "memory" or a registered one, like "badger" and "sqlite"
+// - StorageEncryption: source of the key encrypting the values of the database
+// - StorageKey: first private key of a conode whose key was rotated, which its database keeps, see RotateKey
+// - EncryptedStorageKey: The StorageKey encrypted with the passphrase of the Private key
+// - StorageIntegrity: maintain and verify checksums of the values of the database
+// - Restore: snapshot of the database restored at startup, and the services taken from it
+// - Compaction: daily quiet window during which the database is compacted
+// - Backup: S3-compatible object storage receiving backups of the database
+// - MetricsToken: bearer token required to access the /metrics endpoint
+// - CORS: origins, methods and headers allowed for browsers using the API
+// - ServiceCORS: CORS policies of specific services, indexed by service name
+// - Audit: file, rotation and hash-chaining of the log of client requests
+// - Admin: unix socket, or loopback address and token, of the admin interface
+// - Log: file receiving the messages of the log, with its rotation
+// - Syslog: facility and tag of the messages of the log sent to the local syslog
+// - Journald: identifier of the messages of the log sent to systemd-journald
+// - LogLevels: log levels of some packages or files, indexed by their name
+// - Ship: Loki or Elasticsearch server receiving the messages of the log
+// - KeepAlive: interval of the pings measuring the round-trip times to the other conodes, like "30s"
+// - Crash: directory receiving the reports of the panics of the protocols and the services
+// - Sentry: Sentry project receiving the panics and the errors of the log
+// - StrictVersions: refuse the conodes running incompatible versions of onet or of the protocols
+// - Suites: suites accepted from the other conodes besides our own, negotiated with them
+// - PublicAddress: STUN servers and group asked at startup if Address has the public IP of the conode
+// - IPFilter: CIDRs allowed and denied to connect to the conode and its websocket
+// - UpgradeOnSIGHUP: restart the binary of the conode on SIGHUP without stopping it, needs NotifyAccess=main under systemd
 type CothorityConfig struct {
 	Suite                      string
 	Public                     string
 	Services                   map[string]ServiceConfig
 	Private                    string
+	EncryptedPrivate           *EncryptedKey `toml:",omitempty"`
+	PrivateURL                 string        `toml:",omitempty"`
 	Address                    network.Address
 	ListenAddress              string
 	Description                string
 	URL                        string
 	WebSocketTLSCertificate    CertificateURL
 	WebSocketTLSCertificateKey CertificateURL
+	KeyRefresh                 string                            `toml:",omitempty"`
+	Plugins                    string                            `toml:",omitempty"`
+	Config                     map[string]map[string]interface{} `toml:",omitempty"`
+	StorageQuotas              map[string]int64                  `toml:",omitempty"`
+	StorageBackend             string                            `toml:",omitempty"`
+	StorageEncryption          *onet.StorageEncryption           `toml:",omitempty"`
+	StorageKey                 string                            `toml:",omitempty"`
+	EncryptedStorageKey        *EncryptedKey                     `toml:",omitempty"`
+	StorageIntegrity           bool                              `toml:",omitempty"`
+	Restore                    *onet.StorageRestore              `toml:",omitempty"`
+	Compaction                 *onet.CompactionConfig            `toml:",omitempty"`
+	Backup                     *onet.BackupConfig                `toml:",omitempty"`
+	MetricsToken               string                            `toml:",omitempty"`
+	CORS                       *onet.CORSConfig                  `toml:",omitempty"`
+	ServiceCORS                map[string]*onet.CORSConfig       `toml:",omitempty"`
+	Audit                      *onet.AuditConfig                 `toml:",omitempty"`
+	Admin                      *onet.AdminConfig                 `toml:",omitempty"`
+	Log                        *log.FileConfig                   `toml:",omitempty"`
+	Syslog                     *log.SyslogConfig                 `toml:",omitempty"`
+	Journald                   *log.JournaldConfig               `toml:",omitempty"`
+	LogLevels                  map[string]int                    `toml:",omitempty"`
+	Ship                       *log.ShipperConfig                `toml:",omitempty"`
+	KeepAlive                  string                            `toml:",omitempty"`
+	Crash                      *onet.CrashConfig                 `toml:",omitempty"`
+	Sentry                     *onet.SentryConfig                `toml:",omitempty"`
+	StrictVersions             bool                              `toml:",omitempty"`
+	Suites                     []string                          `toml:",omitempty"`
+	PublicAddress              *onet.PublicAddressConfig         `toml:",omitempty"`
+	IPFilter                   *network.IPFilterConfig           `toml:",omitempty"`
+	UpgradeOnSIGHUP            bool                              `toml:",omitempty"`
+	// passphrase encrypting the private key when saved, nil to save it in
+	// clear
+	passphrase []byte
 }
 
 // ServiceConfig is the configuration of a specific service to override
@@ -55,26 +127,86 @@ type ServiceConfig struct {
 // will return an error if the file couldn't be created or if
 // there is an error in the encoding.
 func (hc *CothorityConfig) Save(file string) error {
+	saved := *hc
+	saved.EncryptedPrivate = nil
+	saved.EncryptedStorageKey = nil
+	if hc.PrivateURL != "" {
+		// the key stays in its provider
+		saved.Private = ""
+	} else if hc.passphrase != nil {
+		ek, err := encryptKey(hc.Private, hc.passphrase)
+		if err != nil {
+			return xerrors.Errorf("encrypting private key: %v", err)
+		}
+		saved.Private = ""
+		saved.EncryptedPrivate = ek
+	}
+	if hc.passphrase != nil && hc.StorageKey != "" {
+		ek, err := encryptKey(hc.StorageKey, hc.passphrase)
+		if err != nil {
+			return xerrors.Errorf("encrypting storage key: %v", err)
+		}
+		saved.StorageKey = ""
+		saved.EncryptedStorageKey = ek
+	}
 	fd, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return xerrors.Errorf("opening config file: %v", err)
 	}
+	defer fd.Close()
 	fd.WriteString("# This file contains your private key.\n")
 	fd.WriteString("# Do not give it away lightly!\n")
-	err = toml.NewEncoder(fd).Encode(hc)
+	err = toml.NewEncoder(fd).Encode(&saved)
 	if err != nil {
 		return xerrors.Errorf("toml encoding: %v", err)
 	}
 	return nil
 }
 
-// LoadCothority loads a conode config from the given file.
+// LoadCothority loads a conode config from the given file. An encrypted
+// private key is decrypted with the passphrase from CONODE_PASSPHRASE, from
+// the file descriptor in CONODE_PASSPHRASE_FD, or asked on the terminal, and
+// is encrypted again when the config is saved. A private key at PrivateURL
+// is fetched from its key provider, and isn't saved.
 func LoadCothority(file string) (*CothorityConfig, error) {
 	hc := &CothorityConfig{}
 	_, err := toml.DecodeFile(file, hc)
 	if err != nil {
 		return nil, xerrors.Errorf("toml decoding: %v", err)
 	}
+	if hc.EncryptedPrivate != nil {
+		passphrase, err := passphraseFor(file)
+		if err != nil {
+			return nil, err
+		}
+		hc.Private, err = hc.EncryptedPrivate.Decrypt(passphrase)
+		if err != nil {
+			rememberPassphrase(file, nil)
+			return nil, xerrors.Errorf("decrypting private key: %v", err)
+		}
+		hc.EncryptedPrivate = nil
+		hc.passphrase = passphrase
+	}
+	if hc.EncryptedStorageKey != nil {
+		passphrase, err := passphraseFor(file)
+		if err != nil {
+			return nil, err
+		}
+		hc.StorageKey, err = hc.EncryptedStorageKey.Decrypt(passphrase)
+		if err != nil {
+			rememberPassphrase(file, nil)
+			return nil, xerrors.Errorf("decrypting storage key: %v", err)
+		}
+		hc.EncryptedStorageKey = nil
+		hc.passphrase = passphrase
+	}
+	if hc.Private == "" && hc.PrivateURL != "" {
+		key, err := onet.FetchKey(hc.PrivateURL)
+		if err != nil {
+			return nil, xerrors.Errorf("private key: %v", err)
+		}
+		hc.Private = strings.TrimSpace(string(key))
+	}
 
 	// Backwards compatibility with configs before we included the suite name
 	if hc.Suite == "" {
@@ -83,6 +215,35 @@ func LoadCothority(file string) (*CothorityConfig, error) {
 	return hc, nil
 }
 
+// ServiceConfigs returns the configurations of all registered services that
+// declared one with onet.RegisterServiceConfig. The defaults of a service are
+// overwritten by the values of its section in the config file, for example
+// [Config.Skipchain] for the Skipchain service.
+func (hc *CothorityConfig) ServiceConfigs() (map[string]interface{}, error) {
+	configs := make(map[string]interface{})
+	for _, name := range onet.ServiceFactory.RegisteredServiceNames() {
+		cfg := onet.ServiceFactory.NewConfig(name)
+		if cfg == nil {
+			continue
+		}
+		if section, ok := hc.Config[name]; ok {
+			// Re-encode the section so that the toml library can decode it
+			// into the config type of the service.
+			var buf bytes.Buffer
+			err := toml.NewEncoder(&buf).Encode(section)
+			if err != nil {
+				return nil, xerrors.Errorf("encoding config of %s: %v", name, err)
+			}
+			_, err = toml.Decode(buf.String(), cfg)
+			if err != nil {
+				return nil, xerrors.Errorf("decoding config of %s: %v", name, err)
+			}
+		}
+		configs[name] = cfg
+	}
+	return configs, nil
+}
+
 // GetServerIdentity will convert a CothorityConfig into a *network.ServerIdentity.
 // It can give an error if there is a problem parsing the strings from the CothorityConfig.
 func (hc *CothorityConfig) GetServerIdentity() (*network.ServerIdentity, error) {
@@ -107,7 +268,7 @@ func (hc *CothorityConfig) GetServerIdentity() (*network.ServerIdentity, error)
 	if hc.WebSocketTLSCertificateKey != "" {
 		if hc.URL != "" {
 			si.URL = strings.Replace(hc.URL, "http://", "https://", 0)
-		} else {
+		} else if si.Address.Port() != "0" {
 			p, err := strconv.Atoi(si.Address.Port())
 			if err != nil {
 				return nil, xerrors.Errorf("port conversion: %v")
@@ -121,6 +282,66 @@ func (hc *CothorityConfig) GetServerIdentity() (*network.ServerIdentity, error)
 	return si, nil
 }
 
+// storageKey returns the StorageKey, or nil if there is none.
+func (hc *CothorityConfig) storageKey(suite network.Suite) (kyber.Scalar, error) {
+	if hc.StorageKey == "" {
+		return nil, nil
+	}
+	key, err := encoding.StringHexToScalar(suite, hc.StorageKey)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing storage key: %v", err)
+	}
+	return key, nil
+}
+
+// storagePublic returns the public key naming the database and its backups:
+// the one of the StorageKey, or of the conode if there is none.
+func (hc *CothorityConfig) storagePublic() (kyber.Point, error) {
+	suite, err := suites.Find(hc.Suite)
+	if err != nil {
+		return nil, xerrors.Errorf("kyber suite: %v", err)
+	}
+	key, err := hc.storageKey(suite)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		return suite.Point().Mul(key, nil), nil
+	}
+	si, err := hc.GetServerIdentity()
+	if err != nil {
+		return nil, xerrors.Errorf("parsing identity: %v", err)
+	}
+	return si.Public, nil
+}
+
+// saveServiceKeys replaces the key pairs of the services in the config file.
+// The ones of the services that aren't registered are kept.
+func (hc *CothorityConfig) saveServiceKeys(file string, keys []network.ServiceIdentity) error {
+	services := make(map[string]ServiceConfig)
+	for name, sc := range hc.Services {
+		services[name] = sc
+	}
+	for _, sid := range keys {
+		suite, err := suites.Find(sid.Suite)
+		if err != nil {
+			return xerrors.Errorf("suite of %s: %v", sid.Name, err)
+		}
+		sc := ServiceConfig{Suite: sid.Suite}
+		if sc.Public, err = encoding.PointToStringHex(suite, sid.Public); err != nil {
+			return xerrors.Errorf("encoding %s: %v", sid.Name, err)
+		}
+		if sid.GetPrivate() != nil {
+			if sc.Private, err = encoding.ScalarToStringHex(suite, sid.GetPrivate()); err != nil {
+				return xerrors.Errorf("encoding %s: %v", sid.Name, err)
+			}
+		}
+		services[sid.Name] = sc
+	}
+	hc.Services = services
+	return hc.Save(file)
+}
+
 // ParseCothority parses the config file into a CothorityConfig.
 // It returns the CothorityConfig, the Host so we can already use it, and an error if
 // the file is inaccessible or has wrong values in it.
@@ -129,23 +350,110 @@ func ParseCothority(file string) (*CothorityConfig, *onet.Server, error) {
 	if err != nil {
 		return nil, nil, xerrors.Errorf("reading config: %v", err)
 	}
+	server, err := hc.newServer(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hc, server, nil
+}
+
+// newServer creates the server of the config. The keys generated by the
+// services are saved in the config file, unless it is empty.
+func (hc *CothorityConfig) newServer(file string) (*onet.Server, error) {
 	suite, err := suites.Find(hc.Suite)
 	if err != nil {
-		return nil, nil, xerrors.Errorf("kyber suite: %v", err)
+		return nil, xerrors.Errorf("kyber suite: %v", err)
 	}
 
 	si, err := hc.GetServerIdentity()
 	if err != nil {
-		return nil, nil, xerrors.Errorf("parse server identity: %v", err)
+		return nil, xerrors.Errorf("parse server identity: %v", err)
+	}
+
+	// Plugins need to be registered before the server instantiates the
+	// services.
+	if hc.Plugins != "" {
+		if err := loadPlugins(hc.Plugins); err != nil {
+			return nil, xerrors.Errorf("loading plugins: %v", err)
+		}
+	}
+
+	configs, err := hc.ServiceConfigs()
+	if err != nil {
+		return nil, xerrors.Errorf("service configs: %v", err)
+	}
+
+	var publicAddress *onet.PublicAddressConfig
+	if hc.PublicAddress != nil {
+		pa := *hc.PublicAddress
+		if pa.Group != "" {
+			f, err := os.Open(pa.Group)
+			if err != nil {
+				return nil, xerrors.Errorf("opening group of PublicAddress: %v", err)
+			}
+			group, err := ReadGroupDescToml(f)
+			f.Close()
+			if err != nil {
+				return nil, xerrors.Errorf("reading group of PublicAddress: %v", err)
+			}
+			pa.Peers = append(pa.Peers, group.Roster.List...)
+		}
+		publicAddress = &pa
+	}
+
+	var keepAlive time.Duration
+	if hc.KeepAlive != "" {
+		keepAlive, err = time.ParseDuration(hc.KeepAlive)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid KeepAlive %q", hc.KeepAlive)
+		}
+	}
+
+	storageKey, err := hc.storageKey(suite)
+	if err != nil {
+		return nil, err
 	}
 
 	// Same as `NewServerTCP` if `hc.ListenAddress` is empty
-	server := onet.NewServerTCPWithListenAddr(si, suite, hc.ListenAddress)
+	opts := onet.ServerOptions{
+		ListenAddress:     hc.ListenAddress,
+		ServiceConfigs:    configs,
+		StorageQuotas:     hc.StorageQuotas,
+		StorageBackend:    hc.StorageBackend,
+		StorageEncryption: hc.StorageEncryption,
+		StorageKey:        storageKey,
+		StorageIntegrity:  hc.StorageIntegrity,
+		Restore:           hc.Restore,
+		Compaction:        hc.Compaction,
+		Backup:            hc.Backup,
+		MetricsToken:      hc.MetricsToken,
+		CORS:              hc.CORS,
+		ServiceCORS:       hc.ServiceCORS,
+		Audit:             hc.Audit,
+		Admin:             hc.Admin,
+		KeepAlive:         keepAlive,
+		Crash:             hc.Crash,
+		Sentry:            hc.Sentry,
+		StrictVersions:    hc.StrictVersions,
+		Suites:            hc.Suites,
+		PublicAddress:     publicAddress,
+		IPFilter:          hc.IPFilter,
+	}
+	if file != "" {
+		opts.SaveServiceKeys = func(keys []network.ServiceIdentity) error {
+			return hc.saveServiceKeys(file, keys)
+		}
+	}
+	// the previous process of an upgraded conode hands over once the
+	// configuration is loaded, and the database is opened when it closes
+	notifyUpgradeReady()
+	server := onet.NewServerTCPWithOptions(si, suite, opts)
 
 	// Set Websocket TLS if possible
 	if hc.WebSocketTLSCertificate != "" && hc.WebSocketTLSCertificateKey != "" {
-		if hc.WebSocketTLSCertificate.CertificateURLType() == File &&
-			hc.WebSocketTLSCertificateKey.CertificateURLType() == File {
+		certType := hc.WebSocketTLSCertificate.CertificateURLType()
+		keyType := hc.WebSocketTLSCertificateKey.CertificateURLType()
+		if certType == File && keyType == File {
 			// Use the reloader only when both are files as it doesn't
 			// make sense for string embedded certificates.
 
@@ -154,7 +462,36 @@ func ParseCothority(file string) (*CothorityConfig, *onet.Server, error) {
 				hc.WebSocketTLSCertificateKey.blobPart(),
 			)
 			if err != nil {
-				return nil, nil, xerrors.Errorf("certificate: %v", err)
+				return nil, xerrors.Errorf("certificate: %v", err)
+			}
+
+			server.WebSocket.Lock()
+			server.WebSocket.TLSConfig = &tls.Config{
+				GetCertificate: cr.GetCertificateFunc(),
+			}
+			server.WebSocket.Unlock()
+		} else if certType == Provider || keyType == Provider {
+			// Fetch them again regularly, to get them once rotated.
+			refresh := DefaultKeyRefresh
+			if hc.KeyRefresh != "" {
+				refresh, err = time.ParseDuration(hc.KeyRefresh)
+				if err != nil {
+					return nil, xerrors.Errorf("invalid KeyRefresh %q", hc.KeyRefresh)
+				}
+			}
+			cr, err := onet.NewCertificateReloaderFunc(func() ([]byte, []byte, error) {
+				cert, err := hc.WebSocketTLSCertificate.Content()
+				if err != nil {
+					return nil, nil, err
+				}
+				key, err := hc.WebSocketTLSCertificateKey.Content()
+				if err != nil {
+					return nil, nil, err
+				}
+				return cert, key, nil
+			}, refresh)
+			if err != nil {
+				return nil, xerrors.Errorf("certificate: %v", err)
 			}
 
 			server.WebSocket.Lock()
@@ -165,15 +502,15 @@ func ParseCothority(file string) (*CothorityConfig, *onet.Server, error) {
 		} else {
 			tlsCertificate, err := hc.WebSocketTLSCertificate.Content()
 			if err != nil {
-				return nil, nil, xerrors.Errorf("getting WebSocketTLSCertificate content: %v", err)
+				return nil, xerrors.Errorf("getting WebSocketTLSCertificate content: %v", err)
 			}
 			tlsCertificateKey, err := hc.WebSocketTLSCertificateKey.Content()
 			if err != nil {
-				return nil, nil, xerrors.Errorf("getting WebSocketTLSCertificateKey content: %v", err)
+				return nil, xerrors.Errorf("getting WebSocketTLSCertificateKey content: %v", err)
 			}
 			cert, err := tls.X509KeyPair(tlsCertificate, tlsCertificateKey)
 			if err != nil {
-				return nil, nil, xerrors.Errorf("loading X509KeyPair: %v", err)
+				return nil, xerrors.Errorf("loading X509KeyPair: %v", err)
 			}
 
 			server.WebSocket.Lock()
@@ -183,7 +520,125 @@ func ParseCothority(file string) (*CothorityConfig, *onet.Server, error) {
 			server.WebSocket.Unlock()
 		}
 	}
-	return hc, server, nil
+	return server, nil
+}
+
+// ParseCothorities parses the configuration files of several conodes, so that
+// they can run in the same process. Each conode has its own listeners,
+// database and service instances. The conodes must have different public keys
+// and addresses, and can't share a port: neither the port of the router, nor
+// the port above the address where the websocket listens.
+func ParseCothorities(files ...string) ([]*CothorityConfig, []*onet.Server, error) {
+	publics := make(map[string]string)
+	addresses := make(map[network.Address]string)
+	ports := make(map[int]string)
+	for _, file := range files {
+		hc, err := LoadCothority(file)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("reading config %s: %v", file, err)
+		}
+		if other, ok := publics[hc.Public]; ok {
+			return nil, nil, xerrors.Errorf("%s and %s have the same public key",
+				other, file)
+		}
+		publics[hc.Public] = file
+		if other, ok := addresses[hc.Address]; ok {
+			return nil, nil, xerrors.Errorf("%s and %s have the same address",
+				other, file)
+		}
+		addresses[hc.Address] = file
+		used, err := hc.listenPorts()
+		if err != nil {
+			return nil, nil, xerrors.Errorf("config %s: %v", file, err)
+		}
+		for _, port := range used {
+			if other, ok := ports[port]; ok {
+				return nil, nil, xerrors.Errorf("%s and %s both listen on port %d",
+					other, file, port)
+			}
+			ports[port] = file
+		}
+	}
+
+	var configs []*CothorityConfig
+	var servers []*onet.Server
+	for _, file := range files {
+		hc, server, err := ParseCothority(file)
+		if err != nil {
+			for _, s := range servers {
+				s.Close()
+			}
+			return nil, nil, xerrors.Errorf("parsing %s: %v", file, err)
+		}
+		configs = append(configs, hc)
+		servers = append(servers, server)
+	}
+	return configs, servers, nil
+}
+
+// listenPorts returns the ports the conode listens on: the port of the
+// router, from the listen address if there is one, and the port above the
+// address for the websocket, which listens on all interfaces. Port 0, which
+// is chosen by the system, is not returned, and with an address of port 0,
+// the websocket also binds a free port.
+func (hc *CothorityConfig) listenPorts() ([]int, error) {
+	port, err := strconv.Atoi(hc.Address.Port())
+	if err != nil {
+		return nil, xerrors.Errorf("invalid port of address %s", hc.Address)
+	}
+	routerPort := port
+	if hc.ListenAddress != "" {
+		_, p, err := net.SplitHostPort(hc.ListenAddress)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid listen address: %v", err)
+		}
+		routerPort, err = strconv.Atoi(p)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid port of listen address %s",
+				hc.ListenAddress)
+		}
+	}
+	if port == 0 {
+		// the websocket binds a free port
+		if routerPort == 0 {
+			return nil, nil
+		}
+		return []int{routerPort}, nil
+	}
+	if routerPort == port+1 {
+		return nil, xerrors.Errorf("the router and the websocket both listen on port %d",
+			routerPort)
+	}
+	if routerPort == 0 {
+		return []int{port + 1}, nil
+	}
+	return []int{routerPort, port + 1}, nil
+}
+
+// loadedPlugins holds the plugin directories already loaded, as the services
+// of a plugin can only be registered once per process.
+var loadedPlugins = struct {
+	sync.Mutex
+	dirs map[string]bool
+}{dirs: make(map[string]bool)}
+
+// loadPlugins loads the plugins of the directory, unless another conode of
+// this process already loaded them.
+func loadPlugins(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return xerrors.Errorf("plugin directory: %v", err)
+	}
+	loadedPlugins.Lock()
+	defer loadedPlugins.Unlock()
+	if loadedPlugins.dirs[abs] {
+		return nil
+	}
+	if _, err := plugin.LoadDir(abs); err != nil {
+		return err
+	}
+	loadedPlugins.dirs[abs] = true
+	return nil
 }
 
 // GroupToml holds the data of the group.toml file.
@@ -240,7 +695,10 @@ func (g *Group) Toml(suite suites.Suite) (*GroupToml, error) {
 
 		services := make(map[string]ServerServiceConfig)
 		for _, sid := range si.ServiceIdentities {
-			suite := onet.ServiceFactory.Suite(sid.Name)
+			suite, err := suites.Find(sid.Suite)
+			if err != nil {
+				return nil, xerrors.Errorf("suite of service key: %v", err)
+			}
 
 			pub, err := encoding.PointToStringHex(suite, sid.Public)
 			if err != nil {
@@ -409,12 +867,20 @@ const (
 	// File is a CertificateURL type that contains the path to a file
 	// containing a certificate.
 	File = "file"
+	// Provider is the CertificateURL type of the URLs of the registered
+	// key providers, like vault://secret/data/conode#tls_key, see
+	// onet.RegisterKeyProvider.
+	Provider = "provider"
 	// InvalidCertificateURLType is an invalid CertificateURL type.
 	InvalidCertificateURLType = "wrong"
 	// DefaultCertificateURLType is the default type when no type is specified
 	DefaultCertificateURLType = File
 )
 
+// DefaultKeyRefresh is how often the TLS certificate and key of the websocket
+// are fetched again from their key providers, if KeyRefresh is empty.
+const DefaultKeyRefresh = 10 * time.Minute
+
 // typeCertificateURLSep is the separator between the type of the URL
 // certificate and the string that identifies the certificate (e.g.
 // filepath, content).
@@ -426,6 +892,9 @@ func certificateURLType(t string) CertificateURLType {
 	if t == "" {
 		return DefaultCertificateURLType
 	}
+	if onet.IsKeyProviderURL(t + typeCertificateURLSep) {
+		return Provider
+	}
 	cuType := CertificateURLType(t)
 	types := []CertificateURLType{String, File}
 	for _, t := range types {
@@ -478,6 +947,9 @@ func (cu CertificateURL) Content() ([]byte, error) {
 		}
 		return dat, nil
 	}
+	if cuType == Provider {
+		return onet.FetchKey(string(cu))
+	}
 	return nil, xerrors.Errorf("Unknown CertificateURL type (%s), cannot get its content", cuType)
 }
 
@@ -540,7 +1012,15 @@ func parseServerServiceConfig(configs map[string]ServerServiceConfig) []network.
 // parseServiceIdentity creates the service identity
 func parseServiceIdentity(name string, suiteName string, pub string, priv string) (srvid network.ServiceIdentity, err error) {
 	suite := onet.ServiceFactory.Suite(name)
-	if suite == nil {
+	if service := network.ServiceKeyService(name); service != name {
+		// the other keys of a service can be of any suite
+		if onet.ServiceFactory.ServiceID(service).IsNil() {
+			return srvid, xerrors.Errorf("Service `%s` has not been registered", service)
+		}
+		if suite, err = suites.Find(suiteName); err != nil {
+			return srvid, xerrors.Errorf("suite of `%s`: %v", name, err)
+		}
+	} else if suite == nil {
 		return srvid, xerrors.Errorf(
 			"Service `%s` has not been registered with a suite", name)
 	} else if suite.String() != suiteName {
@@ -4,17 +4,20 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
 	"strings"
 	"testing"
 
+	"github.com/BurntSushi/toml"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
 )
 
 var o bytes.Buffer
@@ -132,6 +135,32 @@ func TestSaveGroup(t *testing.T) {
 	require.Contains(t, string(data), serverGroup[strings.LastIndex(serverGroup, "[[servers]]"):])
 }
 
+// TestGroup_Pairing checks that a group of BLS keys is saved and read back.
+func TestGroup_Pairing(t *testing.T) {
+	for _, name := range []string{"bn256.g1", "bn256.g2", "bn256.adapter"} {
+		suite := suites.MustFind(name)
+		var servers []*ServerToml
+		for i := 0; i < 2; i++ {
+			pub := suite.Point().Pick(suite.RandomStream())
+			addr := network.NewTLSAddress(fmt.Sprintf("127.0.0.1:%d", 7770+2*i))
+			servers = append(servers, NewServerToml(suite, pub, addr, "bls", nil))
+		}
+		group, err := ReadGroupDescToml(strings.NewReader(NewGroupToml(servers...).String()))
+		require.NoError(t, err, name)
+		require.Len(t, group.Roster.List, 2)
+
+		gt, err := group.Toml(suite)
+		require.NoError(t, err)
+		again, err := ReadGroupDescToml(strings.NewReader(gt.String()))
+		require.NoError(t, err)
+		for i, si := range again.Roster.List {
+			require.Equal(t, suite.String(), gt.Servers[i].Suite)
+			require.True(t, si.Public.Equal(group.Roster.List[i].Public), name)
+		}
+		require.True(t, again.Roster.Aggregate.Equal(group.Roster.Aggregate))
+	}
+}
+
 func TestParseCothority(t *testing.T) {
 	registerService()
 	defer unregisterService()
@@ -151,6 +180,7 @@ func TestParseCothority(t *testing.T) {
         Address = "%s"
         ListenAddress = "%s"
 		    Description = "%s"
+		KeepAlive = "30s"
 		[services]
 			[services.%s]
 			suite = "bn256.adapter"
@@ -182,10 +212,188 @@ func TestParseCothority(t *testing.T) {
 	require.Equal(t, "bn256.adapter", cothConfig.Services[testServiceName].Suite)
 	require.Equal(t, scPublic, cothConfig.Services[testServiceName].Public)
 	require.Equal(t, scPrivate, cothConfig.Services[testServiceName].Private)
+	require.Equal(t, "30s", cothConfig.KeepAlive)
+
+	srv.Close()
+}
+
+func TestParseCothority_PublicAddress(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conode")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
 
+	suite := suites.MustFind("Ed25519")
+	priv, pub := createKeyPair(suite)
+	group := path.Join(tmp, "public.toml")
+	hc := &CothorityConfig{
+		Suite:         suite.String(),
+		Public:        pub,
+		Private:       priv,
+		Address:       network.NewAddress(network.PlainTCP, "127.0.0.1:7770"),
+		ListenAddress: "127.0.0.1:0",
+		PublicAddress: &onet.PublicAddressConfig{Group: group},
+	}
+	file := path.Join(tmp, "private.toml")
+	require.NoError(t, hc.Save(file))
+	_, _, err = ParseCothority(file)
+	require.Error(t, err)
+
+	require.NoError(t, ioutil.WriteFile(group, []byte(serverGroup), 0600))
+	hc, srv, err := ParseCothority(file)
+	require.NoError(t, err)
+	require.Equal(t, group, hc.PublicAddress.Group)
+	require.Len(t, hc.PublicAddress.Peers, 0)
 	srv.Close()
 }
 
+func TestParseCothorities(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conodes")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	suite := suites.MustFind("Ed25519")
+	var files []string
+	for i := 0; i < 2; i++ {
+		priv, pub := createKeyPair(suite)
+		hc := &CothorityConfig{
+			Suite:         suite.String(),
+			Public:        pub,
+			Private:       priv,
+			Address:       network.NewAddress(network.PlainTCP, fmt.Sprintf("1.2.3.4:%d", 1234+i*2)),
+			ListenAddress: "127.0.0.1:0",
+			Description:   fmt.Sprintf("conode %d", i),
+		}
+		files = append(files, path.Join(tmp, fmt.Sprintf("private%d.toml", i)))
+		require.NoError(t, hc.Save(files[i]))
+	}
+
+	configs, servers, err := ParseCothorities(files...)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(servers))
+	require.Equal(t, "conode 1", configs[1].Description)
+	require.False(t, servers[0].ServerIdentity.Equal(servers[1].ServerIdentity))
+	for _, s := range servers {
+		require.NoError(t, s.Close())
+	}
+
+	// the same conode can't be loaded twice
+	_, _, err = ParseCothorities(files[0], files[0])
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "same public key")
+
+	// the ports of the router and the websocket can't collide
+	save := func(file, address, listen string) {
+		priv, pub := createKeyPair(suite)
+		hc := &CothorityConfig{
+			Suite:         suite.String(),
+			Public:        pub,
+			Private:       priv,
+			Address:       network.NewAddress(network.PlainTCP, address),
+			ListenAddress: listen,
+		}
+		require.NoError(t, hc.Save(path.Join(tmp, file)))
+	}
+	save("a.toml", "1.2.3.4:7000", "")
+	save("b.toml", "1.2.3.5:7001", "")
+	save("c.toml", "1.2.3.6:8000", "127.0.0.1:7001")
+	save("d.toml", "1.2.3.7:9000", "127.0.0.1:9001")
+	for _, pair := range [][]string{{"a.toml", "b.toml"}, {"a.toml", "c.toml"},
+		{"d.toml"}} {
+		var paths []string
+		for _, f := range pair {
+			paths = append(paths, path.Join(tmp, f))
+		}
+		_, _, err = ParseCothorities(paths...)
+		require.Error(t, err, pair)
+		require.Contains(t, err.Error(), "port", pair)
+	}
+}
+
+type testServiceConfig struct {
+	Path    string
+	Retries int
+}
+
+func TestCothorityConfig_SaveServiceKeys(t *testing.T) {
+	registerService()
+	defer unregisterService()
+
+	tmp, err := ioutil.TempDir("", "servicekeys")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	file := path.Join(tmp, "private.toml")
+
+	suite := suites.MustFind("Ed25519")
+	priv, pub := createKeyPair(suite)
+	hc := &CothorityConfig{
+		Suite:    suite.String(),
+		Public:   pub,
+		Private:  priv,
+		Address:  network.NewTCPAddress("127.0.0.1:7770"),
+		Services: GenerateServiceKeyPairs(),
+	}
+	hc.Services["unknown"] = ServiceConfig{Suite: "Ed25519", Public: pub}
+	si, err := hc.GetServerIdentity()
+	require.NoError(t, err)
+	sign := si.GenerateServiceKey(network.ServiceKeyName(testServiceName, "sign"),
+		suites.MustFind("bn256.g1"))
+	require.NoError(t, hc.saveServiceKeys(file, si.ServiceKeys()))
+
+	saved, err := LoadCothority(file)
+	require.NoError(t, err)
+	require.Contains(t, saved.Services, "unknown")
+	si, err = saved.GetServerIdentity()
+	require.NoError(t, err)
+	require.True(t, si.HasServiceKeyPair(sign.Name))
+	require.True(t, si.ServicePrivate(sign.Name).Equal(sign.GetPrivate()))
+
+	// the public key goes to the group file
+	st := NewServerToml(suite, si.Public, si.Address, "", saved.Services)
+	group, err := ReadGroupDescToml(strings.NewReader(NewGroupToml(st).String()))
+	require.NoError(t, err)
+	require.True(t, group.Roster.List[0].HasServicePublic(sign.Name))
+	require.True(t, group.Roster.List[0].ServicePublic(sign.Name).Equal(sign.Public))
+	gt, err := group.Toml(suite)
+	require.NoError(t, err)
+	require.Equal(t, "bn256.G1", gt.Servers[0].Services[sign.Name].Suite)
+
+	// the keys of services that aren't registered are ignored
+	unregisterService()
+	si, err = saved.GetServerIdentity()
+	require.NoError(t, err)
+	require.False(t, si.HasServicePublic(sign.Name))
+}
+
+func TestCothorityConfig_ServiceConfigs(t *testing.T) {
+	name := "OnetConfigTestServiceWithConfig"
+	_, err := onet.RegisterNewService(name, func(c *onet.Context) (onet.Service, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+	defer onet.UnregisterService(name)
+	require.NoError(t, onet.RegisterServiceConfig(name,
+		&testServiceConfig{Path: "/tmp", Retries: 2}))
+
+	hc := &CothorityConfig{}
+	_, err = toml.Decode(fmt.Sprintf(`Suite = "Ed25519"
+		[Config.%s]
+		Retries = 5`, name), hc)
+	require.NoError(t, err)
+
+	configs, err := hc.ServiceConfigs()
+	require.NoError(t, err)
+	require.Equal(t, &testServiceConfig{Path: "/tmp", Retries: 5}, configs[name])
+
+	hc.Config[name]["Retries"] = "five"
+	_, err = hc.ServiceConfigs()
+	require.Error(t, err)
+
+	// Without a section, the defaults are used.
+	configs, err = (&CothorityConfig{}).ServiceConfigs()
+	require.NoError(t, err)
+	require.Equal(t, &testServiceConfig{Path: "/tmp", Retries: 2}, configs[name])
+}
+
 func TestParseCothorityWithTLSWebSocket(t *testing.T) {
 	suite := "Ed25519"
 	public := "6a921638a4ade8970ebcd9e371570f08d71a24987f90f12391b9f6c525be5be4"
@@ -245,6 +453,12 @@ f9Oeos0UUothgiDktdQHxdNEwLjQf7lJJBzV+5OtwswCWA==
 	keyFile.WriteString(wsTLSCertKey)
 	keyFile.Close()
 
+	onet.RegisterKeyProvider("testkeys", testKeyProvider{
+		"private": private,
+		"cert":    wsTLSCert,
+		"key":     wsTLSCertKey,
+	})
+
 	// Testing different ways of putting TLS info.
 	privateInfos := []string{
 		fmt.Sprintf(`Suite = "%s"
@@ -277,6 +491,15 @@ f9Oeos0UUothgiDktdQHxdNEwLjQf7lJJBzV+5OtwswCWA==
             WebSocketTLSCertificateKey = "%s"`,
 			suite, public, private, address, listenAddr,
 			description, certFile.Name(), keyFile.Name()),
+		fmt.Sprintf(`Suite = "%s"
+            Public = "%s"
+            PrivateURL = "testkeys://private"
+            Address = "%s"
+            ListenAddress = "%s"
+            Description = "%s"
+            WebSocketTLSCertificate = "testkeys://cert"
+            WebSocketTLSCertificateKey = "testkeys://key"`,
+			suite, public, address, listenAddr, description),
 	}
 
 	for i, privateInfo := range privateInfos {
@@ -321,3 +544,14 @@ f9Oeos0UUothgiDktdQHxdNEwLjQf7lJJBzV+5OtwswCWA==
 		require.Nil(t, err)
 	}
 }
+
+// testKeyProvider gives the keys of its map, indexed by the host of the URL.
+type testKeyProvider map[string]string
+
+func (p testKeyProvider) FetchKey(u *url.URL) ([]byte, error) {
+	key, ok := p[u.Host]
+	if !ok {
+		return nil, xerrors.New("unknown key")
+	}
+	return []byte(key), nil
+}
@@ -0,0 +1,236 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// The environment variables holding the configuration of a conode that
+// doesn't have a config file, like in a container. The address, listen
+// address, description and suite are the ones of the setup command.
+const (
+	// EnvSuite is the suite of the key of the conode, Ed25519 by default.
+	EnvSuite = "CONODE_SUITE"
+	// EnvPrivate is the private key of the conode, marshalled and encoded
+	// in base64.
+	EnvPrivate = "CONODE_PRIVATE_BASE64"
+	// EnvPublic is the public key of the conode, marshalled and encoded in
+	// base64. It is checked against the private key, and computed from it if
+	// it isn't set.
+	EnvPublic = "CONODE_PUBLIC_BASE64"
+	// EnvPrivateURL is the URL of the private key at a key provider, used
+	// if EnvPrivate isn't set.
+	EnvPrivateURL = "CONODE_PRIVATE_URL"
+	// EnvAddress is the address where the conode is reached.
+	EnvAddress = "CONODE_ADDRESS"
+	// EnvListenAddress is the address the conode binds to, if it isn't
+	// EnvAddress.
+	EnvListenAddress = "CONODE_LISTEN_ADDRESS"
+	// EnvDescription is the description of the conode.
+	EnvDescription = "CONODE_DESCRIPTION"
+	// EnvURL is the URL of the websocket of the conode.
+	EnvURL = "CONODE_URL"
+	// EnvServices holds the key pairs of the services as a JSON object, like
+	// {"Skipchain": {"Suite": "bn256.adapter", "Public": "...", "Private": "..."}},
+	// with the keys encoded like EnvPrivate and EnvPublic.
+	EnvServices = "CONODE_SERVICES"
+	// EnvServiceConfig holds the sections of the configurations of the
+	// services as a JSON object, like {"Skipchain": {"MaxBlockSize": 1000}}.
+	EnvServiceConfig = "CONODE_SERVICE_CONFIG"
+	// EnvSettings holds the other settings of private.toml as a JSON object,
+	// like {"StorageBackend": "bbolt", "Admin": {"Socket": "/run/admin.sock"}}.
+	EnvSettings = "CONODE_SETTINGS"
+)
+
+// LoadCothorityFromEnv creates the config of a conode from the environment
+// variables, without a config file. The conode needs at least its private
+// key and its address. As the config isn't saved, the keys generated by the
+// services are lost when the conode stops.
+func LoadCothorityFromEnv() (*CothorityConfig, error) {
+	hc := &CothorityConfig{}
+	if settings := os.Getenv(EnvSettings); settings != "" {
+		if err := decodeJSONSettings(settings, hc); err != nil {
+			return nil, xerrors.Errorf("%s: %v", EnvSettings, err)
+		}
+	}
+	if sections := os.Getenv(EnvServiceConfig); sections != "" {
+		var config struct {
+			Config map[string]map[string]interface{}
+		}
+		err := decodeJSONSettings(`{"Config":`+sections+`}`, &config)
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %v", EnvServiceConfig, err)
+		}
+		hc.Config = config.Config
+	}
+
+	hc.Suite = os.Getenv(EnvSuite)
+	if hc.Suite == "" {
+		hc.Suite = "Ed25519"
+	}
+	suite, err := suites.Find(hc.Suite)
+	if err != nil {
+		return nil, xerrors.Errorf("kyber suite: %v", err)
+	}
+	hc.Address = network.Address(os.Getenv(EnvAddress))
+	if hc.Address == "" {
+		return nil, xerrors.Errorf("need the address of the conode in %s", EnvAddress)
+	}
+	if !hc.Address.Valid() {
+		return nil, xerrors.Errorf("invalid address %s", hc.Address)
+	}
+	hc.ListenAddress = os.Getenv(EnvListenAddress)
+	hc.Description = os.Getenv(EnvDescription)
+	hc.URL = os.Getenv(EnvURL)
+
+	hc.PrivateURL = os.Getenv(EnvPrivateURL)
+	private := os.Getenv(EnvPrivate)
+	if private == "" && hc.PrivateURL != "" {
+		key, err := onet.FetchKey(hc.PrivateURL)
+		if err != nil {
+			return nil, xerrors.Errorf("private key: %v", err)
+		}
+		private = string(bytes.TrimSpace(key))
+	}
+	if private == "" {
+		return nil, xerrors.Errorf("need the private key of the conode in %s or %s",
+			EnvPrivate, EnvPrivateURL)
+	}
+	hc.Private, hc.Public, err = base64KeyPair(suite, private, os.Getenv(EnvPublic))
+	if err != nil {
+		return nil, xerrors.Errorf("key of the conode: %v", err)
+	}
+
+	if services := os.Getenv(EnvServices); services != "" {
+		var keys map[string]ServiceConfig
+		if err := json.Unmarshal([]byte(services), &keys); err != nil {
+			return nil, xerrors.Errorf("%s: %v", EnvServices, err)
+		}
+		hc.Services = make(map[string]ServiceConfig)
+		for name, sc := range keys {
+			suite, err := suites.Find(sc.Suite)
+			if err != nil {
+				return nil, xerrors.Errorf("suite of %s: %v", name, err)
+			}
+			sc.Private, sc.Public, err = base64KeyPair(suite, sc.Private, sc.Public)
+			if err != nil {
+				return nil, xerrors.Errorf("key of %s: %v", name, err)
+			}
+			hc.Services[name] = sc
+		}
+	}
+	return hc, nil
+}
+
+// ParseCothorityFromEnv is ParseCothority for a config given by the
+// environment variables, see LoadCothorityFromEnv.
+func ParseCothorityFromEnv() (*CothorityConfig, *onet.Server, error) {
+	hc, err := LoadCothorityFromEnv()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("reading config: %v", err)
+	}
+	server, err := hc.newServer("")
+	if err != nil {
+		return nil, nil, err
+	}
+	return hc, server, nil
+}
+
+// RunServerFromEnv starts the conode of the config given by the environment
+// variables and returns when it is stopped.
+func RunServerFromEnv() {
+	runServers(func() ([]*CothorityConfig, []*onet.Server, error) {
+		hc, server, err := ParseCothorityFromEnv()
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*CothorityConfig{hc}, []*onet.Server{server}, nil
+	}, nil, nil)
+}
+
+// base64KeyPair decodes the base64 private key, and the public one, which is
+// computed if it is empty, and returns them in hexadecimal, like in the config
+// files. A given public key must match the private key.
+func base64KeyPair(suite suites.Suite, private, public string) (string, string, error) {
+	buf, err := base64.StdEncoding.DecodeString(private)
+	if err != nil {
+		return "", "", xerrors.Errorf("decoding private key: %v", err)
+	}
+	priv := suite.Scalar()
+	if err := priv.UnmarshalBinary(buf); err != nil {
+		return "", "", xerrors.Errorf("unmarshaling private key: %v", err)
+	}
+	pub := suite.Point().Mul(priv, nil)
+	if public != "" {
+		buf, err := base64.StdEncoding.DecodeString(public)
+		if err != nil {
+			return "", "", xerrors.Errorf("decoding public key: %v", err)
+		}
+		given := suite.Point()
+		if err := given.UnmarshalBinary(buf); err != nil {
+			return "", "", xerrors.Errorf("unmarshaling public key: %v", err)
+		}
+		if !given.Equal(pub) {
+			return "", "", xerrors.New("the public key doesn't match the private key")
+		}
+	}
+	privStr, err := encoding.ScalarToStringHex(suite, priv)
+	if err != nil {
+		return "", "", xerrors.Errorf("encoding private key: %v", err)
+	}
+	pubStr, err := encoding.PointToStringHex(suite, pub)
+	if err != nil {
+		return "", "", xerrors.Errorf("encoding public key: %v", err)
+	}
+	return privStr, pubStr, nil
+}
+
+// decodeJSONSettings decodes the JSON object into v like the same settings
+// in a config file, going through toml so that v is decoded by the same
+// rules. The whole numbers are kept as integers.
+func decodeJSONSettings(settings string, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewBufferString(settings))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return xerrors.Errorf("json decoding: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(jsonNumbers(obj)); err != nil {
+		return xerrors.Errorf("toml encoding: %v", err)
+	}
+	if _, err := toml.Decode(buf.String(), v); err != nil {
+		return xerrors.Errorf("toml decoding: %v", err)
+	}
+	return nil
+}
+
+// jsonNumbers replaces the json.Number values by integers or floats.
+func jsonNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonNumbers(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestLoadCothorityFromEnv(t *testing.T) {
+	registerService()
+	defer unregisterService()
+	name := "OnetConfigTestServiceWithConfig"
+	_, err := onet.RegisterNewService(name, func(c *onet.Context) (onet.Service, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+	defer onet.UnregisterService(name)
+	require.NoError(t, onet.RegisterServiceConfig(name,
+		&testServiceConfig{Path: "/tmp", Retries: 2}))
+
+	encode := func(m interface{ MarshalBinary() ([]byte, error) }) string {
+		buf, err := m.MarshalBinary()
+		require.NoError(t, err)
+		return base64.StdEncoding.EncodeToString(buf)
+	}
+	suite := suites.MustFind("Ed25519")
+	kp := key.NewKeyPair(suite)
+	bn := pairing.NewSuiteBn256()
+	skp := key.NewKeyPair(bn)
+	vars := map[string]string{
+		EnvPrivate:     encode(kp.Private),
+		EnvAddress:     "tls://127.0.0.1:7770",
+		EnvDescription: "Container",
+		EnvServices: fmt.Sprintf(`{"%s": {"Suite": "%s", "Private": "%s"}}`,
+			testServiceName, bn.String(), encode(skp.Private)),
+		EnvServiceConfig: fmt.Sprintf(`{"%s": {"Retries": 5}}`, name),
+		EnvSettings:      `{"StorageQuotas": {"Skipchain": 1024}, "Admin": {"Socket": "/run/admin.sock"}}`,
+	}
+	for k, v := range vars {
+		require.NoError(t, os.Setenv(k, v))
+		defer os.Unsetenv(k)
+	}
+
+	hc, err := LoadCothorityFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, "Ed25519", hc.Suite)
+	require.Equal(t, "Container", hc.Description)
+	require.Equal(t, int64(1024), hc.StorageQuotas["Skipchain"])
+	require.Equal(t, "/run/admin.sock", hc.Admin.Socket)
+	si, err := hc.GetServerIdentity()
+	require.NoError(t, err)
+	require.True(t, si.Public.Equal(kp.Public))
+	require.Equal(t, network.Address("tls://127.0.0.1:7770"), si.Address)
+	srvid, ok := si.ServiceKey(testServiceName)
+	require.True(t, ok)
+	require.True(t, srvid.Public.Equal(skp.Public))
+	configs, err := hc.ServiceConfigs()
+	require.NoError(t, err)
+	require.Equal(t, &testServiceConfig{Path: "/tmp", Retries: 5}, configs[name])
+
+	// the public key must match the private one
+	require.NoError(t, os.Setenv(EnvPublic, encode(skp.Public)))
+	_, err = LoadCothorityFromEnv()
+	require.Error(t, err)
+	require.NoError(t, os.Setenv(EnvPublic, encode(kp.Public)))
+	_, err = LoadCothorityFromEnv()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Setenv(EnvSettings, `{"StorageIntegrity": "yes"}`))
+	_, err = LoadCothorityFromEnv()
+	require.Error(t, err)
+	require.NoError(t, os.Unsetenv(EnvSettings))
+
+	require.NoError(t, os.Unsetenv(EnvAddress))
+	_, err = LoadCothorityFromEnv()
+	require.Error(t, err)
+	require.NoError(t, os.Setenv(EnvAddress, "tls://127.0.0.1:7770"))
+	require.NoError(t, os.Unsetenv(EnvPrivate))
+	_, err = LoadCothorityFromEnv()
+	require.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// RotateKey gives a new key to the conode running with the config file. The
+// transition from the old key to the new one is announced by the conode to
+// the members of the group, then the config file is replaced with one holding
+// the new key. If groupFile is not empty, the entry of the conode in the group
+// is updated too. The conode uses its new key once it is restarted.
+//
+// The new config keeps the first key of the conode as its StorageKey, so that
+// the conode finds its database and its backups again. If the announcement
+// fails, the new config is kept next to the old one, and calling RotateKey
+// again announces the same new key, also to the conodes that already received
+// it.
+func RotateKey(ac *onet.AdminClient, configFile, groupFile string) (*onet.KeyTransition, int, error) {
+	hc, err := LoadCothority(configFile)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("reading config: %v", err)
+	}
+	if hc.PrivateURL != "" {
+		return nil, 0, xerrors.New("the key at PrivateURL is rotated in its key provider")
+	}
+	suite, err := suites.Find(hc.Suite)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("kyber suite: %v", err)
+	}
+	old, err := encoding.StringHexToScalar(suite, hc.Private)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("parsing private key: %v", err)
+	}
+	oldPublic := hc.Public
+	// a previous rotation whose announcement failed is retried
+	pending := configFile + ".next"
+	privStr, pubStr, err := pendingKeyPair(pending, hc)
+	if err != nil {
+		return nil, 0, err
+	}
+	if privStr == "" {
+		privStr, pubStr = createKeyPair(suite)
+	}
+	next, err := encoding.StringHexToScalar(suite, privStr)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("parsing new private key: %v", err)
+	}
+	kt, err := onet.NewKeyTransition(suite, hc.Address, old, next)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("key transition: %v", err)
+	}
+
+	var gt *GroupToml
+	var ro *onet.Roster
+	if groupFile != "" {
+		gt = &GroupToml{}
+		if _, err := toml.DecodeFile(groupFile, gt); err != nil {
+			return nil, 0, xerrors.Errorf("reading group: %v", err)
+		}
+		group, err := ReadGroupDescToml(strings.NewReader(gt.String()))
+		if err != nil {
+			return nil, 0, xerrors.Errorf("reading group: %v", err)
+		}
+		ro = group.Roster
+	}
+
+	// The new config is written before the announcement, and takes the place
+	// of the old one only once the announcement is done.
+	if hc.StorageKey == "" {
+		hc.StorageKey = hc.Private
+	}
+	hc.Private = privStr
+	hc.Public = pubStr
+	if err := hc.Save(pending); err != nil {
+		return nil, 0, xerrors.Errorf("saving config: %v", err)
+	}
+
+	sent := 0
+	if ro != nil {
+		sent, err = ac.AnnounceKeyTransition(kt, ro)
+		if err != nil {
+			return nil, sent, xerrors.Errorf("announcing key transition, "+
+				"run again to retry with the same key: %v", err)
+		}
+	}
+	if err := os.Rename(pending, configFile); err != nil {
+		return nil, sent, xerrors.Errorf("replacing config: %v", err)
+	}
+	log.Lvl1("Rotated the key of", hc.Address, "to", pubStr)
+
+	if gt != nil {
+		for _, s := range gt.Servers {
+			if s.Public == oldPublic {
+				s.Public = pubStr
+			}
+		}
+		if err := gt.Save(groupFile + ".tmp"); err != nil {
+			return kt, sent, xerrors.Errorf("saving group: %v", err)
+		}
+		if err := os.Rename(groupFile+".tmp", groupFile); err != nil {
+			return kt, sent, xerrors.Errorf("replacing group: %v", err)
+		}
+	}
+	return kt, sent, nil
+}
+
+// pendingKeyPair returns the key pair of the config of a rotation that wasn't
+// announced, or empty strings if there is none. The config is encrypted with
+// the passphrase of hc.
+func pendingKeyPair(file string, hc *CothorityConfig) (string, string, error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return "", "", nil
+	}
+	p := &CothorityConfig{}
+	if _, err := toml.DecodeFile(file, p); err != nil {
+		return "", "", xerrors.Errorf("reading pending config: %v", err)
+	}
+	if p.EncryptedPrivate != nil {
+		var err error
+		p.Private, err = p.EncryptedPrivate.Decrypt(hc.passphrase)
+		if err != nil {
+			return "", "", xerrors.Errorf("decrypting pending private key: %v", err)
+		}
+	}
+	return p.Private, p.Public, nil
+}
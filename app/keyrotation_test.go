@@ -0,0 +1,145 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestRotateKey(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "rotatekey")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// a free port for the websocket
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	suite := suites.MustFind("Ed25519")
+	priv, pub := createKeyPair(suite)
+	socket := path.Join(tmp, "admin.sock")
+	hc := &CothorityConfig{
+		Suite:         suite.String(),
+		Public:        pub,
+		Private:       priv,
+		Address:       network.NewAddress(network.PlainTCP, fmt.Sprintf("127.0.0.1:%d", port-1)),
+		ListenAddress: "127.0.0.1:0",
+		Admin:         &onet.AdminConfig{Socket: socket},
+	}
+	file := path.Join(tmp, "private.toml")
+	require.NoError(t, hc.Save(file))
+	si, err := hc.GetServerIdentity()
+	require.NoError(t, err)
+	groupFile := path.Join(tmp, "group.toml")
+	require.NoError(t, NewGroupToml(NewServerToml(suite, si.Public, hc.Address,
+		"conode", nil)).Save(groupFile))
+
+	_, srv, err := ParseCothority(file)
+	require.NoError(t, err)
+	go srv.Start()
+	defer srv.Close()
+	srv.WaitStartup()
+
+	ac := onet.NewAdminClient(onet.AdminConfig{Socket: socket})
+	kt, sent, err := RotateKey(ac, file, groupFile)
+	require.NoError(t, err)
+	require.Equal(t, 0, sent)
+	require.NoError(t, kt.Verify(suite))
+
+	nhc, err := LoadCothority(file)
+	require.NoError(t, err)
+	require.NotEqual(t, pub, nhc.Public)
+	nsi, err := nhc.GetServerIdentity()
+	require.NoError(t, err)
+	_, next, err := kt.Keys(suite)
+	require.NoError(t, err)
+	require.True(t, nsi.Public.Equal(next))
+	fd, err := os.Open(groupFile)
+	require.NoError(t, err)
+	defer fd.Close()
+	group, err := ReadGroupDescToml(fd)
+	require.NoError(t, err)
+	require.True(t, group.Roster.List[0].Public.Equal(next))
+
+	// the database keeps the first key
+	require.Equal(t, priv, nhc.StorageKey)
+
+	// the config is kept if the transition can't be announced, and a retry
+	// announces the same key
+	srv.Close()
+	_, _, err = RotateKey(ac, file, groupFile)
+	require.Error(t, err)
+	again, err := LoadCothority(file)
+	require.NoError(t, err)
+	require.Equal(t, nhc.Public, again.Public)
+	pending, err := LoadCothority(file + ".next")
+	require.NoError(t, err)
+	require.NotEqual(t, nhc.Public, pending.Public)
+	require.Equal(t, priv, pending.StorageKey)
+	_, _, err = RotateKey(ac, file, groupFile)
+	require.Error(t, err)
+	retried, err := LoadCothority(file + ".next")
+	require.NoError(t, err)
+	require.Equal(t, pending.Public, retried.Public)
+}
+
+type rotationTestService struct {
+	*onet.ServiceProcessor
+}
+
+func TestRotateKey_Storage(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "rotatekey")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	require.NoError(t, os.Setenv("CONODE_SERVICE_PATH", tmp))
+	defer os.Unsetenv("CONODE_SERVICE_PATH")
+
+	name := "RotateKeyTestService"
+	_, err = onet.RegisterNewService(name, func(c *onet.Context) (onet.Service, error) {
+		return &rotationTestService{onet.NewServiceProcessor(c)}, nil
+	})
+	require.NoError(t, err)
+	defer onet.UnregisterService(name)
+
+	suite := suites.MustFind("Ed25519")
+	priv, pub := createKeyPair(suite)
+	hc := &CothorityConfig{
+		Suite:             suite.String(),
+		Public:            pub,
+		Private:           priv,
+		Address:           network.NewAddress(network.PlainTCP, "127.0.0.1:0"),
+		StorageEncryption: &onet.StorageEncryption{},
+	}
+	file := path.Join(tmp, "private.toml")
+	require.NoError(t, hc.Save(file))
+	_, srv, err := ParseCothority(file)
+	require.NoError(t, err)
+	require.NoError(t, srv.Service(name).(*rotationTestService).SaveVersion(3))
+	require.NoError(t, srv.Close())
+
+	_, _, err = RotateKey(nil, file, "")
+	require.NoError(t, err)
+
+	// the conode restarted with its new key reads its encrypted database
+	nhc, srv, err := ParseCothority(file)
+	require.NoError(t, err)
+	defer srv.Close()
+	require.NotEqual(t, pub, nhc.Public)
+	v, err := srv.Service(name).(*rotationTestService).LoadVersion()
+	require.NoError(t, err)
+	require.Equal(t, 3, v)
+	dbs, err := filepath.Glob(path.Join(tmp, "*.db"))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(dbs))
+}
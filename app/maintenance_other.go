@@ -0,0 +1,9 @@
+// +build !freebsd,!linux,!darwin
+
+package app
+
+import "go.dedis.ch/onet/v3"
+
+// handleMaintenanceSignals does nothing on systems without SIGUSR1 and
+// SIGUSR2. The maintenance mode can still be set with the onet.Server API.
+func handleMaintenanceSignals(server *onet.Server) func() { return func() {} }
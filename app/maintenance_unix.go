@@ -0,0 +1,49 @@
+// +build freebsd linux darwin
+
+package app
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// maintenanceTimeout is how long in-flight work is waited for when entering
+// the maintenance mode.
+const maintenanceTimeout = 5 * time.Minute
+
+// handleMaintenanceSignals puts the conode in maintenance mode when it
+// receives SIGUSR1, and gets it out of maintenance with SIGUSR2. It returns
+// the function to stop handling them.
+func handleMaintenanceSignals(server *onet.Server) func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range c {
+			if sig == syscall.SIGUSR2 {
+				server.LeaveMaintenance()
+				log.Info("Left maintenance mode")
+				continue
+			}
+			log.Info("Entering maintenance mode")
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), maintenanceTimeout)
+				defer cancel()
+				if err := server.EnterMaintenance(ctx); err != nil {
+					log.Warn("In-flight work didn't finish:", err)
+					return
+				}
+				log.Info("In maintenance mode, no work in progress")
+			}()
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(c)
+	}
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// KeyMnemonic returns the private key of the conode as a phrase of words of
+// the BIP-39 english list, to be written down. The conode can be set up again
+// from it with the Mnemonic of SetupConfig. The keys of the services are not
+// part of it.
+func KeyMnemonic(hc *CothorityConfig) (string, error) {
+	suite, err := suites.Find(hc.Suite)
+	if err != nil {
+		return "", xerrors.Errorf("kyber suite: %v", err)
+	}
+	priv, err := encoding.StringHexToScalar(suite, hc.Private)
+	if err != nil {
+		return "", xerrors.Errorf("parsing private key: %v", err)
+	}
+	buf, err := priv.MarshalBinary()
+	if err != nil {
+		return "", xerrors.Errorf("marshaling private key: %v", err)
+	}
+	phrase, err := bip39.NewMnemonic(buf)
+	if err != nil {
+		return "", xerrors.Errorf("mnemonic: %v", err)
+	}
+	return phrase, nil
+}
+
+// KeyFromMnemonic returns the private key, in hexadecimal, written in the
+// phrase given by KeyMnemonic. The checksum of the phrase catches most typing
+// errors.
+func KeyFromMnemonic(suite network.Suite, phrase string) (string, error) {
+	phrase = strings.Join(strings.Fields(strings.ToLower(phrase)), " ")
+	if !bip39.IsMnemonicValid(phrase) {
+		return "", xerrors.New("invalid mnemonic")
+	}
+	buf, err := bip39.EntropyFromMnemonic(phrase)
+	if err != nil {
+		return "", xerrors.Errorf("mnemonic: %v", err)
+	}
+	priv := suite.Scalar()
+	if err := priv.UnmarshalBinary(buf); err != nil {
+		return "", xerrors.Errorf("unmarshaling private key: %v", err)
+	}
+	privStr, err := encoding.ScalarToStringHex(suite, priv)
+	if err != nil {
+		return "", xerrors.Errorf("encoding private key: %v", err)
+	}
+	return privStr, nil
+}
+
+// MnemonicCommand prints the private key of a conode as a phrase to write
+// down. It is part of ConodeCommands.
+var MnemonicCommand = cli.Command{
+	Name:  "mnemonic",
+	Usage: "print the private key of the conode as words, to set it up again with setup --mnemonic",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:   "config, c",
+			Value:  DefaultServerConfig,
+			Usage:  "config file of the conode",
+			EnvVar: "CONODE_CONFIG",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		hc, err := LoadCothority(c.String("config"))
+		if err != nil {
+			return xerrors.Errorf("reading config: %v", err)
+		}
+		phrase, err := KeyMnemonic(hc)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, phrase)
+		return nil
+	},
+}
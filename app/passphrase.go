@@ -0,0 +1,279 @@
+package app
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/xerrors"
+)
+
+// The sources of the passphrase of an encrypted private key, tried in this
+// order before asking it on the terminal.
+const (
+	// PassphraseEnv is the environment variable holding the passphrase.
+	PassphraseEnv = "CONODE_PASSPHRASE"
+	// PassphraseFDEnv is the environment variable holding the number of a
+	// file descriptor the passphrase is read from, like a pipe opened by the
+	// supervisor of the conode.
+	PassphraseFDEnv = "CONODE_PASSPHRASE_FD"
+)
+
+// The parameters of scrypt for the new encrypted keys.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// EncryptedKey is a private key encrypted with AES-GCM, with a key derived
+// from a passphrase by scrypt. The binary values are hex-encoded.
+type EncryptedKey struct {
+	KDF        string
+	Salt       string
+	N          int
+	R          int
+	P          int
+	Nonce      string
+	Ciphertext string
+}
+
+// encryptKey encrypts the hex-encoded private key with the passphrase.
+func encryptKey(private string, passphrase []byte) (*EncryptedKey, error) {
+	ek := &EncryptedKey{KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, xerrors.Errorf("salt: %v", err)
+	}
+	aead, err := ek.aead(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, xerrors.Errorf("nonce: %v", err)
+	}
+	ek.Salt = hex.EncodeToString(salt)
+	ek.Nonce = hex.EncodeToString(nonce)
+	ek.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, []byte(private), nil))
+	return ek, nil
+}
+
+// aead returns the cipher of the key derived from the passphrase.
+func (ek *EncryptedKey) aead(passphrase, salt []byte) (cipher.AEAD, error) {
+	if ek.KDF != "scrypt" {
+		return nil, xerrors.Errorf("unknown key derivation %q", ek.KDF)
+	}
+	key, err := scrypt.Key(passphrase, salt, ek.N, ek.R, ek.P, 32)
+	if err != nil {
+		return nil, xerrors.Errorf("deriving key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, xerrors.Errorf("cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Decrypt returns the hex-encoded private key.
+func (ek *EncryptedKey) Decrypt(passphrase []byte) (string, error) {
+	salt, err := hex.DecodeString(ek.Salt)
+	if err != nil {
+		return "", xerrors.Errorf("decoding salt: %v", err)
+	}
+	nonce, err := hex.DecodeString(ek.Nonce)
+	if err != nil {
+		return "", xerrors.Errorf("decoding nonce: %v", err)
+	}
+	ciphertext, err := hex.DecodeString(ek.Ciphertext)
+	if err != nil {
+		return "", xerrors.Errorf("decoding ciphertext: %v", err)
+	}
+	aead, err := ek.aead(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return "", xerrors.New("invalid nonce")
+	}
+	private, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", xerrors.New("wrong passphrase")
+	}
+	return string(private), nil
+}
+
+// SetPassphrase makes Save encrypt the private key with the passphrase. An
+// empty passphrase saves it in clear.
+func (hc *CothorityConfig) SetPassphrase(passphrase []byte) {
+	hc.passphrase = passphrase
+	if len(passphrase) == 0 {
+		hc.passphrase = nil
+	}
+}
+
+// passphrases holds the passphrases already given for the config files, as
+// they are read several times and a file descriptor can only be read once.
+var passphrases = struct {
+	sync.Mutex
+	byFile map[string][]byte
+}{byFile: make(map[string][]byte)}
+
+// passphraseFor returns the passphrase of the private key of the config
+// file, from PassphraseEnv, PassphraseFDEnv or the terminal.
+func passphraseFor(file string) ([]byte, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, xerrors.Errorf("config path: %v", err)
+	}
+	passphrases.Lock()
+	defer passphrases.Unlock()
+	if p, ok := passphrases.byFile[abs]; ok {
+		return p, nil
+	}
+	p, err := readPassphrase("Passphrase of " + file)
+	if err != nil {
+		return nil, err
+	}
+	passphrases.byFile[abs] = p
+	return p, nil
+}
+
+// rememberPassphrase replaces the passphrase of the config file given
+// before. A nil passphrase is asked again the next time.
+func rememberPassphrase(file string, passphrase []byte) error {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return xerrors.Errorf("config path: %v", err)
+	}
+	passphrases.Lock()
+	defer passphrases.Unlock()
+	if passphrase == nil {
+		delete(passphrases.byFile, abs)
+	} else {
+		passphrases.byFile[abs] = passphrase
+	}
+	return nil
+}
+
+// readPassphrase reads a passphrase from PassphraseEnv, PassphraseFDEnv, or
+// asks it with the prompt.
+func readPassphrase(prompt string) ([]byte, error) {
+	if p := os.Getenv(PassphraseEnv); p != "" {
+		return []byte(p), nil
+	}
+	if fd := os.Getenv(PassphraseFDEnv); fd != "" {
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid %s: %v", PassphraseFDEnv, err)
+		}
+		f := os.NewFile(uintptr(n), "passphrase")
+		if f == nil {
+			return nil, xerrors.Errorf("invalid file descriptor %d", n)
+		}
+		defer f.Close()
+		buf, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, xerrors.Errorf("reading passphrase: %v", err)
+		}
+		return bytes.TrimRight(buf, "\r\n"), nil
+	}
+	fmt.Fprint(out, prompt+": ")
+	return readSecret()
+}
+
+// readSecret reads a line from the terminal without echoing it, or from the
+// input if it isn't a terminal.
+func readSecret() ([]byte, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		line, err := in.ReadBytes('\n')
+		if err != nil && len(line) == 0 {
+			return nil, xerrors.Errorf("reading passphrase: %v", err)
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+	p, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(out)
+	if err != nil {
+		return nil, xerrors.Errorf("reading passphrase: %v", err)
+	}
+	return p, nil
+}
+
+// PassphraseCommand encrypts the private key of a conode with a passphrase,
+// or changes or removes it. The current passphrase is read like when the
+// conode starts, and the new one from CONODE_NEW_PASSPHRASE or the terminal.
+// It is part of ConodeCommands.
+var PassphraseCommand = cli.Command{
+	Name:  "passphrase",
+	Usage: "encrypt the private key of the conode with a passphrase, or change or remove it",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:   "config, c",
+			Value:  DefaultServerConfig,
+			Usage:  "config file of the conode",
+			EnvVar: "CONODE_CONFIG",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		file := c.String("config")
+		hc, err := LoadCothority(file)
+		if err != nil {
+			return xerrors.Errorf("reading config: %v", err)
+		}
+		passphrase := []byte(os.Getenv("CONODE_NEW_PASSPHRASE"))
+		if len(passphrase) == 0 {
+			fmt.Fprint(out, "New passphrase, empty to store the key in clear: ")
+			passphrase, err = readNewPassphrase()
+			if err != nil {
+				return err
+			}
+		}
+		hc.SetPassphrase(passphrase)
+		tmp := file + ".tmp"
+		if err := hc.Save(tmp); err != nil {
+			return xerrors.Errorf("saving config: %v", err)
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			os.Remove(tmp)
+			return xerrors.Errorf("replacing config: %v", err)
+		}
+		if err := rememberPassphrase(file, passphrase); err != nil {
+			return err
+		}
+		if len(passphrase) == 0 {
+			fmt.Fprintln(out, "Private key of", file, "stored in clear")
+		} else {
+			fmt.Fprintln(out, "Private key of", file, "encrypted")
+		}
+		return nil
+	},
+}
+
+// readNewPassphrase reads the new passphrase twice from the terminal.
+func readNewPassphrase() ([]byte, error) {
+	p, err := readSecret()
+	if err != nil || !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return p, err
+	}
+	fmt.Fprint(out, "Again: ")
+	again, err := readSecret()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(p, again) {
+		return nil, xerrors.New("the passphrases don't match")
+	}
+	return p, nil
+}
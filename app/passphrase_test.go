@@ -0,0 +1,84 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3/suites"
+)
+
+func TestCothorityConfig_Passphrase(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "passphrase")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	file := path.Join(tmp, "private.toml")
+
+	priv, pub := createKeyPair(suites.MustFind("Ed25519"))
+	storage, _ := createKeyPair(suites.MustFind("Ed25519"))
+	hc := &CothorityConfig{Suite: "Ed25519", Public: pub, Private: priv,
+		Address: "tls://127.0.0.1:7770", StorageKey: storage}
+	hc.SetPassphrase([]byte("secret"))
+	require.NoError(t, hc.Save(file))
+	content, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	require.NotContains(t, string(content), priv)
+	require.NotContains(t, string(content), storage)
+	require.Contains(t, string(content), "[EncryptedPrivate]")
+
+	// a wrong passphrase is asked again
+	setInput("wrong")
+	_, err = LoadCothority(file)
+	require.Error(t, err)
+	setInput("secret")
+	loaded, err := LoadCothority(file)
+	require.NoError(t, err)
+	require.Equal(t, priv, loaded.Private)
+	require.Equal(t, storage, loaded.StorageKey)
+	_, err = loaded.GetServerIdentity()
+	require.NoError(t, err)
+
+	// saving again keeps the key encrypted
+	require.NoError(t, loaded.Save(file))
+	content, err = ioutil.ReadFile(file)
+	require.NoError(t, err)
+	require.NotContains(t, string(content), priv)
+
+	// the passphrase is changed, then removed, with the command
+	app := cli.NewApp()
+	app.Commands = ConodeCommands
+	require.NoError(t, os.Setenv("CONODE_NEW_PASSPHRASE", "other"))
+	require.NoError(t, app.Run([]string{"conode", "passphrase", "-c", file}))
+	require.NoError(t, os.Unsetenv("CONODE_NEW_PASSPHRASE"))
+	require.NoError(t, os.Setenv(PassphraseEnv, "other"))
+	defer os.Unsetenv(PassphraseEnv)
+	loaded, err = LoadCothority(file)
+	require.NoError(t, err)
+	require.Equal(t, priv, loaded.Private)
+
+	setInput("")
+	o.Reset()
+	require.NoError(t, app.Run([]string{"conode", "passphrase", "-c", file}))
+	require.Contains(t, o.String(), "stored in clear")
+	content, err = ioutil.ReadFile(file)
+	require.NoError(t, err)
+	require.Contains(t, string(content), priv)
+	require.Contains(t, string(content), storage)
+}
+
+func TestReadPassphrase_FD(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = w.Write([]byte("from the pipe\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	defer os.Unsetenv(PassphraseFDEnv)
+	require.NoError(t, os.Setenv(PassphraseFDEnv, strconv.Itoa(int(r.Fd()))))
+	p, err := readPassphrase("Passphrase")
+	require.NoError(t, err)
+	require.Equal(t, "from the pipe", string(p))
+}
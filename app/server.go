@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -9,13 +10,17 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/urfave/cli"
 	"go.dedis.ch/kyber/v3/util/encoding"
 	"go.dedis.ch/kyber/v3/util/key"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/cfgpath"
 	"go.dedis.ch/onet/v3/log"
+	// the conodes keep the rosters of their groups
+	_ "go.dedis.ch/onet/v3/membership"
 	"go.dedis.ch/onet/v3/network"
 	"golang.org/x/xerrors"
 )
@@ -342,16 +347,241 @@ func tryConnect(ip, binding network.Address) error {
 	return nil
 }
 
+// ServerCommand starts the conodes of the config files given with --config.
+// The flag can be repeated to run several conodes in this process. With
+// --env, the conode is configured by the environment variables instead, see
+// LoadCothorityFromEnv. Conode binaries can add it to their commands.
+var ServerCommand = cli.Command{
+	Name:  "server",
+	Usage: "start the conodes of the config files",
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "config, c",
+			Usage: "config file of a conode, can be repeated",
+		},
+		cli.BoolFlag{
+			Name:   "env",
+			Usage:  "read the config of the conode from the CONODE_* environment variables",
+			EnvVar: "CONODE_FROM_ENV",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.Bool("env") {
+			if len(c.StringSlice("config")) > 0 {
+				return xerrors.New("--env and --config can't be used together")
+			}
+			RunServerFromEnv()
+			return nil
+		}
+		files := c.StringSlice("config")
+		if len(files) == 0 {
+			files = []string{DefaultServerConfig}
+		}
+		RunServers(files...)
+		return nil
+	},
+}
+
+// RestoreCommand downloads the latest backup of the conode of the config file
+// from the object storage of its Backup section. The resulting snapshot is
+// restored by adding it as the Restore section of the config and starting the
+// conode. It is part of ConodeCommands.
+var RestoreCommand = cli.Command{
+	Name:      "restore",
+	Usage:     "download the latest backup of the conode",
+	ArgsUsage: "path",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "config, c",
+			Value: DefaultServerConfig,
+			Usage: "config file of the conode",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return xerrors.New("need the path of the snapshot")
+		}
+		hc, err := LoadCothority(c.String("config"))
+		if err != nil {
+			return xerrors.Errorf("loading config: %v", err)
+		}
+		if hc.Backup == nil {
+			return xerrors.New("the config has no Backup section")
+		}
+		public, err := hc.storagePublic()
+		if err != nil {
+			return err
+		}
+		err = onet.RestoreBackup(*hc.Backup, public, c.Args().First())
+		if err != nil {
+			return xerrors.Errorf("restore: %v", err)
+		}
+		fmt.Fprintln(out, "Backup written to", c.Args().First())
+		return nil
+	},
+}
+
 // RunServer starts a conode with the given config file name. It can
 // be used by different apps (like CoSi, for example)
 func RunServer(configFilename string) {
-	if _, err := os.Stat(configFilename); os.IsNotExist(err) {
-		log.Fatalf("[-] Configuration file does not exist. %s", configFilename)
+	RunServers(configFilename)
+}
+
+// RunServers starts a conode for each of the given config files in this
+// process, and returns when all of them are stopped. Running several conodes
+// in one process saves resources for test cothorities and for operators
+// taking part in several rosters.
+func RunServers(configFilenames ...string) {
+	for _, f := range configFilenames {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			log.Fatalf("[-] Configuration file does not exist. %s", f)
+		}
 	}
-	// Let's read the config
-	_, server, err := ParseCothority(configFilename)
+	runServers(func() ([]*CothorityConfig, []*onet.Server, error) {
+		return ParseCothorities(configFilenames...)
+	}, nil, nil)
+}
+
+// stopTimeout is how long the in-flight work is waited for when stopping
+// the conodes, like a service manager does before killing the process.
+const stopTimeout = 20 * time.Second
+
+// runServers starts the conodes returned by parse and returns when all of
+// them are stopped. Once they are all started, started is called if it isn't
+// nil. When stop is closed, they finish their work in progress, for at most
+// stopTimeout, and are closed. If all their configs have UpgradeOnSIGHUP,
+// they are upgraded without stopping to the binary of the process on SIGHUP,
+// see upgrade.
+func runServers(parse func() ([]*CothorityConfig, []*onet.Server, error),
+	started func(), stop <-chan struct{}) {
+	configs, servers, err := parse()
 	if err != nil {
 		log.Fatal("Couldn't parse config:", err)
 	}
-	server.Start()
+	defer registerLoggers(configs)()
+	// the upgrade restarts all the conodes of the process
+	upgrade := len(configs) > 0
+	for _, hc := range configs {
+		upgrade = upgrade && hc.UpgradeOnSIGHUP
+	}
+	if upgrade {
+		defer handleUpgradeSignal(servers)()
+	}
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		defer handleMaintenanceSignals(server)()
+		wg.Add(1)
+		go func(s *onet.Server) {
+			defer wg.Done()
+			s.Start()
+		}(server)
+	}
+	for _, server := range servers {
+		server.WaitStartup()
+	}
+	network.CloseInheritedListeners()
+	if started != nil {
+		started()
+	}
+	if stop != nil {
+		go func() {
+			<-stop
+			stopServers(servers, false)
+		}()
+	}
+	wg.Wait()
+}
+
+// stopServers puts the servers in maintenance, waits for their work in
+// progress to finish, for at most stopTimeout, and closes them. With
+// checkpoint, the protocol instances still running are saved first, to be
+// resumed by the next process.
+func stopServers(servers []*onet.Server, checkpoint bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(s *onet.Server) {
+			defer wg.Done()
+			if err := s.EnterMaintenance(ctx); err != nil {
+				log.Warn("In-flight work didn't finish:", err)
+			}
+			if checkpoint {
+				n, err := s.CheckpointProtocols()
+				if err != nil {
+					log.Error("Couldn't checkpoint the protocol instances:", err)
+				} else if n > 0 {
+					log.Info("Checkpointed", n, "protocol instances")
+				}
+			}
+			if err := s.Close(); err != nil {
+				log.Error("Couldn't close the conode:", err)
+			}
+		}(server)
+	}
+	wg.Wait()
+}
+
+// registerLoggers sends the log to the files, syslog, journald and log server
+// of the configurations, and its errors to Sentry, sets the log levels of
+// their packages, and returns the function closing them. As the log is shared
+// by the conodes of the process, they get one logger by file, and the syslog,
+// journald, log server, Sentry and package levels of the first configuration
+// having them. The messages sent to the log server are labeled with the
+// address of the conode, unless the configuration has the label "conode".
+func registerLoggers(configs []*CothorityConfig) func() {
+	var keys []int
+	register := func(l log.Logger, err error) {
+		if err != nil {
+			log.Fatal("Couldn't open log:", err)
+		}
+		keys = append(keys, log.RegisterLogger(l))
+	}
+	paths := make(map[string]bool)
+	syslog, journald, ship, levels := false, false, false, false
+	var sentry *onet.SentryReporter
+	for _, hc := range configs {
+		if hc.LogLevels != nil && !levels {
+			levels = true
+			log.SetPackageLevels(hc.LogLevels)
+		}
+		if hc.Log != nil && !paths[hc.Log.Path] {
+			paths[hc.Log.Path] = true
+			register(log.NewRotatingFileLogger(*hc.Log))
+		}
+		if hc.Syslog != nil && !syslog {
+			syslog = true
+			register(log.NewSyslogLoggerFromConfig(*hc.Syslog))
+		}
+		if hc.Journald != nil && !journald {
+			journald = true
+			register(log.NewJournaldLogger(*hc.Journald))
+		}
+		if hc.Ship != nil && !ship {
+			ship = true
+			cfg := *hc.Ship
+			cfg.Labels = map[string]string{"conode": hc.Address.String()}
+			for k, v := range hc.Ship.Labels {
+				cfg.Labels[k] = v
+			}
+			register(log.NewShipper(cfg))
+		}
+		if hc.Sentry != nil && sentry == nil {
+			var err error
+			sentry, err = onet.NewSentryReporter(*hc.Sentry)
+			register(onet.NewErrorLogger(sentry, hc.Address.String()), err)
+		}
+	}
+	return func() {
+		for _, key := range keys {
+			log.UnregisterLogger(key)
+		}
+		if sentry != nil {
+			sentry.Close()
+		}
+		if levels {
+			log.SetPackageLevels(nil)
+		}
+	}
 }
@@ -1,13 +1,22 @@
 package app
 
 import (
+	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
 )
 
 func TestInteractiveConfig(t *testing.T) {
@@ -36,3 +45,103 @@ func TestInteractiveConfig(t *testing.T) {
 
 	log.ErrFatal(os.RemoveAll(tmp))
 }
+
+func TestRegisterLoggers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cfg := &log.FileConfig{Path: dir + "/conode.log"}
+	socket := dir + "/journald"
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	jcfg := &log.JournaldConfig{Socket: socket}
+	shipped := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadAll(r.Body)
+		shipped <- buf
+	}))
+	defer srv.Close()
+	ship := &log.ShipperConfig{Loki: srv.URL, FlushInterval: "1h"}
+	reported := make(chan []byte, 1)
+	sentrySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadAll(r.Body)
+		reported <- buf
+	}))
+	defer sentrySrv.Close()
+	sentry := &onet.SentryConfig{DSN: strings.Replace(sentrySrv.URL, "//", "//key@", 1) + "/1"}
+	closeLogs := registerLoggers([]*CothorityConfig{{Log: cfg, Journald: jcfg},
+		{Log: cfg, Journald: jcfg, LogLevels: map[string]int{"network": 3},
+			Address: "tcp://127.0.0.1:7770", Ship: ship, Sentry: sentry}, {}})
+	require.Equal(t, map[string]int{"network": 3}, log.PackageLevels())
+	log.Error("to the file")
+	closeLogs()
+	log.Info("not to the file")
+	require.Empty(t, log.PackageLevels())
+
+	buf, err := ioutil.ReadFile(cfg.Path)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(buf), "to the file"))
+	// only one message, sent once
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf = make([]byte, 1024)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Contains(t, string(buf[:n]), "to the file")
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, err = conn.Read(buf)
+	require.Error(t, err)
+	require.Contains(t, string(<-shipped), `"conode":"tcp://127.0.0.1:7770"`)
+	buf = <-reported
+	require.Contains(t, string(buf), `"message":"to the file"`)
+	require.Contains(t, string(buf), `"conode":"tcp://127.0.0.1:7770"`)
+}
+
+func TestRunServers_Stop(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conode")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// a free port for the websocket
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	suite := suites.MustFind("Ed25519")
+	priv, pub := createKeyPair(suite)
+	hc := &CothorityConfig{
+		Suite:         suite.String(),
+		Public:        pub,
+		Private:       priv,
+		Address:       network.NewAddress(network.PlainTCP, fmt.Sprintf("127.0.0.1:%d", port-1)),
+		ListenAddress: "127.0.0.1:0",
+	}
+	file := path.Join(tmp, "private.toml")
+	require.NoError(t, hc.Save(file))
+
+	started := make(chan struct{})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runServers(func() ([]*CothorityConfig, []*onet.Server, error) {
+			return ParseCothorities(file)
+		}, func() { close(started) }, stop)
+		close(done)
+	}()
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the conode didn't start")
+	}
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/ok", port))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(stopTimeout):
+		t.Fatal("the conode didn't stop")
+	}
+}
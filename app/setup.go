@@ -0,0 +1,227 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// SetupConfig is what Setup needs to generate the configuration of a conode,
+// as given to InteractiveConfig.
+type SetupConfig struct {
+	// Suite of the key of the conode, "Ed25519" if it is empty.
+	Suite string
+	// Address where the other conodes and the clients reach the conode, like
+	// "tls://conode.example.com:7770". Without a scheme, TLS is used.
+	Address string
+	// ListenAddress, if not empty, is the address the conode binds to
+	// instead of Address, like "0.0.0.0:7770".
+	ListenAddress string
+	// Description of the conode, "New cothority" if it is empty.
+	Description string
+	// Private is the private key of the conode in hexadecimal, to keep an
+	// existing identity. A new key is created if it is empty. The keys of the
+	// services are always created.
+	Private string
+	// Mnemonic is the private key of the conode as given by KeyMnemonic, to
+	// recover an identity. It is used if Private is empty.
+	Mnemonic string
+	// ConfigFile and GroupFile are the files written, DefaultServerConfig
+	// and DefaultGroupFile if they are empty. Their directories are created.
+	ConfigFile string
+	GroupFile  string
+	// Passphrase, if not empty, encrypts the private key in ConfigFile.
+	Passphrase []byte
+	// Overwrite replaces the files if they exist, else Setup fails.
+	Overwrite bool
+}
+
+// Setup writes the configuration of a conode and its group definition
+// without asking anything, for the provisioning tools.
+func Setup(cfg SetupConfig) error {
+	if cfg.Suite == "" {
+		cfg.Suite = "Ed25519"
+	}
+	if cfg.Description == "" {
+		cfg.Description = "New cothority"
+	}
+	if cfg.ConfigFile == "" {
+		cfg.ConfigFile = DefaultServerConfig
+	}
+	if cfg.GroupFile == "" {
+		cfg.GroupFile = DefaultGroupFile
+	}
+	suite, err := suites.Find(cfg.Suite)
+	if err != nil {
+		return xerrors.Errorf("finding suite: %v", err)
+	}
+	addr := network.Address(cfg.Address)
+	if !strings.Contains(cfg.Address, "://") {
+		addr = network.NewAddress(network.TLS, cfg.Address)
+	}
+	if !addr.Valid() {
+		return xerrors.Errorf("invalid address %q", cfg.Address)
+	}
+	if !cfg.Overwrite {
+		for _, file := range []string{cfg.ConfigFile, cfg.GroupFile} {
+			if _, err := os.Stat(file); err == nil {
+				return xerrors.Errorf("%s already exists", file)
+			}
+		}
+	}
+
+	if cfg.Private == "" && cfg.Mnemonic != "" {
+		cfg.Private, err = KeyFromMnemonic(suite, cfg.Mnemonic)
+		if err != nil {
+			return xerrors.Errorf("recovering private key: %v", err)
+		}
+	}
+	var privStr, pubStr string
+	if cfg.Private == "" {
+		privStr, pubStr = createKeyPair(suite)
+	} else {
+		priv, err := encoding.StringHexToScalar(suite, cfg.Private)
+		if err != nil {
+			return xerrors.Errorf("parsing private key: %v", err)
+		}
+		privStr = cfg.Private
+		pubStr, err = encoding.PointToStringHex(suite, suite.Point().Mul(priv, nil))
+		if err != nil {
+			return xerrors.Errorf("encoding public key: %v", err)
+		}
+	}
+	public, err := encoding.StringHexToPoint(suite, pubStr)
+	if err != nil {
+		return xerrors.Errorf("parsing public key: %v", err)
+	}
+
+	services := GenerateServiceKeyPairs()
+	conf := &CothorityConfig{
+		Suite:         suite.String(),
+		Public:        pubStr,
+		Private:       privStr,
+		Address:       addr,
+		ListenAddress: cfg.ListenAddress,
+		Services:      services,
+		Description:   cfg.Description,
+	}
+	conf.SetPassphrase(cfg.Passphrase)
+	group := NewGroupToml(NewServerToml(suite, public, addr, cfg.Description, services))
+
+	for _, file := range []string{cfg.ConfigFile, cfg.GroupFile} {
+		if err := os.MkdirAll(filepath.Dir(file), 0744); err != nil {
+			return xerrors.Errorf("creating directory: %v", err)
+		}
+	}
+	if err := conf.Save(cfg.ConfigFile); err != nil {
+		return xerrors.Errorf("saving config: %v", err)
+	}
+	if err := group.Save(cfg.GroupFile); err != nil {
+		return xerrors.Errorf("saving group: %v", err)
+	}
+	log.Lvl1("Wrote the config of", addr, "to", cfg.ConfigFile, "and its group to",
+		cfg.GroupFile)
+	return nil
+}
+
+// SetupCommand writes the configuration of a conode from its flags or their
+// environment variables, without asking anything. It is part of
+// ConodeCommands.
+var SetupCommand = cli.Command{
+	Name:  "setup",
+	Usage: "write the configuration of a conode without interaction",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:   "address",
+			Usage:  "address where the conode is reached, like tls://conode.example.com:7770",
+			EnvVar: "CONODE_ADDRESS",
+		},
+		cli.StringFlag{
+			Name:   "listen",
+			Usage:  "address the conode binds to, if it isn't the one where it is reached",
+			EnvVar: "CONODE_LISTEN_ADDRESS",
+		},
+		cli.StringFlag{
+			Name:   "description",
+			Value:  "New cothority",
+			Usage:  "description of the conode",
+			EnvVar: "CONODE_DESCRIPTION",
+		},
+		cli.StringFlag{
+			Name:   "suite",
+			Value:  "Ed25519",
+			Usage:  "suite of the key of the conode",
+			EnvVar: "CONODE_SUITE",
+		},
+		cli.StringFlag{
+			Name:   "private",
+			Usage:  "existing private key of the conode, in hexadecimal",
+			EnvVar: "CONODE_PRIVATE_KEY",
+		},
+		cli.StringFlag{
+			Name:   "mnemonic",
+			Usage:  "existing private key of the conode, as printed by the mnemonic command",
+			EnvVar: "CONODE_MNEMONIC",
+		},
+		cli.StringFlag{
+			Name:   "config, c",
+			Value:  DefaultServerConfig,
+			Usage:  "config file written",
+			EnvVar: "CONODE_CONFIG",
+		},
+		cli.StringFlag{
+			Name:   "group, g",
+			Value:  DefaultGroupFile,
+			Usage:  "group definition written",
+			EnvVar: "CONODE_GROUP",
+		},
+		cli.BoolFlag{
+			Name:  "encrypt",
+			Usage: "encrypt the private key with a passphrase, from CONODE_PASSPHRASE, CONODE_PASSPHRASE_FD or the terminal",
+		},
+		cli.BoolFlag{
+			Name:   "overwrite",
+			Usage:  "replace the files if they exist",
+			EnvVar: "CONODE_OVERWRITE",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.String("address") == "" {
+			return xerrors.New("need the address of the conode")
+		}
+		cfg := SetupConfig{
+			Suite:         c.String("suite"),
+			Address:       c.String("address"),
+			ListenAddress: c.String("listen"),
+			Description:   c.String("description"),
+			Private:       c.String("private"),
+			Mnemonic:      c.String("mnemonic"),
+			ConfigFile:    c.String("config"),
+			GroupFile:     c.String("group"),
+			Overwrite:     c.Bool("overwrite"),
+		}
+		if c.Bool("encrypt") {
+			var err error
+			cfg.Passphrase, err = readPassphrase("Passphrase of the private key")
+			if err != nil {
+				return err
+			}
+			if len(cfg.Passphrase) == 0 {
+				return xerrors.New("need a passphrase to encrypt the private key")
+			}
+		}
+		if err := Setup(cfg); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Config written to", cfg.ConfigFile, "and group to", cfg.GroupFile)
+		return nil
+	},
+}
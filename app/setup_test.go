@@ -0,0 +1,104 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3/suites"
+)
+
+func TestSetupCommand(t *testing.T) {
+	registerService()
+	defer unregisterService()
+
+	tmp, err := ioutil.TempDir("", "setup")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	config := path.Join(tmp, "conode", "private.toml")
+	group := path.Join(tmp, "conode", "public.toml")
+
+	app := cli.NewApp()
+	app.Commands = ConodeCommands
+	require.Error(t, app.Run([]string{"conode", "setup", "-c", config, "-g", group}))
+
+	priv, pub := createKeyPair(suites.MustFind("Ed25519"))
+	require.NoError(t, os.Setenv("CONODE_DESCRIPTION", "Provisioned"))
+	defer os.Unsetenv("CONODE_DESCRIPTION")
+	o.Reset()
+	require.NoError(t, app.Run([]string{"conode", "setup", "-c", config, "-g", group,
+		"--address", "127.0.0.1:7770", "--listen", "0.0.0.0:7770", "--private", priv}))
+	require.Contains(t, o.String(), "Config written to "+config)
+
+	hc, err := LoadCothority(config)
+	require.NoError(t, err)
+	require.Equal(t, "Ed25519", hc.Suite)
+	require.Equal(t, priv, hc.Private)
+	require.Equal(t, pub, hc.Public)
+	require.Equal(t, "tls://127.0.0.1:7770", hc.Address.String())
+	require.Equal(t, "0.0.0.0:7770", hc.ListenAddress)
+	require.Equal(t, "Provisioned", hc.Description)
+	require.Equal(t, "bn256.adapter", hc.Services[testServiceName].Suite)
+
+	gf, err := os.Open(group)
+	require.NoError(t, err)
+	defer gf.Close()
+	gt, err := ReadGroupDescToml(gf)
+	require.NoError(t, err)
+	require.Len(t, gt.Roster.List, 1)
+	require.Equal(t, hc.Address, gt.Roster.List[0].Address)
+
+	// the files are only replaced on demand
+	require.Error(t, app.Run([]string{"conode", "setup", "-c", config, "-g", group,
+		"--address", "127.0.0.1:7770"}))
+	require.NoError(t, app.Run([]string{"conode", "setup", "-c", config, "-g", group,
+		"--address", "tcp://127.0.0.1:7770", "--overwrite"}))
+	hc, err = LoadCothority(config)
+	require.NoError(t, err)
+	require.NotEqual(t, priv, hc.Private)
+	require.Equal(t, "tcp://127.0.0.1:7770", hc.Address.String())
+
+	require.Error(t, Setup(SetupConfig{Address: "127.0.0.1", ConfigFile: config,
+		GroupFile: group, Overwrite: true}))
+	require.Error(t, Setup(SetupConfig{Address: "127.0.0.1:7770", Private: "zz",
+		ConfigFile: config, GroupFile: group, Overwrite: true}))
+}
+
+func TestSetup_Mnemonic(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "mnemonic")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	config := path.Join(tmp, "private.toml")
+	group := path.Join(tmp, "public.toml")
+
+	suite := suites.MustFind("Ed25519")
+	for i := 0; i < 20; i++ {
+		priv, pub := createKeyPair(suite)
+		phrase, err := KeyMnemonic(&CothorityConfig{Suite: suite.String(), Private: priv})
+		require.NoError(t, err)
+		require.Len(t, strings.Fields(phrase), 24)
+		require.NoError(t, Setup(SetupConfig{Address: "127.0.0.1:7770",
+			Mnemonic: "  " + strings.ToUpper(phrase) + "\n", ConfigFile: config,
+			GroupFile: group, Overwrite: true}))
+		hc, err := LoadCothority(config)
+		require.NoError(t, err)
+		require.Equal(t, priv, hc.Private)
+		require.Equal(t, pub, hc.Public)
+	}
+
+	app := cli.NewApp()
+	app.Commands = ConodeCommands
+	o.Reset()
+	require.NoError(t, app.Run([]string{"conode", "mnemonic", "-c", config}))
+	words := strings.Fields(o.String())
+	require.Len(t, words, 24)
+
+	_, err = KeyFromMnemonic(suite, strings.Join(words[1:], " "))
+	require.Error(t, err)
+	_, err = KeyFromMnemonic(suite, "not a mnemonic")
+	require.Error(t, err)
+}
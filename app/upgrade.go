@@ -0,0 +1,38 @@
+package app
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// EnvUpgradeReady is the file descriptor where a conode started by an
+// upgrade tells the previous process that it loaded its configuration, so
+// that the previous process hands over.
+const EnvUpgradeReady = "CONODE_UPGRADE_READY_FD"
+
+// upgradeTimeout is how long the new process of an upgrade is waited for
+// before giving up.
+const upgradeTimeout = time.Minute
+
+// notifyUpgradeReady tells the previous process of the conode that this one
+// is ready to take over, if it was started by an upgrade.
+func notifyUpgradeReady() {
+	env := os.Getenv(EnvUpgradeReady)
+	if env == "" {
+		return
+	}
+	os.Unsetenv(EnvUpgradeReady)
+	fd, err := strconv.Atoi(env)
+	if err != nil {
+		log.Error("Invalid", EnvUpgradeReady, env)
+		return
+	}
+	f := os.NewFile(uintptr(fd), "upgrade")
+	defer f.Close()
+	if _, err := f.Write([]byte{1}); err != nil {
+		log.Error("Couldn't tell the previous process to hand over:", err)
+	}
+}
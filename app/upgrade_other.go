@@ -0,0 +1,9 @@
+// +build !freebsd,!linux,!darwin
+
+package app
+
+import "go.dedis.ch/onet/v3"
+
+// handleUpgradeSignal does nothing on systems without SIGHUP or without
+// inheritance of the sockets.
+func handleUpgradeSignal(servers []*onet.Server) func() { return func() {} }
@@ -0,0 +1,132 @@
+// +build freebsd linux darwin
+
+package app
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// handleUpgradeSignal upgrades the conodes without stopping them when the
+// process receives SIGHUP, see upgrade. It returns the function to stop
+// handling it.
+func handleUpgradeSignal(servers []*onet.Server) func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			log.Info("Upgrading the conode")
+			if err := upgrade(servers); err != nil {
+				log.Error("Couldn't upgrade:", err)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(c)
+	}
+}
+
+// upgrade starts the binary of the conode again, usually replaced by a new
+// version, with the same arguments, and hands over the listening sockets to
+// it, so that the connections are never refused. Once the new process has
+// loaded its configuration, the conodes close their copy of the sockets, so
+// that the new connections wait for the new process instead of being
+// refused by the maintenance. Then they finish their work in progress, for
+// at most stopTimeout, checkpoint the remaining protocol instances and
+// close, which lets the new process open their databases and serve. If the
+// new process fails before, the conodes keep running.
+//
+// A service manager must not stop the new process when this one exits.
+// Under systemd, the new process is announced as the main process of the
+// unit with NOTIFY_SOCKET, which systemd accepts if the unit has
+// NotifyAccess=main or all. Otherwise, the unit needs KillMode=process, so
+// that the new process isn't killed with this one.
+func upgrade(servers []*onet.Server) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return xerrors.Errorf("finding the binary: %v", err)
+	}
+	// the files given to the new process start at descriptor 3
+	files, listeners, err := network.ListenerFiles(3)
+	if err != nil {
+		return xerrors.Errorf("listening sockets: %v", err)
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return xerrors.Errorf("pipe: %v", err)
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, readyW)
+	cmd.Env = append(os.Environ(), network.EnvListeners+"="+listeners,
+		EnvUpgradeReady+"="+strconv.Itoa(3+len(files)))
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return xerrors.Errorf("starting %s: %v", exe, err)
+	}
+
+	// the pipe is closed without a byte if the new process stops
+	done := make(chan error, 1)
+	go func() {
+		_, err := ready.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(upgradeTimeout):
+		err = xerrors.New("timeout")
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return xerrors.Errorf("the new process isn't ready: %v", err)
+	}
+	if err := notifyMainPID(cmd.Process.Pid); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return xerrors.Errorf("telling systemd about the new process: %v", err)
+	}
+	log.Info("Handing over to the new process", cmd.Process.Pid)
+	network.HandOverListeners()
+	stopServers(servers, true)
+	return nil
+}
+
+// notifyMainPID tells systemd, if it started the conode, that the process
+// with the pid is now the main process of the unit.
+func notifyMainPID(pid int) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	if addr[0] == '@' {
+		// abstract socket
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("MAINPID=" + strconv.Itoa(pid)))
+	return err
+}
@@ -0,0 +1,35 @@
+// +build freebsd linux darwin
+
+package app
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyMainPID(t *testing.T) {
+	// without systemd, there is nothing to tell
+	require.NoError(t, os.Unsetenv("NOTIFY_SOCKET"))
+	require.NoError(t, notifyMainPID(1234))
+
+	tmp, err := ioutil.TempDir("", "notify")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	addr := path.Join(tmp, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, os.Setenv("NOTIFY_SOCKET", addr))
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	require.NoError(t, notifyMainPID(1234))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "MAINPID=1234", string(buf[:n]))
+}
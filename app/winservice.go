@@ -0,0 +1,100 @@
+package app
+
+import (
+	"path/filepath"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+)
+
+// ServiceCommand manages the Windows service running the conodes of the
+// config files, so they don't need a wrapper like NSSM: "install" registers
+// it and its event log source, "start" and "stop" control it, "uninstall"
+// removes it, and "run" is what the service manager executes. The log of the
+// service goes to the Windows event log. It is part of ConodeCommands.
+var ServiceCommand = cli.Command{
+	Name:  "service",
+	Usage: "manage the Windows service running the conodes",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "name",
+			Value: "conode",
+			Usage: "name of the service",
+		},
+	},
+	Subcommands: []cli.Command{
+		{
+			Name:  "install",
+			Usage: "install the service, started with Windows",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "config, c",
+					Usage: "config file of a conode, can be repeated",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				files, err := serviceConfigs(c)
+				if err != nil {
+					return err
+				}
+				return installService(c.Parent().String("name"), files)
+			},
+		},
+		{
+			Name:  "uninstall",
+			Usage: "remove the service",
+			Action: func(c *cli.Context) error {
+				return uninstallService(c.Parent().String("name"))
+			},
+		},
+		{
+			Name:  "start",
+			Usage: "start the service",
+			Action: func(c *cli.Context) error {
+				return startService(c.Parent().String("name"))
+			},
+		},
+		{
+			Name:  "stop",
+			Usage: "stop the service once the work in progress is done",
+			Action: func(c *cli.Context) error {
+				return stopService(c.Parent().String("name"))
+			},
+		},
+		{
+			Name:   "run",
+			Usage:  "run the conodes, as the service manager does",
+			Hidden: true,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "config, c",
+					Usage: "config file of a conode, can be repeated",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				files, err := serviceConfigs(c)
+				if err != nil {
+					return err
+				}
+				return runService(c.Parent().String("name"), files)
+			},
+		},
+	},
+}
+
+// serviceConfigs returns the absolute paths of the config files given with
+// --config, as the service doesn't run in the current directory.
+func serviceConfigs(c *cli.Context) ([]string, error) {
+	files := c.StringSlice("config")
+	if len(files) == 0 {
+		files = []string{DefaultServerConfig}
+	}
+	for i, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, xerrors.Errorf("config path: %v", err)
+		}
+		files[i] = abs
+	}
+	return files, nil
+}
@@ -0,0 +1,27 @@
+// +build !windows
+
+package app
+
+import "golang.org/x/xerrors"
+
+var errNoService = xerrors.New("services are only supported on Windows")
+
+func installService(name string, configs []string) error {
+	return errNoService
+}
+
+func uninstallService(name string) error {
+	return errNoService
+}
+
+func startService(name string) error {
+	return errNoService
+}
+
+func stopService(name string) error {
+	return errNoService
+}
+
+func runService(name string, configs []string) error {
+	return errNoService
+}
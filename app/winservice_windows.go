@@ -0,0 +1,186 @@
+// +build windows
+
+package app
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+	"golang.org/x/xerrors"
+)
+
+// installService registers the service running the conodes of the config
+// files with this executable, and the source of its event log.
+func installService(name string, configs []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return xerrors.Errorf("executable: %v", err)
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return xerrors.Errorf("service manager: %v", err)
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return xerrors.Errorf("service %s already exists", name)
+	}
+	args := []string{"service", "--name", name, "run"}
+	for _, f := range configs {
+		args = append(args, "--config", f)
+	}
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: name,
+		Description: "Conodes of the config files " + strings.Join(configs, ", "),
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return xerrors.Errorf("creating service: %v", err)
+	}
+	defer s.Close()
+	if err := log.InstallEventLogSource(name); err != nil {
+		s.Delete()
+		return err
+	}
+	log.Info("Installed service", name)
+	return nil
+}
+
+// uninstallService removes the service and the source of its event log.
+func uninstallService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return xerrors.Errorf("service manager: %v", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return xerrors.Errorf("service %s is not installed: %v", name, err)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return xerrors.Errorf("deleting service: %v", err)
+	}
+	if err := log.RemoveEventLogSource(name); err != nil {
+		return err
+	}
+	log.Info("Uninstalled service", name)
+	return nil
+}
+
+// startService asks the service manager to start the service.
+func startService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return xerrors.Errorf("service manager: %v", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return xerrors.Errorf("service %s is not installed: %v", name, err)
+	}
+	defer s.Close()
+	if err := s.Start(); err != nil {
+		return xerrors.Errorf("starting service: %v", err)
+	}
+	return nil
+}
+
+// stopService asks the service manager to stop the service and waits for it
+// to be stopped.
+func stopService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return xerrors.Errorf("service manager: %v", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return xerrors.Errorf("service %s is not installed: %v", name, err)
+	}
+	defer s.Close()
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return xerrors.Errorf("stopping service: %v", err)
+	}
+	deadline := time.Now().Add(stopTimeout + 10*time.Second)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return xerrors.Errorf("service %s didn't stop", name)
+		}
+		time.Sleep(300 * time.Millisecond)
+		status, err = s.Query()
+		if err != nil {
+			return xerrors.Errorf("service status: %v", err)
+		}
+	}
+	return nil
+}
+
+// runService runs the conodes of the config files under the service manager,
+// sending the log to the event log.
+func runService(name string, configs []string) error {
+	el, err := log.NewEventLogLogger(&log.LoggerInfo{DebugLvl: log.DebugVisible()}, name)
+	if err != nil {
+		return err
+	}
+	defer log.UnregisterLogger(log.RegisterLogger(el))
+	if err := svc.Run(name, &conodeService{configs: configs}); err != nil {
+		return xerrors.Errorf("running service: %v", err)
+	}
+	return nil
+}
+
+// conodeService is the handler of the requests of the service manager.
+type conodeService struct {
+	configs []string
+}
+
+// Execute starts the conodes and stops them, once their work in progress is
+// done, when the service is stopped or Windows shuts down.
+func (cs *conodeService) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown
+	s <- svc.Status{State: svc.StartPending}
+
+	running := make(chan struct{})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runServers(func() ([]*CothorityConfig, []*onet.Server, error) {
+			return ParseCothorities(cs.configs...)
+		}, func() { close(running) }, stop)
+	}()
+
+	for {
+		select {
+		case <-running:
+			s <- svc.Status{State: svc.Running, Accepts: accepts}
+			log.Info("Service running")
+			running = nil
+		case <-done:
+			// the conodes stopped by themselves
+			return false, 0
+		case req := <-r:
+			switch req.Cmd {
+			case svc.Interrogate:
+				s <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				log.Info("Stopping service")
+				s <- svc.Status{State: svc.StopPending,
+					WaitHint: uint32((stopTimeout + 5*time.Second) / time.Millisecond)}
+				close(stop)
+				<-done
+				s <- svc.Status{State: svc.Stopped}
+				return false, 0
+			default:
+				log.Warn("Unexpected service request", req.Cmd)
+			}
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package onet
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// Outcomes of the client requests written in the audit log.
+const (
+	AuditOK           = "ok"
+	AuditError        = "error"
+	AuditUnauthorized = "unauthorized"
+	AuditCancelled    = "cancelled"
+)
+
+// AuditConfig describes where and how the client requests are audited.
+type AuditConfig struct {
+	// Path is the file the records are appended to.
+	Path string
+	// MaxSize is the size in bytes after which the file is rotated. If it is
+	// 0, the file is never rotated.
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept. If it is 0, all files
+	// are kept.
+	MaxFiles int
+	// HashChain links every record to the previous one by including its
+	// hash, so that removing or changing a record can be detected with
+	// VerifyAuditLog.
+	HashChain bool
+}
+
+// AuditRecord is an entry of the audit log. The log holds one record per
+// line, encoded in JSON. A streaming request has a record for every message
+// of the client, and a REST request is recorded with the status of its
+// response as error.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Remote is the address of the client.
+	Remote string `json:"remote"`
+	// Identities are the keys that signed the request, if the handler is
+	// protected by a rule.
+	Identities []string      `json:"identities,omitempty"`
+	Service    string        `json:"service"`
+	Message    string        `json:"message"`
+	Outcome    string        `json:"outcome"`
+	Error      string        `json:"error,omitempty"`
+	Latency    time.Duration `json:"latency"`
+	// Prev and Hash are only set if the log is hash-chained.
+	Prev string `json:"prev,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// hash returns the hash of the record without its Hash field.
+func (r AuditRecord) hash() (string, error) {
+	r.Hash = ""
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return "", xerrors.Errorf("encoding record: %v", err)
+	}
+	h := sha256.Sum256(buf)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// AuditLog is an append-only log of the client requests.
+type AuditLog struct {
+	sync.Mutex
+	cfg  AuditConfig
+	file *os.File
+	size int64
+	prev string
+}
+
+// NewAuditLog opens the audit log, appending to the file if it exists.
+func NewAuditLog(cfg AuditConfig) (*AuditLog, error) {
+	if cfg.Path == "" {
+		return nil, xerrors.New("missing path of the audit log")
+	}
+	a := &AuditLog{cfg: cfg}
+	if cfg.HashChain {
+		prev, err := lastAuditHash(cfg.Path)
+		if err != nil {
+			return nil, xerrors.Errorf("reading audit log: %v", err)
+		}
+		a.prev = prev
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *AuditLog) open() error {
+	f, err := os.OpenFile(a.cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return xerrors.Errorf("opening audit log: %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return xerrors.Errorf("opening audit log: %v", err)
+	}
+	a.file = f
+	a.size = fi.Size()
+	return nil
+}
+
+// lastAuditHash returns the hash of the last record of the file, or an empty
+// string if there is none.
+func lastAuditHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var last []byte
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		if len(s.Bytes()) > 0 {
+			last = append(last[:0], s.Bytes()...)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	if last == nil {
+		return "", nil
+	}
+	var rec AuditRecord
+	if err := json.Unmarshal(last, &rec); err != nil {
+		return "", xerrors.Errorf("decoding last record: %v", err)
+	}
+	return rec.Hash, nil
+}
+
+// Log appends the record to the log.
+func (a *AuditLog) Log(rec *AuditRecord) error {
+	a.Lock()
+	defer a.Unlock()
+	if a.file == nil {
+		return xerrors.New("audit log is closed")
+	}
+	if a.cfg.HashChain {
+		rec.Prev = a.prev
+		h, err := rec.hash()
+		if err != nil {
+			return err
+		}
+		rec.Hash = h
+	}
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return xerrors.Errorf("encoding record: %v", err)
+	}
+	buf = append(buf, '\n')
+	if a.cfg.MaxSize > 0 && a.size > 0 && a.size+int64(len(buf)) > a.cfg.MaxSize {
+		if err := a.rotate(); err != nil {
+			return xerrors.Errorf("rotating: %v", err)
+		}
+	}
+	n, err := a.file.Write(buf)
+	a.size += int64(n)
+	if err != nil {
+		return xerrors.Errorf("writing record: %v", err)
+	}
+	a.prev = rec.Hash
+	return nil
+}
+
+// rotate renames the current file by appending the time to its name, and
+// removes the oldest files if there are more than MaxFiles.
+func (a *AuditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	a.file = nil
+	rotated := a.cfg.Path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+	if err := os.Rename(a.cfg.Path, rotated); err != nil {
+		return err
+	}
+	if a.cfg.MaxFiles > 0 {
+		files, err := filepath.Glob(a.cfg.Path + ".*")
+		if err != nil {
+			return err
+		}
+		sort.Strings(files)
+		for len(files) > a.cfg.MaxFiles {
+			if err := os.Remove(files[0]); err != nil {
+				return err
+			}
+			files = files[1:]
+		}
+	}
+	return a.open()
+}
+
+// Close closes the file of the log.
+func (a *AuditLog) Close() error {
+	a.Lock()
+	defer a.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// VerifyAuditLog checks the hash chain of the records read from r. prev is
+// the hash of the record preceding the first one, which is empty for the
+// first file of a log. It returns the hash of the last record, to verify the
+// next file.
+func VerifyAuditLog(r io.Reader, prev string) (string, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var rec AuditRecord
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return "", xerrors.Errorf("line %d: decoding: %v", line, err)
+		}
+		if rec.Prev != prev {
+			return "", xerrors.Errorf("line %d: wrong link to the previous record", line)
+		}
+		h, err := rec.hash()
+		if err != nil {
+			return "", xerrors.Errorf("line %d: %v", line, err)
+		}
+		if h != rec.Hash {
+			return "", xerrors.Errorf("line %d: wrong hash", line)
+		}
+		prev = rec.Hash
+	}
+	if err := s.Err(); err != nil {
+		return "", xerrors.Errorf("reading: %v", err)
+	}
+	return prev, nil
+}
+
+type auditKey struct{}
+
+// auditRecord returns the record of the request in ctx, or nil if the request
+// is not audited.
+func auditRecord(ctx context.Context) *AuditRecord {
+	rec, _ := ctx.Value(auditKey{}).(*AuditRecord)
+	return rec
+}
+
+// logRequest completes the record with the outcome of the request and
+// appends it to the log.
+func (a *AuditLog) logRequest(ctx context.Context, rec *AuditRecord, err error) {
+	rec.Latency = time.Since(rec.Time)
+	switch {
+	case err == nil:
+		rec.Outcome = AuditOK
+	case xerrors.Is(err, ErrUnauthorized):
+		rec.Outcome = AuditUnauthorized
+	case ctx.Err() != nil:
+		rec.Outcome = AuditCancelled
+	default:
+		rec.Outcome = AuditError
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if err := a.Log(rec); err != nil {
+		log.Error("writing audit log:", err)
+	}
+}
+
+type auditStreamKey struct{}
+
+// auditStream holds the log and the template of the records of the messages
+// of a streaming request.
+type auditStream struct {
+	log *AuditLog
+	rec AuditRecord
+}
+
+// auditStreamMessage returns a context holding the record of a message of the
+// streaming request in ctx, and the function writing the record once the
+// message is processed. If the request is not audited, ctx is returned as is.
+func auditStreamMessage(ctx context.Context) (context.Context, func(error)) {
+	s, ok := ctx.Value(auditStreamKey{}).(*auditStream)
+	if !ok {
+		return ctx, func(error) {}
+	}
+	rec := s.rec
+	rec.Time = time.Now()
+	ctx = context.WithValue(ctx, auditKey{}, &rec)
+	return ctx, func(err error) { s.log.logRequest(ctx, &rec, err) }
+}
+
+// SetAuditLog sets the log where the client requests are recorded. It must
+// be called before the services are registered.
+func (w *WebSocket) SetAuditLog(a *AuditLog) {
+	w.Lock()
+	defer w.Unlock()
+	w.audit = a
+}
+
+func (w *WebSocket) auditLog() *AuditLog {
+	w.Lock()
+	defer w.Unlock()
+	return w.audit
+}
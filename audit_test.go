@@ -0,0 +1,204 @@
+package onet
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cfg := AuditConfig{
+		Path:      filepath.Join(dir, "audit.log"),
+		MaxSize:   1000,
+		MaxFiles:  2,
+		HashChain: true,
+	}
+
+	a, err := NewAuditLog(cfg)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, a.Log(&AuditRecord{Service: "s", Message: "m", Outcome: AuditOK}))
+	}
+	require.NoError(t, a.Close())
+	require.Error(t, a.Log(&AuditRecord{}))
+
+	// reopening continues the chain
+	a, err = NewAuditLog(cfg)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, a.Log(&AuditRecord{Service: "s", Message: "m", Outcome: AuditOK}))
+	}
+	require.NoError(t, a.Close())
+
+	rotated, err := filepath.Glob(cfg.Path + ".*")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(rotated))
+	sort.Strings(rotated)
+
+	// the oldest file has been removed, so start from its last hash
+	f, err := os.Open(rotated[0])
+	require.NoError(t, err)
+	var first AuditRecord
+	s := bufio.NewScanner(f)
+	require.True(t, s.Scan())
+	require.NoError(t, json.Unmarshal(s.Bytes(), &first))
+	f.Close()
+	prev := first.Prev
+	for _, p := range append(rotated, cfg.Path) {
+		f, err := os.Open(p)
+		require.NoError(t, err)
+		prev, err = VerifyAuditLog(f, prev)
+		f.Close()
+		require.NoError(t, err)
+	}
+
+	buf, err := ioutil.ReadFile(cfg.Path)
+	require.NoError(t, err)
+	tampered := strings.Replace(string(buf), `"service":"s"`, `"service":"x"`, 1)
+	_, err = VerifyAuditLog(strings.NewReader(tampered), "")
+	require.Error(t, err)
+}
+
+func TestWebSocket_Audit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	a, err := NewAuditLog(AuditConfig{Path: filepath.Join(dir, "audit.log")})
+	require.NoError(t, err)
+	defer a.Close()
+
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+	ts := server.Service(testServiceName).(*testService)
+	srv := httptest.NewServer(&wsHandler{
+		service:     ts,
+		serviceName: testServiceName,
+		sessions:    new(int64),
+		typesRx:     new(network.TypeCounter),
+		typesTx:     new(network.TypeCounter),
+		audit:       a,
+	})
+	defer srv.Close()
+	si := *server.ServerIdentity
+	si.URL = srv.URL
+
+	client := NewClient(tSuite, testServiceName)
+	defer client.Close()
+	require.NoError(t, client.SendProtobuf(&si, &testMsg{12}, &testMsg{}))
+	require.Error(t, client.SendProtobuf(&si, &testPanicMsg{}, nil))
+	kp := key.NewKeyPair(tSuite)
+	require.NoError(t, ts.SetRule("testMsg", Identity(kp.Public)))
+	defer ts.SetRule("testMsg", "")
+	require.NoError(t, client.SendProtobufSigned(&si, &testMsg{12}, &testMsg{}, kp.Private))
+	require.Error(t, client.SendProtobuf(&si, &testMsg{12}, &testMsg{}))
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "audit.log"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	require.Equal(t, 4, len(lines))
+	var recs []AuditRecord
+	for _, l := range lines {
+		var rec AuditRecord
+		require.NoError(t, json.Unmarshal([]byte(l), &rec))
+		require.Equal(t, testServiceName, rec.Service)
+		require.NotEqual(t, "", rec.Remote)
+		recs = append(recs, rec)
+	}
+	require.Equal(t, "testMsg", recs[0].Message)
+	require.Equal(t, AuditOK, recs[0].Outcome)
+	require.Equal(t, "testPanicMsg", recs[1].Message)
+	require.Equal(t, AuditError, recs[1].Outcome)
+	require.Contains(t, recs[1].Error, "deadbeef")
+	require.Equal(t, AuditOK, recs[2].Outcome)
+	require.Equal(t, []string{Identity(kp.Public)}, recs[2].Identities)
+	require.Equal(t, AuditUnauthorized, recs[3].Outcome)
+	require.Equal(t, "", recs[3].Hash)
+}
+
+func TestAudit_StreamingREST(t *testing.T) {
+	log.AddUserUninterestingGoroutine("created by net/http.(*Transport).dialConn")
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	a, err := NewAuditLog(AuditConfig{Path: filepath.Join(dir, "audit.log")})
+	require.NoError(t, err)
+	defer a.Close()
+
+	serName := "streamingService"
+	_, err = RegisterNewService(serName, newStreamingService)
+	require.NoError(t, err)
+	defer UnregisterService(serName)
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	server := local.GenServers(1)[0]
+	server.WebSocket.SetAuditLog(a)
+
+	// streaming request
+	srv := httptest.NewServer(&wsHandler{
+		service:     server.Service(serName),
+		serviceName: serName,
+		sessions:    new(int64),
+		typesRx:     new(network.TypeCounter),
+		typesTx:     new(network.TypeCounter),
+		audit:       a,
+	})
+	defer srv.Close()
+	si := *server.ServerIdentity
+	si.URL = srv.URL
+	client := NewClient(tSuite, serName)
+	defer client.Close()
+	conn, err := client.Stream(&si, &SimpleRequest{Val: 1})
+	require.NoError(t, err)
+	require.NoError(t, conn.ReadMessage(&SimpleResponse{}))
+	require.Error(t, conn.ReadMessage(&SimpleResponse{}))
+
+	// REST requests
+	port, err := strconv.Atoi(server.ServerIdentity.Address.Port())
+	require.NoError(t, err)
+	addr := "http://" + server.ServerIdentity.Address.Host() + ":" + strconv.Itoa(port+1)
+	resp, err := http.Get(addr + "/v3/testService/restMsgGET1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, err = http.Post(addr+"/v3/testService/restMsgPOSTString", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "audit.log"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	require.Equal(t, 3, len(lines))
+	var recs []AuditRecord
+	for _, l := range lines {
+		var rec AuditRecord
+		require.NoError(t, json.Unmarshal([]byte(l), &rec))
+		require.NotEqual(t, "", rec.Remote)
+		recs = append(recs, rec)
+	}
+	require.Equal(t, serName, recs[0].Service)
+	require.Equal(t, "SimpleRequest", recs[0].Message)
+	require.Equal(t, AuditOK, recs[0].Outcome)
+	require.Equal(t, testServiceName, recs[1].Service)
+	require.Equal(t, "restMsgGET1", recs[1].Message)
+	require.Equal(t, AuditOK, recs[1].Outcome)
+	require.Equal(t, "restMsgPOSTString", recs[2].Message)
+	require.Equal(t, AuditError, recs[2].Outcome)
+}
@@ -0,0 +1,441 @@
+package onet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ErrUnauthorized is returned when a request to a handler protected by a rule
+// is not signed by a set of keys satisfying the rule.
+var ErrUnauthorized = xerrors.New("unauthorized")
+
+// SignedRequestWindow is the maximum difference between the timestamp of a
+// signed request and the local time. The conode remembers the requests it
+// accepted during that time, so that they can't be replayed.
+var SignedRequestWindow = 5 * time.Minute
+
+// ClientSignature is the schnorr signature of a client on a SignedRequest.
+type ClientSignature struct {
+	Public    []byte
+	Signature []byte
+}
+
+// SignedRequest is the envelope a client sends to a handler protected by a
+// rule. The signatures cover the conode, the service, the handler, the
+// timestamp and the message, so a request cannot be used for another handler
+// or sent to another conode.
+type SignedRequest struct {
+	// Message is the protobuf-encoded request for the handler.
+	Message []byte
+	// Timestamp is the time of signing in nanoseconds since the epoch.
+	Timestamp  int64
+	Signatures []ClientSignature
+	// Capability, if set, gives access to the handler whatever the rule.
+	Capability *Capability
+}
+
+// signedRequestDigest returns the hash signed by the clients.
+func signedRequestDigest(dst network.ServerIdentityID, service, path string,
+	ts int64, msg []byte) []byte {
+	h := sha256.New()
+	h.Write(dst[:])
+	h.Write([]byte(service))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	binary.Write(h, binary.LittleEndian, ts)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// NewSignedRequest signs the encoded message for the handler at path of the
+// service of the conode dst with all the private keys.
+func NewSignedRequest(suite network.Suite, dst network.ServerIdentityID,
+	service, path string, msg []byte, privates ...kyber.Scalar) (*SignedRequest, error) {
+	sr := &SignedRequest{
+		Message:   msg,
+		Timestamp: time.Now().UnixNano(),
+	}
+	digest := signedRequestDigest(dst, service, path, sr.Timestamp, msg)
+	for _, priv := range privates {
+		pub, err := suite.Point().Mul(priv, nil).MarshalBinary()
+		if err != nil {
+			return nil, xerrors.Errorf("marshaling public key: %v", err)
+		}
+		sig, err := schnorr.Sign(suite, priv, digest)
+		if err != nil {
+			return nil, xerrors.Errorf("signing: %v", err)
+		}
+		sr.Signatures = append(sr.Signatures, ClientSignature{
+			Public:    pub,
+			Signature: sig,
+		})
+	}
+	return sr, nil
+}
+
+// verify checks the timestamp and the signatures of the request sent to the
+// conode dst, and returns the identities of the signers.
+func (sr *SignedRequest) verify(suite network.Suite, dst network.ServerIdentityID,
+	service, path string) ([]string, error) {
+	diff := time.Since(time.Unix(0, sr.Timestamp))
+	if diff > SignedRequestWindow || -diff > SignedRequestWindow {
+		return nil, xerrors.New("timestamp outside of the allowed window")
+	}
+	digest := signedRequestDigest(dst, service, path, sr.Timestamp, sr.Message)
+	ids := make([]string, 0, len(sr.Signatures))
+	for _, s := range sr.Signatures {
+		pub := suite.Point()
+		if err := pub.UnmarshalBinary(s.Public); err != nil {
+			return nil, xerrors.Errorf("unmarshaling public key: %v", err)
+		}
+		if err := schnorr.Verify(suite, pub, digest, s.Signature); err != nil {
+			return nil, xerrors.Errorf("invalid signature of %s: %v", Identity(pub), err)
+		}
+		ids = append(ids, Identity(pub))
+	}
+	return ids, nil
+}
+
+// seenRequests remembers the digests of the signed requests accepted during
+// the validity window.
+type seenRequests struct {
+	sync.Mutex
+	expiry map[string]time.Time
+}
+
+// add returns false if the request with this digest and timestamp has already
+// been accepted.
+func (s *seenRequests) add(digest []byte, ts int64) bool {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	if s.expiry == nil {
+		s.expiry = make(map[string]time.Time)
+	}
+	for d, exp := range s.expiry {
+		if now.After(exp) {
+			delete(s.expiry, d)
+		}
+	}
+	if _, ok := s.expiry[string(digest)]; ok {
+		return false
+	}
+	s.expiry[string(digest)] = time.Unix(0, ts).Add(SignedRequestWindow)
+	return true
+}
+
+// Identity returns how a public key is written in a rule: "key:" followed by
+// the hex-encoded public key.
+func Identity(pub kyber.Point) string {
+	buf, err := pub.MarshalBinary()
+	if err != nil {
+		return "key:invalid"
+	}
+	return "key:" + hex.EncodeToString(buf)
+}
+
+// Rule is an access-control rule of a handler. Like the expressions of darcs,
+// it combines identities with '&' (and), '|' (or) and parentheses, e.g.,
+//
+//	key:abcd... | (key:0123... & key:4567...)
+//
+// where '&' binds tighter than '|'. A request satisfies the rule if the
+// expression is true when the identities that signed it are true.
+type Rule struct {
+	expr string
+	root ruleNode
+}
+
+type ruleNode interface {
+	eval(ids map[string]bool) bool
+}
+
+type ruleID string
+
+func (r ruleID) eval(ids map[string]bool) bool { return ids[string(r)] }
+
+type ruleOp struct {
+	and  bool
+	l, r ruleNode
+}
+
+func (o ruleOp) eval(ids map[string]bool) bool {
+	if o.and {
+		return o.l.eval(ids) && o.r.eval(ids)
+	}
+	return o.l.eval(ids) || o.r.eval(ids)
+}
+
+// ParseRule parses a rule expression.
+func ParseRule(expr string) (*Rule, error) {
+	p := &ruleParser{tokens: tokenizeRule(expr)}
+	root, err := p.or()
+	if err != nil {
+		return nil, xerrors.Errorf("parsing rule: %v", err)
+	}
+	if p.pos != len(p.tokens) {
+		return nil, xerrors.Errorf("parsing rule: unexpected '%s'", p.tokens[p.pos])
+	}
+	return &Rule{expr: expr, root: root}, nil
+}
+
+// Evaluate returns whether the identities satisfy the rule.
+func (r *Rule) Evaluate(identities []string) bool {
+	ids := make(map[string]bool)
+	for _, id := range identities {
+		ids[id] = true
+	}
+	return r.root.eval(ids)
+}
+
+// String returns the expression of the rule.
+func (r *Rule) String() string {
+	return r.expr
+}
+
+func tokenizeRule(expr string) []string {
+	var tokens []string
+	start := -1
+	for i, c := range expr {
+		switch c {
+		case '&', '|', '(', ')', ' ', '\t', '\n':
+			if start >= 0 {
+				tokens = append(tokens, expr[start:i])
+				start = -1
+			}
+			if c != ' ' && c != '\t' && c != '\n' {
+				tokens = append(tokens, string(c))
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, expr[start:])
+	}
+	return tokens
+}
+
+type ruleParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *ruleParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *ruleParser) or() (ruleNode, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "|" {
+		p.pos++
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = ruleOp{and: false, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *ruleParser) and() (ruleNode, error) {
+	l, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&" {
+		p.pos++
+		r, err := p.atom()
+		if err != nil {
+			return nil, err
+		}
+		l = ruleOp{and: true, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *ruleParser) atom() (ruleNode, error) {
+	tok := p.peek()
+	switch tok {
+	case "":
+		return nil, xerrors.New("unexpected end of expression")
+	case "&", "|", ")":
+		return nil, xerrors.Errorf("unexpected '%s'", tok)
+	case "(":
+		p.pos++
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, xerrors.New("missing ')'")
+		}
+		p.pos++
+		return n, nil
+	}
+	if !strings.HasPrefix(tok, "key:") {
+		return nil, xerrors.Errorf("unknown identity '%s'", tok)
+	}
+	if buf, err := hex.DecodeString(tok[len("key:"):]); err != nil || len(buf) == 0 {
+		return nil, xerrors.Errorf("invalid key in '%s'", tok)
+	}
+	p.pos++
+	return ruleID(tok), nil
+}
+
+// handlerRules holds the rules of the handlers of a ServiceProcessor.
+type handlerRules struct {
+	sync.RWMutex
+	rules map[string]*Rule
+}
+
+func (hr *handlerRules) get(path string) *Rule {
+	hr.RLock()
+	defer hr.RUnlock()
+	return hr.rules[path]
+}
+
+func (hr *handlerRules) set(path string, r *Rule) {
+	hr.Lock()
+	defer hr.Unlock()
+	if hr.rules == nil {
+		hr.rules = make(map[string]*Rule)
+	}
+	if r == nil {
+		delete(hr.rules, path)
+		return
+	}
+	hr.rules[path] = r
+}
+
+// SetRule protects the handler of the message called path with a rule. The
+// clients must then send a SignedRequest, e.g., with Client.SendProtobufSigned,
+// and the handler is only called if the signers satisfy the rule. An empty
+// expression removes the rule. Handlers protected by a rule cannot be used
+// over the REST API.
+func (p *ServiceProcessor) SetRule(path, expr string) error {
+	if _, ok := p.handlers[path]; !ok {
+		return xerrors.New("the requested message hasn't been registered: " + path)
+	}
+	if expr == "" {
+		p.rules.set(path, nil)
+		return nil
+	}
+	r, err := ParseRule(expr)
+	if err != nil {
+		return err
+	}
+	p.rules.set(path, r)
+	return nil
+}
+
+// authorize checks the request if the handler is protected by a rule, and
+// returns the message for the handler.
+func (p *ServiceProcessor) authorize(ctx context.Context, path string, buf []byte) ([]byte, error) {
+	rule := p.rules.get(path)
+	if rule == nil {
+		return buf, nil
+	}
+	if signer := RequestSigner(ctx); signer != nil {
+		// signed next to the message, see Client.SetSigner
+		if !rule.Evaluate([]string{Identity(signer)}) {
+			return nil, xerrors.Errorf("rule '%s' not satisfied: %w", rule, ErrUnauthorized)
+		}
+		return buf, nil
+	}
+	sr := &SignedRequest{}
+	if err := protobuf.Decode(buf, sr); err != nil {
+		return nil, xerrors.Errorf("decoding signed request: %v: %w", err, ErrUnauthorized)
+	}
+	suite := p.Context.server.Suite()
+	dst := p.Context.server.ServerIdentity.ID
+	service := ServiceFactory.Name(p.ServiceID())
+	ids, err := sr.verify(suite, dst, service, path)
+	if err != nil {
+		return nil, xerrors.Errorf("%v: %w", err, ErrUnauthorized)
+	}
+	if !p.seen.add(signedRequestDigest(dst, service, path, sr.Timestamp, sr.Message),
+		sr.Timestamp) {
+		return nil, xerrors.Errorf("request replayed: %w", ErrUnauthorized)
+	}
+	if sr.Capability != nil {
+		err := p.server.verifyCapability(sr.Capability, service, path)
+		if err != nil {
+			return nil, xerrors.Errorf("%v: %w", err, ErrUnauthorized)
+		}
+		ids = append(ids, sr.Capability.ID())
+	}
+	if rec := auditRecord(ctx); rec != nil {
+		rec.Identities = ids
+	}
+	if sr.Capability != nil {
+		return sr.Message, nil
+	}
+	if !rule.Evaluate(ids) {
+		return nil, xerrors.Errorf("rule '%s' not satisfied: %w", rule, ErrUnauthorized)
+	}
+	return sr.Message, nil
+}
+
+// SendProtobufSigned is like SendProtobuf, but sends the message in a
+// SignedRequest signed by all the private keys, for handlers protected by a
+// rule.
+func (c *Client) SendProtobufSigned(dst *network.ServerIdentity, msg interface{},
+	ret interface{}, privates ...kyber.Scalar) error {
+	return c.sendSignedRequest(dst, msg, ret, nil, privates...)
+}
+
+// sendSignedRequest sends the message in a SignedRequest with the capability
+// and signed by all the private keys.
+func (c *Client) sendSignedRequest(dst *network.ServerIdentity, msg interface{},
+	ret interface{}, capa *Capability, privates ...kyber.Scalar) error {
+	buf, err := protobuf.Encode(msg)
+	if err != nil {
+		return xerrors.Errorf("encoding: %v", err)
+	}
+	path := strings.Split(reflect.TypeOf(msg).String(), ".")[1]
+	sr, err := NewSignedRequest(c.suite, dst.ID, c.service, path, buf, privates...)
+	if err != nil {
+		return xerrors.Errorf("signing: %v", err)
+	}
+	sr.Capability = capa
+	buf, err = protobuf.Encode(sr)
+	if err != nil {
+		return xerrors.Errorf("encoding: %v", err)
+	}
+	// the request is bound to dst, so it can't fail over, and it is
+	// already signed
+	ctx := context.WithValue(c.withRetryBudget(context.Background()), unsignedKey{}, true)
+	reply, _, err := c.send(ctx, dst, path, buf)
+	if err != nil {
+		return xerrors.Errorf("sending: %w", err)
+	}
+	if ret != nil {
+		err := protobuf.DecodeWithConstructors(reply, ret, network.DefaultConstructors(c.suite))
+		if err != nil {
+			return xerrors.Errorf("decoding: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package onet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("key:0a | key:0b & (key:0c | key:0d)")
+	require.NoError(t, err)
+	require.True(t, r.Evaluate([]string{"key:0a"}))
+	require.False(t, r.Evaluate([]string{"key:0b"}))
+	require.True(t, r.Evaluate([]string{"key:0b", "key:0d"}))
+	require.False(t, r.Evaluate([]string{"key:0c", "key:0d"}))
+	require.False(t, r.Evaluate(nil))
+
+	for _, expr := range []string{"", "key:0a &", "(key:0a", "key:0a)",
+		"key:0a key:0b", "user:0a", "& key:0a", "key:", "key:xyz"} {
+		_, err := ParseRule(expr)
+		require.Error(t, err, expr)
+	}
+}
+
+func TestSignedRequest_Verify(t *testing.T) {
+	kp1 := key.NewKeyPair(tSuite)
+	kp2 := key.NewKeyPair(tSuite)
+	dst := network.NewServerIdentity(kp1.Public, network.NewLocalAddress("conode")).ID
+	sr, err := NewSignedRequest(tSuite, dst, "service", "path", []byte("msg"),
+		kp1.Private, kp2.Private)
+	require.NoError(t, err)
+
+	ids, err := sr.verify(tSuite, dst, "service", "path")
+	require.NoError(t, err)
+	require.Equal(t, []string{Identity(kp1.Public), Identity(kp2.Public)}, ids)
+
+	_, err = sr.verify(tSuite, dst, "service", "other")
+	require.Error(t, err)
+	other := network.NewServerIdentity(kp2.Public, network.NewLocalAddress("other")).ID
+	_, err = sr.verify(tSuite, other, "service", "path")
+	require.Error(t, err)
+	sr.Message = []byte("other")
+	_, err = sr.verify(tSuite, dst, "service", "path")
+	require.Error(t, err)
+
+	sr, err = NewSignedRequest(tSuite, dst, "service", "path", []byte("msg"), kp1.Private)
+	require.NoError(t, err)
+	sr.Timestamp -= int64(2 * SignedRequestWindow)
+	_, err = sr.verify(tSuite, dst, "service", "path")
+	require.Error(t, err)
+}
+
+func TestServiceProcessor_Rule(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	h := local.GenServers(1)[0]
+	ts := h.Service(testServiceName).(*testService)
+
+	admin1 := key.NewKeyPair(tSuite)
+	admin2 := key.NewKeyPair(tSuite)
+	other := key.NewKeyPair(tSuite)
+	require.Error(t, ts.SetRule("unknown", Identity(admin1.Public)))
+	require.Error(t, ts.SetRule("testMsg", "key:"))
+	require.NoError(t, ts.SetRule("testMsg",
+		Identity(admin1.Public)+" & "+Identity(admin2.Public)))
+
+	send := func(sign bool, keys ...*key.Pair) error {
+		client := local.NewClient(testServiceName)
+		defer client.Close()
+		reply := &testMsg{}
+		var err error
+		if sign {
+			privates := make([]kyber.Scalar, len(keys))
+			for i, kp := range keys {
+				privates[i] = kp.Private
+			}
+			err = client.SendProtobufSigned(h.ServerIdentity, &testMsg{12}, reply, privates...)
+		} else {
+			err = client.SendProtobuf(h.ServerIdentity, &testMsg{12}, reply)
+		}
+		if err == nil && reply.I != 12 {
+			return xerrors.New("wrong reply")
+		}
+		return err
+	}
+
+	require.Error(t, send(false))
+	require.Error(t, send(true, admin1))
+	require.Error(t, send(true, admin1, other))
+	require.NoError(t, send(true, admin1, admin2))
+	require.NoError(t, send(true, admin2, other, admin1))
+
+	// the error returned by the dispatcher
+	sr, err := NewSignedRequest(tSuite, h.ServerIdentity.ID, testServiceName,
+		"testMsg", nil, other.Private)
+	require.NoError(t, err)
+	buf, err := protobuf.Encode(sr)
+	require.NoError(t, err)
+	_, err = ts.authorize(context.Background(), "testMsg", buf)
+	require.True(t, xerrors.Is(err, ErrUnauthorized))
+
+	// a request can't be replayed
+	sr, err = NewSignedRequest(tSuite, h.ServerIdentity.ID, testServiceName,
+		"testMsg", nil, admin1.Private, admin2.Private)
+	require.NoError(t, err)
+	buf, err = protobuf.Encode(sr)
+	require.NoError(t, err)
+	_, err = ts.authorize(context.Background(), "testMsg", buf)
+	require.NoError(t, err)
+	_, err = ts.authorize(context.Background(), "testMsg", buf)
+	require.True(t, xerrors.Is(err, ErrUnauthorized))
+	require.Contains(t, err.Error(), "replayed")
+
+	require.NoError(t, ts.SetRule("testMsg", ""))
+	require.NoError(t, send(false))
+}
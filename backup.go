@@ -0,0 +1,572 @@
+package onet
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+// BackupConfig ships backups of the database of the services to a bucket of
+// an S3-compatible object storage, like AWS S3 or MinIO. A backup chain
+// starts with a full snapshot, followed by incremental diffs holding the
+// values changed since the previous backup. If the database is encrypted,
+// the backups are too. RestoreBackup gets the latest state back.
+type BackupConfig struct {
+	// Endpoint is the URL of the object storage, e.g.,
+	// "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000".
+	Endpoint string
+	// Region of the bucket, by default "us-east-1".
+	Region string `toml:",omitempty"`
+	// Bucket receiving the backups.
+	Bucket string
+	// Prefix of the objects of the conode, ending with "/". If it is empty,
+	// the hash of the public key of the conode is used, as for its
+	// database, or of the one of ServerOptions.StorageKey.
+	Prefix string `toml:",omitempty"`
+	// AccessKey and SecretKey are the credentials. If they are empty, the
+	// environment variables AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are
+	// used.
+	AccessKey string `toml:",omitempty"`
+	SecretKey string `toml:",omitempty"`
+	// Interval between two backups, like "1h", which is the default.
+	Interval string `toml:",omitempty"`
+	// FullEvery is the number of incremental backups after which a new
+	// chain starts with a full snapshot, 24 by default.
+	FullEvery int `toml:",omitempty"`
+	// KeepChains is the number of chains kept in the bucket, 7 by default.
+	KeepChains int `toml:",omitempty"`
+}
+
+// client returns the client of the object storage.
+func (cfg BackupConfig) client() (*s3Client, error) {
+	access, secret := cfg.AccessKey, cfg.SecretKey
+	if access == "" {
+		access = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if secret == "" {
+		secret = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	return newS3Client(cfg.Endpoint, cfg.Region, cfg.Bucket, access, secret)
+}
+
+// prefix returns the prefix of the objects of the conode with the given
+// public key.
+func (cfg BackupConfig) prefix(public kyber.Point) (string, error) {
+	if cfg.Prefix != "" {
+		return cfg.Prefix, nil
+	}
+	pub, err := public.MarshalBinary()
+	if err != nil {
+		return "", xerrors.Errorf("marshaling public key: %v", err)
+	}
+	return fmt.Sprintf("%x/", sha256.Sum256(pub)), nil
+}
+
+// backupFull and backupIncrement name the objects of a chain.
+const (
+	backupFull      = "full.db"
+	backupIncrement = "incr-%06d.bin"
+)
+
+// backupEntry is a key of a bucket, with its value or the hash of its value.
+type backupEntry struct {
+	Bucket []byte
+	Key    []byte
+	Value  []byte
+}
+
+// backupDiff is an incremental backup.
+type backupDiff struct {
+	// Buckets are all the buckets after the diff. The others are removed.
+	Buckets [][]byte
+	// Puts are the values written since the previous backup.
+	Puts []backupEntry
+	// Deletes are the keys removed since the previous backup.
+	Deletes []backupEntry
+}
+
+// backupState is kept next to the database to compute the next diff.
+type backupState struct {
+	Chain string
+	// Seq is the number of incremental backups in the chain.
+	Seq int
+	// Entries hold the hashes of the values of the last backup, and the
+	// empty buckets.
+	Entries []backupEntry
+}
+
+// backupIndex maps the buckets to the hashes of the values of their keys.
+type backupIndex map[string]map[string][32]byte
+
+func (idx backupIndex) entries() []backupEntry {
+	var es []backupEntry
+	for b, keys := range idx {
+		if len(keys) == 0 {
+			es = append(es, backupEntry{Bucket: []byte(b)})
+		}
+		for k, h := range keys {
+			hash := h
+			es = append(es, backupEntry{Bucket: []byte(b), Key: []byte(k), Value: hash[:]})
+		}
+	}
+	return es
+}
+
+func indexFromEntries(es []backupEntry) backupIndex {
+	idx := make(backupIndex)
+	for _, e := range es {
+		keys, ok := idx[string(e.Bucket)]
+		if !ok {
+			keys = make(map[string][32]byte)
+			idx[string(e.Bucket)] = keys
+		}
+		// an empty bucket has an entry without hash
+		if len(e.Value) > 0 {
+			var h [32]byte
+			copy(h[:], e.Value)
+			keys[string(e.Key)] = h
+		}
+	}
+	return idx
+}
+
+// diff returns the changes of the store since the index, and the index of
+// the store.
+func (idx backupIndex) diff(tx StoreTx) (*backupDiff, backupIndex, error) {
+	d := &backupDiff{}
+	now := make(backupIndex)
+	err := tx.ForEach(func(name []byte, b StoreBucket) error {
+		d.Buckets = append(d.Buckets, append([]byte{}, name...))
+		keys := make(map[string][32]byte)
+		now[string(name)] = keys
+		old := idx[string(name)]
+		return b.ForEach(func(k, v []byte) error {
+			h := sha256.Sum256(v)
+			keys[string(k)] = h
+			if oh, ok := old[string(k)]; !ok || oh != h {
+				d.Puts = append(d.Puts, backupEntry{
+					Bucket: append([]byte{}, name...),
+					Key:    append([]byte{}, k...),
+					Value:  append([]byte{}, v...),
+				})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for b, keys := range idx {
+		nk, ok := now[b]
+		if !ok {
+			// removed with its bucket
+			continue
+		}
+		for k := range keys {
+			if _, ok := nk[k]; !ok {
+				d.Deletes = append(d.Deletes, backupEntry{Bucket: []byte(b), Key: []byte(k)})
+			}
+		}
+	}
+	return d, now, nil
+}
+
+// changes returns whether the diff changes anything for the index it was
+// computed against.
+func (d *backupDiff) changes(idx backupIndex) bool {
+	return len(d.Puts) > 0 || len(d.Deletes) > 0 || len(d.Buckets) != len(idx)
+}
+
+// apply writes the diff to the transaction.
+func (d *backupDiff) apply(tx StoreTx) error {
+	keep := make(map[string]bool)
+	for _, b := range d.Buckets {
+		keep[string(b)] = true
+	}
+	var remove [][]byte
+	err := tx.ForEach(func(name []byte, b StoreBucket) error {
+		if !keep[string(name)] {
+			remove = append(remove, append([]byte{}, name...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range remove {
+		if err := tx.DeleteBucket(name); err != nil {
+			return xerrors.Errorf("deleting %s: %v", name, err)
+		}
+	}
+	for _, name := range d.Buckets {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return xerrors.Errorf("creating %s: %v", name, err)
+		}
+	}
+	for _, e := range d.Puts {
+		if err := tx.Bucket(e.Bucket).Put(e.Key, e.Value); err != nil {
+			return xerrors.Errorf("writing in %s: %v", e.Bucket, err)
+		}
+	}
+	for _, e := range d.Deletes {
+		if err := tx.Bucket(e.Bucket).Delete(e.Key); err != nil {
+			return xerrors.Errorf("deleting in %s: %v", e.Bucket, err)
+		}
+	}
+	return nil
+}
+
+// backupScheduler ships the backups of the database of a conode.
+type backupScheduler struct {
+	cfg        BackupConfig
+	client     *s3Client
+	prefix     string
+	interval   time.Duration
+	fullEvery  int
+	keepChains int
+	stop       chan struct{}
+	closing    sync.Once
+	stopped    sync.WaitGroup
+
+	sync.Mutex
+	last  time.Time
+	chain string
+	seq   int
+	err   error
+}
+
+func newBackupScheduler(cfg BackupConfig, public kyber.Point) (*backupScheduler, error) {
+	client, err := cfg.client()
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := cfg.prefix(public)
+	if err != nil {
+		return nil, err
+	}
+	bs := &backupScheduler{
+		cfg:        cfg,
+		client:     client,
+		prefix:     prefix,
+		interval:   time.Hour,
+		fullEvery:  cfg.FullEvery,
+		keepChains: cfg.KeepChains,
+		stop:       make(chan struct{}),
+	}
+	if cfg.Interval != "" {
+		bs.interval, err = time.ParseDuration(cfg.Interval)
+		if err != nil || bs.interval <= 0 {
+			return nil, xerrors.Errorf("invalid interval %q", cfg.Interval)
+		}
+	}
+	if bs.fullEvery <= 0 {
+		bs.fullEvery = 24
+	}
+	if bs.keepChains <= 0 {
+		bs.keepChains = 7
+	}
+	return bs, nil
+}
+
+func (bs *backupScheduler) start(s *serviceManager) {
+	bs.stopped.Add(1)
+	go func() {
+		defer bs.stopped.Done()
+		for {
+			select {
+			case <-bs.stop:
+				return
+			case <-time.After(bs.interval):
+			}
+			if err := bs.backup(s); err != nil {
+				log.Error("Backup:", err)
+			}
+		}
+	}()
+}
+
+// close stops the scheduler, waiting for a running backup. The server can be
+// closed several times.
+func (bs *backupScheduler) close() {
+	bs.closing.Do(func() { close(bs.stop) })
+	bs.stopped.Wait()
+}
+
+// statePath returns the file of the state of the backups.
+func (bs *backupScheduler) statePath(s *serviceManager) string {
+	return s.dbFileName() + ".backup"
+}
+
+func (bs *backupScheduler) loadState(s *serviceManager) *backupState {
+	buf, err := ioutil.ReadFile(bs.statePath(s))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("Reading backup state, starting a new chain:", err)
+		}
+		return nil
+	}
+	var st backupState
+	if err := protobuf.Decode(buf, &st); err != nil {
+		log.Warn("Decoding backup state, starting a new chain:", err)
+		return nil
+	}
+	return &st
+}
+
+func (bs *backupScheduler) saveState(s *serviceManager, st *backupState) error {
+	buf, err := protobuf.Encode(st)
+	if err != nil {
+		return xerrors.Errorf("encoding: %v", err)
+	}
+	tmp := bs.statePath(s) + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return xerrors.Errorf("writing: %v", err)
+	}
+	if err := os.Rename(tmp, bs.statePath(s)); err != nil {
+		return xerrors.Errorf("moving: %v", err)
+	}
+	return nil
+}
+
+// backup ships a full snapshot if a new chain is due, or else the diff since
+// the previous backup.
+func (bs *backupScheduler) backup(s *serviceManager) error {
+	st := bs.loadState(s)
+	var err error
+	if st == nil || st.Seq >= bs.fullEvery {
+		st, err = bs.full(s)
+	} else {
+		err = bs.incremental(s, st)
+	}
+	bs.Lock()
+	defer bs.Unlock()
+	bs.last = time.Now()
+	bs.err = err
+	if err != nil {
+		return err
+	}
+	bs.chain, bs.seq = st.Chain, st.Seq
+	return nil
+}
+
+// full ships a snapshot starting a new chain, and removes the old chains.
+func (bs *backupScheduler) full(s *serviceManager) (*backupState, error) {
+	tmp := bs.statePath(s) + ".full"
+	defer os.Remove(tmp)
+	if err := unwrapStore(s.store).Backup(tmp); err != nil {
+		return nil, xerrors.Errorf("snapshot: %v", err)
+	}
+	db, err := bbolt.Open(tmp, 0600, &bbolt.Options{ReadOnly: true})
+	if err != nil {
+		return nil, xerrors.Errorf("opening snapshot: %v", err)
+	}
+	var idx backupIndex
+	err = db.View(func(tx *bbolt.Tx) error {
+		_, idx, err = backupIndex{}.diff(boltTx{tx})
+		return err
+	})
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("indexing snapshot: %v", err)
+	}
+	buf, err := ioutil.ReadFile(tmp)
+	if err != nil {
+		return nil, xerrors.Errorf("reading snapshot: %v", err)
+	}
+
+	st := &backupState{Chain: time.Now().UTC().Format("20060102T150405.000000000Z")}
+	if err := bs.client.put(bs.prefix+st.Chain+"/"+backupFull, buf); err != nil {
+		return nil, xerrors.Errorf("uploading snapshot: %v", err)
+	}
+	st.Entries = idx.entries()
+	if err := bs.saveState(s, st); err != nil {
+		return nil, xerrors.Errorf("saving state: %v", err)
+	}
+	log.Lvl2("Backed up the database in chain", st.Chain)
+	if err := bs.prune(); err != nil {
+		log.Warn("Removing old backups:", err)
+	}
+	return st, nil
+}
+
+// incremental ships the changes since the previous backup, if any.
+func (bs *backupScheduler) incremental(s *serviceManager, st *backupState) error {
+	old := indexFromEntries(st.Entries)
+	var d *backupDiff
+	var idx backupIndex
+	err := unwrapStore(s.store).View(func(tx StoreTx) error {
+		var err error
+		d, idx, err = old.diff(tx)
+		return err
+	})
+	if err != nil {
+		return xerrors.Errorf("computing diff: %v", err)
+	}
+	if !d.changes(old) {
+		return nil
+	}
+	buf, err := protobuf.Encode(d)
+	if err != nil {
+		return xerrors.Errorf("encoding diff: %v", err)
+	}
+	name := fmt.Sprintf(backupIncrement, st.Seq+1)
+	if err := bs.client.put(bs.prefix+st.Chain+"/"+name, buf); err != nil {
+		return xerrors.Errorf("uploading diff: %v", err)
+	}
+	st.Seq++
+	st.Entries = idx.entries()
+	if err := bs.saveState(s, st); err != nil {
+		return xerrors.Errorf("saving state: %v", err)
+	}
+	log.Lvl3("Backed up", len(d.Puts), "changes and", len(d.Deletes),
+		"removals in chain", st.Chain)
+	return nil
+}
+
+// chains returns the objects of the prefix, indexed by chain, and the chains
+// in order.
+func backupChains(client *s3Client, prefix string) (map[string][]string, []string, error) {
+	keys, err := client.list(prefix)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("listing backups: %v", err)
+	}
+	objects := make(map[string][]string)
+	var chains []string
+	for _, k := range keys {
+		parts := strings.SplitN(strings.TrimPrefix(k, prefix), "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if _, ok := objects[parts[0]]; !ok {
+			chains = append(chains, parts[0])
+		}
+		objects[parts[0]] = append(objects[parts[0]], parts[1])
+	}
+	sort.Strings(chains)
+	return objects, chains, nil
+}
+
+// prune removes the chains older than the ones kept.
+func (bs *backupScheduler) prune() error {
+	objects, chains, err := backupChains(bs.client, bs.prefix)
+	if err != nil {
+		return err
+	}
+	if len(chains) <= bs.keepChains {
+		return nil
+	}
+	for _, c := range chains[:len(chains)-bs.keepChains] {
+		for _, o := range objects[c] {
+			if err := bs.client.delete(bs.prefix + c + "/" + o); err != nil {
+				return err
+			}
+		}
+		log.Lvl2("Removed backup chain", c)
+	}
+	return nil
+}
+
+// GetStatus implements StatusReporter.
+func (bs *backupScheduler) GetStatus() *Status {
+	bs.Lock()
+	defer bs.Unlock()
+	f := map[string]string{
+		"Interval": bs.interval.String(),
+	}
+	if !bs.last.IsZero() {
+		f["Last"] = bs.last.Format(time.RFC3339)
+		f["Chain"] = bs.chain
+		f["Seq"] = strconv.Itoa(bs.seq)
+	}
+	if bs.err != nil {
+		f["Error"] = bs.err.Error()
+	}
+	return &Status{Field: f}
+}
+
+// RestoreBackup writes the latest state backed up by the conode with the
+// given public key, or the one of its ServerOptions.StorageKey, to path, as a
+// snapshot to restore with ServerOptions.Restore.
+func RestoreBackup(cfg BackupConfig, public kyber.Point, path string) error {
+	client, err := cfg.client()
+	if err != nil {
+		return err
+	}
+	prefix, err := cfg.prefix(public)
+	if err != nil {
+		return err
+	}
+	objects, chains, err := backupChains(client, prefix)
+	if err != nil {
+		return err
+	}
+	if len(chains) == 0 {
+		return xerrors.Errorf("no backup in %s", prefix)
+	}
+	chain := chains[len(chains)-1]
+	var incs []string
+	var full bool
+	for _, o := range objects[chain] {
+		if o == backupFull {
+			full = true
+		} else if strings.HasPrefix(o, "incr-") {
+			incs = append(incs, o)
+		}
+	}
+	if !full {
+		return xerrors.Errorf("chain %s has no full snapshot", chain)
+	}
+	buf, err := client.get(prefix + chain + "/" + backupFull)
+	if err != nil {
+		return xerrors.Errorf("downloading snapshot: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return xerrors.Errorf("creating directory: %v", err)
+	}
+	if err := ioutil.WriteFile(path, buf, 0600); err != nil {
+		return xerrors.Errorf("writing snapshot: %v", err)
+	}
+	if len(incs) == 0 {
+		return nil
+	}
+
+	db, err := openDb(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	sort.Strings(incs)
+	for _, inc := range incs {
+		buf, err := client.get(prefix + chain + "/" + inc)
+		if err != nil {
+			return xerrors.Errorf("downloading %s: %v", inc, err)
+		}
+		d := &backupDiff{}
+		if err := protobuf.Decode(buf, d); err != nil {
+			return xerrors.Errorf("decoding %s: %v", inc, err)
+		}
+		err = db.Update(func(tx *bbolt.Tx) error {
+			return d.apply(boltTx{tx})
+		})
+		if err != nil {
+			return xerrors.Errorf("applying %s: %v", inc, err)
+		}
+	}
+	log.Lvl2("Restored chain", chain, "with", len(incs), "incremental backups")
+	return nil
+}
@@ -0,0 +1,168 @@
+package onet
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/protobuf"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// fakeS3 is an object storage holding the objects of one bucket in memory.
+type fakeS3 struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/bucket") {
+		http.NotFound(w, r)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/bucket"), "/")
+	f.Lock()
+	defer f.Unlock()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		var res struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []struct{ Key string }
+		}
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			res.Contents = append(res.Contents, struct{ Key string }{k})
+		}
+		xml.NewEncoder(w).Encode(res)
+	case r.Method == http.MethodPut:
+		buf, _ := ioutil.ReadAll(r.Body)
+		f.objects[key] = buf
+	case r.Method == http.MethodGet:
+		buf, ok := f.objects[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(buf)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestServer_Backup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	old := os.Getenv("CONODE_SERVICE_PATH")
+	defer os.Setenv("CONODE_SERVICE_PATH", old)
+	require.NoError(t, os.Setenv("CONODE_SERVICE_PATH", dir))
+
+	s3 := &fakeS3{objects: make(map[string][]byte)}
+	ts := httptest.NewServer(s3)
+	defer ts.Close()
+	cfg := BackupConfig{
+		Endpoint:   ts.URL,
+		Bucket:     "bucket",
+		AccessKey:  "access",
+		SecretKey:  "secret",
+		FullEvery:  2,
+		KeepChains: 1,
+	}
+	priv, id := NewPrivIdentity(tSuite, 0)
+	c := newStorageServer(t, priv, id, ServerOptions{Backup: &cfg})
+	defer c.Close()
+	ctx := serviceContext(c, serviceWebSocket)
+	put := func(bucket, k, v string) {
+		require.NoError(t, ctx.UpdateAdditionalBucket([]byte(bucket), func(b *QuotaBucket) error {
+			if v == "" {
+				return b.Delete([]byte(k))
+			}
+			return b.Put([]byte(k), []byte(v))
+		}))
+	}
+
+	put("a", "1", "one")
+	put("a", "2", "two")
+	require.NoError(t, c.backup.backup(c.serviceManager))
+	chain := c.backup.chain
+	require.Len(t, s3.objects, 1)
+
+	// the diffs only hold the changes
+	put("a", "2", "")
+	put("a", "3", "three")
+	put("b", "1", "other")
+	require.NoError(t, c.backup.backup(c.serviceManager))
+	require.NoError(t, c.backup.backup(c.serviceManager))
+	require.Len(t, s3.objects, 2)
+	d := &backupDiff{}
+	for k, v := range s3.objects {
+		if strings.HasSuffix(k, "incr-000001.bin") {
+			require.NoError(t, protobuf.Decode(v, d))
+		}
+	}
+	require.Len(t, d.Puts, 2)
+	require.Len(t, d.Deletes, 1)
+	require.Equal(t, "1", c.statusReporterStruct.ReportStatus()["Backup"].Field["Seq"])
+
+	restored := filepath.Join(dir, "restored.db")
+	require.NoError(t, RestoreBackup(cfg, id.Public, restored))
+	db, err := bbolt.Open(restored, 0600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.View(func(tx *bbolt.Tx) error {
+		a := tx.Bucket(ctx.additionalBucketName([]byte("a")))
+		require.Equal(t, []byte("one"), a.Get([]byte("1")))
+		require.Nil(t, a.Get([]byte("2")))
+		require.Equal(t, []byte("three"), a.Get([]byte("3")))
+		b := tx.Bucket(ctx.additionalBucketName([]byte("b")))
+		require.Equal(t, []byte("other"), b.Get([]byte("1")))
+		return nil
+	}))
+	require.NoError(t, db.Close())
+
+	// a new chain replaces the old one
+	put("a", "1", "")
+	require.NoError(t, c.backup.backup(c.serviceManager))
+	require.NoError(t, c.backup.backup(c.serviceManager))
+	require.NotEqual(t, chain, c.backup.chain)
+	for k := range s3.objects {
+		require.False(t, strings.Contains(k, chain), k)
+	}
+	require.NoError(t, RestoreBackup(cfg, id.Public, restored))
+	db, err = bbolt.Open(restored, 0600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.View(func(tx *bbolt.Tx) error {
+		require.Nil(t, tx.Bucket(ctx.additionalBucketName([]byte("a"))).Get([]byte("1")))
+		return nil
+	}))
+	require.NoError(t, db.Close())
+
+	// failures are reported
+	c.backup.client.bucket = "unknown"
+	put("a", "1", "again")
+	require.Error(t, c.backup.backup(c.serviceManager))
+	require.NotEmpty(t, c.statusReporterStruct.ReportStatus()["Backup"].Field["Error"])
+	_, err = newBackupScheduler(BackupConfig{Endpoint: "ftp://host", Bucket: "b"}, id.Public)
+	require.Error(t, err)
+
+	// closed again by the server
+	c.backup.close()
+}
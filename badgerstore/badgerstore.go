@@ -0,0 +1,334 @@
+// Package badgerstore is a backend of the onet Store keeping the data in
+// BadgerDB, whose log-structured merge tree is better suited to services
+// writing a lot than the B+tree of bbolt. It is a module of its own, so that
+// onet doesn't depend on BadgerDB. A conode uses it by importing the package:
+//
+//	import _ "go.dedis.ch/onet/v3/badgerstore"
+//
+// and setting StorageBackend = "badger" in its private.toml. The database is
+// a directory instead of a file.
+//
+// The read-only transactions run concurrently, but the read-write ones are
+// serialized, as with bbolt, so that they never conflict.
+package badgerstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// Backend is the name of the backend, for the StorageBackend of the conode.
+const Backend = "badger"
+
+func init() {
+	if err := onet.RegisterStoreBackend(Backend, Open); err != nil {
+		panic(err)
+	}
+}
+
+// GCInterval is the interval between two garbage collections of the values
+// overwritten or deleted.
+var GCInterval = 10 * time.Minute
+
+// iterationBatch is the number of pairs read at once by ForEach.
+const iterationBatch = 1000
+
+var errTxNotWritable = xerrors.New("transaction not writable")
+
+// Store is the onet.Store of a BadgerDB database.
+type Store struct {
+	db     *badger.DB
+	dir    string
+	writes sync.Mutex
+	stop   chan struct{}
+	closed sync.Once
+	gc     sync.WaitGroup
+}
+
+// Open opens the database in the directory at path, creating it if needed.
+// The writes are synced to the disk when their transaction commits.
+func Open(path string) (onet.Store, error) {
+	db, err := badger.Open(badger.DefaultOptions(path).
+		WithSyncWrites(true).
+		WithLogger(logger{}))
+	if err != nil {
+		return nil, xerrors.Errorf("opening badger: %v", err)
+	}
+	s := &Store{db: db, dir: path, stop: make(chan struct{})}
+	s.gc.Add(1)
+	go s.collectGarbage()
+	return s, nil
+}
+
+func (s *Store) collectGarbage() {
+	defer s.gc.Done()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(GCInterval):
+		}
+		for s.db.RunValueLogGC(0.5) == nil {
+		}
+	}
+}
+
+// View implements onet.Store.
+func (s *Store) View(fn func(tx onet.StoreTx) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		return run(fn, &tx{txn: txn})
+	})
+}
+
+// Update implements onet.Store.
+func (s *Store) Update(fn func(tx onet.StoreTx) error) error {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		return run(fn, &tx{txn: txn, writable: true})
+	})
+}
+
+// run calls fn, returning the first error of the reads of the transaction if
+// fn doesn't fail.
+func run(fn func(tx onet.StoreTx) error, t *tx) error {
+	if err := fn(t); err != nil {
+		return err
+	}
+	return t.err
+}
+
+// Size implements onet.Store. It is the size of the files of the database.
+func (s *Store) Size() (int64, error) {
+	var size int64
+	err := filepath.Walk(s.dir, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Backup implements onet.Store.
+func (s *Store) Backup(path string) error {
+	return onet.WriteBoltBackup(s, path)
+}
+
+// Close implements onet.Store.
+func (s *Store) Close() error {
+	err := xerrors.New("already closed")
+	s.closed.Do(func() {
+		close(s.stop)
+		s.gc.Wait()
+		err = s.db.Close()
+	})
+	return err
+}
+
+// The keys of the database are the names of the buckets, prefixed with 'b',
+// and the keys of the buckets, prefixed with 'k' and the length and name of
+// their bucket.
+
+func bucketKey(name []byte) []byte {
+	return append([]byte{'b'}, name...)
+}
+
+func entryPrefix(name []byte) []byte {
+	p := make([]byte, 5, 5+len(name))
+	p[0] = 'k'
+	binary.BigEndian.PutUint32(p[1:], uint32(len(name)))
+	return append(p, name...)
+}
+
+type tx struct {
+	txn      *badger.Txn
+	writable bool
+	// the first error of the reads not returning one, failing the
+	// transaction
+	err error
+}
+
+func (t *tx) fail(err error) {
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+func (t *tx) exists(name []byte) bool {
+	_, err := t.txn.Get(bucketKey(name))
+	if err != nil && err != badger.ErrKeyNotFound {
+		t.fail(xerrors.Errorf("reading bucket %s: %v", name, err))
+	}
+	return err == nil
+}
+
+func (t *tx) Bucket(name []byte) onet.StoreBucket {
+	if !t.exists(name) {
+		return nil
+	}
+	return &bucket{tx: t, prefix: entryPrefix(name)}
+}
+
+func (t *tx) CreateBucketIfNotExists(name []byte) (onet.StoreBucket, error) {
+	if !t.exists(name) {
+		if !t.writable {
+			return nil, errTxNotWritable
+		}
+		if len(name) == 0 {
+			return nil, xerrors.New("bucket name required")
+		}
+		if err := t.txn.Set(bucketKey(name), []byte{}); err != nil {
+			return nil, err
+		}
+	}
+	return &bucket{tx: t, prefix: entryPrefix(name)}, nil
+}
+
+func (t *tx) DeleteBucket(name []byte) error {
+	if !t.writable {
+		return errTxNotWritable
+	}
+	if !t.exists(name) {
+		return xerrors.New("bucket not found")
+	}
+	var keys [][]byte
+	it := t.txn.NewIterator(badger.IteratorOptions{Prefix: entryPrefix(name)})
+	for it.Rewind(); it.Valid(); it.Next() {
+		keys = append(keys, it.Item().KeyCopy(nil))
+	}
+	it.Close()
+	for _, k := range append(keys, bucketKey(name)) {
+		if err := t.txn.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tx) ForEach(fn func(name []byte, b onet.StoreBucket) error) error {
+	// fn may change the buckets
+	var names [][]byte
+	it := t.txn.NewIterator(badger.IteratorOptions{Prefix: []byte{'b'}})
+	for it.Rewind(); it.Valid(); it.Next() {
+		names = append(names, it.Item().KeyCopy(nil)[1:])
+	}
+	it.Close()
+	for _, name := range names {
+		if err := fn(name, &bucket{tx: t, prefix: entryPrefix(name)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type bucket struct {
+	tx     *tx
+	prefix []byte
+}
+
+func (b *bucket) key(k []byte) []byte {
+	return append(append([]byte{}, b.prefix...), k...)
+}
+
+func (b *bucket) Get(key []byte) []byte {
+	item, err := b.tx.txn.Get(b.key(key))
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	var v []byte
+	if err == nil {
+		v, err = item.ValueCopy(nil)
+	}
+	if err != nil {
+		b.tx.fail(xerrors.Errorf("reading %x: %v", key, err))
+		return nil
+	}
+	if v == nil {
+		// an empty value is not a missing one
+		v = []byte{}
+	}
+	return v
+}
+
+func (b *bucket) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return errTxNotWritable
+	}
+	if len(key) == 0 {
+		return xerrors.New("key required")
+	}
+	return b.tx.txn.Set(b.key(key), append([]byte{}, value...))
+}
+
+func (b *bucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return errTxNotWritable
+	}
+	return b.tx.txn.Delete(b.key(key))
+}
+
+// ForEach reads the pairs in batches, so that fn can write in the
+// transaction.
+func (b *bucket) ForEach(fn func(k, v []byte) error) error {
+	start := b.prefix
+	for {
+		var keys, values [][]byte
+		it := b.tx.txn.NewIterator(badger.IteratorOptions{Prefix: b.prefix,
+			PrefetchValues: true, PrefetchSize: 100})
+		for it.Seek(start); it.Valid() && len(keys) < iterationBatch; it.Next() {
+			v, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				it.Close()
+				return err
+			}
+			if v == nil {
+				v = []byte{}
+			}
+			keys = append(keys, it.Item().KeyCopy(nil))
+			values = append(values, v)
+		}
+		it.Close()
+		for i := range keys {
+			if err := fn(keys[i][len(b.prefix):], values[i]); err != nil {
+				return err
+			}
+		}
+		if len(keys) < iterationBatch {
+			return nil
+		}
+		start = append(keys[len(keys)-1], 0)
+	}
+}
+
+// logger sends the messages of BadgerDB to the log of onet.
+type logger struct{}
+
+func (logger) Errorf(f string, args ...interface{}) {
+	log.Error("badger:", strings.TrimSpace(fmt.Sprintf(f, args...)))
+}
+
+func (logger) Warningf(f string, args ...interface{}) {
+	log.Warn("badger:", strings.TrimSpace(fmt.Sprintf(f, args...)))
+}
+
+func (logger) Infof(f string, args ...interface{}) {
+	log.Lvl3("badger:", strings.TrimSpace(fmt.Sprintf(f, args...)))
+}
+
+func (logger) Debugf(f string, args ...interface{}) {
+	log.Lvl5("badger:", strings.TrimSpace(fmt.Sprintf(f, args...)))
+}
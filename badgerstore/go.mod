@@ -0,0 +1,37 @@
+module go.dedis.ch/onet/v3/badgerstore
+
+go 1.21
+
+require (
+	github.com/dgraph-io/badger/v4 v4.5.1
+	go.dedis.ch/onet/v3 v3.2.10
+	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2
+)
+
+require (
+	github.com/BurntSushi/toml v0.3.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/daviddengcn/go-colortext v0.0.0-20180409174941-186a3d44e920 // indirect
+	github.com/dgraph-io/ristretto/v2 v2.1.0 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/golang/groupcache v0.0.0-20200121045136-8c9f03a8e57e // indirect
+	github.com/google/flatbuffers v24.12.23+incompatible // indirect
+	github.com/gorilla/websocket v1.4.0 // indirect
+	github.com/klauspost/compress v1.17.11 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	go.dedis.ch/fixbuf v1.0.3 // indirect
+	go.dedis.ch/kyber/v3 v3.0.12 // indirect
+	go.dedis.ch/protobuf v1.0.11 // indirect
+	go.etcd.io/bbolt v1.3.3 // indirect
+	go.opencensus.io v0.24.0 // indirect
+	golang.org/x/crypto v0.32.0 // indirect
+	golang.org/x/net v0.34.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	google.golang.org/protobuf v1.36.3 // indirect
+	gopkg.in/satori/go.uuid.v1 v1.2.0 // indirect
+	gopkg.in/tylerb/graceful.v1 v1.2.15 // indirect
+	rsc.io/goversion v1.2.0 // indirect
+)
+
+replace go.dedis.ch/onet/v3 => ../
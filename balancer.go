@@ -0,0 +1,198 @@
+package onet
+
+import (
+	"context"
+	"crypto/sha256"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// Balancer chooses which members of a roster a Client contacts first, see
+// SetBalancer. It is used by SendToAny, SendProtobufParallel and the
+// failover, and must be safe for concurrent use.
+type Balancer interface {
+	// Order returns the nodes in the order they should be contacted, in a
+	// new slice. key is the one given with WithBalanceKey, or empty.
+	Order(key string, nodes []*network.ServerIdentity) []*network.ServerIdentity
+	// Done is called after every request the client sent to a conode, with
+	// its round-trip time and its error, if any.
+	Done(si *network.ServerIdentity, rtt time.Duration, err error)
+}
+
+type balanceKey struct{}
+
+// WithBalanceKey returns a context telling the Balancer of the client the key
+// of the request, e.g., the ID of a skipchain, so that the requests with the
+// same key can be sent to the same conode.
+func WithBalanceKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, balanceKey{}, key)
+}
+
+// SetBalancer sets the balancer of the client. It can be changed while
+// requests are sent. A nil balancer, the default, contacts the conodes in a
+// random order.
+func (c *Client) SetBalancer(b Balancer) {
+	c.Lock()
+	defer c.Unlock()
+	c.balancer = b
+}
+
+func (c *Client) getBalancer() Balancer {
+	c.Lock()
+	defer c.Unlock()
+	return c.balancer
+}
+
+// order returns the nodes in the order given by the balancer of the client.
+func (c *Client) order(ctx context.Context, nodes []*network.ServerIdentity) []*network.ServerIdentity {
+	b := c.getBalancer()
+	if b == nil {
+		return shuffle(nodes)
+	}
+	key, _ := ctx.Value(balanceKey{}).(string)
+	return b.Order(key, nodes)
+}
+
+func shuffle(nodes []*network.ServerIdentity) []*network.ServerIdentity {
+	ordered := make([]*network.ServerIdentity, len(nodes))
+	for i, j := range rand.Perm(len(nodes)) {
+		ordered[i] = nodes[j]
+	}
+	return ordered
+}
+
+// RoundRobinBalancer contacts the conodes in turn: every call starts with
+// the node after the first one of the previous call.
+type RoundRobinBalancer struct {
+	next uint64
+}
+
+// NewRoundRobinBalancer returns a balancer contacting the conodes in turn.
+func NewRoundRobinBalancer() *RoundRobinBalancer {
+	return &RoundRobinBalancer{}
+}
+
+// Order implements Balancer.
+func (b *RoundRobinBalancer) Order(key string, nodes []*network.ServerIdentity) []*network.ServerIdentity {
+	ordered := make([]*network.ServerIdentity, len(nodes))
+	if len(nodes) == 0 {
+		return ordered
+	}
+	start := int((atomic.AddUint64(&b.next, 1) - 1) % uint64(len(nodes)))
+	for i := range nodes {
+		ordered[i] = nodes[(start+i)%len(nodes)]
+	}
+	return ordered
+}
+
+// Done implements Balancer.
+func (b *RoundRobinBalancer) Done(si *network.ServerIdentity, rtt time.Duration, err error) {}
+
+// latencyFailure is the round-trip time recorded for a failed request.
+const latencyFailure = 5 * time.Second
+
+// LeastLatencyBalancer contacts the conodes with the shortest round-trip time
+// first. The conodes without any yet are contacted before the others, so that
+// they get measured. A failed request counts as a round-trip time of 5s.
+type LeastLatencyBalancer struct {
+	// Weight of a new round-trip time in the average, between 0 and 1. If it
+	// is 0, 0.3 is used. It must be set before the balancer is used.
+	Weight float64
+	sync.Mutex
+	rtts map[network.ServerIdentityID]time.Duration
+}
+
+// NewLeastLatencyBalancer returns a balancer contacting the fastest conodes
+// first.
+func NewLeastLatencyBalancer() *LeastLatencyBalancer {
+	return &LeastLatencyBalancer{
+		rtts: make(map[network.ServerIdentityID]time.Duration),
+	}
+}
+
+// Order implements Balancer.
+func (b *LeastLatencyBalancer) Order(key string, nodes []*network.ServerIdentity) []*network.ServerIdentity {
+	ordered := shuffle(nodes)
+	b.Lock()
+	defer b.Unlock()
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return b.rtts[ordered[i].ID] < b.rtts[ordered[j].ID]
+	})
+	return ordered
+}
+
+// Done implements Balancer.
+func (b *LeastLatencyBalancer) Done(si *network.ServerIdentity, rtt time.Duration, err error) {
+	if xerrors.Is(err, context.Canceled) {
+		// e.g., another conode answered first
+		return
+	}
+	if err != nil {
+		rtt = latencyFailure
+	}
+	w := b.Weight
+	if w <= 0 || w > 1 {
+		w = 0.3
+	}
+	b.Lock()
+	defer b.Unlock()
+	if old, ok := b.rtts[si.ID]; ok {
+		rtt = time.Duration(w*float64(rtt) + (1-w)*float64(old))
+	}
+	if rtt <= 0 {
+		// not to be taken as unmeasured
+		rtt = 1
+	}
+	b.rtts[si.ID] = rtt
+}
+
+// StickyBalancer sends the requests with the same key to the same conode, as
+// long as it is in the roster. The conodes are ranked by a hash of the key
+// and their ID, so that the other keys stay on their conode when the roster
+// changes. The requests without a key are ordered by the fallback.
+type StickyBalancer struct {
+	fallback Balancer
+}
+
+// NewStickyBalancer returns a balancer sending the requests with the same key
+// to the same conode. The requests without a key are ordered by fallback, or
+// randomly if it is nil.
+func NewStickyBalancer(fallback Balancer) *StickyBalancer {
+	return &StickyBalancer{fallback: fallback}
+}
+
+// Order implements Balancer.
+func (b *StickyBalancer) Order(key string, nodes []*network.ServerIdentity) []*network.ServerIdentity {
+	if key == "" {
+		if b.fallback != nil {
+			return b.fallback.Order(key, nodes)
+		}
+		return shuffle(nodes)
+	}
+	ordered := make([]*network.ServerIdentity, len(nodes))
+	copy(ordered, nodes)
+	ranks := make(map[*network.ServerIdentity]string, len(nodes))
+	for _, si := range nodes {
+		h := sha256.New()
+		h.Write([]byte(key))
+		h.Write(si.ID[:])
+		ranks[si] = string(h.Sum(nil))
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ranks[ordered[i]] < ranks[ordered[j]]
+	})
+	return ordered
+}
+
+// Done implements Balancer.
+func (b *StickyBalancer) Done(si *network.ServerIdentity, rtt time.Duration, err error) {
+	if b.fallback != nil {
+		b.fallback.Done(si, rtt, err)
+	}
+}
@@ -0,0 +1,117 @@
+package onet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+func balancerNodes(n int) []*network.ServerIdentity {
+	nodes := make([]*network.ServerIdentity, n)
+	for i := range nodes {
+		nodes[i] = network.NewServerIdentity(key.NewKeyPair(tSuite).Public,
+			network.NewTCPAddress("127.0.0.1:1"))
+	}
+	return nodes
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	nodes := balancerNodes(3)
+	b := NewRoundRobinBalancer()
+	for i := 0; i < 6; i++ {
+		ordered := b.Order("", nodes)
+		require.Len(t, ordered, 3)
+		require.Equal(t, nodes[i%3], ordered[0])
+		require.Equal(t, nodes[(i+1)%3], ordered[1])
+	}
+	require.Empty(t, b.Order("", nil))
+}
+
+func TestLeastLatencyBalancer(t *testing.T) {
+	nodes := balancerNodes(3)
+	b := NewLeastLatencyBalancer()
+	b.Done(nodes[0], 30*time.Millisecond, nil)
+	b.Done(nodes[1], 10*time.Millisecond, nil)
+	// not measured yet
+	require.Equal(t, nodes[2], b.Order("", nodes)[0])
+
+	b.Done(nodes[2], 20*time.Millisecond, nil)
+	require.Equal(t, []*network.ServerIdentity{nodes[1], nodes[2], nodes[0]}, b.Order("", nodes))
+
+	b.Done(nodes[1], 0, xerrors.New("unreachable"))
+	require.Equal(t, []*network.ServerIdentity{nodes[2], nodes[0], nodes[1]}, b.Order("", nodes))
+	// cancelled requests don't count
+	b.Done(nodes[2], 0, xerrors.Errorf("waiting for reply: %w", context.Canceled))
+	require.Equal(t, nodes[2], b.Order("", nodes)[0])
+}
+
+func TestStickyBalancer(t *testing.T) {
+	nodes := balancerNodes(5)
+	b := NewStickyBalancer(NewRoundRobinBalancer())
+	first := b.Order("chain", nodes)[0]
+	for i := 0; i < 5; i++ {
+		require.Equal(t, first, b.Order("chain", nodes)[0])
+	}
+	// the key stays on its conode if another one leaves the roster
+	var others []*network.ServerIdentity
+	for _, si := range nodes {
+		if si != first && len(others) < 3 {
+			others = append(others, si)
+		}
+	}
+	require.Equal(t, first, b.Order("chain", append(others, first))[0])
+
+	require.Equal(t, nodes[0], b.Order("", nodes)[0])
+	require.Equal(t, nodes[1], b.Order("", nodes)[0])
+}
+
+func TestClient_SetBalancer(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+
+	_, roster, _ := l.GenTree(3, false)
+	cl := NewClient(tSuite, serviceWebSocket)
+	defer cl.Close()
+	buf, err := protobuf.Encode(&SimpleResponse{})
+	require.NoError(t, err)
+
+	cl.SetBalancer(NewRoundRobinBalancer())
+	for i := 0; i < 3; i++ {
+		_, si, err := cl.SendToAny(roster, 1, "SimpleResponse", buf)
+		require.NoError(t, err)
+		require.True(t, si.Equal(roster.List[i]))
+	}
+
+	cl.SetBalancer(NewStickyBalancer(nil))
+	ctx := WithBalanceKey(context.Background(), "chain")
+	_, first, err := cl.SendToAnyWithContext(ctx, roster, 1, "SimpleResponse", buf)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		var sr SimpleResponse
+		si, err := cl.SendProtobufParallelWithContext(ctx, roster.List, &SimpleResponse{}, &sr,
+			&ParallelOptions{Parallel: 1}, nil)
+		require.NoError(t, err)
+		require.True(t, si.Equal(first))
+	}
+
+	// the failover tries the fastest conode after the destination
+	ll := NewLeastLatencyBalancer()
+	cl.SetBalancer(ll)
+	dead := network.NewServerIdentity(key.NewKeyPair(tSuite).Public, network.NewTCPAddress("127.0.0.1:1"))
+	for _, si := range roster.List[:2] {
+		ll.Done(si, time.Second, nil)
+	}
+	cl.SetFailover(&FailoverPolicy{Nodes: roster.List, MaxAttempts: 2})
+	cl.SetRetryPolicy(&RetryPolicy{MaxAttempts: 1})
+	var obs recordingObserver
+	cl.SetObserver(&obs)
+	require.NoError(t, cl.SendProtobuf(dead, &SimpleResponse{}, &SimpleResponse{}))
+	require.Len(t, obs.done, 2)
+	require.True(t, obs.done[1].Destination.Equal(roster.List[2]))
+}
@@ -0,0 +1,118 @@
+package onet
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// BatchReply is the reply to one request of a batch.
+type BatchReply struct {
+	// Index of the request in the batch
+	Index int
+	Reply []byte
+	Err   error
+}
+
+// SendBatch sends all the requests to the handler at path of dst over one
+// connection, without waiting for the replies in between, and returns the
+// replies as they arrive, in the order of the requests. The channel is closed
+// after the last one. A request the conode answers with an error doesn't stop
+// the batch, but if the connection is lost or ctx is done, all the remaining
+// requests get the error.
+func (c *Client) SendBatch(ctx context.Context, dst *network.ServerIdentity, path string,
+	bufs [][]byte) <-chan BatchReply {
+	ctx = c.withRetryBudget(ctx)
+	// buffered, so that the batch finishes even if the replies are not read
+	replies := make(chan BatchReply, len(bufs))
+	go func() {
+		defer close(replies)
+		next := 0
+		for next < len(bufs) {
+			start := next
+			n, err := c.sendBatch(ctx, dst, path, bufs[start:], func(i int, reply []byte) {
+				replies <- BatchReply{Index: start + i, Reply: reply}
+			})
+			next += n
+			if err == nil {
+				continue
+			}
+			var ce *websocket.CloseError
+			if ctx.Err() == nil && xerrors.As(err, &ce) && ce.Code == websocket.CloseProtocolError {
+				// the conode closed the connection after answering the
+				// request with an error, the next ones are sent again
+				replies <- BatchReply{Index: next, Err: err}
+				next++
+				continue
+			}
+			for ; next < len(bufs); next++ {
+				replies <- BatchReply{Index: next, Err: err}
+			}
+		}
+	}()
+	return replies
+}
+
+// sendBatch sends the requests over a new connection and passes the replies to
+// got. It returns the number of replies received before an error.
+func (c *Client) sendBatch(ctx context.Context, dst *network.ServerIdentity, path string,
+	bufs [][]byte, got func(int, []byte)) (int, error) {
+	var query url.Values
+	if deadline, ok := ctx.Deadline(); ok {
+		query = url.Values{TimeoutQuery: []string{time.Until(deadline).String()}}
+	}
+	sigs := make([]string, len(bufs))
+	for i, buf := range bufs {
+		var err error
+		sigs[i], err = c.requestSignature(ctx, dst, path, buf)
+		if err != nil {
+			return 0, xerrors.Errorf("signing: %v", err)
+		}
+	}
+	conn, err := c.dial(ctx, dst, path, query)
+	if err != nil {
+		return 0, xerrors.Errorf("new connection: %w", err)
+	}
+	defer conn.Close()
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for i, buf := range bufs {
+			if sigs[i] != "" {
+				err := conn.WriteMessage(websocket.TextMessage,
+					[]byte(SignatureMessagePrefix+sigs[i]))
+				if err != nil {
+					return
+				}
+			}
+			if err := conn.WriteMessage(websocket.BinaryMessage, buf); err != nil {
+				// the reading fails as well
+				return
+			}
+			c.Lock()
+			c.tx += uint64(len(buf))
+			c.Unlock()
+		}
+	}()
+	for i := range bufs {
+		reply, err := readMessage(ctx, conn)
+		if err != nil {
+			conn.Close()
+			<-written
+			return i, err
+		}
+		c.Lock()
+		c.rx += uint64(len(reply))
+		c.Unlock()
+		got(i, reply)
+	}
+	<-written
+	conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "client closed"))
+	return len(bufs), nil
+}
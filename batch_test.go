@@ -0,0 +1,48 @@
+package onet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/protobuf"
+)
+
+func TestClient_SendBatch(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(1, false)
+	si := servers[0].ServerIdentity
+	cl := NewClient(tSuite, serviceWebSocket)
+
+	var bufs [][]byte
+	for i := 0; i < 20; i++ {
+		// the conode answers the requests with the flag set with an error
+		buf, err := protobuf.Encode(&ErrorRequest{Roster: *roster, Flags: i % 7 / 6})
+		require.NoError(t, err)
+		bufs = append(bufs, buf)
+	}
+	var n int
+	for r := range cl.SendBatch(context.Background(), si, "ErrorRequest", bufs) {
+		require.Equal(t, n, r.Index)
+		if n%7 == 6 {
+			require.Error(t, r.Err)
+			require.Contains(t, r.Err.Error(), "found in flags")
+		} else {
+			require.NoError(t, r.Err)
+			require.NoError(t, protobuf.Decode(r.Reply, &SimpleResponse{}))
+		}
+		n++
+	}
+	require.Equal(t, len(bufs), n)
+
+	// all the requests fail if the batch is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n = 0
+	for r := range cl.SendBatch(ctx, si, "ErrorRequest", bufs) {
+		require.Error(t, r.Err)
+		n++
+	}
+	require.Equal(t, len(bufs), n)
+}
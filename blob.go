@@ -0,0 +1,292 @@
+package onet
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// BlobChunkSize is the size of the chunks in which the blobs are stored. Each
+// chunk is stored once, whatever the number of blobs holding it.
+var BlobChunkSize = 256 << 10
+
+// The additional buckets of a service holding its blobs: the chunks, indexed
+// by their hash, the number of references to every chunk, and the
+// description of every blob.
+var (
+	blobChunksBucket = []byte("onet_blob_chunks")
+	blobRefsBucket   = []byte("onet_blob_refs")
+	blobsBucket      = []byte("onet_blobs")
+)
+
+// BlobID is the hash of the content of a blob.
+type BlobID [sha256.Size]byte
+
+// String returns the hex-encoded ID.
+func (id BlobID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// blobManifest describes a blob.
+type blobManifest struct {
+	Size int64
+	// Refs is the number of times the blob has been stored and not
+	// released.
+	Refs   int64
+	Chunks [][]byte
+}
+
+func loadBlobManifest(b StoreBucket, id BlobID) (*blobManifest, error) {
+	buf := b.Get(id[:])
+	if buf == nil {
+		return nil, nil
+	}
+	m := &blobManifest{}
+	if err := protobuf.Decode(buf, m); err != nil {
+		return nil, xerrors.Errorf("decoding blob %s: %v", id, err)
+	}
+	return m, nil
+}
+
+// addChunkRef adds delta to the references of the chunk, and removes the
+// chunk once it has none.
+func addChunkRef(chunks, refs *QuotaBucket, hash []byte, delta int64) error {
+	var n int64
+	if v := refs.Get(hash); len(v) == 8 {
+		n = int64(binary.BigEndian.Uint64(v))
+	}
+	n += delta
+	if n <= 0 {
+		if err := refs.Delete(hash); err != nil {
+			return err
+		}
+		return chunks.Delete(hash)
+	}
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(n))
+	return refs.Put(hash, v)
+}
+
+// blobBuckets returns the buckets of the blobs in the transaction.
+func blobBuckets(tx *ServiceTx) (chunks, refs, blobs *QuotaBucket, err error) {
+	if chunks, err = tx.AdditionalBucket(blobChunksBucket); err != nil {
+		return
+	}
+	if refs, err = tx.AdditionalBucket(blobRefsBucket); err != nil {
+		return
+	}
+	blobs, err = tx.AdditionalBucket(blobsBucket)
+	return
+}
+
+// PutBlob stores the content read from r as a blob and returns its ID. The
+// content is stored in chunks of BlobChunkSize, each one in its own
+// transaction, so that large blobs don't have to fit in memory. Storing the
+// same content again returns the same ID and adds a reference to the blob,
+// which is kept until every reference is released with ReleaseBlob. The
+// blobs count towards the storage quota of the service.
+func (c *Context) PutBlob(r io.Reader) (BlobID, error) {
+	var id BlobID
+	m := &blobManifest{}
+	h := sha256.New()
+	buf := make([]byte, BlobChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			chunk := buf[:n]
+			h.Write(chunk)
+			sum := sha256.Sum256(chunk)
+			err := c.Update(func(tx *ServiceTx) error {
+				chunks, refs, _, err := blobBuckets(tx)
+				if err != nil {
+					return err
+				}
+				if chunks.Get(sum[:]) == nil {
+					if err := chunks.Put(sum[:], chunk); err != nil {
+						return err
+					}
+				}
+				return addChunkRef(chunks, refs, sum[:], 1)
+			})
+			if err != nil {
+				c.releaseChunks(m.Chunks)
+				return id, xerrors.Errorf("storing chunk: %v", err)
+			}
+			m.Chunks = append(m.Chunks, sum[:])
+			m.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			c.releaseChunks(m.Chunks)
+			return id, xerrors.Errorf("reading blob: %v", err)
+		}
+	}
+	copy(id[:], h.Sum(nil))
+
+	hashes := m.Chunks
+	err := c.Update(func(tx *ServiceTx) error {
+		chunks, refs, blobs, err := blobBuckets(tx)
+		if err != nil {
+			return err
+		}
+		old, err := loadBlobManifest(blobs, id)
+		if err != nil {
+			return err
+		}
+		stored := m
+		if old != nil {
+			// the chunks are already referenced by the stored blob
+			for _, hash := range hashes {
+				if err := addChunkRef(chunks, refs, hash, -1); err != nil {
+					return err
+				}
+			}
+			stored = &blobManifest{Size: old.Size, Refs: old.Refs, Chunks: old.Chunks}
+		}
+		stored.Refs++
+		buf, err := protobuf.Encode(stored)
+		if err != nil {
+			return xerrors.Errorf("encoding: %v", err)
+		}
+		return blobs.Put(id[:], buf)
+	})
+	if err != nil {
+		c.releaseChunks(hashes)
+		return id, xerrors.Errorf("storing blob: %v", err)
+	}
+	return id, nil
+}
+
+// releaseChunks drops the references to the chunks of a blob that couldn't
+// be stored.
+func (c *Context) releaseChunks(hashes [][]byte) {
+	err := c.Update(func(tx *ServiceTx) error {
+		chunks, refs, _, err := blobBuckets(tx)
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if err := addChunkRef(chunks, refs, hash, -1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("Couldn't remove the chunks of a blob:", err)
+	}
+}
+
+// ReleaseBlob drops a reference to the blob, and removes it once it has
+// none. The chunks it shares with other blobs are kept.
+func (c *Context) ReleaseBlob(id BlobID) error {
+	return c.Update(func(tx *ServiceTx) error {
+		chunks, refs, blobs, err := blobBuckets(tx)
+		if err != nil {
+			return err
+		}
+		m, err := loadBlobManifest(blobs, id)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			return xerrors.Errorf("unknown blob %s", id)
+		}
+		m.Refs--
+		if m.Refs > 0 {
+			buf, err := protobuf.Encode(m)
+			if err != nil {
+				return xerrors.Errorf("encoding: %v", err)
+			}
+			return blobs.Put(id[:], buf)
+		}
+		for _, hash := range m.Chunks {
+			if err := addChunkRef(chunks, refs, hash, -1); err != nil {
+				return err
+			}
+		}
+		return blobs.Delete(id[:])
+	})
+}
+
+// BlobSize returns the size of the blob, or an error if it isn't stored.
+func (c *Context) BlobSize(id BlobID) (int64, error) {
+	m, err := c.blobManifest(id)
+	if err != nil {
+		return 0, err
+	}
+	return m.Size, nil
+}
+
+func (c *Context) blobManifest(id BlobID) (*blobManifest, error) {
+	var m *blobManifest
+	err := c.manager.store.View(func(tx StoreTx) error {
+		b := tx.Bucket(c.additionalBucketName(blobsBucket))
+		if b == nil {
+			return nil
+		}
+		var err error
+		m, err = loadBlobManifest(b, id)
+		return err
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("tx error: %v", err)
+	}
+	if m == nil {
+		return nil, xerrors.Errorf("unknown blob %s", id)
+	}
+	return m, nil
+}
+
+// OpenBlob returns a reader of the content of the blob. The chunks are read
+// one at a time, when needed. The blob must not be released while it is
+// read.
+func (c *Context) OpenBlob(id BlobID) (io.Reader, error) {
+	m, err := c.blobManifest(id)
+	if err != nil {
+		return nil, err
+	}
+	return &blobReader{ctx: c, chunks: m.Chunks}, nil
+}
+
+// blobReader reads the chunks of a blob in order.
+type blobReader struct {
+	ctx    *Context
+	chunks [][]byte
+	buf    []byte
+}
+
+func (r *blobReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if len(r.chunks) == 0 {
+			return 0, io.EOF
+		}
+		hash := r.chunks[0]
+		r.chunks = r.chunks[1:]
+		err := r.ctx.manager.store.View(func(tx StoreTx) error {
+			b := tx.Bucket(r.ctx.additionalBucketName(blobChunksBucket))
+			if b == nil {
+				return xerrors.New("no chunks")
+			}
+			v := b.Get(hash)
+			if v == nil {
+				return xerrors.Errorf("missing chunk %x", hash)
+			}
+			r.buf = append([]byte{}, v...)
+			return nil
+		})
+		if err != nil {
+			return 0, xerrors.Errorf("reading blob: %v", err)
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
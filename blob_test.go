@@ -0,0 +1,84 @@
+package onet
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_Blobs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "blobs")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	defer func(size int) { BlobChunkSize = size }(BlobChunkSize)
+	BlobChunkSize = 16
+
+	c := createContext(t, tmp)
+	countChunks := func() int {
+		n := 0
+		require.NoError(t, c.ViewAdditionalBucket(blobChunksBucket, func(b StoreBucket) error {
+			return b.ForEach(func(k, v []byte) error {
+				n++
+				return nil
+			})
+		}))
+		return n
+	}
+
+	// 5 chunks, 2 of them identical
+	content := append(bytes.Repeat([]byte("a"), 32), []byte("bbbbbbbbbbbbbbbbcccccccccccccccccdd")...)
+	id, err := c.PutBlob(bytes.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, 4, countChunks())
+	size, err := c.BlobSize(id)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), size)
+	r, err := c.OpenBlob(id)
+	require.NoError(t, err)
+	read, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content, read)
+
+	// a blob sharing chunks only stores the new ones
+	other := append(bytes.Repeat([]byte("a"), 16), []byte("eee")...)
+	id2, err := c.PutBlob(bytes.NewReader(other))
+	require.NoError(t, err)
+	require.Equal(t, 5, countChunks())
+
+	// the same content gets the same ID and a new reference
+	id3, err := c.PutBlob(bytes.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, id, id3)
+	require.Equal(t, 5, countChunks())
+	require.NoError(t, c.ReleaseBlob(id))
+	_, err = c.BlobSize(id)
+	require.NoError(t, err)
+
+	require.NoError(t, c.ReleaseBlob(id))
+	_, err = c.BlobSize(id)
+	require.Error(t, err)
+	require.Error(t, c.ReleaseBlob(id))
+	require.Equal(t, 2, countChunks())
+	r, err = c.OpenBlob(id2)
+	require.NoError(t, err)
+	read, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, other, read)
+
+	require.NoError(t, c.ReleaseBlob(id2))
+	require.Equal(t, 0, countChunks())
+	used, _ := c.StorageUsage()
+	require.Equal(t, int64(0), used)
+
+	// the empty blob
+	id, err = c.PutBlob(bytes.NewReader(nil))
+	require.NoError(t, err)
+	r, err = c.OpenBlob(id)
+	require.NoError(t, err)
+	read, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Empty(t, read)
+}
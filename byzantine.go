@@ -0,0 +1,191 @@
+package onet
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ByzantineBehavior changes the messages sent by the protocol instances of a
+// byzantine server: it returns the message to send to the tree-node instead
+// of msg, or nil to send nothing. As it is called for every destination,
+// returning different messages to different destinations equivocates.
+type ByzantineBehavior func(n *TreeNodeInstance, to *TreeNode, msg interface{}) interface{}
+
+// byzantine holds a behavior and the alternative protocols used by the
+// servers having it.
+type byzantine struct {
+	behavior  ByzantineBehavior
+	protocols map[string]NewProtocol
+}
+
+var byzantines = struct {
+	sync.Mutex
+	m map[string]*byzantine
+}{m: map[string]*byzantine{}}
+
+// ByzantineRegister registers the behavior of the byzantine servers with the
+// given name. The behavior can be nil if the byzantine servers only run
+// alternative protocols, registered with ByzantineProtocolRegister. The
+// behaviors "silent", "corrupt" and "equivocate" are always available.
+func ByzantineRegister(name string, b ByzantineBehavior) error {
+	byzantines.Lock()
+	defer byzantines.Unlock()
+	if bz, ok := byzantines.m[name]; ok {
+		if bz.behavior != nil || b == nil {
+			return xerrors.Errorf("byzantine behavior %s already exists", name)
+		}
+		bz.behavior = b
+		return nil
+	}
+	byzantines.m[name] = &byzantine{behavior: b,
+		protocols: map[string]NewProtocol{}}
+	return nil
+}
+
+// ByzantineProtocolRegister registers an alternative implementation of the
+// protocol, instantiated instead of the honest one by the servers with the
+// byzantine behavior of the given name. It only replaces the protocols
+// instantiated by onet, not the ones created by the NewProtocol method of a
+// service.
+func ByzantineProtocolRegister(name, protocol string, fn NewProtocol) error {
+	byzantines.Lock()
+	defer byzantines.Unlock()
+	bz, ok := byzantines.m[name]
+	if !ok {
+		bz = &byzantine{protocols: map[string]NewProtocol{}}
+		byzantines.m[name] = bz
+	}
+	if _, exists := bz.protocols[protocol]; exists {
+		return xerrors.Errorf("byzantine protocol %s of %s already exists",
+			protocol, name)
+	}
+	bz.protocols[protocol] = fn
+	return nil
+}
+
+// byzantineState is the byzantine behavior of a server.
+type byzantineState struct {
+	sync.Mutex
+	name string
+	*byzantine
+}
+
+// SetByzantine makes the server byzantine, with the behavior registered under
+// the given name, or honest again if the name is empty. It is meant for
+// simulations studying attacks and applies to the messages sent and the
+// protocols instantiated after the call.
+func (c *Server) SetByzantine(name string) error {
+	var bz *byzantine
+	if name != "" {
+		byzantines.Lock()
+		bz = byzantines.m[name]
+		byzantines.Unlock()
+		if bz == nil {
+			return xerrors.Errorf("unknown byzantine behavior %s", name)
+		}
+		log.Lvl2(c.ServerIdentity, "turns byzantine:", name)
+	}
+	c.byzantine.Lock()
+	defer c.byzantine.Unlock()
+	c.byzantine.name = name
+	c.byzantine.byzantine = bz
+	return nil
+}
+
+// Byzantine returns the name of the byzantine behavior of the server, or the
+// empty string if it is honest.
+func (c *Server) Byzantine() string {
+	c.byzantine.Lock()
+	defer c.byzantine.Unlock()
+	return c.byzantine.name
+}
+
+// byzantineBehavior returns the behavior of the server, or nil if it sends
+// its messages as is.
+func (c *Server) byzantineBehavior() ByzantineBehavior {
+	c.byzantine.Lock()
+	defer c.byzantine.Unlock()
+	if c.byzantine.byzantine == nil {
+		return nil
+	}
+	return c.byzantine.behavior
+}
+
+// byzantineProtocol returns the alternative of the protocol run by the server,
+// or nil if it runs the honest one.
+func (c *Server) byzantineProtocol(protocol string) NewProtocol {
+	c.byzantine.Lock()
+	defer c.byzantine.Unlock()
+	if c.byzantine.byzantine == nil {
+		return nil
+	}
+	byzantines.Lock()
+	defer byzantines.Unlock()
+	return c.byzantine.protocols[protocol]
+}
+
+func init() {
+	log.ErrFatal(ByzantineRegister("silent",
+		func(*TreeNodeInstance, *TreeNode, interface{}) interface{} {
+			return nil
+		}))
+	log.ErrFatal(ByzantineRegister("corrupt",
+		func(n *TreeNodeInstance, _ *TreeNode, msg interface{}) interface{} {
+			return corruptMessage(n.Suite(), msg)
+		}))
+	log.ErrFatal(ByzantineRegister("equivocate",
+		func(n *TreeNodeInstance, to *TreeNode, msg interface{}) interface{} {
+			if to.RosterIndex%2 == 0 {
+				return msg
+			}
+			return corruptMessage(n.Suite(), msg)
+		}))
+}
+
+// corruptMessageTries is how often corruptMessage changes the encoding of a
+// message before giving up.
+const corruptMessageTries = 10
+
+// corruptMessage returns a copy of msg with a random byte of its encoding
+// changed, or msg if it finds no such copy that still decodes.
+func corruptMessage(suite network.Suite, msg interface{}) interface{} {
+	t := reflect.TypeOf(msg)
+	ptr := t.Kind() == reflect.Ptr
+	if ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return msg
+	}
+	// protobuf only encodes pointers to structures
+	orig := reflect.ValueOf(msg)
+	if !ptr {
+		orig = reflect.New(t)
+		orig.Elem().Set(reflect.ValueOf(msg))
+	}
+	buf, err := protobuf.Encode(orig.Interface())
+	if err != nil || len(buf) == 0 {
+		return msg
+	}
+	for i := 0; i < corruptMessageTries; i++ {
+		corrupted := append([]byte{}, buf...)
+		corrupted[rand.Intn(len(corrupted))] ^= byte(1 + rand.Intn(255))
+		v := reflect.New(t)
+		err := protobuf.DecodeWithConstructors(corrupted, v.Interface(),
+			network.DefaultConstructors(suite))
+		if err != nil {
+			continue
+		}
+		if ptr {
+			return v.Interface()
+		}
+		return v.Elem().Interface()
+	}
+	return msg
+}
@@ -0,0 +1,101 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// byzantineProtocol sends its value to its child, which reports the value
+// it received.
+type byzantineProtocol struct {
+	*TreeNodeInstance
+	value    int64
+	received chan int64
+}
+
+func (p *byzantineProtocol) Start() error {
+	defer p.Done()
+	return p.SendTo(p.Children()[0], &SimpleMessage{p.value})
+}
+
+func (p *byzantineProtocol) receive(msg MsgSimpleMessage) error {
+	p.received <- msg.I
+	p.Done()
+	return nil
+}
+
+func TestServer_SetByzantine(t *testing.T) {
+	received := make(chan int64, 1)
+	newProtocol := func(value int64) NewProtocol {
+		return func(n *TreeNodeInstance) (ProtocolInstance, error) {
+			p := &byzantineProtocol{TreeNodeInstance: n, value: value,
+				received: received}
+			return p, p.RegisterHandler(p.receive)
+		}
+	}
+	_, err := GlobalProtocolRegister("byzantineTest", newProtocol(10))
+	require.NoError(t, err)
+	require.NoError(t, ByzantineProtocolRegister("byzantineTestLiar",
+		"byzantineTest", newProtocol(11)))
+	require.Error(t, ByzantineProtocolRegister("byzantineTestLiar",
+		"byzantineTest", newProtocol(12)))
+	require.Error(t, ByzantineRegister("silent", nil))
+
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(2, true)
+	require.Error(t, servers[0].SetByzantine("unknown"))
+
+	run := func() (int64, bool) {
+		_, err := servers[0].StartProtocol("byzantineTest", tree)
+		require.NoError(t, err)
+		select {
+		case v := <-received:
+			return v, true
+		case <-time.After(500 * time.Millisecond):
+			return 0, false
+		}
+	}
+
+	v, ok := run()
+	require.True(t, ok)
+	require.Equal(t, int64(10), v)
+
+	require.NoError(t, servers[0].SetByzantine("byzantineTestLiar"))
+	require.Equal(t, "byzantineTestLiar", servers[0].Byzantine())
+	v, ok = run()
+	require.True(t, ok)
+	require.Equal(t, int64(11), v)
+
+	require.NoError(t, servers[0].SetByzantine("silent"))
+	_, ok = run()
+	require.False(t, ok)
+
+	require.NoError(t, servers[0].SetByzantine(""))
+	require.Equal(t, "", servers[0].Byzantine())
+	v, ok = run()
+	require.True(t, ok)
+	require.Equal(t, int64(10), v)
+}
+
+type corruptTestMessage struct {
+	I    int64
+	Data []byte
+}
+
+func TestCorruptMessage(t *testing.T) {
+	msg := &corruptTestMessage{I: 1, Data: make([]byte, 64)}
+	corrupted := corruptMessage(tSuite, msg)
+	require.IsType(t, msg, corrupted)
+	require.NotEqual(t, msg, corrupted)
+	require.Equal(t, &corruptTestMessage{I: 1, Data: make([]byte, 64)}, msg)
+
+	value := corruptMessage(tSuite, *msg)
+	require.IsType(t, *msg, value)
+	require.NotEqual(t, *msg, value)
+
+	// messages without encoding can't be corrupted
+	require.Equal(t, &struct{}{}, corruptMessage(tSuite, &struct{}{}))
+}
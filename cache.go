@@ -0,0 +1,133 @@
+package onet
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/network"
+)
+
+// CachePolicy tells a Client to keep the replies of the conodes, so that the
+// same request sent again to the same conode is answered from the cache, see
+// SetCache.
+type CachePolicy struct {
+	// TTL is how long a reply is kept, unless the request gives its own with
+	// WithCacheTTL. If it is 0, only the requests with a TTL are cached.
+	TTL time.Duration
+	// MaxEntries is the number of replies kept. If it is 0, 1000 replies
+	// are kept.
+	MaxEntries int
+}
+
+const defaultCacheEntries = 1000
+
+type cacheTTLKey struct{}
+
+// WithCacheTTL returns a context telling the Client to keep the reply of the
+// request for ttl, if the client has a cache. A zero ttl doesn't cache the
+// reply, and a request with a ttl is never answered from a reply older than
+// it.
+func WithCacheTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, cacheTTLKey{}, ttl)
+}
+
+// SetCache sets the cache policy of the replies to the requests sent with
+// Send and SendProtobuf. A nil policy disables the cache, which is the
+// default, and drops the cached replies.
+func (c *Client) SetCache(p *CachePolicy) {
+	c.Lock()
+	defer c.Unlock()
+	if p == nil {
+		c.cache = nil
+		return
+	}
+	max := p.MaxEntries
+	if max == 0 {
+		max = defaultCacheEntries
+	}
+	c.cache = &replyCache{
+		ttl:     p.TTL,
+		max:     max,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// replyCache holds the replies of a Client.
+type replyCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	reply   []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// cacheKey returns the key of the request sent to the conode.
+func cacheKey(dst *network.ServerIdentity, path string, buf []byte) string {
+	h := sha256.New()
+	h.Write(dst.ID[:])
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(buf)
+	return string(h.Sum(nil))
+}
+
+// requestTTL returns how long the reply of the request can be kept.
+func (rc *replyCache) requestTTL(ctx context.Context) time.Duration {
+	if ttl, ok := ctx.Value(cacheTTLKey{}).(time.Duration); ok {
+		return ttl
+	}
+	return rc.ttl
+}
+
+// get returns the reply to the request, if it is in the cache.
+func (rc *replyCache) get(ctx context.Context, key string) ([]byte, bool) {
+	ttl := rc.requestTTL(ctx)
+	if ttl <= 0 {
+		return nil, false
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	e, ok := rc.entries[key]
+	now := time.Now()
+	if !ok || now.After(e.expires) || now.Sub(e.stored) > ttl {
+		return nil, false
+	}
+	return append([]byte{}, e.reply...), true
+}
+
+// put keeps the reply to the request, if the request can be cached.
+func (rc *replyCache) put(ctx context.Context, key string, reply []byte) {
+	ttl := rc.requestTTL(ctx)
+	if ttl <= 0 {
+		return
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	now := time.Now()
+	if _, ok := rc.entries[key]; !ok && len(rc.entries) >= rc.max {
+		// drop the expired replies, or else the one expiring first
+		var first string
+		for k, e := range rc.entries {
+			if now.After(e.expires) {
+				delete(rc.entries, k)
+			} else if first == "" || e.expires.Before(rc.entries[first].expires) {
+				first = k
+			}
+		}
+		if len(rc.entries) >= rc.max {
+			delete(rc.entries, first)
+		}
+	}
+	rc.entries[key] = cacheEntry{
+		reply:   append([]byte{}, reply...),
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+}
@@ -0,0 +1,65 @@
+package onet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/protobuf"
+)
+
+func TestClient_Cache(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(2, false)
+
+	cl := NewClient(tSuite, serviceWebSocket)
+	cl.SetCache(&CachePolicy{TTL: time.Minute})
+	buf, err := protobuf.Encode(&SimpleResponse{})
+	require.NoError(t, err)
+	send := func(ctx context.Context, i int) bool {
+		tx := cl.Tx()
+		reply, err := cl.SendWithContext(ctx, servers[i].ServerIdentity, "SimpleResponse", buf)
+		require.NoError(t, err)
+		require.NoError(t, protobuf.Decode(reply, &SimpleResponse{}))
+		return cl.Tx() == tx
+	}
+
+	require.False(t, send(context.Background(), 0))
+	require.True(t, send(context.Background(), 0))
+	// another conode
+	require.False(t, send(context.Background(), 1))
+
+	// the TTL of the request
+	require.False(t, send(WithCacheTTL(context.Background(), 0), 0))
+	time.Sleep(20 * time.Millisecond)
+	require.False(t, send(WithCacheTTL(context.Background(), 10*time.Millisecond), 0))
+	require.True(t, send(WithCacheTTL(context.Background(), time.Second), 0))
+
+	// errors are not cached
+	req := &ErrorRequest{Roster: *roster, Flags: 1}
+	require.Error(t, cl.SendProtobuf(servers[0].ServerIdentity, req, nil))
+	tx := cl.Tx()
+	require.Error(t, cl.SendProtobuf(servers[0].ServerIdentity, req, nil))
+	require.NotEqual(t, tx, cl.Tx())
+
+	cl.SetCache(nil)
+	require.False(t, send(context.Background(), 0))
+}
+
+func TestReplyCache_MaxEntries(t *testing.T) {
+	cl := NewClient(tSuite, serviceWebSocket)
+	cl.SetCache(&CachePolicy{TTL: time.Minute, MaxEntries: 2})
+	rc := cl.cache
+	ctx := context.Background()
+	rc.put(WithCacheTTL(ctx, time.Second), "a", []byte("a"))
+	rc.put(ctx, "b", []byte("b"))
+	rc.put(ctx, "c", []byte("c"))
+	require.Len(t, rc.entries, 2)
+	_, ok := rc.get(ctx, "a")
+	require.False(t, ok)
+	reply, ok := rc.get(ctx, "c")
+	require.True(t, ok)
+	require.Equal(t, []byte("c"), reply)
+}
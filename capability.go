@@ -0,0 +1,188 @@
+package onet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// Capability grants its bearer access to some handlers of a service until it
+// expires, even if the handlers are protected by a rule. It is signed by the
+// conode, or by the key of the service if the conode has one, so operators can
+// hand out narrowly scoped credentials without adding keys to the rules.
+//
+// Whoever holds a capability can use it, so it must be kept secret like a
+// password and given a short expiry.
+type Capability struct {
+	Service string
+	// Handlers are the names of the messages of the handlers the capability
+	// gives access to.
+	Handlers []string
+	// Expiry is the end of validity in nanoseconds since the epoch.
+	Expiry int64
+	// Issuer is the public key that signed the capability.
+	Issuer    []byte
+	Signature []byte
+}
+
+// digest returns the hash signed by the issuer.
+func (c *Capability) digest() []byte {
+	h := sha256.New()
+	h.Write([]byte("onet-capability"))
+	h.Write([]byte(c.Service))
+	h.Write([]byte{0})
+	for _, handler := range c.Handlers {
+		h.Write([]byte(handler))
+		h.Write([]byte{0})
+	}
+	binary.Write(h, binary.LittleEndian, c.Expiry)
+	h.Write(c.Issuer)
+	return h.Sum(nil)
+}
+
+// NewCapability returns a capability for the handlers of the service, valid
+// until expiry, signed with private.
+func NewCapability(suite network.Suite, private kyber.Scalar, service string,
+	handlers []string, expiry time.Time) (*Capability, error) {
+	if len(handlers) == 0 {
+		return nil, xerrors.New("a capability needs at least one handler")
+	}
+	issuer, err := suite.Point().Mul(private, nil).MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("marshaling public key: %v", err)
+	}
+	c := &Capability{
+		Service:  service,
+		Handlers: handlers,
+		Expiry:   expiry.UnixNano(),
+		Issuer:   issuer,
+	}
+	c.Signature, err = schnorr.Sign(suite, private, c.digest())
+	if err != nil {
+		return nil, xerrors.Errorf("signing: %v", err)
+	}
+	return c, nil
+}
+
+// ParseCapability decodes a capability written with Capability.String.
+func ParseCapability(s string) (*Capability, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding base64: %v", err)
+	}
+	c := &Capability{}
+	if err := protobuf.Decode(buf, c); err != nil {
+		return nil, xerrors.Errorf("decoding capability: %v", err)
+	}
+	return c, nil
+}
+
+// String returns the capability as a token that can be given to its bearer.
+func (c *Capability) String() string {
+	buf, err := protobuf.Encode(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// ID returns how the capability appears in the audit log. It doesn't reveal
+// the capability.
+func (c *Capability) ID() string {
+	h := sha256.Sum256(c.Signature)
+	return "capability:" + hex.EncodeToString(h[:8])
+}
+
+// verify checks that the capability is valid for the handler at path of the
+// service at the time now, and signed by one of the issuers.
+func (c *Capability) verify(service, path string, now time.Time,
+	issuers map[kyber.Point]network.Suite) error {
+	if c.Service != service {
+		return xerrors.Errorf("capability is for service %s", c.Service)
+	}
+	found := false
+	for _, h := range c.Handlers {
+		found = found || h == path
+	}
+	if !found {
+		return xerrors.Errorf("capability doesn't cover %s", path)
+	}
+	if now.UnixNano() > c.Expiry {
+		return xerrors.New("capability expired")
+	}
+	for pub, suite := range issuers {
+		buf, err := pub.MarshalBinary()
+		if err != nil || !bytes.Equal(buf, c.Issuer) {
+			continue
+		}
+		if err := schnorr.Verify(suite, pub, c.digest(), c.Signature); err != nil {
+			return xerrors.Errorf("invalid signature: %v", err)
+		}
+		return nil
+	}
+	return xerrors.New("unknown issuer")
+}
+
+// capabilityIssuers returns the keys the conode accepts on the capabilities
+// of the service: its own key and the key of the service.
+func (c *Server) capabilityIssuers(service string) map[kyber.Point]network.Suite {
+	issuers := map[kyber.Point]network.Suite{
+		c.ServerIdentity.Public: c.Suite(),
+	}
+	for _, sid := range c.ServerIdentity.ServiceIdentities {
+		if sid.Name != service {
+			continue
+		}
+		suite, err := suites.Find(sid.Suite)
+		if err != nil {
+			log.Warn("Unknown suite of service", service, ":", err)
+			continue
+		}
+		issuers[sid.Public] = suite
+	}
+	return issuers
+}
+
+// verifyCapability checks the capability for the handler at path of the
+// service.
+func (c *Server) verifyCapability(capa *Capability, service, path string) error {
+	return capa.verify(service, path, c.clock.Now(), c.capabilityIssuers(service))
+}
+
+// NewCapability issues a capability for the handlers of the service, valid
+// until expiry. It is signed with the key of the service if the conode has
+// one, else with the key of the conode.
+func (c *Server) NewCapability(service string, handlers []string, expiry time.Time) (*Capability, error) {
+	if ServiceFactory.ServiceID(service).IsNil() {
+		return nil, xerrors.Errorf("unknown service %s", service)
+	}
+	for _, sid := range c.ServerIdentity.ServiceIdentities {
+		if sid.Name != service || sid.GetPrivate() == nil {
+			continue
+		}
+		suite, err := suites.Find(sid.Suite)
+		if err != nil {
+			return nil, xerrors.Errorf("suite of service: %v", err)
+		}
+		return NewCapability(suite, sid.GetPrivate(), service, handlers, expiry)
+	}
+	return NewCapability(c.Suite(), c.ServerIdentity.GetPrivate(), service, handlers, expiry)
+}
+
+// SendProtobufCapability is like SendProtobuf, but gives the capability along
+// with the message, for handlers protected by a rule.
+func (c *Client) SendProtobufCapability(dst *network.ServerIdentity, msg interface{},
+	ret interface{}, capa *Capability) error {
+	return c.sendSignedRequest(dst, msg, ret, capa)
+}
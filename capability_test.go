@@ -0,0 +1,64 @@
+package onet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+func TestCapability(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	h := local.GenServers(1)[0]
+	ts := h.Service(testServiceName).(*testService)
+	admin := key.NewKeyPair(tSuite)
+	require.NoError(t, ts.SetRule("testMsg", Identity(admin.Public)))
+
+	send := func(capa *Capability) error {
+		client := local.NewClient(testServiceName)
+		defer client.Close()
+		return client.SendProtobufCapability(h.ServerIdentity, &testMsg{12}, &testMsg{}, capa)
+	}
+
+	expiry := time.Now().Add(time.Hour)
+	capa, err := h.NewCapability(testServiceName, []string{"testMsg"}, expiry)
+	require.NoError(t, err)
+	require.NoError(t, send(capa))
+	parsed, err := ParseCapability(capa.String())
+	require.NoError(t, err)
+	require.NoError(t, send(parsed))
+
+	_, err = h.NewCapability("unknown", []string{"testMsg"}, expiry)
+	require.Error(t, err)
+	_, err = h.NewCapability(testServiceName, nil, expiry)
+	require.Error(t, err)
+
+	// wrong handler, expired, wrong issuer, tampered
+	capa, err = h.NewCapability(testServiceName, []string{"otherMsg"}, expiry)
+	require.NoError(t, err)
+	require.Error(t, send(capa))
+	capa, err = h.NewCapability(testServiceName, []string{"testMsg"}, time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	require.Error(t, send(capa))
+	capa, err = NewCapability(tSuite, admin.Private, testServiceName, []string{"testMsg"}, expiry)
+	require.NoError(t, err)
+	require.Error(t, send(capa))
+	capa, err = h.NewCapability(testServiceName, []string{"otherMsg"}, expiry)
+	require.NoError(t, err)
+	capa.Handlers = []string{"testMsg"}
+	require.Error(t, send(capa))
+
+	// the error returned by the dispatcher
+	sr, err := NewSignedRequest(tSuite, h.ServerIdentity.ID, testServiceName, "testMsg", nil)
+	require.NoError(t, err)
+	sr.Capability = capa
+	buf, err := protobuf.Encode(sr)
+	require.NoError(t, err)
+	_, err = ts.authorize(context.Background(), "testMsg", buf)
+	require.True(t, xerrors.Is(err, ErrUnauthorized))
+}
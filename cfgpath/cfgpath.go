@@ -1,65 +1,164 @@
+// Package cfgpath returns the directories where an application keeps its
+// configuration, its data and its cache.
+//
+// Each of them can be set with an environment variable named after the
+// application: for "conode", CONODE_CONFIG_DIR, CONODE_DATA_DIR and
+// CONODE_CACHE_DIR. Else they are:
+//
+//	         Linux, BSD (XDG)        macOS                                  Windows
+//	config   $XDG_CONFIG_HOME/app    ~/Library/Application Support/app      %APPDATA%\app
+//	data     $XDG_DATA_HOME/app      ~/Library/Application Support/app/data %LOCALAPPDATA%\app
+//	cache    $XDG_CACHE_HOME/app     ~/Library/Caches/app                   %LOCALAPPDATA%\app\cache
+//
+// with the defaults of the XDG Base Directory specification, ~/.config,
+// ~/.local/share and ~/.cache, if the XDG variables are unset or not
+// absolute. On Windows, the data stay in %APPDATA%\app\data if they were
+// kept there before. On the other systems, they are in ./app.
 package cfgpath
 
 import (
 	"os"
 	"os/user"
-	"path"
+	"path/filepath"
 	"runtime"
+	"strings"
 
 	"go.dedis.ch/onet/v3/log"
 )
 
+// kind is the type of files kept in a directory.
+type kind int
+
+const (
+	config kind = iota
+	data
+	cache
+)
+
 // GetConfigPath returns the location for which the configuration files are stored.
-// Linux:	we follow the XDG Base Directory specification
-// macOS:	$HOME/Library/Application Support/appName
-// Windows:	%AppData%/appName
-// Other:	./appName (we use current directory)
 func GetConfigPath(appName string) string {
+	return getPath(appName, config, runtime.GOOS)
+}
+
+// GetDataPath returns the location for which the data files are stored.
+func GetDataPath(appName string) string {
+	return getPath(appName, data, runtime.GOOS)
+}
+
+// GetCachePath returns the location for which the files that can be
+// recreated are stored.
+func GetCachePath(appName string) string {
+	return getPath(appName, cache, runtime.GOOS)
+}
+
+// EnvName returns the environment variable overriding the directory of the
+// kind, "config", "data" or "cache", of the application.
+func EnvName(appName, kind string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, appName)
+	return name + "_" + strings.ToUpper(kind) + "_DIR"
+}
+
+func (k kind) String() string {
+	switch k {
+	case config:
+		return "config"
+	case data:
+		return "data"
+	default:
+		return "cache"
+	}
+}
+
+func getPath(appName string, k kind, goos string) string {
 	if len(appName) == 0 {
 		log.Panic("appName cannot be empty")
 	}
+	if p := os.Getenv(EnvName(appName, k.String())); p != "" {
+		return p
+	}
 
-	home := os.Getenv("HOME")
+	home := homeDir()
 	if home == "" {
-		u, err := user.Current()
-		if err != nil {
-			log.Warn("Could not find the home directory. Switching back to current dir.")
-			return getCurrentDir(appName)
-		}
-		home = u.HomeDir
+		log.Warn("Could not find the home directory. Switching back to current dir.")
+		return getCurrentDir(appName)
 	}
 
-	switch runtime.GOOS {
+	switch goos {
 	case "darwin":
-		return path.Join(home, "Library", "Application Support", appName)
+		switch k {
+		case config:
+			return filepath.Join(home, "Library", "Application Support", appName)
+		case data:
+			return filepath.Join(home, "Library", "Application Support", appName, "data")
+		default:
+			return filepath.Join(home, "Library", "Caches", appName)
+		}
 	case "windows":
-		return path.Join(os.Getenv("APPDATA"), appName)
-	case "linux", "freebsd":
-		xdg := os.Getenv("XDG_CONFIG_HOME")
-		if xdg != "" {
-			return path.Join(xdg, appName)
+		roaming := os.Getenv("APPDATA")
+		if roaming == "" {
+			roaming = filepath.Join(home, "AppData", "Roaming")
+		}
+		local := os.Getenv("LOCALAPPDATA")
+		if local == "" {
+			local = filepath.Join(home, "AppData", "Local")
+		}
+		switch k {
+		case config:
+			return filepath.Join(roaming, appName)
+		case data:
+			// where the data were kept before
+			legacy := filepath.Join(roaming, appName, "data")
+			if _, err := os.Stat(legacy); err == nil {
+				return legacy
+			}
+			return filepath.Join(local, appName)
+		default:
+			return filepath.Join(local, appName, "cache")
+		}
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		switch k {
+		case config:
+			return filepath.Join(envDir("XDG_CONFIG_HOME", home, ".config"), appName)
+		case data:
+			return filepath.Join(envDir("XDG_DATA_HOME", home, ".local", "share"), appName)
+		default:
+			return filepath.Join(envDir("XDG_CACHE_HOME", home, ".cache"), appName)
 		}
-		return path.Join(home, ".config", appName)
 	default:
 		return getCurrentDir(appName)
 	}
 }
 
-// GetDataPath returns the location for which the data files are stored.
-// Linux:	we follow the XDG Base Directory specification
-// All others:	the "data" directory in the path retunred by GetConfigPath
-func GetDataPath(appName string) string {
-	switch runtime.GOOS {
-	case "linux", "freebsd":
-		xdg := os.Getenv("XDG_DATA_HOME")
-		if xdg != "" {
-			return path.Join(xdg, appName)
-		}
-		return path.Join(os.Getenv("HOME"), ".local", "share", appName)
-	default:
-		p := GetConfigPath(appName)
-		return path.Join(p, "data")
+// envDir returns the directory in the XDG environment variable if it is an
+// absolute path, else the default one in the home directory.
+func envDir(name, home string, def ...string) string {
+	if p := os.Getenv(name); filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(append([]string{home}, def...)...)
+}
+
+// homeDir returns the home directory of the user, or "" if it isn't known.
+func homeDir() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return home
+	}
+	if home := os.Getenv("USERPROFILE"); home != "" {
+		return home
+	}
+	u, err := user.Current()
+	if err != nil {
+		return ""
 	}
+	return u.HomeDir
 }
 
 func getCurrentDir(appName string) string {
@@ -67,5 +166,5 @@ func getCurrentDir(appName string) string {
 	if err != nil {
 		log.Panic("impossible to get the current directory:", err)
 	}
-	return path.Join(curr, appName)
+	return filepath.Join(curr, appName)
 }
@@ -0,0 +1,66 @@
+package cfgpath
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setEnv sets the environment variables and returns a function restoring
+// them.
+func setEnv(vars map[string]string) func() {
+	old := make(map[string]string)
+	for k, v := range vars {
+		old[k] = os.Getenv(k)
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	require.Equal(t, "CONODE_CONFIG_DIR", EnvName("conode", "config"))
+	require.Equal(t, "MY_APP2_CACHE_DIR", EnvName("my-app2", "cache"))
+}
+
+func TestGetPath(t *testing.T) {
+	home, err := ioutil.TempDir("", "cfgpath")
+	require.NoError(t, err)
+	defer os.RemoveAll(home)
+	defer setEnv(map[string]string{"HOME": home, "XDG_CONFIG_HOME": "",
+		"XDG_DATA_HOME": "relative", "XDG_CACHE_HOME": "/cache",
+		"APPDATA": filepath.Join(home, "roaming"), "LOCALAPPDATA": "",
+		"APP_CONFIG_DIR": "", "APP_DATA_DIR": "", "APP_CACHE_DIR": ""})()
+
+	for goos, dirs := range map[string][]string{
+		"linux": {filepath.Join(home, ".config", "app"),
+			filepath.Join(home, ".local", "share", "app"), "/cache/app"},
+		"darwin": {filepath.Join(home, "Library", "Application Support", "app"),
+			filepath.Join(home, "Library", "Application Support", "app", "data"),
+			filepath.Join(home, "Library", "Caches", "app")},
+		"windows": {filepath.Join(home, "roaming", "app"),
+			filepath.Join(home, "AppData", "Local", "app"),
+			filepath.Join(home, "AppData", "Local", "app", "cache")},
+	} {
+		for i, k := range []kind{config, data, cache} {
+			require.Equal(t, dirs[i], getPath("app", k, goos), "%s %s", goos, k)
+		}
+	}
+
+	// the data of the previous versions stay where they are on Windows
+	legacy := filepath.Join(home, "roaming", "app", "data")
+	require.NoError(t, os.MkdirAll(legacy, 0700))
+	require.Equal(t, legacy, getPath("app", data, "windows"))
+
+	defer setEnv(map[string]string{"APP_DATA_DIR": "/srv/app"})()
+	for _, goos := range []string{"linux", "darwin", "windows"} {
+		require.Equal(t, "/srv/app", getPath("app", data, goos))
+	}
+	require.Equal(t, filepath.Join(home, ".config", "app"), getPath("app", config, "linux"))
+}
@@ -0,0 +1,221 @@
+package onet
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// ChaosConfig bounds the faults injected by LocalTest.Chaos. A zero value
+// disables the corresponding fault.
+type ChaosConfig struct {
+	// Seed chooses the faults, so that a failing test can be run again
+	// with the same ones.
+	Seed int64
+	// MaxDelay bounds the random delay of every message sent between the
+	// servers. The messages from a server to another one stay in order.
+	MaxDelay time.Duration
+	// ReconnectInterval is the mean time between the closing of the
+	// connections of two random servers, which open new ones to send their
+	// next messages.
+	ReconnectInterval time.Duration
+	// RestartInterval is the mean time between the restarts of a random
+	// server, which is down during RestartDowntime. A restarted server
+	// loses its protocol instances and the messages it receives while it is
+	// down, but keeps the storage of its services.
+	RestartInterval time.Duration
+	RestartDowntime time.Duration
+}
+
+// chaos injects the faults of a configuration into the servers of a test.
+type chaos struct {
+	cfg     ChaosConfig
+	servers []*Server
+	rand    *rand.Rand
+	// queues keeps the delayed messages from a server to another in order
+	queues map[[2]network.ServerIdentityID]chan struct{}
+	stops  []func()
+	// timers are the next reconnection and the next restart
+	timers map[string]*time.Timer
+	// down are the crashed servers, with the timers restarting them
+	down    map[*Server]*time.Timer
+	stopped bool
+	// pending are the delayed messages and the faults being injected
+	pending sync.WaitGroup
+	sync.Mutex
+}
+
+// Chaos injects random faults within the bounds of cfg into the servers of
+// the test, until the returned function or CloseAll is called: delayed
+// messages, closed connections and restarted servers. It applies to the
+// servers already created, and is meant to shake out the assumptions of the
+// services on the ordering and the reliability of the network.
+func (l *LocalTest) Chaos(cfg ChaosConfig) func() {
+	l.panicClosed()
+	c := &chaos{
+		cfg:    cfg,
+		rand:   rand.New(rand.NewSource(cfg.Seed)),
+		queues: make(map[[2]network.ServerIdentityID]chan struct{}),
+		timers: make(map[string]*time.Timer),
+		down:   make(map[*Server]*time.Timer),
+	}
+	for _, s := range l.Servers {
+		c.servers = append(c.servers, s)
+	}
+	// the seed chooses the same servers in every run
+	sort.Slice(c.servers, func(i, j int) bool {
+		return c.servers[i].ServerIdentity.Address < c.servers[j].ServerIdentity.Address
+	})
+	log.Lvl2("Starting chaos with seed", cfg.Seed)
+	if cfg.MaxDelay > 0 {
+		for _, s := range c.servers {
+			c.stops = append(c.stops, s.intercept(network.ErrorType, nil, c.delay))
+		}
+	}
+	c.Lock()
+	if cfg.ReconnectInterval > 0 && len(c.servers) > 1 {
+		c.every("reconnect", cfg.ReconnectInterval, c.reconnect)
+	}
+	if cfg.RestartInterval > 0 && len(c.servers) > 0 {
+		c.every("restart", cfg.RestartInterval, c.restart)
+	}
+	c.Unlock()
+	l.chaos = append(l.chaos, c.stop)
+	return c.stop
+}
+
+// duration returns a random duration of at most max. It must be called
+// with the lock.
+func (c *chaos) duration(max time.Duration) time.Duration {
+	return time.Duration(c.rand.Int63n(int64(max) + 1))
+}
+
+// delay delivers the intercepted message after a random delay, once the
+// previous message to the same server is delivered.
+func (c *chaos) delay(i *Interception) {
+	c.Lock()
+	if c.stopped {
+		c.Unlock()
+		if err := i.Deliver(); err != nil {
+			log.Lvl3("chaos couldn't deliver message:", err)
+		}
+		return
+	}
+	d := c.duration(c.cfg.MaxDelay)
+	key := [2]network.ServerIdentityID{i.From.ID, i.To.ID}
+	prev := c.queues[key]
+	done := make(chan struct{})
+	c.queues[key] = done
+	c.pending.Add(1)
+	c.Unlock()
+	go func() {
+		defer c.pending.Done()
+		defer close(done)
+		time.Sleep(d)
+		if prev != nil {
+			<-prev
+		}
+		if err := i.Deliver(); err != nil {
+			log.Lvl3("chaos couldn't deliver message:", err)
+		}
+	}()
+}
+
+// every calls f after random intervals of mean interval, until the chaos
+// stops. It must be called with the lock, and f is called with the lock.
+// The function f returns is then called without it, as crashing a server
+// can send messages that are delayed.
+func (c *chaos) every(name string, interval time.Duration, f func() func()) {
+	c.timers[name] = time.AfterFunc(c.duration(2*interval), func() {
+		c.Lock()
+		if c.stopped {
+			c.Unlock()
+			return
+		}
+		c.pending.Add(1)
+		inject := f()
+		c.every(name, interval, f)
+		c.Unlock()
+		defer c.pending.Done()
+		if inject != nil {
+			inject()
+		}
+	})
+}
+
+// reconnect closes the connections between two random servers.
+func (c *chaos) reconnect() func() {
+	a := c.servers[c.rand.Intn(len(c.servers))]
+	b := c.servers[c.rand.Intn(len(c.servers))]
+	if a == b {
+		return nil
+	}
+	return func() {
+		log.Lvl3("Chaos closes the connections between", a.ServerIdentity,
+			"and", b.ServerIdentity)
+		a.Router.CloseConnections(b.ServerIdentity.ID)
+	}
+}
+
+// restart crashes a random server, and restarts it after the downtime.
+func (c *chaos) restart() func() {
+	s := c.servers[c.rand.Intn(len(c.servers))]
+	if _, down := c.down[s]; down {
+		return nil
+	}
+	// the timer restarting it is set once it crashed
+	c.down[s] = nil
+	return func() {
+		s.Crash()
+		c.Lock()
+		defer c.Unlock()
+		if c.stopped {
+			return
+		}
+		c.pending.Add(1)
+		c.down[s] = time.AfterFunc(c.cfg.RestartDowntime, func() {
+			defer c.pending.Done()
+			c.Lock()
+			_, down := c.down[s]
+			delete(c.down, s)
+			c.Unlock()
+			if down {
+				s.Restart()
+			}
+		})
+	}
+}
+
+// stop ends the chaos, restarts the crashed servers and waits for the
+// delayed messages to be delivered.
+func (c *chaos) stop() {
+	c.Lock()
+	if c.stopped {
+		c.Unlock()
+		return
+	}
+	c.stopped = true
+	for _, stop := range c.stops {
+		stop()
+	}
+	for _, t := range c.timers {
+		t.Stop()
+	}
+	down := c.down
+	c.down = nil
+	for _, t := range down {
+		if t != nil && t.Stop() {
+			c.pending.Done()
+		}
+	}
+	c.Unlock()
+	// the faults being injected end before the servers are restarted
+	c.pending.Wait()
+	for s := range down {
+		s.Restart()
+	}
+}
@@ -0,0 +1,58 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalTest_Chaos(t *testing.T) {
+	received := make(chan int64, 10)
+	_, err := GlobalProtocolRegister("chaosTest", func(n *TreeNodeInstance) (ProtocolInstance, error) {
+		p := &interceptProtocol{TreeNodeInstance: n, received: received}
+		return p, p.RegisterHandler(p.receive)
+	})
+	require.NoError(t, err)
+
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(2, true)
+
+	run := func() []int64 {
+		servers[0].StartProtocol("chaosTest", tree)
+		var values []int64
+		for {
+			select {
+			case v := <-received:
+				values = append(values, v)
+			case <-time.After(300 * time.Millisecond):
+				return values
+			}
+		}
+	}
+
+	// the delayed messages stay in order, and are sent again on new
+	// connections
+	stop := local.Chaos(ChaosConfig{Seed: 1, MaxDelay: 50 * time.Millisecond,
+		ReconnectInterval: 10 * time.Millisecond})
+	for i := 0; i < 5; i++ {
+		require.Equal(t, []int64{1, 2}, run())
+	}
+	stop()
+
+	// a crashed server drops the messages, until it restarts
+	stop = local.Chaos(ChaosConfig{Seed: 1, RestartInterval: 10 * time.Millisecond,
+		RestartDowntime: time.Second})
+	dropped := false
+	for i := 0; i < 5 && !dropped; i++ {
+		dropped = len(run()) < 2
+	}
+	require.True(t, dropped)
+	stop()
+	require.Equal(t, []int64{1, 2}, run())
+
+	// CloseAll stops the chaos
+	local.Chaos(ChaosConfig{Seed: 2, MaxDelay: 50 * time.Millisecond,
+		RestartInterval: 10 * time.Millisecond, RestartDowntime: time.Second})
+}
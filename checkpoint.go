@@ -0,0 +1,198 @@
+package onet
+
+import (
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// Checkpointer is implemented by the protocol instances that can be resumed
+// by the next process of the conode when it is upgraded without stopping,
+// instead of failing for the other members of the roster.
+type Checkpointer interface {
+	// Checkpoint returns the state of the instance. It is called right
+	// before the conode closes, while the instance may still run.
+	Checkpoint() ([]byte, error)
+	// Resume restores the state returned by Checkpoint in the instance
+	// created again by the next process, before it gets any message.
+	Resume(state []byte) error
+}
+
+// checkpointBucket holds the protocol instances saved by
+// CheckpointProtocols, by token.
+var checkpointBucket = []byte("onet_checkpoints")
+
+// protocolCheckpoint is what is saved of a protocol instance to resume it.
+type protocolCheckpoint struct {
+	Token  Token
+	Tree   *TreeMarshal
+	Roster *Roster
+	Config *GenericConfig
+	State  []byte
+}
+
+// CheckpointProtocols saves the running protocol instances implementing
+// Checkpointer in the database, so that they are resumed when the conode
+// starts again from it, usually in the process replacing this one during an
+// upgrade. The other instances are lost. It returns the number of instances
+// saved, and is to be called in maintenance, right before Close.
+func (c *Server) CheckpointProtocols() (int, error) {
+	o := c.overlay
+	o.instancesLock.Lock()
+	tnis := make(map[*TreeNodeInstance]ProtocolInstance)
+	for id, pi := range o.protocolInstances {
+		if tni := o.instances[id]; tni != nil {
+			tnis[tni] = pi
+		}
+	}
+	o.instancesLock.Unlock()
+
+	// Checkpoint isn't called under the lock, as the instances use it
+	var cps []*protocolCheckpoint
+	for tni, pi := range tnis {
+		cpr, ok := pi.(Checkpointer)
+		if !ok {
+			log.Warn("Protocol instance of", tni.ProtocolName(),
+				"can't be checkpointed and is lost")
+			continue
+		}
+		state, err := cpr.Checkpoint()
+		if err != nil {
+			log.Error("Couldn't checkpoint the protocol instance of",
+				tni.ProtocolName(), ":", err)
+			continue
+		}
+		tree := tni.Tree()
+		if tree == nil {
+			continue
+		}
+		cps = append(cps, &protocolCheckpoint{
+			Token:  *tni.Token(),
+			Tree:   tree.MakeTreeMarshal(),
+			Roster: tree.Roster,
+			Config: tni.config,
+			State:  state,
+		})
+	}
+	if len(cps) == 0 {
+		return 0, nil
+	}
+	err := c.serviceManager.store.Update(func(tx StoreTx) error {
+		b, err := tx.CreateBucketIfNotExists(checkpointBucket)
+		if err != nil {
+			return xerrors.Errorf("creating bucket: %v", err)
+		}
+		for _, cp := range cps {
+			buf, err := protobuf.Encode(cp)
+			if err != nil {
+				return xerrors.Errorf("encoding checkpoint: %v", err)
+			}
+			id := cp.Token.ID()
+			if err := b.Put(id[:], buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("tx error: %v", err)
+	}
+	return len(cps), nil
+}
+
+// resumeProtocols creates again the protocol instances saved by
+// CheckpointProtocols, and removes them from the database.
+func (c *Server) resumeProtocols() {
+	// most starts have no checkpoint: don't write to the database for them
+	found := false
+	err := c.serviceManager.store.View(func(tx StoreTx) error {
+		found = tx.Bucket(checkpointBucket) != nil
+		return nil
+	})
+	if err != nil {
+		log.Error("Couldn't read the protocol checkpoints:", err)
+		return
+	}
+	if !found {
+		return
+	}
+
+	var cps []*protocolCheckpoint
+	err = c.serviceManager.store.Update(func(tx StoreTx) error {
+		b := tx.Bucket(checkpointBucket)
+		if b == nil {
+			return nil
+		}
+		err := b.ForEach(func(k, v []byte) error {
+			cp := &protocolCheckpoint{}
+			err := protobuf.DecodeWithConstructors(v, cp,
+				network.DefaultConstructors(c.suite))
+			if err != nil {
+				log.Error("Couldn't decode a protocol checkpoint:", err)
+				return nil
+			}
+			cps = append(cps, cp)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.DeleteBucket(checkpointBucket)
+	})
+	if err != nil {
+		log.Error("Couldn't read the protocol checkpoints:", err)
+		return
+	}
+	for _, cp := range cps {
+		if err := c.overlay.resumeProtocol(cp); err != nil {
+			log.Error("Couldn't resume a protocol instance:", err)
+		}
+	}
+	if len(cps) > 0 {
+		log.Lvl2(c.ServerIdentity.Address, "resumed", len(cps), "protocol instances")
+	}
+}
+
+// resumeProtocol creates the protocol instance of the checkpoint, restores
+// its state and starts dispatching its messages.
+func (o *Overlay) resumeProtocol(cp *protocolCheckpoint) error {
+	if cp.Tree == nil || cp.Roster == nil {
+		return xerrors.New("checkpoint without tree")
+	}
+	tree, err := cp.Tree.MakeTree(cp.Roster)
+	if err != nil {
+		return xerrors.Errorf("making tree: %v", err)
+	}
+	tn := tree.Search(cp.Token.TreeNodeID)
+	if tn == nil {
+		return xerrors.New("tree node not in the tree")
+	}
+	o.RegisterTree(tree)
+	tok := cp.Token
+	io := o.protoIO.getByName(o.server.protocols.ProtocolIDToName(tok.ProtoID))
+	tni := o.newTreeNodeInstanceFromToken(tn, &tok, io)
+	tni.config = cp.Config
+	pi, err := o.server.serviceManager.newProtocol(tni, cp.Config)
+	if err == nil && pi == nil {
+		err = xerrors.New("no protocol instance")
+	}
+	if err == nil {
+		if cpr, ok := pi.(Checkpointer); !ok {
+			err = xerrors.New("the protocol instance isn't a Checkpointer")
+		} else if err = cpr.Resume(cp.State); err != nil {
+			err = xerrors.Errorf("resuming: %v", err)
+		}
+	}
+	if err == nil {
+		err = o.RegisterProtocolInstance(pi)
+	}
+	if err != nil {
+		o.instancesLock.Lock()
+		o.nodeDelete(&tok)
+		o.instancesLock.Unlock()
+		return xerrors.Errorf("protocol %s: %v", tni.ProtocolName(), err)
+	}
+	go o.dispatch(tni, pi)
+	return nil
+}
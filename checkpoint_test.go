@@ -0,0 +1,104 @@
+package onet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const checkpointProtoName = "CheckpointProtoTest"
+
+func init() {
+	GlobalProtocolRegister(checkpointProtoName, newCheckpointProto)
+}
+
+// checkpointProto is a ping pong whose instances can be checkpointed.
+type checkpointProto struct {
+	*TreeNodeInstance
+	state  []byte
+	done   chan bool
+	closed chan bool
+	pings  chan struct {
+		*TreeNode
+		PingPongMsg
+	}
+}
+
+func newCheckpointProto(tn *TreeNodeInstance) (ProtocolInstance, error) {
+	p := &checkpointProto{
+		TreeNodeInstance: tn,
+		done:             make(chan bool, 1),
+		closed:           make(chan bool),
+	}
+	err := p.RegisterChannelsLength(len(tn.Tree().List()), &p.pings)
+	return p, err
+}
+
+func (p *checkpointProto) Start() error {
+	return p.SendToChildren(&PingPongMsg{})
+}
+
+func (p *checkpointProto) Dispatch() error {
+	select {
+	case <-p.pings:
+	case <-p.closed:
+		// stopped without finishing, as when the conode is upgraded
+		return nil
+	}
+	defer p.Done()
+	if !p.IsRoot() {
+		return p.SendToParent(&PingPongMsg{})
+	}
+	p.done <- true
+	return nil
+}
+
+func (p *checkpointProto) Shutdown() error {
+	close(p.closed)
+	return nil
+}
+
+func (p *checkpointProto) Checkpoint() ([]byte, error) {
+	return p.state, nil
+}
+
+func (p *checkpointProto) Resume(state []byte) error {
+	p.state = state
+	return nil
+}
+
+func TestServer_CheckpointProtocols(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(2, true)
+	server := servers[0]
+
+	pi, err := local.CreateProtocol(checkpointProtoName, tree)
+	require.NoError(t, err)
+	pi.(*checkpointProto).state = []byte("round 1")
+	// the pingpong protocol can't be resumed
+	pp, err := local.CreateProtocol(pingPongProtoName, tree)
+	require.NoError(t, err)
+	n, err := server.CheckpointProtocols()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.NoError(t, pp.Start())
+	<-pp.(*pingPongProto).done
+
+	// the instances are closed and created again, as by the next process
+	server.overlay.closeInstances()
+	tok := pi.Token().ID()
+	delete(server.overlay.instancesInfo, tok)
+	server.resumeProtocols()
+	require.Equal(t, 1, server.overlay.instancesCount())
+	resumed := server.overlay.protocolInstances[tok].(*checkpointProto)
+	require.Equal(t, []byte("round 1"), resumed.state)
+	require.NoError(t, server.serviceManager.store.View(func(tx StoreTx) error {
+		require.Nil(t, tx.Bucket(checkpointBucket))
+		return nil
+	}))
+
+	// the resumed instance gets the messages of the other conode
+	require.NoError(t, resumed.Start())
+	<-resumed.done
+}
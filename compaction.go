@@ -0,0 +1,339 @@
+package onet
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+// CompactionConfig schedules the compaction of the database of the services.
+// A bbolt file never shrinks: the space freed by deleted data is only reused
+// for new data. Compacting it copies the data to a new file, which replaces
+// the old one. The writes wait during the copy, and all accesses during the
+// replacement, which is why it is done in a quiet window.
+type CompactionConfig struct {
+	// Window is the daily period, in local time, during which the database
+	// is compacted once, e.g., "02:00-04:00". It may span midnight.
+	Window string
+	// MinFree is the fraction of the file that must be free for the
+	// compaction to be worth it. If it is 0, 0.25 is used.
+	MinFree float64 `toml:",omitempty"`
+}
+
+// compactionCheck is the interval between two checks of the window.
+var compactionCheck = time.Minute
+
+// quietWindow is a daily period, given by offsets from midnight.
+type quietWindow struct {
+	start, end time.Duration
+}
+
+// parseQuietWindow parses a window like "02:00-04:00".
+func parseQuietWindow(s string) (quietWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return quietWindow{}, xerrors.Errorf("window %q isn't start-end", s)
+	}
+	var w quietWindow
+	for i, p := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(p))
+		if err != nil {
+			return quietWindow{}, xerrors.Errorf("window %q: %v", s, err)
+		}
+		d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		if i == 0 {
+			w.start = d
+		} else {
+			w.end = d
+		}
+	}
+	if w.start == w.end {
+		return quietWindow{}, xerrors.Errorf("window %q is empty", s)
+	}
+	return w, nil
+}
+
+// contains returns whether t is in the window.
+func (w quietWindow) contains(t time.Time) bool {
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if w.start < w.end {
+		return d >= w.start && d < w.end
+	}
+	return d >= w.start || d < w.end
+}
+
+// length returns the duration of the window.
+func (w quietWindow) length() time.Duration {
+	if w.start < w.end {
+		return w.end - w.start
+	}
+	return 24*time.Hour - w.start + w.end
+}
+
+// compactionStats are reported in the status of the database.
+type compactionStats struct {
+	sync.Mutex
+	last      time.Time
+	reclaimed int64
+	err       error
+}
+
+// Compact copies the database of the services to a new file, which replaces
+// the old one, and returns the number of bytes reclaimed. Only the bbolt
+// backend needs it: for the others, it does nothing. It fails if a service
+// got the database with GetAdditionalBucket, as the service might still use
+// the old one.
+func (c *Server) Compact() (int64, error) {
+	return c.serviceManager.compact()
+}
+
+func (s *serviceManager) compact() (int64, error) {
+	bs, ok := unwrapStore(s.store).(*boltStore)
+	if !ok {
+		return 0, nil
+	}
+	reclaimed, err := bs.compact()
+	s.compaction.Lock()
+	s.compaction.last = time.Now()
+	s.compaction.reclaimed += reclaimed
+	s.compaction.err = err
+	s.compaction.Unlock()
+	if err != nil {
+		return 0, xerrors.Errorf("compacting: %v", err)
+	}
+	log.Lvlf2("Compacted the database, reclaiming %d bytes", reclaimed)
+	return reclaimed, nil
+}
+
+// statusFields adds the statistics of the compactions to the status.
+func (cs *compactionStats) statusFields(f map[string]string) {
+	cs.Lock()
+	defer cs.Unlock()
+	if cs.last.IsZero() {
+		return
+	}
+	f["Compaction.Last"] = cs.last.Format(time.RFC3339)
+	f["Compaction.Reclaimed"] = strconv.FormatInt(cs.reclaimed, 10)
+	if cs.err != nil {
+		f["Compaction.Error"] = cs.err.Error()
+	}
+}
+
+// freeFraction returns the fraction of the file holding no data.
+func (s *boltStore) freeFraction() float64 {
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	var size, free int64
+	s.db.View(func(tx *bbolt.Tx) error {
+		size = tx.Size()
+		free = int64(tx.DB().Stats().FreePageN) * int64(tx.DB().Info().PageSize)
+		return nil
+	})
+	if size == 0 {
+		return 0
+	}
+	return float64(free) / float64(size)
+}
+
+// compact copies the database to a new file and replaces the old file with
+// it. The writes wait during the copy, and all accesses during the
+// replacement.
+func (s *boltStore) compact() (int64, error) {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+	s.swap.RLock()
+	exposed := s.exposed
+	path := s.db.Path()
+	s.swap.RUnlock()
+	if exposed != "" {
+		return 0, xerrors.Errorf("service %s uses the bbolt database directly", exposed)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		return 0, xerrors.Errorf("stat: %v", err)
+	}
+
+	tmp := path + ".compact"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return 0, xerrors.Errorf("removing old copy: %v", err)
+	}
+	dst, err := openDb(tmp)
+	if err != nil {
+		return 0, err
+	}
+	// no write can happen, but the reads go on
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return copyBolt(dst, tx, compactionTxMaxSize)
+	})
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, xerrors.Errorf("copying: %v", err)
+	}
+
+	s.swap.Lock()
+	defer s.swap.Unlock()
+	if err := s.db.Close(); err != nil {
+		os.Remove(tmp)
+		return 0, xerrors.Errorf("closing: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		if s.db, err = openDb(path); err != nil {
+			return 0, xerrors.Errorf("reopening: %v", err)
+		}
+		return 0, xerrors.Errorf("replacing file: %v", err)
+	}
+	if s.db, err = openDb(path); err != nil {
+		return 0, xerrors.Errorf("reopening: %v", err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		return 0, xerrors.Errorf("stat: %v", err)
+	}
+	return before.Size() - after.Size(), nil
+}
+
+// compactionTxMaxSize is the number of bytes of keys and values copied in a
+// transaction when compacting, as the default of "bbolt compact". The copy
+// isn't synced before its last transaction.
+var compactionTxMaxSize int64 = 65536
+
+// copyBolt copies the buckets of src, with their sequences, to the empty
+// dst, committing a transaction every maxSize bytes. As the keys come in
+// order, the pages are filled completely.
+func copyBolt(dst *bbolt.DB, src *bbolt.Tx, maxSize int64) error {
+	dst.NoSync = true
+	tx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	var size int64
+	err = walkBolt(src, func(path [][]byte, k, v []byte, seq uint64) error {
+		if size += int64(len(k) + len(v)); size > maxSize {
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			if tx, err = dst.Begin(true); err != nil {
+				return err
+			}
+			size = int64(len(k) + len(v))
+		}
+		var parent interface {
+			CreateBucket([]byte) (*bbolt.Bucket, error)
+		} = tx
+		if len(path) > 0 {
+			b := tx.Bucket(path[0])
+			for _, name := range path[1:] {
+				b = b.Bucket(name)
+			}
+			b.FillPercent = 1
+			if v != nil {
+				return b.Put(k, v)
+			}
+			parent = b
+		}
+		b, err := parent.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return b.SetSequence(seq)
+	})
+	if err != nil {
+		if tx != nil {
+			tx.Rollback()
+		}
+		return err
+	}
+	dst.NoSync = false
+	return tx.Commit()
+}
+
+// walkBolt calls fn for every bucket and key/value pair of tx, with the
+// names of the buckets holding them. v is nil for a bucket, whose sequence
+// is seq.
+func walkBolt(tx *bbolt.Tx, fn func(path [][]byte, k, v []byte, seq uint64) error) error {
+	var walk func(path [][]byte, b *bbolt.Bucket) error
+	walk = func(path [][]byte, b *bbolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return fn(path, k, v, 0)
+			}
+			nested := b.Bucket(k)
+			if err := fn(path, k, nil, nested.Sequence()); err != nil {
+				return err
+			}
+			return walk(append(path[:len(path):len(path)], k), nested)
+		})
+	}
+	return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+		if err := fn(nil, name, nil, b.Sequence()); err != nil {
+			return err
+		}
+		return walk([][]byte{name}, b)
+	})
+}
+
+// compactionScheduler compacts the database once in every quiet window.
+type compactionScheduler struct {
+	window  quietWindow
+	minFree float64
+	stop    chan struct{}
+	closing sync.Once
+	stopped sync.WaitGroup
+}
+
+func newCompactionScheduler(cfg CompactionConfig) (*compactionScheduler, error) {
+	w, err := parseQuietWindow(cfg.Window)
+	if err != nil {
+		return nil, err
+	}
+	cs := &compactionScheduler{window: w, minFree: cfg.MinFree, stop: make(chan struct{})}
+	if cs.minFree <= 0 {
+		cs.minFree = 0.25
+	}
+	return cs, nil
+}
+
+func (cs *compactionScheduler) start(s *serviceManager) {
+	cs.stopped.Add(1)
+	go func() {
+		defer cs.stopped.Done()
+		var last time.Time
+		for {
+			select {
+			case <-cs.stop:
+				return
+			case <-time.After(compactionCheck):
+			}
+			now := time.Now()
+			if !cs.window.contains(now) || now.Sub(last) < cs.window.length() {
+				continue
+			}
+			last = now
+			bs, ok := unwrapStore(s.store).(*boltStore)
+			if !ok || bs.freeFraction() < cs.minFree {
+				continue
+			}
+			if _, err := s.compact(); err != nil {
+				log.Error("Scheduled compaction:", err)
+			}
+		}
+	}()
+}
+
+// close stops the scheduler, waiting for a running compaction. The server can
+// be closed several times.
+func (cs *compactionScheduler) close() {
+	cs.closing.Do(func() { close(cs.stop) })
+	cs.stopped.Wait()
+}
@@ -0,0 +1,133 @@
+package onet
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+	bbolt "go.etcd.io/bbolt"
+)
+
+func TestQuietWindow(t *testing.T) {
+	at := func(h, m int) time.Time {
+		return time.Date(2020, 1, 1, h, m, 0, 0, time.Local)
+	}
+	w, err := parseQuietWindow("02:00-04:30")
+	require.NoError(t, err)
+	require.True(t, w.contains(at(2, 0)))
+	require.True(t, w.contains(at(4, 29)))
+	require.False(t, w.contains(at(4, 30)))
+	require.False(t, w.contains(at(1, 59)))
+	require.Equal(t, 150*time.Minute, w.length())
+
+	w, err = parseQuietWindow("23:00 - 01:00")
+	require.NoError(t, err)
+	require.True(t, w.contains(at(23, 30)))
+	require.True(t, w.contains(at(0, 30)))
+	require.False(t, w.contains(at(12, 0)))
+	require.Equal(t, 2*time.Hour, w.length())
+
+	for _, s := range []string{"", "02:00", "02:00-02:00", "2am-4am"} {
+		_, err = parseQuietWindow(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestServer_Compact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compaction")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d time.Duration) { compactionCheck = d }(compactionCheck)
+	compactionCheck = 10 * time.Millisecond
+	// several transactions for the copy
+	defer func(s int64) { compactionTxMaxSize = s }(compactionTxMaxSize)
+	compactionTxMaxSize = 10000
+
+	// a window open now
+	now := time.Now()
+	window := fmt.Sprintf("%s-%s", now.Add(-time.Hour).Format("15:04"),
+		now.Add(time.Hour).Format("15:04"))
+	priv, id := NewPrivIdentity(tSuite, 0)
+	router, err := network.NewLocalRouter(id, tSuite)
+	require.NoError(t, err)
+	c := newServerWithOptions(tSuite, dir, router, priv,
+		ServerOptions{Compaction: &CompactionConfig{Window: window, MinFree: 0.9}})
+	defer c.Close()
+
+	// the sequences and the nested buckets are kept
+	bs := unwrapStore(c.serviceManager.store).(*boltStore)
+	require.NoError(t, bs.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		require.NoError(t, b.SetSequence(3))
+		n, err := b.CreateBucket([]byte("inner"))
+		if err != nil {
+			return err
+		}
+		require.NoError(t, n.SetSequence(5))
+		return n.Put([]byte("k"), []byte("v"))
+	}))
+
+	ctx := serviceContext(c, serviceWebSocket)
+	value := bytes.Repeat([]byte{1}, 1000)
+	require.NoError(t, ctx.UpdateAdditionalBucket([]byte("data"), func(b *QuotaBucket) error {
+		for i := 0; i < 1000; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("%04d", i)), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.NoError(t, ctx.UpdateAdditionalBucket([]byte("data"), func(b *QuotaBucket) error {
+		for i := 1; i < 1000; i++ {
+			if err := b.Delete([]byte(fmt.Sprintf("%04d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	// not enough free space for the scheduler
+	c.StartInBackground()
+	time.Sleep(10 * compactionCheck)
+	require.Empty(t, c.serviceManager.GetStatus().Field["Compaction.Last"])
+
+	reclaimed, err := c.Compact()
+	require.NoError(t, err)
+	require.True(t, reclaimed > 500000, reclaimed)
+	st := c.serviceManager.GetStatus().Field
+	require.NotEmpty(t, st["Compaction.Last"])
+	require.Equal(t, fmt.Sprint(reclaimed), st["Compaction.Reclaimed"])
+	require.NoError(t, ctx.ViewAdditionalBucket([]byte("data"), func(b StoreBucket) error {
+		require.Equal(t, value, b.Get([]byte("0000")))
+		require.Nil(t, b.Get([]byte("0001")))
+		return nil
+	}))
+	require.NoError(t, bs.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("nested"))
+		require.Equal(t, uint64(3), b.Sequence())
+		require.Equal(t, uint64(5), b.Bucket([]byte("inner")).Sequence())
+		require.Equal(t, []byte("v"), b.Bucket([]byte("inner")).Get([]byte("k")))
+		return nil
+	}))
+	_, err = os.Stat(c.serviceManager.dbFileName() + ".compact")
+	require.True(t, os.IsNotExist(err))
+
+	// the database can't be replaced once a service holds it
+	ctx.GetAdditionalBucket([]byte("raw"))
+	_, err = c.Compact()
+	require.Error(t, err)
+	require.NotEmpty(t, c.serviceManager.GetStatus().Field["Compaction.Error"])
+	require.Contains(t, c.serviceManager.GetStatus().Field["Compaction.Disabled"],
+		string(ctx.bucketName))
+
+	// closed again by the server
+	c.compaction.close()
+}
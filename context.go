@@ -2,7 +2,9 @@ package onet
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"fmt"
 	"sync"
 
 	"go.dedis.ch/onet/v3/log"
@@ -13,12 +15,18 @@ import (
 
 // Context represents the methods that are available to a service.
 type Context struct {
+	// how many JournalBatches have writes that aren't committed, first to
+	// be aligned for the atomic operations
+	openBatches       int64
 	overlay           *Overlay
 	server            *Server
 	serviceID         ServiceID
 	manager           *serviceManager
 	bucketName        []byte
 	bucketVersionName []byte
+	usage             *storageUsage
+	// trace contexts of the requests being processed
+	traces requestTraces
 }
 
 // defaultContext is the implementation of the Context interface. It is
@@ -31,8 +39,14 @@ func newContext(c *Server, o *Overlay, servID ServiceID, manager *serviceManager
 		manager:           manager,
 		bucketName:        []byte(ServiceFactory.Name(servID)),
 		bucketVersionName: []byte(ServiceFactory.Name(servID) + "version"),
+		usage:             &storageUsage{quota: c.storageQuotas[ServiceFactory.Name(servID)]},
 	}
-	err := manager.db.Update(func(tx *bbolt.Tx) error {
+	ctx.usage.notify = func(used, quota int64) {
+		c.events.publish(Event{Type: EventStorageWarning,
+			Service: ServiceFactory.Name(servID),
+			Message: fmt.Sprintf("%d of the %d bytes of the quota used", used, quota)})
+	}
+	err := manager.store.Update(func(tx StoreTx) error {
 		_, err := tx.CreateBucketIfNotExists(ctx.bucketName)
 		if err != nil {
 			return xerrors.Errorf("creating bucket: %v", err)
@@ -41,23 +55,48 @@ func newContext(c *Server, o *Overlay, servID ServiceID, manager *serviceManager
 		if err != nil {
 			return xerrors.Errorf("creating bucket: %v", err)
 		}
+		ctx.usage.set(serviceBucketsStats(tx, ctx.bucketName))
 		return nil
 	})
 	if err != nil {
 		log.Panic("Failed to create bucket: " + err.Error())
 	}
+	recovered, err := ctx.recoverJournal()
+	if err != nil {
+		log.Panic("Failed to apply journal: " + err.Error())
+	}
+	n, err := ctx.migrate()
+	if err != nil {
+		log.Panic("Failed to migrate data: " + err.Error())
+	}
+	if n > 0 || recovered > 0 {
+		if err := ctx.updateStorageUsage(); err != nil {
+			log.Error("Couldn't update storage usage:", err)
+		}
+	}
 	return ctx
 }
 
 // NewTreeNodeInstance creates a TreeNodeInstance that is bound to a
-// service instead of the Overlay.
+// service instead of the Overlay. When it is called while handling a client
+// request, the messages of the node are part of the span of the request.
 func (c *Context) NewTreeNodeInstance(t *Tree, tn *TreeNode, protoName string) *TreeNodeInstance {
 	io := c.overlay.protoIO.getByName(protoName)
-	return c.overlay.NewTreeNodeInstanceFromService(t, tn, ProtocolNameToID(protoName), c.serviceID, io)
+	tni := c.overlay.NewTreeNodeInstanceFromService(t, tn, ProtocolNameToID(protoName), c.serviceID, io)
+	if ctx := c.traces.current(); ctx != nil {
+		tni.SetTraceContext(ctx)
+	}
+	return tni
 }
 
 // SendRaw sends a message to the ServerIdentity.
 func (c *Context) SendRaw(si *network.ServerIdentity, msg interface{}) error {
+	if c.server.intercepted(si, msg, func(msg network.Message) error {
+		_, err := c.server.Send(si, msg)
+		return err
+	}) {
+		return nil
+	}
 	_, err := c.server.Send(si, msg)
 	if err != nil {
 		xerrors.Errorf("sending message: %v", err)
@@ -80,9 +119,30 @@ func (c *Context) ServiceID() ServiceID {
 	return c.serviceID
 }
 
-// CreateProtocol returns a ProtocolInstance bound to the service.
+// ServiceConfig returns the configuration of the service, as registered with
+// RegisterServiceConfig and filled in from the server configuration. It
+// returns nil if the service didn't register a configuration.
+func (c *Context) ServiceConfig() interface{} {
+	name := ServiceFactory.Name(c.serviceID)
+	if cfg, ok := c.server.serviceConfigs[name]; ok {
+		return cfg
+	}
+	return ServiceFactory.NewConfig(name)
+}
+
+// CreateProtocol returns a ProtocolInstance bound to the service. When it is
+// called while handling a client request, the protocol is part of the span of
+// the request. If the service processes concurrent requests, it should use
+// CreateProtocolWithContext instead.
 func (c *Context) CreateProtocol(name string, t *Tree) (ProtocolInstance, error) {
-	pi, err := c.overlay.CreateProtocol(name, t, c.serviceID)
+	return c.CreateProtocolWithContext(c.traces.current(), name, t)
+}
+
+// CreateProtocolWithContext returns a ProtocolInstance bound to the service,
+// whose messages are part of the span held by ctx, usually the context given
+// to the handler of the request.
+func (c *Context) CreateProtocolWithContext(ctx context.Context, name string, t *Tree) (ProtocolInstance, error) {
+	pi, err := c.overlay.createProtocol(ctx, name, t, c.serviceID)
 	if err != nil {
 		return nil, xerrors.Errorf("creating protocol: %v", err)
 	}
@@ -122,6 +182,11 @@ func (c *Context) RegisterStatusReporter(name string, s StatusReporter) {
 	c.server.statusReporterStruct.RegisterStatusReporter(name, s)
 }
 
+// RegisterMetricsCollector adds a collector to the /metrics endpoint.
+func (c *Context) RegisterMetricsCollector(name string, mc MetricsCollector) {
+	c.server.RegisterMetricsCollector(name, mc)
+}
+
 // RegisterProcessor overrides the RegisterProcessor methods of the Dispatcher.
 // It delegates the dispatching to the serviceManager.
 func (c *Context) RegisterProcessor(p network.Processor, msgType network.MessageTypeID) {
@@ -166,27 +231,19 @@ type ContextDB interface {
 // Save takes a key and an interface. The interface will be network.Marshal'ed
 // and saved in the database under the bucket named after the service name.
 //
-// The data will be stored in a different bucket for every service.
+// The data will be stored in a different bucket for every service. If the
+// service has a storage quota and the data doesn't fit, an error wrapping
+// ErrStorageQuotaExceeded is returned. Every call is a transaction of its own:
+// services writing many keys at once use Update instead.
 func (c *Context) Save(key []byte, data interface{}) error {
-	buf, err := network.Marshal(data)
-	if err != nil {
-		return xerrors.Errorf("marshaling: %v", err)
-	}
-	err = c.manager.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(c.bucketName)
-		return b.Put(key, buf)
-	})
-	if err != nil {
-		return xerrors.Errorf("tx error: %v", err)
-	}
-	return nil
+	return c.SaveWithTTL(key, data, 0)
 }
 
 // Load takes a key and returns the network.Unmarshaled data.
 // Returns a nil value if the key does not exist.
 func (c *Context) Load(key []byte) (interface{}, error) {
 	var buf []byte
-	err := c.manager.db.View(func(tx *bbolt.Tx) error {
+	err := c.manager.store.View(func(tx StoreTx) error {
 		v := tx.Bucket(c.bucketName).Get(key)
 		if v == nil {
 			return nil
@@ -216,7 +273,7 @@ func (c *Context) Load(key []byte) (interface{}, error) {
 // Returns a nil value if the key does not exist.
 func (c *Context) LoadRaw(key []byte) ([]byte, error) {
 	var buf []byte
-	err := c.manager.db.View(func(tx *bbolt.Tx) error {
+	err := c.manager.store.View(func(tx StoreTx) error {
 		v := tx.Bucket(c.bucketName).Get(key)
 		if v == nil {
 			return nil
@@ -238,7 +295,7 @@ var dbVersion = []byte("dbVersion")
 // no version has been found.
 func (c *Context) LoadVersion() (int, error) {
 	var buf []byte
-	err := c.manager.db.View(func(tx *bbolt.Tx) error {
+	err := c.manager.store.View(func(tx StoreTx) error {
 		v := tx.Bucket(c.bucketVersionName).Get(dbVersion)
 		if v == nil {
 			return nil
@@ -271,7 +328,7 @@ func (c *Context) SaveVersion(version int) error {
 	if err != nil {
 		return xerrors.Errorf("int to bytes: %v", err)
 	}
-	err = c.manager.db.Update(func(tx *bbolt.Tx) error {
+	err = c.manager.store.Update(func(tx StoreTx) error {
 		b := tx.Bucket(c.bucketVersionName)
 		return b.Put(dbVersion, buf.Bytes())
 	})
@@ -288,13 +345,46 @@ func (c *Context) SaveVersion(version int) error {
 // This function should only be used if the Load and Save functions are not sufficient.
 // Additionally, the user should not create buckets directly on the DB but always
 // call this function to create new buckets to avoid bucket name conflicts.
+//
+// Writes done directly in the returned database are not checked against the
+// storage quota of the service: they are only accounted for when the buckets
+// are scanned, at startup and for the status. Use UpdateAdditionalBucket for
+// writes that must respect the quota.
+//
+// It is only available with the bbolt storage backend, without
+// StorageEncryption and StorageIntegrity, as a service writing directly would
+// bypass them: with another configuration, it panics, making the conode fail
+// when the service starts. The services supporting all the configurations use
+// ViewAdditionalBucket and UpdateAdditionalBucket instead. Once a service got
+// the database, it can't be compacted anymore.
 func (c *Context) GetAdditionalBucket(name []byte) (*bbolt.DB, []byte) {
+	bs, ok := c.manager.store.(*boltStore)
+	if !ok {
+		log.Panicf("Service %s uses GetAdditionalBucket, which needs the bbolt "+
+			"storage backend without StorageEncryption and StorageIntegrity",
+			c.bucketName)
+	}
+	fullName, err := c.additionalBucket(name)
+	if err != nil {
+		panic(xerrors.Errorf("tx error: %v", err))
+	}
+	return bs.exposeDB(string(c.bucketName)), fullName
+}
+
+// additionalBucketName returns the full name of the additional bucket with
+// the given name.
+func (c *Context) additionalBucketName(name []byte) []byte {
 	// make a copy to insure c.bucketName is not written
 	bucketName := make([]byte, len(c.bucketName))
 	copy(bucketName, c.bucketName)
+	return append(append(bucketName, byte('_')), name...)
+}
 
-	fullName := append(append(bucketName, byte('_')), name...)
-	err := c.manager.db.Update(func(tx *bbolt.Tx) error {
+// additionalBucket creates the additional bucket with the given name, if
+// needed, and returns its full name.
+func (c *Context) additionalBucket(name []byte) ([]byte, error) {
+	fullName := c.additionalBucketName(name)
+	err := c.manager.store.Update(func(tx StoreTx) error {
 		_, err := tx.CreateBucketIfNotExists(fullName)
 		if err != nil {
 			return xerrors.Errorf("create bucket: %v", err)
@@ -302,7 +392,33 @@ func (c *Context) GetAdditionalBucket(name []byte) (*bbolt.DB, []byte) {
 		return nil
 	})
 	if err != nil {
-		panic(xerrors.Errorf("tx error: %v", err))
+		return nil, err
+	}
+	return fullName, nil
+}
+
+var errBucketMissing = xerrors.New("bucket missing")
+
+// ViewAdditionalBucket calls fn in a read-only transaction on the additional
+// bucket with the given name, created if needed as with GetAdditionalBucket.
+// It works with all the storage backends.
+func (c *Context) ViewAdditionalBucket(name []byte, fn func(b StoreBucket) error) error {
+	fullName := c.additionalBucketName(name)
+	view := func(tx StoreTx) error {
+		b := tx.Bucket(fullName)
+		if b == nil {
+			return errBucketMissing
+		}
+		return fn(b)
 	}
-	return c.manager.db, fullName
+	err := c.manager.store.View(view)
+	if xerrors.Is(err, errBucketMissing) {
+		if _, err = c.additionalBucket(name); err == nil {
+			err = c.manager.store.View(view)
+		}
+	}
+	if err != nil {
+		return xerrors.Errorf("tx error: %w", err)
+	}
+	return nil
 }
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/kyber/v3/util/key"
@@ -115,6 +116,206 @@ func TestContext_GetAdditionalBucket(t *testing.T) {
 	require.Equal(t, "testService_new", string(name))
 }
 
+func TestContext_StorageQuota(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conode")
+	log.ErrFatal(err)
+	defer os.RemoveAll(tmp)
+
+	network.RegisterMessage(ContextData{})
+	c := createContext(t, tmp)
+	used, quota := c.StorageUsage()
+	require.Equal(t, int64(0), used)
+	require.Equal(t, int64(0), quota)
+
+	cd := &ContextData{42, "meaning of life"}
+	buf, err := network.Marshal(cd)
+	require.NoError(t, err)
+	size := int64(len("a") + len(buf))
+	c.usage.quota = 2 * size
+
+	var warned int64
+	c.SetStorageWarning(func(used, quota int64) {
+		warned = used
+	})
+	events, unsubscribe := c.Subscribe(EventStorageWarning)
+	defer unsubscribe()
+	require.NoError(t, c.Save([]byte("a"), cd))
+	require.Equal(t, int64(0), warned)
+	used, _ = c.StorageUsage()
+	require.Equal(t, size, used)
+	// overwriting a key doesn't use more space
+	require.NoError(t, c.Save([]byte("a"), cd))
+	require.NoError(t, c.Save([]byte("b"), cd))
+	require.Equal(t, 2*size, warned)
+	require.Len(t, events, 1)
+	ev := <-events
+	require.Equal(t, "testService", ev.Service)
+	require.Contains(t, ev.Message, fmt.Sprintf("%d of the %d bytes", 2*size, 2*size))
+
+	err = c.Save([]byte("c"), cd)
+	require.Error(t, err)
+	require.True(t, xerrors.Is(err, ErrStorageQuotaExceeded))
+	used, _ = c.StorageUsage()
+	require.Equal(t, 2*size, used)
+	ret, err := c.Load([]byte("c"))
+	require.NoError(t, err)
+	require.Nil(t, ret)
+
+	// data in additional buckets is accounted for when scanning
+	db, name := c.GetAdditionalBucket([]byte("extra"))
+	require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(name).Put([]byte("k"), []byte("v"))
+	}))
+	require.NoError(t, c.updateStorageUsage())
+	used, _ = c.StorageUsage()
+	require.Equal(t, 2*size+2, used)
+
+	// the buckets of testService_other are not counted
+	other := "testService_other"
+	_, err = RegisterNewService(other, func(c *Context) (Service, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+	defer UnregisterService(other)
+	require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(other))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("k"), []byte("v"))
+	}))
+	require.NoError(t, c.updateStorageUsage())
+	used, _ = c.StorageUsage()
+	require.Equal(t, 2*size+2, used)
+
+	// writes through UpdateAdditionalBucket respect the quota
+	c.usage.quota = used + 4
+	require.NoError(t, c.UpdateAdditionalBucket([]byte("extra"), func(b *QuotaBucket) error {
+		return b.Put([]byte("k2"), []byte("v2"))
+	}))
+	err = c.UpdateAdditionalBucket([]byte("extra"), func(b *QuotaBucket) error {
+		return b.Put([]byte("k3"), []byte("v3"))
+	})
+	require.True(t, xerrors.Is(err, ErrStorageQuotaExceeded))
+	require.NoError(t, c.UpdateAdditionalBucket([]byte("extra"), func(b *QuotaBucket) error {
+		require.NoError(t, b.Delete([]byte("k2")))
+		return b.Put([]byte("k3"), []byte("v3"))
+	}))
+	// a failed transaction gives back its space
+	err = c.UpdateAdditionalBucket([]byte("extra"), func(b *QuotaBucket) error {
+		require.NoError(t, b.Delete([]byte("k3")))
+		require.NoError(t, b.Put([]byte("k4"), []byte("v4")))
+		return xerrors.New("abort")
+	})
+	require.Error(t, err)
+	used2, _ := c.StorageUsage()
+	require.Equal(t, used+4, used2)
+	require.NoError(t, c.updateStorageUsage())
+	used2, _ = c.StorageUsage()
+	require.Equal(t, used+4, used2)
+}
+
+func TestContext_Update(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conode")
+	log.ErrFatal(err)
+	defer os.RemoveAll(tmp)
+
+	network.RegisterMessage(ContextData{})
+	c := createContext(t, tmp)
+	require.NoError(t, c.Update(func(tx *ServiceTx) error {
+		for i := int64(0); i < 100; i++ {
+			cd := &ContextData{i, "bulk"}
+			if err := tx.Save([]byte(fmt.Sprint(i)), cd); err != nil {
+				return err
+			}
+		}
+		// the writes are visible in the transaction
+		msg, err := tx.Load([]byte("42"))
+		require.NoError(t, err)
+		require.Equal(t, int64(42), msg.(*ContextData).I)
+		require.NoError(t, tx.Delete([]byte("0")))
+		b, err := tx.AdditionalBucket([]byte("extra"))
+		require.NoError(t, err)
+		return b.Put([]byte("k"), []byte("v"))
+	}))
+	msg, err := c.Load([]byte("99"))
+	require.NoError(t, err)
+	require.Equal(t, int64(99), msg.(*ContextData).I)
+	msg, err = c.Load([]byte("0"))
+	require.NoError(t, err)
+	require.Nil(t, msg)
+	st, err := c.storageStats()
+	require.NoError(t, err)
+	require.Equal(t, int64(102), st.writes)
+	require.Equal(t, int64(100), st.keys)
+	used, _ := c.StorageUsage()
+	require.NoError(t, c.updateStorageUsage())
+	used2, _ := c.StorageUsage()
+	require.Equal(t, used2, used)
+
+	// a transaction going over the quota keeps nothing
+	c.usage.quota = used + 100
+	err = c.Update(func(tx *ServiceTx) error {
+		for i := 0; i < 100; i++ {
+			if err := tx.Save([]byte(fmt.Sprint("new", i)), &ContextData{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.True(t, xerrors.Is(err, ErrStorageQuotaExceeded))
+	used2, _ = c.StorageUsage()
+	require.Equal(t, used, used2)
+	msg, err = c.Load([]byte("new0"))
+	require.NoError(t, err)
+	require.Nil(t, msg)
+}
+
+func TestContext_StorageStats(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conode")
+	log.ErrFatal(err)
+	defer os.RemoveAll(tmp)
+
+	network.RegisterMessage(ContextData{})
+	c := createContext(t, tmp)
+	cd := &ContextData{42, "meaning of life"}
+	require.NoError(t, c.Save([]byte("a"), cd))
+	require.NoError(t, c.Save([]byte("a"), cd))
+	require.NoError(t, c.UpdateAdditionalBucket([]byte("extra"), func(b *QuotaBucket) error {
+		require.NoError(t, b.Put([]byte("k1"), []byte("v1")))
+		require.NoError(t, b.Put([]byte("k2"), []byte("v2")))
+		return b.Delete([]byte("k1"))
+	}))
+	st, err := c.storageStats()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), st.keys)
+	require.Equal(t, int64(5), st.writes)
+	require.Equal(t, 5.0/storageRateWindow, st.writeRate)
+
+	// a failed transaction doesn't count
+	require.Error(t, c.UpdateAdditionalBucket([]byte("extra"), func(b *QuotaBucket) error {
+		require.NoError(t, b.Put([]byte("k3"), []byte("v3")))
+		return xerrors.New("abort")
+	}))
+	st, err = c.storageStats()
+	require.NoError(t, err)
+	require.Equal(t, int64(5), st.writes)
+
+	// the scan counts the keys and the pages
+	require.NoError(t, c.updateStorageUsage())
+	st, err = c.storageStats()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), st.keys)
+	require.True(t, st.disk >= st.used, "%d < %d", st.disk, st.used)
+
+	var r writeRate
+	now := time.Now()
+	r.add(now.Add(-2*storageRateWindow*time.Second), 100)
+	r.add(now.Add(-time.Second), 30)
+	r.add(now, 30)
+	require.Equal(t, 60.0/storageRateWindow, r.perSecond(now))
+}
+
 func TestContext_Path(t *testing.T) {
 	tmp, err := ioutil.TempDir("", "conode")
 	log.ErrFatal(err)
@@ -155,6 +356,7 @@ func createContext(t *testing.T, dbPath string) *Context {
 		Router: &network.Router{
 			ServerIdentity: si,
 		},
+		events: newEventBus(),
 	}
 
 	name := "testService"
@@ -178,7 +380,7 @@ func createContext(t *testing.T, dbPath string) *Context {
 		return nil
 	})
 	require.Nil(t, err)
-	sm.db = db
+	sm.store = &boltStore{db: db}
 
 	return newContext(cn, nil, ServiceFactory.ServiceID(name), sm)
 }
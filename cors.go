@@ -0,0 +1,149 @@
+package onet
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig describes which browser origins may use the HTTP and websocket
+// API of a conode. A nil CORSConfig allows all origins, which is the
+// historical behaviour.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins, like "https://example.com", that
+	// may access the API. "*" allows all origins.
+	AllowedOrigins []string
+	// AllowedMethods lists the methods allowed in cross-origin requests.
+	// If empty, GET and POST are allowed.
+	AllowedMethods []string
+	// AllowedHeaders lists the request headers allowed in cross-origin
+	// requests.
+	AllowedHeaders []string
+	// AllowCredentials lets the browser send cookies and other credentials.
+	AllowCredentials bool
+	// MaxAge is the number of seconds the browser may cache the answer to
+	// a preflight request.
+	MaxAge int
+}
+
+var defaultCORSMethods = []string{"GET", "POST"}
+
+// allowOrigin returns whether a request from this origin is allowed. Requests
+// without an origin don't come from a browser and are always allowed.
+func (c *CORSConfig) allowOrigin(origin string) bool {
+	if c == nil || origin == "" {
+		return true
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOrigin returns whether the request comes from the conode itself, like
+// the requests of the Go client which sends the address of the conode as
+// origin. These requests aren't cross-origin and are always allowed.
+func sameOrigin(r *http.Request) bool {
+	u, err := url.Parse(r.Header.Get("Origin"))
+	if err != nil {
+		return false
+	}
+	return u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+func (c *CORSConfig) methods() []string {
+	if len(c.AllowedMethods) == 0 {
+		return defaultCORSMethods
+	}
+	return c.AllowedMethods
+}
+
+func (c *CORSConfig) allowMethod(method string) bool {
+	for _, m := range c.methods() {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin can be used as websocket.Upgrader.CheckOrigin. Browsers don't
+// apply CORS to websockets, so the origin has to be checked by the server.
+func (c *CORSConfig) checkOrigin(r *http.Request) bool {
+	return sameOrigin(r) || c.allowOrigin(r.Header.Get("Origin"))
+}
+
+// handler wraps h so that cross-origin requests are answered according to
+// the configuration, including preflight requests.
+func (c *CORSConfig) handler(h http.Handler) http.Handler {
+	if c == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || sameOrigin(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !c.allowOrigin(origin) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		allowed := origin
+		if !c.AllowCredentials {
+			for _, o := range c.AllowedOrigins {
+				if o == "*" {
+					allowed = "*"
+				}
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if c.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		reqMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != http.MethodOptions || reqMethod == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		// preflight request
+		if !c.allowMethod(reqMethod) {
+			http.Error(w, "method not allowed", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.methods(), ", "))
+		if len(c.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers",
+				strings.Join(c.AllowedHeaders, ", "))
+		}
+		if c.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// SetCORS sets the CORS policy of the websocket. The policy of a service
+// overrides the default one for the endpoints of that service. It must be
+// called before the services are registered.
+func (w *WebSocket) SetCORS(def *CORSConfig, services map[string]*CORSConfig) {
+	w.Lock()
+	defer w.Unlock()
+	w.cors = def
+	w.serviceCORS = services
+}
+
+// corsFor returns the CORS policy of the service.
+func (w *WebSocket) corsFor(service string) *CORSConfig {
+	w.Lock()
+	defer w.Unlock()
+	if c, ok := w.serviceCORS[service]; ok {
+		return c
+	}
+	return w.cors
+}
@@ -0,0 +1,105 @@
+package onet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORSConfig_Handler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	cors := &CORSConfig{
+		AllowedOrigins: []string{"https://dapp.example"},
+		AllowedHeaders: []string{"Content-Type"},
+		MaxAge:         60,
+	}
+	h := cors.handler(ok)
+
+	do := func(method, origin, reqMethod string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/v3/test/resource", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if reqMethod != "" {
+			r.Header.Set("Access-Control-Request-Method", reqMethod)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+
+	// not from a browser
+	rr := do("GET", "", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	rr = do("GET", "https://dapp.example", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "https://dapp.example", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	rr = do("GET", "https://evil.example", "")
+	require.Equal(t, http.StatusForbidden, rr.Code)
+
+	// same origin as the request, which is sent to example.com
+	rr = do("GET", "http://example.com", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	rr = do("OPTIONS", "https://dapp.example", "POST")
+	require.Equal(t, http.StatusNoContent, rr.Code)
+	require.Equal(t, "GET, POST", rr.Header().Get("Access-Control-Allow-Methods"))
+	require.Equal(t, "Content-Type", rr.Header().Get("Access-Control-Allow-Headers"))
+	require.Equal(t, "60", rr.Header().Get("Access-Control-Max-Age"))
+
+	rr = do("OPTIONS", "https://dapp.example", "DELETE")
+	require.Equal(t, http.StatusForbidden, rr.Code)
+
+	cors = &CORSConfig{AllowedOrigins: []string{"*"}}
+	h = cors.handler(ok)
+	rr = do("GET", "https://any.example", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	// no policy allows everything
+	require.True(t, (*CORSConfig)(nil).allowOrigin("https://any.example"))
+}
+
+func TestWebSocket_CORS(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(1)
+
+	w := servers[0].WebSocket
+	w.SetCORS(nil, map[string]*CORSConfig{
+		"corsTest": {AllowedOrigins: []string{"https://dapp.example"}},
+	})
+	require.NoError(t, w.registerService("corsTest", &DummyService3{}))
+	srv := httptest.NewServer(w.mux)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/corsTest/path"
+
+	conn, _, err := websocket.DefaultDialer.Dial(url,
+		http.Header{"Origin": []string{"https://dapp.example"}})
+	require.NoError(t, err)
+	conn.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial(url,
+		http.Header{"Origin": []string{"https://evil.example"}})
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// the Go client sends the address of the conode as origin
+	w.SetCORS(&CORSConfig{AllowedOrigins: []string{"https://dapp.example"}}, nil)
+	require.NoError(t, w.registerService("corsClient", &DummyService3{}))
+	client := NewClient(tSuite, "corsClient")
+	defer client.Close()
+	require.NoError(t, client.SendProtobuf(servers[0].ServerIdentity, &SimpleResponse{}, nil))
+	dst := *servers[0].ServerIdentity
+	dst.URL = srv.URL
+	require.NoError(t, client.SendProtobuf(&dst, &SimpleResponse{}, nil))
+}
@@ -0,0 +1,250 @@
+package onet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// CrashConfig writes a report of every panic recovered in the goroutines of
+// the protocol instances and in the handlers of the services. The panics are
+// counted on /metrics even without it.
+type CrashConfig struct {
+	// Dir is the directory receiving the reports, one JSON file by panic.
+	Dir string
+	// MaxReports is the number of reports kept in Dir, the oldest ones being
+	// removed, 100 by default.
+	MaxReports int `toml:",omitempty"`
+}
+
+// CrashReport is the report of a panic recovered by the conode.
+type CrashReport struct {
+	Time time.Time
+	// Conode is the address of the conode.
+	Conode string
+	// Where is the part of the conode that panicked, like
+	// "protocol.Dispatch" or "service.request".
+	Where string
+	// Panic is the value given to panic.
+	Panic string
+	// Stack of the goroutine that panicked.
+	Stack string
+	// Token of the protocol instance that panicked, if any.
+	Token *Token `json:",omitempty"`
+	// Messages are the last ones received by the protocol instance, the
+	// oldest first.
+	Messages []CrashMessage `json:",omitempty"`
+	// Fields are the fields of the log of the protocol instance or the
+	// request, like the protocol, the round and the service, and the request
+	// of the service.
+	Fields map[string]string `json:",omitempty"`
+}
+
+// CrashMessage is a message received by a protocol instance before a panic.
+type CrashMessage struct {
+	Time time.Time
+	Type string
+	// From is the address of the conode that sent the message.
+	From string
+	Size int
+}
+
+// crashMessages is the number of messages of a protocol instance kept for
+// the crash reports.
+const crashMessages = 10
+
+// panicError is the error of a panic recovered in a handler, with the stack
+// of the goroutine that panicked.
+type panicError struct {
+	value interface{}
+	stack string
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// crashReporter counts the panics and writes their reports.
+type crashReporter struct {
+	sync.Mutex
+	conode string
+	cfg    CrashConfig
+	// panics by part of the conode
+	panics map[string]uint64
+	// reporter and sentry receive the panics, if not nil
+	reporter ErrorReporter
+	sentry   *SentryReporter
+}
+
+func newCrashReporter(conode string, cfg *CrashConfig) (*crashReporter, error) {
+	cr := &crashReporter{conode: conode, panics: make(map[string]uint64)}
+	if cfg != nil {
+		cr.cfg = *cfg
+		if cr.cfg.MaxReports <= 0 {
+			cr.cfg.MaxReports = 100
+		}
+		if err := os.MkdirAll(cr.cfg.Dir, 0750); err != nil {
+			return nil, xerrors.Errorf("crash reports: %v", err)
+		}
+	}
+	return cr, nil
+}
+
+// report counts the panic, writes its report, with the fields of the log
+// added, and forwards it to the error reporters.
+func (cr *crashReporter) report(rep *CrashReport, fields ...log.Field) {
+	if cr == nil {
+		return
+	}
+	rep.Time = time.Now()
+	rep.Conode = cr.conode
+	for _, f := range fields {
+		if rep.Fields == nil {
+			rep.Fields = make(map[string]string)
+		}
+		if _, ok := rep.Fields[f.Key]; !ok {
+			rep.Fields[f.Key] = fmt.Sprint(f.Value)
+		}
+	}
+
+	cr.Lock()
+	defer cr.Unlock()
+	cr.panics[rep.Where]++
+	if cr.reporter != nil || cr.sentry != nil {
+		ev := crashEvent(rep)
+		if cr.reporter != nil {
+			cr.reporter.ReportError(ev)
+		}
+		if cr.sentry != nil {
+			cr.sentry.ReportError(ev)
+		}
+	}
+	if cr.cfg.Dir == "" {
+		return
+	}
+	buf, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		log.Error("Couldn't encode the crash report:", err)
+		return
+	}
+	name := filepath.Join(cr.cfg.Dir, fmt.Sprintf("crash-%s-%s.json",
+		rep.Time.UTC().Format("20060102T150405.000000000"),
+		strings.Replace(rep.Where, ".", "-", -1)))
+	if err := ioutil.WriteFile(name, buf, 0600); err != nil {
+		log.Error("Couldn't write the crash report:", err)
+		return
+	}
+	log.Error("Wrote the crash report", name)
+	cr.prune()
+}
+
+// prune removes the oldest reports beyond the maximum.
+func (cr *crashReporter) prune() {
+	names, err := filepath.Glob(filepath.Join(cr.cfg.Dir, "crash-*.json"))
+	if err != nil || len(names) <= cr.cfg.MaxReports {
+		return
+	}
+	// the names start with the time of the report
+	sort.Strings(names)
+	for _, name := range names[:len(names)-cr.cfg.MaxReports] {
+		if err := os.Remove(name); err != nil {
+			log.Warn("Couldn't remove the crash report:", err)
+		}
+	}
+}
+
+// counts returns the number of panics by part of the conode.
+func (cr *crashReporter) counts() map[string]uint64 {
+	cr.Lock()
+	defer cr.Unlock()
+	counts := make(map[string]uint64)
+	for where, n := range cr.panics {
+		counts[where] = n
+	}
+	return counts
+}
+
+// reportPanic reports the panic recovered as r in the part of the protocol
+// instance of the token given by where.
+func (o *Overlay) reportPanic(where string, tok *Token, r interface{}) {
+	o.instancesLock.Lock()
+	tni := o.instances[tok.ID()]
+	o.instancesLock.Unlock()
+	if tni != nil {
+		tni.reportPanic(where, r)
+		return
+	}
+	o.server.crashes.report(&CrashReport{Where: where, Panic: fmt.Sprint(r),
+		Stack: log.Stack(), Token: tok},
+		logFields(o.protocolName(tok.ProtoID), tok)...)
+	o.protocolEvent(EventProtocolFailed, tok, xerrors.Errorf("panic in %s: %v", where, r))
+}
+
+// reportPanic reports the panic recovered as r in the part of the protocol
+// instance given by where, with the messages it received last.
+func (n *TreeNodeInstance) reportPanic(where string, r interface{}) {
+	n.overlay.server.crashes.report(&CrashReport{Where: where,
+		Panic: fmt.Sprint(r), Stack: log.Stack(), Token: n.token,
+		Messages: n.recentMessages()}, n.LogFields()...)
+	n.protocolEvent(EventProtocolFailed, xerrors.Errorf("panic in %s: %v", where, r))
+}
+
+// reportRequestPanic reports the panic of a request to a service, recovered
+// as r or returned by the handler as a panicError.
+func (cr *crashReporter) reportRequestPanic(service, path string, r interface{},
+	err error) {
+	rep := &CrashReport{Where: "service.request",
+		Fields: map[string]string{"service": service, "request": path}}
+	var pe *panicError
+	switch {
+	case r != nil:
+		rep.Panic = fmt.Sprint(r)
+		rep.Stack = log.Stack()
+	case xerrors.As(err, &pe):
+		rep.Panic = fmt.Sprint(pe.value)
+		rep.Stack = pe.stack
+	default:
+		return
+	}
+	cr.report(rep)
+}
+
+// recordMessage keeps the message for the crash reports.
+func (n *TreeNodeInstance) recordMessage(msg *ProtocolMsg) {
+	cm := CrashMessage{Time: time.Now(), Type: msg.MsgType.String(),
+		Size: int(msg.Size)}
+	if msg.Msg != nil {
+		t := reflect.TypeOf(msg.Msg)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		cm.Type = t.String()
+	}
+	if msg.ServerIdentity != nil {
+		cm.From = msg.ServerIdentity.Address.String()
+	}
+	n.recentMutex.Lock()
+	defer n.recentMutex.Unlock()
+	if len(n.recent) >= crashMessages {
+		n.recent = n.recent[1:]
+	}
+	n.recent = append(n.recent, cm)
+}
+
+// recentMessages returns the last messages received by the protocol
+// instance, the oldest first.
+func (n *TreeNodeInstance) recentMessages() []CrashMessage {
+	n.recentMutex.Lock()
+	defer n.recentMutex.Unlock()
+	return append([]CrashMessage(nil), n.recent...)
+}
@@ -0,0 +1,160 @@
+package onet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func init() {
+	GlobalProtocolRegister("ProtocolHandlerPanic", func(n *TreeNodeInstance) (ProtocolInstance, error) {
+		p := &protocolHandlerPanic{TreeNodeInstance: n}
+		return p, p.RegisterHandler(p.handle)
+	})
+}
+
+// protocolHandlerPanic panics in the handler of the message sent by the root
+// to its children.
+type protocolHandlerPanic struct {
+	*TreeNodeInstance
+}
+
+func (p *protocolHandlerPanic) Start() error {
+	return p.SendToChildren(&DummyMsg{A: 1})
+}
+
+func (p *protocolHandlerPanic) handle(msg WrapDummyMsg) error {
+	p.Done()
+	panic("handler panic")
+}
+
+func readCrashReports(t *testing.T, dir string) []CrashReport {
+	names, err := filepath.Glob(filepath.Join(dir, "crash-*.json"))
+	require.NoError(t, err)
+	var reps []CrashReport
+	for _, name := range names {
+		buf, err := ioutil.ReadFile(name)
+		require.NoError(t, err)
+		var rep CrashReport
+		require.NoError(t, json.Unmarshal(buf, &rep))
+		reps = append(reps, rep)
+	}
+	return reps
+}
+
+func TestCrash_ProtocolHandler(t *testing.T) {
+	log.OutputToBuf()
+	defer log.OutputToOs()
+
+	dir, err := ioutil.TempDir("", "crash")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+
+	servers, _, tree := local.GenTree(2, true)
+	child := servers[1]
+	child.crashes, err = newCrashReporter(child.ServerIdentity.Address.String(),
+		&CrashConfig{Dir: dir})
+	require.NoError(t, err)
+
+	pi, err := servers[0].CreateProtocol("ProtocolHandlerPanic", tree)
+	require.NoError(t, err)
+	require.NoError(t, pi.Start())
+	defer pi.(*protocolHandlerPanic).Done()
+
+	var reps []CrashReport
+	require.Eventually(t, func() bool {
+		reps = readCrashReports(t, dir)
+		return len(reps) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	rep := reps[0]
+	require.Equal(t, "protocol.handler", rep.Where)
+	require.Equal(t, "handler panic", rep.Panic)
+	require.Equal(t, child.ServerIdentity.Address.String(), rep.Conode)
+	require.Contains(t, rep.Stack, "crash_test.go")
+	require.NotNil(t, rep.Token)
+	require.Equal(t, pi.Token().RoundID, rep.Token.RoundID)
+	require.Len(t, rep.Messages, 1)
+	require.Equal(t, "onet.DummyMsg", rep.Messages[0].Type)
+	require.Equal(t, servers[0].ServerIdentity.Address.String(), rep.Messages[0].From)
+	require.Equal(t, map[string]uint64{"protocol.handler": 1}, child.crashes.counts())
+}
+
+func TestCrash_ServiceRequest(t *testing.T) {
+	log.OutputToBuf()
+	defer log.OutputToOs()
+
+	dir, err := ioutil.TempDir("", "crash")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	s := newTCPServer(tSuite, 0, local.path, false,
+		ServerOptions{Crash: &CrashConfig{Dir: dir}})
+	s.StartInBackground()
+	defer s.Close()
+
+	client := NewClient(tSuite, testServiceName)
+	defer client.Close()
+	err = client.SendProtobuf(s.ServerIdentity, &testPanicMsg{}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "deadbeef")
+
+	reps := readCrashReports(t, dir)
+	require.Len(t, reps, 1)
+	require.Equal(t, "service.request", reps[0].Where)
+	require.Equal(t, "deadbeef", reps[0].Panic)
+	require.Equal(t, testServiceName, reps[0].Fields["service"])
+	require.Equal(t, "testPanicMsg", reps[0].Fields["request"])
+	require.Contains(t, reps[0].Stack, "ProcessMsgPanic")
+
+	metrics := s.coreMetrics()
+	var found bool
+	for _, m := range metrics {
+		if m.Name == "onet_panics_total" && m.Labels["where"] == "service.request" {
+			require.Equal(t, float64(1), m.Value)
+			found = true
+		}
+	}
+	require.True(t, found)
+}
+
+func TestCrash_Prune(t *testing.T) {
+	log.OutputToBuf()
+	defer log.OutputToOs()
+
+	dir, err := ioutil.TempDir("", "crash")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cr, err := newCrashReporter("conode", &CrashConfig{Dir: dir, MaxReports: 2})
+	require.NoError(t, err)
+	for _, where := range []string{"a", "b", "c"} {
+		cr.report(&CrashReport{Where: where})
+	}
+	reps := readCrashReports(t, dir)
+	require.Len(t, reps, 2)
+	require.Equal(t, "b", reps[0].Where)
+	require.Equal(t, "c", reps[1].Where)
+	require.Equal(t, map[string]uint64{"a": 1, "b": 1, "c": 1}, cr.counts())
+
+	// the panics are counted without a directory
+	cr, err = newCrashReporter("conode", nil)
+	require.NoError(t, err)
+	cr.report(&CrashReport{Where: "a"})
+	require.Equal(t, map[string]uint64{"a": 1}, cr.counts())
+
+	// a server without a reporter ignores the panics
+	var nilReporter *crashReporter
+	nilReporter.report(&CrashReport{Where: "a"})
+}
@@ -0,0 +1,265 @@
+package onet
+
+import (
+	"crypto/cipher"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/kyber/v3/xof/blake2xb"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// Clock tells the time and runs the timers of a server. It is the real time,
+// unless the server is given a VirtualClock to make a simulation
+// reproducible.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After sends the time on the returned channel once d passed.
+	After(d time.Duration) <-chan time.Time
+	// AfterFunc calls f once d passed.
+	AfterFunc(d time.Duration, f func()) ClockTimer
+}
+
+// ClockTimer is a timer of a Clock, which can be stopped before it fires.
+type ClockTimer interface {
+	// Stop prevents the timer from firing. It returns false if the timer
+	// already fired or was stopped.
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return time.AfterFunc(d, f)
+}
+
+// Clock returns the clock of the server, the real time unless SetClock is
+// called.
+func (c *Server) Clock() Clock {
+	return c.clock
+}
+
+// SetClock replaces the clock of the server, to drive the timers of a
+// simulation or a test that use it: the timeouts of the overlay and the
+// expiry of the capabilities. It must be called before the server is
+// started.
+func (c *Server) SetClock(clock Clock) {
+	c.clock = clock
+	c.overlay.treeStorage.setClock(clock)
+}
+
+// SetClock replaces the real time for the waits between the attempts to
+// reach a conode and the retries of the offline queue. A nil clock sets back
+// the real time.
+func (c *Client) SetClock(clock Clock) {
+	c.Lock()
+	defer c.Unlock()
+	c.clock = clock
+}
+
+// getClock returns the clock of the client.
+func (c *Client) getClock() Clock {
+	c.Lock()
+	defer c.Unlock()
+	if c.clock == nil {
+		return realClock{}
+	}
+	return c.clock
+}
+
+// VirtualClock is a Clock whose time only moves with Advance, which fires
+// the timers in the order of their deadlines.
+type VirtualClock struct {
+	now time.Time
+	// timers are sorted by deadline, then by creation
+	timers []*virtualTimer
+	sync.Mutex
+}
+
+type virtualTimer struct {
+	clock *VirtualClock
+	at    time.Time
+	fire  func(time.Time)
+	// callers started the timer, to name its owner if it leaks
+	callers []uintptr
+}
+
+// NewVirtualClock returns a clock starting at the given time.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+// Now implements the Clock interface.
+func (c *VirtualClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+// After implements the Clock interface.
+func (c *VirtualClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.add(d, func(t time.Time) { ch <- t })
+	return ch
+}
+
+// AfterFunc implements the Clock interface. Unlike the real clock, f is
+// called by Advance, so that the timers fire in order.
+func (c *VirtualClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return c.add(d, func(time.Time) { f() })
+}
+
+// Advance moves the time forward by d, and fires the timers whose deadline
+// it passes, including the ones they start. The timers started with a
+// duration of zero or less fire with the next Advance.
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.Lock()
+	end := c.now.Add(d)
+	c.Unlock()
+	for {
+		c.Lock()
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			c.now = end
+			c.Unlock()
+			return
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+		c.Unlock()
+		t.fire(t.at)
+	}
+}
+
+// Timers returns how many timers wait to fire.
+func (c *VirtualClock) Timers() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.timers)
+}
+
+func (c *VirtualClock) add(d time.Duration, fire func(time.Time)) *virtualTimer {
+	c.Lock()
+	defer c.Unlock()
+	t := &virtualTimer{clock: c, at: c.now.Add(d), fire: fire}
+	var pcs [16]uintptr
+	// skips Callers, add, and After or AfterFunc
+	t.callers = pcs[:runtime.Callers(3, pcs[:])]
+	c.timers = append(c.timers, t)
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].at.Before(c.timers[j].at)
+	})
+	return t
+}
+
+// timerStacks returns the functions that started the timers waiting to fire,
+// one stack by timer.
+func (c *VirtualClock) timerStacks() []string {
+	c.Lock()
+	defer c.Unlock()
+	var stacks []string
+	for _, t := range c.timers {
+		var stack strings.Builder
+		frames := runtime.CallersFrames(t.callers)
+		for {
+			f, more := frames.Next()
+			stack.WriteString(f.Function + "()\n")
+			if !more {
+				break
+			}
+		}
+		stacks = append(stacks, stack.String())
+	}
+	return stacks
+}
+
+// Stop implements the ClockTimer interface.
+func (t *virtualTimer) Stop() bool {
+	c := t.clock
+	c.Lock()
+	defer c.Unlock()
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// randomSource is where onet reads the random bytes of its nonces and
+// permutations, crypto/rand unless SetSeed is called.
+var randomSource struct {
+	reader io.Reader
+	sync.Mutex
+}
+
+// SetSeed draws the nonces and the permutations of onet, and math/rand, from
+// the seed, so that a simulation can be reproduced. It must never be used
+// outside of simulations, as the nonces become predictable.
+func SetSeed(seed int64) {
+	randomSource.Lock()
+	defer randomSource.Unlock()
+	randomSource.reader = blake2xb.New(seedBytes(seed, "onet"))
+	rand.Seed(seed)
+}
+
+// randomRead fills buf with random bytes.
+func randomRead(buf []byte) error {
+	randomSource.Lock()
+	defer randomSource.Unlock()
+	if randomSource.reader == nil {
+		_, err := io.ReadFull(cryptorand.Reader, buf)
+		return err
+	}
+	_, err := io.ReadFull(randomSource.reader, buf)
+	return err
+}
+
+// NewSeededSuite returns the suite with its RandomStream drawn from the seed
+// and the name, so that the keys picked with it are always the same. The
+// name tells apart the streams of the same seed. Like SetSeed, it is only
+// meant for simulations.
+func NewSeededSuite(suite network.Suite, seed int64, name string) network.Suite {
+	return &seededSuite{Suite: suite,
+		stream: &lockedStream{Stream: blake2xb.New(seedBytes(seed, name))}}
+}
+
+type seededSuite struct {
+	network.Suite
+	stream cipher.Stream
+}
+
+func (s *seededSuite) RandomStream() cipher.Stream {
+	return s.stream
+}
+
+// lockedStream can be used by the goroutines of a server at the same time.
+type lockedStream struct {
+	cipher.Stream
+	sync.Mutex
+}
+
+func (s *lockedStream) XORKeyStream(dst, src []byte) {
+	s.Lock()
+	defer s.Unlock()
+	s.Stream.XORKeyStream(dst, src)
+}
+
+func seedBytes(seed int64, name string) []byte {
+	buf := make([]byte, 8, 8+len(name))
+	binary.LittleEndian.PutUint64(buf, uint64(seed))
+	return append(buf, name...)
+}
@@ -0,0 +1,107 @@
+package onet
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+)
+
+func TestVirtualClock(t *testing.T) {
+	c := NewVirtualClock(SimulationEpoch)
+	require.Equal(t, SimulationEpoch, c.Now())
+
+	var fired []int
+	c.AfterFunc(2*time.Second, func() { fired = append(fired, 2) })
+	c.AfterFunc(time.Second, func() {
+		fired = append(fired, 1)
+		// a timer started by a timer fires in the same Advance
+		c.AfterFunc(500*time.Millisecond, func() { fired = append(fired, 15) })
+	})
+	c.AfterFunc(time.Second, func() { fired = append(fired, 11) })
+	stopped := c.AfterFunc(1500*time.Millisecond, func() { fired = append(fired, 0) })
+	after := c.After(3 * time.Second)
+	require.Equal(t, 5, c.Timers())
+
+	require.True(t, stopped.Stop())
+	require.False(t, stopped.Stop())
+	c.Advance(time.Second + 500*time.Millisecond)
+	require.Equal(t, []int{1, 11, 15}, fired)
+	require.Equal(t, SimulationEpoch.Add(1500*time.Millisecond), c.Now())
+
+	c.Advance(10 * time.Second)
+	require.Equal(t, []int{1, 11, 15, 2}, fired)
+	require.Equal(t, SimulationEpoch.Add(3*time.Second), <-after)
+	require.Equal(t, SimulationEpoch.Add(11500*time.Millisecond), c.Now())
+	require.Equal(t, 0, c.Timers())
+}
+
+func TestSetSeed(t *testing.T) {
+	defer func() {
+		randomSource.Lock()
+		randomSource.reader = nil
+		randomSource.Unlock()
+	}()
+	read := func() []byte {
+		buf := make([]byte, 32)
+		require.NoError(t, randomRead(buf))
+		return buf
+	}
+	SetSeed(1)
+	first := read()
+	perm := securePermute(10)
+	SetSeed(1)
+	require.Equal(t, first, read())
+	require.Equal(t, perm, securePermute(10))
+	SetSeed(2)
+	require.NotEqual(t, first, read())
+}
+
+func TestNewSeededSuite(t *testing.T) {
+	k1 := key.NewKeyPair(NewSeededSuite(tSuite, 1, "a"))
+	require.True(t, k1.Public.Equal(key.NewKeyPair(NewSeededSuite(tSuite, 1, "a")).Public))
+	require.False(t, k1.Public.Equal(key.NewKeyPair(NewSeededSuite(tSuite, 1, "b")).Public))
+	require.False(t, k1.Public.Equal(key.NewKeyPair(NewSeededSuite(tSuite, 2, "a")).Public))
+}
+
+func TestSimulationDeterministic(t *testing.T) {
+	registerService()
+	defer unregisterService()
+	defer func() {
+		randomSource.Lock()
+		randomSource.reader = nil
+		randomSource.Unlock()
+	}()
+
+	create := func() *SimulationConfig {
+		sc := &SimulationConfig{Config: "Deterministic = true\nSeed = 3\n"}
+		sb := &SimulationBFTree{Hosts: 3, BF: 2, Suite: "Ed25519",
+			Deterministic: true, Seed: 3}
+		sb.CreateRoster(sc, []string{"127.0.0.1"}, 2000)
+		require.NoError(t, sb.CreateTree(sc))
+		return sc
+	}
+	sc := create()
+	sc2 := create()
+	for i, si := range sc.Roster.List {
+		require.True(t, si.Public.Equal(sc2.Roster.List[i].Public))
+		require.Equal(t, si.ServiceIdentities[1].Public.String(),
+			sc2.Roster.List[i].ServiceIdentities[1].Public.String())
+	}
+
+	dir, err := ioutil.TempDir("", "deterministic")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, sc.Save(dir))
+	scs, err := LoadSimulationConfig("Ed25519", dir, sc.Roster.List[0].Address.NetworkAddress())
+	require.NoError(t, err)
+	defer closeAll(scs)
+	clock, ok := scs[0].Server.Clock().(*VirtualClock)
+	require.True(t, ok)
+	require.Equal(t, SimulationEpoch, clock.Now())
+	_, ok = scs[0].Server.Suite().(*seededSuite)
+	require.True(t, ok)
+}
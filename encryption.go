@@ -0,0 +1,349 @@
+package onet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/xerrors"
+)
+
+// The sources of the key of StorageEncryption.
+const (
+	// StorageKeyConode derives the key from the private key of the conode,
+	// or from ServerOptions.StorageKey, which keeps it across key rotations.
+	StorageKeyConode = "conode"
+	// StorageKeyEnv reads the hex-encoded key from an environment variable.
+	StorageKeyEnv = "env"
+)
+
+// DefaultStorageKeyEnv is the environment variable holding the key when
+// StorageEncryption.Key is "env" and no other variable is given.
+const DefaultStorageKeyEnv = "CONODE_STORAGE_KEY"
+
+// StorageEncryption configures the encryption of the values stored by the
+// services, so that a copy of the database, e.g., a stolen disk or a backup,
+// doesn't give their state. The names of the buckets and the keys aren't
+// encrypted, as the services rely on their order.
+//
+// Enabling it on an existing database encrypts all its values when the
+// conode starts. A conode started with another key refuses to open the
+// database. A value that can't be decrypted makes the transaction reading it
+// fail.
+//
+// The services getting the database with Context.GetAdditionalBucket would
+// bypass the encryption: a conode running one of them fails to start.
+type StorageEncryption struct {
+	// Key is the source of the 32 bytes key: StorageKeyConode (the default),
+	// StorageKeyEnv, or the name of a provider added with
+	// RegisterStorageKeyProvider, e.g., for a key management service.
+	Key string `toml:",omitempty"`
+	// KeyEnv is the environment variable read for StorageKeyEnv, by default
+	// CONODE_STORAGE_KEY.
+	KeyEnv string `toml:",omitempty"`
+}
+
+// StorageKeyProvider returns the 32 bytes key encrypting the database.
+type StorageKeyProvider func() ([]byte, error)
+
+var storageKeyProviders = struct {
+	sync.Mutex
+	providers map[string]StorageKeyProvider
+}{providers: make(map[string]StorageKeyProvider)}
+
+// RegisterStorageKeyProvider makes a new source of the key of
+// StorageEncryption available under the given name.
+func RegisterStorageKeyProvider(name string, p StorageKeyProvider) error {
+	storageKeyProviders.Lock()
+	defer storageKeyProviders.Unlock()
+	if name == StorageKeyConode || name == StorageKeyEnv {
+		return xerrors.Errorf("storage key provider %s is built in", name)
+	}
+	if _, ok := storageKeyProviders.providers[name]; ok {
+		return xerrors.Errorf("storage key provider %s already registered", name)
+	}
+	storageKeyProviders.providers[name] = p
+	return nil
+}
+
+// storageKeySize is the size of the AES-256 key.
+const storageKeySize = 32
+
+// key returns the key given by the configuration. private is the key the
+// database derives from.
+func (e StorageEncryption) key(private kyber.Scalar) ([]byte, error) {
+	var key []byte
+	switch e.Key {
+	case "", StorageKeyConode:
+		buf, err := private.MarshalBinary()
+		if err != nil {
+			return nil, xerrors.Errorf("marshaling private key: %v", err)
+		}
+		key = make([]byte, storageKeySize)
+		kdf := hkdf.New(sha256.New, buf, nil, []byte("onet storage encryption"))
+		if _, err := io.ReadFull(kdf, key); err != nil {
+			return nil, xerrors.Errorf("deriving key: %v", err)
+		}
+	case StorageKeyEnv:
+		name := e.KeyEnv
+		if name == "" {
+			name = DefaultStorageKeyEnv
+		}
+		s := os.Getenv(name)
+		if s == "" {
+			return nil, xerrors.Errorf("environment variable %s not set", name)
+		}
+		var err error
+		key, err = hex.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return nil, xerrors.Errorf("decoding %s: %v", name, err)
+		}
+	default:
+		storageKeyProviders.Lock()
+		p, ok := storageKeyProviders.providers[e.Key]
+		storageKeyProviders.Unlock()
+		if !ok {
+			return nil, xerrors.Errorf("unknown storage key provider %s", e.Key)
+		}
+		var err error
+		key, err = p()
+		if err != nil {
+			return nil, xerrors.Errorf("getting key from %s: %v", e.Key, err)
+		}
+	}
+	if len(key) != storageKeySize {
+		return nil, xerrors.Errorf("key of %d bytes instead of %d", len(key),
+			storageKeySize)
+	}
+	return key, nil
+}
+
+// encryptionBucket holds the value telling whether the store is encrypted,
+// and with which key.
+var encryptionBucket = []byte("onet_encryption")
+
+var encryptionCheck = []byte("check")
+
+// storeEncrypted returns whether the values of the store, as written on the
+// disk, are encrypted.
+func storeEncrypted(s Store) (bool, error) {
+	var enc bool
+	err := s.View(func(tx StoreTx) error {
+		enc = tx.Bucket(encryptionBucket) != nil
+		return nil
+	})
+	return enc, err
+}
+
+// encryptedStore encrypts the values of the wrapped Store with AES-GCM. The
+// name of the bucket and the key are authenticated with the value, so that
+// the values can't be moved around.
+type encryptedStore struct {
+	Store
+	aead cipher.AEAD
+}
+
+// newEncryptedStore returns a store encrypting the values written in s with
+// the key. The values written before the encryption was enabled are
+// encrypted.
+func newEncryptedStore(s Store, key []byte) (Store, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, xerrors.Errorf("creating cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, xerrors.Errorf("creating cipher: %v", err)
+	}
+	es := &encryptedStore{Store: s, aead: aead}
+
+	err = s.Update(func(tx StoreTx) error {
+		if b := tx.Bucket(encryptionBucket); b != nil {
+			_, err := es.open(encryptionBucket, encryptionCheck, b.Get(encryptionCheck))
+			if err != nil {
+				return xerrors.New("wrong key")
+			}
+			return nil
+		}
+		return es.encryptAll(tx)
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("encrypted store: %v", err)
+	}
+	return es, nil
+}
+
+// encryptAll encrypts the values of the unencrypted store and marks it as
+// encrypted.
+func (s *encryptedStore) encryptAll(tx StoreTx) error {
+	// the buckets can't be changed while iterating over them
+	var names [][]byte
+	err := tx.ForEach(func(name []byte, b StoreBucket) error {
+		names = append(names, append([]byte{}, name...))
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("listing buckets: %v", err)
+	}
+	var n int
+	for _, name := range names {
+		b := tx.Bucket(name)
+		var keys, values [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			// nil for a nested bucket
+			if v != nil {
+				keys = append(keys, append([]byte{}, k...))
+				values = append(values, s.seal(name, k, v))
+			}
+			return nil
+		})
+		if err != nil {
+			return xerrors.Errorf("reading %s: %v", name, err)
+		}
+		for i := range keys {
+			if err := b.Put(keys[i], values[i]); err != nil {
+				return xerrors.Errorf("writing %s: %v", name, err)
+			}
+		}
+		n += len(keys)
+	}
+	b, err := tx.CreateBucketIfNotExists(encryptionBucket)
+	if err != nil {
+		return xerrors.Errorf("creating bucket: %v", err)
+	}
+	if n > 0 {
+		log.Lvl1("Encrypted", n, "values of the database")
+	}
+	return b.Put(encryptionCheck, s.seal(encryptionBucket, encryptionCheck, encryptionCheck))
+}
+
+// additionalData returns the data authenticated with the value of the key
+// in the bucket.
+func additionalData(bucket, key []byte) []byte {
+	ad := make([]byte, 0, len(bucket)+len(key)+1)
+	ad = append(ad, bucket...)
+	ad = append(ad, 0)
+	return append(ad, key...)
+}
+
+func (s *encryptedStore) seal(bucket, key, value []byte) []byte {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(value)+s.aead.Overhead())
+	if err := randomRead(nonce); err != nil {
+		panic(xerrors.Errorf("reading random nonce: %v", err))
+	}
+	return s.aead.Seal(nonce, nonce, value, additionalData(bucket, key))
+}
+
+func (s *encryptedStore) open(bucket, key, value []byte) ([]byte, error) {
+	if len(value) < s.aead.NonceSize() {
+		return nil, xerrors.New("value too short")
+	}
+	ns := s.aead.NonceSize()
+	plain, err := s.aead.Open(nil, value[:ns], value[ns:], additionalData(bucket, key))
+	if err != nil {
+		return nil, err
+	}
+	if plain == nil {
+		// an empty value is not a missing one
+		plain = []byte{}
+	}
+	return plain, nil
+}
+
+func (s *encryptedStore) View(fn func(tx StoreTx) error) error {
+	return s.Store.View(func(tx StoreTx) error {
+		var err error
+		if ferr := fn(encryptedTx{tx, s, &err}); ferr != nil {
+			return ferr
+		}
+		return err
+	})
+}
+
+func (s *encryptedStore) Update(fn func(tx StoreTx) error) error {
+	return s.Store.Update(func(tx StoreTx) error {
+		var err error
+		if ferr := fn(encryptedTx{tx, s, &err}); ferr != nil {
+			return ferr
+		}
+		return err
+	})
+}
+
+type encryptedTx struct {
+	StoreTx
+	store *encryptedStore
+	// the first error of Get, failing the transaction
+	err *error
+}
+
+func (tx encryptedTx) Bucket(name []byte) StoreBucket {
+	b := tx.StoreTx.Bucket(name)
+	if b == nil {
+		return nil
+	}
+	return encryptedBucket{b, tx, name}
+}
+
+func (tx encryptedTx) CreateBucketIfNotExists(name []byte) (StoreBucket, error) {
+	b, err := tx.StoreTx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+	return encryptedBucket{b, tx, name}, nil
+}
+
+func (tx encryptedTx) ForEach(fn func(name []byte, b StoreBucket) error) error {
+	return tx.StoreTx.ForEach(func(name []byte, b StoreBucket) error {
+		return fn(name, encryptedBucket{b, tx, name})
+	})
+}
+
+type encryptedBucket struct {
+	StoreBucket
+	tx   encryptedTx
+	name []byte
+}
+
+// Get returns the decrypted value. A value that can't be decrypted is taken
+// as missing, and the transaction returns an error once its function
+// returns.
+func (b encryptedBucket) Get(key []byte) []byte {
+	v := b.StoreBucket.Get(key)
+	if v == nil {
+		return nil
+	}
+	plain, err := b.tx.store.open(b.name, key, v)
+	if err != nil {
+		if *b.tx.err == nil {
+			*b.tx.err = xerrors.Errorf("decrypting %x in bucket %s: %v", key, b.name, err)
+		}
+		return nil
+	}
+	return plain
+}
+
+func (b encryptedBucket) Put(key, value []byte) error {
+	return b.StoreBucket.Put(key, b.tx.store.seal(b.name, key, value))
+}
+
+func (b encryptedBucket) ForEach(fn func(k, v []byte) error) error {
+	return b.StoreBucket.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return fn(k, nil)
+		}
+		plain, err := b.tx.store.open(b.name, k, v)
+		if err != nil {
+			return xerrors.Errorf("decrypting %x in bucket %s: %v", k, b.name, err)
+		}
+		return fn(k, plain)
+	})
+}
@@ -0,0 +1,139 @@
+package onet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encryption")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "db")
+	name, key, value := []byte("bucket"), []byte("key"), []byte("secret value")
+
+	s, err := openBoltStore(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Update(func(tx StoreTx) error {
+		b, err := tx.CreateBucketIfNotExists(name)
+		require.NoError(t, err)
+		return b.Put(key, value)
+	}))
+
+	// the values already stored get encrypted
+	k := bytes.Repeat([]byte{1}, storageKeySize)
+	es, err := newEncryptedStore(s, k)
+	require.NoError(t, err)
+	require.NoError(t, es.Update(func(tx StoreTx) error {
+		b := tx.Bucket(name)
+		require.Equal(t, value, b.Get(key))
+		return b.Put([]byte("empty"), []byte{})
+	}))
+	require.NoError(t, es.View(func(tx StoreTx) error {
+		require.Equal(t, []byte{}, tx.Bucket(name).Get([]byte("empty")))
+		return nil
+	}))
+	require.NoError(t, s.View(func(tx StoreTx) error {
+		raw := tx.Bucket(name).Get(key)
+		require.NotNil(t, raw)
+		require.False(t, bytes.Contains(raw, value))
+		return nil
+	}))
+
+	// another key is refused
+	_, err = newEncryptedStore(s, bytes.Repeat([]byte{2}, storageKeySize))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "wrong key")
+	require.NoError(t, es.Close())
+
+	// a value moved to another key doesn't decrypt
+	s, err = openBoltStore(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Update(func(tx StoreTx) error {
+		b := tx.Bucket(name)
+		return b.Put([]byte("moved"), b.Get(key))
+	}))
+	es, err = newEncryptedStore(s, k)
+	require.NoError(t, err)
+	defer es.Close()
+	err = es.View(func(tx StoreTx) error {
+		require.Nil(t, tx.Bucket(name).Get([]byte("moved")))
+		require.Error(t, tx.Bucket(name).ForEach(func(k, v []byte) error { return nil }))
+		return nil
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "decrypting")
+	// nothing is written by a transaction reading it
+	require.Error(t, es.Update(func(tx StoreTx) error {
+		b := tx.Bucket(name)
+		return b.Put([]byte("copy"), b.Get([]byte("moved")))
+	}))
+	require.NoError(t, es.View(func(tx StoreTx) error {
+		require.Nil(t, tx.Bucket(name).Get([]byte("copy")))
+		return nil
+	}))
+}
+
+func TestStorageEncryption_Key(t *testing.T) {
+	private := tSuite.Scalar().Pick(tSuite.RandomStream())
+	k1, err := StorageEncryption{}.key(private)
+	require.NoError(t, err)
+	k2, err := StorageEncryption{Key: StorageKeyConode}.key(private)
+	require.NoError(t, err)
+	require.Equal(t, k1, k2)
+
+	env := StorageEncryption{Key: StorageKeyEnv, KeyEnv: "ONET_TEST_STORAGE_KEY"}
+	_, err = env.key(private)
+	require.Error(t, err)
+	k := bytes.Repeat([]byte{3}, storageKeySize)
+	os.Setenv("ONET_TEST_STORAGE_KEY", hex.EncodeToString(k))
+	defer os.Unsetenv("ONET_TEST_STORAGE_KEY")
+	k3, err := env.key(private)
+	require.NoError(t, err)
+	require.Equal(t, k, k3)
+
+	require.NoError(t, RegisterStorageKeyProvider("test-kms", func() ([]byte, error) {
+		return []byte("short"), nil
+	}))
+	require.Error(t, RegisterStorageKeyProvider(StorageKeyEnv, nil))
+	_, err = StorageEncryption{Key: "test-kms"}.key(private)
+	require.Error(t, err)
+	_, err = StorageEncryption{Key: "unknown"}.key(private)
+	require.Error(t, err)
+}
+
+func TestServer_StorageEncryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encryption")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	priv, id := NewPrivIdentity(tSuite, 0)
+	router, err := network.NewLocalRouter(id, tSuite)
+	require.NoError(t, err)
+	c := newServerWithOptions(tSuite, dir, router, priv,
+		ServerOptions{StorageEncryption: &StorageEncryption{}})
+	c.StartInBackground()
+	defer c.Close()
+
+	_, ok := c.serviceManager.store.(*boltStore)
+	require.False(t, ok)
+	require.Equal(t, "true", c.serviceManager.GetStatus().Field["Encrypted"])
+	ctx := c.serviceManager.contexts[ServiceFactory.ServiceID(serviceWebSocket)]
+	require.NoError(t, ctx.Save([]byte("key"), &SimpleResponse{Val: 3}))
+	msg, err := ctx.Load([]byte("key"))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), msg.(*SimpleResponse).Val)
+	used, _ := ctx.StorageUsage()
+	require.NoError(t, ctx.updateStorageUsage())
+	rescanned, _ := ctx.StorageUsage()
+	require.Equal(t, used, rescanned)
+
+	// the services can't bypass the encryption
+	require.Panics(t, func() { ctx.GetAdditionalBucket([]byte("raw")) })
+}
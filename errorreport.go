@@ -0,0 +1,103 @@
+package onet
+
+import (
+	"fmt"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// ErrorEvent is a panic or an error forwarded to an ErrorReporter.
+type ErrorEvent struct {
+	Time time.Time
+	// Conode is the address of the conode.
+	Conode string
+	// Service is the name of the service concerned, if known.
+	Service string
+	// Severity is log.SeverityPanic for the panics recovered by the conode,
+	// and the severity of the message for the errors of the log.
+	Severity log.Severity
+	Message  string
+	// Stack of the goroutine that panicked, empty for the errors of the log.
+	Stack string
+	// Fields are the details of the event, like the part of the conode that
+	// panicked, the protocol or the place the error was logged.
+	Fields map[string]string
+}
+
+// ErrorReporter forwards the panics and the errors of the conodes to an error
+// tracker, like Sentry, so that the operators are alerted. ReportError is
+// called from the goroutine of the panic or with the lock of the log: it must
+// be safe for concurrent use, mustn't block and mustn't log with onet.
+type ErrorReporter interface {
+	ReportError(ev *ErrorEvent)
+}
+
+// ErrorReporterFunc is a function implementing ErrorReporter.
+type ErrorReporterFunc func(ev *ErrorEvent)
+
+// ReportError implements ErrorReporter.
+func (f ErrorReporterFunc) ReportError(ev *ErrorEvent) {
+	f(ev)
+}
+
+// SetErrorReporter forwards the panics recovered in the protocols and the
+// services of the server to the reporter, in addition to the one of
+// ServerOptions.Sentry. Nil removes it.
+func (c *Server) SetErrorReporter(er ErrorReporter) {
+	c.crashes.Lock()
+	defer c.crashes.Unlock()
+	c.crashes.reporter = er
+}
+
+// crashEvent returns the event of the crash report.
+func crashEvent(rep *CrashReport) *ErrorEvent {
+	ev := &ErrorEvent{
+		Time:     rep.Time,
+		Conode:   rep.Conode,
+		Service:  rep.Fields["service"],
+		Severity: log.SeverityPanic,
+		Message:  "panic: " + rep.Panic,
+		Stack:    rep.Stack,
+		Fields:   map[string]string{"where": rep.Where},
+	}
+	for k, v := range rep.Fields {
+		if k != "service" {
+			ev.Fields[k] = v
+		}
+	}
+	if rep.Token != nil {
+		ev.Fields["round"] = rep.Token.RoundID.String()
+	}
+	return ev
+}
+
+// NewErrorLogger returns a logger forwarding the errors of the log to the
+// reporter, labeled with the conode and with the service of the messages
+// having the field "service". As the log is shared by the conodes of a
+// process, it is registered once, for example with log.RegisterLogger.
+func NewErrorLogger(er ErrorReporter, conode string) log.Logger {
+	return log.NewBackendLogger(log.BackendFunc(func(e *log.Entry) {
+		if e.Severity < log.SeverityError {
+			return
+		}
+		ev := &ErrorEvent{
+			Time:     e.Time,
+			Conode:   conode,
+			Severity: e.Severity,
+			Message:  e.Message,
+			Fields:   make(map[string]string),
+		}
+		for _, f := range e.Fields {
+			if f.Key == "service" {
+				ev.Service = fmt.Sprint(f.Value)
+			} else {
+				ev.Fields[f.Key] = fmt.Sprint(f.Value)
+			}
+		}
+		if e.File != "" {
+			ev.Fields["caller"] = fmt.Sprintf("%s:%d", e.File, e.Line)
+		}
+		er.ReportError(ev)
+	}), &log.LoggerInfo{})
+}
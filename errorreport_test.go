@@ -0,0 +1,70 @@
+package onet
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// eventRecorder keeps the events it receives.
+type eventRecorder struct {
+	sync.Mutex
+	events []*ErrorEvent
+}
+
+func (r *eventRecorder) ReportError(ev *ErrorEvent) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, ev)
+}
+
+func TestServer_SetErrorReporter(t *testing.T) {
+	log.OutputToBuf()
+	defer log.OutputToOs()
+
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	s := local.GenServers(1)[0]
+	rec := &eventRecorder{}
+	s.SetErrorReporter(rec)
+
+	client := local.NewClient(testServiceName)
+	require.Error(t, client.SendProtobuf(s.ServerIdentity, &testPanicMsg{}, nil))
+
+	rec.Lock()
+	defer rec.Unlock()
+	require.Len(t, rec.events, 1)
+	ev := rec.events[0]
+	require.Equal(t, s.ServerIdentity.Address.String(), ev.Conode)
+	require.Equal(t, testServiceName, ev.Service)
+	require.Equal(t, log.SeverityPanic, ev.Severity)
+	require.Equal(t, "panic: deadbeef", ev.Message)
+	require.Contains(t, ev.Stack, "ProcessMsgPanic")
+	require.Equal(t, "service.request", ev.Fields["where"])
+	require.Equal(t, "testPanicMsg", ev.Fields["request"])
+}
+
+func TestNewErrorLogger(t *testing.T) {
+	log.OutputToBuf()
+	defer log.OutputToOs()
+
+	rec := &eventRecorder{}
+	key := log.RegisterLogger(NewErrorLogger(rec, "tls://127.0.0.1:7770"))
+	log.Warn("not reported")
+	log.Error("reported", log.KV("service", "Skipchain"), log.KV("block", 3))
+	log.UnregisterLogger(key)
+	log.Error("not reported")
+
+	rec.Lock()
+	defer rec.Unlock()
+	require.Len(t, rec.events, 1)
+	ev := rec.events[0]
+	require.Equal(t, "tls://127.0.0.1:7770", ev.Conode)
+	require.Equal(t, "Skipchain", ev.Service)
+	require.Equal(t, log.SeverityError, ev.Severity)
+	require.Equal(t, "reported", ev.Message)
+	require.Equal(t, "3", ev.Fields["block"])
+	require.Contains(t, ev.Fields["caller"], "errorreport_test.go")
+}
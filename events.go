@@ -0,0 +1,221 @@
+package onet
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// EventType tells what happened in an Event.
+type EventType int
+
+const (
+	// EventPeerUp is when the server gets its first connection to a peer.
+	EventPeerUp EventType = iota + 1
+	// EventPeerDown is when the last connection to a peer is closed.
+	EventPeerDown
+	// EventProtocolStarted is when a protocol instance is created on the
+	// server, by a service or when it receives its first message.
+	EventProtocolStarted
+	// EventProtocolFinished is when a protocol instance is done.
+	EventProtocolFinished
+	// EventProtocolFailed is when a protocol instance panicked, or when its
+	// Start or its Dispatch returned an error.
+	EventProtocolFailed
+	// EventStorageWarning is when the storage used by a service goes above
+	// StorageQuotaWarning of its quota.
+	EventStorageWarning
+	// EventConfigReloaded is when a part of the configuration of the server
+	// is changed while it runs, like the log levels set through the admin
+	// interface.
+	EventConfigReloaded
+	// EventKeyRotated is when a peer announces the new key it rotates to,
+	// see Server.KeyTransition.
+	EventKeyRotated
+	// EventServiceKeyChanged is when a service generates or rotates one of
+	// its keys, see Context.GenerateServiceKey.
+	EventServiceKeyChanged
+	// EventAddressMismatch is when the public IP of the server isn't the
+	// host of its address, see PublicAddressConfig.
+	EventAddressMismatch
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPeerUp:
+		return "PeerUp"
+	case EventPeerDown:
+		return "PeerDown"
+	case EventProtocolStarted:
+		return "ProtocolStarted"
+	case EventProtocolFinished:
+		return "ProtocolFinished"
+	case EventProtocolFailed:
+		return "ProtocolFailed"
+	case EventStorageWarning:
+		return "StorageWarning"
+	case EventConfigReloaded:
+		return "ConfigReloaded"
+	case EventKeyRotated:
+		return "KeyRotated"
+	case EventServiceKeyChanged:
+		return "ServiceKeyChanged"
+	case EventAddressMismatch:
+		return "AddressMismatch"
+	default:
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+}
+
+// Event is published on the event bus of a server, see Server.Subscribe.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Peer is the conode of EventPeerUp, EventPeerDown and EventKeyRotated.
+	Peer *network.ServerIdentity
+	// Protocol is the name of the protocol, and Token its instance, of the
+	// events of the protocols.
+	Protocol string
+	Token    *Token
+	// Service is the service using all its storage for EventStorageWarning,
+	// and the one changing its key for EventServiceKeyChanged, whose name is
+	// the Message.
+	Service string
+	// Err is why the protocol failed for EventProtocolFailed.
+	Err error
+	// Message describes the event, like the storage used by the service or
+	// the part of the configuration that was changed.
+	Message string
+}
+
+// eventBufferSize is the number of events waiting to be received by a
+// subscriber. The next ones are dropped.
+const eventBufferSize = 100
+
+type subscription struct {
+	// types are the types of events sent, all of them if nil
+	types   map[EventType]bool
+	events  chan Event
+	dropped int
+}
+
+// eventBus sends the events of a server to its subscribers.
+type eventBus struct {
+	sync.Mutex
+	subs   map[int]*subscription
+	nextID int
+	closed bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[int]*subscription)}
+}
+
+// subscribe returns the channel of the events of the types and the function
+// ending the subscription. Without a bus, the channel is closed.
+func (b *eventBus) subscribe(types []EventType) (<-chan Event, func()) {
+	sub := &subscription{events: make(chan Event, eventBufferSize)}
+	if b == nil {
+		close(sub.events)
+		return sub.events, func() {}
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.closed {
+		close(sub.events)
+		return sub.events, func() {}
+	}
+	if len(types) > 0 {
+		sub.types = make(map[EventType]bool)
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+	return sub.events, func() {
+		b.Lock()
+		defer b.Unlock()
+		if _, ok := b.subs[id]; ok {
+			delete(b.subs, id)
+			close(sub.events)
+		}
+	}
+}
+
+// publish sends the event to the subscribers without waiting for them: the
+// subscribers too slow to receive it miss it.
+func (b *eventBus) publish(ev Event) {
+	if b == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b.Lock()
+	defer b.Unlock()
+	for _, sub := range b.subs {
+		if sub.types != nil && !sub.types[ev.Type] {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			if sub.dropped == 0 {
+				log.Warn("Subscriber too slow, dropping the events like", ev.Type)
+			}
+			sub.dropped++
+		}
+	}
+}
+
+// close ends all the subscriptions.
+func (b *eventBus) close() {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	for id, sub := range b.subs {
+		delete(b.subs, id)
+		close(sub.events)
+	}
+	b.closed = true
+}
+
+// Subscribe returns a channel receiving the events of the server of the given
+// types, or of all types if none is given, and the function ending the
+// subscription. The channel is closed when the subscription ends or when the
+// server is closed. The events are dropped while eventBufferSize of them
+// wait to be received, so the subscribers must not block.
+func (c *Server) Subscribe(types ...EventType) (<-chan Event, func()) {
+	return c.events.subscribe(types)
+}
+
+// Publish sends the event to the subscribers of the server, for example
+// EventConfigReloaded when the application changes the configuration.
+func (c *Server) Publish(ev Event) {
+	c.events.publish(ev)
+}
+
+// Subscribe returns a channel receiving the events of the server of the
+// service, see Server.Subscribe.
+func (c *Context) Subscribe(types ...EventType) (<-chan Event, func()) {
+	return c.server.Subscribe(types...)
+}
+
+// protocolEvent publishes the event of the protocol instance.
+func (n *TreeNodeInstance) protocolEvent(t EventType, err error) {
+	n.overlay.protocolEvent(t, n.token, err)
+}
+
+// protocolEvent publishes the event of the protocol instance of the token.
+func (o *Overlay) protocolEvent(t EventType, tok *Token, err error) {
+	o.server.events.publish(Event{Type: t,
+		Protocol: o.server.protocols.ProtocolIDToName(tok.ProtoID), Token: tok,
+		Err: err})
+}
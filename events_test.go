@@ -0,0 +1,100 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestEventBus(t *testing.T) {
+	log.OutputToBuf()
+	defer log.OutputToOs()
+
+	b := newEventBus()
+	all, unsubscribeAll := b.subscribe(nil)
+	peers, unsubscribePeers := b.subscribe([]EventType{EventPeerUp, EventPeerDown})
+	b.publish(Event{Type: EventPeerUp})
+	b.publish(Event{Type: EventConfigReloaded})
+	require.Len(t, all, 2)
+	require.Len(t, peers, 1)
+	ev := <-peers
+	require.Equal(t, EventPeerUp, ev.Type)
+	require.False(t, ev.Time.IsZero())
+
+	// the channel is closed at the end of the subscription
+	unsubscribePeers()
+	unsubscribePeers()
+	_, ok := <-peers
+	require.False(t, ok)
+
+	// the events are dropped when the subscriber doesn't read them
+	for i := 0; i < eventBufferSize; i++ {
+		b.publish(Event{Type: EventConfigReloaded})
+	}
+	require.Len(t, all, eventBufferSize)
+	unsubscribeAll()
+
+	all, _ = b.subscribe(nil)
+	b.close()
+	_, ok = <-all
+	require.False(t, ok)
+	all, _ = b.subscribe(nil)
+	_, ok = <-all
+	require.False(t, ok)
+
+	// without a bus, nothing is sent
+	var nilBus *eventBus
+	nilBus.publish(Event{Type: EventPeerUp})
+	all, _ = nilBus.subscribe(nil)
+	_, ok = <-all
+	require.False(t, ok)
+	require.Equal(t, "PeerDown", EventPeerDown.String())
+}
+
+func TestServer_Subscribe(t *testing.T) {
+	log.OutputToBuf()
+	defer log.OutputToOs()
+
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(2, true)
+	events, unsubscribe := servers[1].Subscribe()
+	defer unsubscribe()
+
+	pi, err := servers[0].CreateProtocol("ProtocolHandlerPanic", tree)
+	require.NoError(t, err)
+	require.NoError(t, pi.Start())
+	defer pi.(*protocolHandlerPanic).Done()
+
+	// the panic of the handler fails the protocol after it is done
+	received := make(map[EventType]Event)
+	timeout := time.After(5 * time.Second)
+	for received[EventProtocolFailed].Type == 0 {
+		select {
+		case ev := <-events:
+			received[ev.Type] = ev
+		case <-timeout:
+			require.Fail(t, "didn't get the events", received)
+		}
+	}
+	require.True(t, received[EventPeerUp].Peer.Equal(servers[0].ServerIdentity))
+	for _, typ := range []EventType{EventProtocolStarted, EventProtocolFinished,
+		EventProtocolFailed} {
+		require.Equal(t, "ProtocolHandlerPanic", received[typ].Protocol)
+		require.Equal(t, pi.Token().RoundID, received[typ].Token.RoundID)
+	}
+	require.Contains(t, received[EventProtocolFailed].Err.Error(), "handler panic")
+
+	servers[0].Close()
+	for received[EventPeerDown].Type == 0 {
+		select {
+		case ev := <-events:
+			received[ev.Type] = ev
+		case <-timeout:
+			require.Fail(t, "didn't get the events", received)
+		}
+	}
+	require.True(t, received[EventPeerDown].Peer.Equal(servers[0].ServerIdentity))
+}
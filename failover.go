@@ -0,0 +1,120 @@
+package onet
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// FailoverPolicy tells a Client to send a request to other conodes when the
+// conode it was sent to can't answer it, see SetFailover.
+type FailoverPolicy struct {
+	// Nodes are the conodes tried after the destination of the request, in
+	// this order unless the client has a Balancer, usually the list of the
+	// roster.
+	Nodes []*network.ServerIdentity
+	// MaxAttempts is the number of conodes tried, including the
+	// destination. If it is 0, all the nodes are tried.
+	MaxAttempts int
+	// AttemptTimeout, if not 0, limits the time given to every conode.
+	AttemptTimeout time.Duration
+	// Idempotent returns whether the request at path can be processed more
+	// than once. Such a request is also sent to the next conode when the
+	// previous one may have received it, e.g., after a timeout. Other
+	// requests are only sent to the next conode if the previous one
+	// couldn't be reached or is in maintenance. If nil, no request is
+	// idempotent.
+	Idempotent func(path string) bool
+}
+
+// IdempotentMessages returns a FailoverPolicy.Idempotent function accepting
+// the requests of the type of the messages.
+func IdempotentMessages(msgs ...interface{}) func(string) bool {
+	paths := make(map[string]bool)
+	for _, msg := range msgs {
+		paths[strings.Split(reflect.TypeOf(msg).String(), ".")[1]] = true
+	}
+	return func(path string) bool {
+		return paths[path]
+	}
+}
+
+// SetFailover sets the failover policy of the requests sent by the client
+// with Send and SendProtobuf. The errors returned by a conode for a request
+// are not failed over, and neither are the signed requests, as they are
+// bound to their destination. A nil policy disables the failover, which is
+// the default.
+func (c *Client) SetFailover(p *FailoverPolicy) {
+	c.Lock()
+	defer c.Unlock()
+	c.failover = p
+}
+
+// sendFailover sends the request to dst, and then to the nodes of the policy
+// as long as the error allows it. It also returns whether the request may have
+// reached one of them.
+func (c *Client) sendFailover(ctx context.Context, p *FailoverPolicy,
+	dst *network.ServerIdentity, path string, buf []byte) ([]byte, bool, error) {
+	others := p.Nodes
+	if c.getBalancer() != nil {
+		others = c.order(ctx, others)
+	}
+	nodes := []*network.ServerIdentity{dst}
+	for _, si := range others {
+		if !si.ID.Equal(dst.ID) {
+			nodes = append(nodes, si)
+		}
+	}
+	if p.MaxAttempts > 0 && p.MaxAttempts < len(nodes) {
+		nodes = nodes[:p.MaxAttempts]
+	}
+
+	var err error
+	var anyDelivered bool
+	for _, si := range nodes {
+		actx, cancel := ctx, context.CancelFunc(func() {})
+		if p.AttemptTimeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, p.AttemptTimeout)
+		}
+		var reply []byte
+		var delivered bool
+		reply, delivered, err = c.send(actx, si, path, buf)
+		cancel()
+		if err == nil {
+			return reply, true, nil
+		}
+		anyDelivered = anyDelivered || delivered
+		if ctx.Err() != nil || !canFailover(err, delivered, p.Idempotent, path) {
+			return nil, anyDelivered, err
+		}
+		log.Lvlf2("request %s/%s to %s failed, trying the next conode: %v",
+			c.service, path, si, err)
+	}
+	return nil, anyDelivered, xerrors.Errorf("all %d conodes failed, last error: %w",
+		len(nodes), err)
+}
+
+// canFailover returns whether the request can be sent to another conode
+// after the error.
+func canFailover(err error, delivered bool, idempotent func(string) bool,
+	path string) bool {
+	if xerrors.Is(err, ErrMaintenance) || !delivered {
+		return true
+	}
+	var ce *websocket.CloseError
+	if xerrors.As(err, &ce) && ce.Code == websocket.CloseProtocolError {
+		// the conode answered with an error
+		return false
+	}
+	var pe *postError
+	if xerrors.As(err, &pe) {
+		return false
+	}
+	return idempotent != nil && idempotent(path)
+}
@@ -0,0 +1,67 @@
+package onet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+func TestClient_Failover(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(3, false)
+	dead := network.NewServerIdentity(key.NewKeyPair(tSuite).Public,
+		network.NewTCPAddress("127.0.0.1:1"))
+
+	client := local.NewClientKeep(serviceWebSocket)
+	defer client.Close()
+	policy := &FailoverPolicy{Nodes: roster.List}
+	client.SetFailover(policy)
+
+	// unreachable conode
+	require.NoError(t, client.SendProtobuf(dead, &SimpleResponse{}, &SimpleResponse{}))
+
+	// conode in maintenance
+	require.NoError(t, servers[0].EnterMaintenance(context.Background()))
+	require.NoError(t, client.SendProtobuf(servers[0].ServerIdentity,
+		&SimpleResponse{}, &SimpleResponse{}))
+	servers[0].LeaveMaintenance()
+
+	// an error of the conode is returned
+	err := client.SendProtobuf(servers[0].ServerIdentity,
+		&ErrorRequest{Roster: *roster, Flags: 1}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "found in flags")
+
+	// a request that timed out is only sent again if it is idempotent
+	policy.AttemptTimeout = 200 * time.Millisecond
+	policy.MaxAttempts = 2
+	ctxState := func(i int) chan string {
+		return servers[i].Service(serviceWebSocket).(*ServiceWebSocket).ctxState
+	}
+	err = client.SendProtobuf(servers[0].ServerIdentity, &ContextRequest{Wait: true}, nil)
+	require.True(t, xerrors.Is(err, context.DeadlineExceeded))
+	<-ctxState(0)
+	select {
+	case <-ctxState(1):
+		require.Fail(t, "request sent twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	policy.Idempotent = IdempotentMessages(&ContextRequest{})
+	err = client.SendProtobuf(servers[0].ServerIdentity, &ContextRequest{Wait: true}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "conodes failed")
+	<-ctxState(0)
+	<-ctxState(1)
+	select {
+	case <-ctxState(2):
+		require.Fail(t, "more attempts than allowed")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,150 @@
+// Package fixtures builds the server identities, rosters and trees of the
+// tests of the services and protocols. They are drawn from a seed, so that
+// every run of a test gets the same keys and addresses, and the malformed
+// variants test how the services check what they receive:
+//
+//	f := fixtures.New(suites.MustFind("Ed25519"), 1)
+//	tree := f.Tree(5, fixtures.Nary(2))
+//	dup := f.RosterWithDuplicateKey(3)
+//
+// The identities aren't backed by servers: the tests running a protocol or a
+// service still use onet.LocalTest.
+package fixtures
+
+import (
+	"strconv"
+
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// FirstPort is the port of the first identity of a builder. The ports of the
+// next ones follow by steps of two, leaving the following port to their
+// websocket like the servers do.
+const FirstPort = 2000
+
+// BadAddresses are addresses that aren't valid, missing or having a wrong
+// part.
+var BadAddresses = []network.Address{
+	"",
+	"127.0.0.1:2000",
+	"tcp://",
+	"tcp://127.0.0.1",
+	"tcp://127.0.0.1:port",
+	"tcp://127.0.0.1:-1",
+	"tcp://127.0.0.1:65536",
+	"tcp://bad..host:2000",
+	"udp://127.0.0.1:2000",
+}
+
+// Builder builds the fixtures of a seed. Two builders of the same suite and
+// seed return the same fixtures, in the same order. A builder can't be used
+// by several goroutines at once.
+type Builder struct {
+	suite network.Suite
+	seed  int64
+	// the suites of the keys of the services, by name
+	services map[string]network.Suite
+	port     int
+}
+
+// New returns the builder of the fixtures of the seed, with the keys of the
+// servers in the suite.
+func New(suite network.Suite, seed int64) *Builder {
+	return &Builder{
+		suite:    onet.NewSeededSuite(suite, seed, "fixtures"),
+		seed:     seed,
+		services: make(map[string]network.Suite),
+		port:     FirstPort,
+	}
+}
+
+// ServerIdentity returns a new identity on localhost, with its private key
+// and the keys of the services registered with a suite, like the ones of the
+// servers.
+func (b *Builder) ServerIdentity() *network.ServerIdentity {
+	addr := network.NewTCPAddress("127.0.0.1:" + strconv.Itoa(b.port))
+	b.port += 2
+	return b.identity(addr)
+}
+
+// ServerIdentities returns n new identities.
+func (b *Builder) ServerIdentities(n int) []*network.ServerIdentity {
+	ids := make([]*network.ServerIdentity, n)
+	for i := range ids {
+		ids[i] = b.ServerIdentity()
+	}
+	return ids
+}
+
+// Roster returns a roster of n new identities.
+func (b *Builder) Roster(n int) *onet.Roster {
+	return onet.NewRoster(b.ServerIdentities(n))
+}
+
+// Shape builds a tree out of a roster, with its first identity as the root.
+type Shape func(ro *onet.Roster) *onet.Tree
+
+// Nary returns the shape of the trees where every node has up to bf
+// children, filled level by level.
+func Nary(bf int) Shape {
+	return func(ro *onet.Roster) *onet.Tree {
+		return ro.GenerateNaryTree(bf)
+	}
+}
+
+// Star is the shape of the trees where the root has all the other nodes as
+// children.
+var Star Shape = func(ro *onet.Roster) *onet.Tree {
+	return ro.GenerateStar()
+}
+
+// Line is the shape of the trees where every node has one child.
+var Line = Nary(1)
+
+// Tree returns a tree of the shape on a roster of n new identities.
+func (b *Builder) Tree(n int, shape Shape) *onet.Tree {
+	return shape(b.Roster(n))
+}
+
+// RosterWithBadAddress returns a roster of n new identities, the last one
+// having the address, e.g. one of BadAddresses.
+func (b *Builder) RosterWithBadAddress(n int, addr network.Address) *onet.Roster {
+	ids := b.ServerIdentities(n - 1)
+	return onet.NewRoster(append(ids, b.identity(addr)))
+}
+
+// RosterWithDuplicateKey returns a roster of n new identities, the last one
+// having the keys, and so the ID, of the first one at its own address. It
+// needs n to be at least 2.
+func (b *Builder) RosterWithDuplicateKey(n int) *onet.Roster {
+	ids := b.ServerIdentities(n)
+	first, last := ids[0], ids[n-1]
+	dup := network.NewServerIdentity(first.Public, last.Address)
+	dup.SetPrivate(first.GetPrivate())
+	dup.ServiceIdentities = first.ServiceIdentities
+	ids[n-1] = dup
+	return onet.NewRoster(ids)
+}
+
+// identity returns a new identity at the address.
+func (b *Builder) identity(addr network.Address) *network.ServerIdentity {
+	kp := key.NewKeyPair(b.suite)
+	si := network.NewServerIdentity(kp.Public, addr)
+	si.SetPrivate(kp.Private)
+	for _, name := range onet.ServiceFactory.RegisteredServiceNames() {
+		suite := onet.ServiceFactory.Suite(name)
+		if suite == nil {
+			continue
+		}
+		seeded, ok := b.services[name]
+		if !ok {
+			seeded = onet.NewSeededSuite(suite, b.seed, "fixtures/"+name)
+			b.services[name] = seeded
+		}
+		sid := network.NewServiceIdentityFromPair(name, suite, key.NewKeyPair(seeded))
+		si.ServiceIdentities = append(si.ServiceIdentities, sid)
+	}
+	return si
+}
@@ -0,0 +1,75 @@
+package fixtures
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+var tSuite = suites.MustFind("Ed25519")
+
+func init() {
+	_, err := onet.RegisterNewServiceWithSuite("fixturesService", suites.MustFind("bn256.adapter"),
+		func(c *onet.Context) (onet.Service, error) { return nil, nil })
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestBuilder_Seed(t *testing.T) {
+	a := New(tSuite, 1).Roster(3)
+	b := New(tSuite, 1).Roster(3)
+	require.True(t, a.ID.Equal(b.ID))
+	for i, si := range a.List {
+		require.Equal(t, si.ID, b.List[i].ID)
+		require.Equal(t, si.Address, b.List[i].Address)
+		require.True(t, si.GetPrivate().Equal(b.List[i].GetPrivate()))
+		require.Equal(t, 1, len(si.ServiceIdentities))
+		require.True(t, si.ServiceIdentities[0].Public.Equal(
+			b.List[i].ServiceIdentities[0].Public))
+	}
+	require.Equal(t, network.NewTCPAddress("127.0.0.1:2004"), a.List[2].Address)
+	require.False(t, a.ID.Equal(New(tSuite, 2).Roster(3).ID))
+
+	f := New(tSuite, 1)
+	first := f.ServerIdentity()
+	require.Equal(t, a.List[0].ID, first.ID)
+	require.NotEqual(t, first.ID, f.ServerIdentity().ID)
+	require.True(t, tSuite.Point().Mul(first.GetPrivate(), nil).Equal(first.Public))
+}
+
+func TestBuilder_Tree(t *testing.T) {
+	f := New(tSuite, 1)
+	tree := f.Tree(7, Nary(2))
+	require.Equal(t, 7, tree.Size())
+	require.Equal(t, 2, len(tree.Root.Children))
+	require.True(t, tree.UsesList())
+
+	tree = f.Tree(5, Star)
+	require.Equal(t, 4, len(tree.Root.Children))
+
+	tree = f.Tree(3, Line)
+	require.Equal(t, 1, len(tree.Root.Children))
+	require.Equal(t, 1, len(tree.Root.Children[0].Children))
+}
+
+func TestBuilder_Malformed(t *testing.T) {
+	for _, addr := range BadAddresses {
+		require.False(t, addr.Valid(), "address %q is valid", addr)
+	}
+
+	f := New(tSuite, 1)
+	ro := f.RosterWithBadAddress(3, BadAddresses[2])
+	require.Equal(t, 3, len(ro.List))
+	require.True(t, ro.List[1].Address.Valid())
+	require.False(t, ro.List[2].Address.Valid())
+
+	ro = f.RosterWithDuplicateKey(3)
+	require.Equal(t, 3, len(ro.List))
+	require.Equal(t, ro.List[0].ID, ro.List[2].ID)
+	require.NotEqual(t, ro.List[0].Address, ro.List[2].Address)
+	require.NotEqual(t, ro.List[0].ID, ro.List[1].ID)
+}
@@ -0,0 +1,226 @@
+package onet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// HealthCheck returns an error if the part of the conode it checks is not
+// healthy.
+type HealthCheck func() error
+
+// HealthChecker can be implemented by a service to be part of the readiness
+// check of the conode.
+type HealthChecker interface {
+	HealthCheck() error
+}
+
+// healthChecks holds the checks reported on the /healthz and /readyz
+// endpoints of the WebSocket.
+type healthChecks struct {
+	sync.Mutex
+	live  map[string]HealthCheck
+	ready map[string]HealthCheck
+}
+
+func newHealthChecks() *healthChecks {
+	return &healthChecks{
+		live:  make(map[string]HealthCheck),
+		ready: make(map[string]HealthCheck),
+	}
+}
+
+// RegisterLivenessCheck adds a check to the /healthz endpoint. A failing
+// liveness check tells the orchestrator that the conode needs a restart.
+func (c *Server) RegisterLivenessCheck(name string, check HealthCheck) {
+	c.health.Lock()
+	defer c.health.Unlock()
+	c.health.live[name] = check
+}
+
+// RegisterReadinessCheck adds a check to the /readyz endpoint. A failing
+// readiness check tells the orchestrator that the conode can't serve
+// requests right now.
+func (c *Server) RegisterReadinessCheck(name string, check HealthCheck) {
+	c.health.Lock()
+	defer c.health.Unlock()
+	c.health.ready[name] = check
+}
+
+// registerHealthEndpoints adds the default checks and serves them on the
+// WebSocket.
+func (c *Server) registerHealthEndpoints() {
+	c.RegisterReadinessCheck("listener", c.listenerCheck)
+	c.RegisterReadinessCheck("storage", cachedCheck(c.storageCheck, storageCheckInterval))
+	c.RegisterReadinessCheck("services", c.servicesCheck)
+	c.WebSocket.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		c.health.serve(w, c.health.live)
+	})
+	c.WebSocket.mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		c.health.serve(w, c.health.ready)
+	})
+	c.WebSocket.mux.HandleFunc("/version", serveVersion)
+}
+
+// VersionInfo is served as JSON on the /version endpoint of the WebSocket,
+// for the tools checking the conodes of a roster.
+type VersionInfo struct {
+	// Version of the main module of the binary, "(devel)" if it isn't known.
+	Version string `json:"version"`
+	// Go is the release of Go the binary was built with.
+	Go string `json:"go"`
+	// Time is the clock of the conode, in nanoseconds since the epoch.
+	Time int64 `json:"time"`
+}
+
+// serveVersion writes the VersionInfo of the conode.
+func serveVersion(w http.ResponseWriter, r *http.Request) {
+	vi := VersionInfo{Go: runtime.Version()}
+	vi.Version, _ = buildVersion()
+	vi.Time = time.Now().UnixNano()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vi)
+}
+
+// serve runs all checks in alphabetical order and writes one line per check.
+// The status code is 503 if any of the checks fails.
+func (h *healthChecks) serve(w http.ResponseWriter, checks map[string]HealthCheck) {
+	h.Lock()
+	var names []string
+	fns := make(map[string]HealthCheck)
+	for name, fn := range checks {
+		names = append(names, name)
+		fns[name] = fn
+	}
+	h.Unlock()
+	sort.Strings(names)
+
+	var out string
+	failed := false
+	for _, name := range names {
+		if err := fns[name](); err != nil {
+			log.Lvl2("health check", name, "failed:", err)
+			out += fmt.Sprintf("[-]%s failed: %v\n", name, err)
+			failed = true
+		} else {
+			out += fmt.Sprintf("[+]%s ok\n", name)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if failed {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		out += "check failed\n"
+	} else {
+		out += "ok\n"
+	}
+	w.Write([]byte(out))
+}
+
+// listenerCheck makes sure the router accepts connections from other
+// conodes.
+func (c *Server) listenerCheck() error {
+	if !c.Router.Listening() {
+		return xerrors.New("router is not listening")
+	}
+	return nil
+}
+
+// storageCheckInterval is how long the result of the storage check is reused,
+// so that probes can't make the conode write to its database all the time.
+var storageCheckInterval = 5 * time.Second
+
+// cachedCheck returns a HealthCheck that runs check at most once every
+// interval and returns the last result in between.
+func cachedCheck(check HealthCheck, interval time.Duration) HealthCheck {
+	var mutex sync.Mutex
+	var last time.Time
+	var lastErr error
+	return func() error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if time.Since(last) >= interval {
+			lastErr = check()
+			last = time.Now()
+		}
+		return lastErr
+	}
+}
+
+// storageCheck makes sure the database is writable.
+func (c *Server) storageCheck() error {
+	bucket := []byte("onet_healthcheck")
+	err := c.serviceManager.store.Update(func(tx StoreTx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+			return err
+		}
+		return tx.DeleteBucket(bucket)
+	})
+	if err != nil {
+		return xerrors.Errorf("db not writable: %v", err)
+	}
+	return nil
+}
+
+// servicesCheck calls HealthCheck on all services implementing
+// HealthChecker.
+func (c *Server) servicesCheck() error {
+	c.serviceManager.servicesMutex.Lock()
+	checkers := make(map[string]HealthChecker)
+	for id, s := range c.serviceManager.services {
+		if hc, ok := s.(HealthChecker); ok {
+			checkers[ServiceFactory.Name(id)] = hc
+		}
+	}
+	c.serviceManager.servicesMutex.Unlock()
+
+	var names []string
+	for name := range checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := checkers[name].HealthCheck(); err != nil {
+			return xerrors.Errorf("service %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// NewRosterCheck returns a HealthCheck that fails if less than threshold
+// members of the roster accept a connection within timeout.
+func NewRosterCheck(ro *Roster, threshold int, timeout time.Duration) HealthCheck {
+	return func() error {
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		reachable := 0
+		for _, si := range ro.List {
+			wg.Add(1)
+			go func(addr string) {
+				defer wg.Done()
+				conn, err := net.DialTimeout("tcp", addr, timeout)
+				if err != nil {
+					return
+				}
+				conn.Close()
+				mutex.Lock()
+				reachable++
+				mutex.Unlock()
+			}(si.Address.NetworkAddress())
+		}
+		wg.Wait()
+		if reachable < threshold {
+			return xerrors.Errorf("only %d out of %d nodes are reachable, "+
+				"need %d", reachable, len(ro.List), threshold)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+package onet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func getHealth(t *testing.T, s *Server, path string) (int, string) {
+	hp, err := getWSHostPort(s.ServerIdentity, false)
+	require.NoError(t, err)
+	resp, err := http.Get("http://" + hp + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestServer_Health(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, ro, _ := local.GenTree(2, false)
+	s := servers[0]
+
+	code, body := getHealth(t, s, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok\n", body)
+
+	code, body = getHealth(t, s, "/readyz")
+	require.Equal(t, http.StatusOK, code, body)
+	require.Contains(t, body, "[+]listener ok")
+	require.Contains(t, body, "[+]storage ok")
+	require.Contains(t, body, "[+]services ok")
+
+	s.RegisterReadinessCheck("roster", NewRosterCheck(ro, 2, time.Second))
+	code, body = getHealth(t, s, "/readyz")
+	require.Equal(t, http.StatusOK, code, body)
+	require.Contains(t, body, "[+]roster ok")
+
+	require.NoError(t, servers[1].Close())
+	code, body = getHealth(t, s, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Contains(t, body, "[-]roster failed: only 1 out of 2")
+
+	s.RegisterLivenessCheck("broken", func() error {
+		return xerrors.New("deadlocked")
+	})
+	code, body = getHealth(t, s, "/healthz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Contains(t, body, "[-]broken failed: deadlocked")
+}
+
+func TestServer_Version(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, _, _ := local.GenTree(1, false)
+
+	before := time.Now().UnixNano()
+	code, body := getHealth(t, servers[0], "/version")
+	require.Equal(t, http.StatusOK, code)
+	var vi VersionInfo
+	require.NoError(t, json.Unmarshal([]byte(body), &vi))
+	require.NotEmpty(t, vi.Version)
+	require.Equal(t, runtime.Version(), vi.Go)
+	require.True(t, vi.Time >= before && vi.Time <= time.Now().UnixNano())
+}
+
+func TestCachedCheck(t *testing.T) {
+	calls := 0
+	check := cachedCheck(func() error {
+		calls++
+		return xerrors.New("failed")
+	}, 50*time.Millisecond)
+	require.Error(t, check())
+	require.Error(t, check())
+	require.Equal(t, 1, calls)
+	time.Sleep(60 * time.Millisecond)
+	require.Error(t, check())
+	require.Equal(t, 2, calls)
+}
@@ -0,0 +1,272 @@
+package onet
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// TransportMode tells a Client how to send the requests to the non-streaming
+// handlers, see SetTransportMode. Streams always use websockets.
+type TransportMode int
+
+const (
+	// TransportWebSocket sends the requests over websockets, which is the
+	// default.
+	TransportWebSocket TransportMode = iota
+	// TransportHTTPPost sends each request in the body of an HTTP POST
+	// request and reads the reply in the body of the response, for the
+	// networks where websockets are blocked.
+	TransportHTTPPost
+	// TransportAuto uses websockets, unless a conode refuses the websocket
+	// handshake, e.g., because a proxy in between doesn't support it. The
+	// requests to this conode are then sent with HTTP POST.
+	TransportAuto
+)
+
+// SetTransportMode sets how the requests are sent. The dialer, the proxy and
+// the TLS configuration of the client are used by the HTTP requests as well,
+// as they are set at the first one.
+func (c *Client) SetTransportMode(m TransportMode) {
+	c.Lock()
+	defer c.Unlock()
+	c.transport = m
+}
+
+// postError is returned when the conode answers an HTTP POST request with an
+// error.
+type postError struct {
+	status int
+	msg    string
+}
+
+func (e *postError) Error() string {
+	return http.StatusText(e.status) + ": " + e.msg
+}
+
+// Unwrap returns the error of the conode, if it is known to the client.
+func (e *postError) Unwrap() error {
+	switch e.status {
+	case http.StatusServiceUnavailable:
+		return ErrMaintenance
+	case http.StatusForbidden:
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// sendTransport sends the request with the transport of the client.
+func (c *Client) sendTransport(ctx context.Context, dst *network.ServerIdentity,
+	path string, buf []byte) ([]byte, bool, error) {
+	c.Lock()
+	mode := c.transport
+	postOnly := c.postOnly[postKey(dst)]
+	c.Unlock()
+	if mode == TransportHTTPPost || mode == TransportAuto && postOnly {
+		return c.post(ctx, dst, path, buf)
+	}
+
+	rcv, delivered, err := c.sendConn(ctx, dst, path, buf)
+	if mode == TransportAuto && !delivered && xerrors.Is(err, websocket.ErrBadHandshake) {
+		log.Lvl2("Websocket to", dst, "refused, using HTTP POST:", err)
+		c.Lock()
+		c.postOnly[postKey(dst)] = true
+		c.Unlock()
+		return c.post(ctx, dst, path, buf)
+	}
+	return rcv, delivered, err
+}
+
+// postKey returns the key of the conode in Client.postOnly: how it is
+// reached, as conodes with the same identity may be reached differently.
+func postKey(dst *network.ServerIdentity) string {
+	if dst.URL != "" {
+		return dst.URL
+	}
+	return dst.Address.NetworkAddress()
+}
+
+// post sends the request in an HTTP POST request. It also returns whether the
+// request may have reached the conode.
+func (c *Client) post(ctx context.Context, dst *network.ServerIdentity, path string,
+	buf []byte) ([]byte, bool, error) {
+	var query url.Values
+	if deadline, ok := ctx.Deadline(); ok {
+		if time.Until(deadline) <= 0 {
+			return nil, false, xerrors.Errorf("deadline: %w", context.DeadlineExceeded)
+		}
+		query = url.Values{TimeoutQuery: []string{time.Until(deadline).String()}}
+	}
+	u, header, err := c.serviceURL(dst, path, query)
+	if err != nil {
+		return nil, false, err
+	}
+	sig, err := c.requestSignature(ctx, dst, path, buf)
+	if err != nil {
+		return nil, false, xerrors.Errorf("signing: %v", err)
+	}
+	if sig != "" {
+		header.Set(SignatureHeader, sig)
+	}
+	client := c.postClient()
+
+	log.Lvlf4("Posting %x to %s/%s", buf, c.service, path)
+	policy := c.retryPolicy()
+	budget := retryBudgetFrom(ctx)
+	var resp *http.Response
+	for a := 0; ; a++ {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, u.String(),
+			bytes.NewReader(buf))
+		if err != nil {
+			return nil, false, xerrors.Errorf("new request: %v", err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		resp, err = client.Do(req)
+		if err == nil || !dialFailed(err) || a+1 >= policy.MaxAttempts {
+			break
+		}
+		wait := policy.backoff(a)
+		if !budget.spend(wait) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, false, xerrors.Errorf("post: %w", ctx.Err())
+		case <-c.getClock().After(wait):
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, true, xerrors.Errorf("waiting for reply: %w", ctx.Err())
+		}
+		return nil, !dialFailed(err), xerrors.Errorf("post: %w", err)
+	}
+	defer resp.Body.Close()
+	c.Lock()
+	c.tx += uint64(len(buf))
+	c.Unlock()
+
+	rcv, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, true, xerrors.Errorf("waiting for reply: %w", ctx.Err())
+		}
+		return nil, true, xerrors.Errorf("reading reply: %v", err)
+	}
+	c.Lock()
+	c.rx += uint64(len(rcv))
+	c.Unlock()
+	if resp.StatusCode != http.StatusOK {
+		return nil, true, xerrors.Errorf("post: %w",
+			&postError{status: resp.StatusCode, msg: strings.TrimSpace(string(rcv))})
+	}
+	log.Lvlf4("Received %x", rcv)
+	return rcv, true, nil
+}
+
+// dialFailed returns whether the HTTP request failed because the connection
+// couldn't be opened, so that it hasn't been sent.
+func dialFailed(err error) bool {
+	var oe *net.OpError
+	return xerrors.As(err, &oe) && oe.Op == "dial"
+}
+
+// postClient returns the HTTP client of the POST requests.
+func (c *Client) postClient() *http.Client {
+	c.Lock()
+	defer c.Unlock()
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Transport: &http.Transport{
+			Proxy:           c.Proxy,
+			DialContext:     c.NetDialContext,
+			TLSClientConfig: c.TLSClientConfig,
+		}}
+	}
+	return c.httpClient
+}
+
+// servePost answers a request to a non-streaming handler sent in the body of
+// an HTTP POST request. The reply is in the body of the response, or the
+// error if the status isn't 200.
+func (t wsHandler) servePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/"+t.serviceName+"/")
+	log.Lvlf2("post request from %s: %s/%s", r.RemoteAddr, t.serviceName, path)
+
+	if bs, ok := t.service.(BidirectionalStreamer); ok {
+		isStreaming, err := bs.IsStreaming(path)
+		if err != nil {
+			log.Errorf("failed to check if it is a streaming "+
+				"request %s/%s: %+v", t.serviceName, path, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if isStreaming {
+			http.Error(w, "streaming requests need a websocket", http.StatusBadRequest)
+			return
+		}
+	}
+
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Lvl2("reading request from", r.RemoteAddr, ":", err)
+		return
+	}
+	var timeout time.Duration
+	if q := r.URL.Query().Get(TimeoutQuery); q != "" {
+		timeout, err = time.ParseDuration(q)
+		if err != nil {
+			log.Warn("invalid timeout from", r.RemoteAddr, ":", err)
+		}
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(r.Context(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(r.Context())
+	}
+	defer cancel()
+	if h := r.Header.Get(SignatureHeader); h != "" {
+		rs, err := decodeRequestSignature(h)
+		if err != nil {
+			http.Error(w, "invalid signature: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx = context.WithValue(ctx, requestSignatureKey{}, rs)
+	}
+
+	reply, err := t.handleRequest(ctx, r, path, buf)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case xerrors.Is(err, ErrMaintenance):
+			status = http.StatusServiceUnavailable
+		case xerrors.Is(err, ErrUnauthorized):
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := w.Write(reply); err != nil {
+		log.Lvl2("writing reply to", r.RemoteAddr, ":", err)
+	}
+}
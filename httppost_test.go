@@ -0,0 +1,119 @@
+package onet
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+func TestWebSocket_Post(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(2, false)
+	hp, err := getWSHostPort(roster.List[0], false)
+	require.NoError(t, err)
+	base := "http://" + hp + "/" + serviceWebSocket + "/"
+	defer http.DefaultClient.CloseIdleConnections()
+
+	buf, err := protobuf.Encode(&SimpleResponse{})
+	require.NoError(t, err)
+	resp, err := http.Post(base+"SimpleResponse", "application/octet-stream", bytes.NewReader(buf))
+	require.NoError(t, err)
+	reply, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	sr := &SimpleResponse{}
+	require.NoError(t, protobuf.Decode(reply, sr))
+	require.Equal(t, int64(1), sr.Val)
+
+	buf, err = protobuf.Encode(&ErrorRequest{Roster: *roster, Flags: 1})
+	require.NoError(t, err)
+	resp, err = http.Post(base+"ErrorRequest", "application/octet-stream", bytes.NewReader(buf))
+	require.NoError(t, err)
+	reply, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	require.Contains(t, string(reply), "found in flags")
+}
+
+func TestClient_TransportHTTPPost(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(2, false)
+
+	cl := NewClient(tSuite, serviceWebSocket)
+	defer cl.Close()
+	cl.SetTransportMode(TransportHTTPPost)
+	sr := &SimpleResponse{}
+	require.NoError(t, cl.SendProtobuf(roster.List[0], &SimpleResponse{}, sr))
+	require.Equal(t, int64(1), sr.Val)
+	require.Empty(t, cl.connections)
+	require.NotZero(t, cl.Rx())
+	require.NotZero(t, cl.Tx())
+
+	err := cl.SendProtobuf(roster.List[0], &ErrorRequest{Roster: *roster, Flags: 1}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "found in flags")
+	var pe *postError
+	require.True(t, xerrors.As(err, &pe))
+	require.False(t, canFailover(err, true, nil, "ErrorRequest"))
+}
+
+func TestClient_TransportAuto(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(1, false)
+	hp, err := getWSHostPort(roster.List[0], false)
+	require.NoError(t, err)
+
+	// a proxy that doesn't support websockets
+	defer http.DefaultClient.CloseIdleConnections()
+	var posts int
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			http.Error(w, "no websockets", http.StatusForbidden)
+			return
+		}
+		posts++
+		u := url.URL{Scheme: "http", Host: hp, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		resp, err := http.Post(u.String(), r.Header.Get("Content-Type"), r.Body)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+	si := network.NewServerIdentity(roster.List[0].Public, network.NewTCPAddress(proxy.Listener.Addr().String()))
+	si.URL = proxy.URL
+
+	cl := NewClient(tSuite, serviceWebSocket)
+	defer cl.Close()
+	require.Error(t, cl.SendProtobuf(si, &SimpleResponse{}, &SimpleResponse{}))
+	require.Equal(t, 0, posts)
+
+	cl.SetTransportMode(TransportAuto)
+	sr := &SimpleResponse{}
+	require.NoError(t, cl.SendProtobuf(si, &SimpleResponse{}, sr))
+	require.Equal(t, int64(1), sr.Val)
+	require.Equal(t, 1, posts)
+	// the next requests don't try the websocket again
+	require.NoError(t, cl.SendProtobuf(si, &SimpleResponse{}, sr))
+	require.Equal(t, 2, posts)
+
+	// a conode that can't be reached isn't assumed to refuse websockets
+	dead := network.NewServerIdentity(roster.List[0].Public, network.NewTCPAddress("127.0.0.1:1"))
+	require.Error(t, cl.SendProtobuf(dead, &SimpleResponse{}, sr))
+	require.False(t, cl.postOnly[postKey(dead)])
+}
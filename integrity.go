@@ -0,0 +1,453 @@
+package onet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// integrityRoots holds the checksum of every bucket: the XOR of the hashes
+// of its keys and values, updated on every write. The hashes of the keys of
+// a bucket are in its companion bucket, named integrityRoots, "_" and the
+// name of the bucket.
+var integrityRoots = []byte("onet_integrity")
+
+// integrityReportMax is the maximum number of corrupted keys reported by a
+// verification.
+const integrityReportMax = 1000
+
+// IntegrityError is a key failing the integrity verification of the
+// database.
+type IntegrityError struct {
+	Bucket string
+	// Key is hex-encoded.
+	Key     string
+	Problem string
+}
+
+// IntegrityReport is the result of the integrity verification of the
+// database.
+type IntegrityReport struct {
+	Time      time.Time
+	Buckets   int
+	Keys      int
+	Corrupted []IntegrityError
+}
+
+func isIntegrityBucket(name []byte) bool {
+	return bytes.HasPrefix(name, integrityRoots)
+}
+
+func integrityCompanion(name []byte) []byte {
+	return append(append(append([]byte{}, integrityRoots...), '_'), name...)
+}
+
+// integrityHash returns the hash of the key and its value.
+func integrityHash(key, value []byte) []byte {
+	h := sha256.New()
+	var l [binary.MaxVarintLen64]byte
+	h.Write(l[:binary.PutUvarint(l[:], uint64(len(key)))])
+	h.Write(key)
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+func xorInto(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// integrityStore keeps the checksums of the buckets of the wrapped Store up
+// to date, and doesn't return the values that don't match them.
+type integrityStore struct {
+	Store
+}
+
+// newIntegrityStore returns a store maintaining the checksums of s. They are
+// computed from the data if s has none yet, e.g., because the checksums were
+// just enabled or a snapshot was restored.
+func newIntegrityStore(s Store) (*integrityStore, error) {
+	err := s.Update(func(tx StoreTx) error {
+		if tx.Bucket(integrityRoots) != nil {
+			return nil
+		}
+		return rebuildIntegrity(tx)
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("integrity store: %v", err)
+	}
+	return &integrityStore{Store: s}, nil
+}
+
+// integrityBuckets returns the names of the buckets holding the checksums.
+func integrityBuckets(tx StoreTx) ([][]byte, error) {
+	var names [][]byte
+	err := tx.ForEach(func(name []byte, b StoreBucket) error {
+		if isIntegrityBucket(name) {
+			names = append(names, append([]byte{}, name...))
+		}
+		return nil
+	})
+	return names, err
+}
+
+// dropIntegrity removes the checksums of s, so that they are computed again
+// when they are enabled.
+func dropIntegrity(s Store) error {
+	return s.Update(func(tx StoreTx) error {
+		names, err := integrityBuckets(tx)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := tx.DeleteBucket(name); err != nil {
+				return xerrors.Errorf("deleting %s: %v", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// rebuildIntegrity computes the checksums of all the buckets.
+func rebuildIntegrity(tx StoreTx) error {
+	old, err := integrityBuckets(tx)
+	if err != nil {
+		return xerrors.Errorf("listing buckets: %v", err)
+	}
+	for _, name := range old {
+		if err := tx.DeleteBucket(name); err != nil {
+			return xerrors.Errorf("deleting %s: %v", name, err)
+		}
+	}
+	roots, err := tx.CreateBucketIfNotExists(integrityRoots)
+	if err != nil {
+		return xerrors.Errorf("creating bucket: %v", err)
+	}
+	var names [][]byte
+	err = tx.ForEach(func(name []byte, b StoreBucket) error {
+		if !isIntegrityBucket(name) {
+			names = append(names, append([]byte{}, name...))
+		}
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("listing buckets: %v", err)
+	}
+	var n int
+	for _, name := range names {
+		comp, err := tx.CreateBucketIfNotExists(integrityCompanion(name))
+		if err != nil {
+			return xerrors.Errorf("creating bucket: %v", err)
+		}
+		root := make([]byte, sha256.Size)
+		err = tx.Bucket(name).ForEach(func(k, v []byte) error {
+			// nil for a nested bucket
+			if v == nil {
+				return nil
+			}
+			h := integrityHash(k, v)
+			xorInto(root, h)
+			n++
+			return comp.Put(k, h)
+		})
+		if err != nil {
+			return xerrors.Errorf("hashing %s: %v", name, err)
+		}
+		if err := roots.Put(name, root); err != nil {
+			return err
+		}
+	}
+	log.Lvl2("Computed the checksums of", n, "values")
+	return nil
+}
+
+func (s *integrityStore) View(fn func(tx StoreTx) error) error {
+	return s.Store.View(func(tx StoreTx) error {
+		return fn(&integrityTx{StoreTx: tx})
+	})
+}
+
+func (s *integrityStore) Update(fn func(tx StoreTx) error) error {
+	return s.Store.Update(func(tx StoreTx) error {
+		itx := &integrityTx{StoreTx: tx, roots: make(map[string][]byte)}
+		if err := fn(itx); err != nil {
+			return err
+		}
+		return itx.flush()
+	})
+}
+
+// verify checks the values of all the buckets against their checksums.
+func (s *integrityStore) verify() (*IntegrityReport, error) {
+	report := &IntegrityReport{Time: time.Now()}
+	corrupted := func(bucket, key []byte, problem string) {
+		if len(report.Corrupted) < integrityReportMax {
+			report.Corrupted = append(report.Corrupted, IntegrityError{
+				Bucket:  string(bucket),
+				Key:     hex.EncodeToString(key),
+				Problem: problem,
+			})
+		}
+	}
+	err := s.Store.View(func(tx StoreTx) error {
+		roots := tx.Bucket(integrityRoots)
+		if roots == nil {
+			return xerrors.New("no checksums")
+		}
+		err := tx.ForEach(func(name []byte, b StoreBucket) error {
+			if isIntegrityBucket(name) {
+				return nil
+			}
+			report.Buckets++
+			root := make([]byte, sha256.Size)
+			err := b.ForEach(func(k, v []byte) error {
+				if v != nil {
+					xorInto(root, integrityHash(k, v))
+					report.Keys++
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			stored := roots.Get(name)
+			if stored == nil {
+				// an empty bucket never written
+				stored = make([]byte, sha256.Size)
+			}
+			if bytes.Equal(root, stored) {
+				return nil
+			}
+
+			// find the keys not matching
+			comp := tx.Bucket(integrityCompanion(name))
+			if comp == nil {
+				corrupted(name, nil, "no checksums")
+				return nil
+			}
+			err = b.ForEach(func(k, v []byte) error {
+				if v == nil {
+					return nil
+				}
+				h := comp.Get(k)
+				if h == nil {
+					corrupted(name, k, "no checksum")
+				} else if !bytes.Equal(h, integrityHash(k, v)) {
+					corrupted(name, k, "checksum mismatch")
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			return comp.ForEach(func(k, _ []byte) error {
+				if b.Get(k) == nil {
+					corrupted(name, k, "missing value")
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+		return roots.ForEach(func(name, _ []byte) error {
+			if tx.Bucket(name) == nil {
+				corrupted(name, nil, "missing bucket")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("verifying: %v", err)
+	}
+	return report, nil
+}
+
+// integrityTx updates the checksums of the buckets written in the
+// transaction, and writes them at its end.
+type integrityTx struct {
+	StoreTx
+	// roots written in the transaction, nil for a deleted bucket
+	roots map[string][]byte
+}
+
+// root returns the checksum of the bucket, as updated in the transaction.
+func (tx *integrityTx) root(name []byte) []byte {
+	if r, ok := tx.roots[string(name)]; ok {
+		if r == nil {
+			// the bucket has been deleted in the transaction
+			r = make([]byte, sha256.Size)
+			tx.roots[string(name)] = r
+		}
+		return r
+	}
+	r := make([]byte, sha256.Size)
+	if roots := tx.StoreTx.Bucket(integrityRoots); roots != nil {
+		if old := roots.Get(name); len(old) == sha256.Size {
+			copy(r, old)
+		}
+	}
+	tx.roots[string(name)] = r
+	return r
+}
+
+func (tx *integrityTx) flush() error {
+	if len(tx.roots) == 0 {
+		return nil
+	}
+	roots, err := tx.StoreTx.CreateBucketIfNotExists(integrityRoots)
+	if err != nil {
+		return xerrors.Errorf("creating bucket: %v", err)
+	}
+	for name, r := range tx.roots {
+		if r == nil {
+			err = roots.Delete([]byte(name))
+		} else {
+			err = roots.Put([]byte(name), r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *integrityTx) wrap(name []byte, b StoreBucket) StoreBucket {
+	if isIntegrityBucket(name) {
+		return b
+	}
+	return integrityBucket{StoreBucket: b, tx: tx, name: append([]byte{}, name...)}
+}
+
+func (tx *integrityTx) Bucket(name []byte) StoreBucket {
+	b := tx.StoreTx.Bucket(name)
+	if b == nil {
+		return nil
+	}
+	return tx.wrap(name, b)
+}
+
+func (tx *integrityTx) CreateBucketIfNotExists(name []byte) (StoreBucket, error) {
+	b, err := tx.StoreTx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+	return tx.wrap(name, b), nil
+}
+
+func (tx *integrityTx) DeleteBucket(name []byte) error {
+	if err := tx.StoreTx.DeleteBucket(name); err != nil {
+		return err
+	}
+	if isIntegrityBucket(name) {
+		return nil
+	}
+	comp := integrityCompanion(name)
+	if tx.StoreTx.Bucket(comp) != nil {
+		if err := tx.StoreTx.DeleteBucket(comp); err != nil {
+			return err
+		}
+	}
+	tx.roots[string(name)] = nil
+	return nil
+}
+
+// ForEach doesn't show the buckets of the checksums.
+func (tx *integrityTx) ForEach(fn func(name []byte, b StoreBucket) error) error {
+	return tx.StoreTx.ForEach(func(name []byte, b StoreBucket) error {
+		if isIntegrityBucket(name) {
+			return nil
+		}
+		return fn(name, tx.wrap(name, b))
+	})
+}
+
+// integrityBucket checks the values read with Get against their checksums.
+// The values given to ForEach are not checked: this is left to the
+// verification of the whole database.
+type integrityBucket struct {
+	StoreBucket
+	tx   *integrityTx
+	name []byte
+}
+
+func (b integrityBucket) Get(key []byte) []byte {
+	v := b.StoreBucket.Get(key)
+	if v == nil {
+		return nil
+	}
+	var h []byte
+	if comp := b.tx.StoreTx.Bucket(integrityCompanion(b.name)); comp != nil {
+		h = comp.Get(key)
+	}
+	if !bytes.Equal(h, integrityHash(key, v)) {
+		log.Errorf("Value of key %x in %s doesn't match its checksum", key, b.name)
+		return nil
+	}
+	return v
+}
+
+func (b integrityBucket) Put(key, value []byte) error {
+	if err := b.StoreBucket.Put(key, value); err != nil {
+		return err
+	}
+	comp, err := b.tx.StoreTx.CreateBucketIfNotExists(integrityCompanion(b.name))
+	if err != nil {
+		return xerrors.Errorf("creating bucket: %v", err)
+	}
+	root := b.tx.root(b.name)
+	if old := comp.Get(key); len(old) == sha256.Size {
+		xorInto(root, old)
+	}
+	h := integrityHash(key, value)
+	xorInto(root, h)
+	return comp.Put(key, h)
+}
+
+func (b integrityBucket) Delete(key []byte) error {
+	if err := b.StoreBucket.Delete(key); err != nil {
+		return err
+	}
+	comp := b.tx.StoreTx.Bucket(integrityCompanion(b.name))
+	if comp == nil {
+		return nil
+	}
+	old := comp.Get(key)
+	if old == nil {
+		return nil
+	}
+	if len(old) == sha256.Size {
+		xorInto(b.tx.root(b.name), old)
+	}
+	return comp.Delete(key)
+}
+
+// VerifyStorage checks all the values of the database against their
+// checksums, which are maintained if ServerOptions.StorageIntegrity is set.
+func (c *Server) VerifyStorage() (*IntegrityReport, error) {
+	return c.serviceManager.verifyIntegrity()
+}
+
+func (s *serviceManager) verifyIntegrity() (*IntegrityReport, error) {
+	is, ok := s.store.(*integrityStore)
+	if !ok {
+		return nil, xerrors.New("the checksums of the database are disabled")
+	}
+	report, err := is.verify()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range report.Corrupted {
+		log.Errorf("Corrupted key %s in %s: %s", c.Key, c.Bucket, c.Problem)
+	}
+	s.integrityMutex.Lock()
+	s.integrity = report
+	s.integrityMutex.Unlock()
+	return report, nil
+}
@@ -0,0 +1,145 @@
+package onet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestIntegrityStore(t *testing.T) {
+	raw := NewMemoryStore()
+	require.NoError(t, raw.Update(func(tx StoreTx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("old"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("k"), []byte("v"))
+	}))
+	es, err := newEncryptedStore(raw, bytes.Repeat([]byte{1}, storageKeySize))
+	require.NoError(t, err)
+
+	// the checksums of the existing data are computed
+	is, err := newIntegrityStore(es)
+	require.NoError(t, err)
+	report, err := is.verify()
+	require.NoError(t, err)
+	require.Empty(t, report.Corrupted)
+	// with the key checking the encryption
+	require.Equal(t, 2, report.Keys)
+
+	require.NoError(t, is.Update(func(tx StoreTx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("a"))
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"1", "2", "3"} {
+			if err := b.Put([]byte(k), []byte("value"+k)); err != nil {
+				return err
+			}
+		}
+		if err := b.Put([]byte("1"), []byte("new")); err != nil {
+			return err
+		}
+		if err := b.Delete([]byte("3")); err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte("empty"))
+		return err
+	}))
+	require.NoError(t, is.Update(func(tx StoreTx) error {
+		if err := tx.DeleteBucket([]byte("old")); err != nil {
+			return err
+		}
+		// the checksum buckets are hidden
+		return tx.ForEach(func(name []byte, b StoreBucket) error {
+			require.False(t, isIntegrityBucket(name))
+			return nil
+		})
+	}))
+	report, err = is.verify()
+	require.NoError(t, err)
+	require.Empty(t, report.Corrupted)
+	require.Equal(t, 3, report.Keys)
+
+	// writes behind the back of the store are found
+	require.NoError(t, es.Update(func(tx StoreTx) error {
+		b := tx.Bucket([]byte("a"))
+		if err := b.Put([]byte("1"), []byte("garbage")); err != nil {
+			return err
+		}
+		if err := b.Put([]byte("4"), []byte("unknown")); err != nil {
+			return err
+		}
+		return b.Delete([]byte("2"))
+	}))
+	require.NoError(t, is.View(func(tx StoreTx) error {
+		require.Nil(t, tx.Bucket([]byte("a")).Get([]byte("1")))
+		return nil
+	}))
+	report, err = is.verify()
+	require.NoError(t, err)
+	problems := make(map[string]string)
+	for _, c := range report.Corrupted {
+		require.Equal(t, "a", c.Bucket)
+		k, err := hex.DecodeString(c.Key)
+		require.NoError(t, err)
+		problems[string(k)] = c.Problem
+	}
+	require.Equal(t, map[string]string{
+		"1": "checksum mismatch",
+		"2": "missing value",
+		"4": "no checksum",
+	}, problems)
+
+	// dropping the checksums accepts the data as it is
+	require.NoError(t, dropIntegrity(es))
+	is, err = newIntegrityStore(es)
+	require.NoError(t, err)
+	report, err = is.verify()
+	require.NoError(t, err)
+	require.Empty(t, report.Corrupted)
+}
+
+func TestServer_VerifyStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "integrity")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	priv, id := NewPrivIdentity(tSuite, 0)
+	router, err := network.NewLocalRouter(id, tSuite)
+	require.NoError(t, err)
+	c := newServerWithOptions(tSuite, dir, router, priv,
+		ServerOptions{StorageIntegrity: true})
+	defer c.Close()
+	require.Equal(t, "0", c.serviceManager.GetStatus().Field["Integrity.Corrupted"])
+
+	ctx := serviceContext(c, serviceWebSocket)
+	require.NoError(t, ctx.Save([]byte("k"), &SimpleResponse{Val: 1}))
+	require.Panics(t, func() { ctx.GetAdditionalBucket([]byte("raw")) })
+	require.NoError(t, unwrapStore(c.serviceManager.store).Update(func(tx StoreTx) error {
+		return tx.Bucket(ctx.bucketName).Put([]byte("k"), []byte("garbage"))
+	}))
+	msg, err := ctx.Load([]byte("k"))
+	require.NoError(t, err)
+	require.Nil(t, msg)
+	report, err := c.VerifyStorage()
+	require.NoError(t, err)
+	require.Len(t, report.Corrupted, 1)
+	require.Equal(t, "1", c.serviceManager.GetStatus().Field["Integrity.Corrupted"])
+
+	// the checksums are disabled by default
+	dir2, err := ioutil.TempDir("", "integrity")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir2)
+	router2, err := network.NewLocalRouter(id, tSuite)
+	require.NoError(t, err)
+	c2 := newServerWithOptions(tSuite, dir2, router2, priv, ServerOptions{})
+	defer c2.Close()
+	_, err = c2.VerifyStorage()
+	require.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package onet
+
+import (
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/network"
+)
+
+// Interception is a message intercepted on its way from a server to
+// another, which is only sent with Deliver.
+type Interception struct {
+	From *network.ServerIdentity
+	To   *network.ServerIdentity
+	// Msg is the intercepted message, which can be changed before it is
+	// delivered.
+	Msg     network.Message
+	deliver func(network.Message) error
+}
+
+// Deliver sends the message to its destination. It can be called later, or
+// several times.
+func (i *Interception) Deliver() error {
+	return i.deliver(i.Msg)
+}
+
+// Interceptor is called with the intercepted messages, in the goroutine
+// sending them. It can inspect and change them, and deliver them at once,
+// later, out of order, or never.
+type Interceptor func(i *Interception)
+
+// DropMessages returns an interceptor dropping the messages.
+func DropMessages() Interceptor {
+	return func(*Interception) {}
+}
+
+// DelayMessages returns an interceptor delivering the messages after d, in
+// the order they were sent.
+func DelayMessages(d time.Duration) Interceptor {
+	var lock sync.Mutex
+	// previous is closed once the previous message is delivered
+	var previous chan struct{}
+	return func(i *Interception) {
+		lock.Lock()
+		prev := previous
+		done := make(chan struct{})
+		previous = done
+		lock.Unlock()
+		go func() {
+			defer close(done)
+			time.Sleep(d)
+			if prev != nil {
+				<-prev
+			}
+			i.Deliver()
+		}()
+	}
+}
+
+// interceptor intercepts the messages of a type sent by a server, to a
+// single server or to all of them.
+type interceptor struct {
+	msgType network.MessageTypeID
+	to      network.ServerIdentityID
+	f       Interceptor
+}
+
+type interceptors struct {
+	list []*interceptor
+	sync.Mutex
+}
+
+// intercept calls f with the messages of the given type sent by the server
+// to the other one, or to every server if to is nil, until the returned
+// function is called. A nil msgType intercepts all the types. The messages
+// are the ones of the protocols and the ones sent with Context.SendRaw.
+func (c *Server) intercept(msgType network.MessageTypeID,
+	to *network.ServerIdentity, f Interceptor) func() {
+	icept := &interceptor{msgType: msgType, f: f}
+	if to != nil {
+		icept.to = to.ID
+	}
+	c.interceptors.Lock()
+	defer c.interceptors.Unlock()
+	c.interceptors.list = append(c.interceptors.list, icept)
+	return func() {
+		c.interceptors.Lock()
+		defer c.interceptors.Unlock()
+		for i, other := range c.interceptors.list {
+			if other == icept {
+				c.interceptors.list = append(c.interceptors.list[:i],
+					c.interceptors.list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// intercepted gives msg to the first interceptor of its type and
+// destination, and returns true, or returns false if there is none.
+// deliver sends the message.
+func (c *Server) intercepted(to *network.ServerIdentity, msg network.Message,
+	deliver func(network.Message) error) bool {
+	msgType := network.MessageType(msg)
+	var f Interceptor
+	c.interceptors.Lock()
+	for _, icept := range c.interceptors.list {
+		if (icept.msgType.IsNil() || icept.msgType.Equal(msgType)) &&
+			(icept.to.IsNil() || icept.to.Equal(to.ID)) {
+			f = icept.f
+			break
+		}
+	}
+	c.interceptors.Unlock()
+	if f == nil {
+		return false
+	}
+	f(&Interception{From: c.ServerIdentity, To: to, Msg: msg, deliver: deliver})
+	return true
+}
+
+// Intercept calls f with the messages of the given type that the server
+// from sends to the server to, instead of sending them, until the returned
+// function is called. A nil from or to stands for all the servers of the
+// test, and network.ErrorType for all the types of messages. The messages are the ones of the protocols and the ones sent with
+// Context.SendRaw. For a message, only the first interceptor registered for
+// it is called.
+func (l *LocalTest) Intercept(msgType network.MessageTypeID, from, to *Server,
+	f Interceptor) func() {
+	l.panicClosed()
+	var toID *network.ServerIdentity
+	if to != nil {
+		toID = to.ServerIdentity
+	}
+	var stops []func()
+	for _, server := range l.Servers {
+		if from == nil || server == from {
+			stops = append(stops, server.intercept(msgType, toID, f))
+		}
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
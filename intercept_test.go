@@ -0,0 +1,111 @@
+package onet
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// interceptProtocol sends 1 and 2 to its children, which report the values
+// they receive.
+type interceptProtocol struct {
+	*TreeNodeInstance
+	received chan int64
+	count    int
+}
+
+func (p *interceptProtocol) Start() error {
+	defer p.Done()
+	for _, i := range []int64{1, 2} {
+		if err := p.SendToChildren(&SimpleMessage{i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *interceptProtocol) receive(msg MsgSimpleMessage) error {
+	p.received <- msg.I
+	p.count++
+	if p.count == 2 {
+		p.Done()
+	}
+	return nil
+}
+
+func TestLocalTest_Intercept(t *testing.T) {
+	received := make(chan int64, 10)
+	_, err := GlobalProtocolRegister("interceptTest", func(n *TreeNodeInstance) (ProtocolInstance, error) {
+		p := &interceptProtocol{TreeNodeInstance: n, received: received}
+		return p, p.RegisterHandler(p.receive)
+	})
+	require.NoError(t, err)
+
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(2, true)
+	msgType := network.MessageType(&SimpleMessage{})
+
+	run := func() []int64 {
+		_, err := servers[0].StartProtocol("interceptTest", tree)
+		require.NoError(t, err)
+		var values []int64
+		for {
+			select {
+			case v := <-received:
+				values = append(values, v)
+			case <-time.After(300 * time.Millisecond):
+				return values
+			}
+		}
+	}
+
+	// the messages the other way are not intercepted
+	stop := local.Intercept(msgType, servers[1], servers[0], DropMessages())
+	require.Equal(t, []int64{1, 2}, run())
+	stop()
+
+	stop = local.Intercept(msgType, servers[0], nil, DropMessages())
+	require.Empty(t, run())
+	stop()
+
+	stop = local.Intercept(msgType, nil, servers[1], func(i *Interception) {
+		require.Equal(t, servers[0].ServerIdentity, i.From)
+		require.Equal(t, servers[1].ServerIdentity, i.To)
+		i.Msg = &SimpleMessage{i.Msg.(*SimpleMessage).I * 10}
+		require.NoError(t, i.Deliver())
+	})
+	require.Equal(t, []int64{10, 20}, run())
+	stop()
+
+	// the first message is delivered after the second
+	var held *Interception
+	var lock sync.Mutex
+	stop = local.Intercept(msgType, servers[0], servers[1], func(i *Interception) {
+		lock.Lock()
+		defer lock.Unlock()
+		if held == nil {
+			held = i
+			return
+		}
+		require.NoError(t, i.Deliver())
+		require.NoError(t, held.Deliver())
+	})
+	require.Equal(t, []int64{2, 1}, run())
+	stop()
+
+	stop = local.Intercept(msgType, servers[0], servers[1],
+		DelayMessages(100*time.Millisecond))
+	start := time.Now()
+	_, err = servers[0].StartProtocol("interceptTest", tree)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), <-received)
+	require.True(t, time.Since(start) >= 100*time.Millisecond)
+	require.Equal(t, int64(2), <-received)
+	stop()
+
+	require.Equal(t, []int64{1, 2}, run())
+}
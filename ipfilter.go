@@ -0,0 +1,27 @@
+package onet
+
+import (
+	"fmt"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// IPFilter returns the networks allowed and denied to connect to the router
+// and the websocket of the server.
+func (c *Server) IPFilter() network.IPFilterConfig {
+	return c.ipFilter.Config()
+}
+
+// SetIPFilter replaces the networks allowed and denied to connect to the
+// router and the websocket of the server. The refused connections are closed
+// before their TLS handshake. The connections already open are kept.
+func (c *Server) SetIPFilter(cfg network.IPFilterConfig) error {
+	if err := c.ipFilter.Set(cfg); err != nil {
+		return err
+	}
+	log.Lvl2(c.ServerIdentity.Address, "allows", cfg.Allow, "and denies", cfg.Deny)
+	c.events.publish(Event{Type: EventConfigReloaded,
+		Message: fmt.Sprint("IP filter set to allow ", cfg.Allow, " and deny ", cfg.Deny)})
+	return nil
+}
@@ -0,0 +1,38 @@
+package onet
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestServer_IPFilter(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, _, _ := local.GenTree(1, false)
+	s := servers[0]
+	hp, err := getWSHostPort(s.ServerIdentity, false)
+	require.NoError(t, err)
+
+	events, unsubscribe := s.Subscribe(EventConfigReloaded)
+	defer unsubscribe()
+	deny := network.IPFilterConfig{Deny: []string{"127.0.0.0/8", "::1"}}
+	require.NoError(t, s.SetIPFilter(deny))
+	require.Equal(t, deny, s.IPFilter())
+	ev := <-events
+	require.Contains(t, ev.Message, "deny [127.0.0.0/8 ::1]")
+	_, err = http.Get("http://" + hp + "/ok")
+	require.Error(t, err)
+
+	// an invalid filter keeps the previous one
+	require.Error(t, s.SetIPFilter(network.IPFilterConfig{Allow: []string{"localhost"}}))
+	require.Equal(t, deny, s.IPFilter())
+
+	require.NoError(t, s.SetIPFilter(network.IPFilterConfig{}))
+	resp, err := http.Get("http://" + hp + "/ok")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
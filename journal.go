@@ -0,0 +1,236 @@
+package onet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// journalBucket holds the batches of every service that are written but not
+// yet fully applied.
+var journalBucket = []byte("onet_journal")
+
+// journalApplyMax is the maximum number of operations of a batch applied in
+// one transaction.
+const journalApplyMax = 1000
+
+// journalOp is a write of a JournalBatch.
+type journalOp struct {
+	// Bucket is the full name of the bucket.
+	Bucket []byte
+	Key    []byte
+	Value  []byte
+	Delete bool
+}
+
+// journalEntry is a JournalBatch as written in the journal.
+type journalEntry struct {
+	Ops []journalOp
+}
+
+// JournalBatch groups writes to several keys and buckets of a service that
+// are applied together. Unlike Context.Update, the writes of a batch don't
+// need to fit in one transaction: the batch is first written to a journal,
+// and then applied in several transactions. If the conode stops before the
+// end, the batch is applied again when it starts, before the service is
+// created, so that the service sees either all of the writes or none.
+type JournalBatch struct {
+	ctx *Context
+	ops []journalOp
+}
+
+// NewJournalBatch returns an empty batch of writes to the buckets of the
+// service.
+func (c *Context) NewJournalBatch() *JournalBatch {
+	return &JournalBatch{ctx: c}
+}
+
+// bucketName returns the full name of the bucket of the service, or of the
+// additional bucket with the given name.
+func (b *JournalBatch) bucketName(bucket []byte) []byte {
+	if bucket == nil {
+		return b.ctx.bucketName
+	}
+	return b.ctx.additionalBucketName(bucket)
+}
+
+// Save adds the storage of the network.Marshal'ed data under key to the
+// batch, as Context.Save does.
+func (b *JournalBatch) Save(key []byte, data interface{}) error {
+	buf, err := network.Marshal(data)
+	if err != nil {
+		return xerrors.Errorf("marshaling: %v", err)
+	}
+	b.Put(nil, key, buf)
+	return nil
+}
+
+// Put adds the storage of the value under key in the given additional
+// bucket to the batch, or in the bucket of the service if bucket is nil.
+func (b *JournalBatch) Put(bucket, key, value []byte) {
+	b.open()
+	b.ops = append(b.ops, journalOp{
+		Bucket: b.bucketName(bucket),
+		Key:    append([]byte{}, key...),
+		Value:  append([]byte{}, value...),
+	})
+}
+
+// Delete adds the removal of the key of the given additional bucket to the
+// batch, or of the bucket of the service if bucket is nil.
+func (b *JournalBatch) Delete(bucket, key []byte) {
+	b.open()
+	b.ops = append(b.ops, journalOp{
+		Bucket: b.bucketName(bucket),
+		Key:    append([]byte{}, key...),
+		Delete: true,
+	})
+}
+
+// Commit writes the batch to the journal and applies it. Once the batch is
+// in the journal, it is applied even if Commit doesn't return, because the
+// conode stops. The values written count towards the storage quota of the
+// service.
+func (b *JournalBatch) Commit() error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	var size int64
+	for _, op := range b.ops {
+		size += int64(len(op.Key) + len(op.Value))
+	}
+	if err := b.ctx.usage.reserve(size); err != nil {
+		return err
+	}
+	id, err := b.write()
+	if err != nil {
+		b.ctx.usage.release(size)
+		return err
+	}
+	if err := b.ctx.applyJournal(id, b.ops); err != nil {
+		return xerrors.Errorf("applying batch: %v", err)
+	}
+	b.ctx.usage.wrote(int64(len(b.ops)), 0)
+	if err := b.ctx.updateStorageUsage(); err != nil {
+		log.Error("Couldn't update storage usage:", err)
+	}
+	b.ops = nil
+	atomic.AddInt64(&b.ctx.openBatches, -1)
+	return nil
+}
+
+// open counts the batch as not committed, when it gets its first write.
+func (b *JournalBatch) open() {
+	if len(b.ops) == 0 {
+		atomic.AddInt64(&b.ctx.openBatches, 1)
+	}
+}
+
+// write stores the batch in the journal and returns its key there.
+func (b *JournalBatch) write() ([]byte, error) {
+	buf, err := protobuf.Encode(&journalEntry{Ops: b.ops})
+	if err != nil {
+		return nil, xerrors.Errorf("encoding batch: %v", err)
+	}
+	id := make([]byte, len(b.ctx.bucketName)+9)
+	copy(id, b.ctx.bucketName)
+	binary.BigEndian.PutUint64(id[len(b.ctx.bucketName)+1:], uint64(time.Now().UnixNano()))
+	err = b.ctx.manager.store.Update(func(tx StoreTx) error {
+		journal, err := tx.CreateBucketIfNotExists(journalBucket)
+		if err != nil {
+			return xerrors.Errorf("creating bucket: %v", err)
+		}
+		return journal.Put(id, buf)
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("writing journal: %v", err)
+	}
+	return id, nil
+}
+
+// applyJournal applies the operations of the batch stored in the journal
+// under id, and removes it from the journal. Applying the operations again
+// gives the same result, so it can be called again after a crash.
+func (c *Context) applyJournal(id []byte, ops []journalOp) error {
+	for len(ops) > 0 {
+		n := len(ops)
+		if n > journalApplyMax {
+			n = journalApplyMax
+		}
+		batch := ops[:n]
+		ops = ops[n:]
+		err := c.manager.store.Update(func(tx StoreTx) error {
+			for _, op := range batch {
+				if err := clearTTL(tx, op.Bucket, op.Key); err != nil {
+					return xerrors.Errorf("removing TTL: %v", err)
+				}
+				if op.Delete {
+					if b := tx.Bucket(op.Bucket); b != nil {
+						if err := b.Delete(op.Key); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+				b, err := tx.CreateBucketIfNotExists(op.Bucket)
+				if err != nil {
+					return xerrors.Errorf("creating bucket: %v", err)
+				}
+				if err := b.Put(op.Key, op.Value); err != nil {
+					return err
+				}
+			}
+			if len(ops) > 0 {
+				return nil
+			}
+			return tx.Bucket(journalBucket).Delete(id)
+		})
+		if err != nil {
+			return xerrors.Errorf("tx error: %v", err)
+		}
+	}
+	return nil
+}
+
+// recoverJournal applies the batches of the service left in the journal by
+// a conode that stopped while applying them, and returns their number.
+func (c *Context) recoverJournal() (int, error) {
+	prefix := append(append([]byte{}, c.bucketName...), 0)
+	var ids [][]byte
+	var entries []*journalEntry
+	err := c.manager.store.View(func(tx StoreTx) error {
+		journal := tx.Bucket(journalBucket)
+		if journal == nil {
+			return nil
+		}
+		return journal.ForEach(func(k, v []byte) error {
+			if len(k) != len(prefix)+8 || !bytes.HasPrefix(k, prefix) {
+				return nil
+			}
+			e := &journalEntry{}
+			if err := protobuf.Decode(v, e); err != nil {
+				return xerrors.Errorf("decoding batch: %v", err)
+			}
+			ids = append(ids, append([]byte{}, k...))
+			entries = append(entries, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("reading journal: %v", err)
+	}
+	for i, e := range entries {
+		log.Lvlf1("Applying a batch of %d writes of %s left in the journal",
+			len(e.Ops), c.bucketName)
+		if err := c.applyJournal(ids[i], e.Ops); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,65 @@
+package onet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestJournalBatch(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	network.RegisterMessage(ContextData{})
+	c := createContext(t, tmp)
+	require.NoError(t, c.Save([]byte("old"), &ContextData{1, "old"}))
+
+	b := c.NewJournalBatch()
+	for i := int64(0); i < journalApplyMax+10; i++ {
+		require.NoError(t, b.Save([]byte(fmt.Sprint(i)), &ContextData{i, "batch"}))
+	}
+	b.Put([]byte("extra"), []byte("k"), []byte("v"))
+	b.Delete(nil, []byte("old"))
+	require.NoError(t, b.Commit())
+	msg, err := c.Load([]byte(fmt.Sprint(journalApplyMax + 5)))
+	require.NoError(t, err)
+	require.Equal(t, int64(journalApplyMax+5), msg.(*ContextData).I)
+	msg, err = c.Load([]byte("old"))
+	require.NoError(t, err)
+	require.Nil(t, msg)
+	require.NoError(t, c.ViewAdditionalBucket([]byte("extra"), func(b StoreBucket) error {
+		require.Equal(t, []byte("v"), b.Get([]byte("k")))
+		return nil
+	}))
+	n, err := c.recoverJournal()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	// a batch in the journal but not applied, as after a crash, is applied
+	// at startup
+	b = c.NewJournalBatch()
+	require.NoError(t, b.Save([]byte("crash"), &ContextData{2, "crash"}))
+	b.Delete(nil, []byte("0"))
+	_, err = b.write()
+	require.NoError(t, err)
+	msg, err = c.Load([]byte("crash"))
+	require.NoError(t, err)
+	require.Nil(t, msg)
+	n, err = c.recoverJournal()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	msg, err = c.Load([]byte("crash"))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), msg.(*ContextData).I)
+	msg, err = c.Load([]byte("0"))
+	require.NoError(t, err)
+	require.Nil(t, msg)
+	n, err = c.recoverJournal()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+}
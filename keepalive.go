@@ -0,0 +1,98 @@
+package onet
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// SetKeepAlive keeps the connections open between requests, like
+// NewClientKeep. While a connection isn't used, a ping is sent every interval
+// so that it isn't dropped by the conode or by the network in between, and it
+// is closed once it has been idle for idleTimeout. A zero interval disables
+// the pings and a zero idleTimeout keeps the connections until Close is
+// called. A connection found closed when sending a request is opened again.
+func (c *Client) SetKeepAlive(interval, idleTimeout time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.keep = true
+	c.keepAlive = interval
+	c.idleTimeout = idleTimeout
+	c.stopKeepAlive()
+	if len(c.idle) > 0 {
+		c.startKeepAlive()
+	}
+}
+
+// startKeepAlive starts the loop pinging and closing the idle connections,
+// if it isn't running yet. Correct locking must be done before calling this
+// method.
+func (c *Client) startKeepAlive() {
+	if c.keepAliveStop != nil {
+		return
+	}
+	period := c.keepAlive
+	if period == 0 || (c.idleTimeout > 0 && c.idleTimeout < period) {
+		period = c.idleTimeout
+	}
+	if period == 0 {
+		return
+	}
+	c.keepAliveStop = make(chan struct{})
+	go c.keepAliveLoop(period, c.keepAliveStop)
+}
+
+// stopKeepAlive stops the keep-alive loop. Correct locking must be done
+// before calling this method.
+func (c *Client) stopKeepAlive() {
+	if c.keepAliveStop != nil {
+		close(c.keepAliveStop)
+		c.keepAliveStop = nil
+	}
+}
+
+func (c *Client) keepAliveLoop(period time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		c.Lock()
+		if c.keepAliveStop != stop {
+			// replaced by SetKeepAlive
+			c.Unlock()
+			return
+		}
+		if len(c.idle) == 0 {
+			// started again by the next idle connection
+			c.stopKeepAlive()
+			c.Unlock()
+			return
+		}
+		now := time.Now()
+		for dest, since := range c.idle {
+			if c.idleTimeout > 0 && now.Sub(since) >= c.idleTimeout {
+				log.Lvl3("Closing idle connection to", dest.si, dest.path)
+				if err := c.closeConn(dest); err != nil {
+					log.Lvl2("closing connection:", err)
+				}
+				continue
+			}
+			if c.keepAlive == 0 {
+				continue
+			}
+			err := c.connections[dest].WriteControl(websocket.PingMessage, nil,
+				now.Add(period))
+			if err != nil {
+				log.Lvl2("Keep-alive of the connection to", dest.si, "failed:", err)
+				c.closeConn(dest)
+			}
+		}
+		c.Unlock()
+	}
+}
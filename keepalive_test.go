@@ -0,0 +1,66 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/protobuf"
+)
+
+func TestClient_KeepAlive(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(1)
+	si := servers[0].ServerIdentity
+
+	cl := NewClient(tSuite, serviceWebSocket)
+	defer cl.Close()
+	cl.SetKeepAlive(20*time.Millisecond, 300*time.Millisecond)
+	buf, err := protobuf.Encode(&SimpleResponse{})
+	require.NoError(t, err)
+	conn := func() *websocket.Conn {
+		cl.Lock()
+		defer cl.Unlock()
+		return cl.connections[destination{si, "SimpleResponse"}]
+	}
+
+	// the connection is kept between requests, and pinged while idle
+	_, err = cl.Send(si, "SimpleResponse", buf)
+	require.NoError(t, err)
+	first := conn()
+	require.NotNil(t, first)
+	time.Sleep(100 * time.Millisecond)
+	_, err = cl.Send(si, "SimpleResponse", buf)
+	require.NoError(t, err)
+	require.True(t, first == conn())
+
+	// then closed once idle for too long
+	for i := 0; conn() != nil; i++ {
+		require.True(t, i < 50, "idle connection not closed")
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestClient_KeepAliveReconnect(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(1)
+	si := servers[0].ServerIdentity
+
+	cl := NewClient(tSuite, serviceWebSocket)
+	defer cl.Close()
+	cl.SetKeepAlive(0, 0)
+	buf, err := protobuf.Encode(&SimpleResponse{})
+	require.NoError(t, err)
+	_, err = cl.Send(si, "SimpleResponse", buf)
+	require.NoError(t, err)
+
+	// the kept connection is lost while idle
+	cl.Lock()
+	cl.connections[destination{si, "SimpleResponse"}].UnderlyingConn().Close()
+	cl.Unlock()
+	_, err = cl.Send(si, "SimpleResponse", buf)
+	require.NoError(t, err)
+}
@@ -0,0 +1,298 @@
+package onet
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// KeyProvider fetches key material kept outside of the config files of the
+// conode, like its private key or the key of the TLS certificate of its
+// websocket, from a secret store or a key management service.
+type KeyProvider interface {
+	// FetchKey returns the key designated by the URL, whose scheme is the
+	// name the provider is registered under.
+	FetchKey(u *url.URL) ([]byte, error)
+}
+
+var keyProviders = struct {
+	sync.Mutex
+	providers map[string]KeyProvider
+}{providers: map[string]KeyProvider{
+	"vault":  &VaultKeyProvider{},
+	"awskms": &AWSKMSKeyProvider{},
+	"gcpkms": &GCPKMSKeyProvider{},
+}}
+
+// RegisterKeyProvider makes a new source of keys available for the URLs with
+// the given scheme. The built-in providers can be replaced, e.g., to give
+// them their parameters instead of taking them from the environment.
+func RegisterKeyProvider(scheme string, p KeyProvider) {
+	keyProviders.Lock()
+	defer keyProviders.Unlock()
+	keyProviders.providers[scheme] = p
+}
+
+// IsKeyProviderURL returns true if the string is the URL of a key of a
+// registered KeyProvider.
+func IsKeyProviderURL(s string) bool {
+	i := strings.Index(s, "://")
+	if i < 0 {
+		return false
+	}
+	keyProviders.Lock()
+	defer keyProviders.Unlock()
+	_, ok := keyProviders.providers[s[:i]]
+	return ok
+}
+
+// FetchKey returns the key at the URL from the provider registered for its
+// scheme, like "vault://secret/data/conode#private".
+func FetchKey(s string) ([]byte, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing key URL: %v", err)
+	}
+	keyProviders.Lock()
+	p, ok := keyProviders.providers[u.Scheme]
+	keyProviders.Unlock()
+	if !ok {
+		return nil, xerrors.Errorf("no key provider for %q", u.Scheme)
+	}
+	key, err := p.FetchKey(u)
+	if err != nil {
+		return nil, xerrors.Errorf("fetching key from %s: %v", u.Scheme, err)
+	}
+	return key, nil
+}
+
+// keyProviderClient sends the requests of the built-in providers.
+var keyProviderClient = &http.Client{Timeout: 30 * time.Second}
+
+// keyProviderDo sends the request and returns the body of the reply.
+func keyProviderDo(req *http.Request) ([]byte, error) {
+	resp, err := keyProviderClient.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("sending: %v", err)
+	}
+	defer resp.Body.Close()
+	reply, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, xerrors.Errorf("reading reply: %v", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, xerrors.Errorf("%s: %s", resp.Status, bytes.TrimSpace(reply))
+	}
+	return reply, nil
+}
+
+// envOr returns the value if it isn't empty, else the first environment
+// variable set.
+func envOr(value string, envs ...string) string {
+	for _, env := range envs {
+		if value != "" {
+			break
+		}
+		value = os.Getenv(env)
+	}
+	return value
+}
+
+// VaultKeyProvider reads the keys from the key/value secrets engine of
+// HashiCorp Vault, with URLs like "vault://secret/data/conode#private": the
+// path of the secret, and the field holding the key. Both versions of the
+// engine are supported.
+type VaultKeyProvider struct {
+	// Address of the Vault server, VAULT_ADDR if it is empty.
+	Address string
+	// Token sent to Vault, VAULT_TOKEN if it is empty.
+	Token string
+}
+
+// FetchKey implements KeyProvider.
+func (p *VaultKeyProvider) FetchKey(u *url.URL) ([]byte, error) {
+	addr := envOr(p.Address, "VAULT_ADDR")
+	if addr == "" {
+		return nil, xerrors.New("no address of the Vault server")
+	}
+	if u.Fragment == "" {
+		return nil, xerrors.New("no field of the secret given after '#'")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+
+		"/v1/"+u.Host+u.Path, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("request: %v", err)
+	}
+	req.Header.Set("X-Vault-Token", envOr(p.Token, "VAULT_TOKEN"))
+	reply, err := keyProviderDo(req)
+	if err != nil {
+		return nil, err
+	}
+	var secret struct {
+		Data map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(reply, &secret); err != nil {
+		return nil, xerrors.Errorf("decoding secret: %v", err)
+	}
+	fields := secret.Data
+	// version 2 of the engine nests the fields with the metadata
+	if nested, ok := secret.Data["data"]; ok {
+		if err := json.Unmarshal(nested, &fields); err != nil {
+			return nil, xerrors.Errorf("decoding secret: %v", err)
+		}
+	}
+	var key string
+	if err := json.Unmarshal(fields[u.Fragment], &key); err != nil {
+		return nil, xerrors.Errorf("no field %q in the secret", u.Fragment)
+	}
+	return []byte(key), nil
+}
+
+// AWSKMSKeyProvider decrypts the keys with AWS KMS, with URLs like
+// "awskms:///etc/conode/private.enc" giving the file of the ciphertext
+// created by the Encrypt operation of KMS.
+type AWSKMSKeyProvider struct {
+	// Endpoint of KMS, https://kms.<region>.amazonaws.com if it is empty.
+	Endpoint string
+	// Region, AWS_REGION or AWS_DEFAULT_REGION if it is empty.
+	Region string
+	// The credentials, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+	// AWS_SESSION_TOKEN if they are empty.
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// FetchKey implements KeyProvider.
+func (p *AWSKMSKeyProvider) FetchKey(u *url.URL) ([]byte, error) {
+	region := envOr(p.Region, "AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		return nil, xerrors.New("no region")
+	}
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://kms." + region + ".amazonaws.com"
+	}
+	ciphertext, err := ioutil.ReadFile(u.Host + u.Path)
+	if err != nil {
+		return nil, xerrors.Errorf("reading ciphertext: %v", err)
+	}
+	body, err := json.Marshal(map[string][]byte{"CiphertextBlob": ciphertext})
+	if err != nil {
+		return nil, xerrors.Errorf("encoding: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/",
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, xerrors.Errorf("request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	awsSign(req, "/", body, region, "kms", envOr(p.AccessKey, "AWS_ACCESS_KEY_ID"),
+		envOr(p.SecretKey, "AWS_SECRET_ACCESS_KEY"),
+		envOr(p.SessionToken, "AWS_SESSION_TOKEN"))
+	reply, err := keyProviderDo(req)
+	if err != nil {
+		return nil, err
+	}
+	var plain struct {
+		Plaintext []byte
+	}
+	if err := json.Unmarshal(reply, &plain); err != nil {
+		return nil, xerrors.Errorf("decoding reply: %v", err)
+	}
+	return plain.Plaintext, nil
+}
+
+// GCPKMSKeyProvider decrypts the keys with Google Cloud KMS, with URLs like
+// "gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k?ciphertext=/etc/conode/private.enc"
+// giving the key of KMS and the file of the ciphertext it created.
+type GCPKMSKeyProvider struct {
+	// Endpoint of KMS, https://cloudkms.googleapis.com if it is empty.
+	Endpoint string
+	// Token is the OAuth2 access token, GOOGLE_OAUTH_ACCESS_TOKEN if it is
+	// empty. Without any, the token of the service account of the instance
+	// is asked to the metadata server.
+	Token string
+	// MetadataHost is the metadata server, GCE_METADATA_HOST or
+	// metadata.google.internal if it is empty.
+	MetadataHost string
+}
+
+// FetchKey implements KeyProvider.
+func (p *GCPKMSKeyProvider) FetchKey(u *url.URL) ([]byte, error) {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://cloudkms.googleapis.com"
+	}
+	ciphertext, err := ioutil.ReadFile(u.Query().Get("ciphertext"))
+	if err != nil {
+		return nil, xerrors.Errorf("reading ciphertext: %v", err)
+	}
+	token, err := p.token()
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]string{
+		"ciphertext": base64.StdEncoding.EncodeToString(ciphertext),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("encoding: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(endpoint, "/")+
+		"/v1/"+u.Host+u.Path+":decrypt", bytes.NewReader(body))
+	if err != nil {
+		return nil, xerrors.Errorf("request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	reply, err := keyProviderDo(req)
+	if err != nil {
+		return nil, err
+	}
+	var plain struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	if err := json.Unmarshal(reply, &plain); err != nil {
+		return nil, xerrors.Errorf("decoding reply: %v", err)
+	}
+	return plain.Plaintext, nil
+}
+
+// token returns the access token sent to KMS.
+func (p *GCPKMSKeyProvider) token() (string, error) {
+	if token := envOr(p.Token, "GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	host := envOr(p.MetadataHost, "GCE_METADATA_HOST")
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+host+
+		"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", xerrors.Errorf("request: %v", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	reply, err := keyProviderDo(req)
+	if err != nil {
+		return "", xerrors.Errorf("getting access token: %v", err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(reply, &token); err != nil {
+		return "", xerrors.Errorf("decoding access token: %v", err)
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,124 @@
+package onet
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultKeyProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/conode":
+			w.Write([]byte(`{"data":{"data":{"private":"abcd"},"metadata":{"version":2}}}`))
+		case "/v1/kv/conode":
+			w.Write([]byte(`{"data":{"private":"1234"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := &VaultKeyProvider{Address: srv.URL, Token: "token"}
+	u, _ := url.Parse("vault://secret/data/conode#private")
+	key, err := p.FetchKey(u)
+	require.NoError(t, err)
+	require.Equal(t, "abcd", string(key))
+	u, _ = url.Parse("vault://kv/conode#private")
+	key, err = p.FetchKey(u)
+	require.NoError(t, err)
+	require.Equal(t, "1234", string(key))
+
+	u, _ = url.Parse("vault://kv/conode#other")
+	_, err = p.FetchKey(u)
+	require.Error(t, err)
+	u, _ = url.Parse("vault://kv/conode")
+	_, err = p.FetchKey(u)
+	require.Error(t, err)
+	p.Token = "wrong"
+	u, _ = url.Parse("vault://kv/conode#private")
+	_, err = p.FetchKey(u)
+	require.Error(t, err)
+}
+
+func TestAWSKMSKeyProvider(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "awskms")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	file := path.Join(tmp, "private.enc")
+	require.NoError(t, ioutil.WriteFile(file, []byte("ciphertext"), 0600))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "TrentService.Decrypt", r.Header.Get("X-Amz-Target"))
+		require.True(t, strings.HasPrefix(r.Header.Get("Authorization"),
+			"AWS4-HMAC-SHA256 Credential=access/"))
+		require.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/kms/aws4_request")
+		var req struct {
+			CiphertextBlob []byte
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "ciphertext", string(req.CiphertextBlob))
+		json.NewEncoder(w).Encode(map[string][]byte{"Plaintext": []byte("plaintext")})
+	}))
+	defer srv.Close()
+
+	RegisterKeyProvider("awskms", &AWSKMSKeyProvider{Endpoint: srv.URL,
+		Region: "eu-west-1", AccessKey: "access", SecretKey: "secret"})
+	defer RegisterKeyProvider("awskms", &AWSKMSKeyProvider{})
+	key, err := FetchKey("awskms://" + file)
+	require.NoError(t, err)
+	require.Equal(t, "plaintext", string(key))
+	_, err = FetchKey("awskms://" + file + ".none")
+	require.Error(t, err)
+	_, err = FetchKey("unknown://key")
+	require.Error(t, err)
+	require.True(t, IsKeyProviderURL("awskms:///etc/key"))
+	require.False(t, IsKeyProviderURL("file:///etc/key"))
+}
+
+func TestGCPKMSKeyProvider(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gcpkms")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	file := path.Join(tmp, "private.enc")
+	require.NoError(t, ioutil.WriteFile(file, []byte("ciphertext"), 0600))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/computeMetadata/") {
+			require.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+			w.Write([]byte(`{"access_token":"token","expires_in":3600}`))
+			return
+		}
+		require.Equal(t, "/v1/projects/p/locations/l/keyRings/r/cryptoKeys/k:decrypt",
+			r.URL.Path)
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		var req struct {
+			Ciphertext string `json:"ciphertext"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, base64.StdEncoding.EncodeToString([]byte("ciphertext")), req.Ciphertext)
+		w.Write([]byte(`{"plaintext":"` + base64.StdEncoding.EncodeToString([]byte("plaintext")) + `"}`))
+	}))
+	defer srv.Close()
+
+	p := &GCPKMSKeyProvider{Endpoint: srv.URL,
+		MetadataHost: strings.TrimPrefix(srv.URL, "http://")}
+	u, err := url.Parse("gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k?ciphertext=" + file)
+	require.NoError(t, err)
+	key, err := p.FetchKey(u)
+	require.NoError(t, err)
+	require.Equal(t, "plaintext", string(key))
+}
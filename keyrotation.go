@@ -0,0 +1,241 @@
+package onet
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// KeyTransition links the old key of a conode to its new one when the conode
+// rotates its key. It is signed by both keys: the old one authorizes the
+// change and the new one proves it is owned by the conode. The conode sends
+// it to the members of its rosters with Server.AnnounceKeyTransition, before
+// restarting with the new key.
+type KeyTransition struct {
+	Address network.Address
+	Old     []byte
+	New     []byte
+	// Timestamp is the time of signing in nanoseconds since the epoch.
+	Timestamp    int64
+	OldSignature []byte
+	NewSignature []byte
+}
+
+var keyTransitionID = network.RegisterMessage(&KeyTransition{})
+
+// keyTransitions holds the transitions received from the other conodes,
+// indexed by the old key.
+type keyTransitions struct {
+	sync.Mutex
+	byOld map[string]*KeyTransition
+}
+
+// NewKeyTransition returns the transition of the conode at addr from the key
+// old to the key next, signed by both.
+func NewKeyTransition(suite network.Suite, addr network.Address, old,
+	next kyber.Scalar) (*KeyTransition, error) {
+	kt := &KeyTransition{Address: addr, Timestamp: time.Now().UnixNano()}
+	var err error
+	kt.Old, err = suite.Point().Mul(old, nil).MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("marshaling old key: %v", err)
+	}
+	kt.New, err = suite.Point().Mul(next, nil).MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("marshaling new key: %v", err)
+	}
+	digest := kt.digest()
+	kt.OldSignature, err = schnorr.Sign(suite, old, digest)
+	if err != nil {
+		return nil, xerrors.Errorf("signing with old key: %v", err)
+	}
+	kt.NewSignature, err = schnorr.Sign(suite, next, digest)
+	if err != nil {
+		return nil, xerrors.Errorf("signing with new key: %v", err)
+	}
+	return kt, nil
+}
+
+// digest is the message signed by both keys.
+func (kt *KeyTransition) digest() []byte {
+	h := sha256.New()
+	h.Write([]byte("onet-key-transition"))
+	h.Write([]byte(kt.Address))
+	h.Write(kt.Old)
+	h.Write(kt.New)
+	binary.Write(h, binary.BigEndian, kt.Timestamp)
+	return h.Sum(nil)
+}
+
+// Keys returns the old and the new key of the transition.
+func (kt *KeyTransition) Keys(suite network.Suite) (old, next kyber.Point, err error) {
+	old = suite.Point()
+	if err := old.UnmarshalBinary(kt.Old); err != nil {
+		return nil, nil, xerrors.Errorf("unmarshaling old key: %v", err)
+	}
+	next = suite.Point()
+	if err := next.UnmarshalBinary(kt.New); err != nil {
+		return nil, nil, xerrors.Errorf("unmarshaling new key: %v", err)
+	}
+	return old, next, nil
+}
+
+// Verify checks the signatures of both keys on the transition.
+func (kt *KeyTransition) Verify(suite network.Suite) error {
+	old, next, err := kt.Keys(suite)
+	if err != nil {
+		return err
+	}
+	if old.Equal(next) {
+		return xerrors.New("the old and the new key are the same")
+	}
+	digest := kt.digest()
+	if err := schnorr.Verify(suite, old, digest, kt.OldSignature); err != nil {
+		return xerrors.Errorf("invalid signature of the old key: %v", err)
+	}
+	if err := schnorr.Verify(suite, next, digest, kt.NewSignature); err != nil {
+		return xerrors.Errorf("invalid signature of the new key: %v", err)
+	}
+	return nil
+}
+
+// ServerIdentity returns the identity of the conode with its new key. The
+// service identities of si, the identity with the old key, are kept.
+func (kt *KeyTransition) ServerIdentity(suite network.Suite,
+	si *network.ServerIdentity) (*network.ServerIdentity, error) {
+	_, next, err := kt.Keys(suite)
+	if err != nil {
+		return nil, err
+	}
+	nsi := network.NewServerIdentity(next, si.Address)
+	nsi.Description = si.Description
+	nsi.URL = si.URL
+	nsi.ServiceIdentities = si.ServiceIdentities
+	return nsi, nil
+}
+
+// ApplyKeyTransition returns a new roster where the conode of the transition
+// has its new key, at the same place. It returns an error if the conode is
+// not in the roster or if the transition is not valid.
+func (ro *Roster) ApplyKeyTransition(suite network.Suite, kt *KeyTransition) (*Roster, error) {
+	if err := kt.Verify(suite); err != nil {
+		return nil, err
+	}
+	old, _, err := kt.Keys(suite)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*network.ServerIdentity, len(ro.List))
+	copy(list, ro.List)
+	for i, si := range list {
+		if si.Public.Equal(old) {
+			list[i], err = kt.ServerIdentity(suite, si)
+			if err != nil {
+				return nil, err
+			}
+			return NewRoster(list), nil
+		}
+	}
+	return nil, xerrors.Errorf("%s is not in the roster", Identity(old))
+}
+
+// storagePrivate returns the private key the database derives from.
+func (c *Server) storagePrivate() kyber.Scalar {
+	if c.storageKey != nil {
+		return c.storageKey
+	}
+	return c.private
+}
+
+// storagePublic returns the public key of storagePrivate, which names the
+// database and its backups.
+func (c *Server) storagePublic() kyber.Point {
+	if c.storageKey != nil {
+		return c.suite.Point().Mul(c.storageKey, nil)
+	}
+	return c.ServerIdentity.Public
+}
+
+// registerKeyRotation lets the server record the transitions announced by
+// the other conodes.
+func (c *Server) registerKeyRotation() {
+	c.keyTransitions = &keyTransitions{byOld: make(map[string]*KeyTransition)}
+	c.RegisterProcessorFunc(keyTransitionID, func(env *network.Envelope) error {
+		kt, ok := env.Msg.(*KeyTransition)
+		if !ok {
+			return xerrors.New("invalid key transition")
+		}
+		if err := kt.Verify(c.suite); err != nil {
+			return xerrors.Errorf("key transition from %s: %v", env.ServerIdentity, err)
+		}
+		old, next, err := kt.Keys(c.suite)
+		if err != nil {
+			return err
+		}
+		// only the conode itself can announce its transition
+		if !env.ServerIdentity.Public.Equal(old) {
+			return xerrors.Errorf("%s announced the key transition of %s",
+				env.ServerIdentity, Identity(old))
+		}
+		c.keyTransitions.Lock()
+		c.keyTransitions.byOld[string(kt.Old)] = kt
+		c.keyTransitions.Unlock()
+		log.Lvl2(c.ServerIdentity, "received the key transition of", env.ServerIdentity)
+		c.events.publish(Event{Type: EventKeyRotated, Peer: env.ServerIdentity,
+			Message: "new key " + Identity(next)})
+		return nil
+	})
+}
+
+// KeyTransition returns the transition announced by the conode with the old
+// key, or nil if there is none. Services use it to update their rosters with
+// Roster.ApplyKeyTransition.
+func (c *Server) KeyTransition(old kyber.Point) *KeyTransition {
+	buf, err := old.MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	c.keyTransitions.Lock()
+	defer c.keyTransitions.Unlock()
+	return c.keyTransitions.byOld[string(buf)]
+}
+
+// AnnounceKeyTransition sends the transition of the key of the server to the
+// other members of the roster. It returns the number of conodes reached, and
+// an error if some of them could not be reached.
+func (c *Server) AnnounceKeyTransition(kt *KeyTransition, ro *Roster) (int, error) {
+	if err := kt.Verify(c.suite); err != nil {
+		return 0, err
+	}
+	old, _, err := kt.Keys(c.suite)
+	if err != nil {
+		return 0, err
+	}
+	if !c.ServerIdentity.Public.Equal(old) {
+		return 0, xerrors.New("the transition is not from the key of the server")
+	}
+	var sent int
+	var failed []string
+	for _, si := range ro.List {
+		if si.Equal(c.ServerIdentity) {
+			continue
+		}
+		if _, err := c.Send(si, kt); err != nil {
+			log.Warn("Couldn't send the key transition to", si, ":", err)
+			failed = append(failed, si.Address.String())
+			continue
+		}
+		sent++
+	}
+	if len(failed) > 0 {
+		return sent, xerrors.Errorf("couldn't reach %v", failed)
+	}
+	return sent, nil
+}
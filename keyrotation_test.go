@@ -0,0 +1,70 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+)
+
+func TestKeyTransition(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	_, ro, _ := local.GenTree(3, false)
+	old := ro.List[1].GetPrivate()
+	next := key.NewKeyPair(tSuite)
+	kt, err := NewKeyTransition(tSuite, ro.List[1].Address, old, next.Private)
+	require.NoError(t, err)
+	require.NoError(t, kt.Verify(tSuite))
+
+	nro, err := ro.ApplyKeyTransition(tSuite, kt)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(nro.List))
+	require.True(t, nro.List[1].Public.Equal(next.Public))
+	require.Equal(t, ro.List[1].Address, nro.List[1].Address)
+	require.True(t, nro.List[0].Equal(ro.List[0]))
+	require.False(t, nro.ID.Equal(ro.ID))
+
+	// the conode must be in the roster
+	_, err = NewRoster(ro.List[:1]).ApplyKeyTransition(tSuite, kt)
+	require.Error(t, err)
+
+	// both signatures cover the transition
+	kt.Address = ro.List[0].Address
+	require.Error(t, kt.Verify(tSuite))
+	kt, err = NewKeyTransition(tSuite, ro.List[1].Address, old, old)
+	require.NoError(t, err)
+	require.Error(t, kt.Verify(tSuite))
+}
+
+func TestServer_AnnounceKeyTransition(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, ro, _ := local.GenTree(3, false)
+	events, unsubscribe := servers[1].Subscribe(EventKeyRotated)
+	defer unsubscribe()
+
+	next := key.NewKeyPair(tSuite)
+	kt, err := NewKeyTransition(tSuite, servers[0].ServerIdentity.Address,
+		servers[0].private, next.Private)
+	require.NoError(t, err)
+	sent, err := servers[0].AnnounceKeyTransition(kt, ro)
+	require.NoError(t, err)
+	require.Equal(t, 2, sent)
+
+	select {
+	case ev := <-events:
+		require.True(t, ev.Peer.Equal(servers[0].ServerIdentity))
+	case <-time.After(time.Second):
+		require.Fail(t, "no event")
+	}
+	received := servers[1].KeyTransition(servers[0].ServerIdentity.Public)
+	require.NotNil(t, received)
+	require.Equal(t, kt.New, received.New)
+	require.Nil(t, servers[1].KeyTransition(servers[2].ServerIdentity.Public))
+
+	// a conode can only announce its own transition
+	_, err = servers[2].AnnounceKeyTransition(kt, ro)
+	require.Error(t, err)
+}
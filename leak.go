@@ -0,0 +1,183 @@
+package onet
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// The leaks checked by LocalTest.CloseAll, on top of the goroutines, are
+// named after the service or the protocol owning them, so that a failing
+// test points to the code to fix.
+
+// typeMethodPrefix returns how the methods of the type of v start in a stack
+// trace, like "go.dedis.ch/onet/v3.(*Overlay).".
+func typeMethodPrefix(v interface{}) string {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		return fmt.Sprintf("%s.(*%s).", t.PkgPath(), t.Name())
+	}
+	return fmt.Sprintf("%s.%s.", t.PkgPath(), t.Name())
+}
+
+// leakOwners returns the services and the protocols of the test, by how
+// their methods start in a stack trace.
+func (l *LocalTest) leakOwners() map[string]string {
+	owners := make(map[string]string)
+	for _, services := range l.Services {
+		for id, s := range services {
+			owners[typeMethodPrefix(s)] = "service " + ServiceFactory.Name(id)
+		}
+	}
+	for _, o := range l.Overlays {
+		o.instancesLock.Lock()
+		for prefix, name := range o.protocolTypes {
+			owners[prefix] = "protocol " + name
+		}
+		o.instancesLock.Unlock()
+	}
+	return owners
+}
+
+// leakOwner returns the service or the protocol whose method is the closest
+// to the top of the stack, or an empty string if there is none.
+func leakOwner(owners map[string]string, stack string) string {
+	for _, line := range strings.Split(stack, "\n") {
+		for prefix, owner := range owners {
+			if strings.HasPrefix(line, prefix) {
+				return owner
+			}
+		}
+	}
+	return ""
+}
+
+// instanceLeaks returns the protocol instances that are still running.
+func (l *LocalTest) instanceLeaks() []string {
+	var leaks []string
+	for _, o := range l.Overlays {
+		o.instancesLock.Lock()
+		for id, pi := range o.protocolInstances {
+			name := "unknown"
+			if tni := o.instances[id]; tni != nil {
+				name = tni.ProtocolName()
+			}
+			owner := ""
+			if sid := pi.Token().ServiceID; !sid.IsNil() {
+				owner = " of service " + ServiceFactory.Name(sid)
+			}
+			leaks = append(leaks, fmt.Sprintf("protocol %s%s (%T) on %s with id %s",
+				name, owner, pi, o.ServerIdentity(), id))
+		}
+		o.instancesLock.Unlock()
+	}
+	return leaks
+}
+
+// storageLeaks returns the journal batches of the services with writes that
+// aren't committed, and the ones still in the journal because they weren't
+// fully applied. The servers must not be closed yet.
+func (l *LocalTest) storageLeaks() []string {
+	var leaks []string
+	for _, s := range l.Servers {
+		if s.Closed() {
+			// closed by the test, with its database
+			continue
+		}
+		for id, ctx := range s.serviceManager.contexts {
+			if n := atomic.LoadInt64(&ctx.openBatches); n > 0 {
+				leaks = append(leaks, fmt.Sprintf("service %s has %d uncommitted journal batches on %s",
+					ServiceFactory.Name(id), n, s.ServerIdentity))
+			}
+		}
+		pending := make(map[string]int)
+		err := s.serviceManager.store.View(func(tx StoreTx) error {
+			journal := tx.Bucket(journalBucket)
+			if journal == nil {
+				return nil
+			}
+			return journal.ForEach(func(k, v []byte) error {
+				// the key is the name of the bucket of the service, a
+				// zero, and the time of the batch
+				if len(k) > 9 {
+					pending[string(k[:len(k)-9])]++
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			leaks = append(leaks, fmt.Sprintf("couldn't read the journal of %s: %v",
+				s.ServerIdentity, err))
+		}
+		for service, n := range pending {
+			leaks = append(leaks, fmt.Sprintf("service %s has %d journal batches not applied on %s",
+				service, n, s.ServerIdentity))
+		}
+	}
+	return leaks
+}
+
+// clientLeaks returns the connections the clients of the test keep open.
+func (l *LocalTest) clientLeaks() []string {
+	var leaks []string
+	l.clientsMut.Lock()
+	defer l.clientsMut.Unlock()
+	for _, c := range l.clients {
+		c.Lock()
+		for dst := range c.connections {
+			leaks = append(leaks, fmt.Sprintf("client of service %s keeps a connection to %s/%s",
+				c.service, dst.si, dst.path))
+		}
+		c.Unlock()
+	}
+	return leaks
+}
+
+// closedLeaks returns the connections that the servers didn't close with
+// them, and the timers of the clock of the test that didn't fire.
+func (l *LocalTest) closedLeaks(servers []*Server, owners map[string]string) []string {
+	var leaks []string
+	for _, s := range servers {
+		for _, info := range s.Router.ConnectionsInfo() {
+			leaks = append(leaks, fmt.Sprintf("closed server %s keeps %d connections to %x",
+				s.ServerIdentity, len(info.Remotes), info.ID[:]))
+		}
+	}
+	if l.Clock != nil {
+		for _, stack := range l.Clock.timerStacks() {
+			owner := leakOwner(owners, stack)
+			if owner == "" {
+				owner = "unknown owner"
+			}
+			leaks = append(leaks, fmt.Sprintf("timer of %s started by:\n%s", owner, stack))
+		}
+	}
+	return leaks
+}
+
+// reportLeaks fails the test, warns or does nothing about the leaks,
+// depending on Check.
+func (l *LocalTest) reportLeaks(err error) {
+	switch l.Check {
+	case CheckNone:
+		// Ignore waitDone
+	case CheckGoroutines:
+		// Only print a warning
+		if l.T != nil {
+			l.T.Log("Warning:", err)
+		} else {
+			log.Warn("Warning:", err)
+		}
+	case CheckAll:
+		// Fail if there are leaking processes or protocolInstances
+		if l.T != nil {
+			l.T.Fatal(err.Error())
+		} else {
+			log.Fatal(err.Error())
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/protobuf"
+)
+
+func TestLocalTest_Leaks(t *testing.T) {
+	l := NewTCPTest(tSuite)
+	defer l.CloseAll()
+	l.Clock = NewVirtualClock(time.Now())
+	s := l.GenServers(1)[0]
+
+	// a journal batch that isn't committed
+	batch := serviceContext(s, serviceWebSocket).NewJournalBatch()
+	require.NoError(t, batch.Save([]byte("key"), &SimpleResponse{Val: 3}))
+	leaks := l.storageLeaks()
+	require.Equal(t, 1, len(leaks))
+	require.Contains(t, leaks[0], "service WebSocket has 1 uncommitted journal batches")
+	require.NoError(t, batch.Commit())
+	require.Empty(t, l.storageLeaks())
+
+	// a client keeping its connection
+	cl := l.NewClientKeep(serviceWebSocket)
+	buf, err := protobuf.Encode(&SimpleResponse{})
+	require.NoError(t, err)
+	_, err = cl.Send(s.ServerIdentity, "SimpleResponse", buf)
+	require.NoError(t, err)
+	leaks = l.clientLeaks()
+	require.Equal(t, 1, len(leaks))
+	require.Contains(t, leaks[0], "client of service WebSocket keeps a connection")
+	require.NoError(t, cl.Close())
+	require.Empty(t, l.clientLeaks())
+
+	// a protocol instance that isn't done
+	_, _, tree := l.GenTree(1, true)
+	p, err := l.CreateProtocol(ProtocolChannelsName, tree)
+	require.NoError(t, err)
+	leaks = l.instanceLeaks()
+	require.Equal(t, 1, len(leaks))
+	require.Contains(t, leaks[0], "protocol "+ProtocolChannelsName+" (*onet.ProtocolChannels)")
+
+	// the owners of the goroutines and the timers
+	owners := l.leakOwners()
+	require.Equal(t, "protocol "+ProtocolChannelsName,
+		leakOwner(owners, typeMethodPrefix(p)+"Dispatch()\n"))
+	p.(*ProtocolChannels).Done()
+	require.NoError(t, l.WaitDone(time.Second))
+	prefix := typeMethodPrefix(s.Service(serviceWebSocket))
+	require.Equal(t, "service WebSocket", leakOwner(owners, "main()\n"+prefix+"loop()\n"))
+	require.Equal(t, "", leakOwner(owners, "main()\n"))
+	// the tree of the protocol is removed after the timeout of the overlay
+	require.Equal(t, 1, len(l.closedLeaks(nil, owners)))
+	timer := l.Clock.AfterFunc(2*globalProtocolTimeout, func() {})
+	stacks := l.Clock.timerStacks()
+	require.Equal(t, 2, len(stacks))
+	require.Contains(t, stacks[0], "(*treeStorage).Remove")
+	require.Contains(t, stacks[1], "TestLocalTest_Leaks")
+	require.Equal(t, 2, len(l.closedLeaks(nil, owners)))
+	timer.Stop()
+	require.Equal(t, 1, len(l.closedLeaks(nil, owners)))
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -28,8 +29,8 @@ const (
 	CheckNone LeakyTestCheck = iota + 1
 	// CheckGoroutines will only check for leaking goroutines.
 	CheckGoroutines
-	// CheckAll will also check for leaking Overlay.Processors and
-	// ProtocolInstances.
+	// CheckAll will also check for leaking Overlay.Processors,
+	// ProtocolInstances, connections, journal batches and timers.
 	CheckAll
 )
 
@@ -54,6 +55,19 @@ type LocalTest struct {
 	Nodes []*TreeNodeInstance
 	// How carefully to check for leaking resources at the end of the test.
 	Check LeakyTestCheck
+	// StorageBackend is the backend of the database of the servers created
+	// afterwards, bbolt by default. StoreBackendMemory keeps the data in
+	// memory, without writing to the disk.
+	StorageBackend string
+	// Clock, if not nil, is the clock of the servers and the clients created
+	// afterwards. The test fast-forwards their timeouts with Advance instead
+	// of waiting for them.
+	Clock *VirtualClock
+	// Watchdog, if not zero, fails the test when a protocol instance of the
+	// servers created afterwards neither sends nor receives a message during
+	// that period. The stalled instance is logged with its pending messages
+	// and the goroutines of its protocol.
+	Watchdog time.Duration
 	// are we running tcp or local layer
 	mode string
 	// TLS certificate if we want TLS for websocket
@@ -75,6 +89,16 @@ type LocalTest struct {
 
 	// keep the latestPort used so that we can add nodes later
 	latestPort int
+	// stops the faults injected by Chaos
+	chaos []func()
+	// the clients created by the test, checked for open connections
+	clients    []*Client
+	clientsMut sync.Mutex
+	// the overlays checked by the watchdog, and how to stop it
+	watched      []*Overlay
+	watchdogStop chan struct{}
+	watchdogDone chan struct{}
+	watchdogMut  sync.Mutex
 }
 
 const (
@@ -243,15 +267,7 @@ func (l *LocalTest) panicClosed() {
 func (l *LocalTest) WaitDone(t time.Duration) error {
 	var lingering []string
 	for i := 0; i < 10; i++ {
-		lingering = []string{}
-		for _, o := range l.Overlays {
-			o.instancesLock.Lock()
-			for si, pi := range o.protocolInstances {
-				lingering = append(lingering, fmt.Sprintf("ProtocolInstance type %T on %s with id %s",
-					pi, o.ServerIdentity(), si))
-			}
-			o.instancesLock.Unlock()
-		}
+		lingering = l.instanceLeaks()
 		for _, s := range l.Servers {
 			disp, ok := s.serviceManager.Dispatcher.(*network.RoutineDispatcher)
 			if ok && disp.GetRoutines() > 0 {
@@ -266,9 +282,18 @@ func (l *LocalTest) WaitDone(t time.Duration) error {
 	return xerrors.New("still have things lingering: " + strings.Join(lingering, "\n"))
 }
 
-// CloseAll closes all the servers.
+// CloseAll closes all the servers. Depending on Check, it then fails the
+// test if something is still running or open: the protocol instances, the
+// connections of the servers and of the clients of the LocalTest, the journal
+// batches that aren't committed or applied, the timers of Clock and the
+// goroutines. They are reported with the service or the protocol owning
+// them, when it is known.
 func (l *LocalTest) CloseAll() {
 	log.Lvl3("Stopping all")
+	for _, stop := range l.chaos {
+		stop()
+	}
+	l.stopWatchdog()
 	if err := l.WaitDone(time.Second); err != nil {
 		log.Warn("Some things still running:", err)
 	}
@@ -300,25 +325,13 @@ func (l *LocalTest) CloseAll() {
 	wg.Wait()
 
 	if err := l.WaitDone(5 * time.Second); err != nil {
-		switch l.Check {
-		case CheckNone:
-			// Ignore waitDone
-		case CheckGoroutines:
-			// Only print a warning
-			if l.T != nil {
-				l.T.Log("Warning:", err)
-			} else {
-				log.Warn("Warning:", err)
-			}
-		case CheckAll:
-			// Fail if there are leaking processes or protocolInstances
-			if l.T != nil {
-				l.T.Fatal(err.Error())
-			} else {
-				log.Fatal(err.Error())
-			}
-		}
+		l.reportLeaks(err)
+	}
+	if leaks := append(l.storageLeaks(), l.clientLeaks()...); len(leaks) > 0 {
+		sort.Strings(leaks)
+		l.reportLeaks(xerrors.New("still have things open: " + strings.Join(leaks, "\n")))
 	}
+	owners := l.leakOwners()
 
 	for _, node := range l.Nodes {
 		log.Lvl3("Closing node", node)
@@ -329,8 +342,10 @@ func (l *LocalTest) CloseAll() {
 	}
 	l.Nodes = make([]*TreeNodeInstance, 0)
 
+	var servers []*Server
 	sd := sync.WaitGroup{}
 	for _, srv := range l.Servers {
+		servers = append(servers, srv)
 		sd.Add(1)
 		go func(server *Server) {
 			log.Lvl3("Closing server", server.ServerIdentity.Address)
@@ -350,6 +365,11 @@ func (l *LocalTest) CloseAll() {
 	sd.Wait()
 	l.Servers = map[network.ServerIdentityID]*Server{}
 	l.ctx.Stop()
+	if leaks := l.closedLeaks(servers, owners); len(leaks) > 0 {
+		sort.Strings(leaks)
+		l.reportLeaks(xerrors.New("still have things open after closing: " +
+			strings.Join(leaks, "\n")))
+	}
 
 	err := os.RemoveAll(l.path)
 	if err != nil {
@@ -361,7 +381,9 @@ func (l *LocalTest) CloseAll() {
 		log.OutputToOs()
 	}
 	if l.Check != CheckNone {
-		log.AfterTest(nil)
+		log.AfterTestWithOwner(nil, func(stack string) string {
+			return leakOwner(owners, stack)
+		})
 	}
 }
 
@@ -491,16 +513,18 @@ func NewPrivIdentity(suite network.Suite, port int) (kyber.Scalar, *network.Serv
 
 // NewTCPServer creates a new server with a tcpRouter with "localhost:"+port as an
 // address.
-func newTCPServer(s network.Suite, port int, path string, wantsTLS bool) *Server {
+func newTCPServer(s network.Suite, port int, path string, wantsTLS bool,
+	opts ServerOptions) *Server {
 	priv, id := NewPrivIdentity(s, port)
 	addr := network.NewTCPAddress(id.Address.NetworkAddress())
-	id2 := network.NewServerIdentity(id.Public, addr)
 	var tcpHost *network.TCPHost
 	var addrWS string
 	// For the websocket we need a port at the address one higher than the
 	// TCPHost. Let TCPHost chose a port, then check if the port+1 is also
 	// available. Else redo the search.
 	for {
+		// the port of the address is replaced by the one chosen
+		id2 := network.NewServerIdentity(id.Public, addr)
 		var err error
 		tcpHost, err = network.NewTCPHost(id2, s)
 		if err != nil {
@@ -520,6 +544,7 @@ func newTCPServer(s network.Suite, port int, path string, wantsTLS bool) *Server
 			break
 		}
 		log.Lvl2("Found closed port:", addrWS)
+		tcpHost.Stop()
 	}
 	scheme := "http"
 	if wantsTLS {
@@ -531,7 +556,7 @@ func newTCPServer(s network.Suite, port int, path string, wantsTLS bool) *Server
 
 	router := network.NewRouter(id, tcpHost)
 	router.UnauthOk = true
-	return newServer(s, path, router, priv)
+	return newServerWithOptions(s, path, router, priv, opts)
 }
 
 // NewLocalServer returns a new server using a LocalRouter (channels) to communicate.
@@ -558,7 +583,9 @@ func NewLocalServer(s network.Suite, port int) *Server {
 func (l *LocalTest) NewClient(serviceName string) *Client {
 	switch l.mode {
 	case TCP:
-		return NewClient(l.Suite, serviceName)
+		c := NewClient(l.Suite, serviceName)
+		l.addClient(c)
+		return c
 	default:
 		log.Fatal("Can't make local client")
 		return nil
@@ -570,13 +597,26 @@ func (l *LocalTest) NewClient(serviceName string) *Client {
 func (l *LocalTest) NewClientKeep(serviceName string) *Client {
 	switch l.mode {
 	case TCP:
-		return NewClientKeep(l.Suite, serviceName)
+		c := NewClientKeep(l.Suite, serviceName)
+		l.addClient(c)
+		return c
 	default:
 		log.Fatal("Can't make local client")
 		return nil
 	}
 }
 
+// addClient gives the clock of the LocalTest to the client, if any, and
+// keeps it to check its connections at the end of the test.
+func (l *LocalTest) addClient(c *Client) {
+	if l.Clock != nil {
+		c.SetClock(l.Clock)
+	}
+	l.clientsMut.Lock()
+	l.clients = append(l.clients, c)
+	l.clientsMut.Unlock()
+}
+
 // genLocalHosts returns n servers created with a localRouter
 func (l *LocalTest) genLocalHosts(n int) []*Server {
 	l.panicClosed()
@@ -589,7 +629,7 @@ func (l *LocalTest) genLocalHosts(n int) []*Server {
 	return servers
 }
 
-func (l LocalTest) wantsTLS() bool {
+func (l *LocalTest) wantsTLS() bool {
 	return len(l.webSocketTLSCertificate) > 0 && len(l.webSocketTLSCertificateKey) > 0
 }
 
@@ -613,6 +653,9 @@ func (l *LocalTest) NewServer(s network.Suite, port int) *Server {
 					log.Error("cannot configure TLS reloader", err)
 					return nil
 				}
+				if l.Clock != nil {
+					cr.SetClock(l.Clock)
+				}
 				server.WebSocket.TLSConfig = &tls.Config{
 					GetCertificate: cr.GetCertificateFunc(),
 				}
@@ -633,14 +676,24 @@ func (l *LocalTest) NewServer(s network.Suite, port int) *Server {
 	return server
 }
 
+// serverOptions returns the options of the servers of the LocalTest.
+func (l *LocalTest) serverOptions() ServerOptions {
+	opts := ServerOptions{StorageBackend: l.StorageBackend}
+	if l.Clock != nil {
+		opts.Clock = l.Clock
+	}
+	return opts
+}
+
 // NewTCPServer returns a new TCP Server attached to this LocalTest, configured
 // for TLS if possible (if anything in LocalTest.webSocketTLSCertificate/Key).
 func (l *LocalTest) newTCPServer(s network.Suite) *Server {
 	l.panicClosed()
-	server := newTCPServer(s, 0, l.path, l.wantsTLS())
+	server := newTCPServer(s, 0, l.path, l.wantsTLS(), l.serverOptions())
 	l.Servers[server.ServerIdentity.ID] = server
 	l.Overlays[server.ServerIdentity.ID] = server.overlay
 	l.Services[server.ServerIdentity.ID] = server.serviceManager.services
+	l.watch(server)
 
 	return server
 }
@@ -654,11 +707,12 @@ func (l *LocalTest) NewLocalServer(s network.Suite, port int) *Server {
 	if err != nil {
 		panic(err)
 	}
-	server := newServer(s, l.path, localRouter, priv)
+	server := newServerWithOptions(s, l.path, localRouter, priv, l.serverOptions())
 	server.StartInBackground()
 	l.Servers[server.ServerIdentity.ID] = server
 	l.Overlays[server.ServerIdentity.ID] = server.overlay
 	l.Services[server.ServerIdentity.ID] = server.serviceManager.services
+	l.watch(server)
 
 	return server
 
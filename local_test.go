@@ -1,7 +1,10 @@
 package onet
 
 import (
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -105,6 +108,71 @@ func TestLocalTCPGenConnectableRoster(t *testing.T) {
 	}
 }
 
+func TestLocalTest_StorageBackend(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	l.StorageBackend = StoreBackendMemory
+	servers := l.GenServers(2)
+
+	ctx := serviceContext(servers[0], serviceWebSocket)
+	require.NoError(t, ctx.Save([]byte("key"), &SimpleResponse{Val: 3}))
+	files, err := ioutil.ReadDir(l.path)
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	// the data can still be written to the disk on demand
+	snap := filepath.Join(l.path, "snapshot.db")
+	require.NoError(t, servers[0].Snapshot(snap, SnapshotFilter{}))
+	_, err = os.Stat(snap)
+	require.NoError(t, err)
+}
+
+func TestLocalTest_Clock(t *testing.T) {
+	l := NewTCPTest(tSuite)
+	defer l.CloseAll()
+	l.Clock = NewVirtualClock(time.Now())
+	h := l.GenServers(1)[0]
+
+	// the capabilities expire with the clock
+	capa, err := h.NewCapability(testServiceName, []string{"testMsg"},
+		l.Clock.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, h.verifyCapability(capa, testServiceName, "testMsg"))
+	l.Clock.Advance(2 * time.Hour)
+	require.Error(t, h.verifyCapability(capa, testServiceName, "testMsg"))
+
+	// the trees are kept until the timeout of the overlay
+	tree := &Tree{ID: TreeID{1}}
+	h.overlay.treeStorage.Set(tree)
+	h.overlay.treeStorage.Remove(tree.ID)
+	l.Clock.Advance(globalProtocolTimeout - time.Second)
+	require.NotNil(t, h.overlay.treeStorage.Get(tree.ID))
+	l.Clock.Advance(time.Second)
+	require.Nil(t, h.overlay.treeStorage.Get(tree.ID))
+
+	// the client waits an hour before retrying to reach a conode
+	c := l.NewClient(testServiceName)
+	defer c.Close()
+	c.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Hour})
+	down := network.NewServerIdentity(h.ServerIdentity.Public,
+		network.NewTCPAddress("127.0.0.1:2"))
+	sent := make(chan error)
+	go func() {
+		_, err := c.Send(down, "testMsg", nil)
+		sent <- err
+	}()
+	for l.Clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-sent:
+		require.Fail(t, "client didn't wait")
+	default:
+	}
+	l.Clock.Advance(time.Hour)
+	require.Error(t, <-sent)
+}
+
 // Tests whether TestClose is called in the service.
 func TestTestClose(t *testing.T) {
 	l := NewTCPTest(tSuite)
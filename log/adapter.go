@@ -0,0 +1,205 @@
+package log
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Severity is the kind of a message, as known by the structured loggers.
+type Severity int
+
+// The severities, from the least to the most severe.
+const (
+	SeverityDebug Severity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+	SeverityFatal
+	SeverityPanic
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityDebug:
+		return "debug"
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	case SeverityFatal:
+		return "fatal"
+	case SeverityPanic:
+		return "panic"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// LevelSeverity returns the severity of the messages of the level: the
+// panics, fatal errors, errors, warnings and information keep their names,
+// the messages of Lvl1 are information and the ones of the higher levels are
+// debugging.
+func LevelSeverity(lvl int) Severity {
+	switch lvl {
+	case lvlPanic:
+		return SeverityPanic
+	case lvlFatal:
+		return SeverityFatal
+	case lvlError:
+		return SeverityError
+	case lvlWarning:
+		return SeverityWarning
+	case lvlInfo, lvlPrint, 1, -1:
+		return SeverityInfo
+	default:
+		return SeverityDebug
+	}
+}
+
+// Field is a key and a value attached to a message. The fields given as
+// arguments to the functions of the log are passed separately to the
+// backends, and written as key=value by the other loggers.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// KV returns the field with the key and the value.
+func KV(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+func (f Field) String() string {
+	return fmt.Sprintf("%s=%v", f.Key, f.Value)
+}
+
+// Entry is a message of the log, as given to a Backend.
+type Entry struct {
+	Time time.Time
+	// Level is the level of the message: 1 to 5 for Lvl1 to Lvl5, -1 to -5
+	// for LLvl1 to LLvl5, and other values for Info, Warn, Error and the
+	// others. Severity gives its meaning.
+	Level    int
+	Severity Severity
+	// Message holds the arguments that aren't fields, separated by spaces.
+	Message string
+	Fields  []Field
+	// File, Line and Function are where the message was logged.
+	File     string
+	Line     int
+	Function string
+}
+
+// Backend receives the messages of the log as entries, to route them into
+// the structured logger of an application, like zap, zerolog or slog. For
+// example, with zap:
+//
+//	func (z zapBackend) Log(e *log.Entry) {
+//		fields := []zap.Field{zap.String("caller",
+//			fmt.Sprintf("%s:%d", e.File, e.Line))}
+//		for _, f := range e.Fields {
+//			fields = append(fields, zap.Any(f.Key, f.Value))
+//		}
+//		switch e.Severity {
+//		case log.SeverityDebug:
+//			z.Debug(e.Message, fields...)
+//		...
+//		}
+//	}
+//
+// The backend mustn't exit or panic for the fatal errors and the panics, as
+// the log does it after sending them. It is called with the lock of the log,
+// so it can't log with onet itself.
+type Backend interface {
+	Log(e *Entry)
+}
+
+// BackendFunc is a function used as a Backend.
+type BackendFunc func(e *Entry)
+
+// Log calls f.
+func (f BackendFunc) Log(e *Entry) {
+	f(e)
+}
+
+// backendLogger is a logger whose messages can go to a backend.
+type backendLogger interface {
+	backend() Backend
+}
+
+type adapterLogger struct {
+	lInfo *LoggerInfo
+	b     Backend
+}
+
+// NewBackendLogger returns a logger sending the messages up to the debug
+// level of the LoggerInfo to the backend. The formatting options of the
+// LoggerInfo are ignored.
+func NewBackendLogger(b Backend, lInfo *LoggerInfo) Logger {
+	return &adapterLogger{lInfo: lInfo, b: b}
+}
+
+// Log is only called with the formatted messages, when the backend is nil.
+func (al *adapterLogger) Log(level int, msg string) {}
+
+func (al *adapterLogger) Close() {}
+
+func (al *adapterLogger) GetLoggerInfo() *LoggerInfo {
+	return al.lInfo
+}
+
+func (al *adapterLogger) backend() Backend {
+	return al.b
+}
+
+// SetBackend sends the messages of the standard logger to the backend
+// instead of the standard output, for applications logging everything with
+// their own logger. The debug level of the standard logger still applies,
+// and the information, warnings and errors are sent even at level 0. Nil
+// sends the messages to the standard output again.
+func SetBackend(b Backend) {
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	loggers[0].(*stdLogger).b = b
+}
+
+func (sl *stdLogger) backend() Backend {
+	return sl.b
+}
+
+// stdBackend returns the backend of the standard logger.
+func stdBackend() Backend {
+	debugMut.RLock()
+	defer debugMut.RUnlock()
+	return loggers[0].(*stdLogger).b
+}
+
+// newEntry returns the entry of the message logged by the caller.
+func newEntry(lvl, skip int, args []interface{}) *Entry {
+	e := &Entry{
+		Time:     time.Now(),
+		Level:    lvl,
+		Severity: LevelSeverity(lvl),
+	}
+	var msg []interface{}
+	for _, a := range args {
+		if f, ok := a.(Field); ok {
+			e.Fields = append(e.Fields, f)
+		} else {
+			msg = append(msg, a)
+		}
+	}
+	e.Message = strings.TrimSuffix(fmt.Sprintln(msg...), "\n")
+	pc, file, line, ok := runtime.Caller(skip + 1)
+	if ok {
+		e.File = filepath.Base(file)
+		e.Line = line
+		e.Function = runtime.FuncForPC(pc).Name()
+	}
+	return e
+}
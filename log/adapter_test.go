@@ -0,0 +1,70 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetBackend(t *testing.T) {
+	lvl := DebugVisible()
+	defer SetDebugVisible(lvl)
+	SetDebugVisible(0)
+	GetStdOut()
+	GetStdErr()
+
+	var entries []*Entry
+	SetBackend(BackendFunc(func(e *Entry) {
+		entries = append(entries, e)
+	}))
+	Info("information", KV("peer", "conode1"), 3)
+	Lvl1("not shown")
+	Warn("warning")
+	SetDebugVisible(2)
+	Lvl2("debugging")
+	SetBackend(nil)
+	Lvl2("to the output", KV("key", 1))
+
+	require.Empty(t, GetStdErr())
+	require.Contains(t, GetStdOut(), "to the output key=1")
+	require.Equal(t, 3, len(entries))
+	require.Equal(t, lvlInfo, entries[0].Level)
+	require.Equal(t, SeverityInfo, entries[0].Severity)
+	require.Equal(t, "information 3", entries[0].Message)
+	require.Equal(t, []Field{{Key: "peer", Value: "conode1"}}, entries[0].Fields)
+	require.Equal(t, "adapter_test.go", entries[0].File)
+	require.Equal(t, "go.dedis.ch/onet/v3/log.TestSetBackend", entries[0].Function)
+	require.Equal(t, SeverityWarning, entries[1].Severity)
+	require.Equal(t, 2, entries[2].Level)
+	require.Equal(t, SeverityDebug, entries[2].Severity)
+	require.Equal(t, "adapter_test.go", entries[2].File)
+}
+
+func TestNewBackendLogger(t *testing.T) {
+	var entries []*Entry
+	key := RegisterLogger(NewBackendLogger(BackendFunc(func(e *Entry) {
+		entries = append(entries, e)
+	}), &LoggerInfo{DebugLvl: 3}))
+	Lvl3("debugging")
+	Lvl4("not sent")
+	Error("error")
+	UnregisterLogger(key)
+	Lvl3("unregistered")
+	GetStdOut()
+	GetStdErr()
+
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, "debugging", entries[0].Message)
+	require.Equal(t, SeverityError, entries[1].Severity)
+}
+
+func TestLevelSeverity(t *testing.T) {
+	require.Equal(t, SeverityPanic, LevelSeverity(lvlPanic))
+	require.Equal(t, SeverityFatal, LevelSeverity(lvlFatal))
+	require.Equal(t, SeverityError, LevelSeverity(lvlError))
+	require.Equal(t, SeverityWarning, LevelSeverity(lvlWarning))
+	require.Equal(t, SeverityInfo, LevelSeverity(lvlPrint))
+	require.Equal(t, SeverityInfo, LevelSeverity(-1))
+	require.Equal(t, SeverityDebug, LevelSeverity(2))
+	require.Equal(t, "warning", SeverityWarning.String())
+}
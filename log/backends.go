@@ -0,0 +1,56 @@
+package log
+
+// SyslogConfig is the configuration of the logger of NewSyslogLoggerFromConfig,
+// for example the [Syslog] section of the configuration of a conode.
+type SyslogConfig struct {
+	// Tag of the messages, the name of the binary if it is empty.
+	Tag string `toml:",omitempty"`
+	// Facility of the messages, like "daemon", which is the default, or
+	// "local0" to "local7".
+	Facility string `toml:",omitempty"`
+	// DebugLvl is the highest debug level of the messages sent. At 0, only
+	// the information, warnings and errors are sent.
+	DebugLvl int `toml:",omitempty"`
+}
+
+// JournaldConfig is the configuration of the logger of NewJournaldLogger,
+// for example the [Journald] section of the configuration of a conode.
+type JournaldConfig struct {
+	// Identifier is the SYSLOG_IDENTIFIER of the messages, the name of the
+	// binary if it is empty.
+	Identifier string `toml:",omitempty"`
+	// DebugLvl is the highest debug level of the messages sent. At 0, only
+	// the information, warnings and errors are sent.
+	DebugLvl int `toml:",omitempty"`
+	// Socket of journald, for the tests.
+	Socket string `toml:"-"`
+}
+
+// The severities of syslog, also used by journald.
+const (
+	severityAlert   = 1
+	severityCrit    = 2
+	severityErr     = 3
+	severityWarning = 4
+	severityInfo    = 6
+	severityDebug   = 7
+)
+
+// severity returns the severity of syslog of the messages of the level: the
+// panics are alerts and the fatal errors are critical.
+func severity(lvl int) int {
+	switch LevelSeverity(lvl) {
+	case SeverityPanic:
+		return severityAlert
+	case SeverityFatal:
+		return severityCrit
+	case SeverityError:
+		return severityErr
+	case SeverityWarning:
+		return severityWarning
+	case SeverityInfo:
+		return severityInfo
+	default:
+		return severityDebug
+	}
+}
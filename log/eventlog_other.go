@@ -0,0 +1,23 @@
+// +build !windows
+
+package log
+
+import "golang.org/x/xerrors"
+
+// NewEventLogLogger returns an error, as there is no event log on this
+// platform.
+func NewEventLogLogger(lInfo *LoggerInfo, source string) (Logger, error) {
+	return nil, xerrors.New("the event log is only supported on Windows")
+}
+
+// InstallEventLogSource returns an error, as there is no event log on this
+// platform.
+func InstallEventLogSource(source string) error {
+	return xerrors.New("the event log is only supported on Windows")
+}
+
+// RemoveEventLogSource returns an error, as there is no event log on this
+// platform.
+func RemoveEventLogSource(source string) error {
+	return xerrors.New("the event log is only supported on Windows")
+}
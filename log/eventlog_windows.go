@@ -0,0 +1,71 @@
+// +build windows
+
+package log
+
+import (
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/xerrors"
+)
+
+// eventID is the identifier of all the events of the log.
+const eventID = 1
+
+type eventLogLogger struct {
+	lInfo *LoggerInfo
+	log   *eventlog.Log
+}
+
+// Log sends the message to the event log, as an error, a warning or an
+// information depending on its level.
+func (el *eventLogLogger) Log(level int, msg string) {
+	var err error
+	switch severity(level) {
+	case severityAlert, severityCrit, severityErr:
+		err = el.log.Error(eventID, msg)
+	case severityWarning:
+		err = el.log.Warning(eventID, msg)
+	default:
+		err = el.log.Info(eventID, msg)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (el *eventLogLogger) Close() {
+	el.log.Close()
+}
+
+func (el *eventLogLogger) GetLoggerInfo() *LoggerInfo {
+	return el.lInfo
+}
+
+// NewEventLogLogger creates a logger that writes into the Windows event log
+// with the given source, which must have been installed, like
+// InstallEventLogSource does.
+func NewEventLogLogger(lInfo *LoggerInfo, source string) (Logger, error) {
+	l, err := eventlog.Open(source)
+	if err != nil {
+		return nil, xerrors.Errorf("event log: %v", err)
+	}
+	return &eventLogLogger{lInfo: lInfo, log: l}, nil
+}
+
+// InstallEventLogSource registers the source of the messages of the event
+// log. It needs the rights of an administrator.
+func InstallEventLogSource(source string) error {
+	err := eventlog.InstallAsEventCreate(source,
+		eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		return xerrors.Errorf("installing event source: %v", err)
+	}
+	return nil
+}
+
+// RemoveEventLogSource removes the source of the messages of the event log.
+func RemoveEventLogSource(source string) error {
+	if err := eventlog.Remove(source); err != nil {
+		return xerrors.Errorf("removing event source: %v", err)
+	}
+	return nil
+}
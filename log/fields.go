@@ -0,0 +1,144 @@
+package log
+
+import (
+	"context"
+	"fmt"
+)
+
+// FieldLogger logs messages with its fields after the arguments, so that
+// the messages of a piece of work, like a request or a protocol instance,
+// can be correlated. It is passed down with the work, or in its context with
+// NewContext. The zero value logs the messages without fields.
+type FieldLogger struct {
+	fields []Field
+}
+
+// WithFields returns the FieldLogger adding the fields to the messages.
+func WithFields(fields ...Field) FieldLogger {
+	return FieldLogger{}.With(fields...)
+}
+
+// With returns a FieldLogger with the fields of l and the given ones, which
+// replace the ones of l with the same keys.
+func (l FieldLogger) With(fields ...Field) FieldLogger {
+	all := make([]Field, 0, len(l.fields)+len(fields))
+	for _, f := range l.fields {
+		if !hasKey(fields, f.Key) {
+			all = append(all, f)
+		}
+	}
+	return FieldLogger{fields: append(all, fields...)}
+}
+
+// Fields returns the fields of the logger.
+func (l FieldLogger) Fields() []Field {
+	return append([]Field(nil), l.fields...)
+}
+
+func (l FieldLogger) args(args []interface{}) []interface{} {
+	args = args[:len(args):len(args)]
+	for _, f := range l.fields {
+		args = append(args, f)
+	}
+	return args
+}
+
+// The methods call lvl and logLvl directly, so that the caller is found at
+// the same depth as with the functions of the package.
+
+// Lvl1 is like the function Lvl1.
+func (l FieldLogger) Lvl1(args ...interface{}) { lvl(1, 2, l.args(args)...) }
+
+// Lvl2 is like the function Lvl2.
+func (l FieldLogger) Lvl2(args ...interface{}) { lvl(2, 2, l.args(args)...) }
+
+// Lvl3 is like the function Lvl3.
+func (l FieldLogger) Lvl3(args ...interface{}) { lvl(3, 2, l.args(args)...) }
+
+// Lvl4 is like the function Lvl4.
+func (l FieldLogger) Lvl4(args ...interface{}) { lvl(4, 2, l.args(args)...) }
+
+// Lvl5 is like the function Lvl5.
+func (l FieldLogger) Lvl5(args ...interface{}) { lvl(5, 2, l.args(args)...) }
+
+// Lvlf1 is like the function Lvlf1.
+func (l FieldLogger) Lvlf1(f string, args ...interface{}) {
+	lvl(1, 2, l.args([]interface{}{fmt.Sprintf(f, args...)})...)
+}
+
+// Lvlf2 is like the function Lvlf2.
+func (l FieldLogger) Lvlf2(f string, args ...interface{}) {
+	lvl(2, 2, l.args([]interface{}{fmt.Sprintf(f, args...)})...)
+}
+
+// Lvlf3 is like the function Lvlf3.
+func (l FieldLogger) Lvlf3(f string, args ...interface{}) {
+	lvl(3, 2, l.args([]interface{}{fmt.Sprintf(f, args...)})...)
+}
+
+// Lvlf4 is like the function Lvlf4.
+func (l FieldLogger) Lvlf4(f string, args ...interface{}) {
+	lvl(4, 2, l.args([]interface{}{fmt.Sprintf(f, args...)})...)
+}
+
+// Lvlf5 is like the function Lvlf5.
+func (l FieldLogger) Lvlf5(f string, args ...interface{}) {
+	lvl(5, 2, l.args([]interface{}{fmt.Sprintf(f, args...)})...)
+}
+
+func (l FieldLogger) ui(lvl int, args []interface{}) {
+	logLvl(lvl, 3, DebugVisible() <= 0 && stdBackend() == nil, l.args(args)...)
+}
+
+// Info is like the function Info.
+func (l FieldLogger) Info(args ...interface{}) { l.ui(lvlInfo, args) }
+
+// Infof is like the function Infof.
+func (l FieldLogger) Infof(f string, args ...interface{}) {
+	l.ui(lvlInfo, []interface{}{fmt.Sprintf(f, args...)})
+}
+
+// Warn is like the function Warn.
+func (l FieldLogger) Warn(args ...interface{}) { l.ui(lvlWarning, args) }
+
+// Warnf is like the function Warnf.
+func (l FieldLogger) Warnf(f string, args ...interface{}) {
+	l.ui(lvlWarning, []interface{}{fmt.Sprintf(f, args...)})
+}
+
+// Error is like the function Error.
+func (l FieldLogger) Error(args ...interface{}) {
+	if last := len(args) - 1; last >= 0 {
+		if err, ok := args[last].(error); ok {
+			args[last] = fmt.Sprintf("%+v", err)
+		}
+	}
+	l.ui(lvlError, args)
+}
+
+// Errorf is like the function Errorf.
+func (l FieldLogger) Errorf(f string, args ...interface{}) {
+	l.ui(lvlError, []interface{}{fmt.Sprintf(f, args...)})
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx holding the logger.
+func NewContext(ctx context.Context, l FieldLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger held by ctx, or one without fields.
+func FromContext(ctx context.Context) FieldLogger {
+	l, _ := ctx.Value(loggerKey{}).(FieldLogger)
+	return l
+}
+
+func hasKey(fields []Field, key string) bool {
+	for _, f := range fields {
+		if f.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package log
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldLogger(t *testing.T) {
+	lvl := DebugVisible()
+	defer SetDebugVisible(lvl)
+	SetDebugVisible(1)
+	GetStdOut()
+
+	l := WithFields(KV("protocol", "count"), KV("round", 1))
+	l.Lvl1("with fields")
+	require.Contains(t, GetStdOut(), "(log.TestFieldLogger)")
+	l.Lvlf1("with %s", "format")
+	require.Contains(t, GetStdOut(), "with format protocol=count round=1\n")
+	Lvl1("without")
+	require.Contains(t, GetStdOut(), "without\n")
+
+	round := l.With(KV("round", 2))
+	require.Equal(t, []Field{{"protocol", "count"}, {"round", 2}}, round.Fields())
+	require.Equal(t, []Field{{"protocol", "count"}, {"round", 1}}, l.Fields())
+
+	ctx := NewContext(context.Background(), round)
+	require.Equal(t, round, FromContext(ctx))
+	require.Empty(t, FromContext(context.Background()).Fields())
+
+	var entries []*Entry
+	key := RegisterLogger(NewBackendLogger(BackendFunc(func(e *Entry) {
+		entries = append(entries, e)
+	}), &LoggerInfo{DebugLvl: 1}))
+	FromContext(ctx).Warn("to the backend", KV("key", "value"))
+	UnregisterLogger(key)
+	require.Equal(t, 1, len(entries))
+	require.Equal(t, "to the backend", entries[0].Message)
+	require.Equal(t, []Field{{"key", "value"}, {"protocol", "count"}, {"round", 2}},
+		entries[0].Fields)
+	require.Contains(t, entries[0].File, "fields_test.go")
+}
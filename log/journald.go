@@ -0,0 +1,80 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// journaldSocket is where journald receives the messages of its native
+// protocol.
+const journaldSocket = "/run/systemd/journal/socket"
+
+type journaldLogger struct {
+	lInfo      *LoggerInfo
+	identifier string
+	conn       *net.UnixConn
+}
+
+// NewJournaldLogger creates a logger that sends the messages to
+// systemd-journald with its native protocol, with the priority of their
+// level and the identifier of the configuration.
+func NewJournaldLogger(cfg JournaldConfig) (Logger, error) {
+	socket := cfg.Socket
+	if socket == "" {
+		socket = journaldSocket
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, xerrors.Errorf("connecting to journald: %v", err)
+	}
+	identifier := cfg.Identifier
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+	return &journaldLogger{
+		lInfo:      &LoggerInfo{DebugLvl: cfg.DebugLvl},
+		identifier: identifier,
+		conn:       conn,
+	}, nil
+}
+
+// Log is called with the lock of the log package, so the errors can't be
+// logged and are written to the standard error.
+func (jl *journaldLogger) Log(level int, msg string) {
+	var buf bytes.Buffer
+	writeJournaldField(&buf, "PRIORITY", strconv.Itoa(severity(level)))
+	writeJournaldField(&buf, "SYSLOG_IDENTIFIER", jl.identifier)
+	writeJournaldField(&buf, "MESSAGE", strings.TrimSuffix(msg, "\n"))
+	if _, err := jl.conn.Write(buf.Bytes()); err != nil {
+		fmt.Fprintln(stdErr, "Couldn't send to journald:", err)
+	}
+}
+
+// writeJournaldField writes the field in the native protocol of journald:
+// "NAME=value\n", or the name, a newline, the length of the value in 64
+// bits little endian, the value and a newline if the value has newlines.
+func writeJournaldField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(name + "=" + value + "\n")
+		return
+	}
+	buf.WriteString(name + "\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
+
+func (jl *journaldLogger) Close() {
+	jl.conn.Close()
+}
+
+func (jl *journaldLogger) GetLoggerInfo() *LoggerInfo {
+	return jl.lInfo
+}
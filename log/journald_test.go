@@ -0,0 +1,64 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournaldLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journald")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	l, err := NewJournaldLogger(JournaldConfig{Identifier: "conode", DebugLvl: 1,
+		Socket: socket})
+	require.NoError(t, err)
+	key := RegisterLogger(l)
+	defer UnregisterLogger(key)
+	buf := make([]byte, 1024)
+
+	Lvl1("starting")
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Contains(t, string(buf[:n]), "PRIORITY=6\nSYSLOG_IDENTIFIER=conode\nMESSAGE=")
+	require.Contains(t, string(buf[:n]), "starting\n")
+
+	lvl(lvlError, 2, "two\nlines")
+	n, err = conn.Read(buf)
+	require.NoError(t, err)
+	require.Contains(t, string(buf[:n]), "PRIORITY=3\n")
+	i := bytes.Index(buf[:n], []byte("MESSAGE\n"))
+	require.True(t, i > 0)
+	size := binary.LittleEndian.Uint64(buf[i+8 : i+16])
+	msg := string(buf[i+16 : n])
+	require.Equal(t, int(size)+1, len(msg))
+	require.Contains(t, msg, "two\nlines\n")
+
+	_, err = NewJournaldLogger(JournaldConfig{Socket: filepath.Join(dir, "none")})
+	require.Error(t, err)
+}
+
+func TestSeverity(t *testing.T) {
+	require.Equal(t, severityAlert, severity(lvlPanic))
+	require.Equal(t, severityCrit, severity(lvlFatal))
+	require.Equal(t, severityErr, severity(lvlError))
+	require.Equal(t, severityWarning, severity(lvlWarning))
+	require.Equal(t, severityInfo, severity(lvlInfo))
+	require.Equal(t, severityInfo, severity(1))
+	require.Equal(t, severityDebug, severity(2))
+	require.Equal(t, severityDebug, severity(-3))
+
+	_, err := NewSyslogLoggerFromConfig(SyslogConfig{Facility: "kernel"})
+	require.Error(t, err)
+}
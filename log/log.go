@@ -19,6 +19,14 @@
 //	log.LLvl2("Less important information")
 // By adding a single 'L' to the method, it *always* gets printed.
 //
+// The debug-level can also be set for some packages or files only, for
+// example to show the `Lvl3` of the network package and only the `Lvl1` of
+// overlay.go:
+//	log.SetPackageLevels(map[string]int{"network": 3, "overlay": 1})
+// To keep the messages in tight loops from flooding the log, every call site
+// can be limited to its first messages and then one in some of them:
+//	log.SetSampling(&log.Sampling{First: 10, Thereafter: 100, Period: time.Second})
+//
 // You can also add a 'f' to the name and use it like fmt.Printf:
 //	log.Lvlf1("Level: %d/%d", now, max)
 //
@@ -35,8 +43,14 @@
 // - Format == FormatPython - with some nice python-style formatting
 // - Format == FormatNone - just as plain text
 //
+// Applications with their own structured logger, like zap, zerolog or slog,
+// can route the messages there with SetBackend or NewBackendLogger, and
+// attach fields to them:
+//	log.Lvl2("Connected", log.KV("peer", si))
+//
 // The log-package also takes into account the following environment-variables:
 //	DEBUG_LVL // will act like SetDebugVisible
+//	DEBUG_PACKAGES // like "network=3,overlay=1", will act like SetPackageLevels
 //	DEBUG_TIME // if 'true' it will print the date and time
 //  DEBUG_FILEPATH // if 'true' it will print the absolute filepath
 //	DEBUG_COLOR // if 'false' it will not use colors
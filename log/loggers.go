@@ -118,6 +118,8 @@ func NewFileLogger(lInfo *LoggerInfo, path string) (Logger, error) {
 
 type stdLogger struct {
 	lInfo *LoggerInfo
+	// b receives the messages instead of the standard output, if it is set
+	b Backend
 }
 
 func (sl *stdLogger) Log(lvl int, msg string) {
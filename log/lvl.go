@@ -77,13 +77,47 @@ func init() {
 }
 
 func lvl(lvl, skip int, args ...interface{}) {
+	logLvl(lvl, skip+1, false, args...)
+}
+
+// logLvl sends the message to the loggers. If plain is true, the standard
+// logger prints it without formatting, like at debug level 0.
+func logLvl(lvl, skip int, plain bool, args ...interface{}) {
 	debugMut.Lock()
 	defer debugMut.Unlock()
-	for _, l := range loggers {
+	pkgLvl, hasPkgLvl := callerLvl(skip)
+	sampled := false
+	var entry *Entry
+	for key, l := range loggers {
 		// Get the *LoggerInfo that contains how should the formatting go.
 		lInfo := l.GetLoggerInfo()
 
-		if lvl > lInfo.DebugLvl {
+		maxLvl := lInfo.DebugLvl
+		if hasPkgLvl {
+			maxLvl = pkgLvl
+		}
+		if lvl > maxLvl {
+			continue
+		}
+		if !sampled {
+			sampled = true
+			keep, dropped := sample(lvl, skip)
+			if !keep {
+				return
+			}
+			if dropped > 0 {
+				args = append(args[:len(args):len(args)], KV("dropped", dropped))
+			}
+		}
+		if key == 0 && plain {
+			print(lvl, args...)
+			continue
+		}
+		if bl, ok := l.(backendLogger); ok && bl.backend() != nil {
+			if entry == nil {
+				entry = newEntry(lvl, skip, args)
+			}
+			bl.backend().Log(entry)
 			continue
 		}
 
@@ -159,7 +193,7 @@ func lvl(lvl, skip int, args ...interface{}) {
 // or
 // Lvl1 -> lvld -> lvl
 func lvlf(l int, f string, args ...interface{}) {
-	if l > DebugVisible() {
+	if l > visibleLvl() {
 		return
 	}
 	lvl(l, 3, fmt.Sprintf(f, args...))
@@ -373,6 +407,7 @@ func MainTest(m *testing.M, ls ...int) {
 
 // ParseEnv looks at the following environment-variables:
 //   DEBUG_LVL - for the actual debug-lvl - default is 1
+//   DEBUG_PACKAGES - the debug-lvl of some packages, like "network=3,overlay=1"
 //   DEBUG_TIME - whether to show the timestamp - default is false
 //   DEBUG_COLOR - whether to color the output - default is false
 //   DEBUG_PADDING - whether to pad the output nicely - default is true
@@ -387,6 +422,17 @@ func ParseEnv() {
 		}
 	}
 
+	dpk := os.Getenv("DEBUG_PACKAGES")
+	if dpk != "" {
+		levels, err := ParsePackageLevels(dpk)
+		Lvl3("Setting package levels to", dpk, levels, err)
+		if err != nil {
+			Error("Couldn't convert", dpk, "to package levels:", err)
+		} else {
+			SetPackageLevels(levels)
+		}
+	}
+
 	dt := os.Getenv("DEBUG_TIME")
 	if dt != "" {
 		dtInt, err := strconv.ParseBool(dt)
@@ -239,6 +239,7 @@ func ExampleLvl3() {
 
 func clearEnv() {
 	os.Setenv("DEBUG_LVL", "")
+	os.Setenv("DEBUG_PACKAGES", "")
 	os.Setenv("DEBUG_TIME", "")
 	os.Setenv("DEBUG_COLOR", "")
 	os.Setenv("DEBUG_PADDING", "")
@@ -0,0 +1,162 @@
+package log
+
+import (
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// The debug level of a package or of a file replaces the one of the loggers
+// for the messages logged there, to turn up the verbosity of one part of a
+// program without drowning it in the messages of the others. The levels are
+// looked up from the most specific name to the least specific one:
+//   - the name of the file, like "router" for router.go
+//   - the import path of the package, like "go.dedis.ch/onet/v3/network"
+//   - the name of the package, like "network", or "onet" for the one of
+//     "go.dedis.ch/onet/v3"
+//   - the parents of the import path, like "go.dedis.ch/onet/v3", which
+//     cover all the packages below them
+//
+// concurrent access is protected by debugMut
+var (
+	packageLevels map[string]int
+	// packageMaxLvl is the highest of the packageLevels
+	packageMaxLvl int
+	// callerLevels caches the package level of the callers by their program
+	// counter
+	callerLevels = make(map[uintptr]callerLevel)
+)
+
+type callerLevel struct {
+	lvl int
+	ok  bool
+}
+
+// versionSuffix matches the major version at the end of an import path.
+var versionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// SetPackageLevels replaces the debug levels of the packages and files, which
+// apply to all the loggers. Nil or an empty map removes them, so that the
+// level of every logger applies again.
+func SetPackageLevels(levels map[string]int) {
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	packageLevels = make(map[string]int)
+	packageMaxLvl = 0
+	for name, lvl := range levels {
+		packageLevels[name] = lvl
+		if lvl > packageMaxLvl {
+			packageMaxLvl = lvl
+		}
+	}
+	callerLevels = make(map[uintptr]callerLevel)
+}
+
+// PackageLevels returns a copy of the debug levels of the packages and files.
+func PackageLevels() map[string]int {
+	debugMut.RLock()
+	defer debugMut.RUnlock()
+	levels := make(map[string]int)
+	for name, lvl := range packageLevels {
+		levels[name] = lvl
+	}
+	return levels
+}
+
+// ParsePackageLevels parses a comma-separated list of debug levels of
+// packages or files, like "network=3,overlay=1".
+func ParsePackageLevels(list string) (map[string]int, error) {
+	levels := make(map[string]int)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		name := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || name == "" {
+			return nil, xerrors.Errorf("%q isn't name=level", entry)
+		}
+		lvl, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, xerrors.Errorf("level of %s: %v", name, err)
+		}
+		levels[name] = lvl
+	}
+	return levels, nil
+}
+
+// FormatPackageLevels returns the levels in the format of ParsePackageLevels,
+// sorted by name.
+func FormatPackageLevels(levels map[string]int) string {
+	var entries []string
+	for name, lvl := range levels {
+		entries = append(entries, name+"="+strconv.Itoa(lvl))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// visibleLvl returns the highest debug level shown by the standard logger,
+// either for all the messages or for the ones of some packages.
+func visibleLvl() int {
+	debugMut.RLock()
+	defer debugMut.RUnlock()
+	lvl := loggers[0].GetLoggerInfo().DebugLvl
+	if len(packageLevels) > 0 && packageMaxLvl > lvl {
+		lvl = packageMaxLvl
+	}
+	return lvl
+}
+
+// callerLvl returns the package level of the caller, and false if it has
+// none. It must be called with the lock of debugMut.
+func callerLvl(skip int) (int, bool) {
+	if len(packageLevels) == 0 {
+		return 0, false
+	}
+	pc, file, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return 0, false
+	}
+	cl, cached := callerLevels[pc]
+	if !cached {
+		for _, name := range callerNames(runtime.FuncForPC(pc).Name(), file) {
+			if cl.lvl, cl.ok = packageLevels[name]; cl.ok {
+				break
+			}
+		}
+		callerLevels[pc] = cl
+	}
+	return cl.lvl, cl.ok
+}
+
+// callerNames returns the names the level of a caller is looked up by, from
+// the most specific to the least specific one.
+func callerNames(funcName, file string) []string {
+	names := []string{strings.TrimSuffix(filepath.Base(file), ".go")}
+	// the package ends at the first dot after the last slash, like in
+	// go.dedis.ch/onet/v3/network.(*Router).Start
+	slash := strings.LastIndex(funcName, "/")
+	dot := strings.Index(funcName[slash+1:], ".")
+	if dot < 0 {
+		return names
+	}
+	pkg := funcName[:slash+1+dot]
+	names = append(names, pkg)
+	elems := strings.Split(pkg, "/")
+	last := elems[len(elems)-1]
+	if versionSuffix.MatchString(last) && len(elems) > 1 {
+		last = elems[len(elems)-2]
+	}
+	names = append(names, last)
+	for i := len(elems) - 1; i > 0; i-- {
+		names = append(names, strings.Join(elems[:i], "/"))
+	}
+	return names
+}
@@ -0,0 +1,81 @@
+package log
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageLevels(t *testing.T) {
+	lvl := DebugVisible()
+	defer SetDebugVisible(lvl)
+	defer SetPackageLevels(nil)
+	SetDebugVisible(1)
+	GetStdOut()
+
+	SetPackageLevels(map[string]int{"log": 3})
+	Lvl3("package level")
+	require.True(t, containsStdOut("package level"))
+	Lvlf3("package %s", "format")
+	require.True(t, containsStdOut("package format"))
+
+	// the file is more specific than the package
+	SetPackageLevels(map[string]int{"log": 3, "packages_test": 0})
+	Lvl1("file level")
+	require.False(t, containsStdOut("file level"))
+	LLvl1("always")
+	require.True(t, containsStdOut("always"))
+
+	SetPackageLevels(map[string]int{"go.dedis.ch/onet/v3": 2})
+	Lvl2("parent level")
+	require.True(t, containsStdOut("parent level"))
+	Lvl3("parent level")
+	require.False(t, containsStdOut("parent level"))
+	require.Equal(t, map[string]int{"go.dedis.ch/onet/v3": 2}, PackageLevels())
+
+	SetPackageLevels(map[string]int{"network": 5})
+	Lvl2("other package")
+	require.False(t, containsStdOut("other package"))
+
+	SetPackageLevels(nil)
+	Lvl2("global level")
+	require.False(t, containsStdOut("global level"))
+	require.Empty(t, PackageLevels())
+
+	os.Setenv("DEBUG_PACKAGES", "log=2, overlay=1")
+	defer clearEnv()
+	ParseEnv()
+	require.Equal(t, map[string]int{"log": 2, "overlay": 1}, PackageLevels())
+}
+
+func TestParsePackageLevels(t *testing.T) {
+	levels, err := ParsePackageLevels(" network=3,overlay = 1,")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"network": 3, "overlay": 1}, levels)
+	require.Equal(t, "network=3,overlay=1", FormatPackageLevels(levels))
+
+	levels, err = ParsePackageLevels("")
+	require.NoError(t, err)
+	require.Empty(t, levels)
+
+	_, err = ParsePackageLevels("network")
+	require.Error(t, err)
+	_, err = ParsePackageLevels("=3")
+	require.Error(t, err)
+	_, err = ParsePackageLevels("network=high")
+	require.Error(t, err)
+}
+
+func TestCallerNames(t *testing.T) {
+	require.Equal(t, []string{"router", "go.dedis.ch/onet/v3/network", "network",
+		"go.dedis.ch/onet/v3", "go.dedis.ch/onet", "go.dedis.ch"},
+		callerNames("go.dedis.ch/onet/v3/network.(*Router).Start.func1",
+			"/src/onet/network/router.go"))
+	require.Equal(t, []string{"overlay", "go.dedis.ch/onet/v3", "onet",
+		"go.dedis.ch/onet", "go.dedis.ch"},
+		callerNames("go.dedis.ch/onet/v3.(*Overlay).TransmitMsg",
+			"/src/onet/overlay.go"))
+	require.Equal(t, []string{"main", "main", "main"},
+		callerNames("main.main", "/src/main.go"))
+}
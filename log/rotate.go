@@ -0,0 +1,234 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// FileConfig is the configuration of a log file written by the logger of
+// NewRotatingFileLogger, for example the [Log] section of the configuration of
+// a conode.
+type FileConfig struct {
+	// Path is the file the messages are appended to.
+	Path string
+	// DebugLvl is the highest debug level of the messages written. At 0,
+	// only the information, warnings and errors are written.
+	DebugLvl int `toml:",omitempty"`
+	// ShowTime writes the time of every message.
+	ShowTime bool `toml:",omitempty"`
+	// MaxSize is the size in bytes after which the file is rotated. If it is
+	// 0, the file is never rotated.
+	MaxSize int64 `toml:",omitempty"`
+	// MaxFiles is the number of rotated files kept. If it is 0, all files
+	// are kept.
+	MaxFiles int `toml:",omitempty"`
+	// MaxAge is how long the rotated files are kept, like "168h". If it is
+	// empty, they are kept regardless of their age.
+	MaxAge string `toml:",omitempty"`
+	// Compress compresses the rotated files with gzip.
+	Compress bool `toml:",omitempty"`
+}
+
+// rotatedSuffix is the time appended to the name of a rotated file.
+const rotatedSuffix = "20060102T150405.000000000"
+
+type rotatingFileLogger struct {
+	lInfo  *LoggerInfo
+	cfg    FileConfig
+	maxAge time.Duration
+	file   *os.File
+	size   int64
+	// waits for the compression of the rotated files, done one at a time
+	wg          sync.WaitGroup
+	compressMut sync.Mutex
+}
+
+// NewRotatingFileLogger creates a logger that appends to the file of the
+// configuration, and rotates it when it grows bigger than MaxSize: the file
+// is renamed by appending the time to its name, optionally compressed, and
+// the rotated files beyond MaxFiles or older than MaxAge are removed.
+func NewRotatingFileLogger(cfg FileConfig) (Logger, error) {
+	if cfg.Path == "" {
+		return nil, xerrors.New("missing path of the log file")
+	}
+	fl := &rotatingFileLogger{
+		lInfo: &LoggerInfo{
+			DebugLvl: cfg.DebugLvl,
+			ShowTime: cfg.ShowTime,
+			Padding:  true,
+		},
+		cfg: cfg,
+	}
+	if cfg.MaxAge != "" {
+		var err error
+		fl.maxAge, err = time.ParseDuration(cfg.MaxAge)
+		if err != nil {
+			return nil, xerrors.Errorf("MaxAge: %v", err)
+		}
+	}
+	if err := fl.open(); err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+func (fl *rotatingFileLogger) open() error {
+	f, err := os.OpenFile(fl.cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return xerrors.Errorf("opening log file: %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return xerrors.Errorf("opening log file: %v", err)
+	}
+	fl.file = f
+	fl.size = fi.Size()
+	return nil
+}
+
+// Log is called with the lock of the log package, so the errors can't be
+// logged and are written to the standard error.
+func (fl *rotatingFileLogger) Log(level int, msg string) {
+	if fl.file == nil {
+		// a rotation failed to open the new file
+		if err := fl.open(); err != nil {
+			fmt.Fprintln(stdErr, "Couldn't open the log file:", err)
+			return
+		}
+	}
+	if fl.cfg.MaxSize > 0 && fl.size > 0 && fl.size+int64(len(msg)) > fl.cfg.MaxSize {
+		if err := fl.rotate(); err != nil {
+			fmt.Fprintln(stdErr, "Couldn't rotate the log file:", err)
+		}
+		if fl.file == nil {
+			return
+		}
+	}
+	n, err := fl.file.WriteString(msg)
+	fl.size += int64(n)
+	if err != nil {
+		fmt.Fprintln(stdErr, "Couldn't write to the log file:", err)
+	}
+}
+
+// rotate renames the current file, and removes the rotated files beyond the
+// limits. The compression of the rotated file runs in the background.
+func (fl *rotatingFileLogger) rotate() error {
+	err := fl.file.Close()
+	fl.file = nil
+	if err != nil {
+		return err
+	}
+	rotated := fl.cfg.Path + "." + time.Now().UTC().Format(rotatedSuffix)
+	if err := os.Rename(fl.cfg.Path, rotated); err != nil {
+		return err
+	}
+	if err := fl.open(); err != nil {
+		return err
+	}
+	if fl.cfg.Compress {
+		fl.wg.Add(1)
+		go func() {
+			defer fl.wg.Done()
+			fl.compressMut.Lock()
+			defer fl.compressMut.Unlock()
+			if err := compressFile(rotated); err != nil {
+				fmt.Fprintln(stdErr, "Couldn't compress the log file:", err)
+			}
+			if err := fl.removeOld(); err != nil {
+				fmt.Fprintln(stdErr, "Couldn't remove the old log files:", err)
+			}
+		}()
+		return nil
+	}
+	return fl.removeOld()
+}
+
+// removeOld removes the rotated files beyond MaxFiles or older than MaxAge.
+func (fl *rotatingFileLogger) removeOld() error {
+	if fl.cfg.MaxFiles <= 0 && fl.maxAge <= 0 {
+		return nil
+	}
+	files, err := filepath.Glob(fl.cfg.Path + ".*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	var kept []string
+	for _, f := range files {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(f, fl.cfg.Path+"."), ".gz")
+		t, err := time.Parse(rotatedSuffix, suffix)
+		if err != nil {
+			// not a rotated file, or one being compressed
+			continue
+		}
+		if fl.maxAge > 0 && time.Since(t) > fl.maxAge {
+			if err := os.Remove(f); err != nil {
+				return err
+			}
+			continue
+		}
+		kept = append(kept, f)
+	}
+	for fl.cfg.MaxFiles > 0 && len(kept) > fl.cfg.MaxFiles {
+		if err := os.Remove(kept[0]); err != nil {
+			return err
+		}
+		kept = kept[1:]
+	}
+	return nil
+}
+
+// compressFile replaces the file with its gzip compression, with the ".gz"
+// extension.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := path + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Close waits for the compression of the rotated files and closes the file.
+func (fl *rotatingFileLogger) Close() {
+	fl.wg.Wait()
+	if fl.file != nil {
+		fl.file.Close()
+		fl.file = nil
+	}
+}
+
+func (fl *rotatingFileLogger) GetLoggerInfo() *LoggerInfo {
+	return fl.lInfo
+}
@@ -0,0 +1,77 @@
+package log
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFileLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "conode.log")
+
+	_, err = NewRotatingFileLogger(FileConfig{})
+	require.Error(t, err)
+	_, err = NewRotatingFileLogger(FileConfig{Path: path, MaxAge: "a week"})
+	require.Error(t, err)
+
+	l, err := NewRotatingFileLogger(FileConfig{Path: path, DebugLvl: 1,
+		MaxSize: 100, MaxFiles: 2})
+	require.NoError(t, err)
+	key := RegisterLogger(l)
+	for i := 0; i < 10; i++ {
+		Lvl1(strings.Repeat("x", 60))
+	}
+	Lvl2("not written")
+	UnregisterLogger(key)
+
+	rotated, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(rotated))
+	for _, f := range append(rotated, path) {
+		buf, err := ioutil.ReadFile(f)
+		require.NoError(t, err)
+		require.Equal(t, 1, strings.Count(string(buf), "\n"))
+		require.NotContains(t, string(buf), "not written")
+	}
+}
+
+func TestRotatingFileLogger_Compress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "conode.log")
+	// a file rotated long ago
+	old := path + "." + time.Now().Add(-48*time.Hour).UTC().Format(rotatedSuffix) + ".gz"
+	require.NoError(t, ioutil.WriteFile(old, nil, 0600))
+
+	l, err := NewRotatingFileLogger(FileConfig{Path: path, MaxSize: 100,
+		MaxAge: "24h", Compress: true})
+	require.NoError(t, err)
+	l.Log(lvlInfo, strings.Repeat("x", 60)+"\n")
+	l.Log(lvlInfo, strings.Repeat("y", 60)+"\n")
+	l.Close()
+
+	_, err = os.Stat(old)
+	require.True(t, os.IsNotExist(err))
+	rotated, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(rotated))
+	require.True(t, strings.HasSuffix(rotated[0], ".gz"))
+	f, err := os.Open(rotated[0])
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	buf, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("x", 60)+"\n", string(buf))
+}
@@ -0,0 +1,85 @@
+package log
+
+import (
+	"runtime"
+	"time"
+)
+
+// Sampling limits the messages logged by every call site, so that the ones
+// in tight loops, like the messages of the router for every packet, can't
+// flood the log on large rosters. Every call site logs its First messages of
+// every Period, and then one in Thereafter. The fatal errors and the panics
+// are always logged.
+//
+// The first message logged after some were dropped gets the number of
+// dropped messages in the field "dropped".
+type Sampling struct {
+	// First is the number of messages of every call site logged in every
+	// period.
+	First int
+	// Thereafter is the sampling of the messages after the first ones: one in
+	// Thereafter messages is logged. If it is 0, they are all dropped, which
+	// limits the rate of every call site to First messages by Period.
+	Thereafter int
+	// Period after which the first messages are logged again. If it is 0,
+	// only the First messages since the call to SetSampling are.
+	Period time.Duration
+}
+
+// concurrent access is protected by debugMut
+var (
+	sampling *Sampling
+	// sampledSites are the counts of the call sites by their program counter
+	sampledSites = make(map[uintptr]*sampledSite)
+)
+
+type sampledSite struct {
+	start   time.Time
+	count   int
+	dropped int
+}
+
+// SetSampling limits the messages of every call site with the sampling, or
+// removes the limits if it is nil.
+func SetSampling(s *Sampling) {
+	debugMut.Lock()
+	defer debugMut.Unlock()
+	if s != nil {
+		cp := *s
+		s = &cp
+	}
+	sampling = s
+	sampledSites = make(map[uintptr]*sampledSite)
+}
+
+// sample returns whether the message of the caller is logged, and the number
+// of messages of the caller dropped before it. It must be called with the
+// lock of debugMut.
+func sample(lvl, skip int) (bool, int) {
+	if sampling == nil || lvl == lvlFatal || lvl == lvlPanic {
+		return true, 0
+	}
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return true, 0
+	}
+	now := time.Now()
+	site := sampledSites[pc]
+	if site == nil {
+		site = &sampledSite{start: now}
+		sampledSites[pc] = site
+	}
+	if sampling.Period > 0 && now.Sub(site.start) >= sampling.Period {
+		site.start = now
+		site.count = 0
+	}
+	site.count++
+	after := site.count - sampling.First
+	if after > 0 && (sampling.Thereafter <= 0 || after%sampling.Thereafter != 0) {
+		site.dropped++
+		return false, 0
+	}
+	dropped := site.dropped
+	site.dropped = 0
+	return true, dropped
+}
@@ -0,0 +1,48 @@
+package log
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampling(t *testing.T) {
+	lvl := DebugVisible()
+	defer SetDebugVisible(lvl)
+	SetDebugVisible(3)
+	defer SetSampling(nil)
+	GetStdOut()
+
+	SetSampling(&Sampling{First: 2, Thereafter: 3})
+	for i := 0; i < 10; i++ {
+		Lvl3("sampled", i)
+	}
+	Lvl3("other call site")
+	// not visible, so not counted
+	Lvl4("hidden")
+	out := GetStdOut()
+	for _, i := range []string{"0", "1", "4 dropped=2", "7 dropped=2"} {
+		require.Contains(t, out, "sampled "+i+"\n")
+	}
+	require.Equal(t, 4, strings.Count(out, "sampled"))
+	require.Contains(t, out, "other call site")
+
+	SetSampling(&Sampling{First: 1, Period: 50 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 5; j++ {
+			Lvl3("limited", i, j)
+		}
+		time.Sleep(60 * time.Millisecond)
+	}
+	out = GetStdOut()
+	require.Equal(t, 3, strings.Count(out, "limited"))
+	require.Contains(t, out, "limited 1 0 dropped=4\n")
+
+	SetSampling(nil)
+	for i := 0; i < 5; i++ {
+		Lvl3("unlimited")
+	}
+	require.Equal(t, 5, strings.Count(GetStdOut(), "unlimited"))
+}
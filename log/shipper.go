@@ -0,0 +1,334 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ShipperConfig is the configuration of the logger of NewShipper, for
+// example the [Ship] section of the configuration of a conode.
+type ShipperConfig struct {
+	// Loki is the URL of a Loki server, like "http://loki:3100", receiving
+	// the messages on its push API.
+	Loki string `toml:",omitempty"`
+	// Elasticsearch is the URL of an Elasticsearch server, like
+	// "http://elasticsearch:9200", receiving the messages on its bulk API,
+	// if Loki is empty.
+	Elasticsearch string `toml:",omitempty"`
+	// Index of Elasticsearch receiving the messages, "onet" if it is empty.
+	Index string `toml:",omitempty"`
+	// Labels are added to all the messages, like the conode they come from.
+	// With Loki, the messages are also labeled with their severity and with
+	// the field "service" of the messages having it.
+	Labels map[string]string `toml:",omitempty"`
+	// DebugLvl is the highest debug level of the messages sent. At 0, only
+	// the information, warnings and errors are sent.
+	DebugLvl int `toml:",omitempty"`
+	// BatchSize is the number of messages sent at once, 100 if it is 0.
+	BatchSize int `toml:",omitempty"`
+	// FlushInterval is the longest time the messages wait to be sent, like
+	// "5s". It is one second if it is empty.
+	FlushInterval string `toml:",omitempty"`
+	// MaxPending is the number of messages kept while the server can't be
+	// reached, 10000 if it is 0. The newer messages are dropped.
+	MaxPending int `toml:",omitempty"`
+}
+
+// shipper is the logger sending the messages to Loki or Elasticsearch.
+type shipper struct {
+	lInfo  *LoggerInfo
+	cfg    ShipperConfig
+	client *http.Client
+	// send sends a batch to the server
+	send func(batch []*Entry) error
+
+	mut     sync.Mutex
+	pending []*Entry
+	dropped int
+	flush   chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewShipper returns a logger sending the messages in batches to the Loki or
+// Elasticsearch server of the configuration, so that the logs of all the
+// conodes of a roster can be searched from one place. The messages are sent
+// in the background, and are kept while the server can't be reached. Close
+// sends the last ones.
+func NewShipper(cfg ShipperConfig) (Logger, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 10000
+	}
+	if cfg.Index == "" {
+		cfg.Index = "onet"
+	}
+	interval := time.Second
+	if cfg.FlushInterval != "" {
+		var err error
+		interval, err = time.ParseDuration(cfg.FlushInterval)
+		if err != nil || interval <= 0 {
+			return nil, xerrors.Errorf("invalid FlushInterval %q", cfg.FlushInterval)
+		}
+	}
+	s := &shipper{
+		lInfo:  &LoggerInfo{DebugLvl: cfg.DebugLvl},
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		flush:  make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	switch {
+	case cfg.Loki != "":
+		s.send = s.sendLoki
+	case cfg.Elasticsearch != "":
+		s.send = s.sendElasticsearch
+	default:
+		return nil, xerrors.New("need the URL of Loki or Elasticsearch")
+	}
+	go s.run(interval)
+	return s, nil
+}
+
+// Log is only called with the formatted messages, when the entries aren't
+// available.
+func (s *shipper) Log(level int, msg string) {}
+
+func (s *shipper) backend() Backend {
+	return BackendFunc(s.keep)
+}
+
+// Close sends the pending messages and stops the shipper.
+func (s *shipper) Close() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *shipper) GetLoggerInfo() *LoggerInfo {
+	return s.lInfo
+}
+
+// keep keeps the entry to be sent. It is called with the lock of the log, so
+// it doesn't wait for the server.
+func (s *shipper) keep(e *Entry) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if len(s.pending) >= s.cfg.MaxPending {
+		s.dropped++
+		return
+	}
+	s.pending = append(s.pending, e)
+	if len(s.pending) >= s.cfg.BatchSize {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *shipper) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failing := false
+	for {
+		stopping := false
+		select {
+		case <-ticker.C:
+		case <-s.flush:
+		case <-s.stop:
+			stopping = true
+		}
+		err := s.sendPending()
+		if stopping {
+			// Close is called with the lock of the log, which can't be
+			// used anymore
+			if err != nil {
+				fmt.Fprintln(stdErr, "Couldn't ship the end of the log:", err)
+			}
+			return
+		}
+		switch {
+		case err != nil && !failing:
+			// only the first failure is logged, as it is also shipped
+			Error("Couldn't ship the log:", err)
+		case err == nil && failing:
+			Info("Shipping the log again")
+		}
+		failing = err != nil
+	}
+}
+
+// sendPending sends the pending messages by batches, and keeps them if they
+// can't be sent.
+func (s *shipper) sendPending() error {
+	for {
+		s.mut.Lock()
+		n := len(s.pending)
+		if n > s.cfg.BatchSize {
+			n = s.cfg.BatchSize
+		}
+		batch := s.pending[:n]
+		dropped := s.dropped
+		s.mut.Unlock()
+		if dropped > 0 {
+			batch = append(batch[:n:n], &Entry{
+				Time:     time.Now(),
+				Level:    lvlWarning,
+				Severity: SeverityWarning,
+				Message:  "Log shipper dropped messages",
+				Fields:   []Field{KV("dropped", dropped)},
+			})
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.send(batch); err != nil {
+			return err
+		}
+		s.mut.Lock()
+		s.pending = s.pending[n:]
+		s.dropped -= dropped
+		s.mut.Unlock()
+	}
+}
+
+// post sends the body to the url, and returns an error if the server doesn't
+// accept it.
+func (s *shipper) post(url, contentType string, body []byte) error {
+	resp, err := s.client.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		return xerrors.Errorf("sending: %v", err)
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return xerrors.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// entryLine returns the message of the entry followed by its fields and the
+// place it was logged.
+func entryLine(e *Entry) string {
+	var b strings.Builder
+	b.WriteString(e.Message)
+	for _, f := range e.Fields {
+		b.WriteString(" ")
+		b.WriteString(f.String())
+	}
+	if e.File != "" {
+		fmt.Fprintf(&b, " caller=%s:%d", e.File, e.Line)
+	}
+	return b.String()
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// sendLoki sends the batch to the push API of Loki, with a stream by set of
+// labels.
+func (s *shipper) sendLoki(batch []*Entry) error {
+	streams := make(map[string]*lokiStream)
+	var keys []string
+	for _, e := range batch {
+		labels := map[string]string{"level": e.Severity.String()}
+		for k, v := range s.cfg.Labels {
+			labels[k] = v
+		}
+		for _, f := range e.Fields {
+			if f.Key == "service" {
+				labels["service"] = fmt.Sprint(f.Value)
+			}
+		}
+		key := fmt.Sprint(labels)
+		st, ok := streams[key]
+		if !ok {
+			st = &lokiStream{Stream: labels}
+			streams[key] = st
+			keys = append(keys, key)
+		}
+		st.Values = append(st.Values, [2]string{
+			strconv.FormatInt(e.Time.UnixNano(), 10), entryLine(e)})
+	}
+	sort.Strings(keys)
+	req := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, k := range keys {
+		req.Streams = append(req.Streams, streams[k])
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return xerrors.Errorf("encoding: %v", err)
+	}
+	return s.post(strings.TrimSuffix(s.cfg.Loki, "/")+"/loki/api/v1/push",
+		"application/json", body)
+}
+
+// sendElasticsearch sends the batch to the bulk API of Elasticsearch, with a
+// document by message holding its fields and the labels.
+func (s *shipper) sendElasticsearch(batch []*Entry) error {
+	var body bytes.Buffer
+	action, err := json.Marshal(map[string]interface{}{
+		"index": map[string]string{"_index": s.cfg.Index}})
+	if err != nil {
+		return xerrors.Errorf("encoding: %v", err)
+	}
+	for _, e := range batch {
+		doc := make(map[string]interface{})
+		for k, v := range s.cfg.Labels {
+			doc[k] = v
+		}
+		for _, f := range e.Fields {
+			doc[f.Key] = fieldValue(f.Value)
+		}
+		doc["@timestamp"] = e.Time.UTC().Format(time.RFC3339Nano)
+		doc["level"] = e.Severity.String()
+		doc["debug"] = e.Level
+		doc["message"] = e.Message
+		if e.File != "" {
+			doc["caller"] = fmt.Sprintf("%s:%d", e.File, e.Line)
+			doc["function"] = e.Function
+		}
+		buf, err := json.Marshal(doc)
+		if err != nil {
+			return xerrors.Errorf("encoding: %v", err)
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(buf)
+		body.WriteByte('\n')
+	}
+	return s.post(strings.TrimSuffix(s.cfg.Elasticsearch, "/")+"/_bulk",
+		"application/x-ndjson", body.Bytes())
+}
+
+// fieldValue returns the value of a field as encoded in a document: the
+// numbers, booleans and strings keep their type, and the other values are
+// formatted.
+func fieldValue(v interface{}) interface{} {
+	switch v.(type) {
+	case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16,
+		uint32, uint64, float32, float64:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,126 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bodies returns a server keeping the bodies of the requests, answering
+// with the status returned by the function.
+func bodies(status func() int) (*httptest.Server, func() [][]byte) {
+	var mut sync.Mutex
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadAll(r.Body)
+		mut.Lock()
+		bodies = append(bodies, append([]byte(r.URL.Path+"\n"), buf...))
+		mut.Unlock()
+		w.WriteHeader(status())
+	}))
+	return srv, func() [][]byte {
+		mut.Lock()
+		defer mut.Unlock()
+		return bodies
+	}
+}
+
+func TestShipper_Loki(t *testing.T) {
+	srv, received := bodies(func() int { return http.StatusNoContent })
+	defer srv.Close()
+	l, err := NewShipper(ShipperConfig{Loki: srv.URL, DebugLvl: 2,
+		Labels: map[string]string{"conode": "c1"}, FlushInterval: "1h"})
+	require.NoError(t, err)
+	key := RegisterLogger(l)
+	Lvl2("request", KV("service", "status"))
+	Lvl3("hidden")
+	UnregisterLogger(key)
+	GetStdOut()
+
+	require.Equal(t, 1, len(received()))
+	lines := bytes.SplitN(received()[0], []byte("\n"), 2)
+	require.Equal(t, "/loki/api/v1/push", string(lines[0]))
+	var req struct {
+		Streams []lokiStream
+	}
+	require.NoError(t, json.Unmarshal(lines[1], &req))
+	require.Equal(t, 1, len(req.Streams))
+	require.Equal(t, map[string]string{"conode": "c1", "level": "debug",
+		"service": "status"}, req.Streams[0].Stream)
+	require.Equal(t, 1, len(req.Streams[0].Values))
+	require.Contains(t, req.Streams[0].Values[0][1], "request service=status caller=shipper_test.go:")
+}
+
+func TestShipper_Elasticsearch(t *testing.T) {
+	srv, received := bodies(func() int { return http.StatusOK })
+	defer srv.Close()
+	l, err := NewShipper(ShipperConfig{Elasticsearch: srv.URL + "/",
+		Labels: map[string]string{"conode": "c1"}, FlushInterval: "1h"})
+	require.NoError(t, err)
+	key := RegisterLogger(l)
+	Info("information", KV("round", 3))
+	Warn("warning")
+	UnregisterLogger(key)
+	GetStdOut()
+	GetStdErr()
+
+	require.Equal(t, 1, len(received()))
+	scanner := bufio.NewScanner(bytes.NewReader(received()[0]))
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.Equal(t, 5, len(lines))
+	require.Equal(t, "/_bulk", lines[0])
+	require.Equal(t, `{"index":{"_index":"onet"}}`, lines[1])
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &doc))
+	require.Equal(t, "information", doc["message"])
+	require.Equal(t, "info", doc["level"])
+	require.Equal(t, "c1", doc["conode"])
+	require.Equal(t, 3.0, doc["round"])
+	require.NoError(t, json.Unmarshal([]byte(lines[4]), &doc))
+	require.Equal(t, "warning", doc["level"])
+}
+
+func TestShipper_Failure(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	var mut sync.Mutex
+	srv, received := bodies(func() int {
+		mut.Lock()
+		defer mut.Unlock()
+		return status
+	})
+	defer srv.Close()
+	l, err := NewShipper(ShipperConfig{Elasticsearch: srv.URL, MaxPending: 2,
+		FlushInterval: "1h"})
+	require.NoError(t, err)
+	s := l.(*shipper)
+	for i := 0; i < 3; i++ {
+		s.keep(&Entry{Time: time.Now(), Message: "message"})
+	}
+	require.Error(t, s.sendPending())
+	require.Equal(t, 2, len(s.pending))
+
+	mut.Lock()
+	status = http.StatusOK
+	mut.Unlock()
+	s.Close()
+	require.Equal(t, 2, len(received()))
+	require.Contains(t, string(received()[1]), `"dropped":1`)
+	require.Empty(t, s.pending)
+	require.Equal(t, 0, s.dropped)
+
+	_, err = NewShipper(ShipperConfig{})
+	require.Error(t, err)
+	_, err = NewShipper(ShipperConfig{Loki: srv.URL, FlushInterval: "soon"})
+	require.Error(t, err)
+}
@@ -13,8 +13,23 @@ type syslogLogger struct {
 	writer *syslog.Writer
 }
 
+// Log sends the message with the severity of its level, see severity.
 func (sl *syslogLogger) Log(level int, msg string) {
-	_, err := sl.writer.Write([]byte(msg))
+	var err error
+	switch severity(level) {
+	case severityAlert:
+		err = sl.writer.Alert(msg)
+	case severityCrit:
+		err = sl.writer.Crit(msg)
+	case severityErr:
+		err = sl.writer.Err(msg)
+	case severityWarning:
+		err = sl.writer.Warning(msg)
+	case severityInfo:
+		err = sl.writer.Info(msg)
+	default:
+		err = sl.writer.Debug(msg)
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -29,7 +44,7 @@ func (sl *syslogLogger) GetLoggerInfo() *LoggerInfo {
 }
 
 // NewSyslogLogger creates a logger that writes into syslog with
-// the given priority and tag, and is using the given LoggerInfo (without the
+// the facility of the given priority and tag, and is using the given LoggerInfo (without the
 // Logger).
 // It returns the logger.
 func NewSyslogLogger(lInfo *LoggerInfo, priority syslog.Priority, tag string) (Logger, error) {
@@ -42,3 +57,32 @@ func NewSyslogLogger(lInfo *LoggerInfo, priority syslog.Priority, tag string) (L
 		writer: writer,
 	}, nil
 }
+
+// syslogFacilities are the facilities of SyslogConfig.
+var syslogFacilities = map[string]syslog.Priority{
+	"user":   syslog.LOG_USER,
+	"daemon": syslog.LOG_DAEMON,
+	"local0": syslog.LOG_LOCAL0,
+	"local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4,
+	"local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6,
+	"local7": syslog.LOG_LOCAL7,
+}
+
+// NewSyslogLoggerFromConfig creates a logger that writes into the local
+// syslog with the facility and the tag of the configuration, and the
+// severity of the level of the messages.
+func NewSyslogLoggerFromConfig(cfg SyslogConfig) (Logger, error) {
+	facility := syslog.LOG_DAEMON
+	if cfg.Facility != "" {
+		var ok bool
+		facility, ok = syslogFacilities[cfg.Facility]
+		if !ok {
+			return nil, xerrors.Errorf("unknown facility %s", cfg.Facility)
+		}
+	}
+	return NewSyslogLogger(&LoggerInfo{DebugLvl: cfg.DebugLvl}, facility, cfg.Tag)
+}
@@ -0,0 +1,11 @@
+// +build !freebsd,!linux,!darwin
+
+package log
+
+import "golang.org/x/xerrors"
+
+// NewSyslogLoggerFromConfig returns an error, as there is no syslog on this
+// platform.
+func NewSyslogLoggerFromConfig(cfg SyslogConfig) (Logger, error) {
+	return nil, xerrors.New("syslog is not supported on this platform")
+}
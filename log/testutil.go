@@ -68,6 +68,13 @@ func matchesUserUninterestingGoroutine(stack string) bool {
 // Inspired by https://golang.org/src/net/http/main_test.go
 // and https://github.com/coreos/etcd/blob/master/pkg/testutil/leak.go
 func AfterTest(t *testing.T) {
+	AfterTestWithOwner(t, nil)
+}
+
+// AfterTestWithOwner is like AfterTest, but also prints the owner of every
+// leaking goroutine, as returned by owner for its stack. The owner is
+// omitted if owner is nil or returns an empty string.
+func AfterTestWithOwner(t *testing.T, owner func(stack string) string) {
 	var stackCount map[string]int
 	for i := 0; i < 10; i++ {
 		n := 0
@@ -85,10 +92,16 @@ func AfterTest(t *testing.T) {
 	}
 	if len(stackCount) > 0 {
 		for stack, count := range stackCount {
+			of := ""
+			if owner != nil {
+				if o := owner(stack); o != "" {
+					of = ", owned by " + o + ","
+				}
+			}
 			if t != nil {
-				t.Logf("%d instances of:\n%s\n", count, stack)
+				t.Logf("%d instances%s of:\n%s\n", count, of, stack)
 			} else {
-				Error(fmt.Sprintf("%d instances of:\n%s\n", count, stack))
+				Error(fmt.Sprintf("%d instances%s of:\n%s\n", count, of, stack))
 			}
 		}
 		Print("Stack-trace of caller: ", Stack())
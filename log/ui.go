@@ -7,11 +7,10 @@ import (
 )
 
 func lvlUI(l int, args ...interface{}) {
-	if DebugVisible() > 0 {
-		lvl(l, 3, args...)
-	} else {
-		print(l, args...)
-	}
+	// at level 0, the standard logger prints the messages without
+	// formatting, and the other loggers, like the log files, get them as
+	// usual
+	logLvl(l, 3, DebugVisible() <= 0 && stdBackend() == nil, args...)
 }
 
 // Info prints the arguments given with a 'info'-format
@@ -103,9 +102,8 @@ func ErrFatalf(err error, f string, args ...interface{}) {
 	}
 }
 
+// print must be called with the lock of debugMut.
 func print(lvl int, args ...interface{}) {
-	debugMut.Lock()
-	defer debugMut.Unlock()
 	out := stdOut
 	if lvl < lvlInfo {
 		out = stdErr
@@ -0,0 +1,121 @@
+package onet
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrMaintenance is returned for client requests and new protocol instances
+// while the conode is in maintenance mode.
+var ErrMaintenance = xerrors.New("conode is in maintenance")
+
+// maintenanceState tracks the maintenance mode and the client requests being
+// processed.
+type maintenanceState struct {
+	sync.Mutex
+	active   bool
+	inFlight int
+	// services still answering during maintenance, indexed by name
+	exempt map[string]bool
+}
+
+func newMaintenanceState() *maintenanceState {
+	return &maintenanceState{
+		// the status service must keep answering so that the state of
+		// the conode can be monitored
+		exempt: map[string]bool{"Status": true},
+	}
+}
+
+// allows returns whether the service can be used in the current state. A nil
+// state, for a websocket without server, allows everything.
+func (m *maintenanceState) allows(service string) bool {
+	if m == nil {
+		return true
+	}
+	m.Lock()
+	defer m.Unlock()
+	return !m.active || m.exempt[service]
+}
+
+// begin registers a client request for the service, or returns
+// ErrMaintenance. end must be called once the request is processed.
+func (m *maintenanceState) begin(service string) error {
+	if m == nil {
+		return nil
+	}
+	m.Lock()
+	defer m.Unlock()
+	if m.active && !m.exempt[service] {
+		return ErrMaintenance
+	}
+	m.inFlight++
+	return nil
+}
+
+func (m *maintenanceState) end() {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	m.inFlight--
+	m.Unlock()
+}
+
+func (m *maintenanceState) isActive() bool {
+	m.Lock()
+	defer m.Unlock()
+	return m.active
+}
+
+// EnterMaintenance stops accepting client requests and new protocol
+// instances, except for the services allowed with AllowInMaintenance. It
+// then waits for the client requests, including the open streams, and the
+// protocol instances in progress to finish. If ctx is done before, its error
+// is returned, but the conode stays in maintenance.
+func (c *Server) EnterMaintenance(ctx context.Context) error {
+	m := c.maintenance
+	m.Lock()
+	m.active = true
+	m.Unlock()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		m.Lock()
+		inFlight := m.inFlight
+		m.Unlock()
+		if inFlight == 0 && c.overlay.instancesCount() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return xerrors.Errorf("waiting for in-flight work: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// LeaveMaintenance accepts client requests and protocol instances again.
+func (c *Server) LeaveMaintenance() {
+	c.maintenance.Lock()
+	c.maintenance.active = false
+	c.maintenance.Unlock()
+}
+
+// InMaintenance returns whether the conode is in maintenance mode.
+func (c *Server) InMaintenance() bool {
+	return c.maintenance.isActive()
+}
+
+// AllowInMaintenance lets the service answer client requests and create
+// protocol instances during maintenance. The "Status" service is always
+// allowed.
+func (c *Server) AllowInMaintenance(service string) {
+	c.maintenance.Lock()
+	c.maintenance.exempt[service] = true
+	c.maintenance.Unlock()
+}
@@ -0,0 +1,89 @@
+package onet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestServer_Maintenance(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(2, true)
+	server := servers[0]
+
+	client := local.NewClient(testServiceName)
+	defer client.Close()
+	send := func() error {
+		return client.SendProtobuf(server.ServerIdentity, &testMsg{12}, &testMsg{})
+	}
+	require.NoError(t, send())
+
+	// a protocol instance is still running
+	pi, err := local.CreateProtocol(pingPongProtoName, tree)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = server.EnterMaintenance(ctx)
+	require.True(t, xerrors.Is(err, context.DeadlineExceeded))
+	require.True(t, server.InMaintenance())
+	require.Equal(t, "true", server.GetStatus().Field["Maintenance"])
+
+	err = send()
+	require.True(t, xerrors.Is(err, ErrMaintenance), err)
+	_, err = server.overlay.CreateProtocol(pingPongProtoName, tree, NilServiceID)
+	require.True(t, xerrors.Is(err, ErrMaintenance))
+
+	// the protocol can finish, as its other node is not in maintenance
+	require.NoError(t, pi.Start())
+	<-pi.(*pingPongProto).done
+	require.NoError(t, server.EnterMaintenance(context.Background()))
+
+	server.AllowInMaintenance(testServiceName)
+	require.NoError(t, send())
+	delete(server.maintenance.exempt, testServiceName)
+
+	server.LeaveMaintenance()
+	require.False(t, server.InMaintenance())
+	require.NoError(t, send())
+	pi, err = local.StartProtocol(pingPongProtoName, tree)
+	require.NoError(t, err)
+	<-pi.(*pingPongProto).done
+}
+
+func TestServer_MaintenanceStreaming(t *testing.T) {
+	serName := "streamingService"
+	_, err := RegisterNewService(serName, newStreamingService)
+	require.NoError(t, err)
+	defer UnregisterService(serName)
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, el, _ := local.GenTree(2, false)
+	server := servers[0]
+
+	client := local.NewClientKeep(serName)
+	defer client.Close()
+	conn, err := client.Stream(server.ServerIdentity,
+		&SimpleRequest{ServerIdentities: el, Val: 3})
+	require.NoError(t, err)
+	require.NoError(t, conn.ReadMessage(&SimpleResponse{}))
+
+	// the stream is still open
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = server.EnterMaintenance(ctx)
+	require.True(t, xerrors.Is(err, context.DeadlineExceeded))
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, conn.ReadMessage(&SimpleResponse{}))
+	}
+	require.NoError(t, server.EnterMaintenance(context.Background()))
+	conn, err = client.Stream(server.ServerIdentity, &SimpleRequest{ServerIdentities: el, Val: 1})
+	if err == nil {
+		err = conn.ReadMessage(&SimpleResponse{})
+	}
+	require.Error(t, err)
+}
@@ -0,0 +1,236 @@
+// Package membership is a service keeping the rosters of groups of conodes
+// up to date. A managed roster starts from the roster given at its creation,
+// and evolves with changes adding, removing, or moving a member, each signed
+// by a threshold of the members of the roster it applies to. The conodes
+// send the history of the roster to each other, so a change needs to be sent
+// to only one of them instead of editing and distributing group files.
+//
+// Other services find the current roster with Service.Roster, and learn
+// about the changes with Service.OnChange.
+package membership
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// Action is what a change does to the roster.
+type Action int
+
+const (
+	// ActionAdd adds the member at the end of the roster.
+	ActionAdd Action = iota + 1
+	// ActionRemove removes the member with the same public key.
+	ActionRemove
+	// ActionUpdate replaces the address, URL and description of the member
+	// with the same public key.
+	ActionUpdate
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionAdd:
+		return "add"
+	case ActionRemove:
+		return "remove"
+	case ActionUpdate:
+		return "update"
+	}
+	return "unknown"
+}
+
+// Threshold returns the number of members of a roster of n conodes that
+// must sign a change: more than two thirds of them.
+func Threshold(n int) int {
+	return n - (n-1)/3
+}
+
+// Signature is the signature of a change by the member at Index in the
+// roster the change applies to.
+type Signature struct {
+	Index     int
+	Signature []byte
+}
+
+// Change is a signed change of a managed roster.
+type Change struct {
+	// ID of the managed roster.
+	ID []byte
+	// Index is the number of changes before this one.
+	Index  int
+	Action Action
+	Member *network.ServerIdentity
+	// Signatures of the members of the roster before the change.
+	Signatures []Signature
+}
+
+// NewChange returns the change to sign of the roster with the given ID and
+// number of changes.
+func NewChange(id []byte, index int, action Action, member *network.ServerIdentity) *Change {
+	return &Change{ID: id, Index: index, Action: action, Member: member}
+}
+
+// Hash returns the message signed by the members.
+func (ch *Change) Hash() ([]byte, error) {
+	h := sha256.New()
+	h.Write([]byte("onet-membership-change"))
+	h.Write(ch.ID)
+	binary.Write(h, binary.BigEndian, int64(ch.Index))
+	binary.Write(h, binary.BigEndian, int64(ch.Action))
+	if ch.Member == nil {
+		return nil, xerrors.New("no member")
+	}
+	if err := writeMember(h, ch.Member); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Sign adds the signature of the member of the roster with the private key.
+func (ch *Change) Sign(suite network.Suite, ro *onet.Roster, private kyber.Scalar) error {
+	public := suite.Point().Mul(private, nil)
+	index, _ := ro.Search(network.NewServerIdentity(public, "").ID)
+	if index < 0 {
+		return xerrors.New("the key is not in the roster")
+	}
+	msg, err := ch.Hash()
+	if err != nil {
+		return err
+	}
+	sig, err := schnorr.Sign(suite, private, msg)
+	if err != nil {
+		return xerrors.Errorf("signing: %v", err)
+	}
+	ch.Signatures = append(ch.Signatures, Signature{Index: index, Signature: sig})
+	return nil
+}
+
+// Apply returns the roster after the change, once it checked that a
+// threshold of the members of ro signed it.
+func (ch *Change) Apply(suite network.Suite, ro *onet.Roster) (*onet.Roster, error) {
+	msg, err := ch.Hash()
+	if err != nil {
+		return nil, err
+	}
+	signed := make(map[int]bool)
+	for _, sig := range ch.Signatures {
+		if sig.Index < 0 || sig.Index >= len(ro.List) || signed[sig.Index] {
+			continue
+		}
+		if err := schnorr.Verify(suite, ro.List[sig.Index].Public, msg,
+			sig.Signature); err != nil {
+			return nil, xerrors.Errorf("invalid signature of %s: %v",
+				ro.List[sig.Index], err)
+		}
+		signed[sig.Index] = true
+	}
+	if len(signed) < Threshold(len(ro.List)) {
+		return nil, xerrors.Errorf("signed by %d members, need %d", len(signed),
+			Threshold(len(ro.List)))
+	}
+
+	index := -1
+	for i, si := range ro.List {
+		if si.Public.Equal(ch.Member.Public) {
+			index = i
+		}
+	}
+	list := make([]*network.ServerIdentity, 0, len(ro.List)+1)
+	switch ch.Action {
+	case ActionAdd:
+		if index >= 0 {
+			return nil, xerrors.Errorf("%s is already a member", ch.Member)
+		}
+		list = append(append(list, ro.List...), ch.Member)
+	case ActionRemove:
+		if index < 0 {
+			return nil, xerrors.Errorf("%s is not a member", ch.Member)
+		}
+		if len(ro.List) == 1 {
+			return nil, xerrors.New("can't remove the last member")
+		}
+		list = append(append(list, ro.List[:index]...), ro.List[index+1:]...)
+	case ActionUpdate:
+		if index < 0 {
+			return nil, xerrors.Errorf("%s is not a member", ch.Member)
+		}
+		list = append(list, ro.List...)
+		si := network.NewServerIdentity(ch.Member.Public, ch.Member.Address)
+		si.URL = ch.Member.URL
+		si.Description = ch.Member.Description
+		si.ServiceIdentities = ro.List[index].ServiceIdentities
+		list[index] = si
+	default:
+		return nil, xerrors.Errorf("unknown action %d", ch.Action)
+	}
+	return onet.NewRoster(list), nil
+}
+
+// Chain is the history of a managed roster: the roster it was created with,
+// and the changes since.
+type Chain struct {
+	Genesis *onet.Roster
+	Changes []*Change
+}
+
+func init() {
+	network.RegisterMessages(&Chain{}, &syncChain{})
+}
+
+// ID returns the identifier of the managed roster, derived from the roster
+// it was created with.
+func (c *Chain) ID() ([]byte, error) {
+	h := sha256.New()
+	h.Write([]byte("onet-membership-genesis"))
+	h.Write(c.Genesis.ID[:])
+	for _, si := range c.Genesis.List {
+		if err := writeMember(h, si); err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// Roster verifies all the changes and returns the current roster.
+func (c *Chain) Roster(suite network.Suite) (*onet.Roster, error) {
+	if c.Genesis == nil || len(c.Genesis.List) == 0 {
+		return nil, xerrors.New("empty roster")
+	}
+	id, err := c.ID()
+	if err != nil {
+		return nil, err
+	}
+	ro := c.Genesis
+	for i, ch := range c.Changes {
+		if !bytes.Equal(ch.ID, id) || ch.Index != i {
+			return nil, xerrors.Errorf("change %d is not part of the chain", i)
+		}
+		ro, err = ch.Apply(suite, ro)
+		if err != nil {
+			return nil, xerrors.Errorf("change %d: %v", i, err)
+		}
+	}
+	return ro, nil
+}
+
+// writeMember writes what identifies the member in the hashes.
+func writeMember(h io.Writer, si *network.ServerIdentity) error {
+	buf, err := si.Public.MarshalBinary()
+	if err != nil {
+		return xerrors.Errorf("marshaling key: %v", err)
+	}
+	for _, b := range [][]byte{buf, []byte(si.Address), []byte(si.URL),
+		[]byte(si.Description)} {
+		binary.Write(h, binary.BigEndian, uint32(len(b)))
+		h.Write(b)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package membership
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+var tSuite = suites.MustFind("Ed25519")
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestThreshold(t *testing.T) {
+	for n, th := range map[int]int{1: 1, 2: 2, 3: 3, 4: 3, 5: 4, 7: 5, 10: 7} {
+		require.Equal(t, th, Threshold(n), "n = %d", n)
+	}
+}
+
+// sign returns the change signed by the given servers.
+func sign(t *testing.T, ch *Change, ro *onet.Roster, servers ...*onet.Server) *Change {
+	for _, s := range servers {
+		require.NoError(t, ch.Sign(tSuite, ro, s.ServerIdentity.GetPrivate()))
+	}
+	return ch
+}
+
+// waitRoster waits until the service has the managed roster with the given
+// number of changes.
+func waitRoster(t *testing.T, s *Service, id []byte, changes int) *onet.Roster {
+	for i := 0; i < 100; i++ {
+		reply, err := s.GetRoster(&GetRoster{ID: id})
+		if err == nil && reply.Changes == changes {
+			return reply.Roster
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Fail(t, "roster not received")
+	return nil
+}
+
+func TestChange_Apply(t *testing.T) {
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, ro, _ := local.GenTree(4, false)
+	chain := &Chain{Genesis: onet.NewRoster(ro.List[:3])}
+	id, err := chain.ID()
+	require.NoError(t, err)
+
+	ch := NewChange(id, 0, ActionAdd, ro.List[3])
+	sign(t, ch, chain.Genesis, servers[0], servers[1])
+	_, err = ch.Apply(tSuite, chain.Genesis)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "need 3")
+	// the same signature twice doesn't count
+	ch.Signatures = append(ch.Signatures, ch.Signatures[0])
+	_, err = ch.Apply(tSuite, chain.Genesis)
+	require.Error(t, err)
+
+	require.Error(t, ch.Sign(tSuite, chain.Genesis, servers[3].ServerIdentity.GetPrivate()))
+	sign(t, ch, chain.Genesis, servers[2])
+	next, err := ch.Apply(tSuite, chain.Genesis)
+	require.NoError(t, err)
+	require.Len(t, next.List, 4)
+
+	// a signature of another change is rejected
+	other := NewChange(id, 0, ActionRemove, ro.List[0])
+	other.Signatures = ch.Signatures
+	_, err = other.Apply(tSuite, chain.Genesis)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid signature")
+
+	// changes must be applied in order
+	chain.Changes = []*Change{ch, ch}
+	_, err = chain.Roster(tSuite)
+	require.Error(t, err)
+	chain.Changes = chain.Changes[:1]
+	ro2, err := chain.Roster(tSuite)
+	require.NoError(t, err)
+	require.True(t, ro2.List[3].Equal(ro.List[3]))
+}
+
+func TestService(t *testing.T) {
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, all, _ := local.GenTree(4, false)
+	services := make([]*Service, len(servers))
+	for i, s := range local.GetServices(servers, ServiceID) {
+		services[i] = s.(*Service)
+	}
+	changed := make(chan *onet.Roster, 10)
+	services[3].OnChange(func(id []byte, ro *onet.Roster) {
+		changed <- ro
+	})
+
+	ro := onet.NewRoster(all.List[:3])
+	_, err := services[3].Create(&Create{Roster: ro})
+	require.Error(t, err)
+	reply, err := services[0].Create(&Create{Roster: ro})
+	require.NoError(t, err)
+	id := reply.ID
+	for _, s := range services[:3] {
+		require.Len(t, waitRoster(t, s, id, 0).List, 3)
+	}
+	_, err = services[3].GetRoster(&GetRoster{ID: id})
+	require.Error(t, err)
+
+	// the new member gets the roster from the others
+	ch := sign(t, NewChange(id, 0, ActionAdd, all.List[3]), ro, servers[:3]...)
+	_, err = services[1].Apply(NewChange(id, 0, ActionAdd, all.List[3]))
+	require.Error(t, err)
+	after, err := services[1].Apply(ch)
+	require.NoError(t, err)
+	require.Len(t, after.Roster.List, 4)
+	for _, s := range services {
+		require.Len(t, waitRoster(t, s, id, 1).List, 4)
+	}
+	require.Len(t, (<-changed).List, 4)
+
+	// replaying the change fails
+	_, err = services[2].Apply(ch)
+	require.Error(t, err)
+
+	// a member moves
+	moved := network.NewServerIdentity(all.List[1].Public, network.NewLocalAddress("moved"))
+	ch = sign(t, NewChange(id, 1, ActionUpdate, moved), after.Roster, servers[:3]...)
+	after, err = services[3].Apply(ch)
+	require.NoError(t, err)
+	require.Equal(t, moved.Address, after.Roster.List[1].Address)
+	waitRoster(t, services[0], id, 2)
+
+	// a member is removed and learns about it
+	ch = sign(t, NewChange(id, 2, ActionRemove, all.List[3]), after.Roster,
+		servers[1:]...)
+	_, err = services[0].Apply(ch)
+	require.NoError(t, err)
+	require.Len(t, waitRoster(t, services[3], id, 3).List, 3)
+	require.Len(t, waitRoster(t, services[2], id, 3).List, 3)
+
+	// the roster is kept in the database
+	services[2].Lock()
+	services[2].rosters = make(map[string]*state)
+	services[2].Unlock()
+	current, err := services[2].Roster(id)
+	require.NoError(t, err)
+	require.Len(t, current.List, 3)
+	require.Equal(t, moved.Address, current.List[1].Address)
+}
+
+func TestClient(t *testing.T) {
+	local := onet.NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, ro, _ := local.GenTree(2, false)
+
+	cl := NewClient(tSuite)
+	defer cl.Close()
+	id, err := cl.Create(ro.List[0], ro)
+	require.NoError(t, err)
+	reply, err := cl.GetRoster(ro.List[1], id)
+	for i := 0; err != nil && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		reply, err = cl.GetRoster(ro.List[1], id)
+	}
+	require.NoError(t, err)
+	require.Equal(t, 0, reply.Changes)
+
+	moved := network.NewServerIdentity(ro.List[0].Public, ro.List[0].Address)
+	moved.Description = "moved"
+	ch := sign(t, NewChange(id, 0, ActionUpdate, moved), ro, servers...)
+	reply, err = cl.Apply(ro.List[1], ch)
+	require.NoError(t, err)
+	require.Equal(t, 1, reply.Changes)
+	require.Equal(t, "moved", reply.Roster.List[0].Description)
+}
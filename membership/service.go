@@ -0,0 +1,272 @@
+package membership
+
+import (
+	"sync"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// ServiceName is the name the service is registered under.
+const ServiceName = "Membership"
+
+// ServiceID is the identifier of the service.
+var ServiceID onet.ServiceID
+
+func init() {
+	var err error
+	ServiceID, err = onet.RegisterNewService(ServiceName, newService)
+	log.ErrFatal(err)
+}
+
+// Create asks a member of the roster to start managing it.
+type Create struct {
+	Roster *onet.Roster
+}
+
+// CreateReply holds the identifier of the managed roster.
+type CreateReply struct {
+	ID []byte
+}
+
+// GetRoster asks the current roster with the given identifier.
+type GetRoster struct {
+	ID []byte
+}
+
+// GetRosterReply is the current roster and the number of changes it went
+// through.
+type GetRosterReply struct {
+	Roster  *onet.Roster
+	Changes int
+}
+
+// syncChain is sent by the conodes to the members of a managed roster when
+// it changes.
+type syncChain struct {
+	Chain *Chain
+}
+
+// state is what the service knows about a managed roster.
+type state struct {
+	chain  *Chain
+	roster *onet.Roster
+}
+
+// Service keeps the managed rosters the conode is a member of.
+type Service struct {
+	*onet.ServiceProcessor
+	sync.Mutex
+	rosters   map[string]*state
+	callbacks []func(id []byte, ro *onet.Roster)
+	// makes the updates of the rosters one at a time
+	updating sync.Mutex
+}
+
+func newService(c *onet.Context) (onet.Service, error) {
+	s := &Service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+		rosters:          make(map[string]*state),
+	}
+	if err := s.RegisterHandlers(s.Create, s.Apply, s.GetRoster); err != nil {
+		return nil, xerrors.Errorf("registering handlers: %v", err)
+	}
+	s.RegisterProcessorFunc(network.MessageType(&syncChain{}), s.processSync)
+	return s, nil
+}
+
+// Create starts managing the roster, of which the conode must be a member.
+// The other members are told about it.
+func (s *Service) Create(req *Create) (*CreateReply, error) {
+	if req.Roster == nil || len(req.Roster.List) == 0 {
+		return nil, xerrors.New("empty roster")
+	}
+	chain := &Chain{Genesis: req.Roster}
+	id, err := s.update(chain)
+	if err != nil {
+		return nil, err
+	}
+	return &CreateReply{ID: id}, nil
+}
+
+// Apply adds the change to the managed roster and sends the new history to
+// the members.
+func (s *Service) Apply(ch *Change) (*GetRosterReply, error) {
+	st, err := s.load(ch.ID)
+	if err != nil {
+		return nil, err
+	}
+	if ch.Index != len(st.chain.Changes) {
+		return nil, xerrors.Errorf("the roster had %d changes, not %d",
+			len(st.chain.Changes), ch.Index)
+	}
+	chain := &Chain{Genesis: st.chain.Genesis,
+		Changes: append(append([]*Change{}, st.chain.Changes...), ch)}
+	if _, err := s.update(chain); err != nil {
+		return nil, err
+	}
+	return s.GetRoster(&GetRoster{ID: ch.ID})
+}
+
+// GetRoster returns the current managed roster.
+func (s *Service) GetRoster(req *GetRoster) (*GetRosterReply, error) {
+	st, err := s.load(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &GetRosterReply{Roster: st.roster, Changes: len(st.chain.Changes)}, nil
+}
+
+// Roster returns the current managed roster with the given identifier, for
+// the other services.
+func (s *Service) Roster(id []byte) (*onet.Roster, error) {
+	st, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	return st.roster, nil
+}
+
+// OnChange registers a function called with each new version of the managed
+// rosters, including the ones received from the other conodes.
+func (s *Service) OnChange(fn func(id []byte, ro *onet.Roster)) {
+	s.Lock()
+	defer s.Unlock()
+	s.callbacks = append(s.callbacks, fn)
+}
+
+// load returns the state of the managed roster, from the database if it
+// hasn't been used since the start of the conode.
+func (s *Service) load(id []byte) (*state, error) {
+	s.Lock()
+	st := s.rosters[string(id)]
+	s.Unlock()
+	if st != nil {
+		return st, nil
+	}
+	msg, err := s.Load(id)
+	if err != nil {
+		return nil, xerrors.Errorf("loading roster: %v", err)
+	}
+	chain, ok := msg.(*Chain)
+	if !ok {
+		return nil, xerrors.New("unknown roster")
+	}
+	ro, err := chain.Roster(s.Suite())
+	if err != nil {
+		return nil, xerrors.Errorf("stored roster: %v", err)
+	}
+	st = &state{chain: chain, roster: ro}
+	s.Lock()
+	s.rosters[string(id)] = st
+	s.Unlock()
+	return st, nil
+}
+
+// update verifies the chain, stores it if it is newer than the one known,
+// and sends it to the members of the roster.
+func (s *Service) update(chain *Chain) ([]byte, error) {
+	ro, err := chain.Roster(s.Suite())
+	if err != nil {
+		return nil, err
+	}
+	id, err := chain.ID()
+	if err != nil {
+		return nil, err
+	}
+	n := len(chain.Changes)
+	removed := n > 0 && chain.Changes[n-1].Action == ActionRemove &&
+		chain.Changes[n-1].Member.Equal(s.ServerIdentity())
+	if i, _ := ro.Search(s.ServerIdentity().ID); i < 0 && !removed {
+		return nil, xerrors.New("this conode is not a member of the roster")
+	}
+
+	s.updating.Lock()
+	defer s.updating.Unlock()
+	if st, err := s.load(id); err == nil && len(st.chain.Changes) >= len(chain.Changes) {
+		return id, nil
+	}
+
+	s.Lock()
+	if err := s.Save(id, chain); err != nil {
+		s.Unlock()
+		return nil, xerrors.Errorf("saving roster: %v", err)
+	}
+	s.rosters[string(id)] = &state{chain: chain, roster: ro}
+	callbacks := append([]func([]byte, *onet.Roster){}, s.callbacks...)
+	s.Unlock()
+	log.Lvlf2("%s: roster %x has %d members after %d changes", s.ServerIdentity(),
+		id[:8], len(ro.List), len(chain.Changes))
+	for _, fn := range callbacks {
+		fn(id, ro)
+	}
+
+	// the removed member learns about its removal too
+	members := ro.List
+	if n > 0 && chain.Changes[n-1].Action == ActionRemove {
+		members = append(append([]*network.ServerIdentity{}, members...),
+			chain.Changes[n-1].Member)
+	}
+	for _, si := range members {
+		if si.Equal(s.ServerIdentity()) {
+			continue
+		}
+		if err := s.SendRaw(si, &syncChain{Chain: chain}); err != nil {
+			log.Warn("Couldn't send the roster to", si, ":", err)
+		}
+	}
+	return id, nil
+}
+
+// processSync stores the history of a roster sent by another member.
+func (s *Service) processSync(env *network.Envelope) error {
+	msg, ok := env.Msg.(*syncChain)
+	if !ok || msg.Chain == nil {
+		return xerrors.New("invalid roster")
+	}
+	if _, err := s.update(msg.Chain); err != nil {
+		return xerrors.Errorf("roster from %s: %v", env.ServerIdentity, err)
+	}
+	return nil
+}
+
+// Client is the client of the service.
+type Client struct {
+	*onet.Client
+}
+
+// NewClient returns a client of the service.
+func NewClient(suite network.Suite) *Client {
+	return &Client{Client: onet.NewClient(suite, ServiceName)}
+}
+
+// Create asks the member of the roster to start managing it, and returns its
+// identifier.
+func (c *Client) Create(si *network.ServerIdentity, ro *onet.Roster) ([]byte, error) {
+	reply := &CreateReply{}
+	if err := c.SendProtobuf(si, &Create{Roster: ro}, reply); err != nil {
+		return nil, xerrors.Errorf("sending: %v", err)
+	}
+	return reply.ID, nil
+}
+
+// Apply sends the signed change to a member of the roster, which returns
+// the new roster.
+func (c *Client) Apply(si *network.ServerIdentity, ch *Change) (*GetRosterReply, error) {
+	reply := &GetRosterReply{}
+	if err := c.SendProtobuf(si, ch, reply); err != nil {
+		return nil, xerrors.Errorf("sending: %v", err)
+	}
+	return reply, nil
+}
+
+// GetRoster returns the current roster and its number of changes.
+func (c *Client) GetRoster(si *network.ServerIdentity, id []byte) (*GetRosterReply, error) {
+	reply := &GetRosterReply{}
+	if err := c.SendProtobuf(si, &GetRoster{ID: id}, reply); err != nil {
+		return nil, xerrors.Errorf("sending: %v", err)
+	}
+	return reply, nil
+}
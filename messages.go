@@ -49,6 +49,15 @@ type ProtocolMsg struct {
 	Size network.Size
 	// Config is the config passed to the protocol constructor.
 	Config *GenericConfig
+	// TraceParent is the W3C trace context of the span that sent the
+	// message, if tracing is enabled.
+	TraceParent string
+}
+
+// WrappedType implements network.WrappingMessage, so that the traffic of the
+// protocols is counted by the types of their messages.
+func (pm *ProtocolMsg) WrappedType() network.MessageTypeID {
+	return pm.MsgType
 }
 
 // ConfigMsg is sent by the overlay containing a generic slice of bytes to
@@ -158,6 +167,9 @@ type OverlayMsg struct {
 	TreeMarshal *TreeMarshal
 
 	Config *GenericConfig
+	// TraceParent is the W3C trace context of the span that sent the
+	// message, if tracing is enabled.
+	TraceParent string
 }
 
 // RequestRoster is used to ask the parent for a given Roster
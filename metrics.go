@@ -0,0 +1,324 @@
+package onet
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// MetricType is the type of a metric, as understood by Prometheus.
+type MetricType string
+
+const (
+	// MetricCounter is a value that only goes up.
+	MetricCounter MetricType = "counter"
+	// MetricGauge is a value that can go up and down.
+	MetricGauge MetricType = "gauge"
+	// MetricHistogram is a distribution of values counted in buckets, with
+	// the sum of the values as Value.
+	MetricHistogram MetricType = "histogram"
+)
+
+// Metric is one sample served on the /metrics endpoint. Samples with the same
+// name must have the same help and type, and differ by their labels.
+type Metric struct {
+	Name   string
+	Help   string
+	Type   MetricType
+	Labels map[string]string
+	Value  float64
+	// Buckets of a histogram, by increasing upper bound.
+	Buckets []MetricBucket
+	// Count is the number of values of a histogram.
+	Count uint64
+}
+
+// MetricBucket is a bucket of a histogram.
+type MetricBucket struct {
+	UpperBound float64
+	// Count is the number of values up to UpperBound, including the ones of
+	// the previous buckets.
+	Count uint64
+}
+
+// MetricsCollector returns the current value of a set of metrics. It is
+// called for every scrape of the /metrics endpoint.
+type MetricsCollector interface {
+	CollectMetrics() []Metric
+}
+
+// MetricsCollectorFunc is a function implementing MetricsCollector.
+type MetricsCollectorFunc func() []Metric
+
+// CollectMetrics implements MetricsCollector.
+func (f MetricsCollectorFunc) CollectMetrics() []Metric {
+	return f()
+}
+
+// metricsRegistry holds the collectors of a server.
+type metricsRegistry struct {
+	sync.Mutex
+	collectors map[string]MetricsCollector
+	token      string
+}
+
+func newMetricsRegistry(token string) *metricsRegistry {
+	return &metricsRegistry{
+		collectors: make(map[string]MetricsCollector),
+		token:      token,
+	}
+}
+
+// RegisterMetricsCollector adds a collector to the /metrics endpoint. A
+// collector registered under an existing name replaces the previous one.
+func (c *Server) RegisterMetricsCollector(name string, mc MetricsCollector) {
+	c.metrics.Lock()
+	defer c.metrics.Unlock()
+	c.metrics.collectors[name] = mc
+}
+
+// registerMetricsEndpoint adds the core metrics and serves all metrics on the
+// WebSocket.
+func (c *Server) registerMetricsEndpoint() {
+	c.RegisterMetricsCollector("onet", MetricsCollectorFunc(c.coreMetrics))
+	c.WebSocket.mux.HandleFunc("/metrics", c.metrics.ServeHTTP)
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format. If a token is
+// configured, the request must carry it as a bearer token.
+func (m *metricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.token != "" {
+		auth := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+m.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	m.Lock()
+	var collectors []MetricsCollector
+	for _, mc := range m.collectors {
+		collectors = append(collectors, mc)
+	}
+	m.Unlock()
+	var metrics []Metric
+	for _, mc := range collectors {
+		metrics = append(metrics, mc.CollectMetrics()...)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(formatMetrics(metrics)))
+}
+
+// formatMetrics returns the metrics in the Prometheus text format, sorted by
+// name.
+func formatMetrics(metrics []Metric) string {
+	sort.SliceStable(metrics, func(i, j int) bool {
+		return metrics[i].Name < metrics[j].Name
+	})
+	var sb strings.Builder
+	last := ""
+	for _, mt := range metrics {
+		if mt.Name != last {
+			if mt.Help != "" {
+				fmt.Fprintf(&sb, "# HELP %s %s\n", mt.Name,
+					helpEscaper.Replace(mt.Help))
+			}
+			if mt.Type != "" {
+				fmt.Fprintf(&sb, "# TYPE %s %s\n", mt.Name, mt.Type)
+			}
+			last = mt.Name
+		}
+		if mt.Type != MetricHistogram {
+			writeSample(&sb, mt.Name, mt.Labels, "", mt.Value)
+			continue
+		}
+		for _, b := range mt.Buckets {
+			writeSample(&sb, mt.Name+"_bucket", mt.Labels,
+				formatFloat(b.UpperBound), float64(b.Count))
+		}
+		writeSample(&sb, mt.Name+"_bucket", mt.Labels, "+Inf", float64(mt.Count))
+		writeSample(&sb, mt.Name+"_sum", mt.Labels, "", mt.Value)
+		writeSample(&sb, mt.Name+"_count", mt.Labels, "", float64(mt.Count))
+	}
+	return sb.String()
+}
+
+// writeSample writes one line of a metric, with the label "le" of the
+// buckets of the histograms if it isn't empty.
+func writeSample(sb *strings.Builder, name string, labels map[string]string,
+	le string, value float64) {
+	sb.WriteString(name)
+	var keys []string
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", k,
+			labelEscaper.Replace(labels[k])))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=\"%s\"", le))
+	}
+	if len(pairs) > 0 {
+		sb.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	sb.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// trafficMetrics returns the counter of the messages of a type, named
+// prefix_messages_total, and the histogram of their sizes, named
+// prefix_message_size_bytes.
+func trafficMetrics(prefix, help string, tt network.TypeTraffic,
+	labels map[string]string) []Metric {
+	hist := Metric{Name: prefix + "_message_size_bytes",
+		Help: "Sizes of the messages " + help + ".", Type: MetricHistogram,
+		Labels: labels, Value: float64(tt.Bytes), Count: tt.Count}
+	var count uint64
+	for i, bound := range network.MessageSizeBounds {
+		count += tt.Sizes[i]
+		hist.Buckets = append(hist.Buckets,
+			MetricBucket{UpperBound: float64(bound), Count: count})
+	}
+	return []Metric{
+		{Name: prefix + "_messages_total", Help: "Messages " + help + ".",
+			Type: MetricCounter, Labels: labels, Value: float64(tt.Count)},
+		hist,
+	}
+}
+
+// latencyMetric returns the histogram of the latencies, in seconds.
+func latencyMetric(name, help string, l network.Latency,
+	labels map[string]string) Metric {
+	hist := Metric{Name: name, Help: help, Type: MetricHistogram,
+		Labels: labels, Value: l.Sum.Seconds(), Count: l.Count}
+	var count uint64
+	for i, bound := range network.LatencyBounds {
+		count += l.Durations[i]
+		hist.Buckets = append(hist.Buckets,
+			MetricBucket{UpperBound: bound.Seconds(), Count: count})
+	}
+	return hist
+}
+
+// coreMetrics returns the metrics every conode exports.
+func (c *Server) coreMetrics() []Metric {
+	metrics := []Metric{
+		{Name: "onet_uptime_seconds", Help: "Time since the server started.",
+			Type: MetricGauge, Value: time.Since(c.started).Seconds()},
+		{Name: "onet_connections", Help: "Open connections to other conodes.",
+			Type: MetricGauge, Value: float64(c.Router.Connections())},
+		{Name: "onet_messages_total", Help: "Messages exchanged with other conodes.",
+			Type: MetricCounter, Labels: map[string]string{"direction": "tx"},
+			Value: float64(c.Router.MsgTx())},
+		{Name: "onet_messages_total", Help: "Messages exchanged with other conodes.",
+			Type: MetricCounter, Labels: map[string]string{"direction": "rx"},
+			Value: float64(c.Router.MsgRx())},
+		{Name: "onet_message_bytes_total", Help: "Bytes exchanged with other conodes.",
+			Type: MetricCounter, Labels: map[string]string{"direction": "tx"},
+			Value: float64(c.Router.Tx())},
+		{Name: "onet_message_bytes_total", Help: "Bytes exchanged with other conodes.",
+			Type: MetricCounter, Labels: map[string]string{"direction": "rx"},
+			Value: float64(c.Router.Rx())},
+		{Name: "onet_protocol_instances", Help: "Running protocol instances.",
+			Type: MetricGauge, Value: float64(c.overlay.instancesCount())},
+		{Name: "onet_websocket_sessions", Help: "Open websocket sessions.",
+			Type: MetricGauge, Value: float64(atomic.LoadInt64(&c.WebSocket.sessions))},
+	}
+
+	for _, dir := range []struct {
+		name        string
+		conodes, ws []network.TypeTraffic
+	}{
+		{"tx", c.Router.MsgTypesTx(), c.WebSocket.typesTx.Traffic()},
+		{"rx", c.Router.MsgTypesRx(), c.WebSocket.typesRx.Traffic()},
+	} {
+		for _, tt := range dir.conodes {
+			metrics = append(metrics, trafficMetrics("onet_type",
+				"exchanged with other conodes, by type", tt,
+				map[string]string{"type": tt.Name, "direction": dir.name})...)
+		}
+		for _, tt := range dir.ws {
+			// the traffic of the clients is counted as "service/message"
+			parts := strings.SplitN(tt.Name, "/", 2)
+			metrics = append(metrics, trafficMetrics("onet_websocket",
+				"exchanged with the clients, by service and message", tt,
+				map[string]string{"service": parts[0], "message": parts[1],
+					"direction": dir.name})...)
+		}
+	}
+
+	for _, pl := range c.Router.PeerLatencies() {
+		labels := map[string]string{"peer": pl.ServerIdentity.Address.String()}
+		if pl.RTT.Count > 0 {
+			metrics = append(metrics, latencyMetric("onet_peer_rtt_seconds",
+				"Round-trip times of the keep-alive pings to other conodes.",
+				pl.RTT, labels))
+		}
+		if pl.Handshake.Count > 0 {
+			metrics = append(metrics, latencyMetric("onet_peer_handshake_seconds",
+				"Durations of the TLS handshakes with other conodes.",
+				pl.Handshake, labels))
+		}
+	}
+
+	for where, n := range c.crashes.counts() {
+		metrics = append(metrics, Metric{Name: "onet_panics_total",
+			Help: "Panics recovered in the protocols and the services.",
+			Type: MetricCounter, Labels: map[string]string{"where": where},
+			Value: float64(n)})
+	}
+
+	if size, err := c.serviceManager.store.Size(); err == nil {
+		metrics = append(metrics, Metric{Name: "onet_db_size_bytes",
+			Help: "Size of the database.", Type: MetricGauge,
+			Value: float64(size)})
+	}
+
+	c.serviceManager.servicesMutex.Lock()
+	contexts := make(map[ServiceID]*Context)
+	for id, ctx := range c.serviceManager.contexts {
+		contexts[id] = ctx
+	}
+	c.serviceManager.servicesMutex.Unlock()
+	for id, ctx := range contexts {
+		st, err := ctx.storageStats()
+		if err != nil {
+			log.Warn("Couldn't get the storage of", ServiceFactory.Name(id), err)
+		}
+		labels := map[string]string{"service": ServiceFactory.Name(id)}
+		metrics = append(metrics,
+			Metric{Name: "onet_service_storage_bytes",
+				Help: "Bytes stored by a service.", Type: MetricGauge,
+				Labels: labels, Value: float64(st.used)},
+			Metric{Name: "onet_service_storage_disk_bytes",
+				Help: "Bytes of the database pages holding the data of a service.",
+				Type: MetricGauge, Labels: labels, Value: float64(st.disk)},
+			Metric{Name: "onet_service_storage_keys",
+				Help: "Keys stored by a service.", Type: MetricGauge,
+				Labels: labels, Value: float64(st.keys)},
+			Metric{Name: "onet_service_storage_writes_total",
+				Help: "Writes of a service in the database.", Type: MetricCounter,
+				Labels: labels, Value: float64(st.writes)})
+	}
+	return metrics
+}
@@ -0,0 +1,97 @@
+package onet
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatMetrics(t *testing.T) {
+	out := formatMetrics([]Metric{
+		{Name: "b", Type: MetricGauge, Value: 1.5},
+		{Name: "a", Help: "line\nbreak", Type: MetricCounter,
+			Labels: map[string]string{"y": `q"uote`, "x": "1"}, Value: 2},
+		{Name: "a", Help: "line\nbreak", Type: MetricCounter, Value: 3},
+		{Name: "c", Type: MetricHistogram, Labels: map[string]string{"x": "1"},
+			Value: 42.5, Count: 3, Buckets: []MetricBucket{
+				{UpperBound: 1, Count: 1}, {UpperBound: 10, Count: 2}}},
+	})
+	require.Equal(t, `# HELP a line\nbreak
+# TYPE a counter
+a{x="1",y="q\"uote"} 2
+a 3
+# TYPE b gauge
+b 1.5
+# TYPE c histogram
+c_bucket{x="1",le="1"} 1
+c_bucket{x="1",le="10"} 2
+c_bucket{x="1",le="+Inf"} 3
+c_sum{x="1"} 42.5
+c_count{x="1"} 3
+`, out)
+}
+
+func TestServer_Metrics(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, _, _ := local.GenTree(2, true)
+	s := servers[0]
+	s.SetKeepAlive(10 * time.Millisecond)
+	_, err := s.Send(servers[1].ServerIdentity, servers[1].ServerIdentity)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		peers := s.PeerLatencies()
+		return len(peers) == 1 && peers[0].RTT.Count > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	client := NewClient(tSuite, testServiceName)
+	defer client.Close()
+	require.NoError(t, client.SendProtobuf(s.ServerIdentity, &testMsg{12}, &testMsg{}))
+	s.RegisterMetricsCollector("test", MetricsCollectorFunc(func() []Metric {
+		return []Metric{{Name: "test_value", Type: MetricGauge, Value: 42}}
+	}))
+
+	hp, err := getWSHostPort(s.ServerIdentity, false)
+	require.NoError(t, err)
+	get := func(token string) (int, string) {
+		req, err := http.NewRequest("GET", "http://"+hp+"/metrics", nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := get("")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, "test_value 42\n")
+	require.Contains(t, body, "# TYPE onet_connections gauge\n")
+	require.Contains(t, body, `onet_messages_total{direction="rx"}`)
+	require.Contains(t, body, "onet_db_size_bytes")
+	require.Contains(t, body, `onet_type_messages_total{direction="tx",type="network.ServerIdentity"} 1`)
+	require.Contains(t, body, `onet_type_message_size_bytes_count{direction="tx",type="network.ServerIdentity"} 1`)
+	require.Contains(t, body, "# TYPE onet_websocket_message_size_bytes histogram\n")
+	require.Contains(t, body, `onet_peer_rtt_seconds_bucket{peer="`+
+		servers[1].ServerIdentity.Address.String()+`",le="+Inf"}`)
+	require.NotContains(t, body, "onet_peer_handshake_seconds")
+	for _, dir := range []string{"rx", "tx"} {
+		require.Contains(t, body, `onet_websocket_messages_total{direction="`+dir+
+			`",message="testMsg",service="`+testServiceName+`"} 1`)
+	}
+
+	s.metrics.token = "secret"
+	code, _ = get("")
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, _ = get("wrong")
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, body = get("secret")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, "test_value 42\n")
+}
@@ -0,0 +1,144 @@
+package onet
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// Migration converts the data stored by a service from the previous version
+// to Version. The migrations of a service are registered with
+// RegisterServiceMigrations and run when the conode starts, before the
+// service is created.
+type Migration struct {
+	// Version is the version of the data after the migration. The first
+	// migration has version 1.
+	Version int
+	// Description tells what the migration does, for the logs.
+	Description string
+	// Migrate converts the data. If it returns an error, none of its writes
+	// are kept and the conode doesn't start.
+	Migrate func(tx *MigrationTx) error
+}
+
+// MigrationTx gives a migration access to the buckets of its service, in the
+// transaction recording the new version.
+type MigrationTx struct {
+	tx  StoreTx
+	ctx *Context
+}
+
+// Bucket returns the bucket of the service, holding the data written with
+// Context.Save. Its values are encoded with network.Marshal.
+func (m *MigrationTx) Bucket() StoreBucket {
+	return m.tx.Bucket(m.ctx.bucketName)
+}
+
+// AdditionalBucket returns the additional bucket of the service with the
+// given name, see Context.GetAdditionalBucket, creating it if needed.
+func (m *MigrationTx) AdditionalBucket(name []byte) (StoreBucket, error) {
+	b, err := m.tx.CreateBucketIfNotExists(m.ctx.additionalBucketName(name))
+	if err != nil {
+		return nil, xerrors.Errorf("creating bucket: %v", err)
+	}
+	return b, nil
+}
+
+// DeleteAdditionalBucket removes the additional bucket of the service with
+// the given name, if it exists.
+func (m *MigrationTx) DeleteAdditionalBucket(name []byte) error {
+	fullName := m.ctx.additionalBucketName(name)
+	if m.tx.Bucket(fullName) == nil {
+		return nil
+	}
+	if err := m.tx.DeleteBucket(fullName); err != nil {
+		return xerrors.Errorf("deleting bucket: %v", err)
+	}
+	return nil
+}
+
+// SetMigrations sets the migrations of the data of the service with the
+// given name. Their versions must follow each other, starting at 1.
+func (s *serviceFactory) SetMigrations(name string, migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return xerrors.Errorf("migration %d has version %d instead of %d",
+				i, m.Version, i+1)
+		}
+		if m.Migrate == nil {
+			return xerrors.Errorf("migration %d has no function", m.Version)
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := range s.constructors {
+		if s.constructors[i].name == name {
+			s.constructors[i].migrations = migrations
+			return nil
+		}
+	}
+	return xerrors.New("Didn't find service " + name)
+}
+
+// migrations returns the migrations of the service with the given name.
+func (s *serviceFactory) migrations(name string) []Migration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, c := range s.constructors {
+		if c.name == name {
+			return c.migrations
+		}
+	}
+	return nil
+}
+
+// RegisterServiceMigrations sets the migrations of the data of an already
+// registered service. When a conode starts, the migrations with a version
+// above the one of the stored data are run in order, each one in its own
+// transaction, which also records its version. The version is the one of
+// Context.LoadVersion, so that services which used to convert their data
+// themselves only run the migrations coming after.
+func RegisterServiceMigrations(name string, migrations ...Migration) error {
+	err := ServiceFactory.SetMigrations(name, migrations)
+	if err != nil {
+		return xerrors.Errorf("register migrations: %v", err)
+	}
+	return nil
+}
+
+// migrate runs the migrations of the service newer than the stored version,
+// and returns how many ran.
+func (c *Context) migrate() (int, error) {
+	migrations := ServiceFactory.migrations(string(c.bucketName))
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	version, err := c.LoadVersion()
+	if err != nil {
+		return 0, xerrors.Errorf("loading version: %v", err)
+	}
+	if version > len(migrations) {
+		return 0, xerrors.Errorf("data has version %d, but the service knows up to %d",
+			version, len(migrations))
+	}
+	for _, m := range migrations[version:] {
+		buf := bytes.NewBuffer(nil)
+		if err := binary.Write(buf, binary.LittleEndian, int32(m.Version)); err != nil {
+			return 0, xerrors.Errorf("int to bytes: %v", err)
+		}
+		err := c.manager.store.Update(func(tx StoreTx) error {
+			if err := m.Migrate(&MigrationTx{tx: tx, ctx: c}); err != nil {
+				return err
+			}
+			return tx.Bucket(c.bucketVersionName).Put(dbVersion, buf.Bytes())
+		})
+		if err != nil {
+			return 0, xerrors.Errorf("migration %d: %v", m.Version, err)
+		}
+		log.Lvlf1("Migrated the data of %s to version %d: %s", c.bucketName,
+			m.Version, m.Description)
+	}
+	return len(migrations) - version, nil
+}
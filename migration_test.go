@@ -0,0 +1,130 @@
+package onet
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+const migrationServiceName = "migrationService"
+
+func TestRegisterServiceMigrations(t *testing.T) {
+	_, err := RegisterNewService(migrationServiceName, func(c *Context) (Service, error) {
+		return NewServiceProcessor(c), nil
+	})
+	require.NoError(t, err)
+	defer UnregisterService(migrationServiceName)
+
+	nop := func(*MigrationTx) error { return nil }
+	require.Error(t, RegisterServiceMigrations(migrationServiceName,
+		Migration{Version: 2, Migrate: nop}))
+	require.Error(t, RegisterServiceMigrations(migrationServiceName,
+		Migration{Version: 1}))
+	require.Error(t, RegisterServiceMigrations("unknown", Migration{Version: 1, Migrate: nop}))
+	require.NoError(t, RegisterServiceMigrations(migrationServiceName,
+		Migration{Version: 1, Migrate: nop}))
+}
+
+func TestContext_Migrate(t *testing.T) {
+	_, err := RegisterNewService(migrationServiceName, func(c *Context) (Service, error) {
+		return NewServiceProcessor(c), nil
+	})
+	require.NoError(t, err)
+	defer UnregisterService(migrationServiceName)
+
+	dir, err := ioutil.TempDir("", "migration")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	old := os.Getenv("CONODE_SERVICE_PATH")
+	defer os.Setenv("CONODE_SERVICE_PATH", old)
+	require.NoError(t, os.Setenv("CONODE_SERVICE_PATH", dir))
+	priv, id := NewPrivIdentity(tSuite, 0)
+
+	// data written before the migrations existed
+	c := newStorageServer(t, priv, id, ServerOptions{})
+	ctx := serviceContext(c, migrationServiceName)
+	require.NoError(t, ctx.Save([]byte("k"), &SimpleResponse{Val: 1}))
+	require.NoError(t, ctx.UpdateAdditionalBucket([]byte("old"), func(b *QuotaBucket) error {
+		return b.Put([]byte("k"), []byte("v"))
+	}))
+	require.NoError(t, c.Close())
+
+	migrations := []Migration{{
+		Version:     1,
+		Description: "double the values",
+		Migrate: func(tx *MigrationTx) error {
+			b := tx.Bucket()
+			_, msg, err := network.Unmarshal(b.Get([]byte("k")), tSuite)
+			if err != nil {
+				return err
+			}
+			msg.(*SimpleResponse).Val *= 2
+			buf, err := network.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte("k"), buf)
+		},
+	}, {
+		Version:     2,
+		Description: "rename the additional bucket",
+		Migrate: func(tx *MigrationTx) error {
+			nb, err := tx.AdditionalBucket([]byte("new"))
+			if err != nil {
+				return err
+			}
+			ob, err := tx.AdditionalBucket([]byte("old"))
+			if err != nil {
+				return err
+			}
+			if err := ob.ForEach(nb.Put); err != nil {
+				return err
+			}
+			return tx.DeleteAdditionalBucket([]byte("old"))
+		},
+	}}
+	require.NoError(t, RegisterServiceMigrations(migrationServiceName, migrations...))
+	c = newStorageServer(t, priv, id, ServerOptions{})
+	ctx = serviceContext(c, migrationServiceName)
+	version, err := ctx.LoadVersion()
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+	msg, err := ctx.Load([]byte("k"))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), msg.(*SimpleResponse).Val)
+	require.NoError(t, ctx.ViewAdditionalBucket([]byte("new"), func(b StoreBucket) error {
+		require.Equal(t, []byte("v"), b.Get([]byte("k")))
+		return nil
+	}))
+	used, _ := ctx.StorageUsage()
+	require.NotZero(t, used)
+
+	// the migrations already applied don't run again, and a failing one
+	// leaves nothing behind
+	migrations = append(migrations, Migration{
+		Version: 3,
+		Migrate: func(tx *MigrationTx) error {
+			require.NoError(t, tx.Bucket().Delete([]byte("k")))
+			return xerrors.New("failed")
+		},
+	})
+	require.NoError(t, RegisterServiceMigrations(migrationServiceName, migrations...))
+	_, err = ctx.migrate()
+	require.Error(t, err)
+	version, err = ctx.LoadVersion()
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+	msg, err = ctx.Load([]byte("k"))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), msg.(*SimpleResponse).Val)
+
+	// data newer than the service
+	require.NoError(t, RegisterServiceMigrations(migrationServiceName, migrations[0]))
+	_, err = ctx.migrate()
+	require.Error(t, err)
+	require.NoError(t, c.Close())
+}
@@ -0,0 +1,122 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// CapturedMessage is a message received by a router, as recorded by a
+// Capture.
+type CapturedMessage struct {
+	// Time is when the message was dispatched, in nanoseconds since the
+	// epoch.
+	Time int64
+	From *ServerIdentity
+	To   *ServerIdentity
+	// Msg is the message, as returned by Marshal.
+	Msg []byte
+}
+
+// CapturedMessageType is the type of the records of a capture.
+var CapturedMessageType = RegisterMessage(CapturedMessage{})
+
+// Message returns the type and the captured message.
+func (cm *CapturedMessage) Message(suite Suite) (MessageTypeID, Message, error) {
+	return Unmarshal(cm.Msg, suite)
+}
+
+// Capture records the messages received by routers, with the servers that
+// sent and received them and the time they were dispatched, so that they can
+// be replayed. The records are written one after the other, every one of
+// them preceded by its length.
+type Capture struct {
+	w       io.Writer
+	err     error
+	stopped bool
+	sync.Mutex
+}
+
+// NewCapture returns a capture writing its records to w.
+func NewCapture(w io.Writer) *Capture {
+	return &Capture{w: w}
+}
+
+// record writes the message received by to.
+func (c *Capture) record(from, to *ServerIdentity, msg Message) {
+	now := time.Now()
+	buf, err := Marshal(msg)
+	if err == nil {
+		buf, err = Marshal(&CapturedMessage{Time: now.UnixNano(), From: from,
+			To: to, Msg: buf})
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.stopped || c.err != nil {
+		return
+	}
+	if err != nil {
+		c.err = xerrors.Errorf("marshaling: %v", err)
+		return
+	}
+	if err := binary.Write(c.w, globalOrder, Size(len(buf))); err != nil {
+		c.err = xerrors.Errorf("writing: %v", err)
+		return
+	}
+	if _, err := c.w.Write(buf); err != nil {
+		c.err = xerrors.Errorf("writing: %v", err)
+	}
+}
+
+// Stop stops the recording and returns the first error that happened while
+// recording, after which the messages weren't recorded anymore.
+func (c *Capture) Stop() error {
+	c.Lock()
+	defer c.Unlock()
+	c.stopped = true
+	return c.err
+}
+
+// SetCapture records the messages dispatched by the router in the capture,
+// including the ones it sends to itself. It applies to the connections
+// opened after the call, and nil stops the recording of the next ones.
+func (r *Router) SetCapture(c *Capture) {
+	r.Lock()
+	defer r.Unlock()
+	r.capture = c
+}
+
+// ReadCapture returns the messages recorded by a capture. If the last
+// record is truncated, for example because the process recording it was
+// killed, the records before it are returned with an error.
+func ReadCapture(r io.Reader, suite Suite) ([]*CapturedMessage, error) {
+	br := bufio.NewReader(r)
+	var msgs []*CapturedMessage
+	for {
+		var size Size
+		err := binary.Read(br, globalOrder, &size)
+		if err == io.EOF {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, xerrors.Errorf("reading size: %v", err)
+		}
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return msgs, xerrors.Errorf("reading record: %v", err)
+		}
+		_, msg, err := Unmarshal(buf, suite)
+		if err != nil {
+			return msgs, xerrors.Errorf("unmarshaling record: %v", err)
+		}
+		cm, ok := msg.(*CapturedMessage)
+		if !ok {
+			return msgs, xerrors.Errorf("unexpected record %T", msg)
+		}
+		msgs = append(msgs, cm)
+	}
+}
@@ -0,0 +1,61 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterCapture(t *testing.T) {
+	h1, err1 := NewTestRouterTCP(0)
+	h2, err2 := NewTestRouterTCP(0)
+	require.NoError(t, err1)
+	require.NoError(t, err2)
+	var buf bytes.Buffer
+	capture := NewCapture(&buf)
+	h2.SetCapture(capture)
+	go h1.Start()
+	go h2.Start()
+	defer func() {
+		h1.Stop()
+		h2.Stop()
+	}()
+
+	proc := &simpleMessageProc{t, make(chan SimpleMessage)}
+	h2.RegisterProcessor(proc, SimpleMessageType)
+	_, err := h1.Send(h2.ServerIdentity, &SimpleMessage{1})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), (<-proc.relay).I)
+	// the messages sent to itself are dispatched while sending
+	sent := make(chan error)
+	go func() {
+		_, err := h2.Send(h2.ServerIdentity, &SimpleMessage{2})
+		sent <- err
+	}()
+	require.Equal(t, int64(2), (<-proc.relay).I)
+	require.NoError(t, <-sent)
+	require.NoError(t, capture.Stop())
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), (<-proc.relay).I)
+
+	msgs, err := ReadCapture(bytes.NewReader(buf.Bytes()), tSuite)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.True(t, msgs[0].From.Equal(h1.ServerIdentity))
+	require.True(t, msgs[0].To.Equal(h2.ServerIdentity))
+	require.True(t, msgs[1].From.Equal(h2.ServerIdentity))
+	require.True(t, msgs[0].Time <= msgs[1].Time)
+	for i, cm := range msgs {
+		msgType, msg, err := cm.Message(tSuite)
+		require.NoError(t, err)
+		require.Equal(t, SimpleMessageType, msgType)
+		require.Equal(t, int64(i+1), msg.(*SimpleMessage).I)
+	}
+
+	// a truncated record is reported, after the complete ones
+	msgs, err = ReadCapture(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), tSuite)
+	require.Error(t, err)
+	require.Equal(t, 1, len(msgs))
+}
@@ -0,0 +1,130 @@
+package network
+
+import (
+	"fmt"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrHandshakeFailed is when the peer couldn't be authenticated while the
+// connection was set up: the TLS handshake failed, the certificate of the
+// peer isn't valid, or the ServerIdentity it sent doesn't match it.
+var ErrHandshakeFailed = xerrors.New("Handshake Failed")
+
+// ErrPeerUnreachable is when no connection could be opened to the peer.
+var ErrPeerUnreachable = xerrors.New("Peer Unreachable")
+
+// ErrSuiteRejected is when the peer uses a suite that isn't allowed.
+var ErrSuiteRejected = xerrors.New("Suite Rejected")
+
+// ErrorCode tells what went wrong in an Error.
+type ErrorCode int
+
+// The codes of the errors of the package, each matching one of the sentinel
+// errors with xerrors.Is.
+const (
+	CodeUnknown ErrorCode = iota
+	CodeClosed
+	CodeEOF
+	CodeCanceled
+	CodeTimeout
+	CodeHandshakeFailed
+	CodePeerUnreachable
+	CodeSuiteRejected
+)
+
+// sentinel returns the error matched by the errors of the code.
+func (c ErrorCode) sentinel() error {
+	switch c {
+	case CodeClosed:
+		return ErrClosed
+	case CodeEOF:
+		return ErrEOF
+	case CodeCanceled:
+		return ErrCanceled
+	case CodeTimeout:
+		return ErrTimeout
+	case CodeHandshakeFailed:
+		return ErrHandshakeFailed
+	case CodePeerUnreachable:
+		return ErrPeerUnreachable
+	case CodeSuiteRejected:
+		return ErrSuiteRejected
+	default:
+		return ErrUnknown
+	}
+}
+
+func (c ErrorCode) String() string {
+	return c.sentinel().Error()
+}
+
+// Error is an error of the package with its code, the operation that failed
+// and the place it was created, which is printed with "%+v". It matches the
+// sentinel error of its code, and the error causing it, with xerrors.Is, and
+// can be retrieved with xerrors.As:
+//
+//	var netErr *network.Error
+//	if xerrors.As(err, &netErr) && netErr.Code == network.CodePeerUnreachable {
+//		...
+//	}
+type Error struct {
+	Code ErrorCode
+	// Op is the operation that failed, like "dial".
+	Op string
+	// Err is the error causing this one, if any.
+	Err   error
+	frame xerrors.Frame
+}
+
+// newError returns the error of the code for the operation, caused by err,
+// with the place it is called from.
+func newError(code ErrorCode, op string, err error) *Error {
+	return &Error{
+		Code:  code,
+		Op:    op,
+		Err:   err,
+		frame: xerrors.Caller(1),
+	}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprint(e)
+}
+
+// Format prints the error, with the places it was created from with "%+v".
+func (e *Error) Format(s fmt.State, v rune) {
+	xerrors.FormatError(e, s, v)
+}
+
+// FormatError implements xerrors.Formatter.
+func (e *Error) FormatError(p xerrors.Printer) error {
+	p.Printf("%s: %v", e.Op, e.Code)
+	e.frame.Format(p)
+	return e.Err
+}
+
+// Unwrap returns the error causing this one.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is tells if the target is the sentinel error of the code.
+func (e *Error) Is(target error) bool {
+	return target == e.Code.sentinel()
+}
+
+// Code returns the code of the first Error in the chain of err, or the code
+// of the first sentinel error it wraps, and CodeUnknown if there is none.
+func Code(err error) ErrorCode {
+	var netErr *Error
+	if xerrors.As(err, &netErr) {
+		return netErr.Code
+	}
+	for c := CodeClosed; c <= CodeSuiteRejected; c++ {
+		if xerrors.Is(err, c.sentinel()) {
+			return c
+		}
+	}
+	return CodeUnknown
+}
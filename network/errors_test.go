@@ -0,0 +1,86 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestError(t *testing.T) {
+	cause := xerrors.New("connection refused")
+	err := xerrors.Errorf("connecting: %w", newError(CodePeerUnreachable, "dial", cause))
+
+	require.Equal(t, "connecting: dial: Peer Unreachable: connection refused", err.Error())
+	require.True(t, xerrors.Is(err, ErrPeerUnreachable))
+	require.True(t, xerrors.Is(err, cause))
+	require.False(t, xerrors.Is(err, ErrHandshakeFailed))
+	require.Equal(t, CodePeerUnreachable, Code(err))
+
+	var netErr *Error
+	require.True(t, xerrors.As(err, &netErr))
+	require.Equal(t, "dial", netErr.Op)
+	require.Equal(t, cause, netErr.Err)
+
+	// the place the error was created is printed with the details
+	require.Contains(t, fmt.Sprintf("%+v", err), "errors_test.go")
+
+	require.Equal(t, CodeClosed, Code(xerrors.Errorf("closing: %w", ErrClosed)))
+	require.Equal(t, CodeUnknown, Code(cause))
+}
+
+func TestNewTCPConn_Unreachable(t *testing.T) {
+	h, err := NewTestTCPHost(0)
+	require.NoError(t, err)
+	defer h.Stop()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := NewAddress(PlainTCP, l.Addr().String())
+	require.NoError(t, l.Close())
+
+	_, err = NewTCPConn(addr, tSuite)
+	require.Error(t, err)
+	require.True(t, xerrors.Is(err, ErrPeerUnreachable))
+
+	_, err = h.Connect(NewServerIdentity(tSuite.Point(), addr))
+	require.True(t, xerrors.Is(err, ErrPeerUnreachable))
+}
+
+func TestNewTLSConn_HandshakeFailed(t *testing.T) {
+	// the peer accepts the connections but doesn't speak TLS
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Write([]byte("not a TLS server\n"))
+			c.Close()
+		}
+	}()
+
+	us, err := NewTestTLSHost(tSuite, 0)
+	require.NoError(t, err)
+	defer us.Stop()
+	them := NewServerIdentity(tSuite.Point(), NewTLSAddress(l.Addr().String()))
+
+	_, err = NewTLSConn(us.sid, them, tSuite)
+	require.Error(t, err)
+	require.True(t, xerrors.Is(err, ErrHandshakeFailed))
+	require.False(t, xerrors.Is(err, ErrPeerUnreachable))
+	require.Equal(t, CodeHandshakeFailed, Code(err))
+}
+
+func TestLocalConn_Unreachable(t *testing.T) {
+	lm := NewLocalManager()
+	defer lm.Stop()
+	_, err := NewLocalConnWithManager(lm, NewLocalAddress("a"),
+		NewLocalAddress("b"), tSuite)
+	require.True(t, xerrors.Is(err, ErrPeerUnreachable))
+}
@@ -0,0 +1,180 @@
+package network
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// EnvListeners lists the listening sockets a process inherits from the
+// previous process of the conode when it is upgraded, as the file
+// descriptors and the addresses they were opened for, like
+// "3=0.0.0.0:7770,4=0.0.0.0:7771".
+const EnvListeners = "CONODE_LISTEN_FDS"
+
+// ErrHandedOver is returned by Accept on the listeners of Listen once they
+// were handed over to a new process with HandOverListeners.
+var ErrHandedOver = xerrors.New("listener handed over to a new process")
+
+// handover keeps the listeners opened by Listen, which can be passed to a new
+// process, and the ones inherited from the previous process.
+var handover = struct {
+	sync.Mutex
+	once sync.Once
+	// open listeners, in the order they were opened
+	open []*handedListener
+	// inherited listeners not taken yet, by address
+	inherited map[string][]net.Listener
+}{}
+
+// handedListener is a listener opened by Listen for an address.
+type handedListener struct {
+	net.Listener
+	addr string
+	// set by HandOverListeners, under the lock of handover
+	handedOver bool
+}
+
+// Accept returns ErrHandedOver once the listener is handed over, instead of
+// the error of the closed listener.
+func (l *handedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		handover.Lock()
+		handedOver := l.handedOver
+		handover.Unlock()
+		if handedOver {
+			return nil, ErrHandedOver
+		}
+	}
+	return c, err
+}
+
+// Close stops tracking the listener and closes it.
+func (l *handedListener) Close() error {
+	handover.Lock()
+	for i, o := range handover.open {
+		if o == l {
+			handover.open = append(handover.open[:i], handover.open[i+1:]...)
+			break
+		}
+	}
+	handover.Unlock()
+	return l.Listener.Close()
+}
+
+// inheritListeners reads the listeners of EnvListeners. The variable is
+// removed, so that the processes started by the conode don't take them.
+func inheritListeners() {
+	handover.inherited = make(map[string][]net.Listener)
+	env := os.Getenv(EnvListeners)
+	if env == "" {
+		return
+	}
+	os.Unsetenv(EnvListeners)
+	for _, fdAddr := range strings.Split(env, ",") {
+		parts := strings.SplitN(fdAddr, "=", 2)
+		if len(parts) != 2 {
+			log.Error("Invalid inherited listener", fdAddr)
+			continue
+		}
+		fd, err := strconv.Atoi(parts[0])
+		if err != nil {
+			log.Error("Invalid inherited listener", fdAddr)
+			continue
+		}
+		f := os.NewFile(uintptr(fd), parts[1])
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			log.Error("Couldn't inherit the listener of", parts[1], ":", err)
+			continue
+		}
+		log.Lvl2("Inherited the listener of", parts[1])
+		handover.inherited[parts[1]] = append(handover.inherited[parts[1]], l)
+	}
+}
+
+// Listen opens a TCP listener on the address, or takes the listener that
+// was opened for the same address by the previous process of the conode, if
+// it was inherited. The listeners opened by Listen can be passed to a new
+// process with ListenerFiles, so that the connections are never refused.
+func Listen(addr string) (net.Listener, error) {
+	handover.Lock()
+	defer handover.Unlock()
+	handover.once.Do(inheritListeners)
+	l := &handedListener{addr: addr}
+	if ls := handover.inherited[addr]; len(ls) > 0 {
+		l.Listener = ls[0]
+		handover.inherited[addr] = ls[1:]
+	} else {
+		var err error
+		l.Listener, err = net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	handover.open = append(handover.open, l)
+	return l, nil
+}
+
+// CloseInheritedListeners closes the inherited listeners that were not
+// taken by Listen, as the addresses changed.
+func CloseInheritedListeners() {
+	handover.Lock()
+	defer handover.Unlock()
+	for addr, ls := range handover.inherited {
+		for _, l := range ls {
+			log.Lvl2("Closing the unused inherited listener of", addr)
+			l.Close()
+		}
+		delete(handover.inherited, addr)
+	}
+}
+
+// HandOverListeners closes the listeners of Listen once their copies were
+// passed to a new process with ListenerFiles, so that the new process accepts
+// all the following connections. The connections already accepted stay
+// open.
+func HandOverListeners() {
+	handover.Lock()
+	defer handover.Unlock()
+	for _, l := range handover.open {
+		log.Lvl2("Handing over the listener of", l.addr)
+		l.handedOver = true
+		l.Listener.Close()
+	}
+	handover.open = nil
+}
+
+// ListenerFiles returns copies of the file descriptors of the open listeners
+// of Listen, to be passed to a new process starting at the file descriptor
+// fd, and the value of EnvListeners telling it their addresses. The files
+// must be closed by the caller.
+func ListenerFiles(fd int) ([]*os.File, string, error) {
+	handover.Lock()
+	defer handover.Unlock()
+	var files []*os.File
+	var env []string
+	for _, l := range handover.open {
+		fl, ok := l.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		f, err := fl.File()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, "", xerrors.Errorf("listener of %s: %v", l.addr, err)
+		}
+		env = append(env, strconv.Itoa(fd+len(files))+"="+l.addr)
+		files = append(files, f)
+	}
+	return files, strings.Join(env, ","), nil
+}
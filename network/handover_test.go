@@ -0,0 +1,123 @@
+package network
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperHandover is the next process of TestListen_Handover: it answers
+// one connection on the inherited listener.
+func TestHelperHandover(t *testing.T) {
+	if os.Getenv(EnvListeners) == "" {
+		return
+	}
+	l, err := Listen("localhost:0")
+	if err != nil {
+		os.Exit(1)
+	}
+	if os.Getenv(EnvListeners) != "" {
+		os.Exit(2)
+	}
+	CloseInheritedListeners()
+	c, err := l.Accept()
+	if err != nil {
+		os.Exit(3)
+	}
+	c.Write([]byte(l.Addr().String()))
+	c.Close()
+	l.Close()
+	os.Exit(0)
+}
+
+func TestListen_Handover(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the sockets can't be inherited on Windows")
+	}
+	l, err := Listen("localhost:0")
+	require.NoError(t, err)
+	files, env, err := ListenerFiles(3)
+	require.NoError(t, err)
+	require.Contains(t, env, "=localhost:0")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperHandover$")
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), EnvListeners+"="+env)
+	require.NoError(t, cmd.Start())
+	for _, f := range files {
+		f.Close()
+	}
+	// the connections are accepted by the next process once this one
+	// stops listening
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	reply, err := ioutil.ReadAll(c)
+	require.NoError(t, err)
+	c.Close()
+	require.Equal(t, addr, string(reply))
+	require.NoError(t, cmd.Wait())
+
+	files, _, err = ListenerFiles(3)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(files))
+}
+
+func TestHandOverListeners(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the sockets can't be inherited on Windows")
+	}
+	ln, err := NewTCPListener(NewAddress(PlainTCP, "127.0.0.1:0"), tSuite)
+	require.NoError(t, err)
+	accepted := make(chan bool, 1)
+	listening := make(chan error)
+	go func() {
+		listening <- ln.Listen(func(c Conn) {
+			accepted <- true
+			c.Close()
+		})
+	}()
+	for !ln.Listening() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the copy kept by the new process
+	files, _, err := ListenerFiles(3)
+	require.NoError(t, err)
+	var next net.Listener
+	for _, f := range files {
+		l, err := net.FileListener(f)
+		require.NoError(t, err)
+		f.Close()
+		if l.Addr().String() == ln.addr.String() {
+			next = l
+		} else {
+			l.Close()
+		}
+	}
+	require.NotNil(t, next)
+	defer next.Close()
+
+	HandOverListeners()
+	c, err := net.Dial("tcp", ln.addr.String())
+	require.NoError(t, err)
+	defer c.Close()
+	c2, err := next.Accept()
+	require.NoError(t, err)
+	c2.Close()
+	select {
+	case <-accepted:
+		t.Fatal("the connection was accepted by the old listener")
+	default:
+	}
+
+	require.NoError(t, ln.Stop())
+	require.NoError(t, <-listening)
+}
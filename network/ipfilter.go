@@ -0,0 +1,182 @@
+package network
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// IPFilterConfig are the networks allowed and denied to connect to a
+// listener, as CIDRs like "10.0.0.0/8" or single IPs.
+type IPFilterConfig struct {
+	// Allow, if not empty, are the only networks accepted.
+	Allow []string `toml:",omitempty"`
+	// Deny are the networks refused, even if they are in Allow.
+	Deny []string `toml:",omitempty"`
+}
+
+// IPFilter closes the connections of the networks refused by its
+// configuration right after they are accepted, before any TLS handshake.
+// Its configuration can be changed while it is used. A nil IPFilter accepts
+// every connection.
+type IPFilter struct {
+	sync.RWMutex
+	cfg   IPFilterConfig
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewIPFilter returns a filter of the connections with the given
+// configuration.
+func NewIPFilter(cfg IPFilterConfig) (*IPFilter, error) {
+	f := &IPFilter{}
+	if err := f.Set(cfg); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Set replaces the networks allowed and denied. The connections already
+// accepted aren't closed.
+func (f *IPFilter) Set(cfg IPFilterConfig) error {
+	allow, err := parseNetworks(cfg.Allow)
+	if err != nil {
+		return xerrors.Errorf("allow: %v", err)
+	}
+	deny, err := parseNetworks(cfg.Deny)
+	if err != nil {
+		return xerrors.Errorf("deny: %v", err)
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.cfg = IPFilterConfig{
+		Allow: append([]string(nil), cfg.Allow...),
+		Deny:  append([]string(nil), cfg.Deny...),
+	}
+	f.allow = allow
+	f.deny = deny
+	return nil
+}
+
+// Config returns the networks allowed and denied.
+func (f *IPFilter) Config() IPFilterConfig {
+	if f == nil {
+		return IPFilterConfig{}
+	}
+	f.RLock()
+	defer f.RUnlock()
+	return IPFilterConfig{
+		Allow: append([]string(nil), f.cfg.Allow...),
+		Deny:  append([]string(nil), f.cfg.Deny...),
+	}
+}
+
+// Allows returns whether a connection from the address, given as
+// "host:port" or as an IP, is accepted. The addresses without an IP, like the
+// ones of unix sockets, are accepted.
+func (f *IPFilter) Allows(addr string) bool {
+	if f == nil {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return true
+	}
+	f.RLock()
+	defer f.RUnlock()
+	for _, n := range f.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, n := range f.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetworks parses the CIDRs, taking a single IP as the network holding
+// only it.
+func parseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range cidrs {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, xerrors.Errorf("invalid IP %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid CIDR %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// filteredListener closes the connections refused by its filter instead of
+// returning them.
+type filteredListener struct {
+	net.Listener
+	filter *IPFilter
+}
+
+// NewFilteredListener returns a listener accepting only the connections
+// allowed by the filter. The refused connections are closed by Accept, so
+// the listener must be wrapped by tls.NewListener after this one for them to
+// be closed before the TLS handshake.
+func NewFilteredListener(ln net.Listener, f *IPFilter) net.Listener {
+	return &filteredListener{Listener: ln, filter: f}
+}
+
+func (l *filteredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.filter.Allows(conn.RemoteAddr().String()) {
+			return conn, nil
+		}
+		log.Lvl3("Refused connection from", conn.RemoteAddr())
+		conn.Close()
+	}
+}
+
+// SetIPFilter closes the incoming connections refused by the filter before
+// reading anything from them, so before the TLS handshake. Nil accepts every
+// connection.
+func (r *Router) SetIPFilter(f *IPFilter) {
+	r.Lock()
+	defer r.Unlock()
+	r.ipFilter = f
+}
+
+// allows returns whether the incoming connection is accepted by the filter
+// of the router.
+func (r *Router) allows(c Conn) bool {
+	r.Lock()
+	f := r.ipFilter
+	r.Unlock()
+	return f.Allows(string(c.Remote()))
+}
@@ -0,0 +1,114 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPFilter_Allows(t *testing.T) {
+	var none *IPFilter
+	require.True(t, none.Allows("10.0.0.1:80"))
+
+	f, err := NewIPFilter(IPFilterConfig{
+		Allow: []string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"},
+		Deny:  []string{"10.1.0.0/16", "10.2.3.4"},
+	})
+	require.NoError(t, err)
+	for addr, allowed := range map[string]bool{
+		"10.0.0.1:80":       true,
+		"10.1.2.3:80":       false,
+		"10.2.3.4":          false,
+		"10.2.3.5":          true,
+		"192.168.1.1:7770":  true,
+		"192.168.1.2:7770":  false,
+		"[2001:db8::1]:443": true,
+		"[2001:db9::1]:443": false,
+		"::ffff:10.0.0.1":   true,
+		"/run/conode.sock":  true,
+	} {
+		require.Equal(t, allowed, f.Allows(addr), addr)
+	}
+
+	// only the denied networks are refused without an allow list
+	require.NoError(t, f.Set(IPFilterConfig{Deny: []string{"10.1.0.0/16"}}))
+	require.True(t, f.Allows("192.168.1.2:7770"))
+	require.False(t, f.Allows("10.1.2.3:80"))
+	require.Equal(t, IPFilterConfig{Deny: []string{"10.1.0.0/16"}}, f.Config())
+
+	// an invalid configuration keeps the previous one
+	require.Error(t, f.Set(IPFilterConfig{Allow: []string{"10.0.0.0/33"}}))
+	require.Error(t, f.Set(IPFilterConfig{Deny: []string{"conode.example"}}))
+	require.False(t, f.Allows("10.1.2.3:80"))
+	_, err = NewIPFilter(IPFilterConfig{Allow: []string{"10.0.0"}})
+	require.Error(t, err)
+}
+
+func TestFilteredListener(t *testing.T) {
+	f, err := NewIPFilter(IPFilterConfig{Deny: []string{"127.0.0.0/8"}})
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln := NewFilteredListener(l, f)
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	// the refused connection is closed by the listener
+	c, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = c.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.False(t, isTimeout(err))
+	c.Close()
+
+	require.NoError(t, f.Set(IPFilterConfig{}))
+	c, err = net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	select {
+	case a := <-accepted:
+		a.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not accepted")
+	}
+}
+
+func TestRouter_IPFilter(t *testing.T) {
+	RegisterMessage(&hello{})
+	r1, err := NewTestRouterTLS(tSuite, 0)
+	require.NoError(t, err)
+	r2, err := NewTestRouterTLS(tSuite, 0)
+	require.NoError(t, err)
+	f, err := NewIPFilter(IPFilterConfig{Allow: []string{"10.0.0.0/8"}})
+	require.NoError(t, err)
+	r1.SetIPFilter(f)
+	go r1.Start()
+	defer r1.Stop()
+	go r2.Start()
+	defer r2.Stop()
+
+	// the connection is closed before the TLS handshake
+	_, err = r2.Send(r1.ServerIdentity, &hello{Hello: "refused"})
+	require.Error(t, err)
+
+	require.NoError(t, f.Set(IPFilterConfig{Allow: []string{"127.0.0.1", "::1"}}))
+	_, err = r2.Send(r1.ServerIdentity, &hello{Hello: "allowed"})
+	require.NoError(t, err)
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
@@ -0,0 +1,215 @@
+package network
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// LatencyBounds are the upper bounds of the durations by which the latencies
+// are counted in Latency.
+var LatencyBounds = []time.Duration{time.Millisecond, 2500 * time.Microsecond,
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 2500 * time.Millisecond,
+	5 * time.Second, 10 * time.Second}
+
+// Latency is the distribution of the durations measured with a peer.
+type Latency struct {
+	// Count is the number of durations.
+	Count uint64
+	// Sum is the total of the durations.
+	Sum time.Duration
+	// Last is the last duration measured.
+	Last time.Duration
+	// Durations are the number of durations by length: Durations[i] counts
+	// the ones of at most LatencyBounds[i] and longer than the previous
+	// bound, and the last one counts the ones longer than all the bounds.
+	Durations []uint64
+}
+
+func (l *Latency) record(d time.Duration) {
+	if l.Durations == nil {
+		l.Durations = make([]uint64, len(LatencyBounds)+1)
+	}
+	l.Count++
+	l.Sum += d
+	l.Last = d
+	l.Durations[sort.Search(len(LatencyBounds), func(i int) bool {
+		return d <= LatencyBounds[i]
+	})]++
+}
+
+// PeerLatency are the latencies measured with a peer.
+type PeerLatency struct {
+	ServerIdentity *ServerIdentity
+	// RTT are the round-trip times of the keep-alive pings, see
+	// Router.SetKeepAlive.
+	RTT Latency
+	// Handshake are the durations of the TLS handshakes of the connections
+	// opened to the peer.
+	Handshake Latency
+}
+
+// keepAlivePing is sent over the connections by the keep-alive of the
+// router. The peer answers with a keepAlivePong of the same nonce.
+type keepAlivePing struct {
+	Nonce uint64
+}
+
+type keepAlivePong struct {
+	Nonce uint64
+}
+
+func init() {
+	RegisterMessages(&keepAlivePing{}, &keepAlivePong{})
+}
+
+// pingTimeout is how long the answer to a ping is waited for.
+const pingTimeout = time.Minute
+
+type sentPing struct {
+	peer ServerIdentityID
+	time time.Time
+}
+
+// latencies are the latencies of the peers of a router.
+type latencies struct {
+	sync.Mutex
+	peers map[ServerIdentityID]*PeerLatency
+	// pings waiting for their answer, by nonce
+	pings map[uint64]sentPing
+	nonce uint64
+}
+
+func (l *latencies) peer(si *ServerIdentity) *PeerLatency {
+	if l.peers == nil {
+		l.peers = make(map[ServerIdentityID]*PeerLatency)
+	}
+	pl, ok := l.peers[si.ID]
+	if !ok {
+		pl = &PeerLatency{ServerIdentity: si}
+		l.peers[si.ID] = pl
+	}
+	return pl
+}
+
+// ping returns the nonce of a ping sent to the peer now, and forgets the
+// pings that weren't answered in time.
+func (l *latencies) ping(id ServerIdentityID) uint64 {
+	l.Lock()
+	defer l.Unlock()
+	if l.pings == nil {
+		l.pings = make(map[uint64]sentPing)
+	}
+	now := time.Now()
+	for nonce, p := range l.pings {
+		if now.Sub(p.time) > pingTimeout {
+			delete(l.pings, nonce)
+		}
+	}
+	l.nonce++
+	l.pings[l.nonce] = sentPing{peer: id, time: now}
+	return l.nonce
+}
+
+// pong records the round-trip time of the ping answered by the peer.
+func (l *latencies) pong(si *ServerIdentity, nonce uint64) {
+	l.Lock()
+	defer l.Unlock()
+	p, ok := l.pings[nonce]
+	if !ok || !p.peer.Equal(si.ID) {
+		return
+	}
+	delete(l.pings, nonce)
+	l.peer(si).RTT.record(time.Since(p.time))
+}
+
+func (l *latencies) handshake(si *ServerIdentity, d time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	l.peer(si).Handshake.record(d)
+}
+
+// copy returns a copy of the latencies of the peers, sorted by address.
+func (l *latencies) copy() []PeerLatency {
+	l.Lock()
+	defer l.Unlock()
+	var peers []PeerLatency
+	for _, pl := range l.peers {
+		cp := *pl
+		cp.RTT.Durations = append([]uint64(nil), pl.RTT.Durations...)
+		cp.Handshake.Durations = append([]uint64(nil), pl.Handshake.Durations...)
+		peers = append(peers, cp)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].ServerIdentity.Address < peers[j].ServerIdentity.Address
+	})
+	return peers
+}
+
+// SetKeepAlive sends a ping every interval over the connections to the other
+// conodes, which keeps them open and measures the round-trip times returned
+// by PeerLatencies. Zero stops the pings.
+func (r *Router) SetKeepAlive(interval time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	if r.keepAliveStop != nil {
+		close(r.keepAliveStop)
+		r.keepAliveStop = nil
+	}
+	if interval > 0 && !r.isClosed {
+		r.keepAliveStop = make(chan struct{})
+		go r.keepAlive(interval, r.keepAliveStop)
+	}
+}
+
+// PeerLatencies returns the latencies measured with the other conodes,
+// sorted by address.
+func (r *Router) PeerLatencies() []PeerLatency {
+	return r.latencies.copy()
+}
+
+func (r *Router) keepAlive(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		r.Lock()
+		conns := make(map[ServerIdentityID]Conn)
+		for id, arr := range r.connections {
+			if len(arr) > 0 {
+				conns[id] = arr[0]
+			}
+		}
+		r.Unlock()
+		for id, c := range conns {
+			ping := &keepAlivePing{Nonce: r.latencies.ping(id)}
+			if _, err := c.Send(ping); err != nil {
+				log.Lvl3(r.address, "couldn't ping", c.Remote(), ":", err)
+			}
+		}
+	}
+}
+
+// handleKeepAlive answers the pings and records the round-trip times of the
+// answers. It returns false if the message isn't one of them.
+func (r *Router) handleKeepAlive(remote *ServerIdentity, c Conn, msg Message) bool {
+	switch m := msg.(type) {
+	case *keepAlivePing:
+		if _, err := c.Send(&keepAlivePong{Nonce: m.Nonce}); err != nil {
+			log.Lvl3(r.address, "couldn't answer the ping of", remote, ":", err)
+		}
+	case *keepAlivePong:
+		r.latencies.pong(remote, m.Nonce)
+	default:
+		return false
+	}
+	return true
+}
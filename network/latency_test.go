@@ -0,0 +1,57 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatency(t *testing.T) {
+	var l Latency
+	l.record(500 * time.Microsecond)
+	l.record(time.Millisecond)
+	l.record(3 * time.Millisecond)
+	l.record(time.Minute)
+
+	require.Equal(t, uint64(4), l.Count)
+	require.Equal(t, time.Minute+4500*time.Microsecond, l.Sum)
+	require.Equal(t, time.Minute, l.Last)
+	require.Equal(t, len(LatencyBounds)+1, len(l.Durations))
+	require.Equal(t, uint64(2), l.Durations[0])
+	require.Equal(t, uint64(0), l.Durations[1])
+	require.Equal(t, uint64(1), l.Durations[2])
+	require.Equal(t, uint64(1), l.Durations[len(LatencyBounds)])
+}
+
+func TestRouter_KeepAlive(t *testing.T) {
+	r1, err := NewTestRouterTCP(0)
+	require.NoError(t, err)
+	r2, err := NewTestRouterTCP(0)
+	require.NoError(t, err)
+	go r1.Start()
+	go r2.Start()
+	defer r1.Stop()
+	defer r2.Stop()
+
+	r2.SetKeepAlive(10 * time.Millisecond)
+	_, err = r2.Send(r1.ServerIdentity, &SimpleMessage{3})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		peers := r2.PeerLatencies()
+		return len(peers) == 1 && peers[0].RTT.Count >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+	peers := r2.PeerLatencies()
+	require.True(t, peers[0].ServerIdentity.ID.Equal(r1.ServerIdentity.ID))
+	require.NotZero(t, peers[0].RTT.Last)
+	// TCP connections have no handshake
+	require.Zero(t, peers[0].Handshake.Count)
+	// only r2 sends pings
+	require.Empty(t, r1.PeerLatencies())
+
+	r2.SetKeepAlive(0)
+	count := r2.PeerLatencies()[0].RTT.Count
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, r2.PeerLatencies()[0].RTT.Count <= count+1)
+}
@@ -0,0 +1,135 @@
+package network
+
+import (
+	"math/rand"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// Link describes an emulated network link between two servers. The messages
+// sent over it are delivered after the delay, no faster than the bandwidth
+// allows, and in order. A lost message is delivered after a retransmission
+// timeout, as TCP would do, and holds back the messages behind it.
+type Link struct {
+	// Delay is the one-way latency of the link.
+	Delay time.Duration
+	// Bandwidth of the link in Mbps, 0 for no limit.
+	Bandwidth float64
+	// Loss is the percentage of lost messages.
+	Loss float64
+}
+
+// LinkEmulator returns the link used by the messages that from sends to to,
+// or false if they are delivered as is.
+type LinkEmulator func(from, to *ServerIdentity) (Link, bool)
+
+// linkMinRTO is the retransmission timeout of a lost message on a link
+// without delay, the minimum of linux.
+const linkMinRTO = 200 * time.Millisecond
+
+// linkMaxRetransmissions limits the retransmissions of a lost message.
+const linkMaxRetransmissions = 10
+
+// SetLinkEmulator emulates the links of the messages received by the router,
+// to study the behavior of a protocol over a WAN with all the servers in one
+// process. It is meant for simulations and applies to the connections opened
+// after the call.
+func (r *Router) SetLinkEmulator(e LinkEmulator) {
+	r.Lock()
+	defer r.Unlock()
+	r.links = e
+}
+
+// linkQueue delays the messages received over a connection, as given by
+// its link, before dispatching them.
+type linkQueue struct {
+	link     Link
+	dispatch func(*Envelope)
+	rand     *rand.Rand
+	// busy is when the link finishes sending the last message.
+	busy time.Time
+	// last is when the last message is delivered.
+	last    time.Time
+	packets chan linkPacket
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+type linkPacket struct {
+	envelope *Envelope
+	at       time.Time
+}
+
+// newLinkQueue returns a queue dispatching the messages of the link with
+// the given function.
+func newLinkQueue(link Link, dispatch func(*Envelope)) *linkQueue {
+	q := &linkQueue{
+		link:     link,
+		dispatch: dispatch,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		packets:  make(chan linkPacket, 1024),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// push queues the message, received now.
+func (q *linkQueue) push(e *Envelope) {
+	select {
+	case q.packets <- linkPacket{e, q.deliverAt(time.Now(), int(e.Size))}:
+	case <-q.stop:
+	}
+}
+
+// deliverAt returns when a message of the given size, sent at now, is
+// delivered.
+func (q *linkQueue) deliverAt(now time.Time, size int) time.Time {
+	start := now
+	if q.busy.After(start) {
+		start = q.busy
+	}
+	q.busy = start
+	if q.link.Bandwidth > 0 {
+		q.busy = start.Add(time.Duration(float64(size*8) / q.link.Bandwidth *
+			float64(time.Microsecond)))
+	}
+	at := q.busy.Add(q.link.Delay)
+	rto := linkMinRTO + 2*q.link.Delay
+	for i := 0; i < linkMaxRetransmissions && q.rand.Float64()*100 < q.link.Loss; i++ {
+		at = at.Add(rto)
+	}
+	if at.Before(q.last) {
+		at = q.last
+	}
+	q.last = at
+	return at
+}
+
+// run dispatches the messages when they are due, until the queue is closed.
+func (q *linkQueue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case p := <-q.packets:
+			select {
+			case <-time.After(time.Until(p.at)):
+			case <-q.stop:
+				return
+			}
+			q.dispatch(p.envelope)
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// close stops the queue and drops the messages not yet delivered, as they
+// would be with the connection.
+func (q *linkQueue) close() {
+	close(q.stop)
+	<-q.done
+	log.Lvl4("Link queue closed with", len(q.packets), "messages dropped")
+}
@@ -0,0 +1,59 @@
+package network
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkQueue_deliverAt(t *testing.T) {
+	q := &linkQueue{link: Link{Delay: 50 * time.Millisecond, Bandwidth: 8},
+		rand: rand.New(rand.NewSource(1))}
+	now := time.Now()
+	// 1000 bytes at 8 Mbps take 1ms
+	require.Equal(t, now.Add(51*time.Millisecond), q.deliverAt(now, 1000))
+	// the second message waits for the first one to be sent
+	require.Equal(t, now.Add(52*time.Millisecond), q.deliverAt(now, 1000))
+	later := now.Add(time.Second)
+	require.Equal(t, later.Add(51*time.Millisecond), q.deliverAt(later, 1000))
+
+	// a lost message is retransmitted and holds back the next ones
+	q = &linkQueue{link: Link{Delay: 50 * time.Millisecond, Loss: 100},
+		rand: rand.New(rand.NewSource(1))}
+	rto := linkMinRTO + 100*time.Millisecond
+	at := q.deliverAt(now, 1000)
+	require.Equal(t, now.Add(50*time.Millisecond+linkMaxRetransmissions*rto), at)
+	q.link.Loss = 0
+	require.Equal(t, at, q.deliverAt(now, 1000))
+}
+
+func TestRouterLinkEmulator(t *testing.T) {
+	h1, err1 := NewTestRouterTCP(0)
+	h2, err2 := NewTestRouterTCP(0)
+	require.NoError(t, err1)
+	require.NoError(t, err2)
+	h2.SetLinkEmulator(func(from, to *ServerIdentity) (Link, bool) {
+		require.True(t, from.Equal(h1.ServerIdentity))
+		require.True(t, to.Equal(h2.ServerIdentity))
+		return Link{Delay: 200 * time.Millisecond}, true
+	})
+	go h1.Start()
+	go h2.Start()
+	defer func() {
+		h1.Stop()
+		h2.Stop()
+	}()
+
+	proc := &simpleMessageProc{t, make(chan SimpleMessage)}
+	h2.RegisterProcessor(proc, SimpleMessageType)
+	start := time.Now()
+	_, err := h1.Send(h2.ServerIdentity, &SimpleMessage{1})
+	require.NoError(t, err)
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{2})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), (<-proc.relay).I)
+	require.Equal(t, int64(2), (<-proc.relay).I)
+	require.True(t, time.Since(start) >= 200*time.Millisecond)
+}
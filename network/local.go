@@ -117,7 +117,8 @@ func (lm *LocalManager) connect(local, remote Address, s Suite) (*LocalConn, err
 
 	fn, ok := lm.listening[remote]
 	if !ok {
-		return nil, xerrors.Errorf("%s can't connect to %s: it's not listening", local, remote)
+		return nil, newError(CodePeerUnreachable, "connect",
+			xerrors.Errorf("%s can't connect to %s: it's not listening", local, remote))
 	}
 
 	outEndpoint := endpoint{local, lm.counter}
@@ -248,7 +249,7 @@ func NewLocalConnWithManager(lm *LocalManager, local, remote Address, s Suite) (
 		if err == nil {
 			return c, nil
 		} else if i == MaxRetryConnect-1 {
-			return nil, xerrors.Errorf("connect: %v", err)
+			return nil, xerrors.Errorf("connect: %w", err)
 		}
 		time.Sleep(WaitRetry)
 	}
@@ -510,7 +511,7 @@ func (lh *LocalHost) Connect(si *ServerIdentity) (Conn, error) {
 		if err == nil {
 			return c, nil
 		}
-		finalErr = xerrors.Errorf("local connection: %v", err)
+		finalErr = xerrors.Errorf("local connection: %w", err)
 		select {
 		case <-time.After(WaitRetry):
 			// sleep done, go try again
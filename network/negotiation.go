@@ -0,0 +1,163 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+
+	"go.dedis.ch/kyber/v3/suites"
+	"golang.org/x/xerrors"
+)
+
+// SuiteOffer is sent before the ServerIdentity by a router with an allowlist
+// of suites, see Router.SetSuites. It holds the suites the router accepts,
+// the one of its own key first.
+type SuiteOffer struct {
+	Suites []string
+}
+
+// SuiteReply answers a SuiteOffer with the suite chosen for the connection,
+// or with an empty suite and the allowed ones if none of the offered suites
+// is allowed.
+type SuiteReply struct {
+	Suite   string
+	Allowed []string
+}
+
+// SuiteOfferType and SuiteReplyType are the types of the messages of the
+// negotiation of the suite.
+var (
+	SuiteOfferType = RegisterMessage(&SuiteOffer{})
+	SuiteReplyType = RegisterMessage(&SuiteReply{})
+)
+
+// SuiteError tells which suites were offered and which were allowed when no
+// common suite was found. It is the cause of the Error with the code
+// CodeSuiteRejected.
+type SuiteError struct {
+	Offered []string
+	Allowed []string
+}
+
+func (e *SuiteError) Error() string {
+	return fmt.Sprintf("none of the suites %s is allowed, only %s",
+		strings.Join(e.Offered, ","), strings.Join(e.Allowed, ","))
+}
+
+// SetSuites sets the suites the router accepts from its peers. The suite of
+// its own key is always accepted. Once it is set, the router negotiates the
+// suite of the connections it opens, which is only understood by routers
+// of this version: all the conodes of a roster must be updated before it is
+// used. The peers that don't negotiate are expected to use the suite of the
+// router, as are all the peers of a router without an allowlist.
+//
+// The messages of a connection are decoded with the negotiated suite, but
+// the certificate of a TLS listener is checked with the suite of the router
+// connecting to it.
+func (r *Router) SetSuites(names []string) error {
+	for _, name := range names {
+		if _, err := suites.Find(name); err != nil {
+			return xerrors.Errorf("unknown suite %q", name)
+		}
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.suites = append([]string{}, names...)
+	return nil
+}
+
+// allowedSuites returns the suites accepted from the peers, the one of the
+// router first.
+func (r *Router) allowedSuites() []string {
+	own := r.ownSuite()
+	allowed := []string{own}
+	r.Lock()
+	defer r.Unlock()
+	for _, name := range r.suites {
+		if !strings.EqualFold(name, own) {
+			allowed = append(allowed, name)
+		}
+	}
+	return allowed
+}
+
+// ownSuite returns the name of the suite of the host.
+func (r *Router) ownSuite() string {
+	switch h := r.host.(type) {
+	case *TCPHost:
+		return h.suite.String()
+	case *LocalHost:
+		return h.suite.String()
+	}
+	return ""
+}
+
+// negotiates returns true if the router sends an offer when it connects.
+func (r *Router) negotiates() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.suites != nil
+}
+
+// offerSuites negotiates the suite of a new connection with the peer.
+func (r *Router) offerSuites(c Conn) error {
+	offer := &SuiteOffer{Suites: r.allowedSuites()}
+	if _, err := c.Send(offer); err != nil {
+		return xerrors.Errorf("sending suites: %w", err)
+	}
+	env, err := c.Receive()
+	if err != nil {
+		return xerrors.Errorf("receiving suite: %w", err)
+	}
+	reply, ok := env.Msg.(*SuiteReply)
+	if !ok {
+		return newError(CodeHandshakeFailed, "negotiation",
+			xerrors.Errorf("received wrong type %s", env.MsgType))
+	}
+	if reply.Suite == "" {
+		return newError(CodeSuiteRejected, "negotiation",
+			&SuiteError{Offered: offer.Suites, Allowed: reply.Allowed})
+	}
+	if !strings.EqualFold(reply.Suite, offer.Suites[0]) {
+		// our ServerIdentity can't be sent in another suite
+		return newError(CodeSuiteRejected, "negotiation",
+			&SuiteError{Offered: offer.Suites[:1], Allowed: []string{reply.Suite}})
+	}
+	return setConnSuite(c, reply.Suite)
+}
+
+// answerSuites chooses the first of the offered suites that is allowed, and
+// tells it to the peer.
+func (r *Router) answerSuites(c Conn, offer *SuiteOffer) error {
+	allowed := r.allowedSuites()
+	for _, name := range offer.Suites {
+		for _, a := range allowed {
+			if strings.EqualFold(name, a) {
+				if _, err := c.Send(&SuiteReply{Suite: a}); err != nil {
+					return xerrors.Errorf("sending suite: %w", err)
+				}
+				return setConnSuite(c, a)
+			}
+		}
+	}
+	if _, err := c.Send(&SuiteReply{Allowed: allowed}); err != nil {
+		return xerrors.Errorf("sending suites: %w", err)
+	}
+	return newError(CodeSuiteRejected, "negotiation",
+		&SuiteError{Offered: offer.Suites, Allowed: allowed})
+}
+
+// setConnSuite makes the connection decode the messages with the suite.
+func setConnSuite(c Conn, name string) error {
+	s, err := suites.Find(name)
+	if err != nil {
+		return newError(CodeSuiteRejected, "negotiation",
+			xerrors.Errorf("unknown suite %q", name))
+	}
+	switch conn := c.(type) {
+	case *TCPConn:
+		conn.suite = s
+	case *LocalConn:
+		conn.suite = s
+	}
+	return nil
+}
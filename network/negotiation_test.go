@@ -0,0 +1,55 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/kyber/v3/util/key"
+	"golang.org/x/xerrors"
+)
+
+// newSuiteRouter returns a TCP router with a key of the suite.
+func newSuiteRouter(t *testing.T, s Suite) *Router {
+	kp := key.NewKeyPair(s)
+	si := NewServerIdentity(kp.Public, NewTCPAddress("127.0.0.1:0"))
+	si.SetPrivate(kp.Private)
+	h, err := NewTCPHost(si, s)
+	require.NoError(t, err)
+	si.Address = h.TCPListener.Address()
+	r := NewRouter(si, h)
+	r.UnauthOk = true
+	go r.Start()
+	return r
+}
+
+func TestRouter_SetSuites(t *testing.T) {
+	p256 := suites.MustFind("P256")
+	ed := newSuiteRouter(t, tSuite)
+	defer ed.Stop()
+	p := newSuiteRouter(t, p256)
+	defer p.Stop()
+	require.Error(t, p.SetSuites([]string{"unknown"}))
+	require.NoError(t, p.SetSuites([]string{"Ed25519"}))
+	require.NoError(t, ed.SetSuites([]string{}))
+
+	// the Ed25519 conode is allowed by the P256 one
+	proc := &simpleMessageProc{t, make(chan SimpleMessage)}
+	p.RegisterProcessor(proc, SimpleMessageType)
+	_, err := ed.Send(p.ServerIdentity, &SimpleMessage{3})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), (<-proc.relay).I)
+
+	// but not the other way around
+	p2 := newSuiteRouter(t, p256)
+	defer p2.Stop()
+	require.NoError(t, p2.SetSuites([]string{}))
+	_, err = p2.Send(ed.ServerIdentity, &SimpleMessage{3})
+	require.Error(t, err)
+	require.True(t, xerrors.Is(err, ErrSuiteRejected))
+	require.Equal(t, CodeSuiteRejected, Code(err))
+	var suiteErr *SuiteError
+	require.True(t, xerrors.As(err, &suiteErr))
+	require.Equal(t, []string{"P256"}, suiteErr.Offered)
+	require.Equal(t, []string{"Ed25519"}, suiteErr.Allowed)
+}
@@ -46,10 +46,22 @@ type Router struct {
 	// Closed, or EOF). Those handler should be added by using SetErrorHandler(). The 1st argument is the remote
 	// server with whom the error happened
 	connectionErrorHandlers []func(*ServerIdentity)
+	// Every handler in this list is called with up true when the first
+	// connection to a peer is registered, and with up false when its last
+	// connection is removed. They are added with AddPeerHandler().
+	peerHandlers []func(si *ServerIdentity, up bool)
 
 	// keep bandwidth of closed connections
 	traffic    counterSafe
 	msgTraffic counterSafe
+	// traffic by type of the messages
+	typesTx TypeCounter
+	typesRx TypeCounter
+	// latencies of the peers, and the pings of the keep-alive waiting for
+	// their answer
+	latencies latencies
+	// closed to stop the keep-alive, nil if it isn't running
+	keepAliveStop chan struct{}
 	// If paused is not nil, then handleConn will stop processing. When unpaused
 	// it will break the connection. This is for testing node failure cases.
 	paused chan bool
@@ -58,6 +70,19 @@ type Router struct {
 	UnauthOk bool
 	// Quiets the startup of the server if set to true.
 	Quiet bool
+	// links emulates the links of the received messages, if set.
+	links LinkEmulator
+	// capture records the received messages, if set.
+	capture *Capture
+	// offline drops the messages, except the ones of the given types.
+	offline       bool
+	offlineExcept map[MessageTypeID]bool
+	// suites accepted from the peers besides the one of the host, nil if
+	// the suite of the connections isn't negotiated.
+	suites []string
+	// ipFilter closes the incoming connections of the refused networks, if
+	// set.
+	ipFilter *IPFilter
 }
 
 // NewRouter returns a new Router attached to a ServerIdentity and the host we want to
@@ -95,6 +120,28 @@ func (r *Router) Unpause() {
 	r.Unlock()
 }
 
+// SetOffline emulates the crash of the server for simulations: while
+// offline, the router drops the messages it receives and refuses to send,
+// except for the messages of the given types. SetOffline(false) brings it
+// back.
+func (r *Router) SetOffline(offline bool, except ...MessageTypeID) {
+	r.Lock()
+	defer r.Unlock()
+	r.offline = offline
+	r.offlineExcept = make(map[MessageTypeID]bool)
+	for _, t := range except {
+		r.offlineExcept[t] = true
+	}
+}
+
+// dropsOffline returns true if the router is offline and drops the messages
+// of the given type.
+func (r *Router) dropsOffline(t MessageTypeID) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.offline && !r.offlineExcept[t]
+}
+
 // Start the listening routine of the underlying Host. This is a
 // blocking call until r.Stop() is called.
 func (r *Router) Start() {
@@ -105,6 +152,13 @@ func (r *Router) Start() {
 	// Any incoming connection waits for the remote server identity
 	// and will create a new handling routine.
 	err := r.host.Listen(func(c Conn) {
+		if !r.allows(c) {
+			log.Lvl3(r.address, "refused connection from", c.Remote())
+			if err := c.Close(); err != nil {
+				log.Lvl5("Couldn't close refused connection:", err)
+			}
+			return
+		}
 		dst, err := r.receiveServerIdentity(c)
 		if err != nil {
 			if !strings.Contains(err.Error(), "EOF") {
@@ -124,7 +178,7 @@ func (r *Router) Start() {
 		}
 		// start handleConn in a go routine that waits for incoming messages and
 		// dispatches them.
-		if err := r.launchHandleRoutine(dst, c); err != nil {
+		if err := r.launchHandleRoutine(dst, c, true); err != nil {
 			log.Lvl3(r.address, "does not accept incoming connection from", c.Remote(), "because it's closed")
 			return
 		}
@@ -145,6 +199,10 @@ func (r *Router) Stop() error {
 	r.Lock()
 	// set the isClosed to true
 	r.isClosed = true
+	if r.keepAliveStop != nil {
+		close(r.keepAliveStop)
+		r.keepAliveStop = nil
+	}
 
 	// then close all connections
 	for _, arr := range r.connections {
@@ -178,6 +236,11 @@ func (r *Router) Send(e *ServerIdentity, msgs ...Message) (uint64, error) {
 	if len(msgs) == 0 {
 		return 0, xerrors.New("need to send at least one message")
 	}
+	for _, msg := range msgs {
+		if r.dropsOffline(MessageType(msg)) {
+			return 0, xerrors.Errorf("offline: %w", ErrClosed)
+		}
+	}
 
 	// Update the message counter with the new message about to be sent.
 	r.msgTraffic.updateTx(1)
@@ -192,6 +255,12 @@ func (r *Router) Send(e *ServerIdentity, msgs ...Message) (uint64, error) {
 				MsgType:        MessageType(msg),
 				Msg:            msg,
 			}
+			r.Lock()
+			capture := r.capture
+			r.Unlock()
+			if capture != nil {
+				capture.record(e, e, msg)
+			}
 			if err := r.Dispatch(packet); err != nil {
 				return 0, xerrors.Errorf("Error dispatching: %s", err)
 			}
@@ -202,6 +271,7 @@ func (r *Router) Send(e *ServerIdentity, msgs ...Message) (uint64, error) {
 			}
 			log.Lvl5("Message sent")
 			sent += uint64(len(b))
+			r.typesTx.Record(trafficName(packet.MsgType, msg), uint64(len(b)))
 		}
 		return sent, nil
 	}
@@ -214,7 +284,7 @@ func (r *Router) Send(e *ServerIdentity, msgs ...Message) (uint64, error) {
 		c, sentLen, err = r.connect(e)
 		totSentLen += sentLen
 		if err != nil {
-			return totSentLen, xerrors.Errorf("connecting: %v", err)
+			return totSentLen, xerrors.Errorf("connecting: %w", err)
 		}
 	}
 
@@ -227,14 +297,15 @@ func (r *Router) Send(e *ServerIdentity, msgs ...Message) (uint64, error) {
 			c, sentLen, err := r.connect(e)
 			totSentLen += sentLen
 			if err != nil {
-				return totSentLen, xerrors.Errorf("connecting: %v", err)
+				return totSentLen, xerrors.Errorf("connecting: %w", err)
 			}
 			sentLen, err = c.Send(msg)
 			totSentLen += sentLen
 			if err != nil {
-				return totSentLen, xerrors.Errorf("connecting: %v", err)
+				return totSentLen, xerrors.Errorf("connecting: %w", err)
 			}
 		}
+		r.typesTx.Record(trafficName(MessageType(msg), msg), sentLen)
 	}
 	log.Lvl5("Message sent")
 	return totSentLen, nil
@@ -247,20 +318,31 @@ func (r *Router) connect(si *ServerIdentity) (Conn, uint64, error) {
 	c, err := r.host.Connect(si)
 	if err != nil {
 		log.Lvl3("Could not connect to", si.Address, err)
-		return nil, 0, xerrors.Errorf("connecting: %v", err)
+		return nil, 0, xerrors.Errorf("connecting: %w", err)
 	}
 	log.Lvl3(r.address, "Connected to", si.Address)
+	if tc, ok := c.(*TCPConn); ok && tc.handshake > 0 {
+		r.latencies.handshake(si, tc.handshake)
+	}
+	if r.negotiates() {
+		if err := r.offerSuites(c); err != nil {
+			if err := c.Close(); err != nil {
+				log.Lvl3("Couldn't close connection:", err)
+			}
+			return nil, 0, xerrors.Errorf("negotiating suite: %w", err)
+		}
+	}
 	var sentLen uint64
 	if sentLen, err = c.Send(r.ServerIdentity); err != nil {
-		return nil, sentLen, xerrors.Errorf("sending: %v", err)
+		return nil, sentLen, xerrors.Errorf("sending: %w", err)
 	}
 
 	if err = r.registerConnection(si, c); err != nil {
-		return nil, sentLen, xerrors.Errorf("register connection: %v", err)
+		return nil, sentLen, xerrors.Errorf("register connection: %w", err)
 	}
 
-	if err = r.launchHandleRoutine(si, c); err != nil {
-		return nil, sentLen, xerrors.Errorf("handling routine: %v", err)
+	if err = r.launchHandleRoutine(si, c, false); err != nil {
+		return nil, sentLen, xerrors.Errorf("handling routine: %w", err)
 	}
 	return c, sentLen, nil
 
@@ -268,8 +350,6 @@ func (r *Router) connect(si *ServerIdentity) (Conn, uint64, error) {
 
 func (r *Router) removeConnection(si *ServerIdentity, c Conn) {
 	r.Lock()
-	defer r.Unlock()
-
 	var toDelete = -1
 	arr := r.connections[si.ID]
 	for i, cc := range arr {
@@ -279,6 +359,7 @@ func (r *Router) removeConnection(si *ServerIdentity, c Conn) {
 	}
 
 	if toDelete == -1 {
+		r.Unlock()
 		log.Error("Remove a connection which is not registered !?")
 		return
 	}
@@ -286,6 +367,13 @@ func (r *Router) removeConnection(si *ServerIdentity, c Conn) {
 	arr[toDelete] = arr[len(arr)-1]
 	arr[len(arr)-1] = nil
 	r.connections[si.ID] = arr[:len(arr)-1]
+	handlers := r.peerHandlers
+	r.Unlock()
+	if len(arr) == 1 {
+		for _, h := range handlers {
+			h(si, false)
+		}
+	}
 }
 
 // triggerConnectionErrorHandlers trigger all registered connectionsErrorHandlers
@@ -297,8 +385,9 @@ func (r *Router) triggerConnectionErrorHandlers(remote *ServerIdentity) {
 
 // handleConn waits for incoming messages and calls the dispatcher for
 // each new message. It only quits if the connection is closed or another
-// unrecoverable error in the connection appears.
-func (r *Router) handleConn(remote *ServerIdentity, c Conn) {
+// unrecoverable error in the connection appears. If the connection was
+// opened by the peer, incoming is true.
+func (r *Router) handleConn(remote *ServerIdentity, c Conn, incoming bool) {
 	defer func() {
 		// Clean up the connection by making sure it's closed.
 		if err := c.Close(); err != nil {
@@ -312,7 +401,38 @@ func (r *Router) handleConn(remote *ServerIdentity, c Conn) {
 		log.Lvl4("onet close", c.Remote(), "rx", rx, "tx", tx)
 	}()
 	address := c.Remote()
+	from := address
+	if from.ConnType() == InvalidConnType {
+		// the TCP connections give the host and port only
+		from = NewAddress(remote.Address.ConnType(), string(address))
+	}
 	log.Lvl3(r.address, "Handling new connection from", remote.Address)
+	r.Lock()
+	links := r.links
+	capture := r.capture
+	r.Unlock()
+	dispatch := func(packet *Envelope) {
+		if r.dropsOffline(packet.MsgType) {
+			log.Lvl4(r.address, "is offline and drops", packet.MsgType)
+			return
+		}
+		if r.handleKeepAlive(remote, c, packet.Msg) {
+			return
+		}
+		if capture != nil {
+			capture.record(remote, r.ServerIdentity, packet.Msg)
+		}
+		if err := r.Dispatch(packet); err != nil {
+			log.Lvl3("Error dispatching:", err)
+		}
+	}
+	if links != nil {
+		if link, ok := links(remote, r.ServerIdentity); ok {
+			q := newLinkQueue(link, dispatch)
+			defer q.close()
+			dispatch = q.push
+		}
+	}
 	for {
 		packet, err := c.Receive()
 
@@ -358,14 +478,15 @@ func (r *Router) handleConn(remote *ServerIdentity, c Conn) {
 		}
 
 		packet.ServerIdentity = remote
+		if incoming {
+			packet.Remote = from
+		}
 
 		// Update the message counter with the new message about to be processed.
 		r.msgTraffic.updateRx(1)
+		r.typesRx.Record(trafficName(packet.MsgType, packet.Msg), uint64(packet.Size))
 
-		if err := r.Dispatch(packet); err != nil {
-			log.Lvl3("Error dispatching:", err)
-		}
-
+		dispatch(packet)
 	}
 }
 
@@ -387,8 +508,8 @@ func (r *Router) connection(sid ServerIdentityID) Conn {
 func (r *Router) registerConnection(remote *ServerIdentity, c Conn) error {
 	log.Lvl4(r.address, "Registers", remote.Address)
 	r.Lock()
-	defer r.Unlock()
 	if r.isClosed {
+		r.Unlock()
 		return xerrors.Errorf("closing: %w", ErrClosed)
 	}
 	_, okc := r.connections[remote.ID]
@@ -397,17 +518,25 @@ func (r *Router) registerConnection(remote *ServerIdentity, c Conn) error {
 			"Appending new connection to same identity.")
 	}
 	r.connections[remote.ID] = append(r.connections[remote.ID], c)
+	first := len(r.connections[remote.ID]) == 1
+	handlers := r.peerHandlers
+	r.Unlock()
+	if first {
+		for _, h := range handlers {
+			h(remote, true)
+		}
+	}
 	return nil
 }
 
-func (r *Router) launchHandleRoutine(dst *ServerIdentity, c Conn) error {
+func (r *Router) launchHandleRoutine(dst *ServerIdentity, c Conn, incoming bool) error {
 	r.Lock()
 	defer r.Unlock()
 	if r.isClosed {
 		return xerrors.Errorf("closing: %w", ErrClosed)
 	}
 	r.wg.Add(1)
-	go r.handleConn(dst, c)
+	go r.handleConn(dst, c, incoming)
 	return nil
 }
 
@@ -461,6 +590,70 @@ func (r *Router) MsgRx() uint64 {
 	return r.msgTraffic.Rx()
 }
 
+// MsgTypesTx returns the traffic of the messages sent, by type.
+func (r *Router) MsgTypesTx() []TypeTraffic {
+	return r.typesTx.Traffic()
+}
+
+// MsgTypesRx returns the traffic of the messages received, by type.
+func (r *Router) MsgTypesRx() []TypeTraffic {
+	return r.typesRx.Traffic()
+}
+
+// Connections returns the number of open connections.
+func (r *Router) Connections() int {
+	r.Lock()
+	defer r.Unlock()
+	n := 0
+	for _, arr := range r.connections {
+		n += len(arr)
+	}
+	return n
+}
+
+// ConnectionInfo describes the open connections to a remote server.
+type ConnectionInfo struct {
+	ID ServerIdentityID
+	// Remotes are the remote addresses of the connections.
+	Remotes []Address
+	Tx      uint64
+	Rx      uint64
+}
+
+// ConnectionsInfo returns the open connections, grouped by remote server.
+func (r *Router) ConnectionsInfo() []ConnectionInfo {
+	r.Lock()
+	defer r.Unlock()
+	var infos []ConnectionInfo
+	for id, arr := range r.connections {
+		if len(arr) == 0 {
+			continue
+		}
+		info := ConnectionInfo{ID: id}
+		for _, c := range arr {
+			info.Remotes = append(info.Remotes, c.Remote())
+			info.Tx += c.Tx()
+			info.Rx += c.Rx()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// CloseConnections closes all the connections to the server and returns how
+// many were closed. New connections can be opened afterwards.
+func (r *Router) CloseConnections(id ServerIdentityID) int {
+	r.Lock()
+	arr := append([]Conn{}, r.connections[id]...)
+	r.Unlock()
+	for _, c := range arr {
+		if err := c.Close(); err != nil {
+			log.Lvl3("closing connection to", c.Remote(), ":", err)
+		}
+	}
+	return len(arr)
+}
+
 // Listening returns true if this router is started.
 func (r *Router) Listening() bool {
 	return r.host.Listening()
@@ -473,11 +666,21 @@ func (r *Router) receiveServerIdentity(c Conn) (*ServerIdentity, error) {
 	// Receive the other ServerIdentity
 	nm, err := c.Receive()
 	if err != nil {
-		return nil, xerrors.Errorf("Error while receiving ServerIdentity during negotiation %s", err)
+		return nil, xerrors.Errorf("receiving ServerIdentity during negotiation: %w", err)
+	}
+	if offer, ok := nm.Msg.(*SuiteOffer); ok {
+		if err := r.answerSuites(c, offer); err != nil {
+			return nil, err
+		}
+		nm, err = c.Receive()
+		if err != nil {
+			return nil, xerrors.Errorf("receiving ServerIdentity during negotiation: %w", err)
+		}
 	}
 	// Check if it is correct
 	if nm.MsgType != ServerIdentityType {
-		return nil, xerrors.Errorf("Received wrong type during negotiation %s", nm.MsgType.String())
+		return nil, newError(CodeHandshakeFailed, "negotiation",
+			xerrors.Errorf("received wrong type %s", nm.MsgType.String()))
 	}
 
 	// Set the ServerIdentity for this connection
@@ -489,15 +692,18 @@ func (r *Router) receiveServerIdentity(c Conn) (*ServerIdentity, error) {
 		if tlsConn, ok := tcpConn.conn.(*tls.Conn); ok {
 			cs := tlsConn.ConnectionState()
 			if len(cs.PeerCertificates) == 0 {
-				return nil, xerrors.New("TLS connection with no peer certs?")
+				return nil, newError(CodeHandshakeFailed, "negotiation",
+					xerrors.New("TLS connection with no peer certs?"))
 			}
 			pub, err := pubFromCN(tcpConn.suite, cs.PeerCertificates[0].Subject.CommonName)
 			if err != nil {
-				return nil, xerrors.Errorf("decoding key: %v", err)
+				return nil, newError(CodeHandshakeFailed, "negotiation",
+					xerrors.Errorf("decoding key: %w", err))
 			}
 
 			if !pub.Equal(dst.Public) {
-				return nil, xerrors.New("mismatch between certificate CommonName and ServerIdentity.Public")
+				return nil, newError(CodeHandshakeFailed, "negotiation",
+					xerrors.New("mismatch between certificate CommonName and ServerIdentity.Public"))
 			}
 			log.Lvl4(r.address, "Public key from CommonName and ServerIdentity match:", pub)
 		} else {
@@ -517,3 +723,12 @@ func (r *Router) receiveServerIdentity(c Conn) (*ServerIdentity, error) {
 func (r *Router) AddErrorHandler(errorHandler func(*ServerIdentity)) {
 	r.connectionErrorHandlers = append(r.connectionErrorHandlers, errorHandler)
 }
+
+// AddPeerHandler adds a function called with up true when the router gets its
+// first connection to a peer, and with up false when the last one is closed.
+// It is called from the goroutines of the connections, and must not block.
+func (r *Router) AddPeerHandler(h func(si *ServerIdentity, up bool)) {
+	r.Lock()
+	defer r.Unlock()
+	r.peerHandlers = append(r.peerHandlers, h)
+}
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"net"
 	"sync"
 	"testing"
 	"time"
@@ -123,6 +124,75 @@ func TestRouterErrorHandling(t *testing.T) {
 	}
 }
 
+func TestRouterPeerHandler(t *testing.T) {
+	h1, err := NewTestRouterTCP(0)
+	require.NoError(t, err)
+	h2, err := NewTestRouterTCP(0)
+	require.NoError(t, err)
+	go h1.Start()
+	go h2.Start()
+	defer h1.Stop()
+
+	type peerEvent struct {
+		si *ServerIdentity
+		up bool
+	}
+	events := make(chan peerEvent, 10)
+	h1.AddPeerHandler(func(si *ServerIdentity, up bool) {
+		events <- peerEvent{si, up}
+	})
+
+	proc := &simpleMessageProc{t, make(chan SimpleMessage)}
+	h2.RegisterProcessor(proc, SimpleMessageType)
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	require.NoError(t, err)
+	<-proc.relay
+	ev := <-events
+	require.True(t, ev.si.Equal(h2.ServerIdentity))
+	require.True(t, ev.up)
+
+	require.NoError(t, h2.Stop())
+	select {
+	case ev = <-events:
+		require.True(t, ev.si.Equal(h2.ServerIdentity))
+		require.False(t, ev.up)
+	case <-time.After(time.Second):
+		t.Fatal("Peer handler should have been called after a disconnection")
+	}
+	require.Len(t, events, 0)
+}
+
+func TestRouterEnvelopeRemote(t *testing.T) {
+	h1, err := NewTestRouterTCP(0)
+	require.NoError(t, err)
+	h2, err := NewTestRouterTCP(0)
+	require.NoError(t, err)
+	go h1.Start()
+	go h2.Start()
+	defer h1.Stop()
+	defer h2.Stop()
+
+	remotes := make(chan Address, 1)
+	for _, h := range []*Router{h1, h2} {
+		h.RegisterProcessorFunc(SimpleMessageType, func(env *Envelope) error {
+			remotes <- env.Remote
+			return nil
+		})
+	}
+	// h2 sees where the connection opened by h1 comes from
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{3})
+	require.NoError(t, err)
+	remote := <-remotes
+	require.Equal(t, h1.ServerIdentity.Address.ConnType(), remote.ConnType())
+	require.True(t, net.ParseIP(remote.Host()).IsLoopback())
+	require.NotEqual(t, h1.ServerIdentity.Address.Port(), remote.Port())
+
+	// the answer comes back on the connection h1 opened
+	_, err = h2.Send(h1.ServerIdentity, &SimpleMessage{4})
+	require.NoError(t, err)
+	require.Equal(t, Address(""), <-remotes)
+}
+
 func TestRouterSendToSelf(t *testing.T) {
 	r, err := NewTestRouterTCP(0)
 	require.Nil(t, err)
@@ -542,6 +612,18 @@ func TestRouterRxTx(t *testing.T) {
 	require.Equal(t, uint64(0), router1.MsgTx())
 	require.Equal(t, uint64(1), router2.MsgTx())
 	require.Equal(t, uint64(0), router2.MsgRx())
+
+	// the exchange of the identities isn't counted by type
+	txTypes := router2.MsgTypesTx()
+	require.Equal(t, 1, len(txTypes))
+	require.Equal(t, "network.ServerIdentity", txTypes[0].Name)
+	require.Equal(t, uint64(1), txTypes[0].Count)
+	require.NotZero(t, txTypes[0].Bytes)
+	rxTypes := router1.MsgTypesRx()
+	require.Equal(t, 1, len(rxTypes))
+	require.Equal(t, "network.ServerIdentity", rxTypes[0].Name)
+	require.Equal(t, uint64(1), rxTypes[0].Count)
+	require.Empty(t, router1.MsgTypesTx())
 	defer router1.Stop()
 }
 
@@ -604,5 +686,38 @@ func TestRouterHandleUnknownError(t *testing.T) {
 
 	router.wg.Add(1)
 	// The test will leak 1 goroutine if the connection is not dropped
-	go router.handleConn(router.ServerIdentity, &testConn{})
+	go router.handleConn(router.ServerIdentity, &testConn{}, false)
+}
+
+func TestRouterOffline(t *testing.T) {
+	h1, err1 := NewTestRouterTCP(0)
+	h2, err2 := NewTestRouterTCP(0)
+	require.NoError(t, err1)
+	require.NoError(t, err2)
+	go h1.Start()
+	go h2.Start()
+	defer func() {
+		h1.Stop()
+		h2.Stop()
+	}()
+	proc := newSimpleMessageProc(t)
+	h2.RegisterProcessor(proc, SimpleMessageType)
+	status := newSimpleProcessor()
+	h2.RegisterProcessor(status, statusMsgID)
+
+	h2.SetOffline(true, statusMsgID)
+	_, err := h2.Send(h1.ServerIdentity, &SimpleMessage{1})
+	require.Error(t, err)
+	// the messages received while offline are dropped, except the
+	// status messages
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{2})
+	require.NoError(t, err)
+	_, err = h1.Send(h2.ServerIdentity, &statusMessage{true, 3})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), (<-status.relay).Val)
+
+	h2.SetOffline(false)
+	_, err = h1.Send(h2.ServerIdentity, &SimpleMessage{4})
+	require.NoError(t, err)
+	require.Equal(t, int64(4), (<-proc.relay).I)
 }
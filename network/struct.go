@@ -3,6 +3,7 @@ package network
 import (
 	"bytes"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -65,6 +66,11 @@ type Envelope struct {
 	Size Size
 	// which constructors are used
 	Constructors protobuf.Constructors
+	// Remote is where the message comes from, as seen by the router, with
+	// the type of the address of the peer, if the peer opened the
+	// connection. It is empty for the connections opened by the router, as
+	// their remote is the address of the peer anyway.
+	Remote Address
 }
 
 // ServerIdentity is used to represent a Server in the whole internet.
@@ -247,6 +253,98 @@ func (si *ServerIdentity) HasServicePublic(name string) bool {
 	return false
 }
 
+// ServiceKeyName returns the name of the key of the service, under which it
+// is kept in the ServiceIdentities: the name of the service for its main key,
+// and "service/key" for the others.
+func ServiceKeyName(service, key string) string {
+	if key == "" {
+		return service
+	}
+	return service + "/" + key
+}
+
+// ServiceKeyService returns the name of the service the key belongs to.
+func ServiceKeyService(name string) string {
+	return strings.SplitN(name, "/", 2)[0]
+}
+
+// ServiceKey returns the service identity with the given name.
+func (si *ServerIdentity) ServiceKey(name string) (ServiceIdentity, bool) {
+	for _, srvid := range si.ServiceIdentities {
+		if srvid.Name == name {
+			return srvid, true
+		}
+	}
+	return ServiceIdentity{}, false
+}
+
+// ServiceKeys returns the service identities sorted by name.
+func (si *ServerIdentity) ServiceKeys() []ServiceIdentity {
+	keys := append(ServiceIdentities{}, si.ServiceIdentities...)
+	sort.Sort(keys)
+	return keys
+}
+
+// PublicServiceKeys returns the service identities sorted by name, without
+// their private keys, to be given to others.
+func (si *ServerIdentity) PublicServiceKeys() []ServiceIdentity {
+	keys := si.ServiceKeys()
+	for i := range keys {
+		keys[i].private = nil
+	}
+	return keys
+}
+
+// GenerateServiceKey creates a new key pair of the suite with the given name,
+// replacing the one that had it, and returns it.
+//
+// The ServiceIdentities are replaced, not modified, so that the copies of the
+// ServerIdentity keep their keys, but it must not be called while they are
+// read elsewhere.
+func (si *ServerIdentity) GenerateServiceKey(name string, suite suites.Suite) ServiceIdentity {
+	srvid := NewServiceIdentityFromPair(name, suite, key.NewKeyPair(suite))
+	keys := []ServiceIdentity{srvid}
+	for _, other := range si.ServiceIdentities {
+		if other.Name != name {
+			keys = append(keys, other)
+		}
+	}
+	sort.Sort(ServiceIdentities(keys))
+	si.ServiceIdentities = keys
+	return srvid
+}
+
+// RotateServiceKey replaces the key pair with the given name with a new one
+// of the same suite, and returns the new and the old ones.
+func (si *ServerIdentity) RotateServiceKey(name string) (next, old ServiceIdentity, err error) {
+	old, ok := si.ServiceKey(name)
+	if !ok {
+		return next, old, xerrors.Errorf("unknown service key %s", name)
+	}
+	suite, err := suites.Find(old.Suite)
+	if err != nil {
+		return next, old, xerrors.Errorf("suite of %s: %v", name, err)
+	}
+	next = si.GenerateServiceKey(name, suite)
+	return next, old, nil
+}
+
+// RemoveServiceKey removes the key pair with the given name, and returns
+// false if there wasn't any.
+func (si *ServerIdentity) RemoveServiceKey(name string) bool {
+	var keys []ServiceIdentity
+	for _, srvid := range si.ServiceIdentities {
+		if srvid.Name != name {
+			keys = append(keys, srvid)
+		}
+	}
+	if len(keys) == len(si.ServiceIdentities) {
+		return false
+	}
+	si.ServiceIdentities = keys
+	return true
+}
+
 // Toml converts an ServerIdentity to a Toml-structure
 func (si *ServerIdentity) Toml(suite Suite) *ServerIdentityToml {
 	var buf bytes.Buffer
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/kyber/v3/util/key"
 	"go.dedis.ch/onet/v3/log"
 )
@@ -95,3 +96,45 @@ func TestServiceIdentity(t *testing.T) {
 	require.False(t, si.HasServicePublic("c"))
 	require.True(t, si.HasServicePublic("d"))
 }
+
+func TestServerIdentity_ServiceKeys(t *testing.T) {
+	kp := key.NewKeyPair(tSuite)
+	si := NewServerIdentity(kp.Public, NewLocalAddress("1"))
+	bn := suites.MustFind("bn256.g2")
+
+	require.Equal(t, "a", ServiceKeyName("a", ""))
+	require.Equal(t, "a/sign", ServiceKeyName("a", "sign"))
+	require.Equal(t, "a", ServiceKeyService("a/sign"))
+
+	main := si.GenerateServiceKey("a", tSuite)
+	sign := si.GenerateServiceKey("a/sign", bn)
+	require.Equal(t, "bn256.G2", sign.Suite)
+	keys := si.ServiceKeys()
+	require.Len(t, keys, 2)
+	require.Equal(t, "a", keys[0].Name)
+	require.True(t, si.HasServiceKeyPair("a/sign"))
+	require.Equal(t, sign.Public, si.ServicePublic("a/sign"))
+
+	// a copy of the ServerIdentity keeps the old keys
+	cp := *si
+	next, old, err := si.RotateServiceKey("a/sign")
+	require.NoError(t, err)
+	require.True(t, old.Public.Equal(sign.Public))
+	require.False(t, next.Public.Equal(sign.Public))
+	require.Equal(t, sign.Suite, next.Suite)
+	require.Equal(t, sign.Public, cp.ServicePublic("a/sign"))
+	_, _, err = si.RotateServiceKey("b")
+	require.Error(t, err)
+
+	for _, srvid := range si.PublicServiceKeys() {
+		require.Nil(t, srvid.GetPrivate())
+	}
+	require.NotNil(t, si.ServicePrivate("a"))
+
+	require.True(t, si.RemoveServiceKey("a/sign"))
+	require.False(t, si.RemoveServiceKey("a/sign"))
+	srvid, ok := si.ServiceKey("a")
+	require.True(t, ok)
+	require.True(t, srvid.Public.Equal(main.Public))
+	require.Len(t, si.ServiceKeys(), 1)
+}
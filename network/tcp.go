@@ -81,6 +81,9 @@ type TCPConn struct {
 
 	counterSafe
 
+	// duration of the TLS handshake of the connections opened by NewTLSConn
+	handshake time.Duration
+
 	// a hook to let us test dead servers
 	receiveRawTest func() ([]byte, error)
 }
@@ -99,13 +102,13 @@ func NewTCPConn(addr Address, suite Suite) (conn *TCPConn, err error) {
 			}
 			return
 		}
-		err = xerrors.Errorf("dial: %v", err)
+		err = newError(CodePeerUnreachable, "dial", err)
 		if i < MaxRetryConnect {
 			time.Sleep(WaitRetry)
 		}
 	}
 	if err == nil {
-		err = xerrors.Errorf("timeout: %w", ErrTimeout)
+		err = newError(CodeTimeout, "dial", nil)
 	}
 	return
 }
@@ -268,6 +271,11 @@ func (c *TCPConn) Close() error {
 // handleError translates the network-layer error to a set of errors
 // used in our packages.
 func handleError(err error) error {
+	if xerrors.Is(err, ErrHandshakeFailed) {
+		// the certificate of the peer was refused during the handshake,
+		// which runs on the first read or write of the listener side
+		return err
+	}
 	if strings.Contains(err.Error(), "use of closed") || strings.Contains(err.Error(), "broken pipe") {
 		return ErrClosed
 	} else if strings.Contains(err.Error(), "canceled") {
@@ -332,7 +340,8 @@ func NewTCPListener(addr Address, s Suite) (*TCPListener, error) {
 
 // NewTCPListenerWithListenAddr returns a TCPListener. This function binds to the
 // given 'listenAddr'. If it is empty, the function binds globally using
-// the port of 'addr'.
+// the port of 'addr'. The listener inherited from the previous process of an
+// upgraded conode is taken if there is one, see Listen.
 // It returns the listener and an error if one occurred during
 // the binding.
 // A subsequent call to Address() gives the actual listening
@@ -353,7 +362,7 @@ func NewTCPListenerWithListenAddr(addr Address,
 		return nil, xerrors.Errorf("listener: %v", err)
 	}
 	for i := 0; i < MaxRetryConnect; i++ {
-		ln, err := net.Listen("tcp", listenOn)
+		ln, err := Listen(listenOn)
 		if err == nil {
 			t.listener = ln
 			break
@@ -394,6 +403,12 @@ func (t *TCPListener) listen(fn func(Conn)) error {
 	for {
 		conn, err := t.listener.Accept()
 		if err != nil {
+			if xerrors.Is(err, ErrHandedOver) {
+				// the new process accepts the connections until Stop
+				<-t.quit
+				t.quitListener <- true
+				return nil
+			}
 			select {
 			case <-t.quit:
 				t.quitListener <- true
@@ -513,7 +528,9 @@ func NewTCPHost(sid *ServerIdentity, s Suite) (*TCPHost, error) {
 }
 
 // NewTCPHostWithListenAddr returns a new Host using TCP connection based type
-// listening on the given address.
+// listening on the given address. If the port of the address of the
+// ServerIdentity is 0, the listener binds any free port, which replaces it in
+// the address, so that it is advertised to the peers.
 func NewTCPHostWithListenAddr(sid *ServerIdentity, s Suite,
 	listenAddr string) (*TCPHost, error) {
 	h := &TCPHost{
@@ -529,6 +546,15 @@ func NewTCPHostWithListenAddr(sid *ServerIdentity, s Suite,
 	if err != nil {
 		return nil, xerrors.Errorf("tcp host: %v", err)
 	}
+	if sid.Address.Port() == "0" {
+		_, port, err := net.SplitHostPort(h.TCPListener.addr.String())
+		if err != nil {
+			return nil, xerrors.Errorf("bound address: %v", err)
+		}
+		sid.Address = NewAddress(sid.Address.ConnType(),
+			net.JoinHostPort(sid.Address.Host(), port))
+		log.Lvl2("Listening on the free port", port, "of", sid.Address)
+	}
 	return h, nil
 }
 
@@ -539,13 +565,13 @@ func (t *TCPHost) Connect(si *ServerIdentity) (Conn, error) {
 	case PlainTCP:
 		c, err := NewTCPConn(si.Address, t.suite)
 		if err != nil {
-			return nil, xerrors.Errorf("tcp connection: %v", err)
+			return nil, xerrors.Errorf("tcp connection: %w", err)
 		}
 		return c, nil
 	case TLS:
 		c, err := NewTLSConn(t.sid, si, t.suite)
 		if err != nil {
-			return nil, xerrors.Errorf("tcp connection: %v", err)
+			return nil, xerrors.Errorf("tcp connection: %w", err)
 		}
 		return c, nil
 	case InvalidConnType:
@@ -609,6 +609,23 @@ func TestTCPHostClose(t *testing.T) {
 	}
 }
 
+// Test that the port bound by a host of port 0 is in its address
+func TestTCPHostAnyPort(t *testing.T) {
+	si := NewTestServerIdentity(NewTCPAddress("127.0.0.1:0"))
+	h, err := NewTCPHost(si, tSuite)
+	require.NoError(t, err)
+	defer h.Stop()
+	require.NotEqual(t, "0", si.Address.Port())
+	require.Equal(t, si.Address.Port(), h.TCPListener.Address().Port())
+
+	go h.Listen(acceptAndClose)
+	h2, err := NewTestTCPHost(0)
+	require.NoError(t, err)
+	defer h2.Stop()
+	_, err = h2.Connect(si)
+	require.NoError(t, err)
+}
+
 type dummyErr struct {
 	timeout   bool
 	temporary bool
@@ -42,6 +42,38 @@ func TestTLS_bn256(t *testing.T) {
 	testTLS(t, s)
 }
 
+func TestTLS_suites(t *testing.T) {
+	for _, name := range []string{"bn256.g1", "bn256.adapter", "P256"} {
+		testTLS(t, suites.MustFind(name))
+	}
+}
+
+// TestNewTLSConn_WrongKey makes sure a conode with a BLS key must prove it
+// holds the key it is expected to have.
+func TestNewTLSConn_WrongKey(t *testing.T) {
+	s := suites.MustFind("bn256.g2")
+	them, err := NewTestTLSHost(s, 0)
+	require.NoError(t, err)
+	go them.Listen(func(c Conn) {
+		c.Receive()
+		c.Close()
+	})
+	defer them.Stop()
+	us, err := NewTestTLSHost(s, 0)
+	require.NoError(t, err)
+	defer us.Stop()
+
+	c, err := NewTLSConn(us.sid, NewServerIdentity(them.sid.Public,
+		them.TCPListener.Address()), s)
+	require.NoError(t, err)
+	c.Close()
+
+	other := NewServerIdentity(s.Point().Pick(s.RandomStream()), them.TCPListener.Address())
+	_, err = NewTLSConn(us.sid, other, s)
+	require.Error(t, err)
+	require.Equal(t, CodeHandshakeFailed, Code(err))
+}
+
 func testTLS(t *testing.T, s suites.Suite) {
 	r1, err := NewTestRouterTLS(s, 0)
 	require.Nil(t, err, "new tcp router")
@@ -94,6 +126,10 @@ func testTLS(t *testing.T, s suites.Suite) {
 	})
 	require.Nil(t, err, "Could not router.Send")
 	require.NotZero(t, sentLen)
+	peers := r2.PeerLatencies()
+	require.Equal(t, 1, len(peers))
+	require.Equal(t, uint64(1), peers[0].Handshake.Count)
+	require.NotZero(t, peers[0].Handshake.Last)
 
 	<-rcv
 }
@@ -177,9 +213,12 @@ func Test_pubFromCN(t *testing.T) {
 	require.True(t, p2.Equal(p1))
 
 	// new-style
-	cn = pubToCN(p1)
-
-	p2, err = pubFromCN(tSuite, cn)
-	require.NoError(t, err)
-	require.True(t, p2.Equal(p1))
+	for _, name := range []string{"Ed25519", "P256", "bn256.g1", "bn256.g2", "bn256.adapter"} {
+		s := suites.MustFind(name)
+		p1 = s.Point().Pick(s.RandomStream())
+		cn = pubToCN(p1)
+		p2, err = pubFromCN(s, cn)
+		require.NoError(t, err, name)
+		require.True(t, p2.Equal(p1), name)
+	}
 }
@@ -0,0 +1,90 @@
+package network
+
+import (
+	"sort"
+	"sync"
+)
+
+// MessageSizeBounds are the upper bounds, in bytes, of the sizes by which
+// the messages are counted in TypeTraffic.
+var MessageSizeBounds = []uint64{64, 256, 1024, 4096, 16384, 65536, 262144,
+	1048576, 4194304}
+
+// TypeTraffic is the traffic of one type of messages.
+type TypeTraffic struct {
+	// Name of the type, like "onet.ProtocolMsg".
+	Name string
+	// Count is the number of messages.
+	Count uint64
+	// Bytes is the total size of the messages.
+	Bytes uint64
+	// Sizes are the number of messages by size: Sizes[i] counts the ones of
+	// at most MessageSizeBounds[i] bytes and bigger than the previous bound,
+	// and the last one counts the ones bigger than all the bounds.
+	Sizes []uint64
+}
+
+// WrappingMessage is a message carrying another one, like the messages of
+// the protocols. Its traffic is counted with the type of the message it
+// carries.
+type WrappingMessage interface {
+	WrappedType() MessageTypeID
+}
+
+// TypeCounter counts the messages and their sizes by type. The zero value is
+// ready to use.
+type TypeCounter struct {
+	sync.Mutex
+	types map[string]*TypeTraffic
+}
+
+// Record counts a message of the type with the size.
+func (tc *TypeCounter) Record(name string, size uint64) {
+	tc.Lock()
+	defer tc.Unlock()
+	if tc.types == nil {
+		tc.types = make(map[string]*TypeTraffic)
+	}
+	tt, ok := tc.types[name]
+	if !ok {
+		tt = &TypeTraffic{
+			Name:  name,
+			Sizes: make([]uint64, len(MessageSizeBounds)+1),
+		}
+		tc.types[name] = tt
+	}
+	tt.Count++
+	tt.Bytes += size
+	tt.Sizes[sort.Search(len(MessageSizeBounds), func(i int) bool {
+		return size <= MessageSizeBounds[i]
+	})]++
+}
+
+// Traffic returns a copy of the traffic of every type, sorted by name.
+func (tc *TypeCounter) Traffic() []TypeTraffic {
+	tc.Lock()
+	defer tc.Unlock()
+	traffic := make([]TypeTraffic, 0, len(tc.types))
+	for _, tt := range tc.types {
+		cp := *tt
+		cp.Sizes = append([]uint64(nil), tt.Sizes...)
+		traffic = append(traffic, cp)
+	}
+	sort.Slice(traffic, func(i, j int) bool {
+		return traffic[i].Name < traffic[j].Name
+	})
+	return traffic
+}
+
+// trafficName returns the name the traffic of the message is counted with.
+func trafficName(typ MessageTypeID, msg Message) string {
+	if wm, ok := msg.(WrappingMessage); ok {
+		if wt := wm.WrappedType(); !wt.Equal(ErrorType) {
+			typ = wt
+		}
+	}
+	if t, ok := registry.get(typ); ok {
+		return t.String()
+	}
+	return typ.String()
+}
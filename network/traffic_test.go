@@ -0,0 +1,53 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type wrapper struct {
+	Type MessageTypeID
+}
+
+func (w *wrapper) WrappedType() MessageTypeID {
+	return w.Type
+}
+
+func TestTypeCounter(t *testing.T) {
+	var tc TypeCounter
+	require.Empty(t, tc.Traffic())
+
+	tc.Record("b", 10)
+	tc.Record("b", 64)
+	tc.Record("b", 65)
+	tc.Record("b", 10*1024*1024)
+	tc.Record("a", 0)
+
+	traffic := tc.Traffic()
+	require.Equal(t, 2, len(traffic))
+	require.Equal(t, "a", traffic[0].Name)
+	require.Equal(t, uint64(1), traffic[0].Count)
+	b := traffic[1]
+	require.Equal(t, "b", b.Name)
+	require.Equal(t, uint64(4), b.Count)
+	require.Equal(t, uint64(10+64+65+10*1024*1024), b.Bytes)
+	require.Equal(t, len(MessageSizeBounds)+1, len(b.Sizes))
+	require.Equal(t, uint64(2), b.Sizes[0])
+	require.Equal(t, uint64(1), b.Sizes[1])
+	require.Equal(t, uint64(1), b.Sizes[len(MessageSizeBounds)])
+
+	// the copy isn't changed by the next messages
+	tc.Record("b", 10)
+	require.Equal(t, uint64(2), b.Sizes[0])
+}
+
+func TestTrafficName(t *testing.T) {
+	siType := MessageType(&ServerIdentity{})
+	require.Equal(t, "network.ServerIdentity", trafficName(siType, &ServerIdentity{}))
+
+	wt := RegisterMessage(&wrapper{})
+	require.Equal(t, "network.ServerIdentity",
+		trafficName(wt, &wrapper{Type: siType}))
+	require.Equal(t, "network.wrapper", trafficName(wt, &wrapper{}))
+}
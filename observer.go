@@ -0,0 +1,44 @@
+package onet
+
+import (
+	"context"
+	"time"
+
+	"go.dedis.ch/onet/v3/network"
+)
+
+// ClientObserver is notified of every request a Client sends to a conode, so
+// that applications can collect metrics or traces of their calls, see
+// SetObserver. Its methods are called from the goroutine sending the
+// request, and must be safe for concurrent use.
+type ClientObserver interface {
+	// RequestStarted is called before the request is sent. The returned
+	// context is used for the request, e.g., to hold a span.
+	RequestStarted(ctx context.Context, req *ClientRequestInfo) context.Context
+	// RequestDone is called once the reply or an error is received, with
+	// the context returned by RequestStarted.
+	RequestDone(ctx context.Context, req *ClientRequestInfo)
+}
+
+// ClientRequestInfo describes a request sent by a Client to a conode.
+type ClientRequestInfo struct {
+	Service     string
+	Path        string
+	Destination *network.ServerIdentity
+	Start       time.Time
+	// bytes sent and received
+	Tx int
+	Rx int
+	// set by the time RequestDone is called
+	Latency time.Duration
+	Err     error
+}
+
+// SetObserver sets the observer of the requests sent by the client, including
+// every conode tried by a failover or a parallel request. The replies from
+// the cache are not observed. A nil observer removes it.
+func (c *Client) SetObserver(o ClientObserver) {
+	c.Lock()
+	defer c.Unlock()
+	c.observer = o
+}
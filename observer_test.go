@@ -0,0 +1,72 @@
+package onet
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3/network"
+)
+
+type observerKey struct{}
+
+type recordingObserver struct {
+	sync.Mutex
+	started int
+	done    []ClientRequestInfo
+}
+
+func (o *recordingObserver) RequestStarted(ctx context.Context, req *ClientRequestInfo) context.Context {
+	o.Lock()
+	defer o.Unlock()
+	o.started++
+	return context.WithValue(ctx, observerKey{}, req)
+}
+
+func (o *recordingObserver) RequestDone(ctx context.Context, req *ClientRequestInfo) {
+	o.Lock()
+	defer o.Unlock()
+	if ctx.Value(observerKey{}) != req {
+		panic("context of RequestStarted not passed")
+	}
+	o.done = append(o.done, *req)
+}
+
+func TestClient_Observer(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(2, false)
+	dead := network.NewServerIdentity(key.NewKeyPair(tSuite).Public,
+		network.NewTCPAddress("127.0.0.1:1"))
+
+	cl := NewClient(tSuite, serviceWebSocket)
+	obs := &recordingObserver{}
+	cl.SetObserver(obs)
+	require.NoError(t, cl.SendProtobuf(servers[0].ServerIdentity, &SimpleResponse{}, &SimpleResponse{}))
+	require.Error(t, cl.SendProtobuf(servers[1].ServerIdentity,
+		&ErrorRequest{Roster: *roster, Flags: 2}, nil))
+
+	// every conode tried is observed
+	cl.SetFailover(&FailoverPolicy{Nodes: roster.List})
+	require.NoError(t, cl.SendProtobuf(dead, &SimpleResponse{}, &SimpleResponse{}))
+
+	require.Equal(t, 4, obs.started)
+	require.Len(t, obs.done, 4)
+	ok := obs.done[0]
+	require.Equal(t, serviceWebSocket, ok.Service)
+	require.Equal(t, "SimpleResponse", ok.Path)
+	require.True(t, ok.Destination.Equal(servers[0].ServerIdentity))
+	require.NotZero(t, ok.Rx)
+	require.NotZero(t, ok.Latency)
+	require.NoError(t, ok.Err)
+	require.Contains(t, obs.done[1].Err.Error(), "found in flags")
+	require.True(t, obs.done[2].Destination.Equal(dead))
+	require.Error(t, obs.done[2].Err)
+	require.NoError(t, obs.done[3].Err)
+
+	cl.SetObserver(nil)
+	require.NoError(t, cl.SendProtobuf(servers[0].ServerIdentity, &SimpleResponse{}, &SimpleResponse{}))
+	require.Len(t, obs.done, 4)
+}
@@ -0,0 +1,35 @@
+module go.dedis.ch/onet/v3/otel
+
+go 1.21
+
+require (
+	github.com/stretchr/testify v1.8.3
+	go.dedis.ch/kyber/v3 v3.0.12
+	go.dedis.ch/onet/v3 v3.2.10
+	go.opentelemetry.io/otel v1.14.0
+	go.opentelemetry.io/otel/sdk v1.14.0
+	go.opentelemetry.io/otel/trace v1.14.0
+)
+
+require (
+	github.com/BurntSushi/toml v0.3.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/daviddengcn/go-colortext v0.0.0-20180409174941-186a3d44e920 // indirect
+	github.com/go-logr/logr v1.2.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/gorilla/websocket v1.4.0 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.dedis.ch/fixbuf v1.0.3 // indirect
+	go.dedis.ch/protobuf v1.0.11 // indirect
+	go.etcd.io/bbolt v1.3.3 // indirect
+	golang.org/x/crypto v0.32.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
+	gopkg.in/satori/go.uuid.v1 v1.2.0 // indirect
+	gopkg.in/tylerb/graceful.v1 v1.2.15 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+	rsc.io/goversion v1.2.0 // indirect
+)
+
+replace go.dedis.ch/onet/v3 => ../
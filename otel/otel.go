@@ -0,0 +1,63 @@
+// Package otel adapts an OpenTelemetry tracer to the tracing of onet. It is a
+// module of its own, so that onet doesn't depend on OpenTelemetry. A conode
+// exports its traces with:
+//
+//	onet.SetTracer(otel.NewTracer(provider.Tracer("conode")))
+//
+// The trace context is passed between conodes and from the clients in the W3C
+// traceparent format.
+package otel
+
+import (
+	"context"
+
+	"go.dedis.ch/onet/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer implements onet.Tracer with an OpenTelemetry tracer.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TraceContext
+}
+
+// NewTracer returns the onet.Tracer creating its spans with t.
+func NewTracer(t trace.Tracer) *Tracer {
+	return &Tracer{tracer: t}
+}
+
+// StartSpan implements onet.Tracer.
+func (t *Tracer) StartSpan(ctx context.Context, name string) (context.Context, onet.Span) {
+	ctx, s := t.tracer.Start(ctx, name)
+	return ctx, span{s}
+}
+
+// Inject implements onet.Tracer.
+func (t *Tracer) Inject(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	return carrier.Get(onet.TraceParentHeader)
+}
+
+// Extract implements onet.Tracer.
+func (t *Tracer) Extract(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	return t.propagator.Extract(ctx,
+		propagation.MapCarrier{onet.TraceParentHeader: traceparent})
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttribute(key, value string) {
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+func (s span) End() {
+	s.span.End()
+}
@@ -0,0 +1,137 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tSuite = suites.MustFind("Ed25519")
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestTracer(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	tr := NewTracer(provider.Tracer("test"))
+
+	require.Equal(t, "", tr.Inject(context.Background()))
+	require.Equal(t, context.Background(), tr.Extract(context.Background(), ""))
+
+	ctx, s := tr.StartSpan(context.Background(), "client")
+	s.SetAttribute("key", "value")
+	parent := trace.SpanContextFromContext(ctx)
+	tp := tr.Inject(ctx)
+	require.Contains(t, tp, parent.TraceID().String())
+
+	// the remote side continues the trace
+	ctx, child := tr.StartSpan(tr.Extract(context.Background(), tp), "server")
+	require.Equal(t, parent.TraceID(), trace.SpanContextFromContext(ctx).TraceID())
+	child.End()
+	s.End()
+
+	spans := rec.Ended()
+	require.Equal(t, 2, len(spans))
+	require.Equal(t, parent.SpanID(), spans[0].Parent().SpanID())
+	require.Equal(t, "value", spans[1].Attributes()[0].Value.AsString())
+}
+
+// The messages of a protocol started by a client request are part of the
+// trace of the request.
+type pingService struct {
+	*onet.ServiceProcessor
+}
+
+type PingRequest struct {
+	Roster *onet.Roster
+}
+
+type PingReply struct{}
+
+func (s *pingService) Ping(req *PingRequest) (*PingReply, error) {
+	pi, err := s.CreateProtocol(pingProtocol, req.Roster.GenerateBinaryTree())
+	if err != nil {
+		return nil, err
+	}
+	if err := pi.Start(); err != nil {
+		return nil, err
+	}
+	<-pi.(*pingProto).done
+	return &PingReply{}, nil
+}
+
+const pingProtocol = "otelPing"
+
+type PingMsg struct{}
+
+type pingProto struct {
+	*onet.TreeNodeInstance
+	done chan bool
+}
+
+func (p *pingProto) Start() error {
+	return p.SendToChildren(&PingMsg{})
+}
+
+func (p *pingProto) ping(msg struct {
+	*onet.TreeNode
+	PingMsg
+}) error {
+	defer p.Done()
+	if !p.IsRoot() {
+		return p.SendToParent(&PingMsg{})
+	}
+	p.done <- true
+	return nil
+}
+
+func TestTracer_Request(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	onet.SetTracer(NewTracer(provider.Tracer("test")))
+	defer onet.SetTracer(nil)
+
+	_, err := onet.GlobalProtocolRegister(pingProtocol,
+		func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+			p := &pingProto{TreeNodeInstance: n, done: make(chan bool, 1)}
+			return p, p.RegisterHandler(p.ping)
+		})
+	require.NoError(t, err)
+	name := "otelService"
+	_, err = onet.RegisterNewService(name, func(c *onet.Context) (onet.Service, error) {
+		s := &pingService{onet.NewServiceProcessor(c)}
+		return s, s.RegisterHandler(s.Ping)
+	})
+	require.NoError(t, err)
+	defer onet.UnregisterService(name)
+
+	local := onet.NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(2, true)
+	client := local.NewClient(name)
+	defer client.Close()
+	require.NoError(t, client.SendProtobuf(servers[0].ServerIdentity,
+		&PingRequest{roster}, &PingReply{}))
+
+	var request trace.SpanContext
+	names := make(map[string]trace.TraceID)
+	for _, s := range rec.Ended() {
+		names[s.Name()] = s.SpanContext().TraceID()
+		if s.Name() == "onet.client_request" {
+			request = s.SpanContext()
+		}
+	}
+	require.True(t, request.IsValid())
+	require.Equal(t, request.TraceID(), names["onet.service_dispatch"])
+	require.Equal(t, request.TraceID(), names["onet.overlay_send"])
+	require.Equal(t, request.TraceID(), names["onet.overlay_receive"])
+}
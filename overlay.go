@@ -1,6 +1,7 @@
 package onet
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -27,6 +28,9 @@ type Overlay struct {
 	instancesInfo     map[TokenID]bool
 	instancesLock     sync.Mutex
 	protocolInstances map[TokenID]ProtocolInstance
+	// protocolTypes are the names of the protocols by the type of their
+	// instances, to name the owners of the leaks in the tests
+	protocolTypes map[string]string
 
 	// treeMarshal that needs to be converted to Tree but host does not have the
 	// entityList associated yet.
@@ -57,6 +61,7 @@ func NewOverlay(c *Server) *Overlay {
 		treeStorage:        newTreeStorage(globalProtocolTimeout),
 		instances:          make(map[TokenID]*TreeNodeInstance),
 		instancesInfo:      make(map[TokenID]bool),
+		protocolTypes:      make(map[string]string),
 		protocolInstances:  make(map[TokenID]ProtocolInstance),
 		pendingTreeMarshal: make(map[RosterID][]*TreeMarshal),
 		pendingConfigs:     make(map[TokenID]*GenericConfig),
@@ -102,6 +107,12 @@ func (o *Overlay) Process(env *network.Envelope) {
 	case info.Roster != nil:
 		o.handleSendRoster(env.ServerIdentity, info.Roster)
 	default:
+		t := getTracer()
+		ctx := t.Extract(context.Background(), info.TraceParent)
+		ctx, span := t.StartSpan(ctx, "onet.overlay_receive")
+		defer span.End()
+		span.SetAttribute("onet.from", env.ServerIdentity.String())
+
 		typ := network.MessageType(inner)
 		protoMsg := &ProtocolMsg{
 			From:           info.TreeNodeInfo.From,
@@ -110,11 +121,13 @@ func (o *Overlay) Process(env *network.Envelope) {
 			Msg:            inner,
 			MsgType:        typ,
 			Size:           env.Size,
+			TraceParent:    t.Inject(ctx),
 		}
 		err = o.TransmitMsg(protoMsg, io)
 		if err != nil {
 			log.Errorf("Msg %s from %s produced error: %+v", protoMsg.MsgType,
 				protoMsg.ServerIdentity, err)
+			span.SetAttribute("error", err.Error())
 		}
 	}
 }
@@ -155,12 +168,19 @@ func (o *Overlay) TransmitMsg(onetMsg *ProtocolMsg, io MessageProxy) error {
 	}
 	// if the TreeNodeInstance is not there, creates it
 	if !ok {
+		if !o.server.maintenance.allows(ServiceFactory.Name(onetMsg.To.ServiceID)) {
+			return xerrors.Errorf("creating protocol: %w", ErrMaintenance)
+		}
 		log.Lvlf4("Creating TreeNodeInstance at %s %x", o.server.ServerIdentity, onetMsg.To.ID())
 		tn, err := o.TreeNodeFromTree(tree, onetMsg.To.TreeNodeID)
 		if err != nil {
 			return xerrors.New("No TreeNode defined in this tree here")
 		}
 		tni := o.newTreeNodeInstanceFromToken(tn, onetMsg.To, io)
+		if onetMsg.TraceParent != "" {
+			tni.SetTraceContext(getTracer().Extract(context.Background(),
+				onetMsg.TraceParent))
+		}
 		// retrieve the possible generic config for this message
 		config := o.getConfig(onetMsg.To.ID())
 		if config == nil {
@@ -180,24 +200,7 @@ func (o *Overlay) TransmitMsg(onetMsg *ProtocolMsg, io MessageProxy) error {
 		if pi == nil {
 			return nil
 		}
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					svc := ServiceFactory.Name(tni.Token().ServiceID)
-					log.Errorf("Panic in call to protocol <%s>.Dispatch("+
-						") from service <%s> at address %s: %v",
-						tni.ProtocolName(), svc, o.server.ServerIdentity, r)
-					log.Error(log.Stack())
-				}
-			}()
-
-			err := pi.Dispatch()
-			if err != nil {
-				svc := ServiceFactory.Name(tni.Token().ServiceID)
-				log.Errorf("%v %s.Dispatch() returned error %+v",
-					o.server.ServerIdentity, svc, err)
-			}
-		}()
+		go o.dispatch(tni, pi)
 		if err := o.RegisterProtocolInstance(pi); err != nil {
 			return xerrors.New("Error Binding TreeNodeInstance and ProtocolInstance:" +
 				err.Error())
@@ -210,6 +213,31 @@ func (o *Overlay) TransmitMsg(onetMsg *ProtocolMsg, io MessageProxy) error {
 	return nil
 }
 
+// dispatch runs the Dispatch method of a protocol instance created for a
+// message of another conode.
+func (o *Overlay) dispatch(tni *TreeNodeInstance, pi ProtocolInstance) {
+	l := tni.Logger()
+	defer func() {
+		if r := recover(); r != nil {
+			svc := ServiceFactory.Name(tni.Token().ServiceID)
+			l.Errorf("Panic in call to protocol <%s>.Dispatch("+
+				") from service <%s> at address %s: %v",
+				tni.ProtocolName(), svc, o.server.ServerIdentity, r)
+			l.Error(log.Stack())
+			tni.reportPanic("protocol.Dispatch", r)
+		}
+	}()
+
+	err := pi.Dispatch()
+	if err != nil {
+		svc := ServiceFactory.Name(tni.Token().ServiceID)
+		l.Errorf("%v %s.Dispatch() returned error %+v",
+			o.server.ServerIdentity, svc, err)
+		tni.protocolEvent(EventProtocolFailed,
+			xerrors.Errorf("dispatch: %v", err))
+	}
+}
+
 // addPendingTreeMarshal adds a treeMarshal to the list.
 // This list is checked each time we receive a new Roster
 // so trees using this Roster can be constructed.
@@ -318,7 +346,7 @@ func (o *Overlay) requestTree(si *network.ServerIdentity, onetMsg *ProtocolMsg,
 	_, err = o.server.Send(si, msg)
 	if err != nil {
 		o.treeStorage.Unregister(onetMsg.To.TreeID)
-		return xerrors.Errorf("sending tree request: %v", err)
+		return xerrors.Errorf("sending tree request: %w", err)
 	}
 
 	return nil
@@ -555,6 +583,29 @@ func (o *Overlay) getConfig(id TokenID) *GenericConfig {
 // in the `NewProtocol` method if a Service has created the protocol and set the
 // config with `SetConfig`. It can be nil.
 func (o *Overlay) SendToTreeNode(from *Token, to *TreeNode, msg network.Message, io MessageProxy, c *GenericConfig) (uint64, error) {
+	return o.sendToTreeNode(context.Background(), from, to, msg, io, c)
+}
+
+// sendToTreeNode sends a message to a treeNode as part of the span in ctx.
+// An intercepted message is only sent when it is delivered.
+func (o *Overlay) sendToTreeNode(ctx context.Context, from *Token, to *TreeNode,
+	msg network.Message, io MessageProxy, c *GenericConfig) (uint64, error) {
+	if o.server.intercepted(to.ServerIdentity, msg, func(msg network.Message) error {
+		_, err := o.transmitToTreeNode(ctx, from, to, msg, io, c)
+		return err
+	}) {
+		return 0, nil
+	}
+	return o.transmitToTreeNode(ctx, from, to, msg, io, c)
+}
+
+// transmitToTreeNode is sendToTreeNode without the interceptors.
+func (o *Overlay) transmitToTreeNode(ctx context.Context, from *Token, to *TreeNode,
+	msg network.Message, io MessageProxy, c *GenericConfig) (uint64, error) {
+	ctx, span := getTracer().StartSpan(ctx, "onet.overlay_send")
+	defer span.End()
+	span.SetAttribute("onet.protocol", o.server.protocols.ProtocolIDToName(from.ProtoID))
+	span.SetAttribute("onet.to", to.ServerIdentity.String())
 	tokenTo := from.ChangeTreeNodeID(to.ID)
 
 	// first send the config if present
@@ -572,6 +623,7 @@ func (o *Overlay) SendToTreeNode(from *Token, to *TreeNode, msg network.Message,
 			From: from,
 			To:   tokenTo,
 		},
+		TraceParent: getTracer().Inject(ctx),
 	}
 	final, err := io.Wrap(msg, info)
 	if err != nil {
@@ -585,7 +637,7 @@ func (o *Overlay) SendToTreeNode(from *Token, to *TreeNode, msg network.Message,
 		sentLen, err = o.server.Send(to.ServerIdentity, final)
 	}
 	if err != nil {
-		err = xerrors.Errorf("sending: %v", err)
+		err = xerrors.Errorf("sending: %w", err)
 	}
 	return sentLen, err
 }
@@ -614,6 +666,7 @@ func (o *Overlay) nodeDelete(token *Token) {
 	}
 	delete(o.protocolInstances, tok)
 	delete(o.instances, tok)
+	tni.protocolEvent(EventProtocolFinished, nil)
 
 	o.cleanTreeStorage(token)
 
@@ -642,17 +695,29 @@ func (o *Overlay) suite() network.Suite {
 	return o.server.Suite()
 }
 
+// instancesCount returns the number of running protocol instances.
+func (o *Overlay) instancesCount() int {
+	o.instancesLock.Lock()
+	defer o.instancesLock.Unlock()
+	return len(o.instances)
+}
+
 // Close calls all nodes, deletes them from the list and closes them
 func (o *Overlay) Close() {
+	o.closeInstances()
+
+	// force cleaning routines to shutdown
+	o.treeStorage.Close()
+}
+
+// closeInstances closes all nodes and deletes them from the list.
+func (o *Overlay) closeInstances() {
 	o.instancesLock.Lock()
 	defer o.instancesLock.Unlock()
 	for _, tni := range o.instances {
 		log.Lvl4(o.server.Address(), "Closing TNI", tni.TokenID())
 		o.nodeDelete(tni.Token())
 	}
-
-	// force cleaning routines to shutdown
-	o.treeStorage.Close()
 }
 
 // CreateProtocol creates a ProtocolInstance, registers it to the Overlay.
@@ -660,8 +725,20 @@ func (o *Overlay) Close() {
 // so the protocol will be picked up by the correct service and handled by its
 // NewProtocol method. If the sid is NilServiceID, then the protocol is handled by onet alone.
 func (o *Overlay) CreateProtocol(name string, t *Tree, sid ServiceID) (ProtocolInstance, error) {
+	return o.createProtocol(nil, name, t, sid)
+}
+
+// createProtocol is CreateProtocol with the trace context of the new node,
+// which can be nil.
+func (o *Overlay) createProtocol(ctx context.Context, name string, t *Tree, sid ServiceID) (ProtocolInstance, error) {
+	if !o.server.maintenance.allows(ServiceFactory.Name(sid)) {
+		return nil, xerrors.Errorf("creating protocol: %w", ErrMaintenance)
+	}
 	io := o.protoIO.getByName(name)
 	tni := o.NewTreeNodeInstanceFromService(t, t.Root, ProtocolNameToID(name), sid, io)
+	if ctx != nil {
+		tni.SetTraceContext(ctx)
+	}
 	pi, err := o.server.protocolInstantiate(tni.token.ProtoID, tni)
 	if err != nil {
 		return nil, xerrors.Errorf("instantiating protocol: %v", err)
@@ -670,17 +747,21 @@ func (o *Overlay) CreateProtocol(name string, t *Tree, sid ServiceID) (ProtocolI
 		return nil, xerrors.Errorf("registering protocol instance: %v", err)
 	}
 	go func() {
+		l := tni.Logger()
 		defer func() {
 			if r := recover(); r != nil {
-				log.Errorf("Panic in %s.Dispatch(): %v", name, r)
-				log.Error(log.Stack())
+				l.Errorf("Panic in %s.Dispatch(): %v", name, r)
+				l.Error(log.Stack())
+				tni.reportPanic("protocol.Dispatch", r)
 			}
 		}()
 
 		err := pi.Dispatch()
 		if err != nil {
-			log.Errorf("%s.Dispatch() created in service %s returned error %s",
+			l.Errorf("%s.Dispatch() created in service %s returned error %s",
 				name, ServiceFactory.Name(sid), err)
+			tni.protocolEvent(EventProtocolFailed,
+				xerrors.Errorf("dispatch: %v", err))
 		}
 	}()
 	return pi, err
@@ -693,21 +774,35 @@ func (o *Overlay) StartProtocol(name string, t *Tree, sid ServiceID) (ProtocolIn
 		return nil, xerrors.Errorf("creating protocol: %v", err)
 	}
 	go func() {
+		l := log.WithFields(logFields(name, pi.Token())...)
 		defer func() {
 			if r := recover(); r != nil {
-				log.Errorf("Panic in %s.Start(): %v", name, r)
-				log.Error(log.Stack())
+				l.Errorf("Panic in %s.Start(): %v", name, r)
+				l.Error(log.Stack())
+				o.reportPanic("protocol.Start", pi.Token(), r)
 			}
 		}()
 
 		err := pi.Start()
 		if err != nil {
-			log.Error("Error while starting:", err)
+			l.Error("Error while starting:", err)
+			o.protocolEvent(EventProtocolFailed, pi.Token(),
+				xerrors.Errorf("start: %v", err))
 		}
 	}()
 	return pi, nil
 }
 
+// protocolName returns the name of the protocol, registered globally or in
+// the server.
+func (o *Overlay) protocolName(id ProtocolID) string {
+	name := protocols.ProtocolIDToName(id)
+	if name == "" {
+		name = o.server.protocols.ProtocolIDToName(id)
+	}
+	return name
+}
+
 // NewTreeNodeInstanceFromProtoName takes a protocol name and a tree and
 // instantiate a TreeNodeInstance for this protocol.
 func (o *Overlay) NewTreeNodeInstanceFromProtoName(t *Tree, name string) *TreeNodeInstance {
@@ -788,6 +883,8 @@ func (o *Overlay) RegisterProtocolInstance(pi ProtocolInstance) error {
 
 	tni.bind(pi)
 	o.protocolInstances[tok.ID()] = pi
+	o.protocolTypes[typeMethodPrefix(pi)] = tni.ProtocolName()
+	tni.protocolEvent(EventProtocolStarted, nil)
 	log.Lvlf4("%s registered ProtocolInstance %x", o.server.Address(), tok.ID())
 	return nil
 }
@@ -821,11 +918,12 @@ func (d *defaultProtoIO) Wrap(msg interface{}, info *OverlayMsg) (interface{}, e
 		}
 		typ := network.MessageType(msg)
 		protoMsg := &ProtocolMsg{
-			From:     info.TreeNodeInfo.From,
-			To:       info.TreeNodeInfo.To,
-			Config:   info.Config,
-			MsgSlice: buff,
-			MsgType:  typ,
+			From:        info.TreeNodeInfo.From,
+			To:          info.TreeNodeInfo.To,
+			Config:      info.Config,
+			MsgSlice:    buff,
+			MsgType:     typ,
+			TraceParent: info.TraceParent,
 		}
 		return protoMsg, nil
 	}
@@ -866,6 +964,7 @@ func (d *defaultProtoIO) Unwrap(msg interface{}) (interface{}, *OverlayMsg, erro
 			To:   onetMsg.To,
 			From: onetMsg.From,
 		}
+		returnOverlay.TraceParent = onetMsg.TraceParent
 		returnMsg = protoMsg
 	case *RequestTree:
 		returnOverlay.RequestTree = inner
@@ -0,0 +1,277 @@
+// Package plugin lets a conode host services that are implemented as
+// separate binaries. A plugin is started by the conode at startup with
+// hashicorp/go-plugin, and is then called over gRPC for every client request
+// addressed to its service. This allows to release services independently
+// from the conode binary.
+//
+// The gRPC service is defined in proto/plugin.proto, so a plugin can be
+// written in any language supported by go-plugin: it has to implement the
+// onet.plugin.Plugin service and follow the go-plugin handshake with
+// ProtocolVersion and the magic cookie below.
+//
+// A plugin binary written in Go only needs to implement the Handler
+// interface and call Serve from its main function:
+//
+//	func main() {
+//		if err := plugin.Serve(myHandler{}); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// On the conode side, LoadDir registers one service for every executable
+// found in the plugins directory, named after the file.
+package plugin
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/plugin/proto"
+	"golang.org/x/xerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProtocolVersion is the application protocol version of the go-plugin
+// handshake between the conode and its plugins. A plugin announcing another
+// version is refused.
+const ProtocolVersion = 3
+
+// MagicCookieKey and MagicCookieValue are set in the environment of every
+// plugin started by the conode. They are not a security measure, but make
+// sure a plugin binary doesn't start serving when launched by hand.
+const (
+	MagicCookieKey   = "ONET_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue = "9ea4c1b3d4f45f2e7a1b0c6e5d3a8f71"
+)
+
+// StartTimeout is the time given to a plugin to announce its endpoint.
+var StartTimeout = 10 * time.Second
+
+// CallTimeout is the maximum time a plugin has to answer a request.
+var CallTimeout = time.Minute
+
+// pluginName is the name under which the plugins are dispensed by go-plugin.
+const pluginName = "service"
+
+var handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  ProtocolVersion,
+	MagicCookieKey:   MagicCookieKey,
+	MagicCookieValue: MagicCookieValue,
+}
+
+// Handler is the interface a plugin binary implements. It has the same
+// semantics as the non-streaming part of onet.Service.ProcessClientRequest.
+type Handler interface {
+	ProcessClientRequest(handler string, msg []byte) ([]byte, error)
+}
+
+// grpcPlugin is the go-plugin definition of a plugin. Only the side of the
+// plugin binary has a Handler.
+type grpcPlugin struct {
+	goplugin.NetRPCUnsupportedPlugin
+	h Handler
+}
+
+// GRPCServer implements goplugin.GRPCPlugin.
+func (p *grpcPlugin) GRPCServer(b *goplugin.GRPCBroker, s *grpc.Server) error {
+	proto.RegisterPluginServer(s, &grpcServer{h: p.h})
+	return nil
+}
+
+// GRPCClient implements goplugin.GRPCPlugin.
+func (p *grpcPlugin) GRPCClient(ctx context.Context, b *goplugin.GRPCBroker,
+	c *grpc.ClientConn) (interface{}, error) {
+	return proto.NewPluginClient(c), nil
+}
+
+// grpcServer exposes a Handler through gRPC.
+type grpcServer struct {
+	proto.UnimplementedPluginServer
+	h Handler
+}
+
+// ProcessClientRequest is the gRPC method called by the conode.
+func (s *grpcServer) ProcessClientRequest(ctx context.Context,
+	req *proto.Request) (*proto.Response, error) {
+	reply, err := s.h.ProcessClientRequest(req.Handler, req.Msg)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.Response{Reply: reply}, nil
+}
+
+// Serve is called from the main function of a plugin binary. It serves
+// requests until the conode stops the plugin.
+func Serve(h Handler) error {
+	// go-plugin exits the process without a cookie, return an error instead
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return xerrors.New("this binary is an onet plugin and is meant to " +
+			"be started by a conode")
+	}
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: handshake,
+		Plugins:         goplugin.PluginSet{pluginName: &grpcPlugin{h: h}},
+		GRPCServer:      goplugin.DefaultGRPCServer,
+	})
+	return nil
+}
+
+// LoadDir registers a service for every executable file in dir. The name of
+// the service is the name of the file without its extension. It returns the
+// names of the registered services. It must be called before the server is
+// created, as services are instantiated at that moment. If a plugin can't be
+// registered, none of the plugins of dir are.
+func LoadDir(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("reading plugin directory: %v", err)
+	}
+	var names []string
+	for _, f := range files {
+		if f.IsDir() || f.Mode()&0111 == 0 {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
+		_, err := Register(name, filepath.Join(dir, f.Name()))
+		if err != nil {
+			for _, n := range names {
+				if err := onet.UnregisterService(n); err != nil {
+					log.Error("Couldn't unregister plugin", n, ":", err)
+				}
+			}
+			return nil, xerrors.Errorf("registering plugin %s: %v", name, err)
+		}
+		log.Lvl2("Registered plugin service", name)
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Register registers a service with the given name that is implemented by
+// the binary at path, started with the given arguments.
+func Register(name, path string, args ...string) (onet.ServiceID, error) {
+	id, err := onet.RegisterNewService(name, func(c *onet.Context) (onet.Service, error) {
+		return newService(c, name, path, args...)
+	})
+	if err != nil {
+		return id, xerrors.Errorf("registering service: %v", err)
+	}
+	return id, nil
+}
+
+// service is the conode-side proxy of a plugin.
+type service struct {
+	*onet.ServiceProcessor
+	name   string
+	dir    string
+	client *goplugin.Client
+	plugin proto.PluginClient
+	closed sync.Once
+}
+
+// newService starts the plugin binary and connects to it.
+func newService(c *onet.Context, name, path string, args ...string) (*service, error) {
+	s := &service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+		name:             name,
+	}
+	// only the user of the conode can enter the directory of the socket, so
+	// no other local process can call the plugin
+	var err error
+	s.dir, err = ioutil.TempDir("", "onet-plugin-")
+	if err != nil {
+		return nil, xerrors.Errorf("socket directory: %v", err)
+	}
+	if err := os.Chmod(s.dir, 0700); err != nil {
+		os.RemoveAll(s.dir)
+		return nil, xerrors.Errorf("socket directory: %v", err)
+	}
+	cmd := exec.Command(path, args...)
+	s.client = goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig:  handshake,
+		Plugins:          goplugin.PluginSet{pluginName: &grpcPlugin{}},
+		Cmd:              cmd,
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolGRPC},
+		StartTimeout:     StartTimeout,
+		UnixSocketConfig: &goplugin.UnixSocketConfig{TempDir: s.dir},
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:   "plugin." + name,
+			Output: logWriter{},
+			Level:  hclog.Info,
+		}),
+	})
+	rpc, err := s.client.Client()
+	if err != nil {
+		s.Close()
+		return nil, xerrors.Errorf("starting plugin: %v", err)
+	}
+	raw, err := rpc.Dispense(pluginName)
+	if err != nil {
+		s.Close()
+		return nil, xerrors.Errorf("connecting to plugin: %v", err)
+	}
+	s.plugin = raw.(proto.PluginClient)
+	return s, nil
+}
+
+// logWriter forwards the log of go-plugin and of the plugins to the log of
+// the conode.
+type logWriter struct{}
+
+func (logWriter) Write(b []byte) (int, error) {
+	log.Lvl2(strings.TrimSpace(string(b)))
+	return len(b), nil
+}
+
+// ProcessClientRequest forwards the request to the plugin. It gives up after
+// CallTimeout, or when the client goes away.
+func (s *service) ProcessClientRequest(req *http.Request, handler string,
+	msg []byte) ([]byte, *onet.StreamingTunnel, error) {
+	ctx := context.Background()
+	if req != nil {
+		ctx = req.Context()
+	}
+	ctx, cancel := context.WithTimeout(ctx, CallTimeout)
+	defer cancel()
+	resp, err := s.plugin.ProcessClientRequest(ctx,
+		&proto.Request{Handler: handler, Msg: msg})
+	if err != nil {
+		if status.Code(err) == codes.DeadlineExceeded {
+			return nil, nil, xerrors.Errorf("plugin %s: no reply after %v", s.name, CallTimeout)
+		}
+		return nil, nil, xerrors.Errorf("plugin %s: %v", s.name, status.Convert(err).Message())
+	}
+	return resp.Reply, nil, nil
+}
+
+// IsStreaming implements onet.BidirectionalStreamer. Plugins don't support
+// streaming handlers, so every request is forwarded to ProcessClientRequest.
+func (s *service) IsStreaming(path string) (bool, error) {
+	return false, nil
+}
+
+// Close stops the plugin and waits for it to exit.
+func (s *service) Close() {
+	s.closed.Do(func() {
+		s.client.Kill()
+		os.RemoveAll(s.dir)
+	})
+}
+
+// TestClose implements onet.TestClose and stops the plugin.
+func (s *service) TestClose() {
+	s.Close()
+}
@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+var tSuite = suites.MustFind("Ed25519")
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+type echoHandler struct{}
+
+func (echoHandler) ProcessClientRequest(handler string, msg []byte) ([]byte, error) {
+	if handler == "Sleep" {
+		time.Sleep(time.Second)
+		return nil, nil
+	}
+	if handler != "Echo" {
+		return nil, xerrors.New("unknown handler " + handler)
+	}
+	return msg, nil
+}
+
+// TestHelperPlugin is not a real test: it is started by the other tests as
+// the plugin binary.
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return
+	}
+	if err := Serve(echoHandler{}); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestServe_NoCookie(t *testing.T) {
+	require.Error(t, Serve(echoHandler{}))
+}
+
+func TestPlugin_ProcessClientRequest(t *testing.T) {
+	name := "testPluginEcho"
+	sid, err := Register(name, os.Args[0], "-test.run=^TestHelperPlugin$")
+	require.NoError(t, err)
+	defer onet.UnregisterService(name)
+
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(1)
+	s := local.GetServices(servers, sid)[0].(*service)
+
+	reply, _, err := s.ProcessClientRequest(nil, "Echo", []byte("ping"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("ping"), reply)
+
+	_, _, err = s.ProcessClientRequest(nil, "Unknown", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown handler")
+
+	// only the user of the conode can reach the socket
+	fi, err := os.Stat(s.dir)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+
+	defer func(d time.Duration) { CallTimeout = d }(CallTimeout)
+	CallTimeout = 100 * time.Millisecond
+	_, _, err = s.ProcessClientRequest(nil, "Sleep", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no reply")
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "readme.txt"), nil, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "testPluginDir.sh"),
+		[]byte("#!/bin/sh\n"), 0755))
+
+	names, err := LoadDir(dir)
+	require.NoError(t, err)
+	defer onet.UnregisterService("testPluginDir")
+	require.Equal(t, []string{"testPluginDir"}, names)
+
+	_, err = LoadDir(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+
+	// testPluginDir is already registered, so testPluginA must be removed
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "testPluginA.sh"),
+		[]byte("#!/bin/sh\n"), 0755))
+	_, err = LoadDir(dir)
+	require.Error(t, err)
+	require.True(t, onet.ServiceFactory.ServiceID("testPluginA").IsNil())
+}
@@ -0,0 +1,5 @@
+// Package proto holds the gRPC protocol spoken between a conode and its
+// plugins, generated from plugin.proto.
+package proto
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative plugin.proto
@@ -1,6 +1,7 @@
 package onet
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
@@ -25,6 +27,9 @@ import (
 // with RegisterMessage.
 type ServiceProcessor struct {
 	handlers map[string]serviceHandler
+	rules    handlerRules
+	// signed requests accepted during the validity window
+	seen seenRequests
 	*Context
 }
 
@@ -44,6 +49,7 @@ func NewServiceProcessor(c *Context) *ServiceProcessor {
 }
 
 var errType = reflect.TypeOf((*error)(nil)).Elem()
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 
 // RegisterHandler will store the given handler that will be used by the service.
 // WebSocket will then forward requests to "ws://service_name/struct_name"
@@ -54,6 +60,11 @@ var errType = reflect.TypeOf((*error)(nil)).Elem()
 //  * ret is a pointer to a struct of the return-message.
 //  * err is an error, it can be nil, or any type that implements error.
 //
+// The function can also take a context.Context as first argument:
+// func(ctx context.Context, msg interface{})(ret interface{}, err error)
+// The context is cancelled when the client closes the connection, or when
+// the timeout given by the client expires.
+//
 // struct_name is stripped of its package-name, so a structure like
 // network.Body will be converted to Body.
 func (p *ServiceProcessor) RegisterHandler(f interface{}) error {
@@ -123,7 +134,7 @@ func (p *ServiceProcessor) RegisterStreamingHandler(f interface{}) error {
 			ft.Out(2).String())
 	}
 
-	cr := ft.In(0)
+	cr := msgArgType(ft)
 	log.Lvl4("Registering streaming handler", cr.String())
 	pm := strings.Split(cr.Elem().String(), ".")[1]
 	p.handlers[pm] = serviceHandler{f, cr.Elem(), true}
@@ -150,7 +161,7 @@ const (
 // it does then make sure the number of fields is either 0 or 1; if there is 1
 // field then it has to be an int or a slice of bytes.
 func prepareHandlerGET(f interface{}) (kindGET, string, error) {
-	in0 := reflect.TypeOf(f).In(0).Elem()
+	in0 := msgArgType(reflect.TypeOf(f)).Elem()
 	if in0.Kind() != reflect.Struct {
 		return invalidGET, "", xerrors.New("input argument must be a struct")
 	}
@@ -168,6 +179,46 @@ func prepareHandlerGET(f interface{}) (kindGET, string, error) {
 	return invalidGET, "", xerrors.New("number of fields must be 0 or 1")
 }
 
+// statusWriter remembers the status of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// auditREST wraps the REST handler h so that its requests are written to the
+// audit log of the server, if there is one.
+func (p *ServiceProcessor) auditREST(service, resource string, h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := p.server.WebSocket.auditLog()
+		if a == nil {
+			h(w, r)
+			return
+		}
+		rec := &AuditRecord{
+			Time:    time.Now(),
+			Remote:  r.RemoteAddr,
+			Service: service,
+			Message: resource,
+		}
+		ctx := context.WithValue(r.Context(), auditKey{}, rec)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h(sw, r.WithContext(ctx))
+		var err error
+		switch {
+		case sw.status == http.StatusUnauthorized:
+			err = ErrUnauthorized
+		case sw.status >= http.StatusBadRequest:
+			err = xerrors.Errorf("%d %s", sw.status, http.StatusText(sw.status))
+		}
+		a.logRequest(ctx, rec, err)
+	})
+}
+
 // RegisterRESTHandler takes a callback of type
 // func(msg interface{})(ret interface{}, err error),
 // where msg and ret must be pointers to structs.
@@ -224,12 +275,33 @@ func (p *ServiceProcessor) RegisterRESTHandler(f interface{}, namespace, method
 		return xerrors.Errorf("regex: %v", err)
 	}
 	val0 := reflect.New(sh.msgType)
+	serviceName := ServiceFactory.Name(p.ServiceID())
 
 	h := func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != method {
 			http.Error(w, wrapJSONMsg("unsupported method: "+r.Method), http.StatusMethodNotAllowed)
 			return
 		}
+		if err := p.server.maintenance.begin(serviceName); err != nil {
+			http.Error(w, wrapJSONMsg(err.Error()), http.StatusServiceUnavailable)
+			return
+		}
+		defer p.server.maintenance.end()
+		if p.rules.get(resource) != nil {
+			// only a capability can be given over the REST API
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			capa, err := ParseCapability(token)
+			if err == nil {
+				err = p.server.verifyCapability(capa, serviceName, resource)
+			}
+			if err != nil {
+				http.Error(w, wrapJSONMsg("handler needs a signed request or a capability"), http.StatusUnauthorized)
+				return
+			}
+			if rec := auditRecord(r.Context()); rec != nil {
+				rec.Identities = []string{capa.ID()}
+			}
+		}
 		var msgBuf []byte
 		switch r.Method {
 		case "GET":
@@ -284,7 +356,8 @@ func (p *ServiceProcessor) RegisterRESTHandler(f interface{}, namespace, method
 			return
 		}
 
-		out, tun, err := callInterfaceFunc(f, val0.Interface(), false)
+		out, tun, err := callInterfaceFunc(r.Context(), f, val0.Interface(), false)
+		p.server.crashes.reportRequestPanic(serviceName, resource, nil, err)
 		if err != nil {
 			http.Error(w, wrapJSONMsg("processing error "+err.Error()),
 				http.StatusBadRequest)
@@ -306,8 +379,10 @@ func (p *ServiceProcessor) RegisterRESTHandler(f interface{}, namespace, method
 	if k == intGET || k == sliceGET {
 		finalSlash = "/"
 	}
+	cors := p.server.WebSocket.corsFor(serviceName)
 	for v := minVersion; v <= maxVersion; v++ {
-		p.getRouter().HandleFunc(fmt.Sprintf("/v%d/%s/%s", v, namespace, resource)+finalSlash, h)
+		p.getRouter().Handle(fmt.Sprintf("/v%d/%s/%s", v, namespace, resource)+finalSlash,
+			cors.handler(p.auditREST(serviceName, resource, h)))
 	}
 	return nil
 }
@@ -340,7 +415,7 @@ func createServiceHandler(f interface{}) (string, serviceHandler, error) {
 			xerrors.New("2nd return value has to implement error, but is: " + ft.Out(1).String())
 	}
 
-	cr := ft.In(0)
+	cr := msgArgType(ft)
 	log.Lvl4("Registering handler", cr.String())
 	pm := strings.Split(cr.Elem().String(), ".")[1]
 
@@ -352,10 +427,14 @@ func handlerInputCheck(f interface{}) error {
 	if ft.Kind() != reflect.Func {
 		return xerrors.New("Input is not a function")
 	}
-	if ft.NumIn() != 1 {
-		return xerrors.New("Need one argument: *struct")
+	switch {
+	case ft.NumIn() == 1:
+	case ft.NumIn() == 2 && ft.In(0) == contextType:
+	default:
+		return xerrors.New("Need one argument: *struct, " +
+			"optionally preceded by a context.Context")
 	}
-	cr := ft.In(0)
+	cr := msgArgType(ft)
 	if cr.Kind() != reflect.Ptr {
 		return xerrors.New("Argument must be a *pointer* to a struct")
 	}
@@ -365,6 +444,21 @@ func handlerInputCheck(f interface{}) error {
 	return nil
 }
 
+// msgArgType returns the type of the message argument of a handler, which is
+// its last argument.
+func msgArgType(ft reflect.Type) reflect.Type {
+	return ft.In(ft.NumIn() - 1)
+}
+
+// requestContext returns the context of the request, or an empty context if
+// there is no request.
+func requestContext(req *http.Request) context.Context {
+	if req == nil {
+		return context.Background()
+	}
+	return req.Context()
+}
+
 // RegisterHandlers takes a vararg of messages to register and returns
 // the first error encountered or nil if everything was OK.
 func (p *ServiceProcessor) RegisterHandlers(procs ...interface{}) error {
@@ -409,20 +503,27 @@ type StreamingTunnel struct {
 	close chan bool
 }
 
-func callInterfaceFunc(handler, input interface{}, streaming bool) (intf interface{}, ch chan bool, err error) {
+func callInterfaceFunc(ctx context.Context, handler, input interface{},
+	streaming bool) (intf interface{}, ch chan bool, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Errorf("Panicked with '%v' at %s", r, log.Stack())
-			err = xerrors.Errorf("panic: %v", r)
+			stack := log.Stack()
+			log.Errorf("Panicked with '%v' at %s", r, stack)
+			err = &panicError{value: r, stack: stack}
 		}
 	}()
 
-	to := reflect.TypeOf(handler).In(0)
+	ft := reflect.TypeOf(handler)
+	to := msgArgType(ft)
 	f := reflect.ValueOf(handler)
 
 	arg := reflect.New(to.Elem())
 	arg.Elem().Set(reflect.ValueOf(input).Elem())
-	ret := f.Call([]reflect.Value{arg})
+	args := []reflect.Value{arg}
+	if ft.NumIn() == 2 {
+		args = []reflect.Value{reflect.ValueOf(ctx), arg}
+	}
+	ret := f.Call(args)
 
 	if streaming {
 		ierr := ret[2].Interface()
@@ -454,6 +555,7 @@ func callInterfaceFunc(handler, input interface{}, streaming bool) (intf interfa
 func (p *ServiceProcessor) ProcessClientStreamRequest(req *http.Request, path string,
 	clientInputs chan []byte) (chan []byte, error) {
 
+	ctx := requestContext(req)
 	outChan := make(chan []byte, 100)
 	var closeOutOnce sync.Once
 	mh, ok := p.handlers[path]
@@ -482,16 +584,8 @@ func (p *ServiceProcessor) ProcessClientStreamRequest(req *http.Request, path st
 					return
 				}
 
-				msg := reflect.New(mh.msgType).Interface()
-
-				err := protobuf.DecodeWithConstructors(buf, msg,
-					network.DefaultConstructors(p.Context.server.Suite()))
-				if err != nil {
-					log.Error(xerrors.Errorf("failed to decode message: %v", err))
-					return
-				}
-
-				reply, stopServiceChan, err = callInterfaceFunc(mh.handler, msg, mh.streaming)
+				var err error
+				reply, stopServiceChan, err = p.dispatchStream(ctx, mh, path, buf)
 				if err != nil {
 					log.Error(err)
 					if stopServiceChan != nil {
@@ -527,7 +621,7 @@ func (p *ServiceProcessor) ProcessClientStreamRequest(req *http.Request, path st
 						}
 						if chosen == 0 {
 							// Send information down to the client.
-							buf, err = protobuf.Encode(v.Interface())
+							buf, err := protobuf.Encode(v.Interface())
 							if err != nil {
 								log.Error(err)
 								return
@@ -550,6 +644,35 @@ func (p *ServiceProcessor) ProcessClientStreamRequest(req *http.Request, path st
 	return outChan, nil
 }
 
+// dispatchStream passes a message of a streaming request to the handler.
+func (p *ServiceProcessor) dispatchStream(ctx context.Context, mh serviceHandler,
+	path string, buf []byte) (reply interface{}, stop chan bool, err error) {
+	ctx, audit := auditStreamMessage(ctx)
+	defer func() { audit(err) }()
+	ctx, span := getTracer().StartSpan(ctx, "onet.service_dispatch")
+	span.SetAttribute("onet.handler", path)
+	defer span.End()
+	defer p.traces.add(ctx)()
+
+	buf, err = p.authorize(ctx, path, buf)
+	if err != nil {
+		span.SetAttribute("error", err.Error())
+		return nil, nil, err
+	}
+	msg := reflect.New(mh.msgType).Interface()
+	err = protobuf.DecodeWithConstructors(buf, msg,
+		network.DefaultConstructors(p.Context.server.Suite()))
+	if err != nil {
+		span.SetAttribute("error", err.Error())
+		return nil, nil, xerrors.Errorf("failed to decode message: %v", err)
+	}
+	reply, stop, err = callInterfaceFunc(ctx, mh.handler, msg, mh.streaming)
+	if err != nil {
+		span.SetAttribute("error", err.Error())
+	}
+	return reply, stop, err
+}
+
 // IsStreaming tell if the service registered at the given path is a streaming
 // service or not. Return an error if the service is not registered.
 func (p *ServiceProcessor) IsStreaming(path string) (bool, error) {
@@ -572,20 +695,34 @@ func (p *ServiceProcessor) ProcessClientRequest(req *http.Request, path string,
 			"ProcessClientRequest: Please use instead ProcessClientStreamRequest")
 	}
 
+	ctx, span := getTracer().StartSpan(requestContext(req), "onet.service_dispatch")
+	span.SetAttribute("onet.handler", path)
+	defer span.End()
+	defer p.traces.add(ctx)()
+
 	reply, _, err := func() (interface{}, chan bool, error) {
 		if !ok {
 			err := xerrors.New("The requested message hasn't been registered: " + path)
 			log.Error(err)
 			return nil, nil, err
 		}
+		ctx, err := p.verifySignature(ctx, path, buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		buf, err = p.authorize(ctx, path, buf)
+		if err != nil {
+			return nil, nil, err
+		}
 		msg := reflect.New(mh.msgType).Interface()
 		if err := protobuf.DecodeWithConstructors(buf, msg,
 			network.DefaultConstructors(p.Context.server.Suite())); err != nil {
 			return nil, nil, xerrors.Errorf("decoding: %v", err)
 		}
-		return callInterfaceFunc(mh.handler, msg, mh.streaming)
+		return callInterfaceFunc(ctx, mh.handler, msg, mh.streaming)
 	}()
 	if err != nil {
+		span.SetAttribute("error", err.Error())
 		return nil, nil, err
 	}
 
@@ -2,6 +2,7 @@ package onet
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -42,6 +43,8 @@ func TestProcessor_AddMessage(t *testing.T) {
 	if len(p.handlers) != 1 {
 		require.Fail(t, "Should have registered one function")
 	}
+	require.Nil(t, p.RegisterHandler(procMsgContext))
+	require.Equal(t, reflect.TypeOf(testMsg2{}), p.handlers["testMsg2"].msgType)
 	mt := network.MessageType(&testMsg{})
 	if mt.Equal(network.ErrorType) {
 		require.Fail(t, "Didn't register message-type correctly")
@@ -53,6 +56,7 @@ func TestProcessor_AddMessage(t *testing.T) {
 		procMsgWrong4,
 		procMsgWrong5,
 		procMsgWrong6,
+		procMsgWrong7,
 	}
 	for _, f := range wrongFunctions {
 		fsig := reflect.TypeOf(f).String()
@@ -370,6 +374,10 @@ func procMsg4(msg *testMsg4) (*testMsg4, error) {
 	return msg, nil
 }
 
+func procMsgContext(ctx context.Context, msg *testMsg2) (network.Message, error) {
+	return nil, ctx.Err()
+}
+
 func procMsgWrong1() (network.Message, error) {
 	return nil, nil
 }
@@ -394,6 +402,10 @@ func procMsgWrong6(msg *testMsg) (testMsg, error) {
 	return *msg, nil
 }
 
+func procMsgWrong7(msg *testMsg, ctx context.Context) (network.Message, error) {
+	return nil, nil
+}
+
 type testService struct {
 	*ServiceProcessor
 	Msg interface{}
@@ -0,0 +1,381 @@
+package onet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// PublicAddressConfig makes the conode check, when it starts, that its
+// address is the one where it is reached, as the address of a conode behind a
+// NAT is easily wrong. The public IP of the conode is asked to STUN servers
+// and to other conodes.
+type PublicAddressConfig struct {
+	// STUN are the STUN servers asked for the public IP of the conode, like
+	// "stun.l.google.com:19302".
+	STUN []string `toml:",omitempty"`
+	// Group is a group definition, like public.toml, whose conodes are
+	// asked for the IP the conode connects from. It is read by the app
+	// package into Peers.
+	Group string `toml:",omitempty"`
+	// Peers are the conodes asked for the IP the conode connects from.
+	Peers []*network.ServerIdentity `toml:"-"`
+	// Update replaces the host of the address of the conode by the public
+	// IP, instead of only warning about it.
+	Update bool `toml:",omitempty"`
+	// Timeout is how long the STUN servers and the peers are waited for,
+	// like "5s", which is the default.
+	Timeout string `toml:",omitempty"`
+}
+
+// defaultPublicAddressTimeout is the Timeout of PublicAddressConfig if it
+// isn't set.
+const defaultPublicAddressTimeout = 5 * time.Second
+
+// observedAddressRequest asks a conode for the address it sees the sender
+// connect from.
+type observedAddressRequest struct {
+	Nonce uint64
+}
+
+// observedAddressReply is the host of the address, empty if the conode
+// didn't see it because it opened the connection itself.
+type observedAddressReply struct {
+	Nonce uint64
+	Host  string
+}
+
+var observedAddressRequestID = network.RegisterMessage(&observedAddressRequest{})
+var observedAddressReplyID = network.RegisterMessage(&observedAddressReply{})
+
+// publicAddress checks the address of the server when it starts.
+type publicAddress struct {
+	sync.Mutex
+	cfg     PublicAddressConfig
+	timeout time.Duration
+	// replies waited for, by nonce
+	pending map[uint64]chan string
+	nonce   uint64
+}
+
+func newPublicAddress(cfg PublicAddressConfig) (*publicAddress, error) {
+	pa := &publicAddress{cfg: cfg, timeout: defaultPublicAddressTimeout,
+		pending: make(map[uint64]chan string)}
+	if cfg.Timeout != "" {
+		var err error
+		pa.timeout, err = time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid Timeout %q", cfg.Timeout)
+		}
+	}
+	return pa, nil
+}
+
+// registerPublicAddress makes the server answer the peers asking for the
+// address they connect from, and check its own address with cfg when it
+// starts, if cfg isn't nil.
+func (c *Server) registerPublicAddress(cfg *PublicAddressConfig) error {
+	if cfg != nil {
+		pa, err := newPublicAddress(*cfg)
+		if err != nil {
+			return err
+		}
+		c.publicAddress = pa
+	}
+	c.RegisterProcessorFunc(observedAddressRequestID, func(env *network.Envelope) error {
+		req, ok := env.Msg.(*observedAddressRequest)
+		if !ok {
+			return xerrors.New("invalid observed address request")
+		}
+		reply := &observedAddressReply{Nonce: req.Nonce}
+		if env.Remote != "" {
+			reply.Host = env.Remote.Host()
+		}
+		if _, err := c.Send(env.ServerIdentity, reply); err != nil {
+			return xerrors.Errorf("sending observed address: %v", err)
+		}
+		return nil
+	})
+	c.RegisterProcessorFunc(observedAddressReplyID, func(env *network.Envelope) error {
+		reply, ok := env.Msg.(*observedAddressReply)
+		if !ok {
+			return xerrors.New("invalid observed address reply")
+		}
+		if c.publicAddress == nil {
+			return nil
+		}
+		c.publicAddress.Lock()
+		ch := c.publicAddress.pending[reply.Nonce]
+		delete(c.publicAddress.pending, reply.Nonce)
+		c.publicAddress.Unlock()
+		if ch != nil {
+			ch <- reply.Host
+		}
+		return nil
+	})
+	return nil
+}
+
+// checkPublicAddress compares the host of the address of the server with the
+// public IP found by the STUN servers and the peers. It warns about a
+// mismatch, and replaces the host if Update is set. It returns the public IP,
+// or "" if it wasn't found.
+func (c *Server) checkPublicAddress() string {
+	pa := c.publicAddress
+	hosts := pa.discover(c)
+	if len(hosts) == 0 {
+		log.Warn("Couldn't find the public IP of", c.ServerIdentity.Address)
+		return ""
+	}
+	// the host given by most sources
+	var public string
+	for h, n := range hosts {
+		if n > hosts[public] || (n == hosts[public] && h < public) {
+			public = h
+		}
+	}
+	addr := c.ServerIdentity.Address
+	if advertises(addr, public) {
+		log.Lvl2(addr, "is reached at its public IP", public)
+		return public
+	}
+	msg := "the public IP is " + public + " but the address is " + addr.String()
+	if len(hosts) > 1 {
+		var others []string
+		for h := range hosts {
+			if h != public {
+				others = append(others, h)
+			}
+		}
+		sort.Strings(others)
+		msg += ", some sources found " + strings.Join(others, ", ")
+	}
+	if pa.cfg.Update {
+		c.ServerIdentity.Address = network.NewAddress(addr.ConnType(),
+			net.JoinHostPort(public, addr.Port()))
+		msg += ", using " + c.ServerIdentity.Address.String()
+		// the peers asked know the previous address
+		for _, si := range pa.cfg.Peers {
+			c.Router.CloseConnections(si.ID)
+		}
+	}
+	log.Warn("Address mismatch:", msg)
+	c.events.publish(Event{Type: EventAddressMismatch, Message: msg})
+	return public
+}
+
+// advertises returns true if the host of the address is the IP, or resolves
+// to it.
+func advertises(addr network.Address, ip string) bool {
+	host := addr.Host()
+	if net.ParseIP(host) != nil {
+		return net.ParseIP(host).Equal(net.ParseIP(ip))
+	}
+	ips, err := net.LookupHost(host)
+	if err != nil {
+		log.Lvl2("Couldn't resolve", host, ":", err)
+		return false
+	}
+	for _, h := range ips {
+		if net.ParseIP(h).Equal(net.ParseIP(ip)) {
+			return true
+		}
+	}
+	return false
+}
+
+// discover asks the STUN servers and the peers for the public IP of the
+// server, and returns the IPs found with the number of sources giving them.
+func (pa *publicAddress) discover(c *Server) map[string]int {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	hosts := make(map[string]int)
+	found := func(source, host string) {
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return
+		}
+		log.Lvl3(source, "sees", c.ServerIdentity.Address, "at", ip)
+		mu.Lock()
+		hosts[ip.String()]++
+		mu.Unlock()
+	}
+	for _, server := range pa.cfg.STUN {
+		wg.Add(1)
+		go func(server string) {
+			defer wg.Done()
+			host, err := stunHost(server, pa.timeout)
+			if err != nil {
+				log.Lvl2("STUN server", server, "failed:", err)
+				return
+			}
+			found(server, host)
+		}(server)
+	}
+	for _, si := range pa.cfg.Peers {
+		if si.Public.Equal(c.ServerIdentity.Public) {
+			continue
+		}
+		wg.Add(1)
+		go func(si *network.ServerIdentity) {
+			defer wg.Done()
+			host, err := pa.ask(c, si)
+			if err != nil {
+				log.Lvl2("Peer", si, "failed:", err)
+				return
+			}
+			found(si.Address.String(), host)
+		}(si)
+	}
+	wg.Wait()
+	return hosts
+}
+
+// ask sends a request to the peer for the host it sees the server connect
+// from.
+func (pa *publicAddress) ask(c *Server, si *network.ServerIdentity) (string, error) {
+	ch := make(chan string, 1)
+	pa.Lock()
+	pa.nonce++
+	nonce := pa.nonce
+	pa.pending[nonce] = ch
+	pa.Unlock()
+	defer func() {
+		pa.Lock()
+		delete(pa.pending, nonce)
+		pa.Unlock()
+	}()
+	if _, err := c.Send(si, &observedAddressRequest{Nonce: nonce}); err != nil {
+		return "", xerrors.Errorf("sending request: %v", err)
+	}
+	select {
+	case host := <-ch:
+		if host == "" {
+			return "", xerrors.New("the peer opened the connection")
+		}
+		return host, nil
+	case <-time.After(pa.timeout):
+		return "", xerrors.New("timeout")
+	}
+}
+
+// The constants of the STUN messages, see RFC 5389.
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+	stunMagicCookie     = 0x2112A442
+	stunMappedAddress   = 0x0001
+	stunXorMappedAddr   = 0x0020
+	stunHeaderSize      = 20
+)
+
+// stunHost asks the STUN server for the IP the request comes from.
+func stunHost(server string, timeout time.Duration) (string, error) {
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return "", xerrors.Errorf("dialing: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return "", xerrors.Errorf("deadline: %v", err)
+	}
+	req := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	if _, err := rand.Read(req[8:]); err != nil {
+		return "", xerrors.Errorf("transaction ID: %v", err)
+	}
+	if _, err := conn.Write(req); err != nil {
+		return "", xerrors.Errorf("sending request: %v", err)
+	}
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", xerrors.Errorf("reading response: %v", err)
+	}
+	ip, err := parseSTUNResponse(buf[:n], req[8:])
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+// parseSTUNResponse returns the address of the binding response to the
+// request with the transaction ID.
+func parseSTUNResponse(msg, txID []byte) (net.IP, error) {
+	if len(msg) < stunHeaderSize ||
+		binary.BigEndian.Uint16(msg[0:]) != stunBindingResponse ||
+		binary.BigEndian.Uint32(msg[4:]) != stunMagicCookie ||
+		!bytes.Equal(msg[8:stunHeaderSize], txID) {
+		return nil, xerrors.New("not a response to the request")
+	}
+	attrs := msg[stunHeaderSize:]
+	if length := int(binary.BigEndian.Uint16(msg[2:])); length <= len(attrs) {
+		attrs = attrs[:length]
+	}
+	var mapped net.IP
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		size := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+size > len(attrs) {
+			break
+		}
+		value := attrs[4 : 4+size]
+		switch typ {
+		case stunXorMappedAddr:
+			// the address is xored with the cookie and the transaction ID
+			if ip := stunIP(value, msg[4:stunHeaderSize]); ip != nil {
+				return ip, nil
+			}
+		case stunMappedAddress:
+			mapped = stunIP(value, nil)
+		}
+		// the attributes are padded to 4 bytes
+		next := 4 + (size+3)&^3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	if mapped == nil {
+		return nil, xerrors.New("no address in the response")
+	}
+	return mapped, nil
+}
+
+// stunIP returns the IP of the address attribute, xored with mask if it
+// isn't nil, or nil if the attribute is invalid.
+func stunIP(value, mask []byte) net.IP {
+	if len(value) < 4 {
+		return nil
+	}
+	var size int
+	switch value[1] {
+	case 0x01:
+		size = net.IPv4len
+	case 0x02:
+		size = net.IPv6len
+	default:
+		return nil
+	}
+	if len(value) < 4+size {
+		return nil
+	}
+	ip := make(net.IP, size)
+	copy(ip, value[4:])
+	if mask != nil {
+		for i := range ip {
+			ip[i] ^= mask[i]
+		}
+	}
+	return ip
+}
@@ -0,0 +1,91 @@
+package onet
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// newSTUNServer answers the binding requests with the given IP, and returns
+// its address and the function closing it.
+func newSTUNServer(t *testing.T, ip net.IP) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < stunHeaderSize {
+				continue
+			}
+			resp := make([]byte, stunHeaderSize+12)
+			binary.BigEndian.PutUint16(resp[0:], stunBindingResponse)
+			binary.BigEndian.PutUint16(resp[2:], 12)
+			copy(resp[4:], buf[4:stunHeaderSize])
+			attr := resp[stunHeaderSize:]
+			binary.BigEndian.PutUint16(attr[0:], stunXorMappedAddr)
+			binary.BigEndian.PutUint16(attr[2:], 8)
+			attr[5] = 0x01
+			binary.BigEndian.PutUint16(attr[6:], 7770^0x2112)
+			for i, b := range ip.To4() {
+				attr[8+i] = b ^ resp[4+i]
+			}
+			conn.WriteTo(resp, from)
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func TestStunHost(t *testing.T) {
+	addr, stop := newSTUNServer(t, net.ParseIP("203.0.113.7"))
+	defer stop()
+	host, err := stunHost(addr, defaultPublicAddressTimeout)
+	require.NoError(t, err)
+	require.Equal(t, "203.0.113.7", host)
+
+	_, err = parseSTUNResponse(make([]byte, stunHeaderSize), make([]byte, 12))
+	require.Error(t, err)
+}
+
+func TestServer_PublicAddress(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(3)
+	s := servers[0]
+	address := s.ServerIdentity.Address
+	defer func() { s.ServerIdentity.Address = address }()
+	events, cancel := s.Subscribe(EventAddressMismatch)
+	defer cancel()
+
+	// the peers see the conode at its address
+	pa, err := newPublicAddress(PublicAddressConfig{Update: true,
+		Peers: []*network.ServerIdentity{servers[1].ServerIdentity, servers[2].ServerIdentity}})
+	require.NoError(t, err)
+	s.publicAddress = pa
+	require.Equal(t, "127.0.0.1", s.checkPublicAddress())
+	require.Equal(t, address, s.ServerIdentity.Address)
+	require.Len(t, events, 0)
+
+	// the STUN servers, more numerous, see it elsewhere
+	var stun []string
+	for i := 0; i < 3; i++ {
+		addr, stop := newSTUNServer(t, net.ParseIP("203.0.113.7"))
+		defer stop()
+		stun = append(stun, addr)
+	}
+	pa.cfg.STUN = stun
+	require.Equal(t, "203.0.113.7", s.checkPublicAddress())
+	require.Equal(t, "203.0.113.7", s.ServerIdentity.Address.Host())
+	require.Equal(t, address.Port(), s.ServerIdentity.Address.Port())
+	ev := <-events
+	require.Contains(t, ev.Message, "some sources found 127.0.0.1")
+
+	_, err = newPublicAddress(PublicAddressConfig{Timeout: "soon"})
+	require.Error(t, err)
+}
@@ -0,0 +1,263 @@
+package onet
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ErrQueued is returned by Send when no conode could be reached and the
+// request has been put in the offline queue of the client, see
+// SetOfflineQueue.
+var ErrQueued = xerrors.New("request queued")
+
+// defaultQueueRetry is the wait between two attempts to flush the queue.
+const defaultQueueRetry = 5 * time.Second
+
+// OfflineQueue tells a Client to keep the requests sent with Send and
+// SendProtobuf while no conode can be reached, and to send them once they
+// can, see SetOfflineQueue.
+type OfflineQueue struct {
+	// Path is the file the queue is kept in, so that the requests survive a
+	// restart of the application. If it is empty, the queue is only kept in
+	// memory. Every client needs its own file.
+	Path string
+	// MaxRequests, if not 0, is the number of requests kept. The next ones
+	// fail as if there were no queue.
+	MaxRequests int
+	// RetryInterval is the wait between two attempts to send the queued
+	// requests. If it is 0, they are tried every 5s.
+	RetryInterval time.Duration
+	// Flushed, if not nil, is called once a queued request has been sent,
+	// with the reply or the error returned by the conode.
+	Flushed func(req *QueuedRequest, reply []byte, err error)
+}
+
+// QueuedRequest is a request waiting in the offline queue.
+type QueuedRequest struct {
+	Destination *network.ServerIdentity
+	Path        string
+	Data        []byte
+	Queued      time.Time
+}
+
+// queueFile is the content of OfflineQueue.Path.
+type queueFile struct {
+	Requests []*QueuedRequest
+}
+
+// offlineQueue holds the queued requests of a Client.
+type offlineQueue struct {
+	sync.Mutex
+	cfg      OfflineQueue
+	requests []*QueuedRequest
+	// closed to stop the flush loop, nil if it isn't running
+	stop chan struct{}
+}
+
+// SetOfflineQueue enables the offline queue of the requests. The requests
+// already in the file of the queue are sent once the conodes can be reached.
+// A nil queue disables it, the requests not sent yet staying in the file.
+func (c *Client) SetOfflineQueue(q *OfflineQueue) error {
+	var oq *offlineQueue
+	if q != nil {
+		oq = &offlineQueue{cfg: *q}
+		if oq.cfg.RetryInterval == 0 {
+			oq.cfg.RetryInterval = defaultQueueRetry
+		}
+		if err := oq.load(c.suite); err != nil {
+			return xerrors.Errorf("loading queue: %v", err)
+		}
+	}
+
+	c.Lock()
+	old := c.queue
+	c.queue = oq
+	c.Unlock()
+	if old != nil {
+		old.stopFlush()
+	}
+	if oq != nil {
+		oq.startFlush(c)
+	}
+	return nil
+}
+
+// QueuedRequests returns the requests waiting in the offline queue.
+func (c *Client) QueuedRequests() []QueuedRequest {
+	c.Lock()
+	q := c.queue
+	c.Unlock()
+	if q == nil {
+		return nil
+	}
+	q.Lock()
+	defer q.Unlock()
+	reqs := make([]QueuedRequest, len(q.requests))
+	for i, r := range q.requests {
+		reqs[i] = *r
+	}
+	return reqs
+}
+
+// enqueue puts the request that couldn't be sent because of err in the
+// offline queue, if the client has one, and returns the error for the
+// caller.
+func (c *Client) enqueue(dst *network.ServerIdentity, path string, buf []byte, err error) error {
+	c.Lock()
+	q := c.queue
+	c.Unlock()
+	if q == nil {
+		return err
+	}
+	q.Lock()
+	if q.cfg.MaxRequests > 0 && len(q.requests) >= q.cfg.MaxRequests {
+		q.Unlock()
+		return xerrors.Errorf("offline queue full: %w", err)
+	}
+	q.requests = append(q.requests, &QueuedRequest{
+		Destination: dst,
+		Path:        path,
+		Data:        append([]byte{}, buf...),
+		Queued:      time.Now(),
+	})
+	if serr := q.save(); serr != nil {
+		q.requests = q.requests[:len(q.requests)-1]
+		q.Unlock()
+		return xerrors.Errorf("%v, and saving the queue: %v", err, serr)
+	}
+	q.Unlock()
+	log.Lvlf2("%s/%s to %s queued: %v", c.service, path, dst, err)
+	q.startFlush(c)
+	return xerrors.Errorf("%v: %w", err, ErrQueued)
+}
+
+// load reads the queued requests from the file of the queue, if any.
+func (q *offlineQueue) load(suite network.Suite) error {
+	if q.cfg.Path == "" {
+		return nil
+	}
+	buf, err := ioutil.ReadFile(q.cfg.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("reading: %v", err)
+	}
+	var f queueFile
+	err = protobuf.DecodeWithConstructors(buf, &f, network.DefaultConstructors(suite))
+	if err != nil {
+		return xerrors.Errorf("decoding: %v", err)
+	}
+	q.requests = f.Requests
+	return nil
+}
+
+// save writes the queued requests to the file of the queue, if any. The
+// queue must be locked.
+func (q *offlineQueue) save() error {
+	if q.cfg.Path == "" {
+		return nil
+	}
+	buf, err := protobuf.Encode(&queueFile{Requests: q.requests})
+	if err != nil {
+		return xerrors.Errorf("encoding: %v", err)
+	}
+	// a crash while writing must not lose the queue
+	tmp := q.cfg.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return xerrors.Errorf("writing: %v", err)
+	}
+	if err := os.Rename(tmp, q.cfg.Path); err != nil {
+		return xerrors.Errorf("moving: %v", err)
+	}
+	return nil
+}
+
+// startFlush starts the loop sending the queued requests, if there are some
+// and it isn't running yet.
+func (q *offlineQueue) startFlush(c *Client) {
+	q.Lock()
+	defer q.Unlock()
+	if q.stop != nil || len(q.requests) == 0 {
+		return
+	}
+	q.stop = make(chan struct{})
+	go q.flushLoop(c, q.stop)
+}
+
+// stopFlush stops the flush loop, leaving the requests in the queue.
+func (q *offlineQueue) stopFlush() {
+	q.Lock()
+	defer q.Unlock()
+	if q.stop != nil {
+		close(q.stop)
+		q.stop = nil
+	}
+}
+
+// flushLoop sends the queued requests in order, until the queue is empty.
+// A request that still can't reach a conode is tried again after the retry
+// interval, with the ones after it.
+func (q *offlineQueue) flushLoop(c *Client, stop chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-c.getClock().After(q.cfg.RetryInterval):
+		}
+		for {
+			q.Lock()
+			if q.stop != stop {
+				q.Unlock()
+				return
+			}
+			if len(q.requests) == 0 {
+				// started again by the next queued request
+				q.stop = nil
+				q.Unlock()
+				return
+			}
+			req := q.requests[0]
+			q.Unlock()
+
+			reply, delivered, err := c.sendRequest(c.withRetryBudget(ctx), req.Destination,
+				req.Path, req.Data)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && !delivered {
+				log.Lvlf3("%s/%s to %s still not sent: %v", c.service, req.Path,
+					req.Destination, err)
+				break
+			}
+
+			q.Lock()
+			q.requests = q.requests[1:]
+			if serr := q.save(); serr != nil {
+				log.Error("Saving the offline queue:", serr)
+			}
+			q.Unlock()
+			if q.cfg.Flushed != nil {
+				q.cfg.Flushed(req, reply, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package onet
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+func TestClient_OfflineQueue(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(1, false)
+	si := roster.List[0]
+
+	dir, err := ioutil.TempDir("", "queue")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue")
+
+	// a network that can be cut
+	var offline int32 = 1
+	d := &net.Dialer{}
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if atomic.LoadInt32(&offline) == 1 {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: xerrors.New("offline")}
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+	newClient := func(flushed chan []byte) *Client {
+		cl := NewClient(tSuite, serviceWebSocket)
+		cl.NetDialContext = dial
+		cl.SetRetryPolicy(&RetryPolicy{MaxAttempts: 1})
+		require.NoError(t, cl.SetOfflineQueue(&OfflineQueue{
+			Path:          path,
+			MaxRequests:   1,
+			RetryInterval: 20 * time.Millisecond,
+			Flushed: func(req *QueuedRequest, reply []byte, err error) {
+				require.NoError(t, err)
+				flushed <- reply
+			},
+		}))
+		return cl
+	}
+
+	flushed := make(chan []byte, 1)
+	cl := newClient(flushed)
+	err = cl.SendProtobuf(si, &SimpleResponse{}, nil)
+	require.True(t, xerrors.Is(err, ErrQueued))
+	err = cl.SendProtobuf(si, &SimpleResponse{}, nil)
+	require.Error(t, err)
+	require.False(t, xerrors.Is(err, ErrQueued))
+	require.Len(t, cl.QueuedRequests(), 1)
+	require.NoError(t, cl.Close())
+
+	// the queue is kept in the file
+	cl = newClient(flushed)
+	defer cl.Close()
+	reqs := cl.QueuedRequests()
+	require.Len(t, reqs, 1)
+	require.True(t, reqs[0].Destination.Equal(si))
+	require.Equal(t, "SimpleResponse", reqs[0].Path)
+
+	atomic.StoreInt32(&offline, 0)
+	select {
+	case reply := <-flushed:
+		sr := &SimpleResponse{}
+		require.NoError(t, protobuf.Decode(reply, sr))
+		require.Equal(t, int64(1), sr.Val)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "queue not flushed")
+	}
+	require.Empty(t, cl.QueuedRequests())
+
+	// the errors of the conode are not queued
+	err = cl.SendProtobuf(si, &ErrorRequest{Roster: *roster, Flags: 1}, nil)
+	require.Error(t, err)
+	require.False(t, xerrors.Is(err, ErrQueued))
+	require.Empty(t, cl.QueuedRequests())
+}
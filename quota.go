@@ -0,0 +1,430 @@
+package onet
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+// ErrStorageQuotaExceeded is returned when a service tries to store more data
+// than its quota allows.
+var ErrStorageQuotaExceeded = xerrors.New("storage quota exceeded")
+
+// StorageQuotaWarning is the fraction of the quota above which the warning
+// callback of a service is called.
+var StorageQuotaWarning = 0.9
+
+// StorageRescanInterval is the minimum time between two scans of the buckets
+// of a service to update its usage for the status. In between, the status
+// reports the usage counted by the writes that check the quota.
+var StorageRescanInterval = 10 * time.Minute
+
+// storageRateWindow is the number of seconds over which the write rate of a
+// service is averaged.
+const storageRateWindow = 60
+
+// writeRate counts the writes of the last storageRateWindow seconds, one slot
+// per second.
+type writeRate struct {
+	counts  [storageRateWindow]int64
+	seconds [storageRateWindow]int64
+}
+
+func (r *writeRate) add(now time.Time, n int64) {
+	sec := now.Unix()
+	i := sec % storageRateWindow
+	if r.seconds[i] != sec {
+		r.seconds[i] = sec
+		r.counts[i] = 0
+	}
+	r.counts[i] += n
+}
+
+// perSecond returns the average number of writes per second.
+func (r *writeRate) perSecond(now time.Time) float64 {
+	sec := now.Unix()
+	var sum int64
+	for i, s := range r.seconds {
+		if sec-s < storageRateWindow {
+			sum += r.counts[i]
+		}
+	}
+	return float64(sum) / storageRateWindow
+}
+
+// storageUsage keeps track of the bytes stored by a service in its buckets.
+type storageUsage struct {
+	sync.Mutex
+	used    int64
+	quota   int64
+	warned  bool
+	warning func(used, quota int64)
+	// notify is also called for the warning, to publish it
+	notify  func(used, quota int64)
+	scanned time.Time
+	// keys is the number of keys, counted by the last scan and the writes
+	// since.
+	keys int64
+	// disk is the size of the pages of the buckets at the last scan.
+	disk int64
+	// writes counts the writes done through the Context since the start.
+	writes int64
+	rate   writeRate
+}
+
+// reserve adds delta to the used bytes if this doesn't exceed the quota. A
+// quota of 0 means no limit.
+func (u *storageUsage) reserve(delta int64) error {
+	u.Lock()
+	defer u.Unlock()
+	if u.quota > 0 && delta > 0 && u.used+delta > u.quota {
+		return xerrors.Errorf("%d + %d bytes > %d: %w", u.used, delta,
+			u.quota, ErrStorageQuotaExceeded)
+	}
+	u.used += delta
+	return nil
+}
+
+// release gives back bytes that have been reserved but not written.
+func (u *storageUsage) release(delta int64) {
+	u.Lock()
+	u.used -= delta
+	u.Unlock()
+}
+
+// set overwrites the usage after a scan of the buckets.
+func (u *storageUsage) set(st bucketsStats) {
+	u.Lock()
+	u.used = st.size
+	u.keys = st.keys
+	u.disk = st.disk
+	u.scanned = time.Now()
+	u.Unlock()
+}
+
+// wrote records the writes of a transaction, and the keys it added or
+// removed.
+func (u *storageUsage) wrote(writes, keys int64) {
+	if writes == 0 {
+		return
+	}
+	u.Lock()
+	u.writes += writes
+	u.keys += keys
+	u.rate.add(time.Now(), writes)
+	u.Unlock()
+}
+
+// needsScan returns whether the last scan is older than
+// StorageRescanInterval.
+func (u *storageUsage) needsScan() bool {
+	u.Lock()
+	defer u.Unlock()
+	return time.Since(u.scanned) >= StorageRescanInterval
+}
+
+// checkWarning calls the warning callback once when the usage goes above
+// StorageQuotaWarning of the quota. It is armed again once the usage is
+// below the threshold.
+func (u *storageUsage) checkWarning() {
+	u.Lock()
+	if u.quota == 0 {
+		u.Unlock()
+		return
+	}
+	above := float64(u.used) >= StorageQuotaWarning*float64(u.quota)
+	fire := above && !u.warned && (u.warning != nil || u.notify != nil)
+	if !above {
+		u.warned = false
+	} else if fire {
+		u.warned = true
+	}
+	used, quota, fn, notify := u.used, u.quota, u.warning, u.notify
+	u.Unlock()
+	if fire {
+		if fn != nil {
+			fn(used, quota)
+		}
+		if notify != nil {
+			notify(used, quota)
+		}
+	}
+}
+
+// get returns the used bytes and the quota.
+func (u *storageUsage) get() (int64, int64) {
+	u.Lock()
+	defer u.Unlock()
+	return u.used, u.quota
+}
+
+// bucketsStats is what the buckets of a service hold.
+type bucketsStats struct {
+	// size is the number of bytes of the keys and values.
+	size int64
+	keys int64
+	// disk is the number of bytes of the pages holding the buckets, or size
+	// if the backend doesn't tell.
+	disk int64
+}
+
+// bucketDiskSize returns the number of bytes of the pages of a bucket, if its
+// backend tells.
+func bucketDiskSize(b StoreBucket) (int64, bool) {
+	switch bb := b.(type) {
+	case *bbolt.Bucket:
+		st := bb.Stats()
+		return int64(st.BranchAlloc + st.LeafAlloc + st.InlineBucketInuse), true
+	case encryptedBucket:
+		return bucketDiskSize(bb.StoreBucket)
+	}
+	return 0, false
+}
+
+// serviceBucketsStats returns what is stored in the bucket of the service and
+// in all its additional buckets. The buckets of the services whose name
+// starts with the name of this service and "_" are not counted.
+func serviceBucketsStats(tx StoreTx, name []byte) bucketsStats {
+	prefix := string(name) + "_"
+	var others []string
+	for _, n := range ServiceFactory.RegisteredServiceNames() {
+		if strings.HasPrefix(n, prefix) {
+			others = append(others, n)
+		}
+	}
+	ownBucket := func(bn string) bool {
+		if bn == string(name) {
+			return true
+		}
+		if !strings.HasPrefix(bn, prefix) {
+			return false
+		}
+		for _, o := range others {
+			if bn == o || bn == o+"version" || strings.HasPrefix(bn, o+"_") {
+				return false
+			}
+		}
+		return true
+	}
+
+	var st bucketsStats
+	tx.ForEach(func(bn []byte, b StoreBucket) error {
+		if ownBucket(string(bn)) {
+			var size int64
+			b.ForEach(func(k, v []byte) error {
+				size += int64(len(k) + len(v))
+				st.keys++
+				return nil
+			})
+			st.size += size
+			if disk, ok := bucketDiskSize(b); ok {
+				st.disk += disk
+			} else {
+				st.disk += size
+			}
+		}
+		return nil
+	})
+	return st
+}
+
+// QuotaBucket gives access to an additional bucket of a service. Its writes
+// count towards the storage quota of the service.
+type QuotaBucket struct {
+	bucket StoreBucket
+	usage  *storageUsage
+	// transaction and name of the bucket, to manage the TTLs of its keys
+	tx   StoreTx
+	name []byte
+	// bytes reserved in the transaction
+	delta int64
+	// writes done and keys added in the transaction
+	writes int64
+	keys   int64
+}
+
+// Get returns the value of the key, or nil. The value is only valid during
+// the transaction.
+func (b *QuotaBucket) Get(key []byte) []byte {
+	return b.bucket.Get(key)
+}
+
+// ForEach calls fn for every key/value pair of the bucket.
+func (b *QuotaBucket) ForEach(fn func(k, v []byte) error) error {
+	return b.bucket.ForEach(fn)
+}
+
+// Put stores the value under key. If the service has a storage quota and the
+// value doesn't fit, an error wrapping ErrStorageQuotaExceeded is returned.
+func (b *QuotaBucket) Put(key, value []byte) error {
+	delta := int64(len(value))
+	var keys int64
+	if old := b.bucket.Get(key); old != nil {
+		delta -= int64(len(old))
+	} else {
+		delta += int64(len(key))
+		keys = 1
+	}
+	if err := b.usage.reserve(delta); err != nil {
+		return err
+	}
+	if err := b.bucket.Put(key, value); err != nil {
+		b.usage.release(delta)
+		return err
+	}
+	if b.tx != nil {
+		if err := clearTTL(b.tx, b.name, key); err != nil {
+			b.usage.release(delta)
+			return err
+		}
+	}
+	b.delta += delta
+	b.writes++
+	b.keys += keys
+	return nil
+}
+
+// Delete removes the key and gives back its space.
+func (b *QuotaBucket) Delete(key []byte) error {
+	old := b.bucket.Get(key)
+	if old == nil {
+		return nil
+	}
+	if err := b.bucket.Delete(key); err != nil {
+		return err
+	}
+	if b.tx != nil {
+		if err := clearTTL(b.tx, b.name, key); err != nil {
+			return err
+		}
+	}
+	size := int64(len(key) + len(old))
+	b.usage.release(size)
+	b.delta -= size
+	b.writes++
+	b.keys--
+	return nil
+}
+
+// UpdateAdditionalBucket calls fn in a read-write transaction on the
+// additional bucket with the given name, created with GetAdditionalBucket.
+// Unlike writes done directly in the database, the writes through the
+// QuotaBucket are checked against the storage quota of the service.
+func (c *Context) UpdateAdditionalBucket(name []byte, fn func(b *QuotaBucket) error) error {
+	fullName, err := c.additionalBucket(name)
+	if err != nil {
+		return xerrors.Errorf("tx error: %v", err)
+	}
+	qb := &QuotaBucket{usage: c.usage, name: fullName}
+	err = c.manager.store.Update(func(tx StoreTx) error {
+		qb.bucket = tx.Bucket(fullName)
+		qb.tx = tx
+		return fn(qb)
+	})
+	if err != nil {
+		c.usage.release(qb.delta)
+		return xerrors.Errorf("tx error: %w", err)
+	}
+	c.usage.wrote(qb.writes, qb.keys)
+	c.usage.checkWarning()
+	return nil
+}
+
+// StorageUsage returns the number of bytes stored by the service, including
+// its additional buckets, and its quota. A quota of 0 means there is no
+// limit.
+func (c *Context) StorageUsage() (used int64, quota int64) {
+	return c.usage.get()
+}
+
+// SetStorageWarning registers a function that is called when the storage
+// used by the service goes above StorageQuotaWarning of its quota.
+func (c *Context) SetStorageWarning(fn func(used, quota int64)) {
+	c.usage.Lock()
+	c.usage.warning = fn
+	c.usage.Unlock()
+}
+
+// updateStorageUsage scans the buckets of the service to account for data
+// written directly in the database.
+func (c *Context) updateStorageUsage() error {
+	err := c.manager.store.View(func(tx StoreTx) error {
+		c.usage.set(serviceBucketsStats(tx, c.bucketName))
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("tx error: %v", err)
+	}
+	c.usage.checkWarning()
+	return nil
+}
+
+// storageStats is the storage used by a service.
+type storageStats struct {
+	used, quota, keys, disk, writes int64
+	// writeRate is the number of writes per second over the last
+	// storageRateWindow seconds.
+	writeRate float64
+}
+
+// storageStats returns the storage used by the service, scanning its buckets
+// if the last scan is older than StorageRescanInterval. The writes done
+// directly in the database returned by GetAdditionalBucket are only counted
+// by the scans, and not in the write rate.
+func (c *Context) storageStats() (storageStats, error) {
+	var err error
+	if c.usage.needsScan() {
+		err = c.updateStorageUsage()
+	}
+	u := c.usage
+	u.Lock()
+	defer u.Unlock()
+	return storageStats{
+		used:      u.used,
+		quota:     u.quota,
+		keys:      u.keys,
+		disk:      u.disk,
+		writes:    u.writes,
+		writeRate: u.rate.perSecond(time.Now()),
+	}, err
+}
+
+// storageReporter reports the storage used by every service.
+type storageReporter struct {
+	manager *serviceManager
+}
+
+// GetStatus implements StatusReporter.
+func (sr storageReporter) GetStatus() *Status {
+	st := &Status{Field: make(map[string]string)}
+	sr.manager.servicesMutex.Lock()
+	var names []string
+	contexts := make(map[string]*Context)
+	for _, c := range sr.manager.contexts {
+		name := ServiceFactory.Name(c.serviceID)
+		names = append(names, name)
+		contexts[name] = c
+	}
+	sr.manager.servicesMutex.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		ss, err := contexts[name].storageStats()
+		if err != nil {
+			st.Field[name+".Error"] = err.Error()
+			continue
+		}
+		st.Field[name+".Used"] = strconv.FormatInt(ss.used, 10)
+		st.Field[name+".Quota"] = strconv.FormatInt(ss.quota, 10)
+		st.Field[name+".Keys"] = strconv.FormatInt(ss.keys, 10)
+		st.Field[name+".Disk"] = strconv.FormatInt(ss.disk, 10)
+		st.Field[name+".Writes"] = strconv.FormatInt(ss.writes, 10)
+		st.Field[name+".WriteRate"] = strconv.FormatFloat(ss.writeRate, 'f', 2, 64)
+	}
+	return st
+}
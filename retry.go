@@ -0,0 +1,112 @@
+package onet
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/network"
+)
+
+// RetryPolicy tells a Client how to retry connecting to a conode, see
+// SetRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts to connect. If it is 0, only
+	// one attempt is made.
+	MaxAttempts int
+	// InitialBackoff is the wait after the first failed attempt.
+	InitialBackoff time.Duration
+	// Multiplier is applied to the wait after each failed attempt. Below 1,
+	// the wait stays the same.
+	Multiplier float64
+	// MaxBackoff, if not 0, is the longest wait between two attempts.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of the wait that is randomized, between 0 and
+	// 1, so that clients don't retry all at the same time.
+	Jitter float64
+	// Budget, if not 0, is the total time one call, e.g., Send, may wait
+	// between attempts, whatever the number of connections it opens.
+	Budget time.Duration
+}
+
+// DefaultRetryPolicy is used by the clients without a retry policy: 5
+// attempts 20ms apart.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    network.MaxRetryConnect,
+	InitialBackoff: network.WaitRetry,
+}
+
+// SetRetryPolicy sets how the client retries connecting to a conode. A nil
+// policy sets back the DefaultRetryPolicy.
+func (c *Client) SetRetryPolicy(p *RetryPolicy) {
+	c.Lock()
+	defer c.Unlock()
+	c.retry = p
+}
+
+// retryPolicy returns the retry policy of the client.
+func (c *Client) retryPolicy() *RetryPolicy {
+	c.Lock()
+	defer c.Unlock()
+	if c.retry == nil {
+		return &DefaultRetryPolicy
+	}
+	return c.retry
+}
+
+// backoff returns the wait after the failed attempt, starting at 0.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	wait := float64(p.InitialBackoff)
+	if p.Multiplier > 1 {
+		wait *= math.Pow(p.Multiplier, float64(attempt))
+	}
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	if wait > math.MaxInt64 {
+		wait = math.MaxInt64
+	}
+	if p.Jitter > 0 {
+		wait -= wait * p.Jitter * rand.Float64()
+	}
+	return time.Duration(wait)
+}
+
+type retryBudgetKey struct{}
+
+// retryBudget is the time left to wait between attempts during a call.
+type retryBudget struct {
+	sync.Mutex
+	left time.Duration
+}
+
+// spend returns false if there isn't enough time left to wait.
+func (b *retryBudget) spend(wait time.Duration) bool {
+	if b == nil {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+	if wait > b.left {
+		return false
+	}
+	b.left -= wait
+	return true
+}
+
+// withRetryBudget returns a context with the retry budget of the policy for
+// a new call, unless ctx is already part of a call.
+func (c *Client) withRetryBudget(ctx context.Context) context.Context {
+	p := c.retryPolicy()
+	if p.Budget == 0 || ctx.Value(retryBudgetKey{}) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, retryBudgetKey{}, &retryBudget{left: p.Budget})
+}
+
+func retryBudgetFrom(ctx context.Context) *retryBudget {
+	b, _ := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	return b
+}
@@ -0,0 +1,57 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := &RetryPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+		Multiplier:     2,
+		MaxBackoff:     50 * time.Millisecond,
+	}
+	for i, exp := range []time.Duration{10, 20, 40, 50, 50} {
+		require.Equal(t, exp*time.Millisecond, p.backoff(i))
+	}
+	require.Equal(t, 50*time.Millisecond, p.backoff(1000))
+
+	p.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		wait := p.backoff(1)
+		require.True(t, wait >= 10*time.Millisecond && wait <= 20*time.Millisecond)
+	}
+
+	require.Equal(t, network.WaitRetry, DefaultRetryPolicy.backoff(3))
+}
+
+func TestClient_RetryPolicy(t *testing.T) {
+	dead := network.NewServerIdentity(key.NewKeyPair(tSuite).Public,
+		network.NewTCPAddress("127.0.0.1:1"))
+	cl := NewClient(tSuite, serviceWebSocket)
+	send := func() time.Duration {
+		start := time.Now()
+		_, err := cl.Send(dead, "SimpleResponse", nil)
+		require.Error(t, err)
+		return time.Since(start)
+	}
+
+	cl.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: 50 * time.Millisecond})
+	require.True(t, send() >= 100*time.Millisecond)
+
+	cl.SetRetryPolicy(&RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Second})
+	require.True(t, send() < 500*time.Millisecond)
+
+	// the budget stops the retries before the attempts are exhausted
+	cl.SetRetryPolicy(&RetryPolicy{
+		MaxAttempts:    100,
+		InitialBackoff: 50 * time.Millisecond,
+		Budget:         120 * time.Millisecond,
+	})
+	elapsed := send()
+	require.True(t, elapsed >= 100*time.Millisecond && elapsed < time.Second)
+}
@@ -0,0 +1,160 @@
+package onet
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// RuntimeStatus is a structured report of the state of the conode, for
+// dashboards. It is served as JSON by the admin interface.
+type RuntimeStatus struct {
+	Uptime time.Duration
+	// Version of the main module of the binary, "(devel)" if it isn't known.
+	Version string
+	// GitHash is the commit the binary was built from, if known.
+	GitHash string
+	Go      GoStatus
+	// Peers are the conodes with open connections, sorted by identity.
+	Peers []PeerStatus
+	// Protocols is the number of running instances of each protocol.
+	Protocols map[string]int
+	// Storage used by each service.
+	Storage map[string]StorageStatus
+	// Suites maps "conode" to the suite of the conode, and the services
+	// with a suite of their own to it.
+	Suites map[string]string
+}
+
+// GoStatus holds the statistics of the Go runtime.
+type GoStatus struct {
+	Version    string
+	Goroutines int
+	GOMAXPROCS int
+	// HeapAlloc and Sys are in bytes, as in runtime.MemStats.
+	HeapAlloc  uint64
+	Sys        uint64
+	NumGC      uint32
+	PauseTotal time.Duration
+}
+
+// PeerStatus describes the connections to another conode.
+type PeerStatus struct {
+	ID          string
+	Remotes     []string
+	Connections int
+	Tx          uint64
+	Rx          uint64
+}
+
+// StorageStatus is the storage used by a service, in bytes except for Keys.
+// Quota is 0 if there is none.
+type StorageStatus struct {
+	Used  int64
+	Quota int64
+	Keys  int64
+	Disk  int64
+}
+
+// buildVersion returns the version of the main module and the commit the
+// binary was built from, as far as the build info knows.
+func buildVersion() (version, revision string) {
+	version = "(devel)"
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if bi.Main.Version != "" {
+		version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" {
+			revision = s.Value
+		}
+	}
+	return
+}
+
+// RuntimeStatus returns the current state of the conode.
+func (c *Server) RuntimeStatus() *RuntimeStatus {
+	st := &RuntimeStatus{
+		Uptime:    time.Since(c.started),
+		Protocols: make(map[string]int),
+		Storage:   make(map[string]StorageStatus),
+		Suites:    map[string]string{"conode": c.suite.String()},
+	}
+	st.Version, st.GitHash = buildVersion()
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	st.Go = GoStatus{
+		Version:    runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		HeapAlloc:  ms.HeapAlloc,
+		Sys:        ms.Sys,
+		NumGC:      ms.NumGC,
+		PauseTotal: time.Duration(ms.PauseTotalNs),
+	}
+
+	for _, info := range c.Router.ConnectionsInfo() {
+		ps := PeerStatus{ID: info.ID.String(), Connections: len(info.Remotes),
+			Tx: info.Tx, Rx: info.Rx}
+		for _, r := range info.Remotes {
+			ps.Remotes = append(ps.Remotes, r.String())
+		}
+		st.Peers = append(st.Peers, ps)
+	}
+	sort.Slice(st.Peers, func(i, j int) bool { return st.Peers[i].ID < st.Peers[j].ID })
+
+	for _, p := range c.overlay.adminProtocols() {
+		st.Protocols[p.Protocol]++
+	}
+
+	c.serviceManager.servicesMutex.Lock()
+	contexts := make(map[string]*Context)
+	for _, ctx := range c.serviceManager.contexts {
+		contexts[ServiceFactory.Name(ctx.serviceID)] = ctx
+	}
+	c.serviceManager.servicesMutex.Unlock()
+	for name, ctx := range contexts {
+		if ss, err := ctx.storageStats(); err == nil {
+			st.Storage[name] = StorageStatus{Used: ss.used, Quota: ss.quota,
+				Keys: ss.keys, Disk: ss.disk}
+		}
+		if suite := ServiceFactory.Suite(name); suite != nil {
+			st.Suites[name] = suite.String()
+		}
+	}
+	return st
+}
+
+// runtimeReporter adds the main figures of the RuntimeStatus to the status of
+// the conode.
+type runtimeReporter struct {
+	c *Server
+}
+
+// GetStatus implements StatusReporter.
+func (rr runtimeReporter) GetStatus() *Status {
+	st := rr.c.RuntimeStatus()
+	f := map[string]string{
+		"Version":     st.Version,
+		"GitHash":     st.GitHash,
+		"HeapAlloc":   strconv.FormatUint(st.Go.HeapAlloc, 10),
+		"Sys":         strconv.FormatUint(st.Go.Sys, 10),
+		"NumGC":       strconv.FormatUint(uint64(st.Go.NumGC), 10),
+		"GOMAXPROCS":  strconv.Itoa(st.Go.GOMAXPROCS),
+		"Peers":       strconv.Itoa(len(st.Peers)),
+		"ConodeSuite": st.Suites["conode"],
+	}
+	for name, n := range st.Protocols {
+		f["Protocols."+name] = strconv.Itoa(n)
+	}
+	for _, p := range st.Peers {
+		f["Connections."+p.ID] = strconv.Itoa(p.Connections)
+	}
+	return &Status{Field: f}
+}
@@ -0,0 +1,34 @@
+package onet
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_RuntimeStatus(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, ro, _ := local.GenTree(2, false)
+	s := servers[0]
+	_, err := s.Send(ro.List[1], &SimpleMessage{42})
+	require.NoError(t, err)
+
+	st := s.RuntimeStatus()
+	require.True(t, st.Uptime > 0)
+	require.NotEmpty(t, st.Version)
+	require.Equal(t, runtime.Version(), st.Go.Version)
+	require.True(t, st.Go.Goroutines > 0)
+	require.True(t, st.Go.HeapAlloc > 0)
+	require.Equal(t, 1, len(st.Peers))
+	require.Equal(t, ro.List[1].ID.String(), st.Peers[0].ID)
+	require.Equal(t, 1, st.Peers[0].Connections)
+	require.Contains(t, st.Storage, serviceWebSocket)
+	require.Equal(t, tSuite.String(), st.Suites["conode"])
+
+	rs := s.statusReporterStruct.ReportStatus()["Runtime"]
+	require.NotNil(t, rs)
+	require.Equal(t, "1", rs.Field["Peers"])
+	require.Equal(t, "1", rs.Field["Connections."+ro.List[1].ID.String()])
+}
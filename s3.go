@@ -0,0 +1,210 @@
+package onet
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// s3Client accesses a bucket of an S3-compatible object storage, like AWS S3
+// or MinIO, with path-style URLs and requests signed with AWS signature
+// version 4.
+type s3Client struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func newS3Client(endpoint, region, bucket, accessKey, secretKey string) (*s3Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing endpoint: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, xerrors.Errorf("endpoint %s isn't an http(s) URL", endpoint)
+	}
+	if bucket == "" {
+		return nil, xerrors.New("no bucket given")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &s3Client{
+		endpoint:  u,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+// s3Escape encodes a path or a query parameter as required by the
+// signature: everything but the unreserved characters, and the slashes of a
+// path.
+func s3Escape(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || path && c == '/' {
+			b.WriteByte(c)
+		} else {
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsSign signs the request with AWS signature version 4, for the service in
+// the region. The session token is only given with temporary credentials.
+func awsSign(req *http.Request, path string, body []byte, region, service,
+	accessKey, secretKey, sessionToken string) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	headers := "host:" + req.URL.Host + "\nx-amz-content-sha256:" + payloadHash +
+		"\nx-amz-date:" + amzDate + "\n"
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+		headers += "x-amz-security-token:" + sessionToken + "\n"
+		signed += ";x-amz-security-token"
+	}
+
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		headers,
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := now.Format("20060102") + "/" + region + "/" + service + "/aws4_request"
+	crHash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" +
+		hex.EncodeToString(crHash[:])
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), now.Format("20060102"))
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+
+		hex.EncodeToString(hmacSHA256(signingKey, toSign)))
+}
+
+// do sends a signed request for the object with the given key, or for the
+// bucket if it is empty.
+func (c *s3Client) do(method, key string, query url.Values, body []byte) ([]byte, error) {
+	path := strings.TrimSuffix(c.endpoint.Path, "/") + "/" + c.bucket
+	if key != "" {
+		path += "/" + key
+	}
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		params = append(params, s3Escape(k, false)+"="+s3Escape(query.Get(k), false))
+	}
+	rawQuery := strings.Join(params, "&")
+	u := *c.endpoint
+	u.Path = path
+	u.RawPath = s3Escape(path, true)
+	u.RawQuery = rawQuery
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, xerrors.Errorf("request: %v", err)
+	}
+	awsSign(req, u.RawPath, body, c.region, "s3", c.accessKey, c.secretKey, "")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("sending: %v", err)
+	}
+	defer resp.Body.Close()
+	reply, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<30))
+	if err != nil {
+		return nil, xerrors.Errorf("reading reply: %v", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, xerrors.Errorf("%s %s: %s: %s", method, key, resp.Status,
+			bytes.TrimSpace(reply))
+	}
+	return reply, nil
+}
+
+func (c *s3Client) put(key string, data []byte) error {
+	_, err := c.do(http.MethodPut, key, nil, data)
+	return err
+}
+
+func (c *s3Client) get(key string) ([]byte, error) {
+	return c.do(http.MethodGet, key, nil, nil)
+}
+
+func (c *s3Client) delete(key string) error {
+	_, err := c.do(http.MethodDelete, key, nil, nil)
+	return err
+}
+
+// list returns the keys of the objects starting with prefix, in order.
+func (c *s3Client) list(prefix string) ([]string, error) {
+	var keys []string
+	var token string
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		reply, err := c.do(http.MethodGet, "", q, nil)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := xml.Unmarshal(reply, &res); err != nil {
+			return nil, xerrors.Errorf("decoding list: %v", err)
+		}
+		for _, o := range res.Contents {
+			keys = append(keys, o.Key)
+		}
+		if !res.IsTruncated {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,218 @@
+package onet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// SentryConfig is the configuration of a SentryReporter, for example the
+// [Sentry] section of the configuration of a conode.
+type SentryConfig struct {
+	// DSN is the Data Source Name of the Sentry project receiving the
+	// events, like "https://<key>@sentry.example.com/<project>".
+	DSN string
+	// Environment of the conode, like "production".
+	Environment string `toml:",omitempty"`
+	// Release of the conode, like its version.
+	Release string `toml:",omitempty"`
+	// MaxPending is the number of events waiting to be sent, 100 if it is
+	// 0. The newer events are dropped.
+	MaxPending int `toml:",omitempty"`
+}
+
+// SentryReporter is an ErrorReporter sending the events to Sentry, in the
+// background.
+type SentryReporter struct {
+	cfg    SentryConfig
+	store  string
+	auth   string
+	client *http.Client
+
+	mut     sync.Mutex
+	closed  bool
+	dropped int
+	events  chan *ErrorEvent
+	done    chan struct{}
+}
+
+// NewSentryReporter returns a reporter sending the events to the Sentry
+// project of the DSN of the configuration. Close sends the last ones.
+func NewSentryReporter(cfg SentryConfig) (*SentryReporter, error) {
+	u, err := url.Parse(cfg.DSN)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing DSN: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, xerrors.Errorf("DSN %s isn't an http(s) URL", cfg.DSN)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, xerrors.New("no key in the DSN")
+	}
+	i := strings.LastIndex(u.Path, "/")
+	if i < 0 || u.Path[i+1:] == "" {
+		return nil, xerrors.New("no project in the DSN")
+	}
+	auth := "Sentry sentry_version=7, sentry_client=onet/3, sentry_key=" +
+		u.User.Username()
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 100
+	}
+	s := &SentryReporter{
+		cfg:    cfg,
+		store:  u.Scheme + "://" + u.Host + u.Path[:i] + "/api/" + u.Path[i+1:] + "/store/",
+		auth:   auth,
+		client: &http.Client{Timeout: 10 * time.Second},
+		events: make(chan *ErrorEvent, cfg.MaxPending),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// ReportError implements ErrorReporter. The event is dropped if too many
+// are waiting to be sent.
+func (s *SentryReporter) ReportError(ev *ErrorEvent) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- ev:
+	default:
+		s.dropped++
+	}
+}
+
+// Close sends the pending events and stops the reporter.
+func (s *SentryReporter) Close() {
+	s.mut.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mut.Unlock()
+	<-s.done
+}
+
+func (s *SentryReporter) run() {
+	defer close(s.done)
+	failing := false
+	for ev := range s.events {
+		err := s.send(ev)
+		switch {
+		case err != nil && !failing:
+			// a warning, as the errors of the log can be sent to Sentry
+			log.Warn("Couldn't send the error to Sentry:", err)
+		case err == nil && failing:
+			log.Info("Sending the errors to Sentry again")
+		}
+		failing = err != nil
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.dropped > 0 {
+		log.Warn("Dropped", s.dropped, "errors not sent to Sentry")
+	}
+}
+
+// sentryEvent is an event of the store API of Sentry.
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	Platform    string            `json:"platform"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Message     string            `json:"message"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+}
+
+// sentryLevel returns the level of Sentry of the severity.
+func sentryLevel(s log.Severity) string {
+	switch s {
+	case log.SeverityPanic, log.SeverityFatal:
+		return "fatal"
+	case log.SeverityError:
+		return "error"
+	case log.SeverityWarning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// send sends the event to the store API of Sentry. The conode, the service
+// and the part of the conode that panicked are tags of the event, the other
+// fields and the stack are extra data.
+func (s *SentryReporter) send(ev *ErrorEvent) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return xerrors.Errorf("event id: %v", err)
+	}
+	se := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   ev.Time.UTC().Format(time.RFC3339Nano),
+		Level:       sentryLevel(ev.Severity),
+		Logger:      "onet",
+		Platform:    "go",
+		ServerName:  ev.Conode,
+		Environment: s.cfg.Environment,
+		Release:     s.cfg.Release,
+		Message:     ev.Message,
+		Tags:        map[string]string{"conode": ev.Conode},
+		Extra:       make(map[string]string),
+	}
+	if ev.Service != "" {
+		se.Tags["service"] = ev.Service
+	}
+	for k, v := range ev.Fields {
+		if k == "where" {
+			se.Tags[k] = v
+		} else {
+			se.Extra[k] = v
+		}
+	}
+	if ev.Stack != "" {
+		se.Extra["stack"] = ev.Stack
+	}
+	body, err := json.Marshal(se)
+	if err != nil {
+		return xerrors.Errorf("encoding: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", s.store, bytes.NewReader(body))
+	if err != nil {
+		return xerrors.Errorf("request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return xerrors.Errorf("sending: %v", err)
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return xerrors.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package onet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestNewSentryReporter(t *testing.T) {
+	for _, dsn := range []string{"", "ftp://key@sentry/1", "https://sentry/1",
+		"https://key@sentry", "https://key@sentry/"} {
+		_, err := NewSentryReporter(SentryConfig{DSN: dsn})
+		require.Error(t, err, dsn)
+	}
+}
+
+func TestSentryReporter(t *testing.T) {
+	type request struct {
+		path  string
+		auth  string
+		event sentryEvent
+	}
+	requests := make(chan request, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		req.path = r.URL.Path
+		req.auth = r.Header.Get("X-Sentry-Auth")
+		buf, _ := ioutil.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(buf, &req.event))
+		requests <- req
+	}))
+	defer srv.Close()
+
+	s, err := NewSentryReporter(SentryConfig{
+		DSN:         strings.Replace(srv.URL, "//", "//public:secret@", 1) + "/prefix/42",
+		Environment: "test",
+	})
+	require.NoError(t, err)
+	s.ReportError(&ErrorEvent{
+		Time:     time.Now(),
+		Conode:   "tls://127.0.0.1:7770",
+		Service:  "Skipchain",
+		Severity: log.SeverityPanic,
+		Message:  "panic: deadbeef",
+		Stack:    "goroutine 1",
+		Fields:   map[string]string{"where": "service.request", "request": "GetBlock"},
+	})
+	s.Close()
+	// the events after Close are ignored
+	s.ReportError(&ErrorEvent{})
+
+	req := <-requests
+	require.Equal(t, "/prefix/api/42/store/", req.path)
+	require.Contains(t, req.auth, "sentry_key=public")
+	require.Contains(t, req.auth, "sentry_secret=secret")
+	require.Len(t, req.event.EventID, 32)
+	require.Equal(t, "fatal", req.event.Level)
+	require.Equal(t, "test", req.event.Environment)
+	require.Equal(t, "panic: deadbeef", req.event.Message)
+	require.Equal(t, map[string]string{"conode": "tls://127.0.0.1:7770",
+		"service": "Skipchain", "where": "service.request"}, req.event.Tags)
+	require.Equal(t, map[string]string{"request": "GetBlock",
+		"stack": "goroutine 1"}, req.event.Extra)
+	require.Len(t, requests, 0)
+}
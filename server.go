@@ -43,6 +43,143 @@ type Server struct {
 	IsStarted      bool
 
 	suite network.Suite
+	// configuration of the services, indexed by their name
+	serviceConfigs map[string]interface{}
+	// storage quotas of the services in bytes, indexed by their name
+	storageQuotas map[string]int64
+	// backend of the database of the services
+	storageBackend string
+	// encryption of the database, nil if it is disabled
+	storageEncryption *StorageEncryption
+	// key the database derives from, nil for the key of the server
+	storageKey kyber.Scalar
+	// are the values of the database checksummed?
+	storageIntegrity bool
+	// snapshot restored at startup, nil if there is none
+	storageRestore *StorageRestore
+	// compacts the database, nil if it isn't scheduled
+	compaction *compactionScheduler
+	// ships the backups of the database, nil if they aren't configured
+	backup *backupScheduler
+	// removes the expired keys of the services
+	ttl *ttlSweeper
+	// transfers of the storage of a service waiting for their chunks
+	stateTransfers *stateTransfers
+	// transitions of the keys announced by the other conodes
+	keyTransitions *keyTransitions
+	// versions of the other conodes not matching ours
+	versionSkew *versionSkew
+	// changes of the keys of the services
+	serviceKeys *serviceKeys
+	// checks the address when the server starts, nil if it isn't configured
+	publicAddress *publicAddress
+	// networks allowed to connect to the router and the websocket, see
+	// SetIPFilter
+	ipFilter *network.IPFilter
+	// checks served on /healthz and /readyz
+	health *healthChecks
+	// collectors served on /metrics
+	metrics *metricsRegistry
+	// reports of the panics recovered in the protocols and the services
+	crashes *crashReporter
+	// events are sent to the subscribers of the server
+	events *eventBus
+	// maintenance mode, see EnterMaintenance
+	maintenance *maintenanceState
+	// local admin interface, nil if it is disabled
+	admin *adminServer
+	// behavior of the server in simulations, see SetByzantine
+	byzantine byzantineState
+	// clock of the timers of the simulations, see SetClock
+	clock Clock
+	// intercept the messages sent by the server in tests, see
+	// LocalTest.Intercept
+	interceptors interceptors
+}
+
+// ServerOptions holds the parameters of a Server that need to be known when
+// it is created.
+type ServerOptions struct {
+	// ListenAddress is the address the router listens on. If it is empty,
+	// the address of the ServerIdentity is used.
+	ListenAddress string
+	// ServiceConfigs holds the configuration of the services, indexed by
+	// the name of the service. Services without an entry get their default
+	// configuration.
+	ServiceConfigs map[string]interface{}
+	// StorageQuotas holds the maximum number of bytes each service may
+	// store in the database, indexed by the name of the service. Services
+	// without an entry have no limit.
+	StorageQuotas map[string]int64
+	// StorageBackend is the backend of the database of the services, e.g.,
+	// StoreBackendMemory or a backend added with RegisterStoreBackend. If it
+	// is empty, a bbolt file is used.
+	StorageBackend string
+	// StorageEncryption, if not nil, encrypts the values stored by the
+	// services.
+	StorageEncryption *StorageEncryption
+	// StorageKey, if not nil, is the private key the database derives from,
+	// instead of the one of the server: the name of its file, the prefix of
+	// its backups and the key of StorageEncryption given by the conode. A
+	// conode keeps its first key there when it rotates its key, so that it
+	// finds its database again.
+	StorageKey kyber.Scalar
+	// StorageIntegrity maintains checksums of the values stored by the
+	// services, verified at startup and with VerifyStorage. The values not
+	// matching their checksum are not returned to the services.
+	StorageIntegrity bool
+	// Restore, if not nil, restores the database of the services from a
+	// snapshot before starting them.
+	Restore *StorageRestore
+	// Compaction, if not nil, schedules the compaction of the database.
+	Compaction *CompactionConfig
+	// Backup, if not nil, ships backups of the database to an
+	// S3-compatible object storage.
+	Backup *BackupConfig
+	// MetricsToken, if not empty, must be given as a bearer token to
+	// access the /metrics endpoint.
+	MetricsToken string
+	// CORS is the policy for browsers accessing the API. If nil, all
+	// origins are allowed.
+	CORS *CORSConfig
+	// ServiceCORS overrides the CORS policy for some services, indexed by
+	// the name of the service.
+	ServiceCORS map[string]*CORSConfig
+	// Audit, if not nil, configures the log where all client requests are
+	// recorded.
+	Audit *AuditConfig
+	// Admin, if not nil, configures the local admin interface.
+	Admin *AdminConfig
+	// Clock, if not nil, replaces the real time for the timeouts of the
+	// server, see SetClock.
+	Clock Clock
+	// KeepAlive, if not zero, is the interval between the pings sent to the
+	// other conodes, measuring the round-trip times exported on /metrics.
+	KeepAlive time.Duration
+	// Crash, if not nil, writes a report of every panic recovered in the
+	// protocols and the services.
+	Crash *CrashConfig
+	// Sentry, if not nil, sends the panics recovered in the protocols and
+	// the services to Sentry, see also SetErrorReporter.
+	Sentry *SentryConfig
+	// StrictVersions closes the connections to the conodes running versions
+	// of onet or of the protocols incompatible with ours, instead of only
+	// reporting them.
+	StrictVersions bool
+	// Suites, if not nil, are the suites accepted from the other conodes
+	// besides the one of the conode, which are then negotiated when a
+	// connection is opened. See network.Router.SetSuites.
+	Suites []string
+	// SaveServiceKeys, if not nil, is called with all the key pairs of the
+	// services when one of them is generated or rotated, to keep them in the
+	// configuration of the conode.
+	SaveServiceKeys func([]network.ServiceIdentity) error
+	// PublicAddress, if not nil, checks when the server starts that its
+	// address has its public IP.
+	PublicAddress *PublicAddressConfig
+	// IPFilter, if not nil, are the networks allowed and denied to connect
+	// to the router and the websocket. It can be changed with SetIPFilter.
+	IPFilter *network.IPFilterConfig
 }
 
 func dbPathFromEnv() string {
@@ -58,6 +195,11 @@ func dbPathFromEnv() string {
 // location. If dbPath is != "", it is considered a temp dir, and the
 // DB is deleted on close.
 func newServer(s network.Suite, dbPath string, r *network.Router, pkey kyber.Scalar) *Server {
+	return newServerWithOptions(s, dbPath, r, pkey, ServerOptions{})
+}
+
+func newServerWithOptions(s network.Suite, dbPath string, r *network.Router,
+	pkey kyber.Scalar, opts ServerOptions) *Server {
 	delDb := false
 	if dbPath == "" {
 		dbPath = dbPathFromEnv()
@@ -73,11 +215,87 @@ func newServer(s network.Suite, dbPath string, r *network.Router, pkey kyber.Sca
 		protocols:            newProtocolStorage(),
 		suite:                s,
 		closeitChannel:       make(chan bool),
+		serviceConfigs:       opts.ServiceConfigs,
+		storageQuotas:        opts.StorageQuotas,
+		storageBackend:       opts.StorageBackend,
+		storageEncryption:    opts.StorageEncryption,
+		storageKey:           opts.StorageKey,
+		storageRestore:       opts.Restore,
+		storageIntegrity:     opts.StorageIntegrity,
+		health:               newHealthChecks(),
+		metrics:              newMetricsRegistry(opts.MetricsToken),
+		maintenance:          newMaintenanceState(),
+		clock:                realClock{},
+	}
+	crashes, err := newCrashReporter(r.ServerIdentity.Address.String(), opts.Crash)
+	log.ErrFatal(err, "Couldn't write crash reports")
+	c.crashes = crashes
+	c.events = newEventBus()
+	r.AddPeerHandler(func(si *network.ServerIdentity, up bool) {
+		ev := Event{Type: EventPeerDown, Peer: si}
+		if up {
+			ev.Type = EventPeerUp
+		}
+		c.events.publish(ev)
+	})
+	if opts.Sentry != nil {
+		sentry, err := NewSentryReporter(*opts.Sentry)
+		log.ErrFatal(err, "Couldn't report the errors to Sentry")
+		c.crashes.sentry = sentry
 	}
 	c.overlay = NewOverlay(c)
+	if opts.KeepAlive > 0 {
+		r.SetKeepAlive(opts.KeepAlive)
+	}
+	if opts.Suites != nil {
+		log.ErrFatal(r.SetSuites(opts.Suites), "Couldn't allow the suites")
+	}
+	if opts.Clock != nil {
+		c.SetClock(opts.Clock)
+	}
 	c.WebSocket = NewWebSocket(r.ServerIdentity)
+	c.WebSocket.SetCORS(opts.CORS, opts.ServiceCORS)
+	c.WebSocket.maintenance = c.maintenance
+	c.WebSocket.crashes = c.crashes
+	c.ipFilter = &network.IPFilter{}
+	if opts.IPFilter != nil {
+		log.ErrFatal(c.ipFilter.Set(*opts.IPFilter), "Couldn't filter the connections")
+	}
+	r.SetIPFilter(c.ipFilter)
+	c.WebSocket.ipFilter = c.ipFilter
+	if opts.Audit != nil {
+		audit, err := NewAuditLog(*opts.Audit)
+		log.ErrFatal(err, "Couldn't open audit log")
+		c.WebSocket.SetAuditLog(audit)
+	}
 	c.serviceManager = newServiceManager(c, c.overlay, dbPath, delDb)
+	c.ttl = newTTLSweeper(StorageTTLSweepInterval)
+	c.registerStateTransfer()
+	c.registerKeyRotation()
+	c.registerVersionSkew(opts.StrictVersions)
+	c.serviceKeys = &serviceKeys{save: opts.SaveServiceKeys}
+	log.ErrFatal(c.registerPublicAddress(opts.PublicAddress),
+		"Couldn't check the public address")
+	if opts.Compaction != nil {
+		cs, err := newCompactionScheduler(*opts.Compaction)
+		log.ErrFatal(err, "Couldn't schedule compaction")
+		c.compaction = cs
+	}
+	if opts.Backup != nil {
+		bs, err := newBackupScheduler(*opts.Backup, c.storagePublic())
+		log.ErrFatal(err, "Couldn't schedule backups")
+		c.backup = bs
+		c.statusReporterStruct.RegisterStatusReporter("Backup", bs)
+	}
 	c.statusReporterStruct.RegisterStatusReporter("Generic", c)
+	c.statusReporterStruct.RegisterStatusReporter("Runtime", runtimeReporter{c})
+	c.registerHealthEndpoints()
+	c.registerMetricsEndpoint()
+	if opts.Admin != nil {
+		admin, err := newAdminServer(c, *opts.Admin)
+		log.ErrFatal(err, "Couldn't start admin interface")
+		c.admin = admin
+	}
 	return c
 }
 
@@ -93,9 +311,24 @@ func NewServerTCP(e *network.ServerIdentity, suite network.Suite) *Server {
 // TcpRouter listening on the given address as Router.
 func NewServerTCPWithListenAddr(e *network.ServerIdentity, suite network.Suite,
 	listenAddr string) *Server {
-	r, err := network.NewTCPRouterWithListenAddr(e, suite, listenAddr)
+	return NewServerTCPWithOptions(e, suite, ServerOptions{ListenAddress: listenAddr})
+}
+
+// NewServerTCPWithOptions returns a new Server out of a private-key and its
+// related public key within the ServerIdentity, configured with the given
+// options. The server will use a TcpRouter as Router. If the port of the
+// address is 0, the router and the websocket bind free ports, which are
+// advertised in the address and the URL of the ServerIdentity.
+func NewServerTCPWithOptions(e *network.ServerIdentity, suite network.Suite,
+	opts ServerOptions) *Server {
+	anyPort := e.Address.Port() == "0"
+	r, err := network.NewTCPRouterWithListenAddr(e, suite, opts.ListenAddress)
 	log.ErrFatal(err)
-	return newServer(suite, "", r, e.GetPrivate())
+	c := newServerWithOptions(suite, "", r, e.GetPrivate(), opts)
+	if anyPort {
+		c.WebSocket.listenOnAnyPort(e)
+	}
+	return c
 }
 
 // Suite can (and should) be used to get the underlying Suite.
@@ -126,7 +359,11 @@ func (c *Server) GetStatus() *Status {
 		"Description": c.ServerIdentity.Description,
 		"ConnType":    string(c.ServerIdentity.Address.ConnType()),
 		"GoRoutines":  fmt.Sprintf("%v", runtime.NumGoroutine()),
+		"Maintenance": strconv.FormatBool(c.InMaintenance()),
 	}}
+	if c.ServerIdentity.URL != "" {
+		st.Field["URL"] = c.ServerIdentity.URL
+	}
 
 	goverOnce.Do(func() {
 		v, err := version.ReadExe(os.Args[0])
@@ -159,7 +396,28 @@ func (c *Server) Close() error {
 		log.Error("While stopping router:", err)
 	}
 	c.WebSocket.stop()
+	if c.admin != nil {
+		if err := c.admin.close(); err != nil {
+			log.Error("While closing admin interface:", err)
+		}
+	}
+	if audit := c.WebSocket.auditLog(); audit != nil {
+		if err := audit.Close(); err != nil {
+			log.Error("While closing audit log:", err)
+		}
+	}
 	c.overlay.Close()
+	if c.compaction != nil {
+		c.compaction.close()
+	}
+	if c.backup != nil {
+		c.backup.close()
+	}
+	c.ttl.close()
+	c.events.close()
+	if c.crashes.sentry != nil {
+		c.crashes.sentry.Close()
+	}
 	err = c.serviceManager.closeDatabase()
 	if err != nil {
 		err = xerrors.Errorf("closing db: %v", err)
@@ -169,6 +427,22 @@ func (c *Server) Close() error {
 	return err
 }
 
+// Crash emulates the crash of the server for simulations: it loses its
+// protocol instances, drops the messages it receives and can't send any,
+// except for the messages of the given types. The storage of the services is
+// kept. Restart brings the server back.
+func (c *Server) Crash(except ...network.MessageTypeID) {
+	log.Lvl2(c.ServerIdentity, "crashes")
+	c.Router.SetOffline(true, except...)
+	c.overlay.closeInstances()
+}
+
+// Restart brings back a server after a Crash.
+func (c *Server) Restart() {
+	log.Lvl2(c.ServerIdentity, "restarts")
+	c.Router.SetOffline(false)
+}
+
 // Address returns the address used by the Router.
 func (c *Server) Address() network.Address {
 	return c.ServerIdentity.Address
@@ -197,10 +471,14 @@ func (c *Server) ProtocolRegister(name string, protocol NewProtocol) (ProtocolID
 
 // protocolInstantiate instantiate a protocol from its ID
 func (c *Server) protocolInstantiate(protoID ProtocolID, tni *TreeNodeInstance) (ProtocolInstance, error) {
-	fn, ok := c.protocols.instantiators[c.protocols.ProtocolIDToName(protoID)]
+	name := c.protocols.ProtocolIDToName(protoID)
+	fn, ok := c.protocols.instantiators[name]
 	if !ok {
 		return nil, xerrors.New("No protocol constructor with this ID")
 	}
+	if byz := c.byzantineProtocol(name); byz != nil {
+		fn = byz
+	}
 	pi, err := fn(tni)
 	if err != nil {
 		return nil, xerrors.Errorf("creating protocol: %v", err)
@@ -209,8 +487,14 @@ func (c *Server) protocolInstantiate(protoID ProtocolID, tni *TreeNodeInstance)
 }
 
 // Start makes the router and the WebSocket listen on their respective
-// ports. It returns once all servers are started.
+// ports. It returns once all servers are started. With PublicAddress in its
+// options, the address of the server is checked first. The protocol
+// instances saved by CheckpointProtocols are resumed before the messages of
+// the other conodes are received.
 func (c *Server) Start() {
+	if c.publicAddress != nil {
+		c.checkPublicAddress()
+	}
 	InformServerStarted()
 	c.started = time.Now()
 	if !c.Quiet {
@@ -218,8 +502,19 @@ func (c *Server) Start() {
 			c.started.Format("2006-01-02 15:04:05"),
 			c.ServerIdentity.Address)
 	}
+	c.resumeProtocols()
 	go c.Router.Start()
 	go c.WebSocket.start()
+	if c.admin != nil {
+		go c.admin.serve()
+	}
+	if c.compaction != nil {
+		c.compaction.start(c.serviceManager)
+	}
+	if c.backup != nil {
+		c.backup.start(c.serviceManager)
+	}
+	c.ttl.start(c.serviceManager)
 	for !c.Router.Listening() || !c.WebSocket.Listening() {
 		time.Sleep(50 * time.Millisecond)
 	}
@@ -1,10 +1,13 @@
 package onet
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
 	bbolt "go.etcd.io/bbolt"
 	uuid "gopkg.in/satori/go.uuid.v1"
 )
@@ -34,10 +37,11 @@ func TestServer_GetService(t *testing.T) {
 
 func TestServer_Database(t *testing.T) {
 	c := NewLocalServer(tSuite, 0)
-	require.NotNil(t, c.serviceManager.db)
+	db := c.serviceManager.store.(*boltStore).db
+	require.NotNil(t, db)
 
 	for _, s := range c.serviceManager.availableServices() {
-		c.serviceManager.db.Update(func(tx *bbolt.Tx) error {
+		db.Update(func(tx *bbolt.Tx) error {
 			b := tx.Bucket([]byte(s))
 			require.NotNil(t, b)
 			return nil
@@ -46,6 +50,26 @@ func TestServer_Database(t *testing.T) {
 	c.Close()
 }
 
+func TestServer_Crash(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(2, true)
+	_, err := servers[0].ProtocolRegister("ServerProtocolCrash", NewServerProtocol)
+	require.NoError(t, err)
+	_, err = servers[0].CreateProtocol("ServerProtocolCrash", tree)
+	require.NoError(t, err)
+	require.Equal(t, 1, servers[0].overlay.instancesCount())
+
+	servers[0].Crash()
+	require.Equal(t, 0, servers[0].overlay.instancesCount())
+	_, err = servers[0].Send(servers[1].ServerIdentity, &SimpleMessage{})
+	require.Error(t, err)
+
+	servers[0].Restart()
+	_, err = servers[0].Send(servers[1].ServerIdentity, &SimpleMessage{})
+	require.NoError(t, err)
+}
+
 type ServerProtocol struct {
 	*TreeNodeInstance
 }
@@ -63,3 +87,30 @@ func NewServerProtocol2(n *TreeNodeInstance) (ProtocolInstance, error) {
 func (cp *ServerProtocol) Start() error {
 	return nil
 }
+
+func TestServer_AnyPort(t *testing.T) {
+	kp := key.NewKeyPair(tSuite)
+	si := network.NewServerIdentity(kp.Public, network.NewTCPAddress("127.0.0.1:0"))
+	si.SetPrivate(kp.Private)
+	c := NewServerTCPWithOptions(si, tSuite, ServerOptions{})
+	c.StartInBackground()
+	defer c.Close()
+
+	require.NotEqual(t, "0", c.ServerIdentity.Address.Port())
+	require.NotEqual(t, "", c.ServerIdentity.URL)
+	require.Equal(t, c.ServerIdentity.URL, c.GetStatus().Field["URL"])
+	resp, err := http.Get(c.ServerIdentity.URL + "/ok")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the peers reach the router at the advertised address
+	kp2 := key.NewKeyPair(tSuite)
+	si2 := network.NewServerIdentity(kp2.Public, network.NewTCPAddress("127.0.0.1:0"))
+	si2.SetPrivate(kp2.Private)
+	c2 := NewServerTCPWithOptions(si2, tSuite, ServerOptions{})
+	c2.StartInBackground()
+	defer c2.Close()
+	_, err = c2.Send(c.ServerIdentity, &SimpleMessage{})
+	require.NoError(t, err)
+}
@@ -1,13 +1,16 @@
 package onet
 
 import (
+	"crypto/cipher"
 	"crypto/sha256"
 	"fmt"
 	"net/http"
 	"os"
 	"path"
+	"reflect"
 	"strconv"
 	"sync"
+	"time"
 
 	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/kyber/v3/util/key"
@@ -113,6 +116,10 @@ type serviceEntry struct {
 	serviceID   ServiceID
 	name        string
 	suite       suites.Suite
+	// config holds the default configuration of the service, if any
+	config interface{}
+	// migrations of the data of the service, see RegisterServiceMigrations
+	migrations []Migration
 }
 
 // ServiceFactory is the global service factory to instantiate Services
@@ -187,6 +194,52 @@ func UnregisterService(name string) error {
 	return nil
 }
 
+// SetConfig attaches a configuration to the service with the given name.
+// The config must be a pointer to a struct holding the default values. When
+// the server is created, these defaults are overwritten with the values
+// found in the service's section of the server configuration.
+func (s *serviceFactory) SetConfig(name string, config interface{}) error {
+	if config == nil || reflect.TypeOf(config).Kind() != reflect.Ptr ||
+		reflect.TypeOf(config).Elem().Kind() != reflect.Struct {
+		return xerrors.New("config must be a pointer to a struct")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := range s.constructors {
+		if s.constructors[i].name == name {
+			s.constructors[i].config = config
+			return nil
+		}
+	}
+	return xerrors.New("Didn't find service " + name)
+}
+
+// NewConfig returns a copy of the default configuration of the service, or
+// nil if the service has no configuration.
+func (s *serviceFactory) NewConfig(name string) interface{} {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, c := range s.constructors {
+		if name == c.name && c.config != nil {
+			def := reflect.ValueOf(c.config)
+			cp := reflect.New(def.Type().Elem())
+			cp.Elem().Set(def.Elem())
+			return cp.Interface()
+		}
+	}
+	return nil
+}
+
+// RegisterServiceConfig attaches a configuration with its default values to
+// an already registered service. See serviceFactory.SetConfig.
+func RegisterServiceConfig(name string, config interface{}) error {
+	err := ServiceFactory.SetConfig(name, config)
+	if err != nil {
+		return xerrors.Errorf("register config: %v", err)
+	}
+	return nil
+}
+
 // registeredServiceIDs returns all the services registered
 func (s *serviceFactory) registeredServiceIDs() []ServiceID {
 	s.mutex.RLock()
@@ -202,11 +255,23 @@ func (s *serviceFactory) registeredServiceIDs() []ServiceID {
 // have a suite registered with them. Other ones will use the default
 // suite and the associated key pair.
 func (s *serviceFactory) generateKeyPairs(si *network.ServerIdentity) {
+	s.generateKeyPairsFrom(si, nil)
+}
+
+// generateKeyPairsFrom is generateKeyPairs with the keys picked from the
+// random stream, or from the ones of the suites if it is nil.
+func (s *serviceFactory) generateKeyPairsFrom(si *network.ServerIdentity,
+	stream cipher.Stream) {
 	services := []network.ServiceIdentity{}
 	for _, name := range ServiceFactory.RegisteredServiceNames() {
 		suite := ServiceFactory.Suite(name)
 		if suite != nil {
-			pair := key.NewKeyPair(suite)
+			var pair *key.Pair
+			if stream == nil {
+				pair = key.NewKeyPair(suite)
+			} else {
+				pair = key.NewKeyPair(&seededSuite{Suite: suite, stream: stream})
+			}
 			sid := network.NewServiceIdentityFromPair(name, suite, pair)
 
 			services = append(services, sid)
@@ -305,13 +370,23 @@ func (s *serviceFactory) start(name string, con *Context) (Service, error) {
 type serviceManager struct {
 	// the actual services
 	services map[ServiceID]Service
+	// the contexts of the services
+	contexts map[ServiceID]*Context
 	// making sure we're not racing for services
 	servicesMutex sync.Mutex
 	// the onet host
 	server *Server
-	// a bbolt database for all services
-	db     *bbolt.DB
-	dbPath string
+	// the database of all services
+	store   Store
+	backend string
+	// are the values encrypted?
+	encrypted bool
+	// statistics of the compactions of the store
+	compaction compactionStats
+	// last verification of the checksums, if they are enabled
+	integrity      *IntegrityReport
+	integrityMutex sync.Mutex
+	dbPath         string
 	// should the db be deleted on close?
 	delDb bool
 	// the dispatcher can take registration of Processors
@@ -323,6 +398,7 @@ func newServiceManager(srv *Server, o *Overlay, dbPath string, delDb bool) *serv
 	services := make(map[ServiceID]Service)
 	s := &serviceManager{
 		services:   services,
+		contexts:   make(map[ServiceID]*Context),
 		server:     srv,
 		dbPath:     dbPath,
 		delDb:      delDb,
@@ -331,11 +407,47 @@ func newServiceManager(srv *Server, o *Overlay, dbPath string, delDb bool) *serv
 
 	s.updateDbFileName()
 
-	db, err := openDb(s.dbFileName())
+	s.backend = srv.storageBackend
+	if s.backend == "" {
+		s.backend = StoreBackendBbolt
+	}
+	store, err := openStore(s.backend, s.dbFileName())
 	if err != nil {
 		log.Panic("Failed to create new database: " + err.Error())
 	}
-	s.db = db
+	if r := srv.storageRestore; r != nil {
+		if err := restoreSnapshot(store, *r); err != nil {
+			log.Panic("Failed to restore database: " + err.Error())
+		}
+	}
+	if enc := srv.storageEncryption; enc != nil {
+		store, err = s.encryptStore(store, *enc)
+		if err != nil {
+			log.Panic("Failed to encrypt database: " + err.Error())
+		}
+	} else if enc, err := storeEncrypted(store); err != nil {
+		log.Panic("Failed to read database: " + err.Error())
+	} else if enc {
+		log.Panic("Database encrypted, but no StorageEncryption configured")
+	}
+	if srv.storageIntegrity {
+		store, err = newIntegrityStore(store)
+		if err != nil {
+			log.Panic("Failed to checksum database: " + err.Error())
+		}
+	} else if err := dropIntegrity(store); err != nil {
+		log.Panic("Failed to remove checksums: " + err.Error())
+	}
+	s.store = store
+	if srv.storageIntegrity {
+		report, err := s.verifyIntegrity()
+		if err != nil {
+			log.Panic("Failed to verify database: " + err.Error())
+		}
+		if len(report.Corrupted) > 0 {
+			log.Error("Found", len(report.Corrupted), "corrupted keys in the database")
+		}
+	}
 
 	for name, inst := range protocols.instantiators {
 		log.Lvl4("Registering global protocol", name)
@@ -356,31 +468,60 @@ func newServiceManager(srv *Server, o *Overlay, dbPath string, delDb bool) *serv
 		log.Lvl3("Started Service", name)
 		s.servicesMutex.Lock()
 		services[id] = srvc
+		s.contexts[id] = cont
 		s.servicesMutex.Unlock()
 		srv.WebSocket.registerService(name, srvc)
 	}
 	log.Lvl3(srv.Address(), "instantiated all services")
 	srv.statusReporterStruct.RegisterStatusReporter("Db", s)
+	srv.statusReporterStruct.RegisterStatusReporter("Storage", storageReporter{s})
 	return s
 }
 
+// DatabaseLockTimeout is how long a database locked by another process, like
+// the previous process of an upgraded conode finishing its work, is waited
+// for before giving up.
+var DatabaseLockTimeout = time.Minute
+
 // openDb opens a database at `path`. It creates the database if it does not exist.
 // The caller must ensure that all parent directories exist.
 func openDb(path string) (*bbolt.DB, error) {
-	db, err := bbolt.Open(path, 0600, nil)
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err == bbolt.ErrTimeout {
+		log.Lvl1("Waiting for another process to close the database", path)
+		db, err = bbolt.Open(path, 0600, &bbolt.Options{Timeout: DatabaseLockTimeout})
+	}
 	if err != nil {
 		return nil, xerrors.Errorf("opening db: %v", err)
 	}
 	return db, nil
 }
 
+// encryptStore returns the store encrypting the values written in store. The
+// store is closed if it fails.
+func (s *serviceManager) encryptStore(store Store, enc StorageEncryption) (Store, error) {
+	key, err := enc.key(s.server.storagePrivate())
+	if err == nil {
+		var es Store
+		es, err = newEncryptedStore(store, key)
+		if err == nil {
+			s.encrypted = true
+			return es, nil
+		}
+	}
+	if cerr := store.Close(); cerr != nil {
+		log.Error("Close database failed with: " + cerr.Error())
+	}
+	return nil, err
+}
+
 func (s *serviceManager) dbFileNameOld() string {
-	pub, _ := s.server.ServerIdentity.Public.MarshalBinary()
+	pub, _ := s.server.storagePublic().MarshalBinary()
 	return path.Join(s.dbPath, fmt.Sprintf("%x.db", pub))
 }
 
 func (s *serviceManager) dbFileName() string {
-	pub, _ := s.server.ServerIdentity.Public.MarshalBinary()
+	pub, _ := s.server.storagePublic().MarshalBinary()
 	h := sha256.New()
 	h.Write(pub)
 	return path.Join(s.dbPath, fmt.Sprintf("%x.db", h.Sum(nil)))
@@ -408,49 +549,69 @@ func (s *serviceManager) Process(env *network.Envelope) {
 // closeDatabase closes the database.
 // It also removes the database file if the path is not default (i.e. testing config)
 func (s *serviceManager) closeDatabase() error {
-	if s.db != nil {
-		err := s.db.Close()
+	if s.store != nil {
+		err := s.store.Close()
 		if err != nil {
 			log.Error("Close database failed with: " + err.Error())
 		}
 	}
 
 	if s.delDb {
-		err := os.Remove(s.dbFileName())
+		// some backends use a directory, and some don't write anything
+		err := os.RemoveAll(s.dbFileName())
 		if err != nil {
 			return xerrors.Errorf("removing file: %v", err)
 		}
+		// state of the backups, if any
+		os.Remove(s.dbFileName() + ".backup")
 	}
 	return nil
 }
 
 // GetStatus is a function that returns the status report of the server.
 func (s *serviceManager) GetStatus() *Status {
-	if s.db == nil {
+	if s.store == nil {
 		return &Status{Field: map[string]string{"Open": "false"}}
 	}
-	st := s.db.Stats()
-	return &Status{Field: map[string]string{
-		"Open":             "true",
-		"FreePageN":        strconv.Itoa(st.FreePageN),
-		"PendingPageN":     strconv.Itoa(st.PendingPageN),
-		"FreeAlloc":        strconv.Itoa(st.FreeAlloc),
-		"FreelistInuse":    strconv.Itoa(st.FreelistInuse),
-		"TxN":              strconv.Itoa(st.TxN),
-		"OpenTxN":          strconv.Itoa(st.OpenTxN),
-		"Tx.PageCount":     strconv.Itoa(st.TxStats.PageCount),
-		"Tx.PageAlloc":     strconv.Itoa(st.TxStats.PageAlloc),
-		"Tx.CursorCount":   strconv.Itoa(st.TxStats.CursorCount),
-		"Tx.NodeCount":     strconv.Itoa(st.TxStats.NodeCount),
-		"Tx.NodeDeref":     strconv.Itoa(st.TxStats.NodeDeref),
-		"Tx.Rebalance":     strconv.Itoa(st.TxStats.Rebalance),
-		"Tx.RebalanceTime": st.TxStats.RebalanceTime.String(),
-		"Tx.Split":         strconv.Itoa(st.TxStats.Split),
-		"Tx.Spill":         strconv.Itoa(st.TxStats.Spill),
-		"Tx.SpillTime":     st.TxStats.SpillTime.String(),
-		"Tx.Write":         strconv.Itoa(st.TxStats.Write),
-		"Tx.WriteTime":     st.TxStats.WriteTime.String(),
-	}}
+	f := map[string]string{
+		"Open":      "true",
+		"Backend":   s.backend,
+		"Encrypted": strconv.FormatBool(s.encrypted),
+	}
+	s.compaction.statusFields(f)
+	s.integrityMutex.Lock()
+	if r := s.integrity; r != nil {
+		f["Integrity.Last"] = r.Time.Format(time.RFC3339)
+		f["Integrity.Corrupted"] = strconv.Itoa(len(r.Corrupted))
+	}
+	s.integrityMutex.Unlock()
+	bs, ok := unwrapStore(s.store).(*boltStore)
+	if !ok {
+		return &Status{Field: f}
+	}
+	if service := bs.exposedTo(); service != "" {
+		f["Compaction.Disabled"] = "service " + service + " uses the database directly"
+	}
+	st := bs.stats()
+	f["FreePageN"] = strconv.Itoa(st.FreePageN)
+	f["PendingPageN"] = strconv.Itoa(st.PendingPageN)
+	f["FreeAlloc"] = strconv.Itoa(st.FreeAlloc)
+	f["FreelistInuse"] = strconv.Itoa(st.FreelistInuse)
+	f["TxN"] = strconv.Itoa(st.TxN)
+	f["OpenTxN"] = strconv.Itoa(st.OpenTxN)
+	f["Tx.PageCount"] = strconv.Itoa(st.TxStats.PageCount)
+	f["Tx.PageAlloc"] = strconv.Itoa(st.TxStats.PageAlloc)
+	f["Tx.CursorCount"] = strconv.Itoa(st.TxStats.CursorCount)
+	f["Tx.NodeCount"] = strconv.Itoa(st.TxStats.NodeCount)
+	f["Tx.NodeDeref"] = strconv.Itoa(st.TxStats.NodeDeref)
+	f["Tx.Rebalance"] = strconv.Itoa(st.TxStats.Rebalance)
+	f["Tx.RebalanceTime"] = st.TxStats.RebalanceTime.String()
+	f["Tx.Split"] = strconv.Itoa(st.TxStats.Split)
+	f["Tx.Spill"] = strconv.Itoa(st.TxStats.Spill)
+	f["Tx.SpillTime"] = st.TxStats.SpillTime.String()
+	f["Tx.Write"] = strconv.Itoa(st.TxStats.Write)
+	f["Tx.WriteTime"] = st.TxStats.WriteTime.String()
+	return &Status{Field: f}
 }
 
 // registerProcessor the processor to the service manager and tells the host to dispatch
@@ -536,6 +697,7 @@ func (s *serviceManager) newProtocol(tni *TreeNodeInstance, config *GenericConfi
 			pi = nil
 			err = xerrors.Errorf("could not create new protocol: %v at %s",
 				r, log.Stack())
+			tni.reportPanic("service.NewProtocol", r)
 		}
 	}()
 
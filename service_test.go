@@ -71,6 +71,36 @@ func TestServiceRegistration(t *testing.T) {
 	UnregisterService(nameWithSuite)
 }
 
+type dummyServiceConfig struct {
+	Name  string
+	Count int
+}
+
+func TestServiceConfig(t *testing.T) {
+	name := "dummyWithConfig"
+	cfgs := make(chan interface{}, 1)
+	RegisterNewService(name, func(c *Context) (Service, error) {
+		cfgs <- c.ServiceConfig()
+		return &DummyService{}, nil
+	})
+	defer UnregisterService(name)
+
+	require.Error(t, RegisterServiceConfig(name, dummyServiceConfig{}))
+	require.Error(t, RegisterServiceConfig("unknown", &dummyServiceConfig{}))
+	require.NoError(t, RegisterServiceConfig(name, &dummyServiceConfig{Count: 3}))
+
+	// Every call returns a new copy of the defaults.
+	def := ServiceFactory.NewConfig(name).(*dummyServiceConfig)
+	def.Count = 4
+	require.Equal(t, 3, ServiceFactory.NewConfig(name).(*dummyServiceConfig).Count)
+	require.Nil(t, ServiceFactory.NewConfig(dummyService2Name))
+
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	local.GenServers(1)
+	require.Equal(t, &dummyServiceConfig{Count: 3}, <-cfgs)
+}
+
 func TestServiceNew(t *testing.T) {
 	ds := &DummyService{
 		link: make(chan bool, 1),
@@ -0,0 +1,93 @@
+package onet
+
+import (
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// ServiceTx is a read-write transaction on the buckets of a service, given by
+// Context.Update. Its writes are committed together, at the end of the
+// transaction, and count towards the storage quota of the service.
+type ServiceTx struct {
+	ctx     *Context
+	tx      StoreTx
+	buckets []*QuotaBucket
+}
+
+// Update calls fn in one read-write transaction on the buckets of the
+// service, so that bulk writes are written to the disk once, instead of once
+// per call to Save. If fn returns an error, none of its writes are kept.
+func (c *Context) Update(fn func(tx *ServiceTx) error) error {
+	stx := &ServiceTx{ctx: c}
+	err := c.manager.store.Update(func(tx StoreTx) error {
+		stx.tx = tx
+		return fn(stx)
+	})
+	var writes, keys int64
+	for _, b := range stx.buckets {
+		if err != nil {
+			c.usage.release(b.delta)
+		}
+		writes += b.writes
+		keys += b.keys
+	}
+	if err != nil {
+		return xerrors.Errorf("tx error: %w", err)
+	}
+	c.usage.wrote(writes, keys)
+	c.usage.checkWarning()
+	return nil
+}
+
+// bucket returns the bucket with the given full name, counting its writes.
+func (t *ServiceTx) bucket(name []byte) *QuotaBucket {
+	qb := &QuotaBucket{bucket: t.tx.Bucket(name), usage: t.ctx.usage, tx: t.tx, name: name}
+	t.buckets = append(t.buckets, qb)
+	return qb
+}
+
+// Save stores the network.Marshal'ed data under key, as Context.Save does.
+func (t *ServiceTx) Save(key []byte, data interface{}) error {
+	return t.SaveWithTTL(key, data, 0)
+}
+
+// Load returns the network.Unmarshal'ed data of the key, or nil if it does
+// not exist. It sees the writes done before in the transaction.
+func (t *ServiceTx) Load(key []byte) (interface{}, error) {
+	buf := t.LoadRaw(key)
+	if buf == nil {
+		return nil, nil
+	}
+	_, ret, err := network.Unmarshal(buf, t.ctx.server.suite)
+	if err != nil {
+		return nil, xerrors.Errorf("unmarshaling: %v", err)
+	}
+	return ret, nil
+}
+
+// LoadRaw returns a copy of the raw data of the key, or nil if it does not
+// exist.
+func (t *ServiceTx) LoadRaw(key []byte) []byte {
+	v := t.tx.Bucket(t.ctx.bucketName).Get(key)
+	if v == nil {
+		return nil
+	}
+	buf := make([]byte, len(v))
+	copy(buf, v)
+	return buf
+}
+
+// Delete removes the key from the bucket of the service.
+func (t *ServiceTx) Delete(key []byte) error {
+	return t.bucket(t.ctx.bucketName).Delete(key)
+}
+
+// AdditionalBucket returns the additional bucket with the given name, see
+// Context.GetAdditionalBucket, creating it if needed.
+func (t *ServiceTx) AdditionalBucket(name []byte) (*QuotaBucket, error) {
+	fullName := t.ctx.additionalBucketName(name)
+	if _, err := t.tx.CreateBucketIfNotExists(fullName); err != nil {
+		return nil, xerrors.Errorf("creating bucket: %v", err)
+	}
+	return t.bucket(fullName), nil
+}
@@ -0,0 +1,91 @@
+package onet
+
+import (
+	"sync"
+
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// serviceKeys serializes the changes of the keys of the services and saves
+// them.
+type serviceKeys struct {
+	sync.Mutex
+	// save persists the keys, nil if they are lost when the server stops
+	save func([]network.ServiceIdentity) error
+}
+
+// changeServiceKeys applies fn to the ServerIdentity of the server and saves
+// the keys.
+func (c *Server) changeServiceKeys(service, name string, fn func(si *network.ServerIdentity) error) error {
+	c.serviceKeys.Lock()
+	defer c.serviceKeys.Unlock()
+	if err := fn(c.ServerIdentity); err != nil {
+		return err
+	}
+	if c.serviceKeys.save != nil {
+		if err := c.serviceKeys.save(c.ServerIdentity.ServiceKeys()); err != nil {
+			return xerrors.Errorf("saving service keys: %v", err)
+		}
+	} else {
+		log.Lvl2(c.ServerIdentity, "doesn't save the service key", name)
+	}
+	c.events.publish(Event{Type: EventServiceKeyChanged, Service: service,
+		Message: name})
+	return nil
+}
+
+// ServiceKey returns the key pair of the service with the given name, or its
+// main key pair, registered with RegisterNewServiceWithSuite, if the name is
+// empty. The key pairs of the services are part of the ServerIdentity of the
+// conode, so their public keys are found in the rosters, with
+// network.ServiceKeyName(service, name).
+func (c *Context) ServiceKey(name string) (network.ServiceIdentity, bool) {
+	return c.server.ServerIdentity.ServiceKey(c.serviceKeyName(name))
+}
+
+// ServiceKeys returns the key pairs of the service, sorted by name.
+func (c *Context) ServiceKeys() []network.ServiceIdentity {
+	service := ServiceFactory.Name(c.serviceID)
+	var keys []network.ServiceIdentity
+	for _, srvid := range c.server.ServerIdentity.ServiceKeys() {
+		if network.ServiceKeyService(srvid.Name) == service {
+			keys = append(keys, srvid)
+		}
+	}
+	return keys
+}
+
+// GenerateServiceKey creates a new key pair of the suite for the service,
+// replacing the one with the same name, and saves it in the configuration of
+// the conode if it can. The rosters created afterwards hold its public key,
+// but the existing ones must be updated by the service.
+func (c *Context) GenerateServiceKey(name string, suite suites.Suite) (network.ServiceIdentity, error) {
+	var srvid network.ServiceIdentity
+	err := c.server.changeServiceKeys(ServiceFactory.Name(c.serviceID), c.serviceKeyName(name),
+		func(si *network.ServerIdentity) error {
+			srvid = si.GenerateServiceKey(c.serviceKeyName(name), suite)
+			return nil
+		})
+	return srvid, err
+}
+
+// RotateServiceKey replaces the key pair of the service with a new one of the
+// same suite, like GenerateServiceKey, and returns the new and the old ones.
+func (c *Context) RotateServiceKey(name string) (next, old network.ServiceIdentity, err error) {
+	err = c.server.changeServiceKeys(ServiceFactory.Name(c.serviceID), c.serviceKeyName(name),
+		func(si *network.ServerIdentity) error {
+			var err error
+			next, old, err = si.RotateServiceKey(c.serviceKeyName(name))
+			return err
+		})
+	return
+}
+
+// serviceKeyName returns the name of the key of the service in the
+// ServerIdentity.
+func (c *Context) serviceKeyName(name string) string {
+	return network.ServiceKeyName(ServiceFactory.Name(c.serviceID), name)
+}
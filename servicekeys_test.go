@@ -0,0 +1,62 @@
+package onet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3/network"
+)
+
+type keyService struct {
+	*ServiceProcessor
+}
+
+func TestContext_ServiceKeys(t *testing.T) {
+	const name = "testServiceKeys"
+	sid, err := RegisterNewServiceWithSuite(name, tSuite, func(c *Context) (Service, error) {
+		return &keyService{NewServiceProcessor(c)}, nil
+	})
+	require.NoError(t, err)
+	defer UnregisterService(name)
+
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(1)
+	ctx := local.GetServices(servers, sid)[0].(*keyService).Context
+	var saved []network.ServiceIdentity
+	servers[0].serviceKeys.save = func(keys []network.ServiceIdentity) error {
+		saved = keys
+		return nil
+	}
+	events, cancel := servers[0].Subscribe(EventServiceKeyChanged)
+	defer cancel()
+
+	main, ok := ctx.ServiceKey("")
+	require.True(t, ok)
+	require.Equal(t, name, main.Name)
+	_, ok = ctx.ServiceKey("sign")
+	require.False(t, ok)
+
+	bn := suites.MustFind("bn256.g2")
+	sign, err := ctx.GenerateServiceKey("sign", bn)
+	require.NoError(t, err)
+	require.Equal(t, name+"/sign", sign.Name)
+	require.Len(t, ctx.ServiceKeys(), 2)
+	require.Equal(t, ctx.ServiceKeys(), saved)
+	ev := <-events
+	require.Equal(t, name, ev.Service)
+	require.Equal(t, name+"/sign", ev.Message)
+
+	next, old, err := ctx.RotateServiceKey("sign")
+	require.NoError(t, err)
+	require.True(t, old.Public.Equal(sign.Public))
+	require.Equal(t, bn.String(), next.Suite)
+	<-events
+	_, _, err = ctx.RotateServiceKey("unknown")
+	require.Error(t, err)
+
+	// the rosters hold the public keys
+	ro := NewRoster([]*network.ServerIdentity{servers[0].ServerIdentity})
+	require.True(t, ro.ServicePublics(name + "/sign")[0].Equal(next.Public))
+}
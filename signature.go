@@ -0,0 +1,177 @@
+package onet
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// SignatureMessagePrefix starts a text message a client can send before a
+// request to attach the signature of a user, followed by the hex-encoded
+// RequestSignature. Like TimeoutMessagePrefix, it applies to the next request
+// only.
+const SignatureMessagePrefix = "onet-signature:"
+
+// SignatureHeader is the HTTP header holding the hex-encoded RequestSignature
+// of a request sent with HTTP POST.
+const SignatureHeader = "Onet-Signature"
+
+// RequestSignature is the schnorr signature of a user on a request. It is
+// sent next to the request, so the message of the handler doesn't change and
+// the services don't need their own signature envelope. Like a SignedRequest,
+// it covers the conode, the service, the handler, the timestamp and the
+// message. See Client.SetSigner and RequestSigner.
+type RequestSignature struct {
+	// Timestamp is the time of signing in nanoseconds since the epoch.
+	Timestamp int64
+	Public    []byte
+	Signature []byte
+}
+
+// NewRequestSignature signs the encoded message for the handler at path of
+// the service of the conode dst with the private key.
+func NewRequestSignature(suite network.Suite, dst network.ServerIdentityID,
+	service, path string, msg []byte, private kyber.Scalar) (*RequestSignature, error) {
+	rs := &RequestSignature{Timestamp: time.Now().UnixNano()}
+	pub, err := suite.Point().Mul(private, nil).MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("marshaling public key: %v", err)
+	}
+	rs.Public = pub
+	digest := signedRequestDigest(dst, service, path, rs.Timestamp, msg)
+	rs.Signature, err = schnorr.Sign(suite, private, digest)
+	if err != nil {
+		return nil, xerrors.Errorf("signing: %v", err)
+	}
+	return rs, nil
+}
+
+// verify checks the timestamp and the signature of the message sent to the
+// conode dst, and returns the public key of the signer.
+func (rs *RequestSignature) verify(suite network.Suite, dst network.ServerIdentityID,
+	service, path string, msg []byte) (kyber.Point, error) {
+	diff := time.Since(time.Unix(0, rs.Timestamp))
+	if diff > SignedRequestWindow || -diff > SignedRequestWindow {
+		return nil, xerrors.New("timestamp outside of the allowed window")
+	}
+	pub := suite.Point()
+	if err := pub.UnmarshalBinary(rs.Public); err != nil {
+		return nil, xerrors.Errorf("unmarshaling public key: %v", err)
+	}
+	digest := signedRequestDigest(dst, service, path, rs.Timestamp, msg)
+	if err := schnorr.Verify(suite, pub, digest, rs.Signature); err != nil {
+		return nil, xerrors.Errorf("invalid signature of %s: %v", Identity(pub), err)
+	}
+	return pub, nil
+}
+
+// encode returns the signature as sent next to the request.
+func (rs *RequestSignature) encode() (string, error) {
+	buf, err := protobuf.Encode(rs)
+	if err != nil {
+		return "", xerrors.Errorf("encoding: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func decodeRequestSignature(s string) (*RequestSignature, error) {
+	buf, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding hex: %v", err)
+	}
+	rs := &RequestSignature{}
+	if err := protobuf.Decode(buf, rs); err != nil {
+		return nil, xerrors.Errorf("decoding: %v", err)
+	}
+	return rs, nil
+}
+
+// requestSignatureKey holds the RequestSignature received with the request,
+// not verified yet.
+type requestSignatureKey struct{}
+
+// requestSignerKey holds the public key of the verified signer.
+type requestSignerKey struct{}
+
+// RequestSigner returns the public key of the user who signed the request
+// being processed, or nil if it isn't signed. The signature has been
+// verified by the ServiceProcessor before the handler is called.
+func RequestSigner(ctx context.Context) kyber.Point {
+	pub, _ := ctx.Value(requestSignerKey{}).(kyber.Point)
+	return pub
+}
+
+// VerifyRequestSigner returns an error wrapping ErrUnauthorized unless the
+// request being processed is signed by one of the public keys.
+func VerifyRequestSigner(ctx context.Context, publics ...kyber.Point) error {
+	signer := RequestSigner(ctx)
+	if signer == nil {
+		return xerrors.Errorf("request not signed: %w", ErrUnauthorized)
+	}
+	for _, pub := range publics {
+		if pub.Equal(signer) {
+			return nil
+		}
+	}
+	return xerrors.Errorf("request signed by %s: %w", Identity(signer), ErrUnauthorized)
+}
+
+// verifySignature checks the RequestSignature received with the request, if
+// any, and returns the context giving its signer to the handler.
+func (p *ServiceProcessor) verifySignature(ctx context.Context, path string,
+	buf []byte) (context.Context, error) {
+	rs, ok := ctx.Value(requestSignatureKey{}).(*RequestSignature)
+	if !ok {
+		return ctx, nil
+	}
+	suite := p.Context.server.Suite()
+	dst := p.Context.server.ServerIdentity.ID
+	service := ServiceFactory.Name(p.ServiceID())
+	pub, err := rs.verify(suite, dst, service, path, buf)
+	if err != nil {
+		return nil, xerrors.Errorf("%v: %w", err, ErrUnauthorized)
+	}
+	if !p.seen.add(signedRequestDigest(dst, service, path, rs.Timestamp, buf), rs.Timestamp) {
+		return nil, xerrors.Errorf("request replayed: %w", ErrUnauthorized)
+	}
+	if rec := auditRecord(ctx); rec != nil {
+		rec.Identities = []string{Identity(pub)}
+	}
+	return context.WithValue(ctx, requestSignerKey{}, pub), nil
+}
+
+type unsignedKey struct{}
+
+// SetSigner sets the private key of the user signing the requests sent by the
+// client, e.g., with Send, SendProtobuf or SendBatch, so that the handlers can
+// authenticate the user with RequestSigner. The signature also satisfies the
+// rule of a handler, see ServiceProcessor.SetRule. A nil key disables the
+// signing, which is the default. Streams are not signed.
+func (c *Client) SetSigner(private kyber.Scalar) {
+	c.Lock()
+	defer c.Unlock()
+	c.signer = private
+}
+
+// requestSignature returns the encoded signature of the request sent to dst,
+// or an empty string if the client doesn't sign the requests.
+func (c *Client) requestSignature(ctx context.Context, dst *network.ServerIdentity,
+	path string, buf []byte) (string, error) {
+	c.Lock()
+	private := c.signer
+	c.Unlock()
+	if private == nil || ctx.Value(unsignedKey{}) != nil {
+		return "", nil
+	}
+	rs, err := NewRequestSignature(c.suite, dst.ID, c.service, path, buf, private)
+	if err != nil {
+		return "", err
+	}
+	return rs.encode()
+}
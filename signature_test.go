@@ -0,0 +1,112 @@
+package onet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+const signerServiceName = "signerService"
+
+func init() {
+	RegisterNewService(signerServiceName, func(c *Context) (Service, error) {
+		s := &signerService{ServiceProcessor: NewServiceProcessor(c)}
+		return s, s.RegisterHandlers(s.WhoAmI)
+	})
+}
+
+// WhoAmIRequest asks for the identity of the signer of the request.
+type WhoAmIRequest struct{}
+
+// WhoAmIReply is the identity of the signer, empty if the request isn't
+// signed.
+type WhoAmIReply struct {
+	Identity string
+}
+
+type signerService struct {
+	*ServiceProcessor
+}
+
+func (s *signerService) WhoAmI(ctx context.Context, req *WhoAmIRequest) (*WhoAmIReply, error) {
+	if signer := RequestSigner(ctx); signer != nil {
+		return &WhoAmIReply{Identity: Identity(signer)}, nil
+	}
+	return &WhoAmIReply{}, nil
+}
+
+func TestRequestSignature_Verify(t *testing.T) {
+	kp := key.NewKeyPair(tSuite)
+	dst := network.NewServerIdentity(kp.Public, network.NewLocalAddress("conode")).ID
+	rs, err := NewRequestSignature(tSuite, dst, "service", "path", []byte("msg"), kp.Private)
+	require.NoError(t, err)
+	enc, err := rs.encode()
+	require.NoError(t, err)
+	rs, err = decodeRequestSignature(enc)
+	require.NoError(t, err)
+
+	pub, err := rs.verify(tSuite, dst, "service", "path", []byte("msg"))
+	require.NoError(t, err)
+	require.True(t, pub.Equal(kp.Public))
+	_, err = rs.verify(tSuite, dst, "service", "other", []byte("msg"))
+	require.Error(t, err)
+	_, err = rs.verify(tSuite, dst, "service", "path", []byte("other"))
+	require.Error(t, err)
+
+	ctx := context.WithValue(context.Background(), requestSignerKey{}, pub)
+	require.NoError(t, VerifyRequestSigner(ctx, key.NewKeyPair(tSuite).Public, kp.Public))
+	require.True(t, xerrors.Is(VerifyRequestSigner(ctx, key.NewKeyPair(tSuite).Public),
+		ErrUnauthorized))
+	require.True(t, xerrors.Is(VerifyRequestSigner(context.Background(), kp.Public),
+		ErrUnauthorized))
+}
+
+func TestClient_SetSigner(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	h := local.GenServers(1)[0]
+	user := key.NewKeyPair(tSuite)
+
+	cl := local.NewClient(signerServiceName)
+	reply := &WhoAmIReply{}
+	require.NoError(t, cl.SendProtobuf(h.ServerIdentity, &WhoAmIRequest{}, reply))
+	require.Empty(t, reply.Identity)
+
+	cl.SetSigner(user.Private)
+	require.NoError(t, cl.SendProtobuf(h.ServerIdentity, &WhoAmIRequest{}, reply))
+	require.Equal(t, Identity(user.Public), reply.Identity)
+
+	cl.SetTransportMode(TransportHTTPPost)
+	reply = &WhoAmIReply{}
+	require.NoError(t, cl.SendProtobuf(h.ServerIdentity, &WhoAmIRequest{}, reply))
+	require.Equal(t, Identity(user.Public), reply.Identity)
+	cl.SetTransportMode(TransportWebSocket)
+
+	buf, err := protobuf.Encode(&WhoAmIRequest{})
+	require.NoError(t, err)
+	for r := range cl.SendBatch(context.Background(), h.ServerIdentity, "WhoAmIRequest",
+		[][]byte{buf, buf}) {
+		require.NoError(t, r.Err)
+		require.NoError(t, protobuf.Decode(r.Reply, reply))
+		require.Equal(t, Identity(user.Public), reply.Identity)
+	}
+
+	// the signature satisfies the rules
+	ts := h.Service(testServiceName).(*testService)
+	require.NoError(t, ts.SetRule("testMsg", Identity(user.Public)))
+	tcl := local.NewClient(testServiceName)
+	require.Error(t, tcl.SendProtobuf(h.ServerIdentity, &testMsg{12}, &testMsg{}))
+	tcl.SetSigner(user.Private)
+	require.NoError(t, tcl.SendProtobuf(h.ServerIdentity, &testMsg{12}, &testMsg{}))
+	require.NoError(t, tcl.SendProtobufSigned(h.ServerIdentity, &testMsg{12}, &testMsg{},
+		user.Private))
+	tcl.SetSigner(key.NewKeyPair(tSuite).Private)
+	err = tcl.SendProtobuf(h.ServerIdentity, &testMsg{12}, &testMsg{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not satisfied")
+}
@@ -3,12 +3,14 @@ package simul
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
 	"math"
+	"net/http"
 	"time"
 
 	"go.dedis.ch/onet/v3/log"
@@ -28,9 +30,18 @@ var simRange = ""
 var race = false
 var runWait = 180 * time.Second
 var experimentWait = 0 * time.Second
+var parallel = 0
+var dashboardAddress = ""
+
+// monitorDrain is how long a run waits for the monitor to receive the last
+// measures once the platform is done.
+var monitorDrain = 5 * time.Second
+
+// dashboard shows the runs of the simulations if dashboardAddress is set.
+var dashboard *monitor.Dashboard
 
 func init() {
-	flag.StringVar(&platformDst, "platform", platformDst, "platform to deploy to [localhost,mininet,deterlab]")
+	flag.StringVar(&platformDst, "platform", platformDst, "platform to deploy to [localhost,mininet,deterlab,docker,terraform,hybrid]")
 	flag.BoolVar(&nobuild, "nobuild", false, "Don't rebuild all helpers")
 	flag.BoolVar(&clean, "clean", false, "Only clean platform")
 	flag.StringVar(&build, "build", "", "List of packages to build")
@@ -40,6 +51,8 @@ func init() {
 	flag.StringVar(&simRange, "range", simRange, "Range of simulations to run. 0: or 3:4 or :4")
 	flag.DurationVar(&runWait, "runwait", runWait, "How long to wait for each simulation to finish - overwrites .toml-value")
 	flag.DurationVar(&experimentWait, "experimentwait", experimentWait, "How long to wait for the whole experiment to finish")
+	flag.IntVar(&parallel, "parallel", parallel, "How many simulations to run at once, on the platforms supporting it - overwrites .toml-value")
+	flag.StringVar(&dashboardAddress, "dashboard", dashboardAddress, "Address where to serve the live dashboard of the simulations, e.g. :8080")
 	log.RegisterFlags()
 }
 
@@ -51,6 +64,15 @@ func startBuild() {
 		log.Fatal("Platform not recognized.", platformDst)
 	}
 	log.Lvl1("Deploying to", platformDst)
+	if dashboardAddress != "" {
+		dashboard = monitor.NewDashboard()
+		go func() {
+			log.Lvl1("Serving the dashboard on", dashboardAddress)
+			if err := http.ListenAndServe(dashboardAddress, dashboard); err != nil {
+				log.Error("Couldn't serve the dashboard:", err)
+			}
+		}()
+	}
 
 	simulations := flag.Args()
 	if len(simulations) == 0 {
@@ -77,8 +99,10 @@ func startBuild() {
 			if err := deployP.Cleanup(); err != nil {
 				log.Error("Couldn't cleanup correctly:", err)
 			}
+			teardown(deployP)
 		} else {
-			logname := strings.Replace(filepath.Base(simulation), ".toml", "", 1)
+			logname := strings.TrimSuffix(filepath.Base(simulation),
+				filepath.Ext(simulation))
 			testsDone := make(chan bool)
 			timeout, err := getExperimentWait(runconfigs)
 			if err != nil {
@@ -92,8 +116,26 @@ func startBuild() {
 			case <-testsDone:
 				log.Lvl3("Done with test", simulation)
 			case <-time.After(timeout):
+				teardown(deployP)
 				log.Fatal("Test failed to finish in", timeout, "seconds")
 			}
+			teardown(deployP)
+		}
+	}
+}
+
+// teardown destroys the machines of the platform and of its replicas, if
+// they created them.
+func teardown(deployP platform.Platform) {
+	replicas.Lock()
+	platforms := append([]platform.Platform{deployP}, replicas.list...)
+	replicas.list = nil
+	replicas.Unlock()
+	for _, p := range platforms {
+		if p, ok := p.(platform.Provisioner); ok {
+			if err := p.Teardown(); err != nil {
+				log.Error("Couldn't tear down the platform:", err)
+			}
 		}
 	}
 }
@@ -132,6 +174,29 @@ func RunTests(deployP platform.Platform, name string, runconfigs []*platform.Run
 	}()
 
 	start, stop := getStartStop(len(runconfigs))
+	n, err := getParallel(runconfigs)
+	if err != nil {
+		log.Fatal("Parallel:", err)
+	}
+	if n > 1 {
+		if rep, ok := deployP.(platform.Replicator); ok {
+			err := runParallel(deployP, rep, name, runconfigs, start, stop, n, args)
+			if err != nil {
+				log.Error("Couldn't merge the results:", err)
+			}
+			if err := writeSummary(name); err != nil {
+				log.Error("Couldn't write the summary:", err)
+			}
+			return
+		}
+		log.Warn("Platform", platformDst, "can't run simulations in parallel,",
+			"running them one after the other")
+	}
+	defer func() {
+		if err := writeSummary(name); err != nil {
+			log.Error("Couldn't write the summary:", err)
+		}
+	}()
 	for i, rc := range runconfigs {
 		// Implement a simple range-argument that will skip checks not in range
 		if i < start || i > stop {
@@ -142,7 +207,7 @@ func RunTests(deployP platform.Platform, name string, runconfigs []*platform.Run
 		// run test t nTimes times
 		// take the average of all successful runs
 		log.Lvl1("Running test with config:", rc)
-		stats, err := RunTest(deployP, rc)
+		stats, err := runTest(deployP, rc, monitorPort, profileDir(name, i))
 		if err != nil {
 			log.Error("Error running test:", err)
 			continue
@@ -164,15 +229,7 @@ func RunTests(deployP platform.Platform, name string, runconfigs []*platform.Run
 			}
 			f := files[j]
 
-			if i == 0 {
-				bucketStat.WriteHeader(f)
-			}
-			if rc.Get("IndividualStats") != "" {
-				err := bucketStat.WriteIndividualStats(f)
-				log.ErrFatal(err)
-			} else {
-				bucketStat.WriteValues(f)
-			}
+			log.ErrFatal(writeStats(f, rc, bucketStat, i == 0))
 			err = f.Sync()
 			if err != nil {
 				log.Fatal("error syncing data to test file:", err)
@@ -181,11 +238,39 @@ func RunTests(deployP platform.Platform, name string, runconfigs []*platform.Run
 	}
 }
 
+// writeStats writes the values of the stats to w, after the header if it
+// is asked for.
+func writeStats(w io.Writer, rc *platform.RunConfig, stats *monitor.Stats, header bool) error {
+	if header {
+		stats.WriteHeader(w)
+	}
+	if rc.Get("IndividualStats") != "" {
+		return stats.WriteIndividualStats(w)
+	}
+	stats.WriteValues(w)
+	return nil
+}
+
 // RunTest a single test - takes a test-file as a string that will be copied
 // to the deterlab-server
 func RunTest(deployP platform.Platform, rc *platform.RunConfig) ([]*monitor.Stats, error) {
+	return runTest(deployP, rc, monitorPort, "test_data/profiles")
+}
+
+// runTest is RunTest with the monitor listening on the given port, and
+// saving the profiles of the conodes in the given directory.
+func runTest(deployP platform.Platform, rc *platform.RunConfig, port int,
+	profiles string) ([]*monitor.Stats, error) {
 	CheckHosts(rc)
 	rc.Delete("simulation")
+	versions, err := platform.Versions(rc)
+	if err != nil {
+		return nil, xerrors.Errorf("versions: %v", err)
+	}
+	versioner, ok := deployP.(platform.Versioner)
+	if versions != nil && !ok {
+		return nil, xerrors.New("the platform can't run another version")
+	}
 	stats := []*monitor.Stats{
 		// this is the global bucket
 		monitor.NewStats(rc.Map(), "hosts", "bf"),
@@ -202,7 +287,35 @@ func RunTest(deployP platform.Platform, rc *platform.RunConfig) ([]*monitor.Stat
 	}
 
 	m := monitor.NewMonitor(stats[0])
-	m.SinkPort = uint16(monitorPort)
+	m.SinkPort = uint16(port)
+	if rc.Get("Profiles") != "" {
+		// the platform can change the working directory while running
+		profiles, err := filepath.Abs(profiles)
+		if err != nil {
+			return nil, xerrors.Errorf("profiles: %v", err)
+		}
+		// the profiles of an earlier run of the test are replaced
+		if err := os.RemoveAll(profiles); err != nil {
+			return nil, xerrors.Errorf("removing profiles: %v", err)
+		}
+		m.SetProfileDir(profiles)
+	}
+	roundWait, err := rc.GetDuration("roundwait")
+	if err == nil {
+		m.SetTimeLimit("round", roundWait)
+	} else if err != platform.ErrorFieldNotPresent {
+		return nil, xerrors.Errorf("RoundWait: %v", err)
+	}
+	closeExporters, err := addExporters(m, rc)
+	if err != nil {
+		return nil, xerrors.Errorf("exporters: %v", err)
+	}
+	defer closeExporters()
+	if dashboard != nil {
+		run := dashboard.NewRun(rc.Map())
+		m.SetDashboard(run)
+		defer run.Close()
+	}
 	defer m.Stop()
 
 	// create the buckets that will split the statistics of the hosts
@@ -221,9 +334,23 @@ func RunTest(deployP platform.Platform, rc *platform.RunConfig) ([]*monitor.Stat
 			m.InsertBucket(i, rules, bs)
 		}
 	}
+	// and the buckets of the versions of a mixed-version simulation
+	if versions != nil {
+		hosts := versioner.HostVersions()
+		m.SetHostVersions(hosts)
+		for _, v := range versions {
+			config := rc.Map()
+			config["version"] = v
+			bs := monitor.NewStats(config, "hosts", "bf")
+			m.InsertBucket(len(stats)-1, versionRules(hosts, v), bs)
+			stats = append(stats, bs)
+		}
+	}
 
 	done := make(chan error)
+	listening := make(chan struct{})
 	go func() {
+		defer close(listening)
 		if err := m.Listen(); err != nil {
 			log.Error("error while closing monitor: " + err.Error())
 		}
@@ -255,17 +382,53 @@ func RunTest(deployP platform.Platform, rc *platform.RunConfig) ([]*monitor.Stat
 	}
 
 	// can timeout the command if it takes too long
+	expired := time.After(timeout)
 	select {
 	case err := <-done:
 		if err != nil {
 			return nil, xerrors.Errorf("simulation error: %v", err)
 		}
+		// the processes might have ended before the monitor received
+		// their last measures
+		select {
+		case <-listening:
+		case <-time.After(monitorDrain):
+			log.Lvl2("Monitor still listening after", monitorDrain)
+		}
 		return stats, nil
-	case <-time.After(timeout):
+	case err := <-m.Aborted():
+		if err := deployP.Cleanup(); err != nil {
+			log.Lvl3("Couldn't cleanup platform:", err)
+		}
+		// the next run starts once the servers of this one stopped, which
+		// the cleanup can't do for the servers running in this process
+		select {
+		case <-done:
+		case <-expired:
+			log.Warn("The aborted simulation is still running")
+		}
+		return nil, xerrors.Errorf("simulation aborted: %v", err)
+	case <-expired:
 		return nil, xerrors.New("simulation timeout")
 	}
 }
 
+// versionRules returns the bucket rules of the hosts running the version.
+func versionRules(hosts []string, version string) []string {
+	var rules []string
+	for i := 0; i < len(hosts); i++ {
+		if hosts[i] != version {
+			continue
+		}
+		start := i
+		for i < len(hosts) && hosts[i] == version {
+			i++
+		}
+		rules = append(rules, fmt.Sprintf("%d:%d", start, i))
+	}
+	return rules
+}
+
 // CheckHosts verifies that at least two out of the three parameters: hosts, BF
 // and depth are set in RunConfig. If one is missing, it tries to fix it. When
 // more than one is missing, it stops the program.
@@ -341,6 +504,11 @@ func generateResultFileName(name string, index int) string {
 	return fmt.Sprintf("test_data/%s_%d.csv", name, index)
 }
 
+// profileDir is the directory of the profiles of a test.
+func profileDir(name string, test int) string {
+	return fmt.Sprintf("test_data/%s_profiles/%d", name, test)
+}
+
 // returns a tuple of start and stop configurations to run
 func getStartStop(rcs int) (int, int) {
 	ssStr := strings.Split(simRange, ":")
@@ -372,6 +540,19 @@ func getRunWait(rc *platform.RunConfig) (time.Duration, error) {
 	return 0, err
 }
 
+// getParallel returns either the command-line value or the value from the
+// runconfig of how many simulations run at once, 1 by default.
+func getParallel(rcs []*platform.RunConfig) (int, error) {
+	if parallel > 0 {
+		return parallel, nil
+	}
+	n, err := rcs[0].GetInt("parallel")
+	if err == platform.ErrorFieldNotPresent {
+		return 1, nil
+	}
+	return n, err
+}
+
 // getExperimentWait returns, in the following order of precedence:
 // 1. the command-line value
 // 2. the value from runconfig
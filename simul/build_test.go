@@ -4,6 +4,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/stretchr/testify/require"
 	"go.dedis.ch/onet/v3/simul/platform"
 )
 
@@ -46,3 +47,10 @@ func TestDepth(t *testing.T) {
 		}
 	}
 }
+
+func TestVersionRules(t *testing.T) {
+	hosts := []string{"current", "other", "other", "current", "other"}
+	require.Equal(t, []string{"0:1", "3:4"}, versionRules(hosts, "current"))
+	require.Equal(t, []string{"1:3", "4:5"}, versionRules(hosts, "other"))
+	require.Nil(t, versionRules(hosts, "v3.2"))
+}
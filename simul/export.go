@@ -0,0 +1,47 @@
+package simul
+
+import (
+	"strings"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/simul/monitor"
+	"go.dedis.ch/onet/v3/simul/platform"
+	"golang.org/x/xerrors"
+)
+
+// addExporters adds to the monitor the exporters of the run-configuration,
+// and returns the function closing them. The measures are labelled with the
+// variables of the run.
+func addExporters(m *monitor.Monitor, rc *platform.RunConfig) (func(), error) {
+	labels := make(map[string]string)
+	for k, v := range rc.Map() {
+		if !strings.HasPrefix(k, "export") {
+			labels[k] = v
+		}
+	}
+	var exporters []monitor.Exporter
+	if file := rc.Get("ExportJSON"); file != "" {
+		e, err := monitor.NewJSONExporter(file, labels)
+		if err != nil {
+			return nil, xerrors.Errorf("json: %v", err)
+		}
+		exporters = append(exporters, e)
+	}
+	if url := rc.Get("ExportInflux"); url != "" {
+		exporters = append(exporters, monitor.NewInfluxExporter(url,
+			rc.Get("ExportInfluxToken"), labels))
+	}
+	if url := rc.Get("ExportPrometheus"); url != "" {
+		exporters = append(exporters, monitor.NewPrometheusExporter(url, labels))
+	}
+	for _, e := range exporters {
+		m.AddExporter(e)
+	}
+	return func() {
+		for _, e := range exporters {
+			if err := e.Close(); err != nil {
+				log.Error("Couldn't close exporter:", err)
+			}
+		}
+	}, nil
+}
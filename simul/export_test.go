@@ -0,0 +1,32 @@
+package simul
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/simul/monitor"
+	"go.dedis.ch/onet/v3/simul/platform"
+)
+
+func TestAddExporters(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "measures.json")
+	rc := platform.NewRunConfig()
+	rc.Put("hosts", "4")
+	rc.Put("bf", "2")
+	rc.Put("ExportJSON", file)
+	m := monitor.NewMonitor(monitor.NewStats(rc.Map(), "hosts", "bf"))
+	closeExporters, err := addExporters(m, rc)
+	require.NoError(t, err)
+	closeExporters()
+
+	_, err = ioutil.ReadFile(file)
+	require.NoError(t, err)
+
+	rc.Put("ExportJSON", filepath.Join(file, "missing", "measures.json"))
+	_, err = addExporters(m, rc)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "json"))
+}
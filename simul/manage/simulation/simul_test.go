@@ -3,13 +3,17 @@ package main
 import (
 	"testing"
 
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"strings"
 
 	"github.com/stretchr/testify/assert"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/simul"
+	"go.dedis.ch/onet/v3/simul/platform"
 )
 
 func TestSimulation(t *testing.T) {
@@ -29,3 +33,73 @@ func TestSimulation_IndividualStats(t *testing.T) {
 	// header + 2 experiments + final newline
 	assert.Equal(t, 4, len(strings.Split(string(csv), "\n")))
 }
+
+func TestSimulation_Resources(t *testing.T) {
+	simul.Start("resources.toml")
+	csv, err := ioutil.ReadFile("test_data/resources.csv")
+	log.ErrFatal(err)
+	lines := strings.Split(string(csv), "\n")
+	for _, m := range []string{"cpu", "rss", "goroutines", "tx", "rx"} {
+		assert.Contains(t, lines[0], "resources_"+m+"_avg")
+	}
+	// every conode measured its resources in every round
+	header := strings.Split(lines[0], ",")
+	values := strings.Split(lines[1], ",")
+	for i, h := range header {
+		if h == "resources_rss_sum" {
+			assert.NotEqual(t, "0", values[i])
+		}
+	}
+}
+
+func TestSimulation_Deterministic(t *testing.T) {
+	simul.Start("deterministic.toml")
+	csv, err := ioutil.ReadFile("test_data/deterministic.csv")
+	log.ErrFatal(err)
+	// header + 1 experiment + final newline
+	assert.Equal(t, 3, len(strings.Split(string(csv), "\n")))
+}
+
+func TestSimulation_Versions(t *testing.T) {
+	simul.Start("versions.toml")
+	// a bucket by version after the global statistics
+	for i, v := range []string{"current", "copy"} {
+		csv, err := ioutil.ReadFile(fmt.Sprintf("test_data/versions_%d.csv", i+1))
+		log.ErrFatal(err)
+		lines := strings.Split(string(csv), "\n")
+		assert.Contains(t, lines[0], "bandwidth_tx_avg")
+		assert.Contains(t, lines[1], ","+v+",")
+	}
+}
+
+func TestSimulation_Profiles(t *testing.T) {
+	simul.Start("profiles.toml")
+	for _, round := range []int{0, 1} {
+		for _, kind := range []string{"cpu", "heap", "block"} {
+			_, err := os.Stat(fmt.Sprintf("test_data/profiles_profiles/0/localhost_round%d_%s.pprof",
+				round, kind))
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestSimulation_YAML(t *testing.T) {
+	simul.Start("matrix.yaml")
+	csv, err := ioutil.ReadFile("test_data/matrix.csv")
+	log.ErrFatal(err)
+	// header + 4 combinations + final newline
+	lines := strings.Split(string(csv), "\n")
+	assert.Equal(t, 6, len(lines))
+	assert.Contains(t, lines[1], "3,2,")
+}
+
+func TestSimulation_Capture(t *testing.T) {
+	simul.Start("capture.toml")
+	captures, err := filepath.Glob("build/captures/*.capture")
+	log.ErrFatal(err)
+	// a capture by host
+	assert.Equal(t, 3, len(captures))
+	for _, c := range captures {
+		assert.NoError(t, platform.Replay("Ed25519", "Count", c))
+	}
+}
@@ -0,0 +1,312 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// dashboardRuns is how many runs the dashboard keeps.
+const dashboardRuns = 20
+
+// dashboardRecent is how many of the last measurements and log messages the
+// dashboard keeps for every run.
+const dashboardRecent = 100
+
+// Dashboard serves over http the state of the runs of a simulation, as
+// received by their monitors: the liveness of the processes reporting to
+// it, the current round, the last measurements and the logged errors. The
+// page at the root refreshes itself, and the state is served as json on
+// /state.
+type Dashboard struct {
+	runs []*DashboardRun
+	sync.Mutex
+}
+
+// NewDashboard returns a dashboard without runs.
+func NewDashboard() *Dashboard {
+	return &Dashboard{}
+}
+
+// NewRun adds a run with the given configuration to the dashboard. The run
+// gets the measures of a monitor with Monitor.SetDashboard.
+func (d *Dashboard) NewRun(config map[string]string) *DashboardRun {
+	d.Lock()
+	defer d.Unlock()
+	r := &DashboardRun{
+		Config:   config,
+		Start:    time.Now(),
+		sources:  map[string]*dashboardSource{},
+		measures: map[string]*dashboardMeasure{},
+	}
+	d.runs = append(d.runs, r)
+	if len(d.runs) > dashboardRuns {
+		d.runs = d.runs[len(d.runs)-dashboardRuns:]
+	}
+	return r
+}
+
+// SetDashboard shows the measures and the reporting processes of the
+// monitor in the run of a dashboard. It must be called before Listen.
+func (m *Monitor) SetDashboard(r *DashboardRun) {
+	m.dashboard = r
+	m.AddExporter(r)
+}
+
+// ServeHTTP implements http.Handler.
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(dashboardPage))
+	case "/state":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.State())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// DashboardState is the state of the runs of a dashboard, the last one
+// first.
+type DashboardState struct {
+	Runs []DashboardRunState `json:"runs"`
+}
+
+// State returns the current state of the dashboard.
+func (d *Dashboard) State() DashboardState {
+	d.Lock()
+	runs := append([]*DashboardRun{}, d.runs...)
+	d.Unlock()
+	state := DashboardState{Runs: []DashboardRunState{}}
+	for i := len(runs) - 1; i >= 0; i-- {
+		state.Runs = append(state.Runs, runs[i].state())
+	}
+	return state
+}
+
+// DashboardRun is a run of a dashboard. It is the exporter of the measures
+// of the monitor of the run.
+type DashboardRun struct {
+	Config map[string]string
+	Start  time.Time
+	end    time.Time
+
+	sources  map[string]*dashboardSource
+	measures map[string]*dashboardMeasure
+	recent   []Measurement
+	logs     []DashboardLog
+	sync.Mutex
+}
+
+type dashboardSource struct {
+	last time.Time
+	logs int
+}
+
+type dashboardMeasure struct {
+	last  float64
+	value *Value
+}
+
+// DashboardLog is a message logged by a process reporting to the dashboard.
+type DashboardLog struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+}
+
+// DashboardRunState is the state of a run of the dashboard.
+type DashboardRunState struct {
+	Config map[string]string `json:"config"`
+	Start  time.Time         `json:"start"`
+	// End is nil while the run goes on
+	End *time.Time `json:"end"`
+	// Round is how many rounds are done, counted with the "round_wall"
+	// measure
+	Round    int                     `json:"round"`
+	Sources  []DashboardSourceState  `json:"sources"`
+	Measures []DashboardMeasureState `json:"measures"`
+	// Recent are the last measurements, the last one first
+	Recent []Measurement `json:"recent"`
+	// Logs are the last messages logged, the last one first
+	Logs []DashboardLog `json:"logs"`
+}
+
+// DashboardSourceState is the state of a process reporting to a run of the
+// dashboard.
+type DashboardSourceState struct {
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"lastSeen"`
+	// Alive is false if the process missed its last heartbeats
+	Alive bool `json:"alive"`
+	Logs  int  `json:"logs"`
+}
+
+// DashboardMeasureState is the state of a measure of a run of the
+// dashboard.
+type DashboardMeasureState struct {
+	Name  string  `json:"name"`
+	Count int     `json:"count"`
+	Last  float64 `json:"last"`
+	Avg   float64 `json:"avg"`
+	P50   float64 `json:"p50"`
+	P99   float64 `json:"p99"`
+}
+
+// Export implements the Exporter interface.
+func (r *DashboardRun) Export(me Measurement) {
+	r.Lock()
+	defer r.Unlock()
+	m, ok := r.measures[me.Name]
+	if !ok {
+		m = &dashboardMeasure{value: NewValue(me.Name)}
+		r.measures[me.Name] = m
+	}
+	m.last = me.Value
+	m.value.Store(me.Value)
+	r.recent = append(r.recent, me)
+	if len(r.recent) > dashboardRecent {
+		r.recent = r.recent[1:]
+	}
+}
+
+// Close implements the Exporter interface. It ends the run.
+func (r *DashboardRun) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.end.IsZero() {
+		r.end = time.Now()
+	}
+	return nil
+}
+
+// report takes the heartbeat or the logged message of a process.
+func (r *DashboardRun) report(sm *singleMeasure) {
+	r.Lock()
+	defer r.Unlock()
+	s, ok := r.sources[sm.Source]
+	if !ok {
+		s = &dashboardSource{}
+		r.sources[sm.Source] = s
+	}
+	now := time.Now()
+	s.last = now
+	if sm.Log == "" {
+		return
+	}
+	s.logs++
+	r.logs = append(r.logs, DashboardLog{Time: now, Source: sm.Source,
+		Message: sm.Log})
+	if len(r.logs) > dashboardRecent {
+		r.logs = r.logs[1:]
+	}
+}
+
+func (r *DashboardRun) state() DashboardRunState {
+	r.Lock()
+	defer r.Unlock()
+	st := DashboardRunState{
+		Config:   r.Config,
+		Start:    r.Start,
+		Sources:  []DashboardSourceState{},
+		Measures: []DashboardMeasureState{},
+		Recent:   []Measurement{},
+		Logs:     []DashboardLog{},
+	}
+	if !r.end.IsZero() {
+		end := r.end
+		st.End = &end
+	}
+	if m, ok := r.measures["round_wall"]; ok {
+		st.Round = m.value.NumValue()
+	}
+	// a process is dead once it misses two heartbeats
+	deadline := time.Now().Add(-3 * ReportInterval)
+	for name, s := range r.sources {
+		st.Sources = append(st.Sources, DashboardSourceState{Name: name,
+			LastSeen: s.last, Alive: st.End == nil && s.last.After(deadline),
+			Logs: s.logs})
+	}
+	sort.Slice(st.Sources, func(i, j int) bool {
+		return st.Sources[i].Name < st.Sources[j].Name
+	})
+	for name, m := range r.measures {
+		st.Measures = append(st.Measures, DashboardMeasureState{Name: name,
+			Count: m.value.NumValue(), Last: m.last, Avg: m.value.Avg(),
+			P50: m.value.Percentile(50), P99: m.value.Percentile(99)})
+	}
+	sort.Slice(st.Measures, func(i, j int) bool {
+		return st.Measures[i].Name < st.Measures[j].Name
+	})
+	for i := len(r.recent) - 1; i >= 0; i-- {
+		st.Recent = append(st.Recent, r.recent[i])
+	}
+	for i := len(r.logs) - 1; i >= 0; i-- {
+		st.Logs = append(st.Logs, r.logs[i])
+	}
+	return st
+}
+
+// dashboardPage shows the state of the dashboard, fetched every two
+// seconds.
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Simulation</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.dead { color: #c00; font-weight: bold; }
+.alive { color: #080; }
+pre { margin: 0; white-space: pre-wrap; }
+h2 { margin-bottom: 0.2em; }
+</style>
+</head>
+<body>
+<h1>Simulation</h1>
+<div id="runs">Loading...</div>
+<script>
+function esc(s) {
+  return String(s).replace(/[&<>"]/g, c => ({"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;"})[c]);
+}
+function table(head, rows) {
+  return "<table><tr>" + head.map(h => "<th>" + h + "</th>").join("") + "</tr>" +
+    rows.map(r => "<tr>" + r.map(c => "<td>" + c + "</td>").join("") + "</tr>").join("") +
+    "</table>";
+}
+function time(t) { return new Date(t).toLocaleTimeString(); }
+function render(state) {
+  return state.runs.map(run => {
+    const rounds = run.config.rounds ? "/" + esc(run.config.rounds) : "";
+    const status = run.end ? "finished at " + time(run.end) : "running";
+    return "<h2>Run started at " + time(run.start) + ", " + status + "</h2>" +
+      "<p>" + Object.keys(run.config).sort().map(k => esc(k) + "=" + esc(run.config[k])).join(", ") + "</p>" +
+      "<p>Round " + run.round + rounds + "</p>" +
+      table(["Process", "Status", "Last seen", "Errors"], run.sources.map(s =>
+        ["<b>" + esc(s.name) + "</b>",
+         s.alive ? "<span class=alive>alive</span>" : "<span class=dead>silent</span>",
+         time(s.lastSeen), s.logs])) +
+      table(["Measure", "Count", "Last", "Average", "Median", "99th percentile"], run.measures.map(m =>
+        [esc(m.name), m.count, m.last.toPrecision(4), m.avg.toPrecision(4),
+         m.p50.toPrecision(4), m.p99.toPrecision(4)])) +
+      table(["Time", "Process", "Message"], run.logs.map(l =>
+        [time(l.time), esc(l.source), "<pre>" + esc(l.message) + "</pre>"])) +
+      table(["Time", "Measure", "Host", "Value"], run.recent.slice(0, 20).map(m =>
+        [time(m.time), esc(m.name), m.host, m.value.toPrecision(4)]));
+  }).join("") || "No run yet";
+}
+function update() {
+  fetch("state").then(r => r.json()).then(state => {
+    document.getElementById("runs").innerHTML = render(state);
+  }).catch(() => {}).finally(() => setTimeout(update, 2000));
+}
+update();
+</script>
+</body>
+</html>
+`
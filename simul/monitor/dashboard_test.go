@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestDashboard(t *testing.T) {
+	d := NewDashboard()
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+
+	r := d.NewRun(map[string]string{"hosts": "4", "rounds": "3"})
+	m := NewMonitor(NewStats(nil))
+	m.SetDashboard(r)
+	m.update(&singleMeasure{Name: "round_wall", Value: 1, Host: 0})
+	m.update(&singleMeasure{Name: "round_wall", Value: 3, Host: 1})
+	m.update(&singleMeasure{Name: "setup_wall", Value: 2, Host: 0})
+	r.report(&singleMeasure{Source: "b"})
+	r.report(&singleMeasure{Source: "a", Log: "E error"})
+	r.sources["b"].last = time.Now().Add(-4 * ReportInterval)
+
+	resp, err := srv.Client().Get(srv.URL + "/state")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var state DashboardState
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&state))
+	require.Len(t, state.Runs, 1)
+	run := state.Runs[0]
+	require.Equal(t, "3", run.Config["rounds"])
+	require.Nil(t, run.End)
+	require.Equal(t, 2, run.Round)
+	require.Len(t, run.Sources, 2)
+	require.Equal(t, "a", run.Sources[0].Name)
+	require.True(t, run.Sources[0].Alive)
+	require.Equal(t, 1, run.Sources[0].Logs)
+	require.False(t, run.Sources[1].Alive)
+	require.Equal(t, []DashboardMeasureState{
+		{Name: "round_wall", Count: 2, Last: 3, Avg: 2, P50: 1, P99: 3},
+		{Name: "setup_wall", Count: 1, Last: 2, Avg: 2, P50: 2, P99: 2},
+	}, run.Measures)
+	require.Len(t, run.Recent, 3)
+	require.Equal(t, "setup_wall", run.Recent[0].Name)
+	require.Len(t, run.Logs, 1)
+	require.Equal(t, "E error", run.Logs[0].Message)
+
+	require.NoError(t, r.Close())
+	for i := 0; i < dashboardRuns; i++ {
+		d.NewRun(map[string]string{"run": strconv.Itoa(i)})
+	}
+	state = d.State()
+	require.Len(t, state.Runs, dashboardRuns)
+	require.Equal(t, strconv.Itoa(dashboardRuns-1), state.Runs[0].Config["run"])
+	require.Equal(t, "0", state.Runs[dashboardRuns-1].Config["run"])
+}
+
+func TestReportLogger(t *testing.T) {
+	// the warnings and errors only go to the loggers with a debug level
+	defer log.SetDebugVisible(log.DebugVisible())
+	log.SetDebugVisible(1)
+	logs := make(chan string, 2)
+	key := log.RegisterLogger(&reportLogger{logs: logs})
+	defer log.UnregisterLogger(key)
+	log.Lvl1("not reported")
+	log.Warn("a warning")
+	log.Error("an error")
+	log.Warn("dropped")
+	require.Len(t, logs, 2)
+	require.Contains(t, <-logs, "a warning")
+	require.Contains(t, <-logs, "an error")
+}
@@ -0,0 +1,465 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// Measurement is a measure received by a monitor, as given to its
+// exporters.
+type Measurement struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	// Host is the index of the host in the roster, or InvalidHostIndex
+	Host int `json:"host"`
+	// Version is the version of the binary run by the host in a
+	// mixed-version simulation
+	Version string `json:"version,omitempty"`
+	// Time is when the monitor received the measure
+	Time time.Time `json:"time"`
+}
+
+// Exporter streams the measurements received by a monitor to an external
+// store, while the simulation runs. Export must not block the monitor, and
+// is ignored once the exporter is closed.
+type Exporter interface {
+	Export(Measurement)
+	// Close sends the pending measurements and releases the exporter.
+	Close() error
+}
+
+// SetHostVersions tags the measures of the hosts with the versions of the
+// binaries they run, given by host index, for a mixed-version simulation.
+// It must be called before Listen.
+func (m *Monitor) SetHostVersions(versions []string) {
+	m.hostVersions = versions
+}
+
+// AddExporter adds an exporter receiving all the measures of the monitor.
+// It must be called before Listen.
+func (m *Monitor) AddExporter(e Exporter) {
+	m.exporters = append(m.exporters, e)
+}
+
+// export gives the measure to the exporters of the monitor.
+func (m *Monitor) export(meas *singleMeasure) {
+	if len(m.exporters) == 0 {
+		return
+	}
+	me := Measurement{Name: meas.Name, Value: meas.Value, Host: meas.Host,
+		Time: time.Now()}
+	if meas.Host >= 0 && meas.Host < len(m.hostVersions) {
+		me.Version = m.hostVersions[meas.Host]
+	}
+	for _, e := range m.exporters {
+		e.Export(me)
+	}
+}
+
+// jsonExporter writes the measurements to a file, one json object by line.
+type jsonExporter struct {
+	file   *os.File
+	labels map[string]string
+	closed bool
+	sync.Mutex
+}
+
+// NewJSONExporter returns an exporter appending the measurements to the
+// file, with the labels, one json object by line.
+func NewJSONExporter(file string, labels map[string]string) (Exporter, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0660)
+	if err != nil {
+		return nil, xerrors.Errorf("opening file: %v", err)
+	}
+	return &jsonExporter{file: f, labels: labels}, nil
+}
+
+func (e *jsonExporter) Export(me Measurement) {
+	e.Lock()
+	defer e.Unlock()
+	if e.closed || math.IsNaN(me.Value) || math.IsInf(me.Value, 0) {
+		return
+	}
+	line, err := json.Marshal(struct {
+		Measurement
+		Labels map[string]string `json:"labels,omitempty"`
+	}{me, e.labels})
+	if err != nil {
+		log.Error("Couldn't encode measure:", err)
+		return
+	}
+	if _, err := e.file.Write(append(line, '\n')); err != nil {
+		log.Error("Couldn't export measure:", err)
+	}
+}
+
+func (e *jsonExporter) Close() error {
+	e.Lock()
+	defer e.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	if err := e.file.Close(); err != nil {
+		return xerrors.Errorf("closing file: %v", err)
+	}
+	return nil
+}
+
+// ExportInterval is how often the exporters sending the measurements over
+// http send them.
+var ExportInterval = time.Second
+
+// exportMaxPending limits the measurements kept by an http exporter when
+// its endpoint is unreachable.
+const exportMaxPending = 100000
+
+// httpExporter posts the measurements in batches to an http endpoint, every
+// ExportInterval.
+type httpExporter struct {
+	url    string
+	header http.Header
+	encode func([]Measurement) []byte
+	client *http.Client
+
+	pending []Measurement
+	dropped int
+	closed  bool
+	sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+	// failed is set once an error is logged, the following ones are only
+	// logged at a higher level
+	failed bool
+}
+
+// newHTTPExporter returns an exporter posting the measurements encoded
+// with encode to the url.
+func newHTTPExporter(url string, header http.Header,
+	encode func([]Measurement) []byte) *httpExporter {
+	e := &httpExporter{
+		url:    url,
+		header: header,
+		encode: encode,
+		client: &http.Client{Timeout: 10 * time.Second},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *httpExporter) Export(me Measurement) {
+	e.Lock()
+	defer e.Unlock()
+	if e.closed || math.IsNaN(me.Value) || math.IsInf(me.Value, 0) {
+		return
+	}
+	if len(e.pending) >= exportMaxPending {
+		e.dropped++
+		return
+	}
+	e.pending = append(e.pending, me)
+}
+
+// run sends the pending measurements every ExportInterval, and a last time
+// when the exporter is closed.
+func (e *httpExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(ExportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.send()
+		case <-e.stop:
+			e.send()
+			return
+		}
+	}
+}
+
+// send posts the pending measurements, which are kept for the next time if
+// the endpoint can't be reached.
+func (e *httpExporter) send() {
+	e.Lock()
+	batch := e.pending
+	e.pending = nil
+	if e.dropped > 0 {
+		log.Warn("Export to", e.url, "dropped", e.dropped, "measures")
+		e.dropped = 0
+	}
+	e.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	err := e.post(e.encode(batch))
+	if err == nil {
+		return
+	}
+	if !e.failed {
+		log.Error("Couldn't export measures to", e.url, ":", err)
+		e.failed = true
+	} else {
+		log.Lvl2("Couldn't export measures to", e.url, ":", err)
+	}
+	e.Lock()
+	if len(e.pending)+len(batch) <= exportMaxPending {
+		e.pending = append(batch, e.pending...)
+	} else {
+		e.dropped += len(batch)
+	}
+	e.Unlock()
+}
+
+func (e *httpExporter) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return xerrors.Errorf("creating request: %v", err)
+	}
+	for k, v := range e.header {
+		req.Header[k] = v
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return xerrors.Errorf("posting: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return xerrors.Errorf("%s %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (e *httpExporter) Close() error {
+	e.Lock()
+	if e.closed {
+		e.Unlock()
+		return nil
+	}
+	e.closed = true
+	e.Unlock()
+	close(e.stop)
+	<-e.done
+	return nil
+}
+
+// NewInfluxExporter returns an exporter writing the measurements to the
+// write endpoint of InfluxDB at url, like
+// "http://localhost:8086/write?db=simul" for InfluxDB 1 or
+// "http://localhost:8086/api/v2/write?org=dedis&bucket=simul" for InfluxDB
+// 2, which needs the token. Every measure is a point of the measurement with
+// its name, with the labels, the host and the version as tags and its value
+// in the "value" field.
+func NewInfluxExporter(url, token string, labels map[string]string) Exporter {
+	header := http.Header{"Content-Type": {"text/plain; charset=utf-8"}}
+	if token != "" {
+		header.Set("Authorization", "Token "+token)
+	}
+	tags := influxTags(labels)
+	return newHTTPExporter(url, header, func(batch []Measurement) []byte {
+		return influxLines(batch, tags)
+	})
+}
+
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+var influxNameEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+
+// influxTags returns the labels as the tags of the line protocol, sorted by
+// key as InfluxDB prefers them.
+func influxTags(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k, v := range labels {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var tags strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&tags, ",%s=%s", influxEscaper.Replace(k),
+			influxEscaper.Replace(labels[k]))
+	}
+	return tags.String()
+}
+
+// influxLines returns the measurements in the line protocol of InfluxDB.
+func influxLines(batch []Measurement, tags string) []byte {
+	var buf bytes.Buffer
+	for _, me := range batch {
+		buf.WriteString(influxNameEscaper.Replace(me.Name))
+		buf.WriteString(tags)
+		if me.Host != InvalidHostIndex {
+			fmt.Fprintf(&buf, ",host=%d", me.Host)
+		}
+		if me.Version != "" {
+			fmt.Fprintf(&buf, ",version=%s", influxEscaper.Replace(me.Version))
+		}
+		fmt.Fprintf(&buf, " value=%s %d\n",
+			strconv.FormatFloat(me.Value, 'g', -1, 64), me.Time.UnixNano())
+	}
+	return buf.Bytes()
+}
+
+// NewPrometheusExporter returns an exporter sending the measurements to the
+// remote-write endpoint at url, like "http://localhost:9090/api/v1/write".
+// Every measure is a sample of the metric with its name, with the labels,
+// the host and the version as labels. The names are changed to be valid in Prometheus.
+func NewPrometheusExporter(url string, labels map[string]string) Exporter {
+	header := http.Header{
+		"Content-Type":                      {"application/x-protobuf"},
+		"Content-Encoding":                  {"snappy"},
+		"X-Prometheus-Remote-Write-Version": {"0.1.0"},
+	}
+	var base []promLabel
+	for k, v := range labels {
+		if v != "" {
+			base = append(base, promLabel{promName(k), v})
+		}
+	}
+	return newHTTPExporter(url, header, func(batch []Measurement) []byte {
+		return snappyEncode(promWriteRequest(batch, base))
+	})
+}
+
+type promLabel struct {
+	name, value string
+}
+
+// promName returns the name with the characters not allowed in the names of
+// Prometheus replaced by '_'.
+func promName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c == '_' || c == ':' || c >= 'a' && c <= 'z' ||
+			c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' && i > 0) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// promWriteRequest returns the protobuf encoding of the remote-write request
+// of the measurements, with a time-series by name and host. The samples of
+// a time-series get increasing timestamps in ms, as Prometheus requires.
+func promWriteRequest(batch []Measurement, labels []promLabel) []byte {
+	type series struct {
+		labels  []promLabel
+		samples [][]byte
+		last    int64
+	}
+	var order []string
+	all := map[string]*series{}
+	for _, me := range batch {
+		key := me.Name + "/" + strconv.Itoa(me.Host)
+		s, ok := all[key]
+		if !ok {
+			ls := append([]promLabel{{"__name__", promName(me.Name)}}, labels...)
+			if me.Host != InvalidHostIndex {
+				ls = append(ls, promLabel{"host", strconv.Itoa(me.Host)})
+			}
+			if me.Version != "" {
+				ls = append(ls, promLabel{"version", me.Version})
+			}
+			sort.Slice(ls, func(i, j int) bool { return ls[i].name < ls[j].name })
+			s = &series{labels: ls, last: math.MinInt64}
+			all[key] = s
+			order = append(order, key)
+		}
+		ts := me.Time.UnixNano() / int64(time.Millisecond)
+		if ts <= s.last {
+			ts = s.last + 1
+		}
+		s.last = ts
+		var sample []byte
+		sample = protoFixed64(sample, 1, math.Float64bits(me.Value))
+		sample = protoVarint(sample, 2, uint64(ts))
+		s.samples = append(s.samples, sample)
+	}
+	var req []byte
+	for _, key := range order {
+		s := all[key]
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = protoBytes(label, 1, []byte(l.name))
+			label = protoBytes(label, 2, []byte(l.value))
+			ts = protoBytes(ts, 1, label)
+		}
+		for _, sample := range s.samples {
+			ts = protoBytes(ts, 2, sample)
+		}
+		req = protoBytes(req, 1, ts)
+	}
+	return req
+}
+
+// appendUvarint appends the varint encoding of v to buf.
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+// protoVarint appends the varint field to buf.
+func protoVarint(buf []byte, field int, v uint64) []byte {
+	buf = appendUvarint(buf, uint64(field<<3))
+	return appendUvarint(buf, v)
+}
+
+// protoFixed64 appends the 64-bit field to buf.
+func protoFixed64(buf []byte, field int, v uint64) []byte {
+	buf = appendUvarint(buf, uint64(field<<3|1))
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+// protoBytes appends the length-delimited field to buf.
+func protoBytes(buf []byte, field int, v []byte) []byte {
+	buf = appendUvarint(buf, uint64(field<<3|2))
+	buf = appendUvarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
+
+// snappyMaxLiteral is the longest literal written by snappyEncode.
+const snappyMaxLiteral = 1 << 16
+
+// snappyEncode returns data in the block format of snappy, as literals
+// only: the measurements are small, and it avoids the dependency.
+func snappyEncode(data []byte) []byte {
+	buf := appendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		n := len(data)
+		if n > snappyMaxLiteral {
+			n = snappyMaxLiteral
+		}
+		switch l := n - 1; {
+		case l < 60:
+			buf = append(buf, byte(l<<2))
+		case l < 1<<8:
+			buf = append(buf, 60<<2, byte(l))
+		default:
+			buf = append(buf, 61<<2, byte(l), byte(l>>8))
+		}
+		buf = append(buf, data[:n]...)
+		data = data[n:]
+	}
+	return buf
+}
@@ -0,0 +1,235 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONExporter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "measures.json")
+	e, err := NewJSONExporter(file, map[string]string{"hosts": "8"})
+	require.NoError(t, err)
+	now := time.Now()
+	e.Export(Measurement{Name: "round_wall", Value: 1.5, Host: 2, Time: now})
+	e.Export(Measurement{Name: "round_wall", Value: math.NaN(), Host: 2, Time: now})
+	require.NoError(t, e.Close())
+	e.Export(Measurement{Name: "round_wall", Value: 2, Host: 2, Time: now})
+
+	out, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	require.Len(t, lines, 1)
+	var me struct {
+		Measurement
+		Labels map[string]string
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &me))
+	require.Equal(t, "round_wall", me.Name)
+	require.Equal(t, 1.5, me.Value)
+	require.Equal(t, 2, me.Host)
+	require.True(t, now.Equal(me.Time))
+	require.Equal(t, map[string]string{"hosts": "8"}, me.Labels)
+}
+
+// recordExporter keeps the measurements it exports.
+type recordExporter []Measurement
+
+func (r *recordExporter) Export(me Measurement) { *r = append(*r, me) }
+func (r *recordExporter) Close() error          { return nil }
+
+func TestMonitor_AddExporter(t *testing.T) {
+	m := NewMonitor(NewStats(nil))
+	r := &recordExporter{}
+	m.AddExporter(r)
+	m.update(&singleMeasure{Name: "round", Value: 2, Host: 1})
+	require.Len(t, *r, 1)
+	require.Equal(t, "round", (*r)[0].Name)
+	require.Equal(t, 2.0, (*r)[0].Value)
+	require.Equal(t, 1, (*r)[0].Host)
+	require.False(t, (*r)[0].Time.IsZero())
+	require.Equal(t, []string{"round"}, m.stats.keys)
+
+	m.SetHostVersions([]string{"current", "other"})
+	m.update(&singleMeasure{Name: "round", Value: 2, Host: 1})
+	m.update(&singleMeasure{Name: "setup", Value: 2, Host: InvalidHostIndex})
+	require.Equal(t, "other", (*r)[1].Version)
+	require.Equal(t, "", (*r)[2].Version)
+}
+
+// exportServer records the bodies and headers posted to it.
+type exportServer struct {
+	bodies  [][]byte
+	headers []http.Header
+	status  int
+	sync.Mutex
+}
+
+func (s *exportServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	s.bodies = append(s.bodies, body)
+	s.headers = append(s.headers, r.Header)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestInfluxExporter(t *testing.T) {
+	s := &exportServer{status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	e := NewInfluxExporter(srv.URL+"/write?db=simul", "secret",
+		map[string]string{"hosts": "8", "bf": "2", "name": "a b"})
+	e.Export(Measurement{Name: "round_wall", Value: 1.5, Host: 2,
+		Time: time.Unix(1, 5)})
+	// the measures are kept while the server fails
+	e.(*httpExporter).send()
+	s.Lock()
+	s.status = 0
+	s.Unlock()
+	e.Export(Measurement{Name: "setup", Value: 3, Host: InvalidHostIndex,
+		Time: time.Unix(2, 0)})
+	e.Export(Measurement{Name: "setup", Value: 4, Host: 3, Version: "v3.2",
+		Time: time.Unix(3, 0)})
+	require.NoError(t, e.Close())
+
+	require.Len(t, s.bodies, 1)
+	require.Equal(t, "round_wall,bf=2,hosts=8,name=a\\ b,host=2 value=1.5 1000000005\n"+
+		"setup,bf=2,hosts=8,name=a\\ b value=3 2000000000\n"+
+		"setup,bf=2,hosts=8,name=a\\ b,host=3,version=v3.2 value=4 3000000000\n",
+		string(s.bodies[0]))
+	require.Equal(t, "Token secret", s.headers[0].Get("Authorization"))
+}
+
+func TestPrometheusExporter(t *testing.T) {
+	s := &exportServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	e := NewPrometheusExporter(srv.URL+"/api/v1/write",
+		map[string]string{"hosts": "8"})
+	at := time.Unix(10, 0)
+	e.Export(Measurement{Name: "round.wall", Value: 1.5, Host: 2, Time: at})
+	e.Export(Measurement{Name: "round.wall", Value: 2.5, Host: 2, Time: at})
+	e.Export(Measurement{Name: "setup", Value: 3, Host: InvalidHostIndex, Time: at})
+	require.NoError(t, e.Close())
+
+	require.Len(t, s.bodies, 1)
+	require.Equal(t, "snappy", s.headers[0].Get("Content-Encoding"))
+	req := snappyDecodeLiterals(t, s.bodies[0])
+	require.Equal(t, promWriteRequest([]Measurement{
+		{Name: "round.wall", Value: 1.5, Host: 2, Time: at},
+		{Name: "round.wall", Value: 2.5, Host: 2, Time: at},
+		{Name: "setup", Value: 3, Host: InvalidHostIndex, Time: at},
+	}, []promLabel{{"hosts", "8"}}), req)
+
+	// two time-series with sorted labels, the second sample of the first
+	// one a millisecond later
+	var series [][]byte
+	for len(req) > 0 {
+		var ts []byte
+		req, ts = protoField(t, req, 1)
+		series = append(series, ts)
+	}
+	require.Len(t, series, 2)
+	var labels []string
+	rest := series[0]
+	var samples [][]byte
+	for len(rest) > 0 {
+		var field int
+		var v []byte
+		field, rest, v = protoAny(t, rest)
+		if field == 1 {
+			_, name := protoField(t, v, 1)
+			_, value := protoField(t, v[len(name)+2:], 2)
+			labels = append(labels, string(name)+"="+string(value))
+		} else {
+			samples = append(samples, v)
+		}
+	}
+	require.Equal(t, []string{"__name__=round_wall", "host=2", "hosts=8"}, labels)
+	require.Len(t, samples, 2)
+	require.Equal(t, byte(1<<3|1), samples[1][0])
+	require.Equal(t, 2.5, math.Float64frombits(binary.LittleEndian.Uint64(samples[1][1:9])))
+	ts, _ := binary.Uvarint(samples[1][10:])
+	require.Equal(t, uint64(10001), ts)
+}
+
+func TestPromName(t *testing.T) {
+	require.Equal(t, "round_wall", promName("round_wall"))
+	require.Equal(t, "_round_wall_avg", promName("0round wall-avg"))
+}
+
+func TestSnappyEncode(t *testing.T) {
+	for _, n := range []int{0, 1, 60, 61, 300, snappyMaxLiteral + 10} {
+		data := bytes.Repeat([]byte{7}, n)
+		require.Equal(t, data, snappyDecodeLiterals(t, snappyEncode(data)))
+	}
+}
+
+// snappyDecodeLiterals decodes a snappy block made only of literals.
+func snappyDecodeLiterals(t *testing.T, buf []byte) []byte {
+	n, l := binary.Uvarint(buf)
+	require.True(t, l > 0)
+	buf = buf[l:]
+	out := []byte{}
+	for len(buf) > 0 {
+		tag := buf[0]
+		require.Equal(t, byte(0), tag&3)
+		length := int(tag >> 2)
+		buf = buf[1:]
+		switch length {
+		case 60:
+			length, buf = int(buf[0]), buf[1:]
+		case 61:
+			length, buf = int(buf[0])|int(buf[1])<<8, buf[2:]
+		}
+		out = append(out, buf[:length+1]...)
+		buf = buf[length+1:]
+	}
+	require.Equal(t, int(n), len(out))
+	return out
+}
+
+// protoField returns the rest of buf and the value of its first field,
+// which must be length-delimited and have the given number.
+func protoField(t *testing.T, buf []byte, field int) ([]byte, []byte) {
+	f, rest, v := protoAny(t, buf)
+	require.Equal(t, field, f)
+	return rest, v
+}
+
+// protoAny returns the number of the first field of buf, the rest of buf,
+// and its value, the raw bytes for the fixed64 and varint fields.
+func protoAny(t *testing.T, buf []byte) (int, []byte, []byte) {
+	key, l := binary.Uvarint(buf)
+	require.True(t, l > 0)
+	buf = buf[l:]
+	switch key & 7 {
+	case 2:
+		n, l := binary.Uvarint(buf)
+		require.True(t, l > 0)
+		return int(key >> 3), buf[l+int(n):], buf[l : l+int(n)]
+	case 1:
+		return int(key >> 3), buf[8:], buf[:8]
+	default:
+		_, l := binary.Uvarint(buf)
+		return int(key >> 3), buf[l:], buf[:l]
+	}
+}
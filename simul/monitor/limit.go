@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// timeLimit aborts the run of a monitor when a time measure takes too long.
+type timeLimit struct {
+	name  string
+	max   time.Duration
+	timer *time.Timer
+	sync.Mutex
+}
+
+// BeginMeasure tells the monitor that the time measure of the given name
+// starts, so that it can abort the run if the measure isn't recorded within
+// the limit given to SetTimeLimit.
+func BeginMeasure(name string) error {
+	return send(&singleMeasure{Name: name, Begin: true})
+}
+
+// SetTimeLimit aborts the run when the wall time of the time measure of the
+// given name exceeds max, either when it is recorded or while it runs. The
+// measure runs from its BeginMeasure, and then from its last record until
+// the next one. It must be called before Listen.
+func (m *Monitor) SetTimeLimit(name string, max time.Duration) {
+	m.limit = &timeLimit{name: name, max: max}
+}
+
+// Aborted returns a channel receiving the reason of the abort of the run,
+// once a measure exceeds its limit. The monitor keeps collecting the
+// measures.
+func (m *Monitor) Aborted() <-chan error {
+	return m.aborted
+}
+
+// abort reports the reason of the abort of the run, if it is the first one.
+func (m *Monitor) abort(err error) {
+	m.abortOnce.Do(func() {
+		log.Error("Monitor aborts the run:", err)
+		m.aborted <- err
+	})
+}
+
+// checkLimit checks the measure against the limit of the monitor, and
+// restarts its timer when the limited measure begins or ends.
+func (m *Monitor) checkLimit(meas *singleMeasure) {
+	l := m.limit
+	if l == nil {
+		return
+	}
+	switch meas.Name {
+	case l.name:
+		if meas.Begin {
+			l.start(m)
+		}
+	case l.name + "_wall":
+		if d := time.Duration(meas.Value * 1e9); d > l.max {
+			m.abort(xerrors.Errorf("%s took %v, more than %v", l.name, d, l.max))
+			return
+		}
+		l.start(m)
+	}
+}
+
+// start restarts the timer of the limit.
+func (l *timeLimit) start(m *Monitor) {
+	l.Lock()
+	defer l.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.timer = time.AfterFunc(l.max, func() {
+		m.abort(xerrors.Errorf("%s didn't end within %v", l.name, l.max))
+	})
+}
+
+// stop stops the timer of the limit.
+func (l *timeLimit) stop() {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+}
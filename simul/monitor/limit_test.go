@@ -0,0 +1,37 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor_SetTimeLimit(t *testing.T) {
+	m := NewMonitor(NewStats(nil))
+	m.SetTimeLimit("round", 100*time.Millisecond)
+	m.update(&singleMeasure{Name: "round_wall", Value: 0.05})
+	m.update(&singleMeasure{Name: "round", Begin: true})
+	require.Nil(t, m.stats.Value("round"))
+	select {
+	case err := <-m.Aborted():
+		require.Contains(t, err.Error(), "didn't end")
+	case <-time.After(time.Second):
+		require.Fail(t, "round didn't abort")
+	}
+
+	m = NewMonitor(NewStats(nil))
+	m.SetTimeLimit("round", time.Second)
+	m.update(&singleMeasure{Name: "round_wall", Value: 0.5})
+	m.update(&singleMeasure{Name: "round_wall", Value: 2})
+	err := <-m.Aborted()
+	require.Contains(t, err.Error(), "took 2s")
+	// the measures are still collected
+	require.Equal(t, 2, m.stats.Value("round_wall").NumValue())
+	m.Stop()
+	select {
+	case err := <-m.Aborted():
+		require.Fail(t, "aborted twice", err)
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
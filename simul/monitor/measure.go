@@ -51,6 +51,14 @@ type singleMeasure struct {
 	Name  string
 	Value float64
 	Host  int
+	// Source is set by the processes reporting to the dashboard, with Log
+	// for the messages they log and without for their heartbeats.
+	Source string `json:",omitempty"`
+	Log    string `json:",omitempty"`
+	// Profile is a profile sent with SendProfile, Name being its file.
+	Profile []byte `json:",omitempty"`
+	// Begin is set by BeginMeasure, to start the time limit of a measure.
+	Begin bool `json:",omitempty"`
 }
 
 // TimeMeasure represents a measure regarding time: It includes the wallclock
@@ -137,6 +145,8 @@ func NewTimeMeasureWithHost(name string, host int) *TimeMeasure {
 // - system time: *name*_system
 //
 // - user time: *name*_user
+//
+// and then calls the functions given to OnRecord for its name.
 func (tm *TimeMeasure) Record() {
 	// Wall time measurement
 	tm.Wall = newSingleMeasureWithHost(tm.name+"_wall", float64(time.Since(tm.lastWallTime))/1.0e9, tm.host)
@@ -148,7 +158,7 @@ func (tm *TimeMeasure) Record() {
 	tm.User.Record()
 	// reset timers
 	tm.reset()
-
+	recorded(tm.name)
 }
 
 // reset reset the time fields of this time measure
@@ -274,6 +284,7 @@ func send(v interface{}) error {
 
 // EndAndCleanup sends a message to end the logging and closes the connection
 func EndAndCleanup() {
+	stopReport()
 	if err := send(newSingleMeasure("end", 0)); err != nil {
 		log.Error("Error while sending 'end' message:", err)
 	}
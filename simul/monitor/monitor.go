@@ -61,6 +61,20 @@ type Monitor struct {
 
 	SinkPort     uint16
 	sinkPortChan chan uint16
+
+	// exporters streaming the measures
+	exporters []Exporter
+	// versions of the hosts, by index, in a mixed-version simulation
+	hostVersions []string
+	// directory where the profiles of the processes are saved
+	profileDir string
+	// run of the dashboard showing the monitor, if any
+	dashboard *DashboardRun
+	// limit of the time of a measure, if any
+	limit *timeLimit
+	// aborted receives the reason of the abort of the run
+	aborted   chan error
+	abortOnce sync.Once
 }
 
 // NewMonitor returns a new monitor given the stats
@@ -74,6 +88,7 @@ func NewMonitor(stats *Stats) *Monitor {
 		done:         make(chan string),
 		listenerLock: new(sync.Mutex),
 		sinkPortChan: make(chan uint16, 1),
+		aborted:      make(chan error, 1),
 	}
 }
 
@@ -149,6 +164,7 @@ func (m *Monitor) Listen() error {
 		}
 	}
 	log.Lvl2("Monitor finished waiting")
+	m.limit.stop()
 	m.mutexConn.Lock()
 	m.conns = make(map[string]net.Conn)
 	m.mutexConn.Unlock()
@@ -159,6 +175,7 @@ func (m *Monitor) Listen() error {
 // And will stop updating the stats
 func (m *Monitor) Stop() {
 	log.Lvl2("Monitor Stop")
+	m.limit.stop()
 	m.listenerLock.Lock()
 	if m.listener != nil {
 		if err := m.listener.Close(); err != nil {
@@ -196,7 +213,19 @@ func (m *Monitor) handleConnection(conn net.Conn) {
 			}
 		}
 
+		if measure.Profile != nil {
+			if err := m.saveProfile(measure); err != nil {
+				log.Error("Couldn't save profile:", err)
+			}
+			continue
+		}
 		log.Lvlf3("Monitor: received a Measure from %s: %+v", conn.RemoteAddr().String(), measure)
+		if measure.Source != "" {
+			if m.dashboard != nil {
+				m.dashboard.report(measure)
+			}
+			continue
+		}
 		// Special case where the measurement is indicating a FINISHED step
 		switch strings.ToLower(measure.Name) {
 		case "end":
@@ -212,8 +241,13 @@ func (m *Monitor) handleConnection(conn net.Conn) {
 // updateBucket will add that specific measure to all the bucket
 // that match the network address.
 func (m *Monitor) update(meas *singleMeasure) {
+	m.checkLimit(meas)
+	if meas.Begin {
+		return
+	}
 	// global stats
 	m.stats.Update(meas)
 	// per bucket stats if defined
 	m.buckets.Update(meas)
+	m.export(meas)
 }
@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// SendProfile sends a profile captured by this process to the monitor,
+// which saves it under the given file name in its profile directory.
+func SendProfile(name string, profile []byte) error {
+	return send(&singleMeasure{Name: name, Profile: profile})
+}
+
+// SetProfileDir sets the directory where the monitor saves the profiles it
+// receives. Without it, they are dropped. It must be called before Listen.
+func (m *Monitor) SetProfileDir(dir string) {
+	m.profileDir = dir
+}
+
+// saveProfile writes the profile of the measure in the profile directory.
+func (m *Monitor) saveProfile(meas *singleMeasure) error {
+	if m.profileDir == "" {
+		log.Lvl2("Monitor: dropping profile", meas.Name)
+		return nil
+	}
+	if err := os.MkdirAll(m.profileDir, 0777); err != nil {
+		return xerrors.Errorf("creating directory: %v", err)
+	}
+	// the name comes from the network, it must stay in the directory
+	file := filepath.Join(m.profileDir, filepath.Base(meas.Name))
+	if err := ioutil.WriteFile(file, meas.Profile, 0660); err != nil {
+		return xerrors.Errorf("writing profile: %v", err)
+	}
+	log.Lvl2("Monitor: saved profile", file)
+	return nil
+}
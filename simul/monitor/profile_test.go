@@ -0,0 +1,37 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	stats := NewStats(nil)
+	mon := NewMonitor(stats)
+	mon.SetProfileDir(filepath.Join(dir, "0"))
+	go mon.Listen()
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, ConnectSink("localhost:"+strconv.Itoa(int(mon.SinkPort))))
+
+	// the profiles can't be saved outside of the directory
+	require.NoError(t, SendProfile("../host_round0_cpu.pprof", []byte("profile")))
+	EndAndCleanup()
+	time.Sleep(100 * time.Millisecond)
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "0", "host_round0_cpu.pprof"))
+	require.NoError(t, err)
+	require.Equal(t, "profile", string(buf))
+	// profiles aren't measures
+	require.Nil(t, stats.Value("../host_round0_cpu.pprof"))
+	mon.Stop()
+}
@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// ReportInterval is how often a process reporting to the dashboard sends a
+// heartbeat.
+var ReportInterval = 5 * time.Second
+
+// reportQueue is how many logged messages wait to be sent to the monitor
+// before the next ones are dropped.
+const reportQueue = 256
+
+var reporting struct {
+	logger int
+	stop   chan struct{}
+	done   chan struct{}
+	sync.Mutex
+}
+
+// Report sends to the monitor the warnings and errors logged by this process
+// and a heartbeat every ReportInterval, so that its dashboard shows the
+// process under the name of source. It must be called after ConnectSink, and
+// stops with EndAndCleanup. With a debug level of 0, the log package prints
+// the warnings and errors without passing them to the loggers, so only the
+// heartbeats are sent.
+func Report(source string) {
+	reporting.Lock()
+	defer reporting.Unlock()
+	if reporting.stop != nil {
+		return
+	}
+	logs := make(chan string, reportQueue)
+	reporting.logger = log.RegisterLogger(&reportLogger{logs: logs})
+	reporting.stop = make(chan struct{})
+	reporting.done = make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(ReportInterval)
+		defer ticker.Stop()
+		// the first heartbeat shows the process at once
+		send(&singleMeasure{Source: source})
+		for {
+			select {
+			case msg := <-logs:
+				send(&singleMeasure{Source: source, Log: msg})
+			case <-ticker.C:
+				send(&singleMeasure{Source: source})
+			case <-stop:
+				return
+			}
+		}
+	}(reporting.stop, reporting.done)
+}
+
+// stopReport stops the reporting of this process, if it is started.
+func stopReport() {
+	reporting.Lock()
+	defer reporting.Unlock()
+	if reporting.stop == nil {
+		return
+	}
+	log.UnregisterLogger(reporting.logger)
+	close(reporting.stop)
+	<-reporting.done
+	reporting.stop = nil
+}
+
+// reportLogger queues the warnings and errors logged by the process. It is
+// called with the lock of the log package, so it must neither log nor block.
+type reportLogger struct {
+	logs chan string
+}
+
+func (l *reportLogger) Log(level int, msg string) {
+	if !strings.HasPrefix(msg, "W") && !strings.HasPrefix(msg, "E") &&
+		!strings.HasPrefix(msg, "F") && !strings.HasPrefix(msg, "P") {
+		return
+	}
+	select {
+	case l.logs <- strings.TrimSpace(msg):
+	default:
+	}
+}
+
+func (l *reportLogger) Close() {}
+
+func (l *reportLogger) GetLoggerInfo() *log.LoggerInfo {
+	return &log.LoggerInfo{DebugLvl: 0}
+}
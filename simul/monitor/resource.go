@@ -0,0 +1,133 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ResourceMeasure measures the resources used by a conode: the cpu time, the
+// resident memory, the goroutines and the bytes sent and received. The cpu
+// time, the memory and the goroutines are those of the process, shared
+// between the conodes it runs, so they are divided by their number.
+type ResourceMeasure struct {
+	name    string
+	host    int
+	counter CounterIO
+	conodes float64
+	baseCPU float64
+	baseTx  uint64
+	baseRx  uint64
+}
+
+// NewResourceMeasure returns a ResourceMeasure of the conode with the given
+// host index, counting its bytes with counter. The process runs the given
+// number of conodes.
+func NewResourceMeasure(name string, counter CounterIO, host, conodes int) *ResourceMeasure {
+	if conodes < 1 {
+		conodes = 1
+	}
+	rm := &ResourceMeasure{name: name, host: host, counter: counter,
+		conodes: float64(conodes)}
+	rm.Reset()
+	return rm
+}
+
+// Reset sets the base of the cpu time and of the bytes to their current
+// value.
+func (rm *ResourceMeasure) Reset() {
+	rm.baseCPU = getCPUTime()
+	rm.baseTx = rm.counter.Tx()
+	rm.baseRx = rm.counter.Rx()
+}
+
+// Record sends the resources used since the last Record or Reset:
+//
+// - cpu time in seconds: *name*_cpu
+//
+// - resident memory in bytes: *name*_rss
+//
+// - number of goroutines: *name*_goroutines
+//
+// - bytes sent and received: *name*_tx and *name*_rx
+func (rm *ResourceMeasure) Record() {
+	cpu := getCPUTime()
+	tx, rx := rm.counter.Tx(), rm.counter.Rx()
+	newSingleMeasureWithHost(rm.name+"_cpu", (cpu-rm.baseCPU)/rm.conodes, rm.host).Record()
+	newSingleMeasureWithHost(rm.name+"_rss", float64(getRSS())/rm.conodes, rm.host).Record()
+	newSingleMeasureWithHost(rm.name+"_goroutines",
+		float64(runtime.NumGoroutine())/rm.conodes, rm.host).Record()
+	newSingleMeasureWithHost(rm.name+"_tx", float64(tx-rm.baseTx), rm.host).Record()
+	newSingleMeasureWithHost(rm.name+"_rx", float64(rx-rm.baseRx), rm.host).Record()
+	rm.baseCPU = cpu
+	rm.baseTx = tx
+	rm.baseRx = rx
+}
+
+// getCPUTime returns the system and user cpu time of the process.
+func getCPUTime() float64 {
+	tSys, tUsr := getRTime()
+	return tSys + tUsr
+}
+
+// getRSS returns the resident memory of the process. Without /proc, it
+// returns the memory the go runtime got from the system.
+func getRSS() uint64 {
+	statm, err := ioutil.ReadFile("/proc/self/statm")
+	if err == nil {
+		fields := strings.Fields(string(statm))
+		if len(fields) > 1 {
+			pages, err := strconv.ParseUint(fields[1], 10, 64)
+			if err == nil {
+				return pages * uint64(os.Getpagesize())
+			}
+		}
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Sys
+}
+
+var recordHooks struct {
+	hooks map[string]map[int]func()
+	next  int
+	sync.Mutex
+}
+
+// OnRecord calls f every time a TimeMeasure with the given name is recorded
+// in this process, until the returned function is called. f must not block,
+// as it is called by Record.
+func OnRecord(name string, f func()) func() {
+	recordHooks.Lock()
+	defer recordHooks.Unlock()
+	if recordHooks.hooks == nil {
+		recordHooks.hooks = make(map[string]map[int]func())
+	}
+	if recordHooks.hooks[name] == nil {
+		recordHooks.hooks[name] = make(map[int]func())
+	}
+	key := recordHooks.next
+	recordHooks.next++
+	recordHooks.hooks[name][key] = f
+	return func() {
+		recordHooks.Lock()
+		defer recordHooks.Unlock()
+		delete(recordHooks.hooks[name], key)
+	}
+}
+
+// recorded calls the functions waiting for the records of name.
+func recorded(name string) {
+	recordHooks.Lock()
+	var fs []func()
+	for _, f := range recordHooks.hooks[name] {
+		fs = append(fs, f)
+	}
+	recordHooks.Unlock()
+	for _, f := range fs {
+		f()
+	}
+}
@@ -0,0 +1,45 @@
+package monitor
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceMeasure(t *testing.T) {
+	mon, stats := setupMonitor(t)
+	mon.InsertBucket(0, []string{"1:2"}, NewStats(nil))
+	dm := &DummyCounterIO{}
+	rm := NewResourceMeasure("res", dm, 1, 2)
+	rm.Record()
+	time.Sleep(100 * time.Millisecond)
+
+	stats.Collect()
+	require.Equal(t, 10.0, stats.Value("res_tx").Avg())
+	require.Equal(t, 10.0, stats.Value("res_rx").Avg())
+	require.True(t, stats.Value("res_cpu").Avg() >= 0)
+	require.True(t, stats.Value("res_rss").Avg() > 0)
+	require.True(t, stats.Value("res_goroutines").Avg() > 0)
+	require.True(t, stats.Value("res_goroutines").Avg() <= float64(runtime.NumGoroutine()))
+	require.NotNil(t, mon.buckets.Get(0).Value("res_rss"))
+
+	EndAndCleanup()
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestOnRecord(t *testing.T) {
+	setupMonitor(t)
+	rounds := 0
+	stop := OnRecord("round", func() { rounds++ })
+	NewTimeMeasure("round").Record()
+	NewTimeMeasure("setup").Record()
+	require.Equal(t, 1, rounds)
+	stop()
+	NewTimeMeasure("round").Record()
+	require.Equal(t, 1, rounds)
+
+	EndAndCleanup()
+	time.Sleep(100 * time.Millisecond)
+}
@@ -368,15 +368,17 @@ func NewValue(name string) *Value {
 	return &Value{name: name, store: make([]float64, 0)}
 }
 
-// Store takes this new time and stores it for later analysis
-// Since we might want to do percentile sorting, we need to have all the Values
-// For the moment, we do a simple store of the Value, but note that some
-// streaming percentile algorithm exists in case the number of messages is
-// growing to big.
+// Store takes this new time and stores it for later analysis. The
+// statistics are updated with it, so that they can be read while the
+// measures are streamed, before Collect. Since we might want to do
+// percentile sorting, we need to have all the Values. For the moment, we do
+// a simple store of the Value, but note that some streaming percentile
+// algorithm exists in case the number of messages is growing to big.
 func (t *Value) Store(newTime float64) {
 	t.Lock()
 	defer t.Unlock()
 	t.store = append(t.store, newTime)
+	t.add(newTime)
 }
 
 // Collect will collect all float64 stored in the store's Value and will compute
@@ -384,33 +386,62 @@ func (t *Value) Store(newTime float64) {
 func (t *Value) Collect() {
 	t.Lock()
 	defer t.Unlock()
+	// the values might have been filtered since they were stored
+	t.n = 0
+	t.sum = 0
+	t.min = 0
+	t.max = 0
+	t.dev = 0
+	for _, newTime := range t.store {
+		t.add(newTime)
+	}
+}
+
+// add updates the statistics with a new value. It must be called with the
+// lock.
+func (t *Value) add(newTime float64) {
 	// It is kept as a streaming average / dev processus for the moment (not the most
 	// optimized).
 	// streaming dev algo taken from http://www.johndcook.com/blog/standard_deviation/
-	t.sum = 0
-	for _, newTime := range t.store {
-		// nothings takes 0 ms to complete, so we know it's the first time
-		if t.min > newTime || t.n == 0 {
-			t.min = newTime
-		}
-		if t.max < newTime {
-			t.max = newTime
-		}
+	// nothings takes 0 ms to complete, so we know it's the first time
+	if t.min > newTime || t.n == 0 {
+		t.min = newTime
+	}
+	if t.max < newTime || t.n == 0 {
+		t.max = newTime
+	}
 
-		t.n++
-		if t.n == 1 {
-			t.oldM = newTime
-			t.newM = newTime
-			t.oldS = 0.0
-		} else {
-			t.newM = t.oldM + (newTime-t.oldM)/float64(t.n)
-			t.newS = t.oldS + (newTime-t.oldM)*(newTime-t.newM)
-			t.oldM = t.newM
-			t.oldS = t.newS
-		}
-		t.dev = math.Sqrt(t.newS / float64(t.n-1))
-		t.sum += newTime
+	t.n++
+	if t.n == 1 {
+		t.oldM = newTime
+		t.newM = newTime
+		t.oldS = 0.0
+		t.newS = 0.0
+	} else {
+		t.newM = t.oldM + (newTime-t.oldM)/float64(t.n)
+		t.newS = t.oldS + (newTime-t.oldM)*(newTime-t.newM)
+		t.oldM = t.newM
+		t.oldS = t.newS
+	}
+	t.dev = math.Sqrt(t.newS / float64(t.n-1))
+	t.sum += newTime
+}
+
+// Percentile returns the value below which the given percentage of the
+// stored values are, using the nearest rank. It is computed from the stored
+// values, so it can be read while the measures are streamed.
+func (t *Value) Percentile(percent float64) float64 {
+	t.Lock()
+	defer t.Unlock()
+	if len(t.store) == 0 {
+		return 0
+	}
+	p, err := stats.PercentileNearestRank(t.store, percent)
+	if err != nil {
+		log.Lvl2("Monitor: couldn't compute percentile of", t.name, ":", err)
+		return 0
 	}
+	return p
 }
 
 // Filter outs its Values
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/require"
 	"go.dedis.ch/onet/v3/log"
 )
 
@@ -97,6 +98,27 @@ func TestValues(t *testing.T) {
 	}
 }
 
+func TestValues_Streaming(t *testing.T) {
+	v := NewValue("test")
+	require.Equal(t, 0.0, v.Percentile(50))
+	for _, f := range []float64{15, 5, 10, 20} {
+		v.Store(f)
+	}
+	// the statistics are computed while the values are stored
+	require.Equal(t, 4, v.NumValue())
+	require.Equal(t, 12.5, v.Avg())
+	require.Equal(t, 5.0, v.Min())
+	require.Equal(t, 20.0, v.Max())
+	require.Equal(t, 10.0, v.Percentile(50))
+	require.Equal(t, 20.0, v.Percentile(99))
+
+	// collecting again computes the same statistics
+	v.Collect()
+	v.Collect()
+	require.Equal(t, 4, v.NumValue())
+	require.Equal(t, 50.0, v.Sum())
+}
+
 func TestStatsAverage(t *testing.T) {
 	m := make(map[string]string)
 	m["servers"] = "1"
@@ -0,0 +1,58 @@
+package platform
+
+import (
+	"github.com/BurntSushi/toml"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// byzantineConfig holds the byzantine conodes of a simulation, read from the
+// run-configuration.
+type byzantineConfig struct {
+	// Byzantine is the name of the behavior of the byzantine conodes, as
+	// registered with onet.ByzantineRegister.
+	Byzantine string
+	// ByzantinePercent is the percentage of byzantine conodes. The root of
+	// the simulation is always honest.
+	ByzantinePercent int
+	// ByzantineSeed chooses the byzantine conodes. All the conodes of a
+	// simulation use it to agree on the same ones.
+	ByzantineSeed int64
+}
+
+// readByzantine returns the byzantine conodes of the simulation
+// configuration, or nil if there are none.
+func readByzantine(config string) (*byzantineConfig, error) {
+	bc := &byzantineConfig{}
+	if _, err := toml.Decode(config, bc); err != nil {
+		return nil, xerrors.Errorf("decoding byzantine: %v", err)
+	}
+	if bc.Byzantine == "" || bc.ByzantinePercent <= 0 {
+		return nil, nil
+	}
+	if bc.ByzantinePercent > 100 {
+		return nil, xerrors.New("ByzantinePercent must be at most 100")
+	}
+	return bc, nil
+}
+
+// apply turns byzantine the chosen conodes of the given configurations.
+func (bc *byzantineConfig) apply(configs []*onet.SimulationConfig) error {
+	sc := configs[0]
+	chosen := chooseConodes(sc.Roster, sc.Tree.Root.ServerIdentity,
+		bc.ByzantinePercent, bc.ByzantineSeed)
+	for _, index := range chosen {
+		id := sc.Roster.List[index].ID
+		for _, c := range configs {
+			if !c.Server.ServerIdentity.ID.Equal(id) {
+				continue
+			}
+			if err := c.Server.SetByzantine(bc.Byzantine); err != nil {
+				return xerrors.Errorf("setting behavior: %v", err)
+			}
+			log.Lvl2("Conode", index, "is byzantine:", bc.Byzantine)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestReadByzantine(t *testing.T) {
+	bc, err := readByzantine(`byzantine = "silent"`)
+	require.NoError(t, err)
+	require.Nil(t, bc)
+
+	bc, err = readByzantine(`byzantine = "silent"
+byzantinepercent = 30
+byzantineseed = 2`)
+	require.NoError(t, err)
+	require.Equal(t, &byzantineConfig{Byzantine: "silent", ByzantinePercent: 30,
+		ByzantineSeed: 2}, bc)
+
+	_, err = readByzantine(`byzantine = "silent"
+byzantinepercent = 101`)
+	require.Error(t, err)
+}
+
+func TestByzantineApply(t *testing.T) {
+	local := onet.NewLocalTest(suites.MustFind("Ed25519"))
+	defer local.CloseAll()
+	servers, roster, tree := local.GenTree(5, true)
+	configs := make([]*onet.SimulationConfig, len(servers))
+	for i, s := range servers {
+		configs[i] = &onet.SimulationConfig{Roster: roster, Tree: tree, Server: s}
+	}
+
+	bc := &byzantineConfig{Byzantine: "corrupt", ByzantinePercent: 50}
+	require.NoError(t, bc.apply(configs))
+	chosen := chooseConodes(roster, tree.Root.ServerIdentity, 50, 0)
+	require.Len(t, chosen, 2)
+	for i, s := range servers {
+		if i == chosen[0] || i == chosen[1] {
+			require.Equal(t, "corrupt", s.Byzantine())
+		} else {
+			require.Equal(t, "", s.Byzantine())
+		}
+	}
+
+	bc.Byzantine = "unknown"
+	require.Error(t, bc.apply(configs))
+}
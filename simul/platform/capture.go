@@ -0,0 +1,144 @@
+package platform
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/app"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// captureDir is the directory where the servers record the messages they
+// receive, next to the configuration of the simulation.
+const captureDir = "captures"
+
+// captureFile returns the file of the capture of the server.
+func captureFile(si *network.ServerIdentity) string {
+	name := strings.Replace(si.Address.NetworkAddress(), ":", "_", -1)
+	return filepath.Join(captureDir, name+".capture")
+}
+
+// startCapture records the messages received by the server in its capture
+// file, until the returned function is called.
+func startCapture(server *onet.Server) (func(), error) {
+	if err := os.MkdirAll(captureDir, 0770); err != nil {
+		return nil, xerrors.Errorf("creating directory: %v", err)
+	}
+	f, err := os.Create(captureFile(server.ServerIdentity))
+	if err != nil {
+		return nil, xerrors.Errorf("creating file: %v", err)
+	}
+	w := bufio.NewWriter(f)
+	capture := network.NewCapture(w)
+	server.SetCapture(capture)
+	return func() {
+		if err := capture.Stop(); err != nil {
+			log.Error("Couldn't capture the messages of", server.ServerIdentity,
+				":", err)
+		}
+		if err := w.Flush(); err != nil {
+			log.Error("Couldn't write capture:", err)
+		}
+		if err := f.Close(); err != nil {
+			log.Error("Couldn't close capture:", err)
+		}
+	}, nil
+}
+
+// Replay feeds the messages of a capture back into the server that
+// received them, at the same pace, to dissect a failed simulation under a
+// debugger. The server is created from the configuration of the simulation
+// in the parent directory of the captures, with an empty database, and set
+// up by the Node method of the simulation. It doesn't listen, so the
+// messages it sends to the other servers are lost.
+func Replay(suite, simul, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return xerrors.Errorf("opening capture: %v", err)
+	}
+	msgs, err := network.ReadCapture(f, suites.MustFind(suite))
+	f.Close()
+	if err != nil {
+		if len(msgs) == 0 {
+			return xerrors.Errorf("reading capture: %v", err)
+		}
+		log.Warn("Replaying the start of the capture:", err)
+	}
+	if len(msgs) == 0 {
+		return xerrors.New("no message in the capture")
+	}
+	to := msgs[0].To
+
+	// the servers keep their database in the directory of the
+	// configuration, which must be empty
+	tmp, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		return xerrors.Errorf("creating directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	config := filepath.Join(filepath.Dir(filepath.Dir(file)), onet.SimulationFileName)
+	if err := app.Copy(tmp, config); err != nil {
+		return xerrors.Errorf("copying configuration: %v", err)
+	}
+	// on localhost, the servers are renamed to 127.0.0.1 after loading
+	// the configuration, so they are found by their port
+	addr := to.Address.NetworkAddress()
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "127.0.0.1" {
+		addr = ":" + port
+	}
+	scs, err := onet.LoadSimulationConfig(suite, tmp, addr)
+	if err != nil {
+		return xerrors.Errorf("loading configuration: %v", err)
+	}
+	var sc *onet.SimulationConfig
+	for _, s := range scs {
+		if s.Server.ServerIdentity.ID.Equal(to.ID) {
+			sc = s
+		} else {
+			s.Server.Close()
+		}
+	}
+	if sc == nil {
+		return xerrors.Errorf("server %s isn't in the configuration", to)
+	}
+	defer sc.Server.Close()
+	sim, err := onet.NewSimulation(simul, sc.Config)
+	if err != nil {
+		return xerrors.Errorf("creating simulation: %v", err)
+	}
+	if err := sim.Node(sc); err != nil {
+		return xerrors.Errorf("setting up node: %v", err)
+	}
+
+	log.Lvl1("Replaying", len(msgs), "messages received by", to)
+	start := time.Now()
+	for i, cm := range msgs {
+		time.Sleep(time.Until(start.Add(time.Duration(cm.Time - msgs[0].Time))))
+		msgType, msg, err := cm.Message(sc.Server.Suite())
+		if err != nil {
+			// the messages of the simulation itself aren't registered
+			log.Lvl2("Skipping message", i, "from", cm.From, ":", err)
+			continue
+		}
+		log.Lvlf2("Replaying message %d from %s: %T", i, cm.From, msg)
+		err = sc.Server.Dispatch(&network.Envelope{
+			ServerIdentity: cm.From,
+			MsgType:        msgType,
+			Msg:            msg,
+		})
+		if err != nil {
+			log.Lvl2("Couldn't dispatch message", i, ":", err)
+		}
+	}
+	log.Lvl1("Replayed the capture of", to)
+	return nil
+}
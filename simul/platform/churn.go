@@ -0,0 +1,238 @@
+package platform
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/onet/v3/simul/monitor"
+	"golang.org/x/xerrors"
+)
+
+// churnConfig holds the churn of a simulation, read from the
+// run-configuration.
+type churnConfig struct {
+	// ChurnPercent is the percentage of conodes crashed at every churn
+	// event. The root of the simulation is never crashed.
+	ChurnPercent int
+	// ChurnAt lists the durations after the start of the simulation at which
+	// the churn events happen, like "10s 30s".
+	ChurnAt string
+	// ChurnInterval is the duration between two churn events, repeated until
+	// the end of the simulation.
+	ChurnInterval string
+	// ChurnDowntime is how long the crashed conodes stay down. By default,
+	// they stay down until the end of the simulation.
+	ChurnDowntime string
+	// ChurnSeed chooses the crashed conodes. All the conodes of a simulation
+	// use it to agree on the same ones.
+	ChurnSeed int64
+
+	at       []time.Duration
+	interval time.Duration
+	downtime time.Duration
+}
+
+// readChurn returns the churn of the simulation configuration, or nil if
+// there is none.
+func readChurn(config string) (*churnConfig, error) {
+	cc := &churnConfig{}
+	if _, err := toml.Decode(config, cc); err != nil {
+		return nil, xerrors.Errorf("decoding churn: %v", err)
+	}
+	if cc.ChurnPercent <= 0 {
+		return nil, nil
+	}
+	if cc.ChurnPercent > 100 {
+		return nil, xerrors.New("ChurnPercent must be at most 100")
+	}
+	for _, a := range strings.FieldsFunc(cc.ChurnAt, func(r rune) bool {
+		return r == ' ' || r == ','
+	}) {
+		d, err := time.ParseDuration(a)
+		if err != nil {
+			return nil, xerrors.Errorf("ChurnAt: %v", err)
+		}
+		cc.at = append(cc.at, d)
+	}
+	var err error
+	if cc.ChurnInterval != "" {
+		if cc.interval, err = time.ParseDuration(cc.ChurnInterval); err != nil {
+			return nil, xerrors.Errorf("ChurnInterval: %v", err)
+		}
+	}
+	if cc.ChurnDowntime != "" {
+		if cc.downtime, err = time.ParseDuration(cc.ChurnDowntime); err != nil {
+			return nil, xerrors.Errorf("ChurnDowntime: %v", err)
+		}
+	}
+	if len(cc.at) == 0 && cc.interval <= 0 {
+		return nil, xerrors.New("churn needs ChurnAt or ChurnInterval")
+	}
+	return cc, nil
+}
+
+// crashed returns the indexes in the roster of the conodes crashed by the
+// given churn event. All the conodes get the same ones.
+func (cc *churnConfig) crashed(roster *onet.Roster, root *network.ServerIdentity,
+	event int) []int {
+	return chooseConodes(roster, root, cc.ChurnPercent, cc.ChurnSeed+int64(event))
+}
+
+// chooseConodes returns the indexes in the roster of the given percentage of
+// the conodes, never the root, chosen by the seed.
+func chooseConodes(roster *onet.Roster, root *network.ServerIdentity,
+	percent int, seed int64) []int {
+	var candidates []int
+	for i, si := range roster.List {
+		if !si.Equal(root) {
+			candidates = append(candidates, i)
+		}
+	}
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates[:len(candidates)*percent/100]
+}
+
+// churn crashes and restarts the conodes of this process as given by its
+// configuration, from start until stop is called.
+type churn struct {
+	cc      *churnConfig
+	configs []*onet.SimulationConfig
+	// except are the message types the crashed conodes still handle
+	except []network.MessageTypeID
+	// clock runs the timers, the one of the first conode
+	clock onet.Clock
+	start time.Time
+	// down holds when the crashed conodes of this process went down, by
+	// their index in the roster
+	down    map[int]time.Time
+	timers  []onet.ClockTimer
+	stopped bool
+	sync.Mutex
+}
+
+// newChurn returns the churn of the conodes of the given configurations,
+// which crash but keep handling the messages of the except types.
+func newChurn(cc *churnConfig, configs []*onet.SimulationConfig,
+	except ...network.MessageTypeID) *churn {
+	return &churn{cc: cc, configs: configs, except: except,
+		clock: configs[0].Server.Clock(), down: make(map[int]time.Time)}
+}
+
+// run schedules the churn events, starting now.
+func (c *churn) run() {
+	log.Lvl2("Starting churn of", c.cc.ChurnPercent, "percent")
+	c.Lock()
+	c.start = c.clock.Now()
+	c.Unlock()
+	for i, at := range c.cc.at {
+		event := i
+		c.schedule(at, func() { c.event(event) })
+	}
+	if c.cc.interval > 0 {
+		c.every(len(c.cc.at))
+	}
+}
+
+// every schedules the churn event, and the next ones after every interval.
+func (c *churn) every(event int) {
+	c.schedule(c.cc.interval, func() {
+		c.event(event)
+		c.every(event + 1)
+	})
+}
+
+// schedule calls f after d, unless the churn is stopped.
+func (c *churn) schedule(d time.Duration, f func()) {
+	c.Lock()
+	defer c.Unlock()
+	if !c.stopped {
+		c.timers = append(c.timers, c.clock.AfterFunc(d, f))
+	}
+}
+
+// event crashes the conodes of this process chosen by the churn event, and
+// schedules their restart.
+func (c *churn) event(event int) {
+	c.Lock()
+	defer c.Unlock()
+	if c.stopped {
+		return
+	}
+	sc := c.configs[0]
+	crashed := c.cc.crashed(sc.Roster, sc.Tree.Root.ServerIdentity, event)
+	for _, index := range crashed {
+		server := c.server(index)
+		if server == nil {
+			continue
+		}
+		if _, ok := c.down[index]; ok {
+			continue
+		}
+		server.Crash(c.except...)
+		down := c.clock.Now()
+		c.down[index] = down
+		monitor.RecordSingleMeasureWithHost("churn_crash",
+			down.Sub(c.start).Seconds(), index)
+		if c.cc.downtime > 0 {
+			i := index
+			c.timers = append(c.timers, c.clock.AfterFunc(c.cc.downtime, func() {
+				c.Lock()
+				defer c.Unlock()
+				// the conode might have been restarted and crashed again
+				if !c.stopped && c.down[i].Equal(down) {
+					c.restart(i)
+				}
+			}))
+		}
+	}
+}
+
+// server returns the server of this process at the index of the roster, or
+// nil if it runs in another process.
+func (c *churn) server(index int) *onet.Server {
+	id := c.configs[0].Roster.List[index].ID
+	for _, sc := range c.configs {
+		if sc.Server.ServerIdentity.ID.Equal(id) {
+			return sc.Server
+		}
+	}
+	return nil
+}
+
+// restart brings back the crashed conode at the index of the roster.
+func (c *churn) restart(index int) {
+	down, ok := c.down[index]
+	if !ok {
+		return
+	}
+	c.server(index).Restart()
+	delete(c.down, index)
+	monitor.RecordSingleMeasureWithHost("churn_downtime",
+		c.clock.Now().Sub(down).Seconds(), index)
+}
+
+// stop ends the churn and restarts all the crashed conodes of this process,
+// so that the simulation can close them.
+func (c *churn) stop() {
+	c.Lock()
+	defer c.Unlock()
+	if c.stopped {
+		return
+	}
+	c.stopped = true
+	for _, t := range c.timers {
+		t.Stop()
+	}
+	for index := range c.down {
+		c.restart(index)
+	}
+}
@@ -0,0 +1,68 @@
+package platform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestReadChurn(t *testing.T) {
+	cc, err := readChurn(`hosts = 10`)
+	require.NoError(t, err)
+	require.Nil(t, cc)
+
+	cc, err = readChurn(`churnpercent = 20
+churnat = "10s, 1m"
+churndowntime = "5s"`)
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{10 * time.Second, time.Minute}, cc.at)
+	require.Equal(t, 5*time.Second, cc.downtime)
+
+	_, err = readChurn(`churnpercent = 20`)
+	require.Error(t, err)
+	_, err = readChurn(`churnpercent = 120
+churninterval = "1s"`)
+	require.Error(t, err)
+}
+
+func TestChurn(t *testing.T) {
+	local := onet.NewLocalTest(suites.MustFind("Ed25519"))
+	defer local.CloseAll()
+	servers, roster, tree := local.GenTree(5, true)
+	configs := make([]*onet.SimulationConfig, len(servers))
+	for i, s := range servers {
+		configs[i] = &onet.SimulationConfig{Roster: roster, Tree: tree, Server: s}
+	}
+
+	cc := &churnConfig{ChurnPercent: 50, ChurnSeed: 3}
+	crashed := cc.crashed(roster, tree.Root.ServerIdentity, 0)
+	require.Len(t, crashed, 2)
+	require.Equal(t, crashed, cc.crashed(roster, tree.Root.ServerIdentity, 0))
+	require.NotContains(t, crashed, 0)
+
+	network.RegisterMessage(simulChurnStop{})
+	c := newChurn(cc, configs)
+	c.event(0)
+	require.Len(t, c.down, 2)
+	for i, s := range servers {
+		_, err := s.Send(servers[(i+1)%len(servers)].ServerIdentity, &simulChurnStop{})
+		if _, down := c.down[i]; down {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+		}
+	}
+	c.stop()
+	require.Empty(t, c.down)
+	for _, i := range crashed {
+		_, err := servers[i].Send(servers[0].ServerIdentity, &simulChurnStop{})
+		require.NoError(t, err)
+	}
+	// no more events after stop
+	c.event(1)
+	require.Empty(t, c.down)
+}
@@ -93,6 +93,16 @@ type Deterlab struct {
 	PreScript string
 	// Tags to use when compiling
 	Tags string
+	// OtherSimul is the directory of the main package of the other version
+	// of a mixed-version simulation, run by the last OtherServers servers
+	OtherSimul   string
+	OtherServers int
+
+	// hostVersions are the versions of the hosts of the run
+	hostVersions []string
+	// hybrid are the conodes running on this machine, in a hybrid
+	// simulation
+	hybrid *hybridHosts
 }
 
 var simulConfig *onet.SimulationConfig
@@ -156,6 +166,14 @@ func (d *Deterlab) Build(build string, arg ...string) error {
 	if build == "" {
 		build = "simul,users"
 	}
+	if d.OtherSimul != "" {
+		other := d.OtherSimul
+		if !filepath.IsAbs(other) {
+			other = path.Join(d.simulDir, other)
+		}
+		packages = append(packages, pkg{"other", "amd64", "linux", other})
+		build += ",other"
+	}
 	var tags []string
 	if d.Tags != "" {
 		tags = append([]string{"-tags"}, strings.Split(d.Tags, " ")...)
@@ -175,7 +193,7 @@ func (d *Deterlab) Build(build string, arg ...string) error {
 			log.ErrFatal(err)
 			// deter has an amd64, linux architecture
 			var out string
-			if p.name == "simul" {
+			if p.name != "users" {
 				out, err = Build(path, dst,
 					p.processor, p.system, append(arg, tags...)...)
 			} else {
@@ -283,6 +301,14 @@ func (d *Deterlab) Deploy(rc *RunConfig) error {
 		return xerrors.Errorf("simulation setup: %v", err)
 	}
 	simulConfig.Config = string(rc.Toml())
+	if err := d.hybrid.deploy(simulConfig, ""); err != nil {
+		return xerrors.Errorf("hybrid: %v", err)
+	}
+	versions, err := readVersions(rc)
+	if err != nil {
+		return xerrors.Errorf("versions: %v", err)
+	}
+	d.hostVersions = versions.hostVersions(simulConfig.Roster, deter.Virt)
 	log.Lvl3("Saving configuration")
 	if err := simulConfig.Save(d.deployDir); err != nil {
 		log.Error("Couldn't save configuration:", err)
@@ -368,6 +394,27 @@ func (d *Deterlab) Wait() error {
 	return nil
 }
 
+// HostVersions implements the Versioner interface.
+func (d *Deterlab) HostVersions() []string {
+	return d.hostVersions
+}
+
+// setHybrid implements the hybridRemote interface.
+func (d *Deterlab) setHybrid(h *hybridHosts) {
+	d.hybrid = h
+}
+
+// SimulBinary returns the binary run by the server at the given index:
+// "other" if it runs the other version of a mixed-version simulation, else
+// "simul".
+func (d *Deterlab) SimulBinary(index int) string {
+	v := &versions{OtherSimul: d.OtherSimul, OtherServers: d.OtherServers}
+	if d.OtherSimul != "" && v.other(index, len(d.Virt)) {
+		return "other"
+	}
+	return "simul"
+}
+
 // Write the hosts.txt file automatically
 // from project name and number of servers
 func (d *Deterlab) createHosts() {
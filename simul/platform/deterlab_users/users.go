@@ -55,9 +55,9 @@ func main() {
 			defer wg.Done()
 			if kill {
 				log.Lvl3("Cleaning up host", h, ".")
-				runSSH(h, "sudo killall -9 simul scp 2>/dev/null >/dev/null")
+				runSSH(h, "sudo killall -9 simul other scp 2>/dev/null >/dev/null")
 				time.Sleep(1 * time.Second)
-				runSSH(h, "sudo killall -9 simul 2>/dev/null >/dev/null")
+				runSSH(h, "sudo killall -9 simul other 2>/dev/null >/dev/null")
 				time.Sleep(1 * time.Second)
 				// Also kill all other process that start with "./" and are probably
 				// locally started processes
@@ -122,7 +122,7 @@ func main() {
 	for i, phys := range deter.Phys {
 		log.Lvl2("Launching simul on", phys)
 		wg.Add(1)
-		go func(phys, internal string) {
+		go func(phys, internal, binary string) {
 			//log.Lvl4("running on", phys, cmd)
 			defer wg.Done()
 			monitorAddr := deter.MonitorAddress + ":" + strconv.Itoa(deter.MonitorPort)
@@ -142,7 +142,7 @@ func main() {
 				" -debug=" + strconv.Itoa(log.DebugVisible()) +
 				" -suite=" + suite
 			log.Lvl3("Args is", args)
-			err := platform.SSHRunStdout("", phys, "cd remote; sudo ./simul "+
+			err := platform.SSHRunStdout("", phys, "cd remote; sudo ./"+binary+
 				args)
 			if err != nil && !killing {
 				log.Lvl1("Error starting simul - will kill all others:", err, internal)
@@ -153,7 +153,7 @@ func main() {
 				}
 			}
 			log.Lvl4("Finished with simul on", internal)
-		}(phys, deter.Virt[i])
+		}(phys, deter.Virt[i], deter.SimulBinary(i))
 	}
 
 	// wait for the servers to finish before stopping
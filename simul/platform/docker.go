@@ -0,0 +1,431 @@
+package platform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/app"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// Docker is the platform running every server of the simulation in its own
+// container on this machine, with docker compose. The simulation binary is
+// built into a small image, the traffic of every container is shaped with
+// netem, and the monitor runs on the host.
+type Docker struct {
+	// Simulation to be run
+	Simulation string
+	// Suite used for the simulation
+	Suite string
+	// Number of containers, the conodes are spread among them. If it is 0,
+	// every conode gets its own container.
+	Servers int
+	// Debugging-level: 0 is none - 5 is everything
+	Debug int
+	// The time to wait for the simulation to finish
+	RunWait string
+	// Delay in ms added to the packets sent by every container
+	Delay int
+	// Bandwidth in Mbps of every container, 0 for no limit
+	Bandwidth int
+	// Image the simulation image is based on, a debian-based image by
+	// default. It needs apt-get to install the traffic shaping.
+	Image string
+	// Subnet of the network of the containers. The first address is the
+	// host, where the monitor runs.
+	Subnet string
+	// Compose is the command running docker compose
+	Compose string
+	// PreScript defines a script that is run before the simulation
+	PreScript string
+	// Tags to use when compiling
+	Tags string
+
+	// Directory we start - the simulation-directory of the service/protocol
+	wd string
+	// Directory for building
+	buildDir string
+	// Directory for deploying, used as docker context
+	deployDir string
+	// Port of the monitor on the host
+	monitorPort int
+	// Name of the docker compose project and of the image
+	project string
+	// Finishes when docker compose returns
+	done chan error
+	// Whether the simulation is started
+	started bool
+	// hybrid are the conodes running on the host, in a hybrid simulation
+	hybrid *hybridHosts
+}
+
+// dockerProject is the name of the docker compose project and of the image,
+// followed by the slot for a replica.
+const dockerProject = "onet-simul"
+
+// Configure implements the Platform-interface. It is called once to set up
+// the necessary internal variables.
+func (d *Docker) Configure(pc *Config) {
+	d.wd, _ = os.Getwd()
+	d.buildDir = d.wd + "/build"
+	d.deployDir = d.wd + "/deploy"
+	d.Suite = pc.Suite
+	d.Debug = pc.Debug
+	d.monitorPort = pc.MonitorPort
+	d.project = dockerProject
+	if d.Image == "" {
+		d.Image = "debian:stable-slim"
+	}
+	if d.Subnet == "" {
+		d.Subnet = "172.28.0.0/16"
+	}
+	if d.Compose == "" {
+		d.Compose = "docker compose"
+	}
+	for _, dir := range []string{d.buildDir, d.deployDir} {
+		os.RemoveAll(dir)
+		log.ErrFatal(os.Mkdir(dir, 0700))
+	}
+	if d.Simulation == "" {
+		log.Fatal("No simulation defined in runconfig")
+	}
+}
+
+// Replica implements the Replicator-interface. The replica has its own
+// compose project and image, and the subnet following the one of the
+// previous slot.
+func (d *Docker) Replica(slot int, pc *Config) (Platform, error) {
+	r := *d
+	r.Debug = pc.Debug
+	r.monitorPort = pc.MonitorPort
+	r.project = fmt.Sprintf("%s-%d", dockerProject, slot)
+	r.deployDir = fmt.Sprintf("%s/deploy-%d", d.wd, slot)
+	r.done = nil
+	r.started = false
+	var err error
+	r.Subnet, err = dockerSubnet(d.Subnet, slot)
+	if err != nil {
+		return nil, xerrors.Errorf("subnet: %v", err)
+	}
+	os.RemoveAll(r.deployDir)
+	if err := os.Mkdir(r.deployDir, 0700); err != nil {
+		return nil, xerrors.Errorf("creating directory: %v", err)
+	}
+	return &r, nil
+}
+
+// Build compiles the simulation binary for linux.
+func (d *Docker) Build(build string, arg ...string) error {
+	log.Lvl1("Building for docker", build)
+	start := time.Now()
+	var tags []string
+	if d.Tags != "" {
+		tags = append([]string{"-tags"}, strings.Split(d.Tags, " ")...)
+	}
+	out, err := Build(".", d.buildDir+"/conode", runtime.GOARCH, "linux",
+		append(arg, tags...)...)
+	if err != nil {
+		return xerrors.Errorf(err.Error() + " " + out)
+	}
+	log.Lvl1("Build is finished after", time.Since(start))
+	return nil
+}
+
+// Cleanup removes the containers and the network of an earlier run.
+func (d *Docker) Cleanup() error {
+	compose := filepath.Join(d.deployDir, "docker-compose.yml")
+	if _, err := os.Stat(compose); os.IsNotExist(err) {
+		return nil
+	}
+	out, err := d.compose("down", "--volumes", "--remove-orphans").CombinedOutput()
+	if err != nil {
+		log.Lvl2("Error while cleaning up:", err, string(out))
+	}
+	return nil
+}
+
+// Deploy writes the configuration of the run, the docker compose file and
+// the image, and builds the image.
+func (d *Docker) Deploy(rc *RunConfig) error {
+	sim, err := onet.NewSimulation(d.Simulation, string(rc.Toml()))
+	if err != nil {
+		return xerrors.Errorf("creating simulation: %v", err)
+	}
+	hosts, err := rc.GetInt("Hosts")
+	if err != nil {
+		return xerrors.Errorf("config: %v", err)
+	}
+	// the run-configuration overwrites the global one
+	dc := *d
+	if s, err := rc.GetInt("Servers"); err == nil {
+		dc.Servers = s
+	}
+	if b, err := rc.GetInt("Bandwidth"); err == nil {
+		dc.Bandwidth = b
+	}
+	if dl, err := rc.GetInt("Delay"); err == nil {
+		dc.Delay = dl
+	}
+	dc.PreScript = rc.Get("PreScript")
+	if dc.PreScript != "" {
+		if _, err := os.Stat(dc.PreScript); err == nil {
+			if err := app.Copy(d.deployDir, dc.PreScript); err != nil {
+				return xerrors.Errorf("copying: %v", err)
+			}
+		}
+	}
+
+	containers := dc.Servers
+	if containers <= 0 || containers > hosts {
+		containers = hosts
+	}
+	gateway, addresses, err := dockerAddresses(dc.Subnet, containers)
+	if err != nil {
+		return xerrors.Errorf("addresses: %v", err)
+	}
+	log.Lvl2("Docker: deploying", hosts, "conodes in", containers, "containers")
+	simulConfig, err := sim.Setup(d.deployDir, addresses)
+	if err != nil {
+		return xerrors.Errorf("simulation setup: %v", err)
+	}
+	simulConfig.Config = string(rc.Toml())
+	if err := d.hybrid.deploy(simulConfig, gateway); err != nil {
+		return xerrors.Errorf("hybrid: %v", err)
+	}
+	if err := simulConfig.Save(d.deployDir); err != nil {
+		return xerrors.Errorf("saving configuration: %v", err)
+	}
+
+	if err := app.Copy(d.deployDir, d.buildDir+"/conode"); err != nil {
+		return xerrors.Errorf("copying: %v", err)
+	}
+	if err := writeLinkScripts(rc, d.deployDir, addresses); err != nil {
+		return xerrors.Errorf("links: %v", err)
+	}
+	files := map[string]string{
+		"Dockerfile":         fmt.Sprintf(dockerfile, dc.Image),
+		"start.sh":           dockerStart,
+		"docker-compose.yml": dc.composeFile(gateway, addresses, d.monitorPort),
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(d.deployDir, name), []byte(content), 0750)
+		if err != nil {
+			return xerrors.Errorf("writing file: %v", err)
+		}
+	}
+
+	log.Lvl1("Building image", d.project)
+	out, err := exec.Command("docker", "build", "-t", d.project, d.deployDir).CombinedOutput()
+	if err != nil {
+		return xerrors.Errorf("building image: %v %s", err, out)
+	}
+	return nil
+}
+
+// Start runs the containers and returns.
+func (d *Docker) Start(args ...string) error {
+	d.done = make(chan error, 1)
+	cmd := d.compose("up")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		return xerrors.Errorf("starting containers: %v", err)
+	}
+	d.started = true
+	go func() {
+		err := cmd.Wait()
+		log.Lvl3(out.String())
+		if err != nil {
+			err = xerrors.Errorf("docker compose: %v", err)
+		}
+		d.done <- err
+	}()
+	return nil
+}
+
+// Wait waits for all the containers to stop, or for RunWait, and removes
+// them.
+func (d *Docker) Wait() error {
+	if !d.started {
+		return nil
+	}
+	d.started = false
+	wait, err := time.ParseDuration(d.RunWait)
+	if err != nil || wait == 0 {
+		wait = 600 * time.Second
+		err = nil
+	}
+	select {
+	case err = <-d.done:
+	case <-time.After(wait):
+		log.Lvl1("Quitting after waiting", wait)
+	}
+	if cerr := d.Cleanup(); cerr != nil {
+		log.Error("Couldn't remove the containers:", cerr)
+	}
+	return err
+}
+
+// setHybrid implements the hybridRemote interface.
+func (d *Docker) setHybrid(h *hybridHosts) {
+	d.hybrid = h
+}
+
+// compose returns the docker compose command with the given arguments on
+// the project of the simulation.
+func (d *Docker) compose(args ...string) *exec.Cmd {
+	cmd := strings.Fields(d.Compose)
+	cmd = append(cmd, "-f", filepath.Join(d.deployDir, "docker-compose.yml"),
+		"-p", d.project)
+	return exec.Command(cmd[0], append(cmd[1:], args...)...)
+}
+
+// dockerAddresses returns the address of the host in the subnet, and the
+// addresses of n containers following it.
+func dockerAddresses(subnet string, n int) (string, []string, error) {
+	ip, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return "", nil, xerrors.Errorf("parsing subnet: %v", err)
+	}
+	ip = ip.Mask(ipNet.Mask).To4()
+	if ip == nil {
+		return "", nil, xerrors.New("only IPv4 subnets are supported")
+	}
+	next := func() string {
+		for j := len(ip) - 1; j >= 0; j-- {
+			ip[j]++
+			if ip[j] > 0 {
+				break
+			}
+		}
+		return ip.String()
+	}
+	gateway := next()
+	addresses := make([]string, n)
+	for i := range addresses {
+		addresses[i] = next()
+		if !ipNet.Contains(net.ParseIP(addresses[i])) {
+			return "", nil, xerrors.Errorf("subnet %s is too small for %d containers",
+				subnet, n)
+		}
+	}
+	return gateway, addresses, nil
+}
+
+// dockerSubnet returns the subnet of the given slot: the n-th subnet of the
+// same size following the given one.
+func dockerSubnet(subnet string, n int) (string, error) {
+	ip, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return "", xerrors.Errorf("parsing subnet: %v", err)
+	}
+	ip = ip.Mask(ipNet.Mask).To4()
+	if ip == nil {
+		return "", xerrors.New("only IPv4 subnets are supported")
+	}
+	ones, bits := ipNet.Mask.Size()
+	start := uint64(binary.BigEndian.Uint32(ip)) + uint64(n)<<uint(bits-ones)
+	if start > math.MaxUint32 {
+		return "", xerrors.Errorf("no subnet %d after %s", n, subnet)
+	}
+	binary.BigEndian.PutUint32(ip, uint32(start))
+	return fmt.Sprintf("%s/%d", ip, ones), nil
+}
+
+// netem returns the arguments of netem shaping the traffic, or an empty
+// string if it isn't shaped.
+func (d *Docker) netem() string {
+	var args []string
+	if d.Delay > 0 {
+		args = append(args, "delay "+strconv.Itoa(d.Delay)+"ms")
+	}
+	if d.Bandwidth > 0 {
+		args = append(args, "rate "+strconv.Itoa(d.Bandwidth)+"mbit")
+	}
+	return strings.Join(args, " ")
+}
+
+// composeFile returns the docker compose file running a container for every
+// address, which connects to the monitor on the gateway.
+func (d *Docker) composeFile(gateway string, addresses []string, monitorPort int) string {
+	var buf bytes.Buffer
+	err := composeTemplate.Execute(&buf, struct {
+		*Docker
+		Project   string
+		Gateway   string
+		Addresses []string
+		Monitor   string
+		Netem     string
+	}{d, d.project, gateway, addresses,
+		net.JoinHostPort(gateway, strconv.Itoa(monitorPort)), d.netem()})
+	log.ErrFatal(err)
+	return buf.String()
+}
+
+var composeTemplate = template.Must(template.New("compose").Parse(`version: "2.4"
+networks:
+  simul:
+    ipam:
+      config:
+        - subnet: {{.Subnet}}
+          gateway: {{.Gateway}}
+services:
+{{- range $i, $a := .Addresses}}
+  conode{{$i}}:
+    image: {{$.Project}}
+    cap_add:
+      - NET_ADMIN
+    networks:
+      simul:
+        ipv4_address: {{$a}}
+    environment:
+      ADDRESS: "{{$a}}"
+      SIMULATION: "{{$.Simulation}}"
+      SUITE: "{{$.Suite}}"
+      DEBUG: "{{$.Debug}}"
+      MONITOR: "{{$.Monitor}}"
+      NETEM: "{{$.Netem}}"
+      PRESCRIPT: "{{$.PreScript}}"
+{{- end}}
+`))
+
+// dockerfile is the image of the simulation, based on the image given as
+// argument.
+const dockerfile = `FROM %s
+RUN apt-get update && apt-get install -y --no-install-recommends iproute2 \
+    && rm -rf /var/lib/apt/lists/*
+WORKDIR /simul
+COPY . /simul
+CMD ["./start.sh"]
+`
+
+// dockerStart shapes the traffic of the container and runs its conodes. The
+// links of the run replace the netem of the container.
+const dockerStart = `#!/bin/sh
+set -e
+if [ -f "links/$ADDRESS.sh" ]; then
+  "./links/$ADDRESS.sh" eth0
+elif [ -n "$NETEM" ]; then
+  tc qdisc add dev eth0 root netem $NETEM
+fi
+if [ -n "$PRESCRIPT" ]; then
+  "./$PRESCRIPT" docker
+fi
+exec ./conode -debug "$DEBUG" -address "$ADDRESS" -simul "$SIMULATION" \
+  -suite "$SUITE" -monitor "$MONITOR"
+`
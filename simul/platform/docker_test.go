@@ -0,0 +1,66 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerAddresses(t *testing.T) {
+	gw, addrs, err := dockerAddresses("172.28.0.0/16", 300)
+	require.NoError(t, err)
+	require.Equal(t, "172.28.0.1", gw)
+	require.Equal(t, "172.28.0.2", addrs[0])
+	require.Equal(t, "172.28.1.0", addrs[254])
+	require.Equal(t, "172.28.1.45", addrs[299])
+
+	_, _, err = dockerAddresses("10.0.0.0/30", 3)
+	require.Error(t, err)
+	_, _, err = dockerAddresses("fd00::/64", 1)
+	require.Error(t, err)
+}
+
+func TestDocker_composeFile(t *testing.T) {
+	d := &Docker{Simulation: "test", Suite: "Ed25519", Subnet: "10.1.0.0/16",
+		Delay: 50, Bandwidth: 100}
+	compose := d.composeFile("10.1.0.1", []string{"10.1.0.2", "10.1.0.3"}, 10000)
+	require.Contains(t, compose, "subnet: 10.1.0.0/16")
+	require.Contains(t, compose, "conode1:")
+	require.Contains(t, compose, "ipv4_address: 10.1.0.3")
+	require.Contains(t, compose, `MONITOR: "10.1.0.1:10000"`)
+	require.Contains(t, compose, `NETEM: "delay 50ms rate 100mbit"`)
+
+	d.Delay, d.Bandwidth = 0, 0
+	require.Contains(t, d.composeFile("10.1.0.1", []string{"10.1.0.2"}, 10000),
+		`NETEM: ""`)
+}
+
+func TestDockerSubnet(t *testing.T) {
+	s, err := dockerSubnet("172.28.0.0/16", 0)
+	require.NoError(t, err)
+	require.Equal(t, "172.28.0.0/16", s)
+	s, err = dockerSubnet("172.28.0.0/16", 3)
+	require.NoError(t, err)
+	require.Equal(t, "172.31.0.0/16", s)
+	s, err = dockerSubnet("10.1.0.0/24", 256)
+	require.NoError(t, err)
+	require.Equal(t, "10.2.0.0/24", s)
+
+	_, err = dockerSubnet("255.255.0.0/16", 1)
+	require.Error(t, err)
+}
+
+func TestDocker_Replica(t *testing.T) {
+	d := &Docker{Simulation: "test", Subnet: "10.1.0.0/16", project: dockerProject,
+		wd: t.TempDir(), monitorPort: 10000}
+	p, err := d.Replica(2, &Config{MonitorPort: 10002})
+	require.NoError(t, err)
+	r := p.(*Docker)
+	require.Equal(t, "10.3.0.0/16", r.Subnet)
+	require.DirExists(t, r.deployDir)
+	require.NotEqual(t, d.deployDir, r.deployDir)
+	compose := r.composeFile("10.3.0.1", []string{"10.3.0.2"}, r.monitorPort)
+	require.Contains(t, compose, "image: onet-simul-2")
+	require.Contains(t, compose, `MONITOR: "10.3.0.1:10002"`)
+	require.Equal(t, "10.1.0.0/16", d.Subnet)
+}
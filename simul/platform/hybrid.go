@@ -0,0 +1,293 @@
+package platform
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/onet/v3/simul/monitor"
+	"golang.org/x/xerrors"
+)
+
+// Hybrid is the platform running the conodes of a simulation on a remote
+// platform, except for some of them running in this process. Running the
+// simulation under a debugger, e.g. with "dlv debug . -- -platform hybrid
+// sim.toml", allows to debug these conodes interactively while the others
+// take part in the run as usual. The monitor on this machine gets the
+// measures of all the conodes.
+//
+// The remote conodes and this machine must reach each other: with docker,
+// this machine is the host of the network of the containers, while the
+// machines of terraform and deterlab need a VPN to the network of their
+// private addresses.
+type Hybrid struct {
+	// Remote is the platform running the other conodes: docker, terraform
+	// or deterlab. Its options are read from the run-file, like the ones of
+	// the hybrid platform.
+	Remote string
+	// LocalHosts is the comma-separated list of the indexes, in the
+	// roster, of the conodes running in this process.
+	LocalHosts string
+	// LocalAddress is the address of this machine for the remote conodes.
+	// With docker, it defaults to the host address in the network of the
+	// containers.
+	LocalAddress string
+	// The simulation to run
+	Simulation string
+	// The time to wait for the simulation to finish
+	RunWait string
+
+	// Suite used for the simulation
+	suite string
+	// Listening monitor port
+	monitorPort int
+	// Directory we start - the simulation-directory of the service/protocol
+	wd string
+	// Directory of the configuration of the local conodes
+	runDir string
+	// options are the global options of the run-file, decoded in the
+	// remote platform when it is created
+	options []string
+	// remote is the platform running the other conodes
+	remote hybridRemote
+	// hosts are the conodes running in this process
+	hosts *hybridHosts
+	// Waits for the local conodes
+	wgRun sync.WaitGroup
+	// errors of the local conodes go here
+	errChan chan error
+	// Whether the local conodes are started
+	started bool
+}
+
+// hybridRemote is implemented by the platforms that can be the remote
+// platform of a hybrid simulation. They move the conodes given to
+// setHybrid to this machine when deploying.
+type hybridRemote interface {
+	Platform
+	setHybrid(h *hybridHosts)
+}
+
+// hybridHosts are the conodes of a simulation running on this machine.
+type hybridHosts struct {
+	// indexes of the conodes in the roster
+	indexes []int
+	// address of this machine, if it isn't the default of the remote
+	// platform
+	address string
+	// directory where the configuration of the local conodes is saved
+	dir string
+}
+
+// decodeOption decodes the global option of a run-file in the platform. A
+// hybrid platform keeps it for its remote platform.
+func decodeOption(p Platform, option string) error {
+	if h, ok := p.(*Hybrid); ok {
+		h.options = append(h.options, option)
+	}
+	_, err := toml.Decode(option, p)
+	return err
+}
+
+// Configure creates and configures the remote platform, with the options of
+// the run-file.
+func (h *Hybrid) Configure(pc *Config) {
+	h.wd, _ = os.Getwd()
+	h.runDir = h.wd + "/hybrid"
+	h.suite = pc.Suite
+	h.monitorPort = pc.MonitorPort
+	if h.Simulation == "" {
+		log.Fatal("No simulation defined in runconfig")
+	}
+	switch h.Remote {
+	case docker:
+		h.remote = &Docker{}
+	case terraform:
+		h.remote = &Terraform{}
+	case deterlab:
+		h.remote = &Deterlab{}
+	default:
+		log.Fatal("Remote must be docker, terraform or deterlab, not", h.Remote)
+	}
+	for _, o := range h.options {
+		if _, err := toml.Decode(o, h.remote); err != nil {
+			log.Error("Error decoding", o)
+		}
+	}
+	h.hosts = &hybridHosts{address: h.LocalAddress, dir: h.runDir}
+	h.remote.setHybrid(h.hosts)
+	h.remote.Configure(pc)
+}
+
+// Build builds the binaries of the remote platform, as this process runs
+// the local conodes.
+func (h *Hybrid) Build(build string, arg ...string) error {
+	return h.remote.Build(build, arg...)
+}
+
+// Cleanup stops the remote conodes still running.
+func (h *Hybrid) Cleanup() error {
+	return h.remote.Cleanup()
+}
+
+// Deploy deploys the run on the remote platform, which also writes the
+// configuration of the local conodes.
+func (h *Hybrid) Deploy(rc *RunConfig) error {
+	local := rc.Get("LocalHosts")
+	if local == "" {
+		return xerrors.New("LocalHosts must be set")
+	}
+	hosts, err := rc.GetInt("Hosts")
+	if err != nil {
+		return xerrors.Errorf("config: %v", err)
+	}
+	h.hosts.indexes = nil
+	for _, s := range strings.Split(local, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return xerrors.Errorf("LocalHosts: %v", err)
+		}
+		if i < 0 || i >= hosts {
+			return xerrors.Errorf("LocalHosts: no host %d in %d hosts", i, hosts)
+		}
+		h.hosts.indexes = append(h.hosts.indexes, i)
+	}
+	os.RemoveAll(h.runDir)
+	if err := os.Mkdir(h.runDir, 0770); err != nil {
+		return xerrors.Errorf("creating directory: %v", err)
+	}
+	if err := h.remote.Deploy(rc); err != nil {
+		return xerrors.Errorf("remote: %v", err)
+	}
+	return nil
+}
+
+// Start starts the remote conodes, and then the local ones in this process.
+func (h *Hybrid) Start(args ...string) error {
+	if err := h.remote.Start(args...); err != nil {
+		return xerrors.Errorf("remote: %v", err)
+	}
+	// the local conodes read their configuration in the current directory
+	if err := os.Chdir(h.runDir); err != nil {
+		return xerrors.Errorf("chdir: %v", err)
+	}
+	h.started = true
+	err := monitor.ConnectSink("localhost:" + strconv.Itoa(h.monitorPort))
+	if err != nil {
+		return xerrors.Errorf("monitor: %v", err)
+	}
+	monitor.Report("localhost")
+	h.errChan = make(chan error, 1)
+	h.wgRun.Add(1)
+	go func() {
+		defer h.wgRun.Done()
+		log.Lvl1("Starting the local conodes at", h.hosts.address)
+		err := simulate(h.suite, h.hosts.address, h.Simulation, "", nil)
+		if err != nil {
+			log.Error("Error running the local conodes:", err)
+			h.errChan <- err
+		}
+	}()
+	return nil
+}
+
+// Wait waits for the local and the remote conodes to finish.
+func (h *Hybrid) Wait() error {
+	if !h.started {
+		return h.remote.Wait()
+	}
+	h.started = false
+	wait, err := time.ParseDuration(h.RunWait)
+	if err != nil || wait == 0 {
+		wait = 600 * time.Second
+	}
+	remote := make(chan error, 1)
+	go func() {
+		remote <- h.remote.Wait()
+	}()
+	local := make(chan struct{})
+	go func() {
+		h.wgRun.Wait()
+		close(local)
+	}()
+	select {
+	case <-local:
+	case <-time.After(wait):
+		log.Lvl1("Quitting after waiting", wait)
+	}
+	err = <-remote
+	select {
+	case e := <-h.errChan:
+		err = xerrors.Errorf("local conodes: %v", e)
+	default:
+	}
+	if e := os.Chdir(h.wd); e != nil {
+		log.Error("Fail to restore the cwd:", e)
+	}
+	monitor.EndAndCleanup()
+	return err
+}
+
+// Teardown destroys the machines of the remote platform, if it created
+// them.
+func (h *Hybrid) Teardown() error {
+	if p, ok := h.remote.(Provisioner); ok {
+		return p.Teardown()
+	}
+	return nil
+}
+
+// deploy moves the conodes to this machine, at the address or the given
+// default one, and saves the configuration for them. It does nothing if h
+// is nil, when the simulation isn't hybrid.
+func (h *hybridHosts) deploy(sc *onet.SimulationConfig, defaultAddress string) error {
+	if h == nil {
+		return nil
+	}
+	address := h.address
+	if address == "" {
+		address = defaultAddress
+	}
+	if address == "" {
+		return xerrors.New("LocalAddress must be set")
+	}
+	h.address = address
+	// the conodes of different machines can have the same port
+	ports := make(map[int]bool)
+	for _, i := range h.indexes {
+		if i >= len(sc.Roster.List) {
+			return xerrors.Errorf("no host %d in the roster", i)
+		}
+		si := sc.Roster.List[i]
+		_, p, err := net.SplitHostPort(si.Address.NetworkAddress())
+		if err != nil {
+			return xerrors.Errorf("address of host %d: %v", i, err)
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return xerrors.Errorf("port of host %d: %v", i, err)
+		}
+		// the websocket of a conode listens on the following port
+		for ports[port] {
+			port += 2
+		}
+		ports[port] = true
+		moved := network.NewAddress(si.Address.ConnType(),
+			net.JoinHostPort(address, strconv.Itoa(port)))
+		sc.PrivateKeys[moved] = sc.PrivateKeys[si.Address]
+		delete(sc.PrivateKeys, si.Address)
+		log.Lvl2("Moving host", i, "from", si.Address, "to", moved)
+		si.Address = moved
+	}
+	if err := sc.Save(h.dir); err != nil {
+		return xerrors.Errorf("saving configuration: %v", err)
+	}
+	return nil
+}
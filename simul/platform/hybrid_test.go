@@ -0,0 +1,56 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestHybrid_Configure(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(wd)
+	require.NoError(t, os.Chdir(t.TempDir()))
+
+	h := NewPlatform(hybrid).(*Hybrid)
+	for _, o := range []string{`Simulation = "test"`, `Remote = "docker"`,
+		`LocalHosts = "0"`, `Subnet = "10.2.0.0/16"`} {
+		require.NoError(t, decodeOption(h, o))
+	}
+	h.Configure(&Config{Suite: "Ed25519", MonitorPort: 10000})
+	d := h.remote.(*Docker)
+	require.Equal(t, "test", d.Simulation)
+	require.Equal(t, "10.2.0.0/16", d.Subnet)
+	require.Equal(t, h.hosts, d.hybrid)
+
+	require.Error(t, h.Deploy(&RunConfig{fields: map[string]string{"hosts": "2"}}))
+	rc := &RunConfig{fields: map[string]string{"hosts": "2", "localhosts": "2"}}
+	require.Error(t, h.Deploy(rc))
+}
+
+func TestHybridHosts_deploy(t *testing.T) {
+	sc := &onet.SimulationConfig{}
+	sim := &onet.SimulationBFTree{Hosts: 4, BF: 2, Suite: "Ed25519"}
+	sim.CreateRoster(sc, []string{"10.0.0.1", "10.0.0.2"}, 2000)
+	require.NoError(t, sim.CreateTree(sc))
+	var h *hybridHosts
+	require.NoError(t, h.deploy(sc, ""))
+
+	h = &hybridHosts{indexes: []int{0, 1, 3}, dir: t.TempDir()}
+	require.Error(t, h.deploy(sc, ""))
+	require.NoError(t, h.deploy(sc, "10.1.0.1"))
+	list := sc.Roster.List
+	require.Equal(t, network.NewTCPAddress("10.1.0.1:2000"), list[0].Address)
+	require.Equal(t, network.NewTCPAddress("10.1.0.1:2002"), list[1].Address)
+	require.Equal(t, network.NewTCPAddress("10.0.0.1:2002"), list[2].Address)
+	require.Equal(t, network.NewTCPAddress("10.1.0.1:2004"), list[3].Address)
+	require.Equal(t, 4, len(sc.PrivateKeys))
+	for _, si := range list {
+		require.NotNil(t, sc.PrivateKeys[si.Address])
+	}
+	require.FileExists(t, filepath.Join(h.dir, onet.SimulationFileName))
+}
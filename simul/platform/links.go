@@ -0,0 +1,193 @@
+package platform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// Links holds the emulated links between the addresses of a simulation, read
+// from the toml-file given in the 'Links' variable of the run-configuration:
+//
+//	Delay = [[0, 50, 150], [50, 0, 100], [150, 100, 0]]
+//	Bandwidth = [[0, 100, 10], [100, 0, 10], [10, 10, 0]]
+//	Loss = [[0, 0, 1], [0, 0, 1], [1, 1, 0]]
+//
+// The entry [i][j] of a matrix applies to the traffic sent from the i-th
+// address to the j-th address. The matrices are repeated over the
+// addresses, so the example gives the addresses in turn to three regions.
+// A missing matrix doesn't restrict the links.
+type Links struct {
+	// Delay in ms
+	Delay [][]float64
+	// Bandwidth in Mbps, 0 for no limit
+	Bandwidth [][]float64
+	// Loss in percent
+	Loss [][]float64
+}
+
+// ReadLinks returns the links of the given file. The values of a row must
+// either all be integers or all have decimals.
+func ReadLinks(file string) (*Links, error) {
+	var raw map[string]interface{}
+	if _, err := toml.DecodeFile(file, &raw); err != nil {
+		return nil, xerrors.Errorf("decoding links: %v", err)
+	}
+	l := &Links{}
+	for name, m := range map[string]*[][]float64{"Delay": &l.Delay,
+		"Bandwidth": &l.Bandwidth, "Loss": &l.Loss} {
+		if raw[name] == nil {
+			continue
+		}
+		var err error
+		*m, err = linksMatrix(raw[name])
+		if err != nil {
+			return nil, xerrors.Errorf("%s matrix: %v", name, err)
+		}
+	}
+	return l, nil
+}
+
+// linksMatrix returns the square matrix of non-negative numbers decoded by
+// toml.
+func linksMatrix(raw interface{}) ([][]float64, error) {
+	rows, ok := raw.([]interface{})
+	if !ok {
+		return nil, xerrors.New("not a matrix")
+	}
+	m := make([][]float64, len(rows))
+	for i, r := range rows {
+		row, ok := r.([]interface{})
+		if !ok || len(row) != len(rows) {
+			return nil, xerrors.New("not a square matrix")
+		}
+		m[i] = make([]float64, len(row))
+		for j, v := range row {
+			switch v := v.(type) {
+			case int64:
+				m[i][j] = float64(v)
+			case float64:
+				m[i][j] = v
+			default:
+				return nil, xerrors.Errorf("%v is not a number", v)
+			}
+			if m[i][j] < 0 {
+				return nil, xerrors.Errorf("negative value %v", v)
+			}
+		}
+	}
+	return m, nil
+}
+
+// readRunLinks returns the links of the run-configuration, or nil if there
+// are none.
+func readRunLinks(rc *RunConfig) (*Links, error) {
+	file := rc.Get("Links")
+	if file == "" {
+		return nil, nil
+	}
+	return ReadLinks(file)
+}
+
+// Link returns the link from the address at index from to the address at
+// index to.
+func (l *Links) Link(from, to int) network.Link {
+	get := func(m [][]float64) float64 {
+		if len(m) == 0 {
+			return 0
+		}
+		return m[from%len(m)][to%len(m)]
+	}
+	return network.Link{
+		Delay:     time.Duration(get(l.Delay) * float64(time.Millisecond)),
+		Bandwidth: get(l.Bandwidth),
+		Loss:      get(l.Loss),
+	}
+}
+
+// Emulator returns the emulator of the links between the conodes of the
+// given addresses, for the platforms running all of them in one process.
+func (l *Links) Emulator(addresses []string) network.LinkEmulator {
+	index := make(map[string]int)
+	for i, a := range addresses {
+		index[a] = i
+	}
+	return func(from, to *network.ServerIdentity) (network.Link, bool) {
+		i, okFrom := index[from.Address.Host()]
+		j, okTo := index[to.Address.Host()]
+		if !okFrom || !okTo {
+			return network.Link{}, false
+		}
+		return l.Link(i, j), true
+	}
+}
+
+// tcScript returns the shell-script shaping the traffic sent by the address
+// at index from with tc, with a htb class and a netem qdisc for every other
+// address. It takes the interface as argument.
+func (l *Links) tcScript(addresses []string, from int) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "#!/bin/sh\n# Links of %s\nset -e\ndev=$1\n", addresses[from])
+	s.WriteString("tc qdisc del dev $dev root 2>/dev/null || true\n")
+	s.WriteString("tc qdisc add dev $dev root handle 1: htb default 1\n")
+	s.WriteString("tc class add dev $dev parent 1: classid 1:1 htb rate 10gbit\n")
+	for to, a := range addresses {
+		link := l.Link(from, to)
+		if to == from || link == (network.Link{}) {
+			continue
+		}
+		class := fmt.Sprintf("1:%x", to+2)
+		rate := "10gbit"
+		if link.Bandwidth > 0 {
+			rate = fmt.Sprintf("%gmbit", link.Bandwidth)
+		}
+		fmt.Fprintf(&s, "tc class add dev $dev parent 1: classid %s htb rate %s\n",
+			class, rate)
+		var netem []string
+		if link.Delay > 0 {
+			netem = append(netem, fmt.Sprintf("delay %dms", link.Delay.Milliseconds()))
+		}
+		if link.Loss > 0 {
+			netem = append(netem, fmt.Sprintf("loss %g%%", link.Loss))
+		}
+		if len(netem) > 0 {
+			fmt.Fprintf(&s, "tc qdisc add dev $dev parent %s netem %s\n",
+				class, strings.Join(netem, " "))
+		}
+		fmt.Fprintf(&s, "tc filter add dev $dev parent 1: protocol ip prio 1 "+
+			"u32 match ip dst %s/32 flowid %s\n", a, class)
+	}
+	return s.String()
+}
+
+// writeLinkScripts writes the tc-script of every address in the 'links'
+// sub-directory of dir, as links/<address>.sh, if the run-configuration has
+// links. The scripts of an earlier run are removed.
+func writeLinkScripts(rc *RunConfig, dir string, addresses []string) error {
+	dir = filepath.Join(dir, "links")
+	if err := os.RemoveAll(dir); err != nil {
+		return xerrors.Errorf("removing scripts: %v", err)
+	}
+	links, err := readRunLinks(rc)
+	if err != nil || links == nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0750); err != nil {
+		return xerrors.Errorf("creating directory: %v", err)
+	}
+	for i, a := range addresses {
+		err := ioutil.WriteFile(filepath.Join(dir, a+".sh"),
+			[]byte(links.tcScript(addresses, i)), 0750)
+		if err != nil {
+			return xerrors.Errorf("writing script: %v", err)
+		}
+	}
+	return nil
+}
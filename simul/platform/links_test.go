@@ -0,0 +1,71 @@
+package platform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestLinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "links")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	file := filepath.Join(tmp, "links.toml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`
+Delay = [[0, 50], [50.0, 0.5]]
+Loss = [[0.0, 1.5], [1.5, 0.0]]
+`), 0600))
+	links, err := ReadLinks(file)
+	require.NoError(t, err)
+	require.Equal(t, network.Link{Delay: 50 * time.Millisecond, Loss: 1.5}, links.Link(0, 1))
+	require.Equal(t, network.Link{Delay: 500 * time.Microsecond}, links.Link(1, 3))
+	// the matrices are repeated over the addresses
+	require.Equal(t, links.Link(0, 1), links.Link(2, 5))
+
+	emulator := links.Emulator([]string{"127.0.0.1", "127.0.0.2"})
+	si := func(a string) *network.ServerIdentity {
+		return network.NewServerIdentity(nil, network.NewAddress(network.PlainTCP, a))
+	}
+	link, ok := emulator(si("127.0.0.1:2000"), si("127.0.0.2:2002"))
+	require.True(t, ok)
+	require.Equal(t, 50*time.Millisecond, link.Delay)
+	_, ok = emulator(si("127.0.0.1:2000"), si("127.0.0.3:2002"))
+	require.False(t, ok)
+
+	script := links.tcScript([]string{"10.0.0.2", "10.0.0.3", "10.0.0.4"}, 0)
+	require.Contains(t, script, "classid 1:3 htb rate 10gbit")
+	require.Contains(t, script, "parent 1:3 netem delay 50ms loss 1.5%")
+	require.Contains(t, script, "match ip dst 10.0.0.3/32 flowid 1:3")
+	// the link to the third address is the one to the first: no shaping
+	require.NotContains(t, script, "10.0.0.4")
+
+	require.NoError(t, ioutil.WriteFile(file, []byte(`Bandwidth = [[0, 1], [1]]`), 0600))
+	_, err = ReadLinks(file)
+	require.Error(t, err)
+}
+
+func TestWriteLinkScripts(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "links")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	file := filepath.Join(tmp, "links.toml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`Bandwidth = [[0, 10], [10, 0]]`), 0600))
+
+	rc := NewRunConfig()
+	rc.Put("Links", file)
+	addresses := []string{"10.0.0.2", "10.0.0.3"}
+	require.NoError(t, writeLinkScripts(rc, tmp, addresses))
+	script, err := ioutil.ReadFile(filepath.Join(tmp, "links", "10.0.0.3.sh"))
+	require.NoError(t, err)
+	require.Contains(t, string(script), "classid 1:2 htb rate 10mbit")
+
+	// a run without links removes the scripts
+	require.NoError(t, writeLinkScripts(NewRunConfig(), tmp, addresses))
+	_, err = os.Stat(filepath.Join(tmp, "links"))
+	require.True(t, os.IsNotExist(err))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"sync"
@@ -15,6 +16,7 @@ import (
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/app"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
 	"go.dedis.ch/onet/v3/simul/monitor"
 	"golang.org/x/xerrors"
 )
@@ -73,6 +75,19 @@ type Localhost struct {
 
 	// RunWait for long simulations
 	RunWait string
+
+	// links emulates the links between the servers, if set
+	links network.LinkEmulator
+
+	// OtherSimul is the directory of the main package of the other version
+	// of a mixed-version simulation
+	OtherSimul string
+	// versions of the servers of the run, nil if they all run this binary
+	versions *versions
+	// hostVersions are the versions of the hosts of the run
+	hostVersions []string
+	// others are the processes of the other version
+	others []*exec.Cmd
 }
 
 // Configure various internal variables
@@ -95,17 +110,49 @@ func (d *Localhost) Configure(pc *Config) {
 	log.Lvl3("Localhost configured ...")
 }
 
-// Build does nothing, as we're using our own binary, no need to build
+// Build only builds the binary of the other version of a mixed-version
+// simulation, as we're using our own binary for the simulation.
 func (d *Localhost) Build(build string, arg ...string) error {
+	if d.OtherSimul == "" {
+		return nil
+	}
+	dir := d.OtherSimul
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(d.localDir, dir)
+	}
+	log.Lvl1("Building the other version in", dir)
+	out, err := Build(dir, filepath.Join(d.runDir, "other"), runtime.GOARCH,
+		runtime.GOOS, arg...)
+	if err != nil {
+		log.Error(out)
+		return xerrors.Errorf("building other version: %v", err)
+	}
 	return nil
 }
 
-// Cleanup kills all running cothority-binaryes
+// Cleanup kills the processes of the other version still running
 func (d *Localhost) Cleanup() error {
-	log.Lvl1("Nothing to clean up")
+	if len(d.others) == 0 {
+		log.Lvl1("Nothing to clean up")
+		return nil
+	}
+	for _, cmd := range d.others {
+		// the processes that ended return an error
+		if err := cmd.Process.Kill(); err != nil {
+			log.Lvl3("Couldn't kill other version:", err)
+		}
+	}
+	d.others = nil
 	return nil
 }
 
+// HostVersions implements the Versioner interface.
+func (d *Localhost) HostVersions() []string {
+	d.Lock()
+	defer d.Unlock()
+	return d.hostVersions
+}
+
 // Deploy copies all files to the run-directory
 func (d *Localhost) Deploy(rc *RunConfig) error {
 	d.Lock()
@@ -160,6 +207,25 @@ func (d *Localhost) Deploy(rc *RunConfig) error {
 	if err := d.sc.Save(d.runDir); err != nil {
 		return xerrors.Errorf("saving folder: %v", err)
 	}
+	d.links = nil
+	links, err := readRunLinks(rc)
+	if err != nil {
+		return xerrors.Errorf("links: %v", err)
+	}
+	if links != nil {
+		d.links = links.Emulator(d.addresses)
+	}
+	d.versions, err = readVersions(rc)
+	if err != nil {
+		return xerrors.Errorf("versions: %v", err)
+	}
+	if d.versions != nil && d.OtherSimul == "" {
+		return xerrors.New("OtherSimul must be set before the runs")
+	}
+	d.hostVersions = d.versions.hostVersions(d.sc.Roster, d.addresses)
+	if d.links != nil && d.versions != nil {
+		log.Warn("The links of the servers of the other version are not emulated")
+	}
 	log.Lvl2("Localhost: Done deploying")
 	d.wgRun.Add(d.servers)
 	// add one to the channel length to indicate it's done
@@ -195,13 +261,20 @@ func (d *Localhost) Start(args ...string) error {
 	if err != nil {
 		return xerrors.Errorf("monitor: %v", err)
 	}
+	monitor.Report("localhost")
 
 	for index := 0; index < d.servers; index++ {
 		log.Lvl3("Starting", index)
 		host := "127.0.0." + strconv.Itoa(index+1)
+		if d.versions.other(index, d.servers) {
+			if err := d.startOther(index, host); err != nil {
+				return xerrors.Errorf("other version: %v", err)
+			}
+			continue
+		}
 		go func(i int, h string) {
 			log.Lvl3("Localhost: will start host", i, h)
-			err := Simulate(d.Suite, host, d.Simulation, "")
+			err := simulate(d.Suite, host, d.Simulation, "", d.links)
 			if err != nil {
 				log.Error("Error running localhost", h, ":", err)
 				d.errChan <- err
@@ -213,6 +286,31 @@ func (d *Localhost) Start(args ...string) error {
 	return nil
 }
 
+// startOther runs the binary of the other version for the server at the
+// given address, in its own process.
+func (d *Localhost) startOther(index int, host string) error {
+	cmd := exec.Command("./other", "-address="+host, "-simul="+d.Simulation,
+		"-monitor=localhost:"+strconv.Itoa(d.monitorPort),
+		"-debug="+strconv.Itoa(d.debug), "-suite="+d.Suite)
+	cmd.Dir = d.runDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	log.Lvl3("Localhost: will start other version on host", index, host)
+	if err := cmd.Start(); err != nil {
+		return xerrors.Errorf("starting: %v", err)
+	}
+	d.others = append(d.others, cmd)
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Error("Error running other version", host, ":", err)
+			d.errChan <- err
+		}
+		d.wgRun.Done()
+		log.Lvl3("other version (index", index, ")", host, "done")
+	}()
+	return nil
+}
+
 // Wait for all processes to finish
 func (d *Localhost) Wait() error {
 	d.Lock()
@@ -234,6 +234,9 @@ func (m *MiniNet) Deploy(rc *RunConfig) error {
 	if err != nil {
 		return xerrors.Errorf("simulation setup: %v", err)
 	}
+	if err := writeLinkScripts(rc, m.deployDir, hosts); err != nil {
+		return xerrors.Errorf("links: %v", err)
+	}
 	simulConfig.Config = string(rc.Toml())
 	m.config = simulConfig.Config
 	log.Lvl3("Saving configuration")
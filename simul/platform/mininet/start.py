@@ -145,6 +145,11 @@ class Conode(Host):
         # to go on. ".0.1" is the BaseRouter.
         if self.IP().endswith(".0.2"):
             ldone = "; date > " + logdone
+        # The links of the run replace the ones of the topology.
+        links = "links/%s.sh" % self.IP()
+        if os.path.isfile(links):
+            dbg( 3, "Setting up the links of", self.IP() )
+            self.cmd('./%s %s' % (links, self.defaultIntf()))
         dbg( 3, "Starting conode on node", self.IP(), args, ldone, socat )
         self.cmd('( %s ./conode %s 2>&1 %s ) | %s &' %
                      (debugStr, args, ldone, socat ))
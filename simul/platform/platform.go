@@ -19,7 +19,6 @@ import (
 
 	"io/ioutil"
 
-	"github.com/BurntSushi/toml"
 	"go.dedis.ch/onet/v3/app"
 	"go.dedis.ch/onet/v3/log"
 	"golang.org/x/xerrors"
@@ -44,6 +43,8 @@ import (
 //     * start all clients
 // 6. Wait
 //     * wait for the applications to finish
+// 7. Teardown, once all runs are done, for a Provisioner
+//     * destroy the machines
 
 // Platform interface that has to be implemented to add another simulation-
 // platform.
@@ -64,6 +65,22 @@ type Platform interface {
 	Wait() error
 }
 
+// Provisioner is implemented by the platforms creating the machines of the
+// simulation. Teardown is called once all the runs of a simulation are done,
+// to destroy them.
+type Provisioner interface {
+	Teardown() error
+}
+
+// Replicator is implemented by the platforms able to run several runs of a
+// simulation at once. Replica returns the platform of the given slot,
+// configured like this one but with its own directories, network and
+// machines, and the monitor port of the configuration. It uses the binaries
+// built by this platform.
+type Replicator interface {
+	Replica(slot int, pc *Config) (Platform, error)
+}
+
 // Config is passed to Platform.Config and prepares the platform for
 // specific system-wide configurations
 type Config struct {
@@ -77,9 +94,12 @@ type Config struct {
 var deterlab = "deterlab"
 var localhost = "localhost"
 var mininet = "mininet"
+var docker = "docker"
+var terraform = "terraform"
+var hybrid = "hybrid"
 
 // NewPlatform returns the appropriate platform
-// [deterlab,localhost]
+// [deterlab,localhost,mininet,docker,terraform,hybrid]
 func NewPlatform(t string) Platform {
 	var p Platform
 	switch t {
@@ -87,6 +107,12 @@ func NewPlatform(t string) Platform {
 		p = &Deterlab{}
 	case localhost:
 		p = &Localhost{}
+	case docker:
+		p = &Docker{}
+	case terraform:
+		p = &Terraform{}
+	case hybrid:
+		p = &Hybrid{}
 	case mininet:
 		p = &MiniNet{}
 		_, err := os.Stat("server_list")
@@ -132,7 +158,17 @@ func NewPlatform(t string) Platform {
 // n1..nn are configuration-options for one run
 // Both the global and the run-configuration are copied to both
 // the platform and the app-configuration.
+//
+// A file with the .yaml or .yml extension is read as a yaml run-file
+// instead, see readYAMLRunFile.
 func ReadRunFile(p Platform, filename string) []*RunConfig {
+	if isYAMLRunFile(filename) {
+		runconfigs, err := readYAMLRunFile(p, filename)
+		if err != nil {
+			log.Fatal("Couldn't read run-file:", err)
+		}
+		return runconfigs
+	}
 	var runconfigs []*RunConfig
 	masterConfig := NewRunConfig()
 	log.Lvl3("Reading file", filename)
@@ -171,7 +207,7 @@ func ReadRunFile(p Platform, filename string) []*RunConfig {
 		// fill in the general config
 		masterConfig.Put(strings.TrimSpace(vals[0]), strings.TrimSpace(vals[1]))
 		// also put it in platform
-		if _, err := toml.Decode(text, p); err != nil {
+		if err := decodeOption(p, text); err != nil {
 			log.Error("Error decoding", text)
 		}
 		log.Lvlf5("Platform is now %+v", p)
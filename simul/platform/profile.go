@@ -0,0 +1,139 @@
+package platform
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/simul/monitor"
+	"golang.org/x/xerrors"
+)
+
+// profileConfig holds the profiles captured by the conodes during a
+// simulation, read from the run-configuration.
+type profileConfig struct {
+	// Profiles is the comma-separated list of the profiles to capture: cpu,
+	// heap and block.
+	Profiles string
+	// ProfileRounds is the comma-separated list of the rounds to profile,
+	// counted from 0.
+	ProfileRounds string
+}
+
+// profiles are the profiles a simulation captures.
+type profiles struct {
+	kinds  []string
+	rounds map[int]bool
+}
+
+var profileKinds = map[string]bool{"cpu": true, "heap": true, "block": true}
+
+// readProfiles returns the profiles of the simulation configuration, or nil
+// if there are none.
+func readProfiles(config string) (*profiles, error) {
+	pc := &profileConfig{}
+	if _, err := toml.Decode(config, pc); err != nil {
+		return nil, xerrors.Errorf("decoding profiles: %v", err)
+	}
+	if pc.Profiles == "" {
+		return nil, nil
+	}
+	p := &profiles{rounds: make(map[int]bool)}
+	for _, kind := range strings.Split(pc.Profiles, ",") {
+		kind = strings.TrimSpace(kind)
+		if !profileKinds[kind] {
+			return nil, xerrors.Errorf("unknown profile %s", kind)
+		}
+		p.kinds = append(p.kinds, kind)
+	}
+	if pc.ProfileRounds == "" {
+		return nil, xerrors.New("ProfileRounds must be set with Profiles")
+	}
+	for _, r := range strings.Split(pc.ProfileRounds, ",") {
+		round, err := strconv.Atoi(strings.TrimSpace(r))
+		if err != nil {
+			return nil, xerrors.Errorf("ProfileRounds: %v", err)
+		}
+		p.rounds[round] = true
+	}
+	return p, nil
+}
+
+// profiled returns true if the round is profiled.
+func (p *profiles) profiled(round int) bool {
+	return p != nil && p.rounds[round]
+}
+
+// profiling is the profile captured by this process. The servers of the
+// process share it, as the profiles cover the whole process.
+var profiling struct {
+	running bool
+	round   int
+	cpu     bytes.Buffer
+	sync.Mutex
+}
+
+// start starts profiling the round, unless a profile is running.
+func (p *profiles) start(round int) error {
+	profiling.Lock()
+	defer profiling.Unlock()
+	if profiling.running {
+		return nil
+	}
+	for _, kind := range p.kinds {
+		switch kind {
+		case "cpu":
+			profiling.cpu.Reset()
+			if err := pprof.StartCPUProfile(&profiling.cpu); err != nil {
+				return xerrors.Errorf("starting cpu profile: %v", err)
+			}
+		case "block":
+			runtime.SetBlockProfileRate(1)
+		}
+	}
+	profiling.running = true
+	profiling.round = round
+	log.Lvl2("Profiling round", round)
+	return nil
+}
+
+// stop stops profiling the round, if it is running, and sends the profiles
+// to the monitor, named after the source and the round.
+func (p *profiles) stop(round int, source string) error {
+	profiling.Lock()
+	defer profiling.Unlock()
+	if !profiling.running || profiling.round != round {
+		return nil
+	}
+	profiling.running = false
+	for _, kind := range p.kinds {
+		var buf bytes.Buffer
+		switch kind {
+		case "cpu":
+			pprof.StopCPUProfile()
+			buf.Write(profiling.cpu.Bytes())
+		case "heap":
+			runtime.GC()
+			if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+				return xerrors.Errorf("heap profile: %v", err)
+			}
+		case "block":
+			err := pprof.Lookup("block").WriteTo(&buf, 0)
+			runtime.SetBlockProfileRate(0)
+			if err != nil {
+				return xerrors.Errorf("block profile: %v", err)
+			}
+		}
+		name := fmt.Sprintf("%s_round%d_%s.pprof", source, round, kind)
+		if err := monitor.SendProfile(name, buf.Bytes()); err != nil {
+			return xerrors.Errorf("sending profile: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadProfiles(t *testing.T) {
+	p, err := readProfiles("")
+	require.NoError(t, err)
+	require.Nil(t, p)
+	require.False(t, p.profiled(0))
+
+	p, err = readProfiles("Profiles = \"cpu, heap\"\nProfileRounds = \"0,2\"\n")
+	require.NoError(t, err)
+	require.Equal(t, []string{"cpu", "heap"}, p.kinds)
+	require.True(t, p.profiled(0))
+	require.False(t, p.profiled(1))
+	require.True(t, p.profiled(2))
+
+	_, err = readProfiles("Profiles = \"cpu,mutex\"\nProfileRounds = \"0\"\n")
+	require.Error(t, err)
+	_, err = readProfiles("Profiles = \"cpu\"\n")
+	require.Error(t, err)
+	_, err = readProfiles("Profiles = \"cpu\"\nProfileRounds = \"first\"\n")
+	require.Error(t, err)
+}
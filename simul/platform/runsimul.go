@@ -15,9 +15,28 @@ import (
 
 type simulInit struct{}
 type simulInitDone struct{}
+type simulChurnStart struct{}
+type simulChurnStop struct{}
+type simulChurnStopDone struct{}
+type simulResources struct{}
+type simulTick struct{}
+type simulProfile struct {
+	Round int
+	// Stop stops the profile of the round instead of starting it
+	Stop bool
+	// Ack asks for a simulProfileDone once the profiles are sent
+	Ack bool
+}
+type simulProfileDone struct{}
 
 // Simulate starts the server and will setup the protocol.
 func Simulate(suite, serverAddress, simul, monitorAddress string) error {
+	return simulate(suite, serverAddress, simul, monitorAddress, nil)
+}
+
+// simulate is Simulate with the links between the servers emulated by the
+// given emulator, if it isn't nil.
+func simulate(suite, serverAddress, simul, monitorAddress string, links network.LinkEmulator) error {
 	scs, err := onet.LoadSimulationConfig(suite, ".", serverAddress)
 	if err != nil {
 		// We probably are not needed
@@ -29,18 +48,45 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 			log.Error("Couldn't connect monitor to sink:", err)
 			return xerrors.New("couldn't connect monitor to sink: " + err.Error())
 		}
+		monitor.Report(serverAddress)
 	}
 	sims := make([]onet.Simulation, len(scs))
 	simulInitID := network.RegisterMessage(simulInit{})
 	simulInitDoneID := network.RegisterMessage(simulInitDone{})
+	simulChurnStartID := network.RegisterMessage(simulChurnStart{})
+	simulChurnStopID := network.RegisterMessage(simulChurnStop{})
+	simulChurnStopDoneID := network.RegisterMessage(simulChurnStopDone{})
+	simulResourcesID := network.RegisterMessage(simulResources{})
+	simulTickID := network.RegisterMessage(simulTick{})
+	simulProfileID := network.RegisterMessage(simulProfile{})
+	simulProfileDoneID := network.RegisterMessage(simulProfileDone{})
 	var rootSC *onet.SimulationConfig
 	var rootSim onet.Simulation
 	// having a waitgroup so the binary stops when all servers are closed
-	var wgServer, wgSimulInit sync.WaitGroup
+	var wgServer, wgSimulInit, wgChurnStop, wgProfile sync.WaitGroup
+	var churnStart sync.Once
+	var ch *churn
 	var ready = make(chan bool)
 	measureNodeBW := true
 	measuresLock := sync.Mutex{}
 	measures := make([]*monitor.CounterIOMeasure, len(scs))
+	measureResources := false
+	// roundWait is set if the monitor aborts the run when a round is too
+	// long
+	roundWait := false
+	// capture is set if the servers record the messages they receive
+	capture := false
+	resources := make([]*monitor.ResourceMeasure, len(scs))
+	// tick is how much the virtual clocks of the deterministic
+	// simulations advance with every round
+	var tick time.Duration
+	var prof *profiles
+	// the profiles of a process are named after its address, or after
+	// localhost for the one running all the servers
+	source := serverAddress
+	if monitorAddress == "" {
+		source = "localhost"
+	}
 	if len(scs) > 0 {
 		cfg := &conf{}
 		_, err := toml.Decode(scs[0].Config, cfg)
@@ -48,20 +94,70 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 			return xerrors.New("error while decoding config: " + err.Error())
 		}
 		measureNodeBW = cfg.IndividualStats == ""
+		measureResources = cfg.Resources
+		roundWait = cfg.RoundWait != ""
+		capture = cfg.Capture
+		if cfg.Deterministic {
+			tick = time.Second
+			if cfg.Tick != "" {
+				tick, err = time.ParseDuration(cfg.Tick)
+				if err != nil {
+					return xerrors.Errorf("Tick: %v", err)
+				}
+			}
+		}
+		prof, err = readProfiles(scs[0].Config)
+		if err != nil {
+			return xerrors.Errorf("profiles: %v", err)
+		}
+		cc, err := readChurn(scs[0].Config)
+		if err != nil {
+			return xerrors.Errorf("churn: %v", err)
+		}
+		if cc != nil {
+			// the crashed conodes still take part in the end of the
+			// simulation
+			ch = newChurn(cc, scs, simulChurnStopID, simulChurnStopDoneID)
+		}
+		bc, err := readByzantine(scs[0].Config)
+		if err != nil {
+			return xerrors.Errorf("byzantine: %v", err)
+		}
+		if bc != nil {
+			if err := bc.apply(scs); err != nil {
+				return xerrors.Errorf("byzantine: %v", err)
+			}
+		}
 	}
+	// stopCaptures stops recording the messages of the servers
+	var stopCaptures []func()
 	for i, sc := range scs {
 		// Starting all servers for that server
 		server := sc.Server
+		if links != nil {
+			server.SetLinkEmulator(links)
+		}
+		if capture {
+			stop, err := startCapture(server)
+			if err != nil {
+				return xerrors.Errorf("capture: %v", err)
+			}
+			stopCaptures = append(stopCaptures, stop)
+		}
 
+		hostIndex, _ := sc.Roster.Search(sc.Server.ServerIdentity.ID)
 		if measureNodeBW {
-			hostIndex, _ := sc.Roster.Search(sc.Server.ServerIdentity.ID)
 			measures[i] = monitor.NewCounterIOMeasureWithHost("bandwidth", sc.Server, hostIndex)
 		}
+		if measureResources {
+			resources[i] = monitor.NewResourceMeasure("resources", sc.Server, hostIndex, len(scs))
+		}
 
 		log.Lvl3(serverAddress, "Starting server", server.ServerIdentity.Address)
 		// Launch a server and notifies when it's done
 		wgServer.Add(1)
 		measure := measures[i]
+		resource := resources[i]
 		go func(c *onet.Server) {
 			ready <- true
 			defer wgServer.Done()
@@ -95,6 +191,11 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 						measure.Reset()
 						measuresLock.Unlock()
 					}
+					if resource != nil {
+						measuresLock.Lock()
+						resource.Reset()
+						measuresLock.Unlock()
+					}
 				}()
 
 				err = sim.Node(scTmp)
@@ -114,6 +215,73 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 			}
 			return nil
 		})
+		server.RegisterProcessorFunc(simulResourcesID, func(env *network.Envelope) error {
+			if resource != nil {
+				measuresLock.Lock()
+				resource.Record()
+				measuresLock.Unlock()
+			}
+			return nil
+		})
+		var tickLock sync.Mutex
+		server.RegisterProcessorFunc(simulTickID, func(env *network.Envelope) error {
+			clock, ok := scTmp.Server.Clock().(*onet.VirtualClock)
+			if ok {
+				// the timers might send messages to this server, so
+				// they cannot fire in its dispatch
+				go func() {
+					tickLock.Lock()
+					defer tickLock.Unlock()
+					clock.Advance(tick)
+				}()
+			}
+			return nil
+		})
+		server.RegisterProcessorFunc(simulProfileID, func(env *network.Envelope) error {
+			msg := env.Msg.(*simulProfile)
+			// the messages are handled in order, so that a round
+			// stops before the next one starts
+			var err error
+			if msg.Stop {
+				err = prof.stop(msg.Round, source)
+			} else {
+				err = prof.start(msg.Round)
+			}
+			if err != nil {
+				log.Error("Couldn't profile round", msg.Round, ":", err)
+			}
+			if msg.Ack {
+				go func() {
+					_, err := scTmp.Server.Send(env.ServerIdentity, &simulProfileDone{})
+					log.ErrFatal(err)
+				}()
+			}
+			return nil
+		})
+		server.RegisterProcessorFunc(simulProfileDoneID, func(env *network.Envelope) error {
+			wgProfile.Done()
+			return nil
+		})
+		server.RegisterProcessorFunc(simulChurnStartID, func(env *network.Envelope) error {
+			if ch != nil {
+				churnStart.Do(ch.run)
+			}
+			return nil
+		})
+		server.RegisterProcessorFunc(simulChurnStopID, func(env *network.Envelope) error {
+			go func() {
+				if ch != nil {
+					ch.stop()
+				}
+				_, err := scTmp.Server.Send(env.ServerIdentity, &simulChurnStopDone{})
+				log.ErrFatal(err)
+			}()
+			return nil
+		})
+		server.RegisterProcessorFunc(simulChurnStopDoneID, func(env *network.Envelope) error {
+			wgChurnStop.Done()
+			return nil
+		})
 		if server.ServerIdentity.ID.Equal(sc.Tree.Root.ServerIdentity.ID) {
 			log.Lvl2(serverAddress, "is root-node, will start protocol")
 			rootSim = sim
@@ -168,9 +336,93 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 		syncWait.Record()
 		log.Lvl1("Starting new node", simul)
 
+		if ch != nil {
+			// The churn starts with the rounds of the simulation.
+			for _, conode := range rootSC.Roster.List {
+				_, err := rootSC.Server.Send(conode, &simulChurnStart{})
+				log.ErrFatal(err, "Couldn't send to conode:")
+			}
+		}
+
+		stopResources := func() {}
+		if measureResources {
+			// Every conode measures its resources at the end of each
+			// round.
+			stopResources = monitor.OnRecord("round", func() {
+				sendAll(rootSC, &simulResources{})
+			})
+		}
+
+		stopTicks := func() {}
+		if tick > 0 {
+			// The virtual clocks of all conodes advance at the end of
+			// each round.
+			stopTicks = monitor.OnRecord("round", func() {
+				sendAll(rootSC, &simulTick{})
+			})
+		}
+
+		// round is the round being run, counted by the round measures
+		round := 0
+		stopProfiles := func() {}
+		if prof != nil {
+			if prof.profiled(round) {
+				sendInOrder(rootSC, &simulProfile{Round: round})
+			}
+			stopProfiles = monitor.OnRecord("round", func() {
+				if prof.profiled(round) {
+					sendInOrder(rootSC, &simulProfile{Round: round, Stop: true})
+				}
+				round++
+				if prof.profiled(round) {
+					sendInOrder(rootSC, &simulProfile{Round: round})
+				}
+			})
+		}
+
+		if roundWait {
+			// The monitor aborts the run if the first round doesn't end
+			// in time.
+			if err := monitor.BeginMeasure("round"); err != nil {
+				log.Error("Couldn't begin round measure:", err)
+			}
+		}
+
 		measureNet := monitor.NewCounterIOMeasure("bandwidth_root", rootSC.Server)
 		simError = rootSim.Run(rootSC)
 		measureNet.Record()
+		stopResources()
+		stopTicks()
+		stopProfiles()
+
+		if prof != nil {
+			// The profiles of an unfinished round are sent before the
+			// conodes close.
+			log.Lvl2("Stopping profiles")
+			for _, conode := range rootSC.Roster.List {
+				wgProfile.Add(1)
+				_, err := rootSC.Server.Send(conode,
+					&simulProfile{Round: round, Stop: true, Ack: true})
+				if err != nil {
+					log.Error("Couldn't send to conode:", err)
+					wgProfile.Done()
+				}
+			}
+			wgProfile.Wait()
+		}
+
+		if ch != nil {
+			// Restart the crashed conodes, so that they can be closed.
+			log.Lvl2("Stopping churn")
+			wgChurnStop.Add(len(rootSC.Roster.List))
+			for _, conode := range rootSC.Roster.List {
+				go func(si *network.ServerIdentity) {
+					_, err := rootSC.Server.Send(si, &simulChurnStop{})
+					log.ErrFatal(err, "Couldn't send to conode:")
+				}(conode)
+			}
+			wgChurnStop.Wait()
+		}
 
 		// Test if all ServerIdentities are used in the tree, else we'll run into
 		// troubles with CloseAll
@@ -192,6 +444,9 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 	log.Lvl3(serverAddress, scs[0].Server.ServerIdentity, "is waiting for all servers to close")
 	wgServer.Wait()
 	log.Lvl2(serverAddress, "has all servers closed")
+	for _, stop := range stopCaptures {
+		stop()
+	}
 	if monitorAddress != "" {
 		monitor.EndAndCleanup()
 	}
@@ -203,6 +458,33 @@ func Simulate(suite, serverAddress, simul, monitorAddress string) error {
 	return nil
 }
 
+// sendAll sends the message from the root to all the conodes, without
+// waiting for it to be sent.
+func sendAll(sc *onet.SimulationConfig, msg interface{}) {
+	for _, conode := range sc.Roster.List {
+		go func(si *network.ServerIdentity) {
+			if _, err := sc.Server.Send(si, msg); err != nil {
+				log.Lvl2("Couldn't send to conode:", err)
+			}
+		}(conode)
+	}
+}
+
+// sendInOrder sends the message from the root to all the conodes, after
+// the messages sent before.
+func sendInOrder(sc *onet.SimulationConfig, msg interface{}) {
+	for _, conode := range sc.Roster.List {
+		if _, err := sc.Server.Send(conode, msg); err != nil {
+			log.Error("Couldn't send to conode:", err)
+		}
+	}
+}
+
 type conf struct {
 	IndividualStats string
+	Resources       bool
+	Deterministic   bool
+	Tick            string
+	RoundWait       string
+	Capture         bool
 }
@@ -0,0 +1,624 @@
+package platform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/app"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// Terraform is the platform running the simulation on virtual machines in
+// the cloud, created with terraform from a template. Every machine runs the
+// conodes of one server. The measurements are sent to the monitor on this
+// machine through ssh tunnels, and the machines are destroyed at the end of
+// the simulation, with an estimation of their cost.
+type Terraform struct {
+	// Simulation to be run
+	Simulation string
+	// Suite used for the simulation
+	Suite string
+	// Number of machines, the conodes are spread among them
+	Servers int
+	// Debugging-level: 0 is none - 5 is everything
+	Debug int
+	// The time to wait for the simulation to finish
+	RunWait string
+	// PreScript defines a script that is run before the simulation
+	PreScript string
+	// Tags to use when compiling
+	Tags string
+
+	// Provider of the built-in templates, "aws" or "gcp"
+	Provider string
+	// Template is the path to a terraform file replacing the built-in
+	// templates. It must take the number of machines in the "servers"
+	// variable and output their "public_ips" and "private_ips".
+	Template string
+	// Region of the machines
+	Region string
+	// Zone of the machines, only for gcp. It defaults to the first zone of
+	// the region.
+	Zone string
+	// Project of the machines, only for gcp
+	Project string
+	// InstanceType is the type of the machines
+	InstanceType string
+	// Image of the machines, ubuntu by default
+	Image string
+	// Login on the machines
+	Login string
+	// SSHKey is the private key to log in, its public key must be next to
+	// it with the ".pub" extension
+	SSHKey string
+	// PricePerHour of one machine in USD, for the estimation of the cost. It
+	// defaults to the price of the known instance types.
+	PricePerHour float64
+
+	// Directory we start - the simulation-directory of the service/protocol
+	wd string
+	// Directory for building
+	buildDir string
+	// Directory for deploying, copied to the machines
+	deployDir string
+	// Directory of the terraform state
+	terraformDir string
+	// Name of the resources, followed by the slot for a replica
+	name string
+	// Port of the monitor on this machine
+	monitorPort int
+	// Addresses of the machines
+	publicIPs, privateIPs []string
+	// Machines running since provisioned, for the cost
+	provisioned time.Time
+	// Hours of machines used before the last provisioning
+	machineHours float64
+	// Waits for the conodes of all the machines
+	wgRun sync.WaitGroup
+	// Whether the simulation is started
+	started bool
+	// hybrid are the conodes running on this machine, in a hybrid
+	// simulation
+	hybrid *hybridHosts
+}
+
+// terraformPrices are the on-demand prices in USD per hour of some instance
+// types, used when Terraform.PricePerHour isn't set.
+var terraformPrices = map[string]float64{
+	"t3.medium":      0.0416,
+	"t3.large":       0.0832,
+	"c5.xlarge":      0.17,
+	"c5.2xlarge":     0.34,
+	"e2-medium":      0.0335,
+	"e2-standard-4":  0.134,
+	"n2-standard-4":  0.1942,
+	"n2-standard-8":  0.3885,
+	"c2-standard-8":  0.4176,
+	"c2-standard-16": 0.8352,
+}
+
+// Configure implements the Platform-interface. It is called once to set up
+// the necessary internal variables.
+func (t *Terraform) Configure(pc *Config) {
+	t.wd, _ = os.Getwd()
+	t.buildDir = t.wd + "/build"
+	t.deployDir = t.wd + "/deploy"
+	t.terraformDir = t.wd + "/terraform"
+	t.name = "onet-simul"
+	t.Suite = pc.Suite
+	t.Debug = pc.Debug
+	t.monitorPort = pc.MonitorPort
+	if t.Provider == "" {
+		t.Provider = "aws"
+	}
+	if t.InstanceType == "" {
+		t.InstanceType = map[string]string{"aws": "t3.medium", "gcp": "e2-medium"}[t.Provider]
+	}
+	if t.Region == "" {
+		t.Region = map[string]string{"aws": "us-east-1", "gcp": "us-central1"}[t.Provider]
+	}
+	if t.Zone == "" {
+		t.Zone = t.Region + "-a"
+	}
+	if t.Login == "" {
+		t.Login = "ubuntu"
+	}
+	if t.SSHKey == "" {
+		home, _ := os.UserHomeDir()
+		t.SSHKey = filepath.Join(home, ".ssh", "id_rsa")
+	}
+	for _, d := range []string{t.buildDir, t.deployDir} {
+		os.RemoveAll(d)
+		log.ErrFatal(os.Mkdir(d, 0700))
+	}
+	// the state is kept to destroy the machines of an interrupted simulation
+	log.ErrFatal(os.MkdirAll(t.terraformDir, 0700))
+	if t.Simulation == "" {
+		log.Fatal("No simulation defined in runconfig")
+	}
+}
+
+// Replica implements the Replicator-interface. The replica creates its own
+// machines, with their own terraform state. A template given in Template must
+// allow several copies of its resources.
+func (t *Terraform) Replica(slot int, pc *Config) (Platform, error) {
+	r := &Terraform{
+		Simulation:   t.Simulation,
+		Suite:        t.Suite,
+		Servers:      t.Servers,
+		Debug:        pc.Debug,
+		RunWait:      t.RunWait,
+		PreScript:    t.PreScript,
+		Tags:         t.Tags,
+		Provider:     t.Provider,
+		Template:     t.Template,
+		Region:       t.Region,
+		Zone:         t.Zone,
+		Project:      t.Project,
+		InstanceType: t.InstanceType,
+		Image:        t.Image,
+		Login:        t.Login,
+		SSHKey:       t.SSHKey,
+		PricePerHour: t.PricePerHour,
+		wd:           t.wd,
+		buildDir:     t.buildDir,
+		deployDir:    fmt.Sprintf("%s/deploy-%d", t.wd, slot),
+		terraformDir: fmt.Sprintf("%s/terraform-%d", t.wd, slot),
+		name:         fmt.Sprintf("onet-simul-%d", slot),
+		monitorPort:  pc.MonitorPort,
+	}
+	os.RemoveAll(r.deployDir)
+	if err := os.Mkdir(r.deployDir, 0700); err != nil {
+		return nil, xerrors.Errorf("creating directory: %v", err)
+	}
+	if err := os.MkdirAll(r.terraformDir, 0700); err != nil {
+		return nil, xerrors.Errorf("creating directory: %v", err)
+	}
+	return r, nil
+}
+
+// Build compiles the simulation binary for the machines.
+func (t *Terraform) Build(build string, arg ...string) error {
+	log.Lvl1("Building for", t.Provider, build)
+	start := time.Now()
+	var tags []string
+	if t.Tags != "" {
+		tags = append([]string{"-tags"}, strings.Split(t.Tags, " ")...)
+	}
+	out, err := Build(".", t.buildDir+"/conode", "amd64", "linux",
+		append(arg, tags...)...)
+	if err != nil {
+		return xerrors.Errorf(err.Error() + " " + out)
+	}
+	log.Lvl1("Build is finished after", time.Since(start))
+	return nil
+}
+
+// Cleanup stops the conodes still running on the machines.
+func (t *Terraform) Cleanup() error {
+	var wg sync.WaitGroup
+	for _, ip := range t.publicIPs {
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			if out, err := t.ssh(ip, "pkill -9 -f onet_run/conode").CombinedOutput(); err != nil {
+				log.Lvl3("Error while cleaning up", ip, ":", err, string(out))
+			}
+		}(ip)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Deploy creates the machines if needed, and copies the binary and the
+// configuration of the run to them.
+func (t *Terraform) Deploy(rc *RunConfig) error {
+	sim, err := onet.NewSimulation(t.Simulation, string(rc.Toml()))
+	if err != nil {
+		return xerrors.Errorf("creating simulation: %v", err)
+	}
+	servers := t.Servers
+	if s, err := rc.GetInt("Servers"); err == nil {
+		servers = s
+	}
+	if servers <= 0 {
+		return xerrors.New("the number of Servers must be set")
+	}
+	if servers != len(t.publicIPs) {
+		if err := t.provision(servers); err != nil {
+			return xerrors.Errorf("provisioning: %v", err)
+		}
+	}
+
+	t.PreScript = rc.Get("PreScript")
+	if t.PreScript != "" {
+		if err := app.Copy(t.deployDir, t.PreScript); err != nil {
+			return xerrors.Errorf("copying: %v", err)
+		}
+	}
+	if err := app.Copy(t.deployDir, t.buildDir+"/conode"); err != nil {
+		return xerrors.Errorf("copying: %v", err)
+	}
+	simulConfig, err := sim.Setup(t.deployDir, t.privateIPs)
+	if err != nil {
+		return xerrors.Errorf("simulation setup: %v", err)
+	}
+	simulConfig.Config = string(rc.Toml())
+	if err := t.hybrid.deploy(simulConfig, ""); err != nil {
+		return xerrors.Errorf("hybrid: %v", err)
+	}
+	if err := simulConfig.Save(t.deployDir); err != nil {
+		return xerrors.Errorf("saving configuration: %v", err)
+	}
+
+	log.Lvl1("Copying the simulation to", len(t.publicIPs), "machines")
+	errs := make(chan error, len(t.publicIPs))
+	for _, ip := range t.publicIPs {
+		go func(ip string) {
+			out, err := t.rsync(ip).CombinedOutput()
+			if err != nil {
+				err = xerrors.Errorf("copying to %s: %v %s", ip, err, out)
+			}
+			errs <- err
+		}(ip)
+	}
+	for range t.publicIPs {
+		if e := <-errs; e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Start runs the conodes on every machine, with a tunnel to the monitor on
+// this machine, and returns.
+func (t *Terraform) Start(args ...string) error {
+	t.started = true
+	monitor := "localhost:" + strconv.Itoa(t.monitorPort)
+	for i, ip := range t.publicIPs {
+		command := "cd onet_run && "
+		if t.PreScript != "" {
+			command += "./" + t.PreScript + " terraform && "
+		}
+		command += fmt.Sprintf("./conode -debug %d -address %s -simul %s -suite %s -monitor %s",
+			t.Debug, t.privateIPs[i], t.Simulation, t.Suite, monitor)
+		cmd := t.ssh(ip, command, "-R", fmt.Sprintf("%d:localhost:%d", t.monitorPort, t.monitorPort))
+		t.wgRun.Add(1)
+		go func(ip string) {
+			defer t.wgRun.Done()
+			out, err := cmd.CombinedOutput()
+			log.Lvl3(ip, string(out))
+			if err != nil {
+				log.Error("Conodes of", ip, "failed:", err)
+			}
+		}(ip)
+	}
+	return nil
+}
+
+// Wait waits for the conodes of all the machines to finish, or for RunWait.
+func (t *Terraform) Wait() error {
+	if !t.started {
+		return nil
+	}
+	t.started = false
+	wait, err := time.ParseDuration(t.RunWait)
+	if err != nil || wait == 0 {
+		wait = 600 * time.Second
+	}
+	done := make(chan struct{})
+	go func() {
+		t.wgRun.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(wait):
+		log.Lvl1("Quitting after waiting", wait)
+		if err := t.Cleanup(); err != nil {
+			log.Error("Couldn't stop the conodes:", err)
+		}
+		<-done
+	}
+	return nil
+}
+
+// Teardown destroys the machines and logs the estimated cost of the
+// simulation.
+func (t *Terraform) Teardown() error {
+	if _, err := os.Stat(filepath.Join(t.terraformDir, "main.tf")); os.IsNotExist(err) {
+		return nil
+	}
+	log.Lvl1("Destroying the machines")
+	err := t.terraform("destroy", "-auto-approve", "-input=false",
+		"-var", "servers=0")
+	t.account(0)
+	log.Lvl1(t.costSummary())
+	return err
+}
+
+// setHybrid implements the hybridRemote interface.
+func (t *Terraform) setHybrid(h *hybridHosts) {
+	t.hybrid = h
+}
+
+// provision creates or destroys machines so that there are servers of them,
+// and waits for them to accept ssh connections.
+func (t *Terraform) provision(servers int) error {
+	tf, err := t.template()
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(t.terraformDir, "main.tf"), []byte(tf), 0600)
+	if err != nil {
+		return xerrors.Errorf("writing template: %v", err)
+	}
+	log.Lvl1("Provisioning", servers, t.InstanceType, "machines on", t.Provider)
+	if err := t.terraform("init", "-input=false"); err != nil {
+		return err
+	}
+	// the machines used until now are accounted before changing them
+	t.account(servers)
+	err = t.terraform("apply", "-auto-approve", "-input=false",
+		"-var", "servers="+strconv.Itoa(servers))
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("terraform", "output", "-json")
+	cmd.Dir = t.terraformDir
+	out, err := cmd.Output()
+	if err != nil {
+		return xerrors.Errorf("terraform output: %v", err)
+	}
+	t.publicIPs, t.privateIPs, err = parseTerraformOutput(out)
+	if err != nil {
+		return err
+	}
+	if len(t.publicIPs) != servers || len(t.privateIPs) != servers {
+		return xerrors.Errorf("got %d machines instead of %d", len(t.publicIPs), servers)
+	}
+
+	deadline := time.Now().Add(5 * time.Minute)
+	for _, ip := range t.publicIPs {
+		for t.ssh(ip, "true").Run() != nil {
+			if time.Now().After(deadline) {
+				return xerrors.Errorf("machine %s doesn't accept ssh connections", ip)
+			}
+			time.Sleep(5 * time.Second)
+		}
+	}
+	return nil
+}
+
+// account adds the hours of the running machines to the cost, and records
+// that there are now servers machines.
+func (t *Terraform) account(servers int) {
+	now := time.Now()
+	if !t.provisioned.IsZero() {
+		t.machineHours += float64(len(t.publicIPs)) * now.Sub(t.provisioned).Hours()
+	}
+	t.provisioned = now
+	if servers == 0 {
+		t.provisioned = time.Time{}
+		t.publicIPs, t.privateIPs = nil, nil
+	}
+}
+
+// costSummary returns the hours of machines used and their estimated cost.
+func (t *Terraform) costSummary() string {
+	price := t.PricePerHour
+	if price == 0 {
+		price = terraformPrices[t.InstanceType]
+	}
+	if price == 0 {
+		return fmt.Sprintf("Used %.2f hours of %s machines, unknown price",
+			t.machineHours, t.InstanceType)
+	}
+	return fmt.Sprintf("Used %.2f hours of %s machines, estimated cost: $%.2f",
+		t.machineHours, t.InstanceType, t.machineHours*price)
+}
+
+// terraform runs the terraform command in the directory of the state.
+func (t *Terraform) terraform(args ...string) error {
+	cmd := exec.Command("terraform", args...)
+	cmd.Dir = t.terraformDir
+	out, err := cmd.CombinedOutput()
+	log.Lvl3(string(out))
+	if err != nil {
+		return xerrors.Errorf("terraform %s: %v %s", args[0], err, out)
+	}
+	return nil
+}
+
+// sshOptions don't ask for the keys of the new machines.
+func (t *Terraform) sshOptions() []string {
+	return []string{"-i", t.SSHKey, "-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null", "-o", "LogLevel=ERROR",
+		"-o", "ConnectTimeout=10"}
+}
+
+// ssh returns the command running command on the machine, with the
+// additional options of ssh.
+func (t *Terraform) ssh(ip, command string, opts ...string) *exec.Cmd {
+	args := append(t.sshOptions(), opts...)
+	args = append(args, t.Login+"@"+ip, command)
+	return exec.Command("ssh", args...)
+}
+
+// rsync returns the command copying the deploy directory to the machine.
+func (t *Terraform) rsync(ip string) *exec.Cmd {
+	return exec.Command("rsync", "-az", "--delete",
+		"-e", "ssh "+strings.Join(t.sshOptions(), " "),
+		t.deployDir+"/", t.Login+"@"+ip+":onet_run/")
+}
+
+// template returns the terraform file creating the machines.
+func (t *Terraform) template() (string, error) {
+	if t.Template != "" {
+		tf, err := ioutil.ReadFile(t.Template)
+		if err != nil {
+			return "", xerrors.Errorf("reading template: %v", err)
+		}
+		return string(tf), nil
+	}
+	tmpl, ok := terraformTemplates[t.Provider]
+	if !ok {
+		return "", xerrors.Errorf("unknown provider %s", t.Provider)
+	}
+	var buf strings.Builder
+	err := tmpl.Execute(&buf, struct {
+		*Terraform
+		Name string
+	}{t, t.name})
+	if err != nil {
+		return "", xerrors.Errorf("template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// parseTerraformOutput returns the addresses of the machines from the output
+// of "terraform output -json".
+func parseTerraformOutput(out []byte) (public, private []string, err error) {
+	var outputs map[string]struct {
+		Value []string `json:"value"`
+	}
+	if err = json.Unmarshal(out, &outputs); err != nil {
+		return nil, nil, xerrors.Errorf("decoding terraform output: %v", err)
+	}
+	return outputs["public_ips"].Value, outputs["private_ips"].Value, nil
+}
+
+var terraformTemplates = map[string]*template.Template{
+	"aws": template.Must(template.New("aws").Parse(`variable "servers" {
+  type = number
+}
+
+provider "aws" {
+  region = "{{.Region}}"
+}
+
+data "aws_ami" "ubuntu" {
+  most_recent = true
+  owners      = ["099720109477"]
+  filter {
+    name   = "name"
+    values = ["ubuntu/images/hvm-ssd/ubuntu-jammy-22.04-amd64-server-*"]
+  }
+}
+
+resource "aws_key_pair" "simul" {
+  key_name_prefix = "{{.Name}}-"
+  public_key      = file("{{.SSHKey}}.pub")
+}
+
+resource "aws_security_group" "simul" {
+  name_prefix = "{{.Name}}-"
+  ingress {
+    from_port   = 22
+    to_port     = 22
+    protocol    = "tcp"
+    cidr_blocks = ["0.0.0.0/0"]
+  }
+  ingress {
+    from_port = 0
+    to_port   = 0
+    protocol  = "-1"
+    self      = true
+  }
+  egress {
+    from_port   = 0
+    to_port     = 0
+    protocol    = "-1"
+    cidr_blocks = ["0.0.0.0/0"]
+  }
+}
+
+resource "aws_instance" "conode" {
+  count                  = var.servers
+  ami                    = {{if .Image}}"{{.Image}}"{{else}}data.aws_ami.ubuntu.id{{end}}
+  instance_type          = "{{.InstanceType}}"
+  key_name               = aws_key_pair.simul.key_name
+  vpc_security_group_ids = [aws_security_group.simul.id]
+  tags = {
+    Name = "{{.Name}}-${count.index}"
+  }
+}
+
+output "public_ips" {
+  value = aws_instance.conode[*].public_ip
+}
+
+output "private_ips" {
+  value = aws_instance.conode[*].private_ip
+}
+`)),
+	"gcp": template.Must(template.New("gcp").Parse(`variable "servers" {
+  type = number
+}
+
+provider "google" {
+  project = "{{.Project}}"
+  region  = "{{.Region}}"
+  zone    = "{{.Zone}}"
+}
+
+resource "google_compute_firewall" "simul" {
+  name          = "{{.Name}}-ssh"
+  network       = "default"
+  source_ranges = ["0.0.0.0/0"]
+  target_tags   = ["{{.Name}}"]
+  allow {
+    protocol = "tcp"
+    ports    = ["22"]
+  }
+}
+
+resource "google_compute_firewall" "simul_internal" {
+  name        = "{{.Name}}-internal"
+  network     = "default"
+  source_tags = ["{{.Name}}"]
+  target_tags = ["{{.Name}}"]
+  allow {
+    protocol = "all"
+  }
+}
+
+resource "google_compute_instance" "conode" {
+  count        = var.servers
+  name         = "{{.Name}}-${count.index}"
+  machine_type = "{{.InstanceType}}"
+  tags         = ["{{.Name}}"]
+  boot_disk {
+    initialize_params {
+      image = "{{if .Image}}{{.Image}}{{else}}ubuntu-os-cloud/ubuntu-2204-lts{{end}}"
+    }
+  }
+  network_interface {
+    network = "default"
+    access_config {}
+  }
+  metadata = {
+    ssh-keys = "{{.Login}}:${file("{{.SSHKey}}.pub")}"
+  }
+}
+
+output "public_ips" {
+  value = google_compute_instance.conode[*].network_interface[0].access_config[0].nat_ip
+}
+
+output "private_ips" {
+  value = google_compute_instance.conode[*].network_interface[0].network_ip
+}
+`)),
+}
@@ -0,0 +1,76 @@
+package platform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerraform_template(t *testing.T) {
+	tf := &Terraform{Provider: "aws", Region: "eu-west-1",
+		InstanceType: "c5.xlarge", SSHKey: "/keys/simul"}
+	out, err := tf.template()
+	require.NoError(t, err)
+	require.Contains(t, out, `region = "eu-west-1"`)
+	require.Contains(t, out, `instance_type          = "c5.xlarge"`)
+	require.Contains(t, out, "data.aws_ami.ubuntu.id")
+	require.Contains(t, out, `file("/keys/simul.pub")`)
+
+	tf.Image = "ami-1234"
+	out, err = tf.template()
+	require.NoError(t, err)
+	require.Contains(t, out, `ami                    = "ami-1234"`)
+
+	tf = &Terraform{Provider: "gcp", Project: "simul", Zone: "europe-west1-b",
+		Login: "ubuntu", SSHKey: "/keys/simul"}
+	out, err = tf.template()
+	require.NoError(t, err)
+	require.Contains(t, out, `zone    = "europe-west1-b"`)
+	require.Contains(t, out, "ubuntu-os-cloud/ubuntu-2204-lts")
+	require.Contains(t, out, `"ubuntu:${file("/keys/simul.pub")}"`)
+
+	tf.wd = t.TempDir()
+	replica, err := tf.Replica(2, &Config{MonitorPort: 10002})
+	require.NoError(t, err)
+	out, err = replica.(*Terraform).template()
+	require.NoError(t, err)
+	require.Contains(t, out, `name          = "onet-simul-2-ssh"`)
+	require.Contains(t, out, `tags         = ["onet-simul-2"]`)
+	require.DirExists(t, replica.(*Terraform).terraformDir)
+
+	tf.Provider = "azure"
+	_, err = tf.template()
+	require.Error(t, err)
+}
+
+func TestParseTerraformOutput(t *testing.T) {
+	public, private, err := parseTerraformOutput([]byte(`{
+  "private_ips": {"sensitive": false, "type": ["tuple", ["string", "string"]],
+    "value": ["10.0.0.2", "10.0.0.3"]},
+  "public_ips": {"sensitive": false, "type": ["tuple", ["string", "string"]],
+    "value": ["1.2.3.4", "1.2.3.5"]}
+}`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"1.2.3.4", "1.2.3.5"}, public)
+	require.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, private)
+
+	_, _, err = parseTerraformOutput([]byte("Error"))
+	require.Error(t, err)
+}
+
+func TestTerraform_cost(t *testing.T) {
+	tf := &Terraform{InstanceType: "t3.large"}
+	tf.publicIPs = make([]string, 4)
+	tf.provisioned = time.Now().Add(-30 * time.Minute)
+	tf.account(0)
+	require.InDelta(t, 2, tf.machineHours, 0.01)
+	require.True(t, tf.provisioned.IsZero())
+	require.Contains(t, tf.costSummary(), "estimated cost: $0.17")
+
+	tf.PricePerHour = 1
+	require.Contains(t, tf.costSummary(), "estimated cost: $2.00")
+	tf.PricePerHour = 0
+	tf.InstanceType = "custom"
+	require.Contains(t, tf.costSummary(), "unknown price")
+}
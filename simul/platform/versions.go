@@ -0,0 +1,94 @@
+package platform
+
+import (
+	"strconv"
+
+	"go.dedis.ch/onet/v3"
+	"golang.org/x/xerrors"
+)
+
+// Versioner is implemented by the platforms able to run another version of
+// the simulation binary on some of the servers, to evaluate the upgrades.
+// HostVersions returns the version of every host of the roster of the last
+// Deploy, or nil if they all run the same binary.
+type Versioner interface {
+	HostVersions() []string
+}
+
+// versions holds the versions of a mixed-version simulation, read from the
+// run-configuration.
+type versions struct {
+	// OtherSimul is the directory of the main package of the other
+	// version, relative to the directory of the simulation.
+	OtherSimul string
+	// OtherServers is how many servers run the other version. They are the
+	// last ones, so that the root of the simulation runs this version.
+	OtherServers int
+	// Version and OtherVersion tag the measures of the hosts running this
+	// version and the other one.
+	Version      string
+	OtherVersion string
+}
+
+// readVersions returns the versions of the run-configuration, or nil if
+// all the servers run this version.
+func readVersions(rc *RunConfig) (*versions, error) {
+	v := &versions{
+		OtherSimul:   rc.Get("OtherSimul"),
+		Version:      rc.Get("Version"),
+		OtherVersion: rc.Get("OtherVersion"),
+	}
+	if v.OtherSimul == "" {
+		return nil, nil
+	}
+	if s := rc.Get("OtherServers"); s != "" {
+		var err error
+		v.OtherServers, err = strconv.Atoi(s)
+		if err != nil {
+			return nil, xerrors.Errorf("OtherServers: %v", err)
+		}
+	}
+	if v.Version == "" {
+		v.Version = "current"
+	}
+	if v.OtherVersion == "" {
+		v.OtherVersion = "other"
+	}
+	return v, nil
+}
+
+// Versions returns the names of the versions of a mixed-version run, this
+// one first, or nil if all the servers run this binary.
+func Versions(rc *RunConfig) ([]string, error) {
+	v, err := readVersions(rc)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return []string{v.Version, v.OtherVersion}, nil
+}
+
+// other returns true if the server at the given index, out of n, runs the
+// other version.
+func (v *versions) other(index, n int) bool {
+	return v != nil && index >= n-v.OtherServers
+}
+
+// hostVersions returns the version of every host of the roster, run by the
+// servers of the given addresses.
+func (v *versions) hostVersions(roster *onet.Roster, addresses []string) []string {
+	if v == nil {
+		return nil
+	}
+	others := make(map[string]bool)
+	for i, a := range addresses {
+		others[a] = v.other(i, len(addresses))
+	}
+	hosts := make([]string, len(roster.List))
+	for i, si := range roster.List {
+		hosts[i] = v.Version
+		if others[si.Address.Host()] {
+			hosts[i] = v.OtherVersion
+		}
+	}
+	return hosts
+}
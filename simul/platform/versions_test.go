@@ -0,0 +1,45 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestVersions(t *testing.T) {
+	rc := NewRunConfig()
+	v, err := readVersions(rc)
+	require.NoError(t, err)
+	require.Nil(t, v)
+	require.Nil(t, v.hostVersions(nil, nil))
+
+	rc.Put("OtherSimul", `"../release"`)
+	rc.Put("OtherServers", "1")
+	rc.Put("OtherVersion", "v3.2")
+	names, err := Versions(rc)
+	require.NoError(t, err)
+	require.Equal(t, []string{"current", "v3.2"}, names)
+
+	v, err = readVersions(rc)
+	require.NoError(t, err)
+	addresses := []string{"127.0.0.1", "127.0.0.2"}
+	var list []*network.ServerIdentity
+	for i := 0; i < 3; i++ {
+		addr := network.NewAddress(network.PlainTCP, addresses[i%2]+":2000")
+		list = append(list, network.NewServerIdentity(suites.MustFind("Ed25519").Point(), addr))
+	}
+	roster := onet.NewRoster(list)
+	require.Equal(t, []string{"current", "v3.2", "current"},
+		v.hostVersions(roster, addresses))
+
+	rc.Put("OtherServers", "two")
+	_, err = readVersions(rc)
+	require.Error(t, err)
+
+	d := &Deterlab{Virt: addresses, OtherSimul: "../release", OtherServers: 1}
+	require.Equal(t, "simul", d.SimulBinary(0))
+	require.Equal(t, "other", d.SimulBinary(1))
+}
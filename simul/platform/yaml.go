@@ -0,0 +1,286 @@
+package platform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+)
+
+// A yaml run-file is the alternative to the .toml-files for large suites of
+// experiments. It is a map with the following keys:
+//
+//	include: [common.yaml]   # files with the config shared by the suites
+//	config:                  # the global options of the experiments
+//	  Simulation: Count
+//	  Servers: 16
+//	runs:                    # the experiments, one by line
+//	  - {Hosts: 3, Rounds: 4}
+//	matrix:                  # experiments with every combination of options
+//	  Hosts: [7, 15]
+//	  Rounds: [4, 8]
+//
+// The anchors and aliases of yaml can be used to share options between the
+// experiments.
+
+// yamlKeys are the keys a yaml run-file can have.
+var yamlKeys = []string{"include", "config", "runs", "matrix"}
+
+// yamlOptionName matches the names of the options, which are written as
+// toml keys.
+var yamlOptionName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// yamlRunFile is the content of a yaml run-file.
+type yamlRunFile struct {
+	Include []string                 `yaml:"include"`
+	Config  map[string]interface{}   `yaml:"config"`
+	Runs    []map[string]interface{} `yaml:"runs"`
+	// Matrix keeps the order of its options, so it can't have merge keys,
+	// which yaml.MapSlice doesn't support.
+	Matrix yaml.MapSlice `yaml:"matrix"`
+}
+
+// yamlOption is an option of a yaml run-file, with its value formatted for
+// the RunConfig.
+type yamlOption struct {
+	name  string
+	value string
+}
+
+// isYAMLRunFile returns true if the run-file is written in yaml.
+func isYAMLRunFile(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// readYAMLRunFile reads the experiments of a yaml run-file. Like for the
+// .toml-files, the global options are also decoded in the platform.
+func readYAMLRunFile(p Platform, filename string) ([]*RunConfig, error) {
+	config, runs, err := parseYAMLRunFile(filename, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, xerrors.Errorf("%s: no experiments in runs or matrix", filename)
+	}
+	masterConfig := NewRunConfig()
+	for _, o := range config {
+		masterConfig.Put(o.name, o.value)
+		if err := decodeOption(p, o.name+" = "+o.value); err != nil {
+			return nil, xerrors.Errorf("%s: config.%s: %v", filename, o.name, err)
+		}
+	}
+	if masterConfig.Get("Simulation") == "" {
+		return nil, xerrors.Errorf("%s: config: Simulation is missing", filename)
+	}
+	var runconfigs []*RunConfig
+	for i, run := range runs {
+		rc := masterConfig.Clone()
+		for _, o := range run {
+			rc.Put(o.name, o.value)
+		}
+		if rc.Get("Servers") == "" {
+			return nil, xerrors.Errorf("%s: experiment %d: Servers is missing",
+				filename, i)
+		}
+		runconfigs = append(runconfigs, rc)
+	}
+	log.Lvl2("Read", len(runconfigs), "experiments from", filename)
+	return runconfigs, nil
+}
+
+// parseYAMLRunFile returns the global options of the run-file, after the
+// ones of its includes, and the options of its experiments. Seen holds the
+// files being parsed, to detect the cycles of includes.
+func parseYAMLRunFile(filename string, seen map[string]bool) ([]yamlOption,
+	[][]yamlOption, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("%s: %v", filename, err)
+	}
+	if seen[abs] {
+		return nil, nil, xerrors.Errorf("%s: included by itself", filename)
+	}
+	seen[abs] = true
+	defer delete(seen, abs)
+
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("reading run-file: %v", err)
+	}
+	var keys yaml.MapSlice
+	if err := yaml.Unmarshal(buf, &keys); err != nil {
+		return nil, nil, xerrors.Errorf("%s: %v", filename, err)
+	}
+	for _, item := range keys {
+		if !isYAMLKey(item.Key) {
+			return nil, nil, xerrors.Errorf("%s: unknown key %v, expected one of %s",
+				filename, item.Key, strings.Join(yamlKeys, ", "))
+		}
+	}
+	var rf yamlRunFile
+	if err := yaml.Unmarshal(buf, &rf); err != nil {
+		return nil, nil, xerrors.Errorf("%s: %v", filename, err)
+	}
+
+	var config []yamlOption
+	for _, inc := range rf.Include {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(filename), inc)
+		}
+		incConfig, incRuns, err := parseYAMLRunFile(inc, seen)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("%s: include: %v", filename, err)
+		}
+		if len(incRuns) > 0 {
+			return nil, nil, xerrors.Errorf("%s: included file %s can only have include and config",
+				filename, inc)
+		}
+		config = append(config, incConfig...)
+	}
+	own, err := yamlOptions(rf.Config)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("%s: config%v", filename, err)
+	}
+	config = append(config, own...)
+
+	var runs [][]yamlOption
+	for i, run := range rf.Runs {
+		options, err := yamlOptions(run)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("%s: runs[%d]%v", filename, i, err)
+		}
+		runs = append(runs, options)
+	}
+	matrix, err := yamlMatrix(rf.Matrix)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("%s: matrix%v", filename, err)
+	}
+	return config, append(runs, matrix...), nil
+}
+
+// isYAMLKey returns true if the key is one of a yaml run-file.
+func isYAMLKey(key interface{}) bool {
+	for _, k := range yamlKeys {
+		if key == k {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlOptions returns the options of a map of a run-file, sorted by name.
+// The errors start with the path of the option in the map.
+func yamlOptions(m map[string]interface{}) ([]yamlOption, error) {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	names := make(map[string]string)
+	var options []yamlOption
+	for _, k := range keys {
+		name, err := yamlName(k, names)
+		if err != nil {
+			return nil, err
+		}
+		value, err := yamlValue(m[k])
+		if err != nil {
+			return nil, xerrors.Errorf(".%s: %v", name, err)
+		}
+		options = append(options, yamlOption{name, value})
+	}
+	return options, nil
+}
+
+// yamlMatrix returns the experiments with every combination of the values
+// of the options of the matrix. The first option changes the least often.
+func yamlMatrix(m yaml.MapSlice) ([][]yamlOption, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	runs := [][]yamlOption{nil}
+	names := make(map[string]string)
+	for _, item := range m {
+		name, err := yamlName(item.Key, names)
+		if err != nil {
+			return nil, err
+		}
+		list, ok := item.Value.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, xerrors.Errorf(".%s: must be a list of values", name)
+		}
+		var values []string
+		for i, v := range list {
+			value, err := yamlValue(v)
+			if err != nil {
+				return nil, xerrors.Errorf(".%s[%d]: %v", name, i, err)
+			}
+			values = append(values, value)
+		}
+		var combined [][]yamlOption
+		for _, run := range runs {
+			for _, value := range values {
+				options := append(append([]yamlOption{}, run...),
+					yamlOption{name, value})
+				combined = append(combined, options)
+			}
+		}
+		runs = combined
+	}
+	return runs, nil
+}
+
+// yamlName returns the name of an option, checking that it is a valid toml
+// key and that it isn't in names yet, as the options are case-insensitive.
+func yamlName(key interface{}, names map[string]string) (string, error) {
+	name := fmt.Sprint(key)
+	if !yamlOptionName.MatchString(name) {
+		return "", xerrors.Errorf(": invalid option name %q", name)
+	}
+	lower := strings.ToLower(name)
+	if other, ok := names[lower]; ok {
+		return "", xerrors.Errorf(": options %s and %s are the same", other, name)
+	}
+	names[lower] = name
+	return name, nil
+}
+
+// yamlValue returns the value of an option as written in the .toml-files:
+// the strings are quoted, and the numbers and booleans aren't.
+func yamlValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64, uint64:
+		return fmt.Sprint(v), nil
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return "", xerrors.New("must be a finite number")
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		// toml reads a float without a dot or an exponent as an integer
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case nil:
+		return "", xerrors.New("missing value")
+	case []interface{}:
+		return "", xerrors.New("must be a single value, not a list")
+	default:
+		return "", xerrors.New("must be a number, a string or a boolean")
+	}
+}
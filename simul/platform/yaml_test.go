@@ -0,0 +1,95 @@
+package platform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const yamlCommon = `
+config:
+  App: sign
+  Machines: 8
+  Servers: 2
+`
+
+const yamlSuite = `
+include: [common.yml]
+config:
+  Simulation: Count
+  Servers: 4
+  Ratio: 2.0
+defaults: &defaults
+`
+
+const yamlRuns = `
+include: [common.yml]
+config:
+  Simulation: Count
+  Servers: 4
+  Ratio: 2.0
+runs:
+  - &small {Hosts: 3, Other: "string 1"}
+  - {<<: *small, Hosts: 5}
+matrix:
+  Hosts: [7, 15]
+  Prescript: [a.sh, b.sh]
+`
+
+func TestReadYAMLRunFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(file, []byte(content), 0660))
+		return file
+	}
+	write("common.yml", yamlCommon)
+
+	tplat := &TPlat{}
+	rcs, err := readYAMLRunFile(tplat, write("runs.yml", yamlRuns))
+	require.NoError(t, err)
+	require.Equal(t, "sign", tplat.App)
+	require.Equal(t, 8, tplat.Machines)
+	require.Equal(t, 6, len(rcs))
+	// the options override the ones of the includes
+	require.Equal(t, "4", rcs[0].Get("Servers"))
+	require.Equal(t, "2.0", rcs[0].Get("Ratio"))
+	require.Equal(t, "Count", rcs[0].Get("Simulation"))
+	require.Equal(t, `"Count"`, rcs[0].fields["simulation"])
+	require.Equal(t, "3", rcs[0].Get("Hosts"))
+	require.Equal(t, "string 1", rcs[0].Get("Other"))
+	require.Equal(t, "5", rcs[1].Get("Hosts"))
+	require.Equal(t, "string 1", rcs[1].Get("Other"))
+	var matrix [][2]string
+	for _, rc := range rcs[2:] {
+		require.Equal(t, "", rc.Get("Other"))
+		matrix = append(matrix, [2]string{rc.Get("Hosts"), rc.Get("Prescript")})
+	}
+	require.Equal(t, [][2]string{{"7", "a.sh"}, {"7", "b.sh"}, {"15", "a.sh"},
+		{"15", "b.sh"}}, matrix)
+
+	for _, test := range []struct{ content, err string }{
+		{yamlSuite, "unknown key defaults"},
+		{"include: [common.yml]\nconfig: {Simulation: Count}\n", "no experiments"},
+		{"include: [common.yml]\nruns: [{Hosts: 3}]\n", "Simulation is missing"},
+		{"config: {Simulation: Count}\nruns: [{Hosts: 3}]\n", "experiment 0: Servers is missing"},
+		{"config: {Simulation: Count, Servers: [1, 2]}\n", "config.Servers: must be a single value"},
+		{"config: {Simulation: Count, Servers: 2, servers: 3}\n", "options Servers and servers are the same"},
+		{"config: {Simulation: Count, Servers: 2}\nruns: [{Host s: 3}]\n", `runs[0]: invalid option name "Host s"`},
+		{"config: {Simulation: Count, Servers: 2}\nmatrix: {Hosts: 3}\n", "matrix.Hosts: must be a list"},
+		{"config: {Simulation: Count, Servers: 2}\nmatrix: {Hosts: [3, {a: 1}]}\n", "matrix.Hosts[1]: must be a number"},
+		{"config: {Simulation: Count, Servers: 2}\nruns: [{Hosts: }]\n", "runs[0].Hosts: missing value"},
+		{"include: [bad.yml]\n", "included by itself"},
+		{"include: [runs.yml]\n", "can only have include and config"},
+		{"config: [Simulation]\n", "cannot unmarshal"},
+	} {
+		_, err := readYAMLRunFile(&TPlat{}, write("bad.yml", test.content))
+		require.Error(t, err, test.content)
+		require.Contains(t, err.Error(), test.err)
+	}
+}
@@ -32,6 +32,10 @@ var simul string
 // suite is Ed25519 by default
 var suite string
 
+// replay is the capture of the messages of a server to replay, instead of
+// running the simulation
+var replay string
+
 // Initialize before 'init' so we can directly use the fields as parameters
 // to 'Flag'
 func init() {
@@ -39,6 +43,7 @@ func init() {
 	flag.StringVar(&simul, "simul", "", "start simulating that protocol")
 	flag.StringVar(&monitorAddress, "monitor", "", "remote monitor")
 	flag.StringVar(&suite, "suite", "Ed25519", "cryptographic suite to use")
+	flag.StringVar(&replay, "replay", "", "replay the capture of a server of that simulation")
 
 }
 
@@ -63,6 +68,8 @@ func Start(rcs ...string) {
 	flag.Parse()
 	if simul == "" {
 		startBuild()
+	} else if replay != "" {
+		log.ErrFatal(platform.Replay(suite, simul, replay))
 	} else {
 		err := platform.Simulate(suite, serverAddress, simul, monitorAddress)
 		log.ErrFatal(err)
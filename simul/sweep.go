@@ -0,0 +1,246 @@
+package simul
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/simul/monitor"
+	"go.dedis.ch/onet/v3/simul/platform"
+	"golang.org/x/xerrors"
+)
+
+// replicas are the platforms created for the parallel runs, torn down with
+// the platform they replicate.
+var replicas struct {
+	list []platform.Platform
+	sync.Mutex
+}
+
+// runParallel runs the tests of the range on n platforms at once: the given
+// one and replicas of it. Every test writes its stats in its own files,
+// which are merged in the order of the tests once all are done.
+func runParallel(deployP platform.Platform, rep platform.Replicator, name string,
+	runconfigs []*platform.RunConfig, start, stop, n, flags int) error {
+	platforms := []platform.Platform{deployP}
+	for slot := 1; slot < n; slot++ {
+		p, err := rep.Replica(slot, &platform.Config{
+			MonitorPort: monitorPort + slot,
+			Debug:       log.DebugVisible(),
+			Suite:       runconfigs[0].Get("Suite"),
+		})
+		if err != nil {
+			log.Error("Couldn't create the platform of slot", slot, ":", err)
+			break
+		}
+		replicas.Lock()
+		replicas.list = append(replicas.list, p)
+		replicas.Unlock()
+		platforms = append(platforms, p)
+	}
+	if err := os.MkdirAll(runsDir(name), 0777); err != nil {
+		return xerrors.Errorf("creating directory: %v", err)
+	}
+	log.Lvl1("Running the tests on", len(platforms), "platforms at once")
+
+	tests := make(chan int)
+	var wg sync.WaitGroup
+	for slot, p := range platforms {
+		wg.Add(1)
+		go func(slot int, p platform.Platform) {
+			defer wg.Done()
+			for i := range tests {
+				rc := runconfigs[i]
+				removeRunStats(name, i)
+				log.Lvl1("Running test", i, "on slot", slot, "with config:", rc)
+				stats, err := runTest(p, rc, monitorPort+slot, profileDir(name, i))
+				if err != nil {
+					log.Error("Error running test", i, ":", err)
+					continue
+				}
+				log.Lvl1("Test", i, "results:", stats[0])
+				if err := writeRunStats(name, i, rc, stats); err != nil {
+					log.Error("Couldn't write the results of test", i, ":", err)
+				}
+			}
+		}(slot, p)
+	}
+	for i := start; i <= stop && i < len(runconfigs); i++ {
+		tests <- i
+	}
+	close(tests)
+	wg.Wait()
+	return mergeRunStats(name, start, stop, len(runconfigs), flags)
+}
+
+// runsDir is the directory of the results of every test of a parallel run.
+func runsDir(name string) string {
+	return fmt.Sprintf("test_data/%s_runs", name)
+}
+
+// generateRunFileName returns the file of the results of a test for the
+// bucket.
+func generateRunFileName(name string, test, index int) string {
+	if index == 0 {
+		return fmt.Sprintf("%s/%d.csv", runsDir(name), test)
+	}
+	return fmt.Sprintf("%s/%d_%d.csv", runsDir(name), test, index)
+}
+
+// removeRunStats removes the results of an earlier run of the test.
+func removeRunStats(name string, test int) {
+	files, _ := filepath.Glob(fmt.Sprintf("%s/%d_*.csv", runsDir(name), test))
+	for _, f := range append(files, generateRunFileName(name, test, 0)) {
+		os.Remove(f)
+	}
+}
+
+// writeRunStats writes the stats of every bucket of a test in its own file,
+// with its header.
+func writeRunStats(name string, test int, rc *platform.RunConfig,
+	stats []*monitor.Stats) error {
+	for j, bucketStat := range stats {
+		f, err := os.Create(generateRunFileName(name, test, j))
+		if err != nil {
+			return xerrors.Errorf("creating file: %v", err)
+		}
+		err = writeStats(f, rc, bucketStat, true)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return xerrors.Errorf("writing stats: %v", err)
+		}
+	}
+	return nil
+}
+
+// mergeRunStats appends the results of the tests of the range to the result
+// files, in the order of the tests. The header comes from the first test,
+// as for a sequential run.
+func mergeRunStats(name string, start, stop, tests, flags int) error {
+	for j := 0; ; j++ {
+		var runs []string
+		for i := start; i <= stop && i < tests; i++ {
+			if _, err := os.Stat(generateRunFileName(name, i, j)); err == nil {
+				runs = append(runs, generateRunFileName(name, i, j))
+			}
+		}
+		if len(runs) == 0 {
+			return nil
+		}
+		f, err := os.OpenFile(generateResultFileName(name, j), flags, 0660)
+		if err != nil {
+			return xerrors.Errorf("opening result file: %v", err)
+		}
+		for i, run := range runs {
+			err = appendRunStats(f, run, i == 0 && start == 0)
+			if err != nil {
+				break
+			}
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return xerrors.Errorf("merging %s: %v", generateResultFileName(name, j), err)
+		}
+	}
+}
+
+// appendRunStats copies the results of the file to w, without its header
+// unless asked to.
+func appendRunStats(w io.Writer, file string, header bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return xerrors.Errorf("opening: %v", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if !header {
+		if _, err := r.ReadString('\n'); err != nil {
+			return xerrors.Errorf("reading header: %v", err)
+		}
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return xerrors.Errorf("copying: %v", err)
+	}
+	return nil
+}
+
+// writeSummary writes test_data/<name>_summary.csv with, for every measure,
+// the number of tests, the mean, minimum, maximum and standard deviation of
+// its average over the tests of the result file.
+func writeSummary(name string) error {
+	in, err := os.Open(generateResultFileName(name, 0))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("opening results: %v", err)
+	}
+	defer in.Close()
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return xerrors.Errorf("reading results: %v", err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	var lines []string
+	for c, field := range records[0] {
+		if !strings.HasSuffix(field, "_avg") {
+			continue
+		}
+		var values []float64
+		for _, record := range records[1:] {
+			if c >= len(record) {
+				continue
+			}
+			v, err := strconv.ParseFloat(record[c], 64)
+			if err == nil && !math.IsNaN(v) {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		mean, min, max, dev := summarize(values)
+		lines = append(lines, fmt.Sprintf("%s,%d,%f,%f,%f,%f",
+			strings.TrimSuffix(field, "_avg"), len(values), mean, min, max, dev))
+	}
+	out := "measure,tests,mean,min,max,dev\n" + strings.Join(lines, "\n") + "\n"
+	err = ioutil.WriteFile(fmt.Sprintf("test_data/%s_summary.csv", name), []byte(out), 0660)
+	if err != nil {
+		return xerrors.Errorf("writing summary: %v", err)
+	}
+	return nil
+}
+
+// summarize returns the mean, minimum, maximum and standard deviation of the
+// values.
+func summarize(values []float64) (mean, min, max, dev float64) {
+	min, max = math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		mean += v
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		dev += (v - mean) * (v - mean)
+	}
+	dev = math.Sqrt(dev / float64(len(values)))
+	return
+}
@@ -0,0 +1,100 @@
+package simul
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/simul/platform"
+)
+
+// sweepPlatform is a platform doing nothing, able to run in parallel.
+type sweepPlatform struct {
+	replicas *[]int
+	torn     *int
+	sync.Mutex
+}
+
+func (p *sweepPlatform) Configure(*platform.Config)       {}
+func (p *sweepPlatform) Build(string, ...string) error    { return nil }
+func (p *sweepPlatform) Cleanup() error                   { return nil }
+func (p *sweepPlatform) Deploy(*platform.RunConfig) error { return nil }
+func (p *sweepPlatform) Start(...string) error            { return nil }
+func (p *sweepPlatform) Wait() error {
+	time.Sleep(10 * time.Millisecond)
+	return nil
+}
+
+func (p *sweepPlatform) Teardown() error {
+	p.Lock()
+	defer p.Unlock()
+	*p.torn++
+	return nil
+}
+
+func (p *sweepPlatform) Replica(slot int, pc *platform.Config) (platform.Platform, error) {
+	p.Lock()
+	defer p.Unlock()
+	*p.replicas = append(*p.replicas, pc.MonitorPort)
+	return &sweepPlatform{replicas: p.replicas, torn: p.torn}, nil
+}
+
+func TestRunParallel(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+	mkTestDir()
+
+	var rcs []*platform.RunConfig
+	for i := 0; i < 5; i++ {
+		rc := platform.NewRunConfig()
+		rc.Put("hosts", strconv.Itoa(i+2))
+		rc.Put("bf", "2")
+		rc.Put("depth", "2")
+		rcs = append(rcs, rc)
+	}
+	var ports []int
+	var torn int
+	p := &sweepPlatform{replicas: &ports, torn: &torn}
+	require.NoError(t, runParallel(p, p, "sweep", rcs, 0, 4, 3,
+		os.O_CREATE|os.O_RDWR|os.O_TRUNC))
+	require.Equal(t, []int{monitorPort + 1, monitorPort + 2}, ports)
+
+	out, err := ioutil.ReadFile(generateResultFileName("sweep", 0))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	require.Len(t, lines, 6)
+	require.Equal(t, "hosts,bf,depth", lines[0])
+	for i, line := range lines[1:] {
+		require.True(t, strings.HasPrefix(line, strconv.Itoa(i+2)+","), line)
+	}
+
+	teardown(p)
+	require.Equal(t, 3, torn)
+}
+
+func TestWriteSummary(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+	mkTestDir()
+
+	// no results, no summary
+	require.NoError(t, writeSummary("summary"))
+
+	require.NoError(t, ioutil.WriteFile(generateResultFileName("summary", 0),
+		[]byte("hosts,round_min,round_avg,round_dev\n"+
+			"2,1,1.5,0.1\n4,2,2.5,0.1\n8,3,5,NaN\n"), 0660))
+	require.NoError(t, writeSummary("summary"))
+	out, err := ioutil.ReadFile("test_data/summary_summary.csv")
+	require.NoError(t, err)
+	require.Equal(t, "measure,tests,mean,min,max,dev\n"+
+		"round,3,3.000000,1.500000,5.000000,1.471960\n", string(out))
+}
@@ -1,6 +1,7 @@
 package onet
 
 import (
+	"crypto/cipher"
 	"io/ioutil"
 	"net"
 	"os"
@@ -114,6 +115,13 @@ func LoadSimulationConfig(s, dir, ca string) ([]*SimulationConfig, error) {
 	}
 
 	scf := msg.(*SimulationConfigFile)
+	det := &simulationDeterministic{}
+	if _, err := toml.Decode(scf.Config, det); err != nil {
+		return nil, xerrors.Errorf("decoding config: %v", err)
+	}
+	if det.Deterministic {
+		SetSeed(det.Seed)
+	}
 	sc := &SimulationConfig{
 		Roster:      scf.Roster,
 		PrivateKeys: scf.PrivateKeys,
@@ -145,7 +153,14 @@ func LoadSimulationConfig(s, dir, ca string) ([]*SimulationConfig, error) {
 					e.ServiceIdentities[i] = network.NewServiceIdentity(sid.Name, suite, sid.Public, privkey)
 				}
 
-				server := NewServerTCP(e, suite)
+				serverSuite := network.Suite(suite)
+				if det.Deterministic {
+					serverSuite = NewSeededSuite(suite, det.Seed, e.Address.String())
+				}
+				server := NewServerTCP(e, serverSuite)
+				if det.Deterministic {
+					server.SetClock(NewVirtualClock(SimulationEpoch))
+				}
 				server.UnauthOk = true
 				server.Quiet = true
 				scNew := *sc
@@ -176,6 +191,17 @@ func LoadSimulationConfig(s, dir, ca string) ([]*SimulationConfig, error) {
 	return ret, nil
 }
 
+// SimulationEpoch is the start of the virtual clocks of the deterministic
+// simulations.
+var SimulationEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// simulationDeterministic are the variables of the configuration of a
+// simulation making it deterministic, see SimulationBFTree.
+type simulationDeterministic struct {
+	Deterministic bool
+	Seed          int64
+}
+
 // Save takes everything in the SimulationConfig structure and saves it to
 // dir + SimulationFileName
 func (sc *SimulationConfig) Save(dir string) error {
@@ -243,6 +269,10 @@ type SimulationBFTree struct {
 	Suite      string
 	PreScript  string // executable script to run before the simulation on each machine
 	TLS        bool   // tells if using TLS or PlainTCP addresses
+	// Deterministic picks the keys of the conodes from Seed, and runs the
+	// simulation with SetSeed and a VirtualClock on every server
+	Deterministic bool
+	Seed          int64
 }
 
 // CreateRoster creates an Roster with the host-names in 'addresses'.
@@ -278,7 +308,14 @@ func (s *SimulationBFTree) CreateRoster(sc *SimulationConfig, addresses []string
 	}
 	entities := make([]*network.ServerIdentity, hosts)
 	log.Lvl3("Doing", hosts, "hosts")
-	key := key.NewKeyPair(suite)
+	keySuite := key.Suite(suite)
+	var stream cipher.Stream
+	if s.Deterministic {
+		seeded := NewSeededSuite(suite, s.Seed, "roster")
+		keySuite = seeded
+		stream = seeded.RandomStream()
+	}
+	key := key.NewKeyPair(keySuite)
 	for c := 0; c < hosts; c++ {
 		key.Private.Add(key.Private, suite.Scalar().One())
 		key.Public.Add(key.Public, suite.Point().Base())
@@ -318,7 +355,7 @@ func (s *SimulationBFTree) CreateRoster(sc *SimulationConfig, addresses []string
 		}
 		entities[c] = network.NewServerIdentity(key.Public.Clone(), add)
 		entities[c].SetPrivate(key.Private)
-		ServiceFactory.generateKeyPairs(entities[c])
+		ServiceFactory.generateKeyPairsFrom(entities[c], stream)
 
 		privConf := newSimulationPrivateKey(key.Private.Clone())
 		sc.PrivateKeys[entities[c].Address] = privConf
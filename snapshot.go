@@ -0,0 +1,283 @@
+package onet
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"strings"
+
+	"go.dedis.ch/onet/v3/log"
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+// SnapshotFilter selects the services whose buckets are part of a snapshot
+// or of a restore. The buckets not belonging to a service, like the one
+// telling whether the database is encrypted, are always part of a snapshot.
+type SnapshotFilter struct {
+	// Include, if not empty, lists the only services taken.
+	Include []string `toml:",omitempty"`
+	// Exclude lists the services not taken.
+	Exclude []string `toml:",omitempty"`
+}
+
+// empty returns whether the filter takes all the services.
+func (f SnapshotFilter) empty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// takes returns whether the filter takes the service.
+func (f SnapshotFilter) takes(service string) bool {
+	for _, s := range f.Exclude {
+		if s == service {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, s := range f.Include {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// StorageRestore restores the database of the services from a snapshot when
+// the conode starts. A snapshot is only restored once: the conode remembers
+// the last one, so that the option can stay in the configuration.
+type StorageRestore struct {
+	// Path is the snapshot, as written by Server.Snapshot or Server.Backup.
+	Path string
+	// Filter selects the services restored. The data of the other services
+	// is kept. If it is empty, the whole database is replaced.
+	Filter SnapshotFilter
+}
+
+// bucketService returns the service owning the bucket, or an empty string
+// for the buckets of onet. A bucket belongs to the service with the longest
+// name among those it is the bucket, the version bucket or an additional
+// bucket of.
+func bucketService(bucket string) string {
+	var owner string
+	for _, n := range ServiceFactory.RegisteredServiceNames() {
+		if bucket == n || bucket == n+"version" || strings.HasPrefix(bucket, n+"_") {
+			if len(n) > len(owner) {
+				owner = n
+			}
+		}
+	}
+	return owner
+}
+
+// unwrapStore returns the store holding the data as written on the disk,
+// i.e., still encrypted and with the checksums.
+func unwrapStore(s Store) Store {
+	if is, ok := s.(*integrityStore); ok {
+		s = is.Store
+	}
+	if es, ok := s.(*encryptedStore); ok {
+		return es.Store
+	}
+	return s
+}
+
+// Snapshot writes a consistent copy of the buckets of the services taken by
+// the filter to path, as a bbolt database, while the conode keeps running. If
+// the database is encrypted, the snapshot is too. The snapshot can be
+// restored with ServerOptions.Restore.
+func (c *Server) Snapshot(path string, filter SnapshotFilter) error {
+	raw := unwrapStore(c.serviceManager.store)
+	if filter.empty() {
+		if err := raw.Backup(path); err != nil {
+			return xerrors.Errorf("copying database: %v", err)
+		}
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("removing old file: %v", err)
+	}
+	db, err := openDb(path)
+	if err != nil {
+		return err
+	}
+	err = raw.View(func(tx StoreTx) error {
+		return db.Update(func(btx *bbolt.Tx) error {
+			return tx.ForEach(func(name []byte, b StoreBucket) error {
+				if s := bucketService(string(name)); s != "" && !filter.takes(s) {
+					return nil
+				}
+				bb, err := btx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return b.ForEach(bb.Put)
+			})
+		})
+	})
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return xerrors.Errorf("copying database: %v", err)
+	}
+	return nil
+}
+
+// Snapshot writes a consistent copy of the buckets of the services taken by
+// the filter to path, see Server.Snapshot.
+func (c *Context) Snapshot(path string, filter SnapshotFilter) error {
+	return c.server.Snapshot(path, filter)
+}
+
+// restoreBucket holds the hash of the last snapshot restored.
+var restoreBucket = []byte("onet_restore")
+
+var restoreLast = []byte("last")
+
+// restoreSnapshot copies the buckets of the services taken by the filter
+// from the snapshot to the store, as written on the disk, replacing their
+// content.
+func restoreSnapshot(store Store, r StorageRestore) error {
+	hash, err := fileHash(r.Path)
+	if err != nil {
+		return xerrors.Errorf("reading snapshot: %v", err)
+	}
+	var done bool
+	err = store.View(func(tx StoreTx) error {
+		if b := tx.Bucket(restoreBucket); b != nil {
+			done = string(b.Get(restoreLast)) == string(hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("tx error: %v", err)
+	}
+	if done {
+		log.Lvl2("Snapshot", r.Path, "already restored")
+		return nil
+	}
+
+	snap, err := bbolt.Open(r.Path, 0600, &bbolt.Options{ReadOnly: true})
+	if err != nil {
+		return xerrors.Errorf("opening snapshot: %v", err)
+	}
+	defer snap.Close()
+	err = snap.View(func(stx *bbolt.Tx) error {
+		return store.Update(func(tx StoreTx) error {
+			return restoreBuckets(boltTx{stx}, tx, r.Filter, hash)
+		})
+	})
+	if err != nil {
+		return xerrors.Errorf("restoring: %v", err)
+	}
+	log.Lvl1("Restored snapshot", r.Path)
+	return nil
+}
+
+// restoreBuckets replaces the buckets taken by the filter in dst by the ones
+// of src, and records the hash of the snapshot.
+func restoreBuckets(src, dst StoreTx, filter SnapshotFilter, hash []byte) error {
+	taken := func(name []byte) bool {
+		s := bucketService(string(name))
+		if s == "" {
+			return filter.empty()
+		}
+		return filter.takes(s)
+	}
+	if !filter.empty() {
+		if err := restoreEncryption(src, dst, taken); err != nil {
+			return err
+		}
+	}
+
+	var old [][]byte
+	err := dst.ForEach(func(name []byte, b StoreBucket) error {
+		if taken(name) {
+			old = append(old, append([]byte{}, name...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range old {
+		if err := dst.DeleteBucket(name); err != nil {
+			return xerrors.Errorf("deleting %s: %v", name, err)
+		}
+	}
+	err = src.ForEach(func(name []byte, b StoreBucket) error {
+		if !taken(name) || string(name) == string(restoreBucket) {
+			return nil
+		}
+		db, err := dst.CreateBucketIfNotExists(name)
+		if err != nil {
+			return xerrors.Errorf("creating %s: %v", name, err)
+		}
+		return b.ForEach(db.Put)
+	})
+	if err != nil {
+		return err
+	}
+	// the checksums are computed again for the restored data
+	if dst.Bucket(integrityRoots) != nil {
+		if err := dst.DeleteBucket(integrityRoots); err != nil {
+			return xerrors.Errorf("deleting %s: %v", integrityRoots, err)
+		}
+	}
+	rb, err := dst.CreateBucketIfNotExists(restoreBucket)
+	if err != nil {
+		return xerrors.Errorf("creating %s: %v", restoreBucket, err)
+	}
+	return rb.Put(restoreLast, hash)
+}
+
+// restoreEncryption makes sure the data kept by a partial restore is
+// encrypted like the restored one. If no data is kept, the database follows
+// the snapshot.
+func restoreEncryption(src, dst StoreTx, taken func([]byte) bool) error {
+	srcEnc := src.Bucket(encryptionBucket)
+	dstEnc := dst.Bucket(encryptionBucket)
+	if (srcEnc != nil) == (dstEnc != nil) {
+		return nil
+	}
+	var kept bool
+	err := dst.ForEach(func(name []byte, b StoreBucket) error {
+		if taken(name) || bucketService(string(name)) == "" {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			kept = true
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if kept {
+		return xerrors.New("only one of the snapshot and the database is encrypted")
+	}
+	if dstEnc != nil {
+		return dst.DeleteBucket(encryptionBucket)
+	}
+	b, err := dst.CreateBucketIfNotExists(encryptionBucket)
+	if err != nil {
+		return xerrors.Errorf("creating %s: %v", encryptionBucket, err)
+	}
+	return srcEnc.ForEach(b.Put)
+}
+
+func fileHash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
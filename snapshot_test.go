@@ -0,0 +1,93 @@
+package onet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/onet/v3/network"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// newStorageServer starts a server keeping its database in the directory
+// given by CONODE_SERVICE_PATH.
+func newStorageServer(t *testing.T, priv kyber.Scalar, id *network.ServerIdentity,
+	opts ServerOptions) *Server {
+	router, err := network.NewLocalRouter(id, tSuite)
+	require.NoError(t, err)
+	c := newServerWithOptions(tSuite, "", router, priv, opts)
+	c.StartInBackground()
+	return c
+}
+
+func serviceContext(c *Server, name string) *Context {
+	return c.serviceManager.contexts[ServiceFactory.ServiceID(name)]
+}
+
+func TestServer_SnapshotRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	old := os.Getenv("CONODE_SERVICE_PATH")
+	defer os.Setenv("CONODE_SERVICE_PATH", old)
+	require.NoError(t, os.Setenv("CONODE_SERVICE_PATH", filepath.Join(dir, "a")))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "a"), 0750))
+
+	priv, id := NewPrivIdentity(tSuite, 0)
+	c := newStorageServer(t, priv, id, ServerOptions{})
+	require.NoError(t, serviceContext(c, serviceWebSocket).Save([]byte("k"), &SimpleResponse{Val: 1}))
+	require.NoError(t, serviceContext(c, clientServiceName).Save([]byte("k"), &SimpleResponse{Val: 2}))
+	snap := filepath.Join(dir, "snapshot.db")
+	require.NoError(t, serviceContext(c, serviceWebSocket).Snapshot(snap,
+		SnapshotFilter{Include: []string{serviceWebSocket}}))
+	require.NoError(t, c.Close())
+
+	db, err := bbolt.Open(snap, 0600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.View(func(tx *bbolt.Tx) error {
+		require.NotNil(t, tx.Bucket([]byte(serviceWebSocket)))
+		require.Nil(t, tx.Bucket([]byte(clientServiceName)))
+		return nil
+	}))
+	require.NoError(t, db.Close())
+
+	// the snapshot replaces the data of the service it holds
+	require.NoError(t, os.Setenv("CONODE_SERVICE_PATH", filepath.Join(dir, "b")))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "b"), 0750))
+	c = newStorageServer(t, priv, id, ServerOptions{})
+	require.NoError(t, serviceContext(c, serviceWebSocket).Save([]byte("k"), &SimpleResponse{Val: 3}))
+	require.NoError(t, serviceContext(c, clientServiceName).Save([]byte("k"), &SimpleResponse{Val: 4}))
+	require.NoError(t, c.Close())
+	restore := ServerOptions{Restore: &StorageRestore{Path: snap,
+		Filter: SnapshotFilter{Exclude: []string{clientServiceName}}}}
+	c = newStorageServer(t, priv, id, restore)
+	load := func(name string) int64 {
+		msg, err := serviceContext(c, name).Load([]byte("k"))
+		require.NoError(t, err)
+		return msg.(*SimpleResponse).Val
+	}
+	require.Equal(t, int64(1), load(serviceWebSocket))
+	require.Equal(t, int64(4), load(clientServiceName))
+
+	// it isn't restored again at the next start
+	require.NoError(t, serviceContext(c, serviceWebSocket).Save([]byte("k"), &SimpleResponse{Val: 5}))
+	require.NoError(t, c.Close())
+	c = newStorageServer(t, priv, id, restore)
+	require.Equal(t, int64(5), load(serviceWebSocket))
+
+	// an encrypted snapshot can't be mixed with unencrypted data
+	encSnap := filepath.Join(dir, "encrypted.db")
+	require.NoError(t, c.Close())
+	c = newStorageServer(t, priv, id, ServerOptions{StorageEncryption: &StorageEncryption{}})
+	require.Equal(t, int64(5), load(serviceWebSocket))
+	require.NoError(t, c.Snapshot(encSnap, SnapshotFilter{Include: []string{serviceWebSocket}}))
+	require.NoError(t, c.Close())
+	require.NoError(t, os.Setenv("CONODE_SERVICE_PATH", filepath.Join(dir, "a")))
+	require.Panics(t, func() {
+		newStorageServer(t, priv, id, ServerOptions{Restore: &StorageRestore{Path: encSnap,
+			Filter: SnapshotFilter{Include: []string{serviceWebSocket}}}})
+	})
+}
@@ -0,0 +1,35 @@
+module go.dedis.ch/onet/v3/sqlitestore
+
+go 1.21
+
+require (
+	go.dedis.ch/onet/v3 v3.2.10
+	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2
+	modernc.org/sqlite v1.34.5
+)
+
+require (
+	github.com/BurntSushi/toml v0.3.1 // indirect
+	github.com/daviddengcn/go-colortext v0.0.0-20180409174941-186a3d44e920 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/gorilla/websocket v1.4.0 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	go.dedis.ch/fixbuf v1.0.3 // indirect
+	go.dedis.ch/kyber/v3 v3.0.12 // indirect
+	go.dedis.ch/protobuf v1.0.11 // indirect
+	go.etcd.io/bbolt v1.3.3 // indirect
+	golang.org/x/crypto v0.32.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	gopkg.in/satori/go.uuid.v1 v1.2.0 // indirect
+	gopkg.in/tylerb/graceful.v1 v1.2.15 // indirect
+	modernc.org/libc v1.55.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+	rsc.io/goversion v1.2.0 // indirect
+)
+
+replace go.dedis.ch/onet/v3 => ../
@@ -0,0 +1,292 @@
+// Package sqlitestore is a backend of the onet Store keeping the data in a
+// SQLite database, with the driver of modernc.org/sqlite, which doesn't need
+// cgo. It is a module of its own, so that onet doesn't depend on SQLite. A
+// conode uses it by importing the package:
+//
+//	import _ "go.dedis.ch/onet/v3/sqlitestore"
+//
+// and setting StorageBackend = "sqlite" in its private.toml.
+//
+// The database is in WAL mode: the read-only transactions run concurrently
+// with the read-write one, which are serialized.
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"go.dedis.ch/onet/v3"
+	"golang.org/x/xerrors"
+	// registers the driver
+	_ "modernc.org/sqlite"
+)
+
+// Backend is the name of the backend, for the StorageBackend of the conode.
+const Backend = "sqlite"
+
+func init() {
+	if err := onet.RegisterStoreBackend(Backend, Open); err != nil {
+		panic(err)
+	}
+}
+
+// iterationBatch is the number of pairs read at once by ForEach.
+const iterationBatch = 1000
+
+var errTxNotWritable = xerrors.New("transaction not writable")
+
+// The values are in the pairs table, and the buckets are listed in the
+// buckets table, so that an empty bucket exists.
+const schema = `
+CREATE TABLE IF NOT EXISTS buckets (name BLOB PRIMARY KEY) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS pairs (
+	bucket BLOB NOT NULL,
+	key BLOB NOT NULL,
+	value BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+) WITHOUT ROWID;
+`
+
+// Store is the onet.Store of a SQLite database.
+type Store struct {
+	db     *sql.DB
+	writes sync.Mutex
+}
+
+// Open opens the database file at path, creating it if needed. The writes
+// are synced to the disk when their transaction commits.
+func Open(path string) (onet.Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+
+		"?_pragma=journal_mode(WAL)&_pragma=synchronous(FULL)"+
+		"&_pragma=busy_timeout(10000)&_txlock=immediate")
+	if err != nil {
+		return nil, xerrors.Errorf("opening sqlite: %v", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, xerrors.Errorf("creating tables: %v", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// View implements onet.Store.
+func (s *Store) View(fn func(tx onet.StoreTx) error) error {
+	sqlTx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+	return run(fn, &tx{tx: sqlTx})
+}
+
+// Update implements onet.Store.
+func (s *Store) Update(fn func(tx onet.StoreTx) error) error {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+	sqlTx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := run(fn, &tx{tx: sqlTx, writable: true}); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// run calls fn, returning the first error of the reads of the transaction if
+// fn doesn't fail.
+func run(fn func(tx onet.StoreTx) error, t *tx) error {
+	if err := fn(t); err != nil {
+		return err
+	}
+	return t.err
+}
+
+// Size implements onet.Store.
+func (s *Store) Size() (int64, error) {
+	var size int64
+	err := s.db.QueryRow("SELECT page_count * page_size " +
+		"FROM pragma_page_count(), pragma_page_size()").Scan(&size)
+	return size, err
+}
+
+// Backup implements onet.Store.
+func (s *Store) Backup(path string) error {
+	return onet.WriteBoltBackup(s, path)
+}
+
+// Close implements onet.Store.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+type tx struct {
+	tx       *sql.Tx
+	writable bool
+	// the first error of the reads not returning one, failing the
+	// transaction
+	err error
+}
+
+func (t *tx) fail(err error) {
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+func (t *tx) exists(name []byte) bool {
+	var one int
+	err := t.tx.QueryRow("SELECT 1 FROM buckets WHERE name = ?", name).Scan(&one)
+	if err != nil && err != sql.ErrNoRows {
+		t.fail(xerrors.Errorf("reading bucket %s: %v", name, err))
+	}
+	return err == nil
+}
+
+func (t *tx) Bucket(name []byte) onet.StoreBucket {
+	if !t.exists(name) {
+		return nil
+	}
+	return &bucket{tx: t, name: append([]byte{}, name...)}
+}
+
+func (t *tx) CreateBucketIfNotExists(name []byte) (onet.StoreBucket, error) {
+	if !t.exists(name) {
+		if !t.writable {
+			return nil, errTxNotWritable
+		}
+		if len(name) == 0 {
+			return nil, xerrors.New("bucket name required")
+		}
+		if _, err := t.tx.Exec("INSERT INTO buckets (name) VALUES (?)", name); err != nil {
+			return nil, err
+		}
+	}
+	return &bucket{tx: t, name: append([]byte{}, name...)}, nil
+}
+
+func (t *tx) DeleteBucket(name []byte) error {
+	if !t.writable {
+		return errTxNotWritable
+	}
+	if !t.exists(name) {
+		return xerrors.New("bucket not found")
+	}
+	if _, err := t.tx.Exec("DELETE FROM pairs WHERE bucket = ?", name); err != nil {
+		return err
+	}
+	_, err := t.tx.Exec("DELETE FROM buckets WHERE name = ?", name)
+	return err
+}
+
+func (t *tx) ForEach(fn func(name []byte, b onet.StoreBucket) error) error {
+	// fn may change the buckets
+	rows, err := t.tx.Query("SELECT name FROM buckets ORDER BY name")
+	if err != nil {
+		return err
+	}
+	var names [][]byte
+	for rows.Next() {
+		var name []byte
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := fn(name, &bucket{tx: t, name: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type bucket struct {
+	tx   *tx
+	name []byte
+}
+
+func (b *bucket) Get(key []byte) []byte {
+	var v []byte
+	err := b.tx.tx.QueryRow("SELECT value FROM pairs WHERE bucket = ? AND key = ?",
+		b.name, key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		b.tx.fail(xerrors.Errorf("reading %x: %v", key, err))
+		return nil
+	}
+	if v == nil {
+		// an empty value is not a missing one
+		v = []byte{}
+	}
+	return v
+}
+
+func (b *bucket) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return errTxNotWritable
+	}
+	if len(key) == 0 {
+		return xerrors.New("key required")
+	}
+	// a nil value would be NULL
+	_, err := b.tx.tx.Exec("INSERT OR REPLACE INTO pairs (bucket, key, value) "+
+		"VALUES (?, ?, ?)", b.name, key, append([]byte{}, value...))
+	return err
+}
+
+func (b *bucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return errTxNotWritable
+	}
+	_, err := b.tx.tx.Exec("DELETE FROM pairs WHERE bucket = ? AND key = ?", b.name, key)
+	return err
+}
+
+// ForEach reads the pairs in batches, so that fn can write in the
+// transaction.
+func (b *bucket) ForEach(fn func(k, v []byte) error) error {
+	// the keys aren't empty
+	after := []byte{}
+	for {
+		rows, err := b.tx.tx.Query("SELECT key, value FROM pairs "+
+			"WHERE bucket = ? AND key > ? ORDER BY key LIMIT ?",
+			b.name, after, iterationBatch)
+		if err != nil {
+			return err
+		}
+		var keys, values [][]byte
+		for rows.Next() {
+			var k, v []byte
+			if err := rows.Scan(&k, &v); err != nil {
+				rows.Close()
+				return err
+			}
+			if v == nil {
+				v = []byte{}
+			}
+			keys = append(keys, k)
+			values = append(values, v)
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		for i := range keys {
+			if err := fn(keys[i], values[i]); err != nil {
+				return err
+			}
+		}
+		if len(keys) < iterationBatch {
+			return nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
@@ -0,0 +1,16 @@
+package sqlitestore
+
+import (
+	"testing"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestStore(t *testing.T) {
+	onet.CheckStoreBackend(t, Open, true)
+}
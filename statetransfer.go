@@ -0,0 +1,342 @@
+package onet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// StateTransferer is implemented by the services that let a new member of
+// their roster fetch their storage from an existing member, with
+// Server.FetchServiceState. Both conodes must run the service.
+type StateTransferer interface {
+	// AuthorizeStateTransfer is called on the conode sending its storage,
+	// with the conode asking for it. The transfer is refused if it returns
+	// an error.
+	AuthorizeStateTransfer(si *network.ServerIdentity) error
+	// VerifyStateTransfer is called on the conode fetching the storage, with
+	// the export of the buckets of the service sent by si, see ReadExport.
+	// Nothing is stored if it returns an error.
+	VerifyStateTransfer(si *network.ServerIdentity, export []byte) error
+}
+
+// StateTransferTimeout is how long FetchServiceState waits for the next part
+// of the storage before giving up.
+var StateTransferTimeout = time.Minute
+
+// stateTransferChunkSize is the size of the parts in which the storage is
+// sent.
+const stateTransferChunkSize = 1 << 20
+
+// StateTransferRequest asks a conode for the storage of a service. It is
+// signed by the conode asking for it.
+type StateTransferRequest struct {
+	Service string
+	// Nonce identifies the transfer.
+	Nonce []byte
+	// Timestamp is the time of signing in nanoseconds since the epoch.
+	Timestamp int64
+	Signature []byte
+}
+
+// StateTransferChunk is a part of the storage of a service, sent in answer to
+// a StateTransferRequest. The last part holds the signature of the sending
+// conode on the whole storage, or the error that stopped the transfer.
+type StateTransferChunk struct {
+	Nonce     []byte
+	Data      []byte
+	Last      bool
+	Signature []byte
+	Error     string
+}
+
+var (
+	stateTransferRequestID = network.RegisterMessage(&StateTransferRequest{})
+	stateTransferChunkID   = network.RegisterMessage(&StateTransferChunk{})
+)
+
+// stateTransferRequestDigest is the message signed in a StateTransferRequest
+// sent to dst.
+func stateTransferRequestDigest(dst network.ServerIdentityID, service string,
+	nonce []byte, timestamp int64) []byte {
+	h := sha256.New()
+	h.Write([]byte("onet-state-transfer-request"))
+	h.Write(dst[:])
+	h.Write([]byte(service))
+	h.Write(nonce)
+	binary.Write(h, binary.BigEndian, timestamp)
+	return h.Sum(nil)
+}
+
+// stateTransferDigest is the message signed by the conode sending the export
+// of the service to dst.
+func stateTransferDigest(dst network.ServerIdentityID, service string, nonce,
+	export []byte) []byte {
+	sum := sha256.Sum256(export)
+	h := sha256.New()
+	h.Write([]byte("onet-state-transfer"))
+	h.Write(dst[:])
+	h.Write([]byte(service))
+	h.Write(nonce)
+	h.Write(sum[:])
+	return h.Sum(nil)
+}
+
+// stateTransfers holds the transfers waiting for their chunks, indexed by
+// their hex-encoded nonce.
+type stateTransfers struct {
+	sync.Mutex
+	pending map[string]chan *StateTransferChunk
+}
+
+// registerStateTransfer lets the server answer the StateTransferRequests and
+// receive the chunks of its own.
+func (c *Server) registerStateTransfer() {
+	c.stateTransfers = &stateTransfers{pending: make(map[string]chan *StateTransferChunk)}
+	c.RegisterProcessorFunc(stateTransferRequestID, func(env *network.Envelope) error {
+		req, ok := env.Msg.(*StateTransferRequest)
+		if !ok {
+			return xerrors.New("invalid state transfer request")
+		}
+		// the export and the sending must not block the dispatcher
+		go c.sendServiceState(env.ServerIdentity, req)
+		return nil
+	})
+	c.RegisterProcessorFunc(stateTransferChunkID, func(env *network.Envelope) error {
+		chunk, ok := env.Msg.(*StateTransferChunk)
+		if !ok {
+			return xerrors.New("invalid state transfer chunk")
+		}
+		c.stateTransfers.Lock()
+		ch, ok := c.stateTransfers.pending[hex.EncodeToString(chunk.Nonce)]
+		c.stateTransfers.Unlock()
+		if !ok {
+			return xerrors.Errorf("unknown state transfer from %s", env.ServerIdentity)
+		}
+		select {
+		case ch <- chunk:
+		case <-time.After(StateTransferTimeout):
+			return xerrors.New("state transfer abandoned")
+		}
+		return nil
+	})
+}
+
+// stateTransferContext returns the context of the service, if it implements
+// StateTransferer.
+func (c *Server) stateTransferContext(service string) (*Context, StateTransferer, error) {
+	c.serviceManager.servicesMutex.Lock()
+	id := ServiceFactory.ServiceID(service)
+	ctx, ok := c.serviceManager.contexts[id]
+	svc := c.serviceManager.services[id]
+	c.serviceManager.servicesMutex.Unlock()
+	if !ok {
+		return nil, nil, xerrors.Errorf("unknown service %s", service)
+	}
+	st, ok := svc.(StateTransferer)
+	if !ok {
+		return nil, nil, xerrors.Errorf("service %s doesn't transfer its state", service)
+	}
+	return ctx, st, nil
+}
+
+// sendServiceState answers a StateTransferRequest of si with the export of
+// the service, or with the error refusing it.
+func (c *Server) sendServiceState(si *network.ServerIdentity, req *StateTransferRequest) {
+	chunks, err := c.serviceStateChunks(si, req)
+	if err != nil {
+		log.Warnf("Refusing the state of %s to %s: %v", req.Service, si, err)
+		chunks = []*StateTransferChunk{{Last: true, Error: err.Error()}}
+	}
+	for _, chunk := range chunks {
+		chunk.Nonce = req.Nonce
+		if _, err := c.Send(si, chunk); err != nil {
+			log.Errorf("Sending the state of %s to %s: %v", req.Service, si, err)
+			return
+		}
+	}
+	log.Lvlf2("%s sent the state of %s to %s", c.ServerIdentity, req.Service, si)
+}
+
+// serviceStateChunks checks the request of si and returns the signed export
+// of the service, cut in chunks.
+func (c *Server) serviceStateChunks(si *network.ServerIdentity,
+	req *StateTransferRequest) ([]*StateTransferChunk, error) {
+	diff := time.Since(time.Unix(0, req.Timestamp))
+	if diff > SignedRequestWindow || -diff > SignedRequestWindow {
+		return nil, xerrors.New("timestamp outside of the allowed window")
+	}
+	digest := stateTransferRequestDigest(c.ServerIdentity.ID, req.Service,
+		req.Nonce, req.Timestamp)
+	if err := schnorr.Verify(c.suite, si.Public, digest, req.Signature); err != nil {
+		return nil, xerrors.Errorf("invalid signature: %v", err)
+	}
+	ctx, st, err := c.stateTransferContext(req.Service)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.AuthorizeStateTransfer(si); err != nil {
+		return nil, xerrors.Errorf("not authorized: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := ctx.Export(&buf); err != nil {
+		return nil, err
+	}
+	export := buf.Bytes()
+	sig, err := schnorr.Sign(c.suite, c.private,
+		stateTransferDigest(si.ID, req.Service, req.Nonce, export))
+	if err != nil {
+		return nil, xerrors.Errorf("signing: %v", err)
+	}
+	var chunks []*StateTransferChunk
+	for len(export) > stateTransferChunkSize {
+		chunks = append(chunks, &StateTransferChunk{Data: export[:stateTransferChunkSize]})
+		export = export[stateTransferChunkSize:]
+	}
+	return append(chunks, &StateTransferChunk{Data: export, Last: true, Signature: sig}), nil
+}
+
+// FetchServiceState replaces the storage of the service with the one of the
+// conode si, which is meant for a conode joining the roster of the service.
+// The service must implement StateTransferer on both conodes: si checks that
+// this conode may fetch its storage, and this conode that the storage is
+// valid, before storing it. The request and the storage are signed by the
+// conodes. As the service is already running, it has to reload the data it
+// keeps in memory afterwards.
+func (c *Server) FetchServiceState(service string, si *network.ServerIdentity) error {
+	ctx, st, err := c.stateTransferContext(service)
+	if err != nil {
+		return err
+	}
+	req := &StateTransferRequest{
+		Service:   service,
+		Nonce:     make([]byte, 32),
+		Timestamp: time.Now().UnixNano(),
+	}
+	if err := randomRead(req.Nonce); err != nil {
+		return xerrors.Errorf("creating nonce: %v", err)
+	}
+	req.Signature, err = schnorr.Sign(c.suite, c.private,
+		stateTransferRequestDigest(si.ID, service, req.Nonce, req.Timestamp))
+	if err != nil {
+		return xerrors.Errorf("signing: %v", err)
+	}
+
+	ch := make(chan *StateTransferChunk)
+	key := hex.EncodeToString(req.Nonce)
+	c.stateTransfers.Lock()
+	c.stateTransfers.pending[key] = ch
+	c.stateTransfers.Unlock()
+	defer func() {
+		c.stateTransfers.Lock()
+		delete(c.stateTransfers.pending, key)
+		c.stateTransfers.Unlock()
+	}()
+	if _, err := c.Send(si, req); err != nil {
+		return xerrors.Errorf("sending request: %v", err)
+	}
+
+	var export []byte
+	for {
+		var chunk *StateTransferChunk
+		select {
+		case chunk = <-ch:
+		case <-time.After(StateTransferTimeout):
+			return xerrors.Errorf("timeout while fetching the state of %s from %s",
+				service, si)
+		}
+		if chunk.Error != "" {
+			return xerrors.Errorf("%s refused the transfer: %s", si, chunk.Error)
+		}
+		export = append(export, chunk.Data...)
+		if chunk.Last {
+			digest := stateTransferDigest(c.ServerIdentity.ID, service, req.Nonce, export)
+			if err := schnorr.Verify(c.suite, si.Public, digest, chunk.Signature); err != nil {
+				return xerrors.Errorf("invalid signature of the state: %v", err)
+			}
+			break
+		}
+	}
+
+	if err := st.VerifyStateTransfer(si, export); err != nil {
+		return xerrors.Errorf("verifying state: %v", err)
+	}
+	if err := ctx.importState(export); err != nil {
+		return err
+	}
+	log.Lvlf2("%s fetched the state of %s from %s", c.ServerIdentity, service, si)
+	return nil
+}
+
+// importState replaces the buckets of the service with the ones of the
+// export, in one transaction.
+func (c *Context) importState(export []byte) error {
+	name := string(c.bucketName)
+	err := c.manager.store.Update(func(tx StoreTx) error {
+		var old [][]byte
+		err := tx.ForEach(func(bn []byte, _ StoreBucket) error {
+			if bucketService(string(bn)) == name {
+				old = append(old, append([]byte{}, bn...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, bn := range old {
+			if err := tx.DeleteBucket(bn); err != nil {
+				return xerrors.Errorf("deleting bucket: %v", err)
+			}
+		}
+		if err := clearServiceTTLs(tx, name); err != nil {
+			return xerrors.Errorf("removing TTLs: %v", err)
+		}
+		return ReadExport(bytes.NewReader(export), func(bucket, key, value []byte) error {
+			if bucketService(string(bucket)) != name {
+				return xerrors.Errorf("bucket %s doesn't belong to %s", bucket, name)
+			}
+			b, err := tx.CreateBucketIfNotExists(bucket)
+			if err != nil {
+				return xerrors.Errorf("creating bucket: %v", err)
+			}
+			return b.Put(key, value)
+		})
+	})
+	if err != nil {
+		return xerrors.Errorf("storing state of %s: %v", name, err)
+	}
+	return c.updateStorageUsage()
+}
+
+// clearServiceTTLs removes the expiries of the keys of the service.
+func clearServiceTTLs(tx StoreTx, service string) error {
+	expiries := tx.Bucket(ttlExpiries)
+	if expiries == nil {
+		return nil
+	}
+	var keys [][2][]byte
+	err := expiries.ForEach(func(k, _ []byte) error {
+		bucket, key, err := splitTTLKey(k)
+		if err == nil && bucketService(string(bucket)) == service {
+			keys = append(keys, [2][]byte{append([]byte{}, bucket...), append([]byte{}, key...)})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := clearTTL(tx, k[0], k[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
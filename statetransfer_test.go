@@ -0,0 +1,93 @@
+package onet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+const stateTransferServiceName = "stateTransferService"
+
+type stateTransferService struct {
+	*ServiceProcessor
+	allowed  map[network.ServerIdentityID]bool
+	received []byte
+	reject   bool
+}
+
+func (s *stateTransferService) AuthorizeStateTransfer(si *network.ServerIdentity) error {
+	if !s.allowed[si.ID] {
+		return xerrors.New("not in the roster")
+	}
+	return nil
+}
+
+func (s *stateTransferService) VerifyStateTransfer(si *network.ServerIdentity, export []byte) error {
+	s.received = export
+	if s.reject {
+		return xerrors.New("invalid state")
+	}
+	return nil
+}
+
+func TestServer_FetchServiceState(t *testing.T) {
+	_, err := RegisterNewService(stateTransferServiceName, func(c *Context) (Service, error) {
+		return &stateTransferService{
+			ServiceProcessor: NewServiceProcessor(c),
+			allowed:          make(map[network.ServerIdentityID]bool),
+		}, nil
+	})
+	require.NoError(t, err)
+	defer UnregisterService(stateTransferServiceName)
+
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	servers := l.GenServers(3)
+	services := make([]*stateTransferService, len(servers))
+	for i, s := range servers {
+		services[i] = s.Service(stateTransferServiceName).(*stateTransferService)
+	}
+	services[0].allowed[servers[1].ServerIdentity.ID] = true
+
+	src := serviceContext(servers[0], stateTransferServiceName)
+	require.NoError(t, src.Save([]byte("a"), &SimpleResponse{Val: 1}))
+	require.NoError(t, src.UpdateAdditionalBucket([]byte("extra"), func(b *QuotaBucket) error {
+		return b.Put([]byte("k"), bytes.Repeat([]byte{1}, 3*stateTransferChunkSize/2))
+	}))
+	dst := serviceContext(servers[1], stateTransferServiceName)
+	require.NoError(t, dst.Save([]byte("old"), &SimpleResponse{Val: 2}))
+
+	// the storage isn't kept if the service doesn't accept it
+	services[1].reject = true
+	require.Error(t, servers[1].FetchServiceState(stateTransferServiceName, servers[0].ServerIdentity))
+	require.NotEmpty(t, services[1].received)
+	msg, err := dst.Load([]byte("old"))
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+
+	services[1].reject = false
+	require.NoError(t, servers[1].FetchServiceState(stateTransferServiceName, servers[0].ServerIdentity))
+	msg, err = dst.Load([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), msg.(*SimpleResponse).Val)
+	msg, err = dst.Load([]byte("old"))
+	require.NoError(t, err)
+	require.Nil(t, msg)
+	require.NoError(t, dst.ViewAdditionalBucket([]byte("extra"), func(b StoreBucket) error {
+		require.Len(t, b.Get([]byte("k")), 3*stateTransferChunkSize/2)
+		return nil
+	}))
+	used, _ := dst.StorageUsage()
+	require.True(t, used > stateTransferChunkSize)
+
+	// the source decides who gets its storage
+	err = servers[2].FetchServiceState(stateTransferServiceName, servers[0].ServerIdentity)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not authorized")
+
+	// only the services taking part can be transferred
+	require.Error(t, servers[1].FetchServiceState(serviceWebSocket, servers[0].ServerIdentity))
+}
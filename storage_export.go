@@ -0,0 +1,134 @@
+package onet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+// exportMagic starts the stream written by Context.Export.
+var exportMagic = []byte("onet-export-v1\n")
+
+// Export writes the buckets of the service to w: its own bucket, its version
+// bucket and its additional buckets. The buckets are read in one read-only
+// transaction, so that the export is consistent while the conode keeps
+// running. The values are written as stored by the service, i.e., not
+// encrypted.
+//
+// The stream starts with the line "onet-export-v1", followed by one record per
+// key: the name of the bucket, the key and the value, each one prefixed by its
+// length as an unsigned varint. ReadExport reads it back.
+func (c *Context) Export(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(exportMagic); err != nil {
+		return xerrors.Errorf("writing: %v", err)
+	}
+	name := string(c.bucketName)
+	var lenBuf [binary.MaxVarintLen64]byte
+	write := func(b []byte) error {
+		n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+		if _, err := bw.Write(lenBuf[:n]); err != nil {
+			return err
+		}
+		_, err := bw.Write(b)
+		return err
+	}
+	err := c.manager.store.View(func(tx StoreTx) error {
+		return tx.ForEach(func(bn []byte, b StoreBucket) error {
+			if bucketService(string(bn)) != name {
+				return nil
+			}
+			return b.ForEach(func(k, v []byte) error {
+				// nested buckets
+				if v == nil {
+					return nil
+				}
+				for _, f := range [][]byte{bn, k, v} {
+					if err := write(f); err != nil {
+						return xerrors.Errorf("writing: %v", err)
+					}
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return xerrors.Errorf("exporting %s: %v", name, err)
+	}
+	if err := bw.Flush(); err != nil {
+		return xerrors.Errorf("writing: %v", err)
+	}
+	return nil
+}
+
+// Export writes the buckets of the service with the given name to path, see
+// Context.Export.
+func (c *Server) Export(service, path string) error {
+	c.serviceManager.servicesMutex.Lock()
+	ctx, ok := c.serviceManager.contexts[ServiceFactory.ServiceID(service)]
+	c.serviceManager.servicesMutex.Unlock()
+	if !ok {
+		return xerrors.Errorf("unknown service %s", service)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return xerrors.Errorf("creating file: %v", err)
+	}
+	err = ctx.Export(f)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = xerrors.Errorf("closing file: %v", cerr)
+	}
+	return err
+}
+
+// ReadExport calls fn for every key of a stream written by Context.Export,
+// in order.
+func ReadExport(r io.Reader, fn func(bucket, key, value []byte) error) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(exportMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, exportMagic) {
+		return xerrors.New("not an export of a service")
+	}
+	read := func() ([]byte, error) {
+		l, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if l > uint64(maxExportField) {
+			return nil, xerrors.Errorf("field of %d bytes", l)
+		}
+		b := make([]byte, l)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	for {
+		bucket, err := read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return xerrors.Errorf("reading bucket: %v", err)
+		}
+		key, err := read()
+		if err != nil {
+			return xerrors.Errorf("reading key: %v", err)
+		}
+		value, err := read()
+		if err != nil {
+			return xerrors.Errorf("reading value: %v", err)
+		}
+		if err := fn(bucket, key, value); err != nil {
+			return err
+		}
+	}
+}
+
+// maxExportField is the largest bucket name, key or value read by
+// ReadExport, as bbolt doesn't store bigger values.
+const maxExportField = 1 << 31
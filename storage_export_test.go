@@ -0,0 +1,52 @@
+package onet
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+	bbolt "go.etcd.io/bbolt"
+)
+
+func TestContext_Export(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "conode")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	network.RegisterMessage(ContextData{})
+	c := createContext(t, tmp)
+	require.NoError(t, c.Save([]byte("a"), &ContextData{42, "meaning of life"}))
+	require.NoError(t, c.UpdateAdditionalBucket([]byte("extra"), func(b *QuotaBucket) error {
+		return b.Put([]byte("k"), []byte("v"))
+	}))
+	db, _ := c.GetAdditionalBucket([]byte("raw"))
+	require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("other"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("k"), []byte("v"))
+	}))
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Export(&buf))
+	found := make(map[string][]byte)
+	require.NoError(t, ReadExport(bytes.NewReader(buf.Bytes()),
+		func(bucket, key, value []byte) error {
+			found[string(bucket)+"/"+string(key)] = value
+			return nil
+		}))
+	require.Len(t, found, 2)
+	cd, err := c.LoadRaw([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, cd, found["testService/a"])
+	require.Equal(t, []byte("v"), found["testService_extra/k"])
+
+	require.Error(t, ReadExport(bytes.NewReader([]byte("not an export")),
+		func(bucket, key, value []byte) error { return nil }))
+	require.Error(t, ReadExport(bytes.NewReader(buf.Bytes()[:buf.Len()-1]),
+		func(bucket, key, value []byte) error { return nil }))
+}
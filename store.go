@@ -0,0 +1,461 @@
+package onet
+
+import (
+	"os"
+	"sort"
+	"sync"
+
+	"go.dedis.ch/onet/v3/log"
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+// Store is the key/value database holding the data of the services of a
+// conode. Its data is organized in buckets, the services accessing them
+// through their Context. The backend of the store is chosen with
+// ServerOptions.StorageBackend.
+type Store interface {
+	// View calls fn in a read-only transaction.
+	View(fn func(tx StoreTx) error) error
+	// Update calls fn in a read-write transaction. If fn returns an error,
+	// none of its writes are kept.
+	Update(fn func(tx StoreTx) error) error
+	// Size returns the number of bytes used by the store.
+	Size() (int64, error)
+	// Backup writes a consistent copy of the store to path, as a bbolt
+	// database.
+	Backup(path string) error
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// StoreTx is a transaction of a Store. It is only valid while the function
+// given to View or Update runs.
+type StoreTx interface {
+	// Bucket returns the bucket with the given name, or nil if it doesn't
+	// exist.
+	Bucket(name []byte) StoreBucket
+	// CreateBucketIfNotExists returns the bucket with the given name,
+	// creating it if needed.
+	CreateBucketIfNotExists(name []byte) (StoreBucket, error)
+	// DeleteBucket removes the bucket with the given name and its content.
+	DeleteBucket(name []byte) error
+	// ForEach calls fn for every bucket, in the order of their names.
+	ForEach(fn func(name []byte, b StoreBucket) error) error
+}
+
+// StoreBucket holds key/value pairs in a transaction of a Store.
+type StoreBucket interface {
+	// Get returns the value of the key, or nil. The value is only valid
+	// during the transaction.
+	Get(key []byte) []byte
+	// Put stores the value under the key.
+	Put(key, value []byte) error
+	// Delete removes the key.
+	Delete(key []byte) error
+	// ForEach calls fn for every key/value pair, in the order of the keys.
+	ForEach(fn func(k, v []byte) error) error
+}
+
+// The backends of the Store shipped with onet.
+const (
+	// StoreBackendBbolt keeps the data in a bbolt file. It is the default.
+	StoreBackendBbolt = "bbolt"
+	// StoreBackendMemory keeps the data in memory only, which is lost when
+	// the conode stops. It is meant for tests and for conodes that don't
+	// need to keep their data, like stateless gateways. Server.Snapshot
+	// still writes its data to the disk on demand.
+	StoreBackendMemory = "memory"
+)
+
+// StoreOpener opens the store of a conode. path is the location of its
+// database, which the backend may use as a file or a directory.
+type StoreOpener func(path string) (Store, error)
+
+var storeBackends = struct {
+	sync.Mutex
+	openers map[string]StoreOpener
+}{openers: map[string]StoreOpener{
+	StoreBackendBbolt:  openBoltStore,
+	StoreBackendMemory: func(string) (Store, error) { return NewMemoryStore(), nil },
+}}
+
+// RegisterStoreBackend makes a new backend of the Store available under the
+// given name, for ServerOptions.StorageBackend and the StorageBackend entry
+// of private.toml. It allows to use other databases without adding them to
+// the dependencies of onet: the modules badgerstore and sqlitestore register
+// the backends using BadgerDB and SQLite. A backend must pass
+// CheckStoreBackend.
+func RegisterStoreBackend(name string, open StoreOpener) error {
+	storeBackends.Lock()
+	defer storeBackends.Unlock()
+	if _, ok := storeBackends.openers[name]; ok {
+		return xerrors.Errorf("storage backend %s already registered", name)
+	}
+	storeBackends.openers[name] = open
+	return nil
+}
+
+// openStore opens the store at path with the given backend, or with bbolt
+// if it is empty.
+func openStore(backend, path string) (Store, error) {
+	if backend == "" {
+		backend = StoreBackendBbolt
+	}
+	storeBackends.Lock()
+	open, ok := storeBackends.openers[backend]
+	storeBackends.Unlock()
+	if !ok {
+		return nil, xerrors.Errorf("unknown storage backend %s", backend)
+	}
+	s, err := open(path)
+	if err != nil {
+		return nil, xerrors.Errorf("opening %s store: %v", backend, err)
+	}
+	return s, nil
+}
+
+// boltStore is the Store of a bbolt database.
+type boltStore struct {
+	// held to write, and to copy the database when compacting it
+	writes sync.Mutex
+	// held to access db, and to replace it when compacting it
+	swap sync.RWMutex
+	db   *bbolt.DB
+	// the service the database has been given to, if any
+	exposed string
+}
+
+func openBoltStore(path string) (Store, error) {
+	db, err := openDb(path)
+	if err != nil {
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) View(fn func(tx StoreTx) error) error {
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (s *boltStore) Update(fn func(tx StoreTx) error) error {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (s *boltStore) Size() (int64, error) {
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	var size int64
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	return size, err
+}
+
+func (s *boltStore) Backup(path string) error {
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+func (s *boltStore) Close() error {
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	return s.db.Close()
+}
+
+// stats returns the statistics of the bbolt database.
+func (s *boltStore) stats() bbolt.Stats {
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	return s.db.Stats()
+}
+
+// exposeDB returns the bbolt database for a service. As the service may keep
+// it, the database can't be replaced by a compacted one anymore.
+func (s *boltStore) exposeDB(service string) *bbolt.DB {
+	s.swap.Lock()
+	defer s.swap.Unlock()
+	if s.exposed == "" {
+		s.exposed = service
+		log.Warn("Service", service, "uses the bbolt database directly:",
+			"it can't be compacted anymore")
+	}
+	return s.db
+}
+
+// exposedTo returns the service the database has been given to, if any.
+func (s *boltStore) exposedTo() string {
+	s.swap.RLock()
+	defer s.swap.RUnlock()
+	return s.exposed
+}
+
+// WriteBoltBackup writes a copy of the store to a new bbolt database at
+// path, for the backends implementing Store.Backup.
+func WriteBoltBackup(s Store, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("removing old file: %v", err)
+	}
+	db, err := openDb(path)
+	if err != nil {
+		return err
+	}
+	err = s.View(func(tx StoreTx) error {
+		return db.Update(func(btx *bbolt.Tx) error {
+			return tx.ForEach(func(name []byte, b StoreBucket) error {
+				bb, err := btx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return b.ForEach(bb.Put)
+			})
+		})
+	})
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type boltTx struct {
+	tx *bbolt.Tx
+}
+
+func (t boltTx) Bucket(name []byte) StoreBucket {
+	// not to return a nil *bbolt.Bucket in a non-nil interface
+	if b := t.tx.Bucket(name); b != nil {
+		return b
+	}
+	return nil
+}
+
+func (t boltTx) CreateBucketIfNotExists(name []byte) (StoreBucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (t boltTx) DeleteBucket(name []byte) error {
+	return t.tx.DeleteBucket(name)
+}
+
+func (t boltTx) ForEach(fn func(name []byte, b StoreBucket) error) error {
+	return t.tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+		return fn(name, b)
+	})
+}
+
+// errTxNotWritable is returned when writing in a read-only transaction.
+var errTxNotWritable = xerrors.New("transaction not writable")
+
+// memoryStore is a Store keeping its buckets in maps. The transactions are
+// serialized, each write recording how to undo it in case the transaction
+// fails.
+type memoryStore struct {
+	sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemoryStore returns a Store keeping its data in memory, as used by the
+// "memory" backend.
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: make(map[string]map[string][]byte)}
+}
+
+func (s *memoryStore) View(fn func(tx StoreTx) error) error {
+	s.RLock()
+	defer s.RUnlock()
+	if s.buckets == nil {
+		return xerrors.New("store closed")
+	}
+	return fn(&memoryTx{store: s})
+}
+
+func (s *memoryStore) Update(fn func(tx StoreTx) error) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.buckets == nil {
+		return xerrors.New("store closed")
+	}
+	tx := &memoryTx{store: s, writable: true}
+	if err := fn(tx); err != nil {
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *memoryStore) Size() (int64, error) {
+	s.RLock()
+	defer s.RUnlock()
+	var size int64
+	for name, b := range s.buckets {
+		size += int64(len(name))
+		for k, v := range b {
+			size += int64(len(k) + len(v))
+		}
+	}
+	return size, nil
+}
+
+func (s *memoryStore) Backup(path string) error {
+	return WriteBoltBackup(s, path)
+}
+
+func (s *memoryStore) Close() error {
+	s.Lock()
+	s.buckets = nil
+	s.Unlock()
+	return nil
+}
+
+type memoryTx struct {
+	store    *memoryStore
+	writable bool
+	// restores the state before the writes of the transaction
+	undo []func()
+}
+
+func (tx *memoryTx) Bucket(name []byte) StoreBucket {
+	if _, ok := tx.store.buckets[string(name)]; !ok {
+		return nil
+	}
+	return &memoryBucket{tx: tx, name: string(name)}
+}
+
+func (tx *memoryTx) CreateBucketIfNotExists(name []byte) (StoreBucket, error) {
+	n := string(name)
+	if _, ok := tx.store.buckets[n]; !ok {
+		if !tx.writable {
+			return nil, errTxNotWritable
+		}
+		if len(name) == 0 {
+			return nil, xerrors.New("bucket name required")
+		}
+		tx.store.buckets[n] = make(map[string][]byte)
+		tx.undo = append(tx.undo, func() { delete(tx.store.buckets, n) })
+	}
+	return &memoryBucket{tx: tx, name: n}, nil
+}
+
+func (tx *memoryTx) DeleteBucket(name []byte) error {
+	if !tx.writable {
+		return errTxNotWritable
+	}
+	n := string(name)
+	old, ok := tx.store.buckets[n]
+	if !ok {
+		return xerrors.New("bucket not found")
+	}
+	delete(tx.store.buckets, n)
+	tx.undo = append(tx.undo, func() { tx.store.buckets[n] = old })
+	return nil
+}
+
+func (tx *memoryTx) ForEach(fn func(name []byte, b StoreBucket) error) error {
+	names := make([]string, 0, len(tx.store.buckets))
+	for n := range tx.store.buckets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if _, ok := tx.store.buckets[n]; !ok {
+			continue
+		}
+		if err := fn([]byte(n), &memoryBucket{tx: tx, name: n}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memoryBucket looks its map up by name, so that it follows a bucket deleted
+// and created again in the transaction.
+type memoryBucket struct {
+	tx   *memoryTx
+	name string
+}
+
+func (b *memoryBucket) data() map[string][]byte {
+	return b.tx.store.buckets[b.name]
+}
+
+func (b *memoryBucket) Get(key []byte) []byte {
+	return b.data()[string(key)]
+}
+
+func (b *memoryBucket) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return errTxNotWritable
+	}
+	data := b.data()
+	if data == nil {
+		return xerrors.New("bucket not found")
+	}
+	if len(key) == 0 {
+		return xerrors.New("key required")
+	}
+	k := string(key)
+	old, existed := data[k]
+	data[k] = append([]byte{}, value...)
+	b.tx.undo = append(b.tx.undo, func() {
+		if existed {
+			data[k] = old
+		} else {
+			delete(data, k)
+		}
+	})
+	return nil
+}
+
+func (b *memoryBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return errTxNotWritable
+	}
+	data := b.data()
+	k := string(key)
+	old, existed := data[k]
+	if !existed {
+		return nil
+	}
+	delete(data, k)
+	b.tx.undo = append(b.tx.undo, func() { data[k] = old })
+	return nil
+}
+
+func (b *memoryBucket) ForEach(fn func(k, v []byte) error) error {
+	data := b.data()
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, ok := data[k]
+		if !ok {
+			continue
+		}
+		if err := fn([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package onet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+func TestStoreBackends(t *testing.T) {
+	CheckStoreBackend(t, openBoltStore, true)
+	CheckStoreBackend(t, func(string) (Store, error) { return NewMemoryStore(), nil }, false)
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	name := []byte("bucket")
+	require.NoError(t, s.Update(func(tx StoreTx) error {
+		b, err := tx.CreateBucketIfNotExists(name)
+		require.NoError(t, err)
+		require.NoError(t, b.Put([]byte("b"), []byte("2")))
+		return b.Put([]byte("a"), []byte("1"))
+	}))
+
+	// a failed transaction leaves nothing behind
+	err := s.Update(func(tx StoreTx) error {
+		b := tx.Bucket(name)
+		require.NoError(t, b.Put([]byte("a"), []byte("3")))
+		require.NoError(t, b.Put([]byte("c"), []byte("4")))
+		require.NoError(t, b.Delete([]byte("b")))
+		_, err := tx.CreateBucketIfNotExists([]byte("other"))
+		require.NoError(t, err)
+		require.NoError(t, tx.DeleteBucket(name))
+		return xerrors.New("abort")
+	})
+	require.Error(t, err)
+
+	require.NoError(t, s.View(func(tx StoreTx) error {
+		require.Nil(t, tx.Bucket([]byte("other")))
+		b := tx.Bucket(name)
+		var kv []string
+		require.NoError(t, b.ForEach(func(k, v []byte) error {
+			kv = append(kv, string(k)+string(v))
+			return nil
+		}))
+		require.Equal(t, []string{"a1", "b2"}, kv)
+		require.Equal(t, errTxNotWritable, b.Put([]byte("d"), []byte("5")))
+		return nil
+	}))
+	size, err := s.Size()
+	require.NoError(t, err)
+	require.Equal(t, int64(len(name)+4), size)
+
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	backup := filepath.Join(dir, "backup.db")
+	require.NoError(t, s.Backup(backup))
+	db, err := bbolt.Open(backup, 0600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.View(func(tx *bbolt.Tx) error {
+		require.Equal(t, []byte("2"), tx.Bucket(name).Get([]byte("b")))
+		return nil
+	}))
+	require.NoError(t, db.Close())
+
+	require.NoError(t, s.Close())
+	require.Error(t, s.View(func(tx StoreTx) error { return nil }))
+}
+
+func TestServer_StorageBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	priv, id := NewPrivIdentity(tSuite, 0)
+	router, err := network.NewLocalRouter(id, tSuite)
+	require.NoError(t, err)
+	c := newServerWithOptions(tSuite, dir, router, priv,
+		ServerOptions{StorageBackend: StoreBackendMemory})
+	c.StartInBackground()
+	defer c.Close()
+
+	_, ok := c.serviceManager.store.(*boltStore)
+	require.False(t, ok)
+	require.Equal(t, StoreBackendMemory, c.serviceManager.GetStatus().Field["Backend"])
+	ctx := c.serviceManager.contexts[ServiceFactory.ServiceID(serviceWebSocket)]
+	require.NoError(t, ctx.Save([]byte("key"), &SimpleResponse{Val: 3}))
+	msg, err := ctx.Load([]byte("key"))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), msg.(*SimpleResponse).Val)
+
+	require.NoError(t, ctx.UpdateAdditionalBucket([]byte("extra"), func(b *QuotaBucket) error {
+		return b.Put([]byte("k"), []byte("v"))
+	}))
+	require.NoError(t, ctx.ViewAdditionalBucket([]byte("extra"), func(b StoreBucket) error {
+		require.Equal(t, []byte("v"), b.Get([]byte("k")))
+		return nil
+	}))
+	require.NoError(t, c.storageCheck())
+
+	// nothing is written to the disk
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	_, err = openStore("unknown", filepath.Join(dir, "db"))
+	require.Error(t, err)
+	require.Error(t, RegisterStoreBackend(StoreBackendBbolt, openBoltStore))
+}
+
+func TestOpenDb_Locked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d time.Duration) { DatabaseLockTimeout = d }(DatabaseLockTimeout)
+	DatabaseLockTimeout = 100 * time.Millisecond
+
+	path := filepath.Join(dir, "test.db")
+	db, err := openDb(path)
+	require.NoError(t, err)
+	_, err = openDb(path)
+	require.Error(t, err)
+
+	// the database is opened once the other holder closes it
+	go func() {
+		time.Sleep(1100 * time.Millisecond)
+		db.Close()
+	}()
+	DatabaseLockTimeout = 5 * time.Second
+	db2, err := openDb(path)
+	require.NoError(t, err)
+	require.NoError(t, db2.Close())
+}
@@ -0,0 +1,198 @@
+package onet
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+// CheckStoreBackend runs the tests every backend of the Store must pass,
+// opening the stores with open. If persistent is true, the data must survive
+// closing and opening the store again.
+func CheckStoreBackend(t *testing.T, open StoreOpener, persistent bool) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.db")
+	s, err := open(path)
+	if err != nil {
+		t.Fatal("opening:", err)
+	}
+	check := func(what string, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+	}
+	expect := func(what string, got, want []byte) {
+		t.Helper()
+		if !bytes.Equal(got, want) || (got == nil) != (want == nil) {
+			t.Fatalf("%s: got %q instead of %q", what, got, want)
+		}
+	}
+	dump := func(s Store) string {
+		t.Helper()
+		var kv []string
+		check("dumping", s.View(func(tx StoreTx) error {
+			return tx.ForEach(func(name []byte, b StoreBucket) error {
+				return b.ForEach(func(k, v []byte) error {
+					kv = append(kv, fmt.Sprintf("%s/%s=%s", name, k, v))
+					return nil
+				})
+			})
+		}))
+		return fmt.Sprint(kv)
+	}
+
+	name, other := []byte("bucket"), []byte("a bucket")
+	check("writing", s.Update(func(tx StoreTx) error {
+		if tx.Bucket(name) != nil {
+			return xerrors.New("bucket exists before its creation")
+		}
+		b, err := tx.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+		for _, kv := range []string{"c3", "a1", "b2", "e"} {
+			if err := b.Put([]byte(kv[:1]), []byte(kv[1:])); err != nil {
+				return err
+			}
+		}
+		expect("reading own write", b.Get([]byte("a")), []byte("1"))
+		if err := b.Put(nil, []byte("x")); err == nil {
+			return xerrors.New("empty key accepted")
+		}
+		b, err = tx.CreateBucketIfNotExists(other)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("k"), []byte("v"))
+	}))
+	const content = "[a bucket/k=v bucket/a=1 bucket/b=2 bucket/c=3 bucket/e=]"
+	if got := dump(s); got != content {
+		t.Fatalf("content %s instead of %s", got, content)
+	}
+	check("reading", s.View(func(tx StoreTx) error {
+		b := tx.Bucket(name)
+		expect("value", b.Get([]byte("b")), []byte("2"))
+		expect("empty value", b.Get([]byte("e")), []byte{})
+		expect("missing value", b.Get([]byte("z")), nil)
+		if tx.Bucket([]byte("missing")) != nil {
+			return xerrors.New("missing bucket returned")
+		}
+		if b.Put([]byte("d"), []byte("4")) == nil {
+			return xerrors.New("write in a read-only transaction")
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte("new")); err == nil {
+			return xerrors.New("bucket created in a read-only transaction")
+		}
+		return nil
+	}))
+
+	// a failed transaction leaves nothing behind
+	err = s.Update(func(tx StoreTx) error {
+		b := tx.Bucket(name)
+		check("overwriting", b.Put([]byte("a"), []byte("3")))
+		check("adding", b.Put([]byte("d"), []byte("4")))
+		check("deleting", b.Delete([]byte("b")))
+		_, err := tx.CreateBucketIfNotExists([]byte("new"))
+		check("creating bucket", err)
+		check("deleting bucket", tx.DeleteBucket(other))
+		return xerrors.New("abort")
+	})
+	if err == nil {
+		t.Fatal("error of the transaction not returned")
+	}
+	if got := dump(s); got != content {
+		t.Fatalf("content %s after a failed transaction", got)
+	}
+
+	check("deleting", s.Update(func(tx StoreTx) error {
+		if err := tx.Bucket(name).Delete([]byte("b")); err != nil {
+			return err
+		}
+		if err := tx.Bucket(name).Delete([]byte("z")); err != nil {
+			return err
+		}
+		if err := tx.DeleteBucket(other); err != nil {
+			return err
+		}
+		if tx.DeleteBucket(other) == nil {
+			return xerrors.New("missing bucket deleted")
+		}
+		if tx.Bucket(other) != nil {
+			return xerrors.New("deleted bucket returned")
+		}
+		// created again empty
+		_, err := tx.CreateBucketIfNotExists(other)
+		return err
+	}))
+	const after = "[bucket/a=1 bucket/c=3 bucket/e=]"
+	if got := dump(s); got != after {
+		t.Fatalf("content %s instead of %s", got, after)
+	}
+
+	// the writes of concurrent transactions are all kept
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.Update(func(tx StoreTx) error {
+				b := tx.Bucket(other)
+				n := len(b.Get([]byte("count")))
+				return b.Put([]byte("count"), bytes.Repeat([]byte{1}, n+1))
+			})
+			errs <- s.View(func(tx StoreTx) error { return nil })
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		check("concurrent transaction", err)
+	}
+	check("counting", s.View(func(tx StoreTx) error {
+		if n := len(tx.Bucket(other).Get([]byte("count"))); n != 20 {
+			return xerrors.Errorf("%d writes instead of 20", n)
+		}
+		return nil
+	}))
+
+	size, err := s.Size()
+	check("size", err)
+	if size <= 0 {
+		t.Fatalf("size %d", size)
+	}
+
+	backup := filepath.Join(dir, "backup.db")
+	check("backup", s.Backup(backup))
+	db, err := bbolt.Open(backup, 0600, nil)
+	check("opening backup", err)
+	check("reading backup", db.View(func(tx *bbolt.Tx) error {
+		expect("backup value", tx.Bucket(name).Get([]byte("c")), []byte("3"))
+		return nil
+	}))
+	check("closing backup", db.Close())
+
+	final := dump(s)
+	check("closing", s.Close())
+	if !persistent {
+		return
+	}
+	s, err = open(path)
+	check("opening again", err)
+	defer s.Close()
+	if got := dump(s); got != final {
+		t.Fatalf("content %q instead of %q after opening again", got, final)
+	}
+}
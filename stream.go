@@ -0,0 +1,223 @@
+package onet
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// StreamReconnectAttempts is how many times in a row a ResumableStream tries
+// to open the stream again before giving up.
+var StreamReconnectAttempts = 10
+
+// streamReconnectMaxWait is the longest wait between two attempts.
+const streamReconnectMaxWait = 5 * time.Second
+
+// ResumableReply is implemented by the messages of a stream that can be
+// resumed after them. The token is given back to the service when the stream
+// is opened again, so that it continues with the next message.
+type ResumableReply interface {
+	ResumeToken() []byte
+}
+
+// ResumableRequest is implemented by the requests opening a stream that can
+// be resumed. SetResumeToken is called with the token of the last message
+// received before the request is sent again.
+type ResumableRequest interface {
+	SetResumeToken(token []byte)
+}
+
+// ResumableStream is a stream that is opened again when the connection is
+// lost, e.g., because the conode restarted or a load-balancer closed it. If
+// the request is a ResumableRequest and the messages are ResumableReplies,
+// the stream continues after the last message read, otherwise the request is
+// sent again as is. The stream isn't opened again if the conode closed it,
+// e.g., because the service finished streaming, except for maintenance.
+type ResumableStream struct {
+	client *Client
+	dst    *network.ServerIdentity
+	msg    interface{}
+	path   string
+
+	// held during ReadMessage
+	reading sync.Mutex
+	token   []byte
+	sync.Mutex
+	conn   *websocket.Conn
+	closed bool
+}
+
+// StreamResumable is like Stream, but returns a stream that is opened again
+// when the connection is lost.
+func (c *Client) StreamResumable(dst *network.ServerIdentity, msg interface{}) (*ResumableStream, error) {
+	return c.StreamResumableWithContext(context.Background(), dst, msg)
+}
+
+// StreamResumableWithContext is like StreamResumable, but gives up connecting
+// once ctx is done.
+func (c *Client) StreamResumableWithContext(ctx context.Context, dst *network.ServerIdentity,
+	msg interface{}) (*ResumableStream, error) {
+	s := &ResumableStream{
+		client: c,
+		dst:    dst,
+		msg:    msg,
+		path:   strings.Split(reflect.TypeOf(msg).String(), ".")[1],
+	}
+	conn, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+	return s, nil
+}
+
+// open connects to the conode and sends the request, with the resume token if
+// there is one.
+func (s *ResumableStream) open(ctx context.Context) (*websocket.Conn, error) {
+	if r, ok := s.msg.(ResumableRequest); ok && s.token != nil {
+		r.SetResumeToken(s.token)
+	}
+	buf, err := protobuf.Encode(s.msg)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding: %v", err)
+	}
+	conn, err := s.client.dial(ctx, s.dst, s.path, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("connecting: %w", err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, buf); err != nil {
+		conn.Close()
+		return nil, xerrors.Errorf("connection write: %v", err)
+	}
+	s.client.Lock()
+	s.client.tx += uint64(len(buf))
+	s.client.Unlock()
+	return conn, nil
+}
+
+// ReadMessage reads the next message of the stream, opening it again if the
+// connection has been lost.
+func (s *ResumableStream) ReadMessage(ret interface{}) error {
+	return s.ReadMessageWithContext(context.Background(), ret)
+}
+
+// ReadMessageWithContext is like ReadMessage, but gives up once ctx is done.
+// The stream can't be used anymore afterwards.
+func (s *ResumableStream) ReadMessageWithContext(ctx context.Context, ret interface{}) error {
+	s.reading.Lock()
+	defer s.reading.Unlock()
+	for attempt := 0; ; attempt++ {
+		conn, err := s.connection(ctx)
+		var buf []byte
+		if err == nil {
+			buf, err = readMessage(ctx, conn)
+		}
+		if s.isClosed() {
+			return xerrors.New("stream closed")
+		}
+		if err == nil {
+			s.client.Lock()
+			s.client.rx += uint64(len(buf))
+			s.client.Unlock()
+			err = protobuf.DecodeWithConstructors(buf, ret, network.DefaultConstructors(s.client.suite))
+			if err != nil {
+				return xerrors.Errorf("decoding: %v", err)
+			}
+			if r, ok := ret.(ResumableReply); ok {
+				s.token = r.ResumeToken()
+			}
+			return nil
+		}
+
+		s.Lock()
+		if s.conn != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+		s.Unlock()
+		if ctx.Err() != nil || !streamLost(err) || attempt >= StreamReconnectAttempts {
+			return err
+		}
+		wait := network.WaitRetry << uint(attempt)
+		if wait > streamReconnectMaxWait {
+			wait = streamReconnectMaxWait
+		}
+		log.Lvl2("Stream to", s.dst, "lost, opening it again:", err)
+		select {
+		case <-ctx.Done():
+			return xerrors.Errorf("reconnecting: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// connection returns the connection of the stream, opening it if needed.
+func (s *ResumableStream) connection(ctx context.Context) (*websocket.Conn, error) {
+	s.Lock()
+	conn, closed := s.conn, s.closed
+	s.Unlock()
+	if closed {
+		return nil, xerrors.New("stream closed")
+	}
+	if conn != nil {
+		return conn, nil
+	}
+	conn, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		conn.Close()
+		return nil, xerrors.New("stream closed")
+	}
+	s.conn = conn
+	return conn, nil
+}
+
+func (s *ResumableStream) isClosed() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.closed
+}
+
+// Close closes the stream. A ReadMessage in progress returns an error.
+func (s *ResumableStream) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "client closed"))
+	if err != nil {
+		log.Lvl2("Error while sending closing type:", err)
+	}
+	err = s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// streamLost returns whether the stream can be opened again after err: the
+// conode didn't close it on purpose.
+func streamLost(err error) bool {
+	if xerrors.Is(err, ErrMaintenance) {
+		return true
+	}
+	var ce *websocket.CloseError
+	if xerrors.As(err, &ce) {
+		return ce.Code == websocket.CloseGoingAway ||
+			ce.Code == websocket.CloseAbnormalClosure
+	}
+	return true
+}
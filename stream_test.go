@@ -0,0 +1,131 @@
+package onet
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const resumeStreamServiceName = "resumeStreamService"
+
+func init() {
+	RegisterNewService(resumeStreamServiceName, func(c *Context) (Service, error) {
+		s := &resumeStreamService{ServiceProcessor: NewServiceProcessor(c)}
+		if err := s.RegisterStreamingHandler(s.Stream); err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
+
+type ResumeStreamRequest struct {
+	Count int64
+	Token []byte
+}
+
+func (r *ResumeStreamRequest) SetResumeToken(token []byte) {
+	r.Token = token
+}
+
+type ResumeStreamReply struct {
+	Val int64
+}
+
+func (r *ResumeStreamReply) ResumeToken() []byte {
+	token := make([]byte, 8)
+	binary.LittleEndian.PutUint64(token, uint64(r.Val+1))
+	return token
+}
+
+type resumeStreamService struct {
+	*ServiceProcessor
+}
+
+func (s *resumeStreamService) Stream(msg *ResumeStreamRequest) (chan *ResumeStreamReply,
+	chan bool, error) {
+	var start int64
+	if len(msg.Token) == 8 {
+		start = int64(binary.LittleEndian.Uint64(msg.Token))
+	}
+	replies := make(chan *ResumeStreamReply)
+	stop := make(chan bool)
+	go func() {
+		defer close(replies)
+		for i := start; i < msg.Count; i++ {
+			// the stream stays open for a while
+			select {
+			case <-time.After(20 * time.Millisecond):
+			case <-stop:
+				return
+			}
+			select {
+			case replies <- &ResumeStreamReply{Val: i}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return replies, stop, nil
+}
+
+func TestClient_StreamResumable(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(1)
+	cl := local.NewClient(resumeStreamServiceName)
+
+	s, err := cl.StreamResumable(servers[0].ServerIdentity, &ResumeStreamRequest{Count: 6})
+	require.NoError(t, err)
+	defer s.Close()
+	for i := int64(0); i < 6; i++ {
+		if i == 3 {
+			// the connection is lost in the middle of the stream
+			s.Lock()
+			require.NoError(t, s.conn.UnderlyingConn().Close())
+			s.Unlock()
+		}
+		reply := &ResumeStreamReply{}
+		require.NoError(t, s.ReadMessage(reply))
+		require.Equal(t, i, reply.Val)
+	}
+
+	// the end of the stream isn't a lost connection
+	require.Error(t, s.ReadMessage(&ResumeStreamReply{}))
+
+	// closing the stream stops the reading
+	s, err = cl.StreamResumable(servers[0].ServerIdentity, &ResumeStreamRequest{Count: 1})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+	require.Error(t, s.ReadMessage(&ResumeStreamReply{}))
+}
+
+func TestClient_StreamResumableRestart(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(1)
+	cl := local.NewClient(resumeStreamServiceName)
+
+	s, err := cl.StreamResumable(servers[0].ServerIdentity, &ResumeStreamRequest{Count: 10})
+	require.NoError(t, err)
+	defer s.Close()
+	reply := &ResumeStreamReply{}
+	require.NoError(t, s.ReadMessage(reply))
+
+	// the conode goes into maintenance, and out of it again
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		servers[0].LeaveMaintenance()
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// the stream is still open, but the conode stays in maintenance
+	require.Error(t, servers[0].EnterMaintenance(ctx))
+	s.Lock()
+	require.NoError(t, s.conn.UnderlyingConn().Close())
+	s.Unlock()
+	require.NoError(t, s.ReadMessage(reply))
+	require.Equal(t, int64(1), reply.Val)
+}
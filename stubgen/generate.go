@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// generatedHeader starts the files written by stubgen, which are skipped when
+// the package is parsed.
+const generatedHeader = "// Code generated by stubgen. DO NOT EDIT."
+
+// endpoint is a handler of the service.
+type endpoint struct {
+	Name string
+	// request and reply types, without the pointer
+	Request string
+	Reply   string
+	// the handler returns a channel of replies
+	Streaming bool
+}
+
+// generate returns the source of the typed client of the handlers of the
+// service typeName in the package in dir. service is the Go expression of
+// the name the service is registered with.
+func generate(dir, typeName, service string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing package: %v", err)
+	}
+	if len(pkgs) != 1 {
+		return nil, xerrors.Errorf("found %d packages in %s", len(pkgs), dir)
+	}
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+
+	registered := make(map[string]bool)
+	var files []*ast.File
+	for _, f := range pkg.Files {
+		if len(f.Comments) > 0 && strings.HasPrefix(f.Comments[0].Text(),
+			strings.TrimPrefix(generatedHeader, "// ")) {
+			continue
+		}
+		files = append(files, f)
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			switch sel.Sel.Name {
+			case "RegisterHandler", "RegisterHandlers",
+				"RegisterStreamingHandler", "RegisterStreamingHandlers":
+				for _, arg := range call.Args {
+					if h, ok := arg.(*ast.SelectorExpr); ok {
+						registered[h.Sel.Name] = true
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	imports := map[string]string{
+		"context":                     "",
+		"go.dedis.ch/onet/v3":         "",
+		"go.dedis.ch/onet/v3/network": "",
+	}
+	var endpoints []endpoint
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv == nil || !registered[fd.Name.Name] ||
+				receiverName(fd.Recv.List[0].Type) != typeName {
+				continue
+			}
+			e, used, err := parseHandler(fd)
+			if err != nil {
+				log.Warnf("skipping %s: %v", fd.Name.Name, err)
+				continue
+			}
+			for _, name := range used {
+				p, alias, err := importPath(f, name)
+				if err != nil {
+					return nil, xerrors.Errorf("handler %s: %v", fd.Name.Name, err)
+				}
+				imports[p] = alias
+			}
+			endpoints = append(endpoints, e)
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, xerrors.Errorf("no handler of %s found", typeName)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Name < endpoints[j].Name
+	})
+
+	var paths []string
+	for p := range imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	// the standard library first
+	var std, other []string
+	for _, p := range paths {
+		line := strings.TrimSpace(imports[p] + " " + strconv.Quote(p))
+		if strings.Contains(strings.Split(p, "/")[0], ".") {
+			other = append(other, line)
+		} else {
+			std = append(std, line)
+		}
+	}
+
+	var buf bytes.Buffer
+	err = stubTemplate.Execute(&buf, struct {
+		Header    string
+		Package   string
+		Std       []string
+		Imports   []string
+		Type      string
+		Service   string
+		Endpoints []endpoint
+	}{generatedHeader, pkg.Name, std, other, typeName, service, endpoints})
+	if err != nil {
+		return nil, xerrors.Errorf("executing template: %v", err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, xerrors.Errorf("formatting: %v", err)
+	}
+	return src, nil
+}
+
+// receiverName returns the name of the type of a receiver.
+func receiverName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// parseHandler returns the endpoint of a handler with one of the signatures
+// accepted by the ServiceProcessor, and the packages its types use.
+func parseHandler(fd *ast.FuncDecl) (endpoint, []string, error) {
+	e := endpoint{Name: fd.Name.Name}
+	var used []string
+	var params []ast.Expr
+	for _, f := range fd.Type.Params.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			params = append(params, f.Type)
+		}
+	}
+	if len(params) == 0 || len(params) > 2 {
+		return e, nil, xerrors.New("wrong number of arguments")
+	}
+	req, pkg, ok := pointedType(params[len(params)-1])
+	if !ok {
+		return e, nil, xerrors.New("the request is not a pointer to a struct")
+	}
+	e.Request = req
+	if pkg != "" {
+		used = append(used, pkg)
+	}
+
+	var results []ast.Expr
+	if fd.Type.Results != nil {
+		for _, f := range fd.Type.Results.List {
+			results = append(results, f.Type)
+		}
+	}
+	reply := results
+	switch len(results) {
+	case 2:
+	case 3:
+		ch, ok := results[0].(*ast.ChanType)
+		if !ok {
+			return e, nil, xerrors.New("a streaming handler must return a channel")
+		}
+		e.Streaming = true
+		reply = []ast.Expr{ch.Value}
+	default:
+		return e, nil, xerrors.New("wrong number of return values")
+	}
+	if rep, pkg, ok := pointedType(reply[0]); ok {
+		e.Reply = rep
+		if pkg != "" {
+			used = append(used, pkg)
+		}
+	} else if e.Streaming {
+		return e, nil, xerrors.New("the replies are not pointers to a struct")
+	}
+	return e, used, nil
+}
+
+// pointedType returns the type pointed to by expr, and its package if it is
+// not in the current one.
+func pointedType(expr ast.Expr) (string, string, bool) {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return "", "", false
+	}
+	switch t := star.X.(type) {
+	case *ast.Ident:
+		return t.Name, "", true
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok {
+			return pkg.Name + "." + t.Sel.Name, pkg.Name, true
+		}
+	}
+	return "", "", false
+}
+
+// importPath returns the path of the package imported as name in the file,
+// and its alias, if any.
+func importPath(f *ast.File, name string) (string, string, error) {
+	for _, imp := range f.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return "", "", xerrors.Errorf("import path: %v", err)
+		}
+		if imp.Name != nil {
+			if imp.Name.Name == name {
+				return p, name, nil
+			}
+			continue
+		}
+		// versions like go.dedis.ch/onet/v3 are named after the element
+		// before
+		base := path.Base(p)
+		if len(base) > 1 && base[0] == 'v' && strings.Trim(base[1:], "0123456789") == "" {
+			base = path.Base(path.Dir(p))
+		}
+		if base == name {
+			return p, "", nil
+		}
+	}
+	return "", "", xerrors.Errorf("package %s not imported", name)
+}
+
+var stubTemplate = template.Must(template.New("stub").Parse(`{{.Header}}
+
+package {{.Package}}
+
+import (
+{{range .Std}}	{{.}}
+{{end}}
+{{range .Imports}}	{{.}}
+{{end}})
+
+// {{.Type}}Client is a typed client of the handlers of {{.Type}}.
+type {{.Type}}Client struct {
+	Client *onet.Client
+}
+
+// New{{.Type}}Client returns a typed client of the handlers of {{.Type}}.
+func New{{.Type}}Client(suite network.Suite) *{{.Type}}Client {
+	return &{{.Type}}Client{Client: onet.NewClient(suite, {{.Service}})}
+}
+{{range .Endpoints}}{{if .Streaming}}
+// {{$.Type}}{{.Name}}Stream reads the replies streamed by the {{.Name}} handler.
+type {{$.Type}}{{.Name}}Stream struct {
+	onet.StreamingConn
+}
+
+// Read returns the next reply of the stream.
+func (s *{{$.Type}}{{.Name}}Stream) Read(ctx context.Context) (*{{.Reply}}, error) {
+	reply := &{{.Reply}}{}
+	if err := s.ReadMessageWithContext(ctx, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// {{.Name}} opens the stream of the {{.Name}} handler of dst.
+func (c *{{$.Type}}Client) {{.Name}}(ctx context.Context, dst *network.ServerIdentity,
+	req *{{.Request}}) (*{{$.Type}}{{.Name}}Stream, error) {
+	conn, err := c.Client.StreamWithContext(ctx, dst, req)
+	if err != nil {
+		return nil, err
+	}
+	return &{{$.Type}}{{.Name}}Stream{conn}, nil
+}
+{{else if .Reply}}
+// {{.Name}} sends the request to the {{.Name}} handler of dst and returns
+// the reply.
+func (c *{{$.Type}}Client) {{.Name}}(ctx context.Context, dst *network.ServerIdentity,
+	req *{{.Request}}) (*{{.Reply}}, error) {
+	reply := &{{.Reply}}{}
+	if err := c.Client.SendProtobufWithContext(ctx, dst, req, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+{{else}}
+// {{.Name}} sends the request to the {{.Name}} handler of dst and decodes
+// the reply in reply, which must be a pointer to the struct returned by the
+// handler, or nil.
+func (c *{{$.Type}}Client) {{.Name}}(ctx context.Context, dst *network.ServerIdentity,
+	req *{{.Request}}, reply interface{}) error {
+	return c.Client.SendProtobufWithContext(ctx, dst, req, reply)
+}
+{{end}}{{end}}`))
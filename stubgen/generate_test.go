@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join("testdata", "svc")
+	src, err := generate(dir, "Service", "ServiceName")
+	require.NoError(t, err)
+	// the expected output is checked in
+	exp, err := ioutil.ReadFile(filepath.Join(dir, "service_client.go"))
+	require.NoError(t, err)
+	require.Equal(t, string(exp), string(src))
+
+	_, err = generate(dir, "Unknown", "ServiceName")
+	require.Error(t, err)
+}
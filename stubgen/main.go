@@ -0,0 +1,83 @@
+// Stubgen writes a typed client for the handlers of an onet service, with
+// one method per handler, so that applications don't have to use the paths
+// and the interface{} of onet.Client. It is meant to be run by go generate
+// in the package of the service, e.g.:
+//
+//	//go:generate go run go.dedis.ch/onet/v3/stubgen -type Service -service ServiceName
+//
+// The handlers are the methods of the type given to RegisterHandler(s) and
+// RegisterStreamingHandler(s). The file is written again whenever the
+// handlers change.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+func main() {
+	cliApp := cli.NewApp()
+	cliApp.Name = "stubgen"
+	cliApp.Usage = "write a typed client for the handlers of an onet service"
+	cliApp.Version = "0.1"
+	cliApp.ArgsUsage = "[package directory]"
+	cliApp.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:     "type, t",
+			Usage:    "type of the service",
+			Required: true,
+		},
+		cli.StringFlag{
+			Name:  "service, s",
+			Value: "ServiceName",
+			Usage: "Go expression of the name the service is registered with",
+		},
+		cli.StringFlag{
+			Name:      "output, o",
+			Usage:     "file to write, by default <type>_client.go in the package directory",
+			TakesFile: true,
+		},
+		cli.IntFlag{
+			Name:  "debug, d",
+			Value: 0,
+			Usage: "debug-level: 1 for terse, 5 for maximal",
+		},
+	}
+	cliApp.Before = func(c *cli.Context) error {
+		log.SetDebugVisible(c.Int("debug"))
+		return nil
+	}
+	cliApp.Action = run
+
+	err := cliApp.Run(os.Args)
+	if err != nil {
+		log.Fatalf("Error while running app: %+v", err)
+	}
+}
+
+func run(c *cli.Context) error {
+	dir := "."
+	if c.NArg() > 0 {
+		dir = c.Args().First()
+	}
+	typeName := c.String("type")
+	src, err := generate(dir, typeName, c.String("service"))
+	if err != nil {
+		return xerrors.Errorf("generating: %v", err)
+	}
+	out := c.String("output")
+	if out == "" {
+		out = filepath.Join(dir, strings.ToLower(typeName)+"_client.go")
+	}
+	if err := ioutil.WriteFile(out, src, 0644); err != nil {
+		return xerrors.Errorf("writing: %v", err)
+	}
+	log.Lvl1("Wrote", out)
+	return nil
+}
@@ -0,0 +1,63 @@
+// Code generated by stubgen. DO NOT EDIT.
+
+package svc
+
+import (
+	"context"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// ServiceClient is a typed client of the handlers of Service.
+type ServiceClient struct {
+	Client *onet.Client
+}
+
+// NewServiceClient returns a typed client of the handlers of Service.
+func NewServiceClient(suite network.Suite) *ServiceClient {
+	return &ServiceClient{Client: onet.NewClient(suite, ServiceName)}
+}
+
+// Info sends the request to the Info handler of dst and decodes
+// the reply in reply, which must be a pointer to the struct returned by the
+// handler, or nil.
+func (c *ServiceClient) Info(ctx context.Context, dst *network.ServerIdentity,
+	req *Info, reply interface{}) error {
+	return c.Client.SendProtobufWithContext(ctx, dst, req, reply)
+}
+
+// Ping sends the request to the Ping handler of dst and returns
+// the reply.
+func (c *ServiceClient) Ping(ctx context.Context, dst *network.ServerIdentity,
+	req *Ping) (*Pong, error) {
+	reply := &Pong{}
+	if err := c.Client.SendProtobufWithContext(ctx, dst, req, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// ServiceWatchStream reads the replies streamed by the Watch handler.
+type ServiceWatchStream struct {
+	onet.StreamingConn
+}
+
+// Read returns the next reply of the stream.
+func (s *ServiceWatchStream) Read(ctx context.Context) (*Event, error) {
+	reply := &Event{}
+	if err := s.ReadMessageWithContext(ctx, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Watch opens the stream of the Watch handler of dst.
+func (c *ServiceClient) Watch(ctx context.Context, dst *network.ServerIdentity,
+	req *Watch) (*ServiceWatchStream, error) {
+	conn, err := c.Client.StreamWithContext(ctx, dst, req)
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceWatchStream{conn}, nil
+}
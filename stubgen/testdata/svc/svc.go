@@ -0,0 +1,52 @@
+package svc
+
+import (
+	"context"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+const ServiceName = "Svc"
+
+type Service struct {
+	*onet.ServiceProcessor
+}
+
+type Ping struct{}
+
+type Pong struct{}
+
+type Watch struct{}
+
+type Event struct{}
+
+type Info struct{}
+
+func newService(c *onet.Context) (onet.Service, error) {
+	s := &Service{ServiceProcessor: onet.NewServiceProcessor(c)}
+	if err := s.RegisterHandlers(s.Ping, s.Info); err != nil {
+		return nil, err
+	}
+	if err := s.RegisterStreamingHandler(s.Watch); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Service) Ping(ctx context.Context, req *Ping) (*Pong, error) {
+	return &Pong{}, nil
+}
+
+func (s *Service) Info(req *Info) (network.Message, error) {
+	return &Pong{}, nil
+}
+
+func (s *Service) Watch(req *Watch) (chan *Event, chan bool, error) {
+	return nil, nil, nil
+}
+
+// NotAHandler isn't registered.
+func (s *Service) NotAHandler(req *Ping) (*Pong, error) {
+	return &Pong{}, nil
+}
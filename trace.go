@@ -0,0 +1,137 @@
+package onet
+
+import (
+	"context"
+	"sync"
+)
+
+// TraceParentHeader is the HTTP header holding the W3C trace context of a
+// client request. It is read from the websocket upgrade request.
+const TraceParentHeader = "traceparent"
+
+// Tracer creates the spans of the distributed tracing. Onet doesn't depend on
+// a tracing library: an application wanting traces registers an adapter for
+// its tracer, e.g., OpenTelemetry, with SetTracer.
+//
+// The trace context is passed between conodes in the W3C traceparent format,
+// so all conodes of a roster must use compatible tracers.
+type Tracer interface {
+	// StartSpan starts a new span as a child of the span in ctx, and
+	// returns a context holding the new span.
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+	// Inject returns the traceparent of the span in ctx, or an empty
+	// string if there is none.
+	Inject(ctx context.Context) string
+	// Extract returns a context holding the remote span described by
+	// traceparent.
+	Extract(ctx context.Context, traceparent string) context.Context
+}
+
+// Span is a unit of work of a trace.
+type Span interface {
+	SetAttribute(key, value string)
+	End()
+}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopTracer) Inject(ctx context.Context) string { return "" }
+
+func (noopTracer) Extract(ctx context.Context, traceparent string) context.Context {
+	return ctx
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key, value string) {}
+
+func (noopSpan) End() {}
+
+var tracer = struct {
+	sync.RWMutex
+	t Tracer
+}{t: noopTracer{}}
+
+// SetTracer sets the tracer used by all servers of this process. Passing nil
+// disables tracing, which is the default.
+func SetTracer(t Tracer) {
+	if t == nil {
+		t = noopTracer{}
+	}
+	tracer.Lock()
+	tracer.t = t
+	tracer.Unlock()
+}
+
+func getTracer() Tracer {
+	tracer.RLock()
+	defer tracer.RUnlock()
+	return tracer.t
+}
+
+// SetTraceContext sets the context holding the span the messages sent by this
+// node are part of. A service can use it to link a protocol to the client
+// request that started it, using the context of the request.
+func (n *TreeNodeInstance) SetTraceContext(ctx context.Context) {
+	n.traceMut.Lock()
+	n.traceCtx = ctx
+	n.traceMut.Unlock()
+}
+
+// TraceContext returns the context holding the span of this node. For nodes
+// created by a message of another conode, it is the span of that message.
+func (n *TreeNodeInstance) TraceContext() context.Context {
+	n.traceMut.Lock()
+	defer n.traceMut.Unlock()
+	if n.traceCtx == nil {
+		return context.Background()
+	}
+	return n.traceCtx
+}
+
+// requestTraces holds the trace contexts of the client requests being
+// processed by a service, so that the protocols created by the handlers are
+// part of the span of the request.
+type requestTraces struct {
+	sync.Mutex
+	next uint64
+	ctxs map[uint64]context.Context
+}
+
+// add registers the context of a request and returns the function to call
+// once the request is processed.
+func (r *requestTraces) add(ctx context.Context) func() {
+	r.Lock()
+	defer r.Unlock()
+	if r.ctxs == nil {
+		r.ctxs = make(map[uint64]context.Context)
+	}
+	r.next++
+	id := r.next
+	r.ctxs[id] = ctx
+	return func() {
+		r.Lock()
+		delete(r.ctxs, id)
+		r.Unlock()
+	}
+}
+
+// current returns the context of the request being processed, or nil if
+// there is none. With concurrent requests it can't tell which one is the
+// caller and also returns nil: the service must then use
+// CreateProtocolWithContext.
+func (r *requestTraces) current() context.Context {
+	r.Lock()
+	defer r.Unlock()
+	if len(r.ctxs) != 1 {
+		return nil
+	}
+	for _, ctx := range r.ctxs {
+		return ctx
+	}
+	return nil
+}
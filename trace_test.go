@@ -0,0 +1,177 @@
+package onet
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testSpanKey struct{}
+
+// testSpan records a span with its trace and its parent.
+type testSpan struct {
+	name   string
+	trace  string
+	id     string
+	parent string
+	tracer *testTracer
+}
+
+func (s *testSpan) SetAttribute(key, value string) {}
+
+func (s *testSpan) End() {
+	s.tracer.Lock()
+	s.tracer.ended = append(s.tracer.ended, s)
+	s.tracer.Unlock()
+}
+
+// testTracer formats the trace context like W3C traceparent.
+type testTracer struct {
+	sync.Mutex
+	next  int
+	ended []*testSpan
+}
+
+func (t *testTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	t.Lock()
+	t.next++
+	s := &testSpan{name: name, id: fmt.Sprintf("%016x", t.next), tracer: t}
+	t.Unlock()
+	if p, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		s.trace, s.parent = p.trace, p.id
+	} else {
+		s.trace = fmt.Sprintf("%032x", s.id)
+	}
+	return context.WithValue(ctx, testSpanKey{}, s), s
+}
+
+func (t *testTracer) Inject(ctx context.Context) string {
+	if s, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		return "00-" + s.trace + "-" + s.id + "-01"
+	}
+	return ""
+}
+
+func (t *testTracer) Extract(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 {
+		return ctx
+	}
+	return context.WithValue(ctx, testSpanKey{}, &testSpan{trace: parts[1], id: parts[2]})
+}
+
+func (t *testTracer) spans(name string) []*testSpan {
+	t.Lock()
+	defer t.Unlock()
+	var ret []*testSpan
+	for _, s := range t.ended {
+		if s.name == name {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func TestTracer_Overlay(t *testing.T) {
+	tr := &testTracer{}
+	SetTracer(tr)
+	defer SetTracer(nil)
+
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(2, true)
+	pi, err := local.CreateProtocol(pingPongProtoName, tree)
+	require.NoError(t, err)
+	protocol := pi.(*pingPongProto)
+
+	ctx, root := tr.StartSpan(context.Background(), "client")
+	protocol.SetTraceContext(ctx)
+	require.NoError(t, protocol.Start())
+	<-protocol.done
+	root.End()
+
+	sends := tr.spans("onet.overlay_send")
+	require.Equal(t, 2, len(sends))
+	receives := tr.spans("onet.overlay_receive")
+	require.True(t, len(receives) >= 1)
+	for _, s := range append(sends, receives...) {
+		require.Equal(t, root.(*testSpan).trace, s.trace)
+	}
+	// the message of the root is sent as part of the client span
+	require.True(t, sends[0].parent == root.(*testSpan).id ||
+		sends[1].parent == root.(*testSpan).id)
+}
+
+func TestTracer_CreateProtocol(t *testing.T) {
+	tr := &testTracer{}
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(2, true)
+	c := servers[0].Service(testServiceName).(*testService).Context
+
+	// create returns the trace context of a new protocol and runs it
+	create := func(ctx context.Context) context.Context {
+		var pi ProtocolInstance
+		var err error
+		if ctx == nil {
+			pi, err = c.CreateProtocol(pingPongProtoName, tree)
+		} else {
+			pi, err = c.CreateProtocolWithContext(ctx, pingPongProtoName, tree)
+		}
+		require.NoError(t, err)
+		require.NoError(t, pi.Start())
+		<-pi.(*pingPongProto).done
+		return pi.(*pingPongProto).TraceContext()
+	}
+
+	// a protocol created while handling a single request
+	ctx, _ := tr.StartSpan(context.Background(), "request")
+	end := c.traces.add(ctx)
+	require.Equal(t, ctx, create(nil))
+
+	// concurrent requests are ambiguous
+	other, _ := tr.StartSpan(context.Background(), "other")
+	endOther := c.traces.add(other)
+	require.Equal(t, context.Background(), create(nil))
+	require.Equal(t, other, create(other))
+	end()
+	endOther()
+	require.Nil(t, c.traces.current())
+}
+
+func TestTracer_Streaming(t *testing.T) {
+	tr := &testTracer{}
+	SetTracer(tr)
+	defer SetTracer(nil)
+
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	serName := "streamingService"
+	_, err := RegisterNewService(serName, newStreamingService)
+	require.NoError(t, err)
+	defer UnregisterService(serName)
+
+	servers, el, _ := local.GenTree(2, false)
+	client := local.NewClientKeep(serName)
+	defer client.Close()
+	conn, err := client.Stream(servers[0].ServerIdentity,
+		&SimpleRequest{ServerIdentities: el, Val: 1})
+	require.NoError(t, err)
+	require.NoError(t, conn.ReadMessage(&SimpleResponse{}))
+	require.Error(t, conn.ReadMessage(&SimpleResponse{}))
+
+	// the span ends when the server closes the connection
+	for i := 0; len(tr.spans("onet.client_stream")) == 0; i++ {
+		require.True(t, i < 100, "stream span didn't end")
+		time.Sleep(10 * time.Millisecond)
+	}
+	stream := tr.spans("onet.client_stream")[0]
+	dispatch := tr.spans("onet.service_dispatch")
+	require.Equal(t, 1, len(dispatch))
+	require.Equal(t, stream.id, dispatch[0].parent)
+}
@@ -2,7 +2,6 @@ package onet
 
 import (
 	"bytes"
-	cryptorand "crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
@@ -723,13 +722,10 @@ func (ro *Roster) RandomSubset(root *network.ServerIdentity, n int) *Roster {
 }
 
 // securePermute is like rand.Perm, but seeded via cryptographically
-// secure random data.
+// secure random data, unless SetSeed is called.
 func securePermute(n int) []int {
 	var buf [8]byte
-	nb, err := cryptorand.Read(buf[:])
-	if nb != 8 {
-		panic("securePermute cannot get random")
-	}
+	err := randomRead(buf[:])
 	if err != nil {
 		panic("securePermute cannot get random: " + err.Error())
 	}
@@ -1,6 +1,7 @@
 package onet
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sync"
@@ -14,6 +15,9 @@ import (
 // TreeNodeInstance represents a protocol-instance in a given TreeNode. It embeds an
 // Overlay where all the tree-structures are stored.
 type TreeNodeInstance struct {
+	// when the node last sent or received a message, in nanoseconds since
+	// the epoch, first to be aligned for the atomic operations
+	active  int64
 	overlay *Overlay
 	token   *Token
 	// cache for the TreeNode this Node is representing
@@ -56,6 +60,14 @@ type TreeNodeInstance struct {
 	// used for the CounterIO interface
 	tx safeAdder
 	rx safeAdder
+
+	// context holding the span of this node, see SetTraceContext
+	traceCtx context.Context
+	traceMut sync.Mutex
+
+	// last messages received, for the crash reports
+	recent      []CrashMessage
+	recentMutex sync.Mutex
 }
 
 type safeAdder struct {
@@ -103,6 +115,7 @@ func newTreeNodeInstance(o *Overlay, tok *Token, tn *TreeNode, io MessageProxy)
 		protoIO:              io,
 		sentTo:               make(map[TreeNodeID]bool),
 	}
+	n.setActive()
 	go n.dispatchMsgReader()
 	return n
 }
@@ -158,6 +171,11 @@ func (n *TreeNodeInstance) SendTo(to *TreeNode, msg interface{}) error {
 		return xerrors.New("is closing")
 	}
 	n.msgDispatchQueueMutex.Unlock()
+	if b := n.Host().byzantineBehavior(); b != nil {
+		if msg = b(n, to, msg); msg == nil {
+			return nil
+		}
+	}
 	var c *GenericConfig
 	// only sends the config once
 	n.configMut.Lock()
@@ -167,10 +185,11 @@ func (n *TreeNodeInstance) SendTo(to *TreeNode, msg interface{}) error {
 	}
 	n.configMut.Unlock()
 
-	sentLen, err := n.overlay.SendToTreeNode(n.token, to, msg, n.protoIO, c)
+	sentLen, err := n.overlay.sendToTreeNode(n.TraceContext(), n.token, to, msg, n.protoIO, c)
 	n.tx.add(sentLen)
+	n.setActive()
 	if err != nil {
-		return xerrors.Errorf("sending: %v", err)
+		return xerrors.Errorf("sending: %w", err)
 	}
 	return nil
 }
@@ -360,6 +379,7 @@ func (n *TreeNodeInstance) closeDispatch() error {
 		if r := recover(); r != nil {
 			log.Errorf("Recovered panic while closing protocol: %v", r)
 			log.Error(log.Stack())
+			n.reportPanic("protocol.Shutdown", r)
 		}
 	}()
 	log.Lvl3("Closing node", n.Info())
@@ -404,7 +424,7 @@ func (n *TreeNodeInstance) dispatchHandler(msgSlice []*ProtocolMsg) error {
 		for _, msg := range msgSlice {
 			if errV.IsValid() && !errV.IsNil() {
 				// Before overwriting an error, print it out
-				log.Errorf("%s: error while dispatching message %s: %s",
+				n.Logger().Errorf("%s: error while dispatching message %s: %s",
 					n.Name(), reflect.TypeOf(msg.Msg),
 					errV.Interface().(error))
 			}
@@ -453,6 +473,7 @@ func (n *TreeNodeInstance) dispatchChannel(msgSlice []*ProtocolMsg) error {
 			log.Errorf("Couldn't dispatch protocol-message %s in %s: %v",
 				mt, n.Info(), r)
 			log.Error(log.Stack())
+			n.reportPanic("protocol.channel", r)
 		}
 	}()
 	to := reflect.TypeOf(n.channels[mt])
@@ -506,6 +527,8 @@ func (n *TreeNodeInstance) ProcessProtocolMsg(msg *ProtocolMsg) {
 		return
 	}
 	n.msgDispatchQueue = append(n.msgDispatchQueue, msg)
+	n.recordMessage(msg)
+	n.setActive()
 	n.notifyDispatch()
 }
 
@@ -520,28 +543,29 @@ func (n *TreeNodeInstance) notifyDispatch() {
 }
 
 func (n *TreeNodeInstance) dispatchMsgReader() {
-	log.Lvl3("Starting node", n.Info())
+	l := n.Logger()
+	l.Lvl3("Starting node", n.Info())
 	for {
 		n.msgDispatchQueueMutex.Lock()
 		if n.closing {
-			log.Lvl3("Closing reader")
+			l.Lvl3("Closing reader")
 			n.msgDispatchQueueMutex.Unlock()
 			return
 		}
 		if len(n.msgDispatchQueue) > 0 {
-			log.Lvl4(n.Info(), "Read message and dispatching it",
+			l.Lvl4(n.Info(), "Read message and dispatching it",
 				len(n.msgDispatchQueue))
 			msg := n.msgDispatchQueue[0]
 			n.msgDispatchQueue = n.msgDispatchQueue[1:]
 			n.msgDispatchQueueMutex.Unlock()
-			err := n.dispatchMsgToProtocol(msg)
+			err := n.dispatchMsgRecover(msg)
 			if err != nil {
-				log.Errorf("%s: error while dispatching message %s: %s",
+				l.Errorf("%s: error while dispatching message %s: %s",
 					n.Name(), reflect.TypeOf(msg.Msg), err)
 			}
 		} else {
 			n.msgDispatchQueueMutex.Unlock()
-			log.Lvl4(n.Info(), "Waiting for message")
+			l.Lvl4(n.Info(), "Waiting for message")
 			// Allow for closing of the channel
 			select {
 			case <-n.msgDispatchQueueWait:
@@ -550,6 +574,18 @@ func (n *TreeNodeInstance) dispatchMsgReader() {
 	}
 }
 
+// dispatchMsgRecover dispatches the message, and recovers from the panics of
+// the handlers of the protocol, so that the next messages are dispatched.
+func (n *TreeNodeInstance) dispatchMsgRecover(msg *ProtocolMsg) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			n.reportPanic("protocol.handler", r)
+			err = xerrors.Errorf("panic: %v", r)
+		}
+	}()
+	return n.dispatchMsgToProtocol(msg)
+}
+
 // dispatchMsgToProtocol will dispatch this onet.Data to the right instance
 func (n *TreeNodeInstance) dispatchMsgToProtocol(onetMsg *ProtocolMsg) error {
 
@@ -724,11 +760,38 @@ func (n *TreeNodeInstance) Name() string {
 // (IP address and TokenID).
 func (n *TreeNodeInstance) Info() string {
 	tid := n.TokenID()
-	name := protocols.ProtocolIDToName(n.token.ProtoID)
-	if name == "" {
-		name = n.overlay.server.protocols.ProtocolIDToName(n.token.ProtoID)
+	return fmt.Sprintf("%s (%s): %s", n.ServerIdentity().Address, tid.String(),
+		n.infoName())
+}
+
+// infoName returns the name of the protocol, registered globally or in the
+// server.
+func (n *TreeNodeInstance) infoName() string {
+	return n.overlay.protocolName(n.token.ProtoID)
+}
+
+// LogFields returns the fields correlating the messages logged for this
+// protocol instance: the name of the protocol, its round, which is the same on
+// all the nodes of the tree, and the service that created it, if any.
+func (n *TreeNodeInstance) LogFields() []log.Field {
+	return logFields(n.infoName(), n.token)
+}
+
+// logFields returns the LogFields of the instance of the protocol with the
+// token.
+func logFields(name string, tok *Token) []log.Field {
+	fields := []log.Field{log.KV("protocol", name),
+		log.KV("round", tok.RoundID.String())}
+	if svc := ServiceFactory.Name(tok.ServiceID); svc != "" {
+		fields = append(fields, log.KV("service", svc))
 	}
-	return fmt.Sprintf("%s (%s): %s", n.ServerIdentity().Address, tid.String(), name)
+	return fields
+}
+
+// Logger returns the logger adding the LogFields to the messages, for the
+// protocol to log with them.
+func (n *TreeNodeInstance) Logger() log.FieldLogger {
+	return log.WithFields(n.LogFields()...)
 }
 
 // TokenID returns the TokenID of the given node (to uniquely identify it)
@@ -764,7 +827,7 @@ func (n *TreeNodeInstance) Broadcast(msg interface{}) []error {
 	for _, node := range n.List() {
 		if !node.Equal(n.TreeNode()) {
 			if err := n.SendTo(node, msg); err != nil {
-				errs = append(errs, xerrors.Errorf("sending: %v", err))
+				errs = append(errs, xerrors.Errorf("sending: %w", err))
 			}
 		}
 	}
@@ -776,7 +839,7 @@ func (n *TreeNodeInstance) Multicast(msg interface{}, nodes ...*TreeNode) []erro
 	var errs []error
 	for _, node := range nodes {
 		if err := n.SendTo(node, msg); err != nil {
-			errs = append(errs, xerrors.Errorf("sending: %v", err))
+			errs = append(errs, xerrors.Errorf("sending: %w", err))
 		}
 	}
 	return errs
@@ -789,7 +852,7 @@ func (n *TreeNodeInstance) SendToParent(msg interface{}) error {
 	}
 	err := n.SendTo(n.Parent(), msg)
 	if err != nil {
-		return xerrors.Errorf("sending: %v", err)
+		return xerrors.Errorf("sending: %w", err)
 	}
 	return nil
 }
@@ -804,7 +867,7 @@ func (n *TreeNodeInstance) SendToChildren(msg interface{}) error {
 	}
 	for _, node := range n.Children() {
 		if err := n.SendTo(node, msg); err != nil {
-			return xerrors.Errorf("sending: %v", err)
+			return xerrors.Errorf("sending: %w", err)
 		}
 	}
 	return nil
@@ -257,6 +257,7 @@ func (cp *pingPongProto) Dispatch() error {
 
 	select {
 	case <-cp.pingPongChan:
+		cp.Logger().Lvl3("received ping")
 		if !cp.IsRoot() {
 			cp.SendToParent(&PingPongMsg{})
 		}
@@ -268,6 +269,7 @@ func (cp *pingPongProto) Dispatch() error {
 
 func (cp *pingPongProto) Start() error {
 	// only called by the root
+	cp.Logger().Lvl3("sending ping")
 	err := cp.SendToChildren(&PingPongMsg{})
 	if err != nil {
 		return err
@@ -275,3 +277,25 @@ func (cp *pingPongProto) Start() error {
 
 	return nil
 }
+
+func TestTreeNodeInstance_LogFields(t *testing.T) {
+	local := NewLocalTest(tSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(2, true)
+
+	rounds := make(map[string]int)
+	key := log.RegisterLogger(log.NewBackendLogger(log.BackendFunc(func(e *log.Entry) {
+		if len(e.Fields) == 2 && e.Fields[0].Value == pingPongProtoName {
+			rounds[e.Fields[1].Value.(string)]++
+		}
+	}), &log.LoggerInfo{DebugLvl: 3}))
+	pi, err := local.StartProtocol(pingPongProtoName, tree)
+	require.NoError(t, err)
+	<-pi.(*pingPongProto).done
+	log.UnregisterLogger(key)
+
+	// the messages of both nodes are logged with the round of the protocol
+	require.Equal(t, 1, len(rounds))
+	round := pi.(*pingPongProto).Token().RoundID.String()
+	require.True(t, rounds[round] >= 2)
+}
@@ -8,21 +8,30 @@ import (
 type treeStorage struct {
 	sync.Mutex
 	timeout       time.Duration
+	clock         Clock
 	wg            sync.WaitGroup
 	trees         map[TreeID]*Tree
-	cancellations map[TreeID]chan struct{}
+	cancellations map[TreeID]ClockTimer
 	closed        bool
 }
 
 func newTreeStorage(t time.Duration) *treeStorage {
 	return &treeStorage{
 		timeout:       t,
+		clock:         realClock{},
 		trees:         make(map[TreeID]*Tree),
-		cancellations: make(map[TreeID]chan struct{}),
+		cancellations: make(map[TreeID]ClockTimer),
 		closed:        false,
 	}
 }
 
+// setClock replaces the clock of the timeouts of the removals.
+func (ts *treeStorage) setClock(clock Clock) {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.clock = clock
+}
+
 // Register creates the key for tree so it is known
 func (ts *treeStorage) Register(id TreeID) {
 	ts.Lock()
@@ -86,7 +95,7 @@ func (ts *treeStorage) Remove(id TreeID) {
 	defer ts.Unlock()
 
 	if ts.closed {
-		// server is closing so we avoid creating new goroutines
+		// server is closing so we avoid starting new timers
 		return
 	}
 
@@ -96,28 +105,20 @@ func (ts *treeStorage) Remove(id TreeID) {
 		return
 	}
 
+	// other distant node instances of the protocol could ask for the tree even
+	// after we're done locally and then it needs to be kept around for some time
 	ts.wg.Add(1)
-	c := make(chan struct{})
-	ts.cancellations[id] = c
-
-	go func() {
+	var timer ClockTimer
+	timer = ts.clock.AfterFunc(ts.timeout, func() {
 		defer ts.wg.Done()
-
-		timer := time.NewTimer(ts.timeout)
-
-		select {
-		// other distant node instances of the protocol could ask for the tree even
-		// after we're done locally and then it needs to be kept around for some time
-		case <-timer.C:
-			ts.Lock()
+		ts.Lock()
+		defer ts.Unlock()
+		if ts.cancellations[id] == timer {
 			delete(ts.trees, id)
 			delete(ts.cancellations, id)
-			ts.Unlock()
-		case <-c:
-			timer.Stop()
-			return
 		}
-	}()
+	})
+	ts.cancellations[id] = timer
 }
 
 // GetRoster looks for the roster in the list of trees or returns nil
@@ -137,16 +138,15 @@ func (ts *treeStorage) GetRoster(id RosterID) *Roster {
 // Close forces cleaning goroutines to be shutdown
 func (ts *treeStorage) Close() {
 	ts.Lock()
-	defer ts.Unlock()
-
 	// prevent further call to remove because the server is closing anyway
 	ts.closed = true
 
-	for k, c := range ts.cancellations {
-		close(c)
-		delete(ts.cancellations, k)
+	for id := range ts.cancellations {
+		ts.cancelDeletion(id)
 	}
+	ts.Unlock()
 
+	// the removals that couldn't be stopped wait for the lock
 	ts.wg.Wait()
 }
 
@@ -154,9 +154,11 @@ func (ts *treeStorage) Close() {
 // to be triggered for the tree.
 // Caution: caller is reponsible for holding the lock.
 func (ts *treeStorage) cancelDeletion(id TreeID) {
-	c := ts.cancellations[id]
-	if c != nil {
-		close(c)
+	timer := ts.cancellations[id]
+	if timer != nil {
+		if timer.Stop() {
+			ts.wg.Done()
+		}
 		delete(ts.cancellations, id)
 	}
 }
@@ -41,6 +41,32 @@ func TestTreeStorage_SimpleCase(t *testing.T) {
 	require.False(t, store.IsRegistered(tree.ID))
 }
 
+func TestTreeStorage_Clock(t *testing.T) {
+	store := newTreeStorage(time.Hour)
+	clock := NewVirtualClock(time.Now())
+	store.setClock(clock)
+
+	tree := &Tree{ID: TreeID{1}}
+	store.Set(tree)
+	store.Remove(tree.ID)
+	clock.Advance(time.Hour - time.Second)
+	require.NotNil(t, store.Get(tree.ID))
+	clock.Advance(time.Second)
+	require.Nil(t, store.Get(tree.ID))
+
+	// a refresh cancels the removal
+	store.Set(tree)
+	store.Remove(tree.ID)
+	require.NotNil(t, store.getAndRefresh(tree.ID))
+	require.Equal(t, 0, clock.Timers())
+	clock.Advance(2 * time.Hour)
+	require.NotNil(t, store.Get(tree.ID))
+
+	store.Remove(tree.ID)
+	store.Close()
+	require.Equal(t, 0, clock.Timers())
+}
+
 // Tests the behaviour of Unregister
 func TestTreeStorage_Registration(t *testing.T) {
 	store := newTreeStorage(treeStoreTimeout)
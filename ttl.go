@@ -0,0 +1,249 @@
+package onet
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// StorageTTLSweepInterval is the time between two removals of the expired
+// keys. Until then, an expired key can still be read.
+var StorageTTLSweepInterval = time.Minute
+
+// storageTTLSweepMax is the maximum number of keys removed in one
+// transaction of the sweeper.
+const storageTTLSweepMax = 1000
+
+// ttlExpiries holds the expiry of the keys with a TTL, indexed by bucket and
+// key, and ttlIndex the same keys ordered by expiry for the sweeper.
+var (
+	ttlExpiries = []byte("onet_ttl_keys")
+	ttlIndex    = []byte("onet_ttl")
+)
+
+// ttlKey returns the bucket and key in a form that can be split again.
+func ttlKey(bucket, key []byte) []byte {
+	k := make([]byte, 2, 2+len(bucket)+len(key))
+	binary.BigEndian.PutUint16(k, uint16(len(bucket)))
+	return append(append(k, bucket...), key...)
+}
+
+func splitTTLKey(k []byte) (bucket, key []byte, err error) {
+	if len(k) < 2 || len(k) < 2+int(binary.BigEndian.Uint16(k)) {
+		return nil, nil, xerrors.New("invalid key")
+	}
+	l := 2 + int(binary.BigEndian.Uint16(k))
+	return k[2:l], k[l:], nil
+}
+
+func ttlIndexKey(expiry int64, key []byte) []byte {
+	k := make([]byte, 8, 8+len(key))
+	binary.BigEndian.PutUint64(k, uint64(expiry))
+	return append(k, key...)
+}
+
+// setTTL records that the key of the bucket expires at the given time, as
+// unix nanoseconds, replacing any previous expiry.
+func setTTL(tx StoreTx, bucket, key []byte, expiry int64) error {
+	if err := clearTTL(tx, bucket, key); err != nil {
+		return err
+	}
+	expiries, err := tx.CreateBucketIfNotExists(ttlExpiries)
+	if err != nil {
+		return xerrors.Errorf("creating bucket: %v", err)
+	}
+	index, err := tx.CreateBucketIfNotExists(ttlIndex)
+	if err != nil {
+		return xerrors.Errorf("creating bucket: %v", err)
+	}
+	k := ttlKey(bucket, key)
+	exp := make([]byte, 8)
+	binary.BigEndian.PutUint64(exp, uint64(expiry))
+	if err := expiries.Put(k, exp); err != nil {
+		return err
+	}
+	return index.Put(ttlIndexKey(expiry, k), []byte{})
+}
+
+// clearTTL removes the expiry of the key of the bucket, if it has one.
+func clearTTL(tx StoreTx, bucket, key []byte) error {
+	expiries := tx.Bucket(ttlExpiries)
+	if expiries == nil {
+		return nil
+	}
+	k := ttlKey(bucket, key)
+	exp := expiries.Get(k)
+	if len(exp) != 8 {
+		return nil
+	}
+	idx := ttlIndexKey(int64(binary.BigEndian.Uint64(exp)), k)
+	if err := expiries.Delete(k); err != nil {
+		return err
+	}
+	if index := tx.Bucket(ttlIndex); index != nil {
+		return index.Delete(idx)
+	}
+	return nil
+}
+
+// errSweepDone stops the scan of the index at the first key not expired.
+var errSweepDone = xerrors.New("sweep done")
+
+// sweepExpired removes up to storageTTLSweepMax keys expired at now, and
+// returns how many it removed.
+func (s *serviceManager) sweepExpired(now time.Time) (int, error) {
+	type expired struct {
+		index, key []byte
+	}
+	freed := make(map[string][2]int64)
+	var removed []expired
+	err := s.store.Update(func(tx StoreTx) error {
+		index := tx.Bucket(ttlIndex)
+		if index == nil {
+			return nil
+		}
+		err := index.ForEach(func(k, _ []byte) error {
+			if len(k) < 8 || int64(binary.BigEndian.Uint64(k)) > now.UnixNano() ||
+				len(removed) >= storageTTLSweepMax {
+				return errSweepDone
+			}
+			removed = append(removed, expired{
+				index: append([]byte{}, k...),
+				key:   append([]byte{}, k[8:]...),
+			})
+			return nil
+		})
+		if err != nil && err != errSweepDone {
+			return err
+		}
+		expiries := tx.Bucket(ttlExpiries)
+		for _, e := range removed {
+			if err := index.Delete(e.index); err != nil {
+				return err
+			}
+			bucket, key, err := splitTTLKey(e.key)
+			if err != nil {
+				log.Warn("Dropping invalid TTL entry:", err)
+				continue
+			}
+			if err := expiries.Delete(e.key); err != nil {
+				return err
+			}
+			b := tx.Bucket(bucket)
+			if b == nil {
+				continue
+			}
+			v := b.Get(key)
+			if v == nil {
+				continue
+			}
+			if err := b.Delete(key); err != nil {
+				return err
+			}
+			f := freed[bucketService(string(bucket))]
+			freed[bucketService(string(bucket))] = [2]int64{f[0] + int64(len(key)+len(v)), f[1] + 1}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("removing expired keys: %v", err)
+	}
+
+	s.servicesMutex.Lock()
+	for id, ctx := range s.contexts {
+		if f, ok := freed[ServiceFactory.Name(id)]; ok {
+			ctx.usage.Lock()
+			ctx.usage.used -= f[0]
+			ctx.usage.keys -= f[1]
+			ctx.usage.Unlock()
+		}
+	}
+	s.servicesMutex.Unlock()
+	return len(removed), nil
+}
+
+// ttlSweeper removes the expired keys in the background.
+type ttlSweeper struct {
+	// interval is read once, so that StorageTTLSweepInterval can be changed
+	// while a server runs.
+	interval time.Duration
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+	closing  sync.Once
+}
+
+func newTTLSweeper(interval time.Duration) *ttlSweeper {
+	return &ttlSweeper{interval: interval, stop: make(chan struct{})}
+}
+
+func (ts *ttlSweeper) start(s *serviceManager) {
+	ts.stopped.Add(1)
+	go func() {
+		defer ts.stopped.Done()
+		for {
+			select {
+			case <-ts.stop:
+				return
+			case <-time.After(ts.interval):
+			}
+			for {
+				n, err := s.sweepExpired(time.Now())
+				if err != nil {
+					log.Error("TTL sweeper:", err)
+				}
+				if n < storageTTLSweepMax {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// close stops the sweeper, waiting for a running sweep. The server can be
+// closed several times.
+func (ts *ttlSweeper) close() {
+	ts.closing.Do(func() { close(ts.stop) })
+	ts.stopped.Wait()
+}
+
+// SaveWithTTL stores the data under key, as Save does, and removes it once
+// ttl has passed. A ttl of 0 keeps the data until it is deleted. Writing the
+// key again replaces its TTL.
+func (c *Context) SaveWithTTL(key []byte, data interface{}, ttl time.Duration) error {
+	buf, err := network.Marshal(data)
+	if err != nil {
+		return xerrors.Errorf("marshaling: %v", err)
+	}
+	return c.Update(func(tx *ServiceTx) error {
+		return tx.bucket(c.bucketName).PutWithTTL(key, buf, ttl)
+	})
+}
+
+// SaveWithTTL stores the data under key and removes it once ttl has passed,
+// see Context.SaveWithTTL.
+func (t *ServiceTx) SaveWithTTL(key []byte, data interface{}, ttl time.Duration) error {
+	buf, err := network.Marshal(data)
+	if err != nil {
+		return xerrors.Errorf("marshaling: %v", err)
+	}
+	return t.bucket(t.ctx.bucketName).PutWithTTL(key, buf, ttl)
+}
+
+// PutWithTTL stores the value under key, as Put does, and removes it once
+// ttl has passed. A ttl of 0 keeps the value until it is deleted.
+func (b *QuotaBucket) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	if b.tx == nil {
+		return xerrors.New("bucket without transaction")
+	}
+	if err := b.Put(key, value); err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	return setTTL(b.tx, b.name, key, time.Now().Add(ttl).UnixNano())
+}
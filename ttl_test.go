@@ -0,0 +1,65 @@
+package onet
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestContext_SaveWithTTL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ttl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d time.Duration) { StorageTTLSweepInterval = d }(StorageTTLSweepInterval)
+	StorageTTLSweepInterval = 10 * time.Millisecond
+
+	priv, id := NewPrivIdentity(tSuite, 0)
+	router, err := network.NewLocalRouter(id, tSuite)
+	require.NoError(t, err)
+	c := newServerWithOptions(tSuite, dir, router, priv, ServerOptions{})
+	defer c.Close()
+	ctx := serviceContext(c, serviceWebSocket)
+	used, _ := ctx.StorageUsage()
+
+	require.NoError(t, ctx.SaveWithTTL([]byte("a"), &SimpleResponse{Val: 1}, time.Hour))
+	require.NoError(t, ctx.SaveWithTTL([]byte("b"), &SimpleResponse{Val: 2}, time.Hour))
+	require.NoError(t, ctx.UpdateAdditionalBucket([]byte("nonces"), func(b *QuotaBucket) error {
+		return b.PutWithTTL([]byte("n"), []byte("v"), time.Hour)
+	}))
+	// writing the key again without TTL keeps it
+	require.NoError(t, ctx.Save([]byte("b"), &SimpleResponse{Val: 3}))
+
+	n, err := c.serviceManager.sweepExpired(time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	n, err = c.serviceManager.sweepExpired(time.Now().Add(2 * time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	msg, err := ctx.Load([]byte("a"))
+	require.NoError(t, err)
+	require.Nil(t, msg)
+	msg, err = ctx.Load([]byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), msg.(*SimpleResponse).Val)
+	require.NoError(t, ctx.ViewAdditionalBucket([]byte("nonces"), func(b StoreBucket) error {
+		require.Nil(t, b.Get([]byte("n")))
+		return nil
+	}))
+	used2, _ := ctx.StorageUsage()
+	require.NoError(t, ctx.updateStorageUsage())
+	used3, _ := ctx.StorageUsage()
+	require.Equal(t, used3, used2)
+	require.NotEqual(t, used, used2)
+
+	// the sweeper runs in the background
+	require.NoError(t, ctx.SaveWithTTL([]byte("c"), &SimpleResponse{Val: 4}, time.Millisecond))
+	c.StartInBackground()
+	require.Eventually(t, func() bool {
+		msg, err := ctx.Load([]byte("c"))
+		return err == nil && msg == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
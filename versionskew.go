@@ -0,0 +1,221 @@
+package onet
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// ProtocolVersion is the version of a protocol, as registered with
+// RegisterProtocolVersion.
+type ProtocolVersion struct {
+	Name    string
+	Version int
+}
+
+// VersionSet is sent by the conodes to each other when they connect, so that
+// the members of a roster running incompatible versions are noticed.
+type VersionSet struct {
+	// Onet is the version of the onet module, "(devel)" if it isn't known.
+	Onet string
+	// Protocols are the versions of the protocols registered with
+	// RegisterProtocolVersion, sorted by name.
+	Protocols []ProtocolVersion
+}
+
+var versionSetID = network.RegisterMessage(&VersionSet{})
+
+var protocolVersions = struct {
+	sync.Mutex
+	versions map[string]int
+}{versions: make(map[string]int)}
+
+// RegisterProtocolVersion declares the version of the protocol with the
+// given name. It is to be increased when the protocol can't work anymore
+// with conodes running the previous version.
+func RegisterProtocolVersion(name string, version int) {
+	protocolVersions.Lock()
+	defer protocolVersions.Unlock()
+	protocolVersions.versions[name] = version
+}
+
+// LocalVersionSet returns the versions of this binary.
+func LocalVersionSet() *VersionSet {
+	vs := &VersionSet{Onet: onetVersion()}
+	protocolVersions.Lock()
+	for name, v := range protocolVersions.versions {
+		vs.Protocols = append(vs.Protocols, ProtocolVersion{Name: name, Version: v})
+	}
+	protocolVersions.Unlock()
+	sort.Slice(vs.Protocols, func(i, j int) bool {
+		return vs.Protocols[i].Name < vs.Protocols[j].Name
+	})
+	return vs
+}
+
+// onetVersion returns the version of the onet module in the binary.
+func onetVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if bi.Main.Path == "go.dedis.ch/onet/v3" {
+		v, _ := buildVersion()
+		return v
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == "go.dedis.ch/onet/v3" {
+			if dep.Replace != nil && dep.Replace.Version != "" {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+// Mismatches returns the differences between the two sets that make them
+// incompatible: another major or minor version of onet, or another version
+// of a protocol both sets know. A "(devel)" version of onet matches any.
+func (vs *VersionSet) Mismatches(other *VersionSet) []string {
+	var diffs []string
+	if !sameMinor(vs.Onet, other.Onet) {
+		diffs = append(diffs, fmt.Sprintf("onet %s != %s", vs.Onet, other.Onet))
+	}
+	theirs := make(map[string]int)
+	for _, p := range other.Protocols {
+		theirs[p.Name] = p.Version
+	}
+	for _, p := range vs.Protocols {
+		if v, ok := theirs[p.Name]; ok && v != p.Version {
+			diffs = append(diffs, fmt.Sprintf("protocol %s %d != %d", p.Name,
+				p.Version, v))
+		}
+	}
+	return diffs
+}
+
+// sameMinor returns true if both semantic versions have the same major and
+// minor numbers, or if one of them isn't a release.
+func sameMinor(a, b string) bool {
+	pa, oka := majorMinor(a)
+	pb, okb := majorMinor(b)
+	return !oka || !okb || pa == pb
+}
+
+// majorMinor returns the "vX.Y" part of the version, and false if it isn't
+// a semantic version.
+func majorMinor(v string) (string, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	if !strings.HasPrefix(v, "v") || len(parts) < 2 {
+		return "", false
+	}
+	for _, p := range parts[:2] {
+		if _, err := strconv.Atoi(p); err != nil {
+			return "", false
+		}
+	}
+	return "v" + parts[0] + "." + parts[1], true
+}
+
+// versionSkew holds the versions of the peers that don't match the local
+// ones.
+type versionSkew struct {
+	sync.Mutex
+	local *VersionSet
+	// strict closes the connections to the incompatible peers
+	strict bool
+	// mismatches of each peer
+	peers map[network.ServerIdentityID]peerSkew
+}
+
+type peerSkew struct {
+	si    *network.ServerIdentity
+	diffs []string
+}
+
+// registerVersionSkew makes the server send its versions to the peers it
+// connects to, and compare theirs.
+func (c *Server) registerVersionSkew(strict bool) {
+	c.versionSkew = &versionSkew{local: LocalVersionSet(), strict: strict,
+		peers: make(map[network.ServerIdentityID]peerSkew)}
+	c.Router.AddPeerHandler(func(si *network.ServerIdentity, up bool) {
+		if !up {
+			return
+		}
+		go func() {
+			if _, err := c.Send(si, c.versionSkew.local); err != nil {
+				log.Lvl2(c.ServerIdentity, "couldn't send its versions to", si, ":", err)
+			}
+		}()
+	})
+	c.RegisterProcessorFunc(versionSetID, func(env *network.Envelope) error {
+		vs, ok := env.Msg.(*VersionSet)
+		if !ok {
+			return xerrors.New("invalid version set")
+		}
+		c.versionSkew.check(c, env.ServerIdentity, vs)
+		return nil
+	})
+	c.statusReporterStruct.RegisterStatusReporter("Versions", c.versionSkew)
+}
+
+// check compares the versions of the peer with the local ones.
+func (vsk *versionSkew) check(c *Server, si *network.ServerIdentity, vs *VersionSet) {
+	diffs := vsk.local.Mismatches(vs)
+	vsk.Lock()
+	_, known := vsk.peers[si.ID]
+	if len(diffs) == 0 {
+		delete(vsk.peers, si.ID)
+	} else {
+		vsk.peers[si.ID] = peerSkew{si: si, diffs: diffs}
+	}
+	vsk.Unlock()
+	if len(diffs) == 0 {
+		return
+	}
+	if !known {
+		log.Warnf("%s runs incompatible versions: %s", si, strings.Join(diffs, ", "))
+	}
+	if vsk.strict {
+		n := c.Router.CloseConnections(si.ID)
+		log.Lvl2("Closed", n, "connections to", si, "because of its versions")
+	}
+}
+
+// GetStatus implements StatusReporter.
+func (vsk *versionSkew) GetStatus() *Status {
+	vsk.Lock()
+	defer vsk.Unlock()
+	f := map[string]string{
+		"Onet":       vsk.local.Onet,
+		"Strict":     strconv.FormatBool(vsk.strict),
+		"Mismatches": strconv.Itoa(len(vsk.peers)),
+	}
+	for _, p := range vsk.local.Protocols {
+		f["Protocol."+p.Name] = strconv.Itoa(p.Version)
+	}
+	for _, p := range vsk.peers {
+		f["Peer."+p.si.Address.String()] = strings.Join(p.diffs, ", ")
+	}
+	return &Status{Field: f}
+}
+
+// VersionMismatches returns the differences with the versions of the peers
+// running incompatible ones, indexed by the address of the peer.
+func (c *Server) VersionMismatches() map[string][]string {
+	c.versionSkew.Lock()
+	defer c.versionSkew.Unlock()
+	m := make(map[string][]string)
+	for _, p := range c.versionSkew.peers {
+		m[p.si.Address.String()] = p.diffs
+	}
+	return m
+}
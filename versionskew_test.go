@@ -0,0 +1,51 @@
+package onet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionSet_Mismatches(t *testing.T) {
+	a := &VersionSet{Onet: "v3.2.1", Protocols: []ProtocolVersion{{"a", 1}, {"b", 2}}}
+	require.Empty(t, a.Mismatches(&VersionSet{Onet: "v3.2.9"}))
+	require.Empty(t, a.Mismatches(&VersionSet{Onet: "(devel)"}))
+	require.Empty(t, a.Mismatches(&VersionSet{Onet: "v3.2.0-20200101-abcdef",
+		Protocols: []ProtocolVersion{{"b", 2}, {"c", 5}}}))
+	require.Equal(t, []string{"onet v3.2.1 != v3.3.0"},
+		a.Mismatches(&VersionSet{Onet: "v3.3.0"}))
+	require.Equal(t, []string{"protocol b 2 != 3"},
+		a.Mismatches(&VersionSet{Onet: "v3.2.1", Protocols: []ProtocolVersion{{"b", 3}}}))
+}
+
+func TestServer_VersionSkew(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, ro, _ := local.GenTree(3, false)
+	servers[0].versionSkew.local = &VersionSet{Onet: "(devel)",
+		Protocols: []ProtocolVersion{{"test", 1}}}
+	servers[1].versionSkew.local = &VersionSet{Onet: "(devel)",
+		Protocols: []ProtocolVersion{{"test", 2}}}
+	servers[1].versionSkew.strict = true
+
+	_, err := servers[0].Send(ro.List[2], &SimpleMessage{1})
+	require.NoError(t, err)
+	_, err = servers[0].Send(ro.List[1], &SimpleMessage{1})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(servers[0].VersionMismatches()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"protocol test 1 != 2"},
+		servers[0].VersionMismatches()[ro.List[1].Address.String()])
+	st := servers[0].versionSkew.GetStatus()
+	require.Equal(t, "1", st.Field["Mismatches"])
+	require.Equal(t, "protocol test 1 != 2", st.Field["Peer."+ro.List[1].Address.String()])
+
+	// the strict server closes the connection
+	require.Eventually(t, func() bool {
+		return servers[1].Router.Connections() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, servers[2].VersionMismatches())
+}
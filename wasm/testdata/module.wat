@@ -0,0 +1,62 @@
+;; Test module of the wasm package. The handler is chosen by its first
+;; letter: Echo, Put, Get, Start, Loop, Burn and Memory. Any other handler
+;; fails with its name as the error.
+(module
+  (import "onet" "storage_get" (func $storage_get (param i32 i32) (result i64)))
+  (import "onet" "storage_put" (func $storage_put (param i32 i32 i32 i32)))
+  (import "onet" "start_protocol" (func $start_protocol (param i32 i32 i32 i32)))
+  (import "onet" "set_error" (func $set_error (param i32 i32)))
+  (memory (export "memory") 1)
+  (global $heap (mut i32) (i32.const 1024))
+  (data (i32.const 0) "key")
+
+  ;; bump allocator, starting again at the beginning of the heap when the
+  ;; first page is full
+  (func $alloc (export "alloc") (param $size i32) (result i32)
+    (if (i32.gt_u (i32.add (global.get $heap) (local.get $size)) (i32.const 65536))
+      (then (global.set $heap (i32.const 1024))))
+    (global.get $heap)
+    (global.set $heap (i32.add (global.get $heap) (local.get $size))))
+
+  (func $process_client_request (export "process_client_request")
+    (param $h i32) (param $hlen i32) (param $m i32) (param $mlen i32) (result i64)
+    (local $c i32) (local $v i64)
+    (local.set $c (i32.load8_u (local.get $h)))
+    ;; Echo returns the message
+    (if (i32.eq (local.get $c) (i32.const 69))
+      (then (return (i64.or
+        (i64.shl (i64.extend_i32_u (local.get $m)) (i64.const 32))
+        (i64.extend_i32_u (local.get $mlen))))))
+    ;; Put stores the message under "key"
+    (if (i32.eq (local.get $c) (i32.const 80))
+      (then
+        (call $storage_put (i32.const 0) (i32.const 3) (local.get $m) (local.get $mlen))
+        (return (i64.const 0))))
+    ;; Get returns the value of "key"
+    (if (i32.eq (local.get $c) (i32.const 71))
+      (then
+        (local.tee $v (call $storage_get (i32.const 0) (i32.const 3)))
+        (if (i64.eq (i64.const -1)) (then (return (i64.const 0))))
+        (return (local.get $v))))
+    ;; Start starts the protocol named after the handler on the roster of
+    ;; the message
+    (if (i32.eq (local.get $c) (i32.const 83))
+      (then
+        (call $start_protocol (local.get $h) (local.get $hlen) (local.get $m) (local.get $mlen))
+        (return (i64.const 0))))
+    ;; Loop never returns
+    (if (i32.eq (local.get $c) (i32.const 76))
+      (then (loop $l (br $l))))
+    ;; Burn calls a function forever
+    (if (i32.eq (local.get $c) (i32.const 66))
+      (then (loop $l (call $nop) (br $l))))
+    ;; Memory grows the memory by 100 pages
+    (if (i32.eq (local.get $c) (i32.const 77))
+      (then
+        (if (i32.eq (memory.grow (i32.const 100)) (i32.const -1))
+          (then (call $set_error (local.get $h) (local.get $hlen))))
+        (return (i64.const 0))))
+    (call $set_error (local.get $h) (local.get $hlen))
+    (i64.const 0))
+
+  (func $nop))
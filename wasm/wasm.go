@@ -0,0 +1,392 @@
+// Package wasm is the host side of services whose logic is compiled to
+// WebAssembly. A module doesn't get access to the conode: it can only use the
+// restricted Host API, which gives it a private storage bucket and lets it
+// start an allowed set of protocols.
+//
+// The modules are run by the engine returned by NewEngine, which is built on
+// wazero, unless Register is given another implementation of Engine.
+//
+// A module of the built-in engine must export:
+//
+//   - its linear memory as "memory";
+//   - "alloc(size i32) -> i32", returning memory where the conode writes the
+//     arguments of a call and the values it returns to the module;
+//   - "process_client_request(handler i32, handler_len i32, msg i32,
+//     msg_len i32) -> i64", returning the pointer of the reply in the high
+//     32 bits and its length in the low 32 bits.
+//
+// It can import the host API from the "onet" module:
+//
+//   - "storage_get(key i32, key_len i32) -> i64", returning the value like
+//     process_client_request, or -1 if there is none;
+//   - "storage_put(key i32, key_len i32, value i32, value_len i32)";
+//   - "start_protocol(name i32, name_len i32, roster i32, roster_len i32)";
+//   - "set_error(msg i32, msg_len i32)", making the call return an error
+//     with the message once the module returns.
+//
+// As modules are untrusted, every call has a deadline and a budget of fuel,
+// and the memory of an instance is limited, see Config. The engine must stop
+// the module when the context of the call is done. If it doesn't, the
+// instance is dropped and a new one serves the following requests.
+package wasm
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ExportProcessClientRequest is the name of the function a module exports to
+// handle client requests.
+const ExportProcessClientRequest = "process_client_request"
+
+// Engine compiles and instantiates WebAssembly modules. The host API must be
+// made available to the module as its imports.
+type Engine interface {
+	Instantiate(code []byte, host Host) (Module, error)
+}
+
+// Module is an instantiated WebAssembly module.
+type Module interface {
+	// Call calls the exported function with the given arguments. It must
+	// interrupt the module and return once ctx is done, e.g., with the
+	// interrupt handle or the fuel of the runtime.
+	Call(ctx context.Context, fn string, args ...[]byte) ([]byte, error)
+	// Close frees all resources held by the module.
+	Close() error
+}
+
+// Host is the API a module can call. It is all a module can do on the conode.
+type Host interface {
+	// StorageGet returns the value stored under key, or nil.
+	StorageGet(key []byte) ([]byte, error)
+	// StoragePut stores the value under key.
+	StoragePut(key, value []byte) error
+	// StartProtocol starts the protocol with the given name on a binary
+	// tree of the protobuf-encoded roster.
+	StartProtocol(name string, roster []byte) error
+}
+
+// Config restricts what a module is allowed to do.
+type Config struct {
+	// Protocols is the list of protocols the module may start.
+	Protocols []string
+	// MaxValueSize is the biggest value a module can store. If 0,
+	// DefaultMaxValueSize is used.
+	MaxValueSize int
+	// CallTimeout is the time after which a call into the module is
+	// interrupted. If 0, DefaultCallTimeout is used.
+	CallTimeout time.Duration
+	// MaxMemoryPages is the number of 64 KiB pages of memory an instance
+	// can use. If 0, DefaultMaxMemoryPages is used.
+	MaxMemoryPages uint32
+	// Fuel is the number of function calls a module can make during a call
+	// before it is interrupted. If 0, DefaultFuel is used.
+	Fuel uint64
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxValueSize == 0 {
+		c.MaxValueSize = DefaultMaxValueSize
+	}
+	if c.CallTimeout == 0 {
+		c.CallTimeout = DefaultCallTimeout
+	}
+	if c.MaxMemoryPages == 0 {
+		c.MaxMemoryPages = DefaultMaxMemoryPages
+	}
+	if c.Fuel == 0 {
+		c.Fuel = DefaultFuel
+	}
+	return c
+}
+
+const (
+	// DefaultMaxValueSize is the default for Config.MaxValueSize.
+	DefaultMaxValueSize = 1024 * 1024
+	// DefaultCallTimeout is the default for Config.CallTimeout.
+	DefaultCallTimeout = 10 * time.Second
+	// DefaultMaxMemoryPages is the default for Config.MaxMemoryPages, 16 MiB.
+	DefaultMaxMemoryPages = 256
+	// DefaultFuel is the default for Config.Fuel.
+	DefaultFuel = 10000000
+)
+
+// Register registers a service with the given name whose logic is the
+// module code, run by the engine. If engine is nil, the engine of NewEngine
+// runs the module.
+func Register(name string, code []byte, engine Engine, cfg Config) (onet.ServiceID, error) {
+	cfg = cfg.withDefaults()
+	if engine == nil {
+		engine = NewEngine(cfg)
+	}
+	id, err := onet.RegisterNewService(name, func(c *onet.Context) (onet.Service, error) {
+		return newService(c, code, engine, cfg)
+	})
+	if err != nil {
+		return id, xerrors.Errorf("registering service: %v", err)
+	}
+	return id, nil
+}
+
+// RegisterFile is like Register but reads the module from a file.
+func RegisterFile(name, path string, engine Engine, cfg Config) (onet.ServiceID, error) {
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return onet.NilServiceID, xerrors.Errorf("reading module: %v", err)
+	}
+	return Register(name, code, engine, cfg)
+}
+
+// instanceGrace is the time an instance has to return from an interrupted
+// call before it is dropped.
+var instanceGrace = time.Second
+
+// instance is an instantiated module. Modules are not expected to be
+// re-entrant, so only one call runs at a time.
+type instance struct {
+	module Module
+	// busy holds a value while a call runs
+	busy    chan struct{}
+	dropped bool
+	closed  sync.Once
+}
+
+func (i *instance) close() {
+	i.closed.Do(func() {
+		if err := i.module.Close(); err != nil {
+			log.Error("closing module:", err)
+		}
+	})
+}
+
+// service runs a module as an onet.Service.
+type service struct {
+	*onet.ServiceProcessor
+	cfg    Config
+	code   []byte
+	engine Engine
+	// protects inst and the dropped field of the instances
+	sync.Mutex
+	inst *instance
+}
+
+func newService(c *onet.Context, code []byte, engine Engine, cfg Config) (*service, error) {
+	s := &service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+		cfg:              cfg,
+		code:             code,
+		engine:           engine,
+	}
+	var err error
+	s.inst, err = s.instantiate()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *service) instantiate() (*instance, error) {
+	m, err := s.engine.Instantiate(s.code, s)
+	if err != nil {
+		return nil, xerrors.Errorf("instantiating module: %v", err)
+	}
+	return &instance{module: m, busy: make(chan struct{}, 1)}, nil
+}
+
+// acquire waits until the current instance is free.
+func (s *service) acquire(ctx context.Context) (*instance, error) {
+	for {
+		s.Lock()
+		inst := s.inst
+		s.Unlock()
+		if inst == nil {
+			return nil, xerrors.New("module is not available")
+		}
+		select {
+		case inst.busy <- struct{}{}:
+		case <-ctx.Done():
+			return nil, xerrors.Errorf("waiting for module: %v", ctx.Err())
+		}
+		s.Lock()
+		dropped := inst.dropped
+		s.Unlock()
+		if !dropped {
+			return inst, nil
+		}
+		<-inst.busy
+	}
+}
+
+// release frees the instance after a call, and closes it if it has been
+// dropped in the meantime.
+func (s *service) release(inst *instance) {
+	<-inst.busy
+	s.Lock()
+	dropped := inst.dropped
+	s.Unlock()
+	if dropped {
+		inst.close()
+	}
+}
+
+// drop replaces an instance that doesn't return from an interrupted call.
+func (s *service) drop(inst *instance) {
+	s.Lock()
+	defer s.Unlock()
+	if inst.dropped {
+		return
+	}
+	inst.dropped = true
+	if s.inst != inst {
+		return
+	}
+	log.Warn("Module of", s.ServiceID(), "doesn't stop, starting a new instance")
+	var err error
+	s.inst, err = s.instantiate()
+	if err != nil {
+		log.Error("Couldn't restart module:", err)
+	}
+}
+
+// ProcessClientRequest passes the request to the module.
+func (s *service) ProcessClientRequest(req *http.Request, handler string,
+	msg []byte) ([]byte, *onet.StreamingTunnel, error) {
+	ctx := context.Background()
+	if req != nil {
+		ctx = req.Context()
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.CallTimeout)
+	defer cancel()
+	inst, err := s.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type result struct {
+		reply []byte
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer s.release(inst)
+		reply, err := inst.module.Call(ctx, ExportProcessClientRequest, []byte(handler), msg)
+		done <- result{reply, err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		select {
+		case res = <-done:
+		case <-time.After(instanceGrace):
+			s.drop(inst)
+			return nil, nil, xerrors.New("module didn't stop in time")
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, nil, xerrors.Errorf("module didn't answer in time: %v", ctx.Err())
+	}
+	if res.err != nil {
+		return nil, nil, xerrors.Errorf("module: %v", res.err)
+	}
+	return res.reply, nil, nil
+}
+
+// IsStreaming implements onet.BidirectionalStreamer. Modules don't support
+// streaming handlers.
+func (s *service) IsStreaming(path string) (bool, error) {
+	return false, nil
+}
+
+// Process drops messages from other conodes, as modules can't register
+// message types.
+func (s *service) Process(env *network.Envelope) {}
+
+// StorageGet implements Host.
+func (s *service) StorageGet(key []byte) ([]byte, error) {
+	var buf []byte
+	err := s.ViewAdditionalBucket([]byte("wasm"), func(b onet.StoreBucket) error {
+		v := b.Get(key)
+		if v != nil {
+			buf = make([]byte, len(v))
+			copy(buf, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("tx error: %v", err)
+	}
+	return buf, nil
+}
+
+// StoragePut implements Host.
+func (s *service) StoragePut(key, value []byte) error {
+	if len(value) > s.cfg.MaxValueSize {
+		return xerrors.Errorf("value of %d bytes is bigger than the allowed %d",
+			len(value), s.cfg.MaxValueSize)
+	}
+	err := s.UpdateAdditionalBucket([]byte("wasm"), func(b *onet.QuotaBucket) error {
+		return b.Put(key, value)
+	})
+	if err != nil {
+		return xerrors.Errorf("storing: %w", err)
+	}
+	return nil
+}
+
+// StartProtocol implements Host.
+func (s *service) StartProtocol(name string, roster []byte) error {
+	allowed := false
+	for _, p := range s.cfg.Protocols {
+		if p == name {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return xerrors.Errorf("module is not allowed to start protocol %s", name)
+	}
+	ro := &onet.Roster{}
+	err := protobuf.DecodeWithConstructors(roster, ro,
+		network.DefaultConstructors(s.Suite()))
+	if err != nil {
+		return xerrors.Errorf("decoding roster: %v", err)
+	}
+	pi, err := s.CreateProtocol(name, ro.GenerateBinaryTree())
+	if err != nil {
+		return xerrors.Errorf("creating protocol: %v", err)
+	}
+	if err := pi.Start(); err != nil {
+		return xerrors.Errorf("starting protocol: %v", err)
+	}
+	return nil
+}
+
+// TestClose implements onet.TestClose and frees the module. A running call
+// closes it when it returns.
+func (s *service) TestClose() {
+	s.Lock()
+	inst := s.inst
+	s.inst = nil
+	if inst != nil {
+		inst.dropped = true
+	}
+	s.Unlock()
+	if inst == nil {
+		return
+	}
+	select {
+	case inst.busy <- struct{}{}:
+		inst.close()
+	default:
+	}
+}
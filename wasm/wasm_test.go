@@ -0,0 +1,135 @@
+package wasm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+var tSuite = suites.MustFind("Ed25519")
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+// fakeEngine stands in for a real WebAssembly runtime: the "code" selects
+// the behaviour of the module.
+type fakeEngine struct {
+	// receives the new modules
+	modules chan *fakeModule
+}
+
+func (e fakeEngine) Instantiate(code []byte, host Host) (Module, error) {
+	m := &fakeModule{kind: string(code), host: host, closed: make(chan bool, 1)}
+	e.modules <- m
+	return m, nil
+}
+
+type fakeModule struct {
+	kind   string
+	host   Host
+	closed chan bool
+	// blocks a "Stuck" call until it is closed
+	stuck chan bool
+}
+
+func (m *fakeModule) Call(ctx context.Context, fn string, args ...[]byte) ([]byte, error) {
+	if fn != ExportProcessClientRequest {
+		return nil, xerrors.New("unknown export")
+	}
+	switch string(args[0]) {
+	case "Put":
+		return nil, m.host.StoragePut([]byte("key"), args[1])
+	case "Get":
+		return m.host.StorageGet([]byte("key"))
+	case "Start":
+		return nil, m.host.StartProtocol("forbidden", args[1])
+	case "Sleep":
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	case "Stuck":
+		// doesn't listen to ctx, like a runtime without interrupts
+		<-m.stuck
+	}
+	return nil, nil
+}
+
+func (m *fakeModule) Close() error {
+	m.closed <- true
+	return nil
+}
+
+func TestService(t *testing.T) {
+	name := "testWasm"
+	engine := fakeEngine{make(chan *fakeModule, 10)}
+	sid, err := Register(name, []byte("storage"), engine,
+		Config{MaxValueSize: 4, CallTimeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	defer onet.UnregisterService(name)
+
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, ro, _ := local.GenTree(2, true)
+	s := local.GetServices(servers, sid)[0].(*service)
+
+	_, _, err = s.ProcessClientRequest(nil, "Put", []byte("abc"))
+	require.NoError(t, err)
+	reply, _, err := s.ProcessClientRequest(nil, "Get", nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte("abc"), reply)
+
+	_, _, err = s.ProcessClientRequest(nil, "Put", []byte("too big"))
+	require.Error(t, err)
+
+	buf, err := protobuf.Encode(ro)
+	require.NoError(t, err)
+	_, _, err = s.ProcessClientRequest(nil, "Start", buf)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not allowed")
+
+	_, _, err = s.ProcessClientRequest(nil, "Sleep", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "in time")
+}
+
+func TestService_Stuck(t *testing.T) {
+	name := "testWasmStuck"
+	engine := fakeEngine{make(chan *fakeModule, 10)}
+	sid, err := Register(name, nil, engine, Config{CallTimeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+	defer onet.UnregisterService(name)
+	defer func(d time.Duration) { instanceGrace = d }(instanceGrace)
+	instanceGrace = 50 * time.Millisecond
+
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(1)
+	s := local.GetServices(servers, sid)[0].(*service)
+	first := <-engine.modules
+	first.stuck = make(chan bool)
+
+	_, _, err = s.ProcessClientRequest(nil, "Stuck", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "didn't stop")
+
+	// a new instance answers while the first one is still stuck
+	second := <-engine.modules
+	_, _, err = s.ProcessClientRequest(nil, "Get", nil)
+	require.NoError(t, err)
+
+	// the first instance is closed once its call returns
+	close(first.stuck)
+	<-first.closed
+	s.TestClose()
+	<-second.closed
+}
@@ -0,0 +1,236 @@
+package wasm
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+	"golang.org/x/xerrors"
+)
+
+// ExportAlloc is the name of the function a module exports to allocate the
+// memory where the conode writes the arguments of a call and the values
+// returned by the host API.
+const ExportAlloc = "alloc"
+
+// HostModule is the name of the module whose functions are the host API.
+const HostModule = "onet"
+
+// NewEngine returns the engine running the modules with wazero, a
+// WebAssembly runtime written in Go, within the memory and fuel limits of
+// cfg. It is the engine of Register if none is given.
+func NewEngine(cfg Config) Engine {
+	return &wazeroEngine{cfg: cfg.withDefaults(), cache: wazero.NewCompilationCache()}
+}
+
+// wazeroEngine runs every instance in its own runtime, so that the host API
+// of an instance only reaches its own service.
+type wazeroEngine struct {
+	cfg   Config
+	cache wazero.CompilationCache
+}
+
+// Instantiate implements Engine.
+func (e *wazeroEngine) Instantiate(code []byte, host Host) (Module, error) {
+	ctx := experimental.WithFunctionListenerFactory(context.Background(), fuelListener{})
+	rc := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(e.cfg.MaxMemoryPages).
+		WithCloseOnContextDone(true).
+		WithCompilationCache(e.cache)
+	m := &wazeroModule{runtime: wazero.NewRuntimeWithConfig(ctx, rc), host: host,
+		fuel: e.cfg.Fuel}
+	_, err := m.runtime.NewHostModuleBuilder(HostModule).
+		NewFunctionBuilder().WithFunc(m.storageGet).Export("storage_get").
+		NewFunctionBuilder().WithFunc(m.storagePut).Export("storage_put").
+		NewFunctionBuilder().WithFunc(m.startProtocol).Export("start_protocol").
+		NewFunctionBuilder().WithFunc(m.setError).Export("set_error").
+		Instantiate(ctx)
+	if err == nil {
+		m.compiled, err = m.runtime.CompileModule(ctx, code)
+	}
+	if err == nil {
+		err = m.instantiate(ctx)
+	}
+	if err != nil {
+		m.runtime.Close(ctx)
+		return nil, err
+	}
+	return m, nil
+}
+
+// wazeroModule is an instance of a module. It is instantiated again when a
+// call is interrupted, as wazero closes the instance, so the memory of the
+// module doesn't survive an interrupted call.
+type wazeroModule struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	mod      api.Module
+	host     Host
+	fuel     uint64
+	// the error set by the module during the current call
+	err string
+}
+
+func (m *wazeroModule) instantiate(ctx context.Context) error {
+	mod, err := m.runtime.InstantiateModule(ctx, m.compiled,
+		wazero.NewModuleConfig().WithName(""))
+	if err != nil {
+		return xerrors.Errorf("instantiating: %v", err)
+	}
+	if mod.Memory() == nil || mod.ExportedFunction(ExportAlloc) == nil {
+		mod.Close(ctx)
+		return xerrors.New("module must export its memory and " + ExportAlloc)
+	}
+	m.mod = mod
+	return nil
+}
+
+// Call implements Module. Every argument is passed to the function as a
+// pointer and a length, and the function returns the pointer and length of
+// its result packed in an i64, the pointer in the high 32 bits.
+func (m *wazeroModule) Call(ctx context.Context, fn string, args ...[]byte) ([]byte, error) {
+	if m.mod.IsClosed() {
+		if err := m.instantiate(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	f := m.mod.ExportedFunction(fn)
+	if f == nil {
+		return nil, xerrors.Errorf("module doesn't export %s", fn)
+	}
+	var params []uint64
+	for _, arg := range args {
+		ptr, err := m.write(ctx, m.mod, arg)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, uint64(ptr), uint64(len(arg)))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	left := &fuel{left: int64(m.fuel), cancel: cancel}
+	m.err = ""
+	res, err := f.Call(context.WithValue(ctx, fuelKey{}, left), params...)
+	if atomic.LoadInt64(&left.left) < 0 {
+		return nil, xerrors.Errorf("module ran out of fuel after %d calls", m.fuel)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.err != "" {
+		return nil, xerrors.New(m.err)
+	}
+	if len(res) != 1 {
+		return nil, xerrors.Errorf("%s must return an i64", fn)
+	}
+	return m.read(m.mod, uint32(res[0]>>32), uint32(res[0]))
+}
+
+// Close implements Module.
+func (m *wazeroModule) Close() error {
+	return m.runtime.Close(context.Background())
+}
+
+// write copies buf to memory allocated by the module.
+func (m *wazeroModule) write(ctx context.Context, mod api.Module, buf []byte) (uint32, error) {
+	res, err := mod.ExportedFunction(ExportAlloc).Call(ctx, uint64(len(buf)))
+	if err != nil {
+		return 0, xerrors.Errorf("allocating: %v", err)
+	}
+	ptr := uint32(res[0])
+	if !mod.Memory().Write(ptr, buf) {
+		return 0, xerrors.Errorf("allocated memory out of range: %d+%d", ptr, len(buf))
+	}
+	return ptr, nil
+}
+
+// read returns a copy of the memory of the module.
+func (m *wazeroModule) read(mod api.Module, ptr, length uint32) ([]byte, error) {
+	buf, ok := mod.Memory().Read(ptr, length)
+	if !ok {
+		return nil, xerrors.Errorf("memory out of range: %d+%d", ptr, length)
+	}
+	return append([]byte{}, buf...), nil
+}
+
+// The host functions abort the call with a panic, which wazero returns as
+// the error of the call.
+
+func (m *wazeroModule) storageGet(ctx context.Context, mod api.Module, kptr, klen uint32) uint64 {
+	key, err := m.read(mod, kptr, klen)
+	if err != nil {
+		panic(err)
+	}
+	value, err := m.host.StorageGet(key)
+	if err != nil {
+		panic(err)
+	}
+	if value == nil {
+		return ^uint64(0)
+	}
+	ptr, err := m.write(ctx, mod, value)
+	if err != nil {
+		panic(err)
+	}
+	return uint64(ptr)<<32 | uint64(len(value))
+}
+
+func (m *wazeroModule) storagePut(ctx context.Context, mod api.Module, kptr, klen, vptr, vlen uint32) {
+	key, err := m.read(mod, kptr, klen)
+	if err != nil {
+		panic(err)
+	}
+	value, err := m.read(mod, vptr, vlen)
+	if err != nil {
+		panic(err)
+	}
+	if err := m.host.StoragePut(key, value); err != nil {
+		panic(err)
+	}
+}
+
+func (m *wazeroModule) startProtocol(ctx context.Context, mod api.Module, nptr, nlen, rptr, rlen uint32) {
+	name, err := m.read(mod, nptr, nlen)
+	if err != nil {
+		panic(err)
+	}
+	roster, err := m.read(mod, rptr, rlen)
+	if err != nil {
+		panic(err)
+	}
+	if err := m.host.StartProtocol(string(name), roster); err != nil {
+		panic(err)
+	}
+}
+
+func (m *wazeroModule) setError(ctx context.Context, mod api.Module, ptr, length uint32) {
+	msg, err := m.read(mod, ptr, length)
+	if err != nil {
+		panic(err)
+	}
+	m.err = string(msg)
+}
+
+// fuel is the number of function calls a module can still make during a
+// call. The call is interrupted when it runs out.
+type fuel struct {
+	left   int64
+	cancel context.CancelFunc
+}
+
+type fuelKey struct{}
+
+// fuelListener takes fuel for every function call of the modules.
+type fuelListener struct{}
+
+func (fuelListener) NewFunctionListener(api.FunctionDefinition) experimental.FunctionListener {
+	return experimental.FunctionListenerFunc(func(ctx context.Context, _ api.Module,
+		_ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+		if f, ok := ctx.Value(fuelKey{}).(*fuel); ok && atomic.AddInt64(&f.left, -1) < 0 {
+			f.cancel()
+		}
+	})
+}
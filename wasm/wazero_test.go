@@ -0,0 +1,117 @@
+package wasm
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/protobuf"
+)
+
+// testModule is compiled from testdata/module.wat.
+const testModule = "testdata/module.wasm"
+
+// mapHost is a Host keeping the values in memory.
+type mapHost map[string][]byte
+
+func (h mapHost) StorageGet(key []byte) ([]byte, error) {
+	return h[string(key)], nil
+}
+
+func (h mapHost) StoragePut(key, value []byte) error {
+	h[string(key)] = value
+	return nil
+}
+
+func (h mapHost) StartProtocol(name string, roster []byte) error {
+	return nil
+}
+
+func TestEngine_Limits(t *testing.T) {
+	code, err := ioutil.ReadFile(testModule)
+	require.NoError(t, err)
+	_, err = NewEngine(Config{}).Instantiate([]byte("not a module"), mapHost{})
+	require.Error(t, err)
+
+	m, err := NewEngine(Config{MaxMemoryPages: 50, Fuel: 1000}).
+		Instantiate(code, mapHost{})
+	require.NoError(t, err)
+	defer m.Close()
+	call := func(ctx context.Context, handler string) error {
+		_, err := m.Call(ctx, ExportProcessClientRequest, []byte(handler), nil)
+		return err
+	}
+
+	err = call(context.Background(), "Memory")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Memory")
+
+	err = call(context.Background(), "Burn")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "fuel")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = call(ctx, "Loop")
+	require.Error(t, err)
+
+	// the module is instantiated again after an interrupted call
+	reply, err := m.Call(context.Background(), ExportProcessClientRequest,
+		[]byte("Echo"), []byte("abc"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("abc"), reply)
+
+	m2, err := NewEngine(Config{}).Instantiate(code, mapHost{})
+	require.NoError(t, err)
+	defer m2.Close()
+	_, err = m2.Call(context.Background(), ExportProcessClientRequest,
+		[]byte("Memory"), nil)
+	require.NoError(t, err)
+}
+
+func TestEngine_Service(t *testing.T) {
+	name := "testWasmEngine"
+	sid, err := RegisterFile(name, testModule, nil,
+		Config{MaxValueSize: 4, CallTimeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	defer onet.UnregisterService(name)
+
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, ro, _ := local.GenTree(2, true)
+	s := local.GetServices(servers, sid)[0].(*service)
+
+	reply, _, err := s.ProcessClientRequest(nil, "Get", nil)
+	require.NoError(t, err)
+	require.Empty(t, reply)
+	_, _, err = s.ProcessClientRequest(nil, "Put", []byte("abc"))
+	require.NoError(t, err)
+	reply, _, err = s.ProcessClientRequest(nil, "Get", nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte("abc"), reply)
+
+	_, _, err = s.ProcessClientRequest(nil, "Put", []byte("too big"))
+	require.Error(t, err)
+
+	buf, err := protobuf.Encode(ro)
+	require.NoError(t, err)
+	_, _, err = s.ProcessClientRequest(nil, "Start", buf)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not allowed")
+
+	_, _, err = s.ProcessClientRequest(nil, "Unknown", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Unknown")
+
+	_, _, err = s.ProcessClientRequest(nil, "Loop", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "in time")
+
+	// the value survives the interrupted call
+	reply, _, err = s.ProcessClientRequest(nil, "Get", nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte("abc"), reply)
+}
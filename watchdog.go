@@ -0,0 +1,146 @@
+package onet
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// setActive records that the node sent or received a message.
+func (n *TreeNodeInstance) setActive() {
+	atomic.StoreInt64(&n.active, time.Now().UnixNano())
+}
+
+// idle returns for how long the node didn't send or receive a message.
+func (n *TreeNodeInstance) idle(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&n.active)))
+}
+
+// pendingMessages describes the messages received by the node and not yet
+// read by its protocol: the ones waiting to be dispatched, and the ones in
+// its channels.
+func (n *TreeNodeInstance) pendingMessages() []string {
+	var pending []string
+	n.msgDispatchQueueMutex.Lock()
+	if q := len(n.msgDispatchQueue); q > 0 {
+		pending = append(pending, fmt.Sprintf("%d messages waiting to be dispatched", q))
+	}
+	n.msgDispatchQueueMutex.Unlock()
+	for _, c := range n.channels {
+		v := reflect.ValueOf(c)
+		pending = append(pending, fmt.Sprintf("%d/%d messages in channel %s",
+			v.Len(), v.Cap(), v.Type()))
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// stalledInstances returns the protocol instances of the overlay that didn't
+// send or receive a message during the period.
+func (o *Overlay) stalledInstances(period time.Duration) []*TreeNodeInstance {
+	o.instancesLock.Lock()
+	defer o.instancesLock.Unlock()
+	now := time.Now()
+	var stalled []*TreeNodeInstance
+	for id := range o.protocolInstances {
+		if tni := o.instances[id]; tni != nil && tni.idle(now) >= period {
+			stalled = append(stalled, tni)
+		}
+	}
+	return stalled
+}
+
+// stallReport describes the stalled node, with its pending messages and the
+// goroutines running the methods of its protocol instance.
+func stallReport(tni *TreeNodeInstance) string {
+	var report strings.Builder
+	pi := tni.ProtocolInstance()
+	fmt.Fprintf(&report, "protocol %s (%T) on %s with id %s didn't send or receive "+
+		"a message for %v\n", tni.ProtocolName(), pi, tni.ServerIdentity(), tni.TokenID(),
+		tni.idle(time.Now()).Round(time.Millisecond))
+	for _, p := range tni.pendingMessages() {
+		fmt.Fprintf(&report, "  %s\n", p)
+	}
+	prefix := typeMethodPrefix(pi)
+	buf := make([]byte, 2<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(g, prefix) {
+			fmt.Fprintf(&report, "\n%s\n", g)
+		}
+	}
+	return report.String()
+}
+
+// watch checks the protocol instances of the server for stalls, if the
+// Watchdog is set, starting the watchdog with the first server.
+func (l *LocalTest) watch(s *Server) {
+	if l.Watchdog <= 0 {
+		return
+	}
+	l.watchdogMut.Lock()
+	defer l.watchdogMut.Unlock()
+	l.watched = append(l.watched, s.overlay)
+	if l.watchdogStop != nil {
+		return
+	}
+	l.watchdogStop = make(chan struct{})
+	l.watchdogDone = make(chan struct{})
+	go l.watchdog(l.Watchdog, l.watchdogStop, l.watchdogDone)
+}
+
+// watchdog reports the stalled protocol instances, once by instance, until
+// stop is closed.
+func (l *LocalTest) watchdog(period time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	interval := period / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	reported := make(map[TokenID]bool)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		l.watchdogMut.Lock()
+		overlays := append([]*Overlay{}, l.watched...)
+		l.watchdogMut.Unlock()
+		for _, o := range overlays {
+			for _, tni := range o.stalledInstances(period) {
+				if reported[tni.TokenID()] {
+					continue
+				}
+				reported[tni.TokenID()] = true
+				report := stallReport(tni)
+				// logged right away, as a stalled test might only end with
+				// the timeout of go test
+				log.Error("Watchdog found a stalled protocol instance:", report)
+				if l.T != nil {
+					l.T.Errorf("stalled %s", tni.Info())
+				}
+			}
+		}
+	}
+}
+
+// stopWatchdog stops the watchdog, if it runs.
+func (l *LocalTest) stopWatchdog() {
+	l.watchdogMut.Lock()
+	stop, done := l.watchdogStop, l.watchdogDone
+	l.watchdogStop = nil
+	l.watchdogMut.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,47 @@
+package onet
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalTest_Watchdog(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+	// the watchdog isn't given T, as it would fail the test
+	l.Watchdog = time.Minute
+	servers, _, tree := l.GenTree(1, true)
+	require.Equal(t, 1, len(l.watched))
+	require.NotNil(t, l.watchdogStop)
+
+	pi, err := l.StartProtocol(ProtocolBlockingName, tree)
+	require.NoError(t, err)
+	bp := pi.(*BlockingProtocol)
+	o := servers[0].overlay
+	require.Empty(t, o.stalledInstances(time.Minute))
+	stalled := o.stalledInstances(0)
+	require.Equal(t, 1, len(stalled))
+	require.Equal(t, bp.TreeNodeInstance, stalled[0])
+
+	report := stallReport(stalled[0])
+	require.Contains(t, report, "protocol "+ProtocolBlockingName+" (*onet.BlockingProtocol)")
+	require.Contains(t, report, "0/100 messages in channel chan struct")
+	// the goroutine of the protocol is started after the instance
+	require.Eventually(t, func() bool {
+		return strings.Contains(stallReport(stalled[0]), "(*BlockingProtocol).Dispatch")
+	}, time.Second, 10*time.Millisecond)
+
+	// a message makes the instance active again
+	go func() { bp.stopBlockChan <- true }()
+	require.NoError(t, l.sendTreeNode("", bp.TreeNodeInstance, bp.TreeNodeInstance,
+		&NodeTestMsg{}))
+	<-bp.doneChan
+	require.Empty(t, o.stalledInstances(time.Second))
+	bp.Done()
+
+	l.stopWatchdog()
+	require.Nil(t, l.watchdogStop)
+}
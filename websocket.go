@@ -1,6 +1,8 @@
 package onet
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -12,9 +14,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
 	"go.dedis.ch/protobuf"
@@ -31,6 +35,13 @@ type CertificateReloader struct {
 	cert     *tls.Certificate
 	certPath string
 	keyPath  string
+	// load gets the certificate and its key, if they aren't in files
+	load func() ([]byte, []byte, error)
+	// the certificate is loaded again after refresh, if not 0
+	refresh time.Duration
+	loaded  time.Time
+	// tells when the certificate expires, see SetClock
+	clock Clock
 }
 
 // NewCertificateReloader takes two file paths as parameter that contain
@@ -40,6 +51,27 @@ func NewCertificateReloader(certPath, keyPath string) (*CertificateReloader, err
 	loader := &CertificateReloader{
 		certPath: certPath,
 		keyPath:  keyPath,
+		clock:    realClock{},
+	}
+
+	err := loader.reload()
+	if err != nil {
+		return nil, xerrors.Errorf("reloading certificate: %v", err)
+	}
+
+	return loader, nil
+}
+
+// NewCertificateReloaderFunc creates a reloader getting the PEM-encoded
+// certificate and key from load, like from a KeyProvider. They are loaded
+// again when the certificate is almost expired and, if refresh is not 0,
+// when they are older than refresh, so that a rotation is picked up.
+func NewCertificateReloaderFunc(load func() ([]byte, []byte, error),
+	refresh time.Duration) (*CertificateReloader, error) {
+	loader := &CertificateReloader{
+		load:    load,
+		refresh: refresh,
+		clock:   realClock{},
 	}
 
 	err := loader.reload()
@@ -51,13 +83,24 @@ func NewCertificateReloader(certPath, keyPath string) (*CertificateReloader, err
 }
 
 func (cr *CertificateReloader) reload() error {
-	newCert, err := tls.LoadX509KeyPair(cr.certPath, cr.keyPath)
+	var newCert tls.Certificate
+	var err error
+	if cr.load != nil {
+		var certPEM, keyPEM []byte
+		certPEM, keyPEM, err = cr.load()
+		if err == nil {
+			newCert, err = tls.X509KeyPair(certPEM, keyPEM)
+		}
+	} else {
+		newCert, err = tls.LoadX509KeyPair(cr.certPath, cr.keyPath)
+	}
 	if err != nil {
 		return xerrors.Errorf("load x509: %v", err)
 	}
 
 	cr.Lock()
 	cr.cert = &newCert
+	cr.loaded = cr.clock.Now()
 	// Successful parse means at least one certificate.
 	cr.cert.Leaf, err = x509.ParseCertificate(newCert.Certificate[0])
 	cr.Unlock()
@@ -68,18 +111,28 @@ func (cr *CertificateReloader) reload() error {
 	return nil
 }
 
+// SetClock replaces the real time to check whether the certificate is about
+// to expire.
+func (cr *CertificateReloader) SetClock(clock Clock) {
+	cr.Lock()
+	defer cr.Unlock()
+	cr.clock = clock
+}
+
 // GetCertificateFunc makes a function that can be passed to the TLSConfig
 // so that it resolves the most up-to-date one.
 func (cr *CertificateReloader) GetCertificateFunc() func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
 	return func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 		cr.RLock()
 
-		exp := time.Now().Add(certificateReloaderLeeway)
+		exp := cr.clock.Now().Add(certificateReloaderLeeway)
 
 		// Here we know the leaf has been parsed successfully as an error
 		// would have been thrown otherwise.
-		if cr.cert == nil || exp.After(cr.cert.Leaf.NotAfter) {
-			// Certificate has expired so we try to load the new one.
+		stale := cr.refresh > 0 && cr.clock.Now().Sub(cr.loaded) > cr.refresh
+		if cr.cert == nil || exp.After(cr.cert.Leaf.NotAfter) || stale {
+			// Certificate has expired, or may have been rotated, so we
+			// try to load the new one.
 
 			// Free the read lock to be able to reload.
 			cr.RUnlock()
@@ -109,6 +162,26 @@ type WebSocket struct {
 	started   bool
 	TLSConfig *tls.Config // can only be modified before Start is called
 	sync.Mutex
+	// number of open websocket sessions, accessed atomically
+	sessions int64
+	// traffic of the clients by service and message, as "service/message"
+	typesRx network.TypeCounter
+	typesTx network.TypeCounter
+	// CORS policies, see SetCORS
+	cors        *CORSConfig
+	serviceCORS map[string]*CORSConfig
+	// audit log of the client requests, see SetAuditLog
+	audit *AuditLog
+	// maintenance mode of the server, nil if there is no server
+	maintenance *maintenanceState
+	// reports the panics of the services, nil if there is no server
+	crashes *crashReporter
+	// ServerIdentity whose URL gets the free port the websocket binds, nil
+	// if it binds the port above the one of the router
+	anyPort *network.ServerIdentity
+	// closes the connections of the refused networks, nil if there is no
+	// server
+	ipFilter *network.IPFilter
 }
 
 // NewWebSocket opens a webservice-listener one port above the given
@@ -184,14 +257,17 @@ func (w *WebSocket) start() {
 	w.started = true
 	w.server.Server.TLSConfig = w.TLSConfig
 	log.Lvl2("Starting to listen on", w.server.Server.Addr)
+	// Check if server is configured for TLS
+	useTLS := w.server.Server.TLSConfig != nil && (w.server.TLSConfig.GetCertificate != nil || len(w.server.Server.TLSConfig.Certificates) >= 1)
+	ln, err := w.listen(useTLS)
+	if err != nil {
+		log.Error("Couldn't listen for the websocket:", err)
+	}
 	started := make(chan bool)
 	go func() {
-		// Check if server is configured for TLS
 		started <- true
-		if w.server.Server.TLSConfig != nil && (w.server.TLSConfig.GetCertificate != nil || len(w.server.Server.TLSConfig.Certificates) >= 1) {
-			w.server.ListenAndServeTLS("", "")
-		} else {
-			w.server.ListenAndServe()
+		if ln != nil {
+			w.server.Serve(ln)
 		}
 	}()
 	<-started
@@ -199,6 +275,52 @@ func (w *WebSocket) start() {
 	w.startstop <- true
 }
 
+// listenOnAnyPort makes the websocket bind a free port when it starts,
+// instead of the one above the port of the router, and set the URL of the
+// ServerIdentity to it if it has none, so that the clients find it.
+func (w *WebSocket) listenOnAnyPort(si *network.ServerIdentity) {
+	w.Lock()
+	defer w.Unlock()
+	w.server.Server.Addr = "0.0.0.0:0"
+	w.anyPort = si
+}
+
+// listen opens the listener of the websocket, or takes the one inherited
+// from the previous process of the conode, see network.Listen. It only
+// accepts the connections allowed by the IP filter of the server. The free port
+// bound by a websocket listening on any port is given to the ServerIdentity.
+func (w *WebSocket) listen(useTLS bool) (net.Listener, error) {
+	ln, err := network.Listen(w.server.Server.Addr)
+	if err != nil {
+		return nil, xerrors.Errorf("listening: %v", err)
+	}
+	// the refused connections are closed before the TLS handshake
+	ln = network.NewFilteredListener(ln, w.ipFilter)
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+		// like graceful.Server.ListenTLS, which enables http2
+		config := w.server.Server.TLSConfig.Clone()
+		if !graceful.TLSConfigHasHTTP2Enabled(config) {
+			config.NextProtos = append(config.NextProtos, "h2")
+		}
+		w.server.Server.TLSConfig = config
+		ln = tls.NewListener(ln, config)
+	}
+	if w.anyPort != nil {
+		_, port, err := net.SplitHostPort(ln.Addr().String())
+		if err != nil {
+			ln.Close()
+			return nil, xerrors.Errorf("bound address: %v", err)
+		}
+		if w.anyPort.URL == "" {
+			w.anyPort.URL = scheme + "://" + net.JoinHostPort(w.anyPort.Address.Host(), port)
+		}
+		log.Lvl2("Websocket listening on the free port", port)
+	}
+	return ln, nil
+}
+
 // registerService stores a service to the given path. All requests to that
 // path and it's sub-endpoints will be forwarded to ProcessClientRequest.
 func (w *WebSocket) registerService(service string, s Service) error {
@@ -210,6 +332,13 @@ func (w *WebSocket) registerService(service string, s Service) error {
 	h := &wsHandler{
 		service:     s,
 		serviceName: service,
+		sessions:    &w.sessions,
+		typesRx:     &w.typesRx,
+		typesTx:     &w.typesTx,
+		cors:        w.corsFor(service),
+		audit:       w.auditLog(),
+		maintenance: w.maintenance,
+		crashes:     w.crashes,
 	}
 	w.mux.Handle(fmt.Sprintf("/%s/", service), h)
 	return nil
@@ -228,10 +357,35 @@ func (w *WebSocket) stop() {
 	w.started = false
 }
 
+// TimeoutQuery is the URL parameter a client can use to give the time after
+// which the requests sent over the connection are abandoned.
+const TimeoutQuery = "timeout"
+
+// TimeoutMessagePrefix starts a text message a client can send before a
+// request to give the time after which this request is abandoned, e.g.,
+// "onet-timeout:1.5s". It overrides TimeoutQuery for the next request only.
+const TimeoutMessagePrefix = "onet-timeout:"
+
+// wsRequest is a request being processed by a wsHandler.
+type wsRequest struct {
+	cancel context.CancelFunc
+	// receives the error that closed the connection, or nil
+	done chan error
+	// bytes sent in the reply
+	tx int
+}
+
 // Pass the request to the websocket.
 type wsHandler struct {
 	serviceName string
 	service     Service
+	sessions    *int64
+	typesRx     *network.TypeCounter
+	typesTx     *network.TypeCounter
+	cors        *CORSConfig
+	audit       *AuditLog
+	maintenance *maintenanceState
+	crashes     *crashReporter
 }
 
 // Wrapper-function so that http.Requests get 'upgraded' to websockets
@@ -241,6 +395,12 @@ func (t wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	tx := 0
 	n := 0
 
+	if !websocket.IsWebSocketUpgrade(r) && (r.Method == http.MethodPost ||
+		r.Method == http.MethodOptions && t.cors != nil) {
+		t.cors.handler(http.HandlerFunc(t.servePost)).ServeHTTP(w, r)
+		return
+	}
+
 	defer func() {
 		log.Lvl2("ws close", r.RemoteAddr, "n", n, "rx", rx, "tx", tx)
 	}()
@@ -249,11 +409,9 @@ func (t wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		// The mobile app on iOS doesn't support compression well...
 		EnableCompression: false,
 		// As the website will not be served from ourselves, we
-		// need to accept _all_ origins. Cross-site scripting is
-		// required.
-		CheckOrigin: func(*http.Request) bool {
-			return true
-		},
+		// need to accept _all_ origins, unless a CORS policy is
+		// configured. Cross-site scripting is required.
+		CheckOrigin: t.cors.checkOrigin,
 	}
 	ws, err := u.Upgrade(w, r, http.Header{})
 	if err != nil {
@@ -261,20 +419,67 @@ func (t wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer ws.Close()
+	atomic.AddInt64(t.sessions, 1)
+	defer atomic.AddInt64(t.sessions, -1)
+
+	var timeout time.Duration
+	if q := r.URL.Query().Get(TimeoutQuery); q != "" {
+		timeout, err = time.ParseDuration(q)
+		if err != nil {
+			log.Warn("invalid timeout from", r.RemoteAddr, ":", err)
+			err = nil
+		}
+	}
+
+	// A request is processed in its own goroutine, so that the connection
+	// can be watched: if the client goes away, the context of the request
+	// is cancelled. Requests are still processed one after the other.
+	var inFlight *wsRequest
+	// timeout of the next request, given by a TimeoutMessagePrefix message
+	var nextTimeout time.Duration
+	// signature of the next request, given by a SignatureMessagePrefix
+	// message
+	var nextSignature *RequestSignature
 
 	// Loop for each message
 outerReadLoop:
 	for err == nil {
 		mt, buf, rerr := ws.ReadMessage()
+		if inFlight != nil {
+			if rerr != nil {
+				inFlight.cancel()
+			}
+			if werr := <-inFlight.done; werr != nil {
+				err = werr
+				break
+			}
+			tx += inFlight.tx
+			inFlight = nil
+		}
 		if rerr != nil {
 			err = rerr
 			break
 		}
 		rx += len(buf)
+		if mt == websocket.TextMessage && bytes.HasPrefix(buf, []byte(TimeoutMessagePrefix)) {
+			nextTimeout, err = time.ParseDuration(string(buf[len(TimeoutMessagePrefix):]))
+			if err != nil {
+				log.Warn("invalid timeout from", r.RemoteAddr, ":", err)
+				err = nil
+			}
+			continue
+		}
+		if mt == websocket.TextMessage && bytes.HasPrefix(buf, []byte(SignatureMessagePrefix)) {
+			nextSignature, err = decodeRequestSignature(string(buf[len(SignatureMessagePrefix):]))
+			if err != nil {
+				log.Warn("invalid signature from", r.RemoteAddr, ":", err)
+				err = nil
+			}
+			continue
+		}
 		n++
 
 		s := t.service
-		var reply []byte
 		var outChan chan []byte
 		path := strings.TrimPrefix(r.URL.Path, "/"+t.serviceName+"/")
 		log.Lvlf2("ws request from %s: %s/%s", r.RemoteAddr, t.serviceName, path)
@@ -291,41 +496,78 @@ outerReadLoop:
 		}
 
 		if !isStreaming {
-			reply, _, err = s.ProcessClientRequest(r, path, buf)
-			if err != nil {
-				log.Errorf("Got an error while executing %s/%s: %+v",
-					t.serviceName, path, err)
-				continue
-			}
-
-			tx += len(reply)
-			err = ws.SetWriteDeadline(time.Now().Add(5 * time.Minute))
-			if err != nil {
-				log.Error(xerrors.Errorf("failed to set the write deadline "+
-					"with request request %s/%s: %v", t.serviceName, path, err))
-				break
+			var ctx context.Context
+			var cancel context.CancelFunc
+			if nextTimeout > 0 {
+				ctx, cancel = context.WithTimeout(r.Context(), nextTimeout)
+				nextTimeout = 0
+			} else if timeout > 0 {
+				ctx, cancel = context.WithTimeout(r.Context(), timeout)
+			} else {
+				ctx, cancel = context.WithCancel(r.Context())
 			}
-
-			err = ws.WriteMessage(mt, reply)
-			if err != nil {
-				log.Error(xerrors.Errorf("failed to write message with "+
-					"request %s/%s: %v", t.serviceName, path, err))
-				break
+			if nextSignature != nil {
+				ctx = context.WithValue(ctx, requestSignatureKey{}, nextSignature)
+				nextSignature = nil
 			}
-
+			inFlight = &wsRequest{cancel: cancel, done: make(chan error, 1)}
+			go func(req *wsRequest) {
+				defer req.cancel()
+				err := t.processRequest(ctx, ws, r, req, mt, path, buf)
+				if err != nil {
+					// unblocks the reading of the next message
+					closeWithError(ws, err)
+					ws.Close()
+				}
+				req.done <- err
+			}(inFlight)
 			continue
 		}
 
+		// every message of the stream is audited by the service
+		ctx := r.Context()
+		var rec *AuditRecord
+		if t.audit != nil {
+			rec = &AuditRecord{
+				Remote:  r.RemoteAddr,
+				Service: t.serviceName,
+				Message: path,
+			}
+			ctx = context.WithValue(ctx, auditStreamKey{}, &auditStream{log: t.audit, rec: *rec})
+			rec.Time = time.Now()
+		}
+		// the stream is a request in progress until it is closed
+		if err = t.maintenance.begin(t.serviceName); err != nil {
+			if rec != nil {
+				t.audit.logRequest(ctx, rec, err)
+			}
+			break
+		}
+		tr := getTracer()
+		ctx = tr.Extract(ctx, r.Header.Get(TraceParentHeader))
+		ctx, span := tr.StartSpan(ctx, "onet.client_stream")
+		span.SetAttribute("onet.service", t.serviceName)
+		span.SetAttribute("onet.path", path)
+		defer span.End()
 		clientInputs := make(chan []byte, 10)
 		clientInputs <- buf
-		outChan, err = bidirectionalStreamer.ProcessClientStreamRequest(r,
+		t.typesRx.Record(t.serviceName+"/"+path, uint64(len(buf)))
+		outChan, err = bidirectionalStreamer.ProcessClientStreamRequest(r.WithContext(ctx),
 			path, clientInputs)
+		t.crashes.reportRequestPanic(t.serviceName, path, nil, err)
 		if err != nil {
+			span.SetAttribute("error", err.Error())
+			if rec != nil {
+				t.audit.logRequest(ctx, rec, err)
+			}
+			t.maintenance.end()
 			log.Errorf("got an error while processing streaming "+
 				"request %s/%s: %+v", t.serviceName, path, err)
 			continue
 		}
 
+		defer t.maintenance.end()
+
 		closing := make(chan bool)
 		go func() {
 			for {
@@ -338,6 +580,7 @@ outerReadLoop:
 					close(closing)
 					return
 				}
+				t.typesRx.Record(t.serviceName+"/"+path, uint64(len(buf)))
 				clientInputs <- buf
 			}
 		}()
@@ -354,6 +597,7 @@ outerReadLoop:
 					break outerReadLoop
 				}
 				tx += len(reply)
+				t.typesTx.Record(t.serviceName+"/"+path, uint64(len(reply)))
 
 				err = ws.SetWriteDeadline(time.Now().Add(5 * time.Minute))
 				if err != nil {
@@ -375,15 +619,113 @@ outerReadLoop:
 
 	}
 
+	closeWithError(ws, err)
+	return
+}
+
+// processRequest passes a non-streaming request to the service and writes
+// the reply. If it returns an error, the connection must be closed.
+func (t wsHandler) processRequest(ctx context.Context, ws *websocket.Conn,
+	r *http.Request, req *wsRequest, mt int, path string, buf []byte) error {
+	reply, err := t.handleRequest(ctx, r, path, buf)
+	if err != nil {
+		return err
+	}
+
+	req.tx = len(reply)
+	err = ws.SetWriteDeadline(time.Now().Add(5 * time.Minute))
+	if err != nil {
+		err = xerrors.Errorf("failed to set the write deadline "+
+			"with request request %s/%s: %v", t.serviceName, path, err)
+		log.Error(err)
+		return err
+	}
+
+	err = ws.WriteMessage(mt, reply)
+	if err != nil {
+		err = xerrors.Errorf("failed to write message with "+
+			"request %s/%s: %v", t.serviceName, path, err)
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// handleRequest passes a non-streaming request to the service and returns
+// the reply.
+func (t wsHandler) handleRequest(ctx context.Context, r *http.Request, path string,
+	buf []byte) ([]byte, error) {
+	t.typesRx.Record(t.serviceName+"/"+path, uint64(len(buf)))
+	var rec *AuditRecord
+	if t.audit != nil {
+		rec = &AuditRecord{
+			Time:    time.Now(),
+			Remote:  r.RemoteAddr,
+			Service: t.serviceName,
+			Message: path,
+		}
+		ctx = context.WithValue(ctx, auditKey{}, rec)
+	}
+	tr := getTracer()
+	ctx = tr.Extract(ctx, r.Header.Get(TraceParentHeader))
+	ctx, span := tr.StartSpan(ctx, "onet.client_request")
+	span.SetAttribute("onet.service", t.serviceName)
+	span.SetAttribute("onet.path", path)
+	reply, err := func() (reply []byte, err error) {
+		if err := t.maintenance.begin(t.serviceName); err != nil {
+			return nil, err
+		}
+		defer t.maintenance.end()
+		ctx := log.NewContext(ctx, log.WithFields(log.KV("service", t.serviceName)))
+		defer func() {
+			p := recover()
+			if p != nil {
+				log.FromContext(ctx).Errorf("Panic in %s/%s: %v", t.serviceName, path, p)
+				err = xerrors.Errorf("panic: %v", p)
+			}
+			t.crashes.reportRequestPanic(t.serviceName, path, p, err)
+		}()
+		reply, _, err = t.service.ProcessClientRequest(r.WithContext(ctx), path, buf)
+		return reply, err
+	}()
+	if err != nil {
+		span.SetAttribute("error", err.Error())
+	}
+	span.End()
+	if rec != nil {
+		t.audit.logRequest(ctx, rec, err)
+	}
+	if ctx.Err() != nil {
+		log.Lvlf2("request %s/%s from %s abandoned: %v",
+			t.serviceName, path, r.RemoteAddr, ctx.Err())
+	}
+	if err != nil {
+		log.Errorf("Got an error while executing %s/%s: %+v",
+			t.serviceName, path, err)
+		return nil, err
+	}
+	t.typesTx.Record(t.serviceName+"/"+path, uint64(len(reply)))
+	return reply, nil
+}
+
+// closeMaintenance is the websocket close code telling the client that the
+// conode is in maintenance.
+const closeMaintenance = 4002
+
+// closeWithError tells the client why the connection is closed.
+func closeWithError(ws *websocket.Conn, err error) {
 	errMessage := "unexpected error: "
 	if err != nil {
 		errMessage += err.Error()
 	}
+	code := websocket.CloseProtocolError
+	if xerrors.Is(err, ErrMaintenance) {
+		code = closeMaintenance
+	}
 
 	ws.WriteControl(websocket.CloseMessage,
-		websocket.FormatCloseMessage(websocket.CloseProtocolError, errMessage),
+		websocket.FormatCloseMessage(code, errMessage),
 		time.Now().Add(time.Millisecond*500))
-	return
 }
 
 type destination struct {
@@ -400,10 +742,45 @@ type Client struct {
 	suite           network.Suite
 	// if not nil, use TLS
 	TLSClientConfig *tls.Config
+	// if not nil, opens the network connections to the conodes, e.g.,
+	// through a SOCKS5 proxy, or to a test double
+	NetDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// if not nil, returns the URL of the proxy for the connection to a
+	// conode, e.g., http.ProxyFromEnvironment
+	Proxy func(*http.Request) (*url.URL, error)
 	// whether to keep the connection
 	keep bool
 	rx   uint64
 	tx   uint64
+	// nil if the requests are only sent to their destination
+	failover *FailoverPolicy
+	// nil for the DefaultRetryPolicy
+	retry *RetryPolicy
+	// nil for the real time, see SetClock
+	clock Clock
+	// nil if the replies are not cached
+	cache *replyCache
+	// notified of the requests, see SetObserver
+	observer ClientObserver
+	// orders the conodes to contact, nil for a random order
+	balancer Balancer
+	// nil if the requests are not queued while offline
+	queue *offlineQueue
+	// signs the requests if not nil, see SetSigner
+	signer kyber.Scalar
+	// keep-alive of the connections between requests, see SetKeepAlive
+	keepAlive   time.Duration
+	idleTimeout time.Duration
+	// when the connections not in use were last released
+	idle map[destination]time.Time
+	// closed to stop the keep-alive loop, nil if it isn't running
+	keepAliveStop chan struct{}
+	// how the requests are sent, see SetTransportMode
+	transport TransportMode
+	// conodes refusing websockets in TransportAuto
+	postOnly map[string]bool
+	// sends the HTTP POST requests, created at the first one
+	httpClient *http.Client
 	sync.Mutex
 }
 
@@ -414,6 +791,8 @@ func NewClient(suite network.Suite, s string) *Client {
 		service:         s,
 		connections:     make(map[destination]*websocket.Conn),
 		connectionsLock: make(map[destination]*sync.Mutex),
+		idle:            make(map[destination]time.Time),
+		postOnly:        make(map[string]bool),
 		suite:           suite,
 	}
 }
@@ -426,22 +805,40 @@ func NewClientKeep(suite network.Suite, s string) *Client {
 	return cl
 }
 
+// UseTransport sets the dialer, the proxy and the TLS configuration of the
+// client from those of the transport, so that the connections to the conodes
+// are opened like the HTTP requests of an application.
+func (c *Client) UseTransport(t *http.Transport) {
+	c.NetDialContext = t.DialContext
+	c.Proxy = t.Proxy
+	c.TLSClientConfig = t.TLSClientConfig
+}
+
 // Suite returns the cryptographic suite in use on this connection.
 func (c *Client) Suite() network.Suite {
 	return c.suite
 }
 
-func (c *Client) closeSingleUseConn(dst *network.ServerIdentity, path string) {
-	dest := destination{dst, path}
+// releaseConn closes the connection after a request, unless the connections
+// are kept. Correct locking must be done before calling this method.
+func (c *Client) releaseConn(dest destination) {
 	if !c.keep {
 		if err := c.closeConn(dest); err != nil {
 			log.Errorf("error while closing the connection to %v : %+v\n",
 				dest, err)
 		}
+		return
+	}
+	if c.keepAlive > 0 || c.idleTimeout > 0 {
+		c.idle[dest] = time.Now()
+		c.startKeepAlive()
 	}
 }
 
-func (c *Client) newConnIfNotExist(dst *network.ServerIdentity, path string) (*websocket.Conn, *sync.Mutex, error) {
+// newConnIfNotExist returns the connection to the path of dst, locked, and
+// whether it was already open.
+func (c *Client) newConnIfNotExist(ctx context.Context, dst *network.ServerIdentity,
+	path string) (*websocket.Conn, *sync.Mutex, bool, error) {
 	var err error
 
 	// c.Lock protects the connections and connectionsLock map
@@ -461,75 +858,111 @@ func (c *Client) newConnIfNotExist(dst *network.ServerIdentity, path string) (*w
 	connLock.Lock()
 	c.Lock()
 	conn, connected := c.connections[dest]
+	delete(c.idle, dest)
 	c.Unlock()
 
 	if !connected {
-		d := &websocket.Dialer{}
-		d.TLSClientConfig = c.TLSClientConfig
+		conn, err = c.dial(ctx, dst, path, nil)
+		if err != nil {
+			connLock.Unlock()
+			return nil, nil, false, err
+		}
+		c.Lock()
+		c.connections[dest] = conn
+		c.Unlock()
+	}
+	return conn, connLock, connected, nil
+}
 
-		var serverURL string
-		var header http.Header
+// serviceURL returns the HTTP URL of the given path of the service at dst,
+// with the query if not nil, and the headers of the requests.
+func (c *Client) serviceURL(dst *network.ServerIdentity, path string,
+	query url.Values) (*url.URL, http.Header, error) {
+	var u *url.URL
+	var header http.Header
 
-		// If the URL is in the dst, then use it.
-		if dst.URL != "" {
-			u, err := url.Parse(dst.URL)
-			if err != nil {
-				connLock.Unlock()
-				return nil, nil, xerrors.Errorf("parsing url: %v", err)
-			}
-			if u.Scheme == "https" {
-				u.Scheme = "wss"
-			} else {
-				u.Scheme = "ws"
-			}
-			if !strings.HasSuffix(u.Path, "/") {
-				u.Path += "/"
-			}
-			u.Path += c.service + "/" + path
-			serverURL = u.String()
-			header = http.Header{"Origin": []string{dst.URL}}
-		} else {
-			// Open connection to service.
-			hp, err := getWSHostPort(dst, false)
-			if err != nil {
-				connLock.Unlock()
-				return nil, nil, xerrors.Errorf("parsing port: %v", err)
-			}
-
-			var wsProtocol string
-			var protocol string
+	// If the URL is in the dst, then use it.
+	if dst.URL != "" {
+		var err error
+		u, err = url.Parse(dst.URL)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("parsing url: %v", err)
+		}
+		if u.Scheme != "https" {
+			u.Scheme = "http"
+		}
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		u.Path += c.service + "/" + path
+		header = http.Header{"Origin": []string{dst.URL}}
+	} else {
+		// Open connection to service.
+		hp, err := getWSHostPort(dst, false)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("parsing port: %v", err)
+		}
 
-			// The old hacky way of deciding if this server has HTTPS or not:
-			// the client somehow magically knows and tells onet by setting
-			// c.TLSClientConfig to a non-nil value.
-			if c.TLSClientConfig != nil {
-				wsProtocol = "wss"
-				protocol = "https"
-			} else {
-				wsProtocol = "ws"
-				protocol = "http"
-			}
-			serverURL = fmt.Sprintf("%s://%s/%s/%s", wsProtocol, hp, c.service, path)
-			header = http.Header{"Origin": []string{protocol + "://" + hp}}
+		// The old hacky way of deciding if this server has HTTPS or not:
+		// the client somehow magically knows and tells onet by setting
+		// c.TLSClientConfig to a non-nil value.
+		protocol := "http"
+		if c.TLSClientConfig != nil {
+			protocol = "https"
 		}
+		u = &url.URL{Scheme: protocol, Host: hp, Path: "/" + c.service + "/" + path}
+		header = http.Header{"Origin": []string{protocol + "://" + hp}}
+	}
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return u, header, nil
+}
 
-		// Re-try to connect in case the websocket is just about to start
-		for a := 0; a < network.MaxRetryConnect; a++ {
-			conn, _, err = d.Dial(serverURL, header)
-			if err == nil {
-				break
-			}
-			time.Sleep(network.WaitRetry)
+// dial opens a new connection to the given path of the service. The query, if
+// not nil, is added to the URL. It stops retrying once ctx is done.
+func (c *Client) dial(ctx context.Context, dst *network.ServerIdentity, path string,
+	query url.Values) (*websocket.Conn, error) {
+	d := &websocket.Dialer{
+		NetDialContext:  c.NetDialContext,
+		Proxy:           c.Proxy,
+		TLSClientConfig: c.TLSClientConfig,
+	}
+
+	u, header, err := c.serviceURL(dst, path, query)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+	serverURL := u.String()
+
+	// Re-try to connect in case the websocket is just about to start
+	policy := c.retryPolicy()
+	budget := retryBudgetFrom(ctx)
+	var conn *websocket.Conn
+	for a := 0; ; a++ {
+		conn, _, err = d.DialContext(ctx, serverURL, header)
+		if err == nil || a+1 >= policy.MaxAttempts {
+			break
 		}
-		if err != nil {
-			connLock.Unlock()
-			return nil, nil, xerrors.Errorf("dial: %v", err)
+		wait := policy.backoff(a)
+		if !budget.spend(wait) {
+			break
 		}
-		c.Lock()
-		c.connections[dest] = conn
-		c.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, xerrors.Errorf("dial: %w", ctx.Err())
+		case <-c.getClock().After(wait):
+		}
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("dial: %w", err)
 	}
-	return conn, connLock, nil
+	return conn, nil
 }
 
 // Send will marshal the message into a ClientRequest message and send it. It has a
@@ -537,34 +970,195 @@ func (c *Client) newConnIfNotExist(dst *network.ServerIdentity, path string) (*w
 // idle connection, the message is sent right away. If the current connection is busy,
 // it waits for it to be free.
 func (c *Client) Send(dst *network.ServerIdentity, path string, buf []byte) ([]byte, error) {
-	conn, connLock, err := c.newConnIfNotExist(dst, path)
-	if err != nil {
-		return nil, xerrors.Errorf("new connection: %v", err)
+	return c.SendWithContext(context.Background(), dst, path, buf)
+}
+
+// SendWithContext is like Send, but gives up once ctx is done. The connection
+// is then closed, which cancels the context of the request on the server. If
+// ctx has a deadline, the time left is sent before the request, so that the
+// handler can take it into account. If the client has a failover policy, the
+// request can be sent to other conodes when dst fails, see SetFailover. If
+// the client has a cache, the reply can come from it, see SetCache. If the
+// client has an offline queue and no conode can be reached, the request is
+// queued and ErrQueued is returned, see SetOfflineQueue.
+func (c *Client) SendWithContext(ctx context.Context, dst *network.ServerIdentity,
+	path string, buf []byte) ([]byte, error) {
+	ctx = c.withRetryBudget(ctx)
+	c.Lock()
+	cache := c.cache
+	c.Unlock()
+	var key string
+	if cache != nil {
+		key = cacheKey(dst, path, buf)
+		if rcv, ok := cache.get(ctx, key); ok {
+			return rcv, nil
+		}
 	}
-	defer connLock.Unlock()
 
+	rcv, delivered, err := c.sendRequest(ctx, dst, path, buf)
+	if err != nil && !delivered && ctx.Err() == nil {
+		// the conodes couldn't be reached
+		err = c.enqueue(dst, path, buf, err)
+	}
+	if err == nil && cache != nil {
+		cache.put(ctx, key, rcv)
+	}
+	return rcv, err
+}
+
+// sendRequest sends the request to dst, or to the other conodes of the
+// failover policy. It also returns whether the request may have reached one
+// of them.
+func (c *Client) sendRequest(ctx context.Context, dst *network.ServerIdentity,
+	path string, buf []byte) ([]byte, bool, error) {
+	c.Lock()
+	policy := c.failover
+	c.Unlock()
+	if policy != nil {
+		return c.sendFailover(ctx, policy, dst, path, buf)
+	}
+	return c.send(ctx, dst, path, buf)
+}
+
+// send sends the request to dst only. It also returns whether the request
+// may have reached dst.
+func (c *Client) send(ctx context.Context, dst *network.ServerIdentity,
+	path string, buf []byte) ([]byte, bool, error) {
+	c.Lock()
+	obs := c.observer
+	bal := c.balancer
+	c.Unlock()
+
+	info := &ClientRequestInfo{
+		Service:     c.service,
+		Path:        path,
+		Destination: dst,
+		Start:       time.Now(),
+		Tx:          len(buf),
+	}
+	if obs != nil {
+		ctx = obs.RequestStarted(ctx, info)
+	}
+	rcv, delivered, err := c.sendTransport(ctx, dst, path, buf)
+	info.Latency = time.Since(info.Start)
+	info.Rx = len(rcv)
+	info.Err = err
+	if bal != nil {
+		bal.Done(dst, info.Latency, err)
+	}
+	if obs != nil {
+		obs.RequestDone(ctx, info)
+	}
+	return rcv, delivered, err
+}
+
+// sendConn sends the request over the connection to dst.
+func (c *Client) sendConn(ctx context.Context, dst *network.ServerIdentity,
+	path string, buf []byte) ([]byte, bool, error) {
 	var rcv []byte
 	defer func() {
 		c.Lock()
-		c.closeSingleUseConn(dst, path)
 		c.rx += uint64(len(rcv))
 		c.tx += uint64(len(buf))
 		c.Unlock()
 	}()
 
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= 0 {
+		return nil, false, xerrors.Errorf("deadline: %w", context.DeadlineExceeded)
+	}
+
+	sig, err := c.requestSignature(ctx, dst, path, buf)
+	if err != nil {
+		return nil, false, xerrors.Errorf("signing: %v", err)
+	}
+	dest := destination{dst, path}
+	for retried := false; ; retried = true {
+		conn, connLock, reused, err := c.newConnIfNotExist(ctx, dst, path)
+		if err != nil {
+			return nil, false, xerrors.Errorf("new connection: %w", err)
+		}
+		var delivered bool
+		rcv, delivered, err = c.exchange(ctx, conn, path, buf, sig)
+		c.Lock()
+		if err != nil {
+			// the connection can't be used anymore
+			if cerr := c.closeConn(dest); cerr != nil {
+				log.Lvl2("closing connection:", cerr)
+			}
+		} else {
+			c.releaseConn(dest)
+		}
+		c.Unlock()
+		connLock.Unlock()
+
+		// a kept connection may have been closed by the conode while it
+		// was idle
+		if err != nil && !delivered && reused && !retried && ctx.Err() == nil {
+			log.Lvl3("Reconnecting to", dst, ":", err)
+			continue
+		}
+		return rcv, delivered, err
+	}
+}
+
+// exchange sends buf over the connection, with the signature if not empty,
+// and waits for the reply, or for ctx to be done. It also returns whether the
+// request has been written to the connection.
+func (c *Client) exchange(ctx context.Context, conn *websocket.Conn, path string,
+	buf []byte, sig string) ([]byte, bool, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		err := conn.WriteMessage(websocket.TextMessage,
+			[]byte(TimeoutMessagePrefix+time.Until(deadline).String()))
+		if err != nil {
+			return nil, false, xerrors.Errorf("connection write: %v", err)
+		}
+	}
+	if sig != "" {
+		err := conn.WriteMessage(websocket.TextMessage, []byte(SignatureMessagePrefix+sig))
+		if err != nil {
+			return nil, false, xerrors.Errorf("connection write: %v", err)
+		}
+	}
 	log.Lvlf4("Sending %x to %s/%s", buf, c.service, path)
 	if err := conn.WriteMessage(websocket.BinaryMessage, buf); err != nil {
-		return nil, xerrors.Errorf("connection write: %v", err)
+		return nil, false, xerrors.Errorf("connection write: %v", err)
+	}
+	rcv, err := readMessage(ctx, conn)
+	if err != nil {
+		return nil, true, err
 	}
+	log.Lvlf4("Received %x", rcv)
+	return rcv, true, nil
+}
 
+// readMessage reads the next message of the connection, or returns once ctx
+// is done.
+func readMessage(ctx context.Context, conn *websocket.Conn) ([]byte, error) {
 	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Minute)); err != nil {
 		return nil, xerrors.Errorf("read deadline: %v", err)
 	}
-	_, rcv, err = conn.ReadMessage()
+	if ctx.Done() != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				// unblocks ReadMessage
+				conn.SetReadDeadline(time.Now())
+			case <-done:
+			}
+		}()
+	}
+	_, rcv, err := conn.ReadMessage()
 	if err != nil {
-		return nil, xerrors.Errorf("connection read: %v", err)
+		if ctx.Err() != nil {
+			return nil, xerrors.Errorf("waiting for reply: %w", ctx.Err())
+		}
+		if websocket.IsCloseError(err, closeMaintenance) {
+			return nil, xerrors.Errorf("connection read: %w", ErrMaintenance)
+		}
+		return nil, xerrors.Errorf("connection read: %w", err)
 	}
-	log.Lvlf4("Received %x", rcv)
 	return rcv, nil
 }
 
@@ -575,14 +1169,20 @@ func (c *Client) Send(dst *network.ServerIdentity, path string, buf []byte) ([]b
 // client. If there is no error, the ret-structure is filled with the
 // data from the service.
 func (c *Client) SendProtobuf(dst *network.ServerIdentity, msg interface{}, ret interface{}) error {
+	return c.SendProtobufWithContext(context.Background(), dst, msg, ret)
+}
+
+// SendProtobufWithContext is like SendProtobuf, but uses SendWithContext.
+func (c *Client) SendProtobufWithContext(ctx context.Context, dst *network.ServerIdentity,
+	msg interface{}, ret interface{}) error {
 	buf, err := protobuf.Encode(msg)
 	if err != nil {
 		return xerrors.Errorf("encoding: %v", err)
 	}
 	path := strings.Split(reflect.TypeOf(msg).String(), ".")[1]
-	reply, err := c.Send(dst, path, buf)
+	reply, err := c.SendWithContext(ctx, dst, path, buf)
 	if err != nil {
-		return xerrors.Errorf("sending: %v", err)
+		return xerrors.Errorf("sending: %w", err)
 	}
 	if ret != nil {
 		err := protobuf.DecodeWithConstructors(reply, ret, network.DefaultConstructors(c.suite))
@@ -615,6 +1215,7 @@ type ParallelOptions struct {
 	//   Default: false
 	IgnoreNodes []*network.ServerIdentity
 	// DontShuffle - if true, the nodes will be contacted in the same order as given in the Roster.
+	// Otherwise they are shuffled, or ordered by the Balancer of the client.
 	// StartNode will be applied before shuffling.
 	//   Default: false
 	DontShuffle bool
@@ -692,12 +1293,34 @@ type Decoder func(data []byte, ret interface{}) error
 // as a structure for future enhancements. If opt is nil, then standard values will be taken.
 func (c *Client) SendProtobufParallelWithDecoder(nodes []*network.ServerIdentity, msg interface{}, ret interface{},
 	opt *ParallelOptions, decoder Decoder) (*network.ServerIdentity, error) {
+	return c.SendProtobufParallelWithContext(context.Background(), nodes, msg, ret, opt, decoder)
+}
+
+// SendProtobufParallelWithContext is like SendProtobufParallelWithDecoder,
+// but gives up once ctx is done. The requests still running are then
+// cancelled. If decoder is nil, protobuf.Decode is used.
+func (c *Client) SendProtobufParallelWithContext(ctx context.Context, nodes []*network.ServerIdentity,
+	msg interface{}, ret interface{}, opt *ParallelOptions, decoder Decoder) (*network.ServerIdentity, error) {
+	ctx = c.withRetryBudget(ctx)
+	if decoder == nil {
+		decoder = protobuf.Decode
+	}
 	buf, err := protobuf.Encode(msg)
 	if err != nil {
 		return nil, xerrors.Errorf("decoding: %v", err)
 	}
 	path := strings.Split(reflect.TypeOf(msg).String(), ".")[1]
 
+	if bal := c.getBalancer(); bal != nil && (opt == nil || !opt.DontShuffle) {
+		// the balancer replaces the shuffling
+		nodes = c.order(ctx, nodes)
+		o := ParallelOptions{DontShuffle: true}
+		if opt != nil {
+			o = *opt
+			o.DontShuffle = true
+		}
+		opt = &o
+	}
 	parallel, nodesChan := opt.GetList(nodes)
 	nodesNbr := len(nodesChan)
 	errChan := make(chan error, nodesNbr)
@@ -713,7 +1336,7 @@ func (c *Client) SendProtobufParallelWithDecoder(nodes []*network.ServerIdentity
 			select {
 			case node := <-nodesChan:
 				log.Lvlf3("Asking %T from: %v - %v", msg, node.Address, node.URL)
-				reply, err := c.Send(node, path, buf)
+				reply, _, err := c.send(ctx, node, path, buf)
 				if err != nil {
 					log.Lvl2("Error while sending to node:", node, err)
 					errChan <- err
@@ -764,6 +1387,15 @@ func (c *Client) SendProtobufParallelWithDecoder(nodes []*network.ServerIdentity
 				return nil, err
 			}
 			errs = append(errs, xerrors.Errorf("sending: %v", err))
+		case <-ctx.Done():
+			decoding.Lock()
+			select {
+			case <-done:
+			default:
+				close(done)
+			}
+			decoding.Unlock()
+			return nil, xerrors.Errorf("sending: %w", ctx.Err())
 		}
 	}
 
@@ -793,14 +1425,17 @@ type StreamingConn struct {
 // ReadMessage read more data from the connection, it will block if there are
 // no messages.
 func (c *StreamingConn) ReadMessage(ret interface{}) error {
-	if err := c.conn.SetReadDeadline(time.Now().Add(5 * time.Minute)); err != nil {
-		return xerrors.Errorf("read deadline: %v", err)
-	}
+	return c.ReadMessageWithContext(context.Background(), ret)
+}
+
+// ReadMessageWithContext is like ReadMessage, but gives up once ctx is done.
+// The connection can't be used anymore afterwards.
+func (c *StreamingConn) ReadMessageWithContext(ctx context.Context, ret interface{}) error {
 	// No need to add bytes to counter here because this function is only
 	// called by the client.
-	_, buf, err := c.conn.ReadMessage()
+	buf, err := readMessage(ctx, c.conn)
 	if err != nil {
-		return xerrors.Errorf("connection read: %v", err)
+		return err
 	}
 	err = protobuf.DecodeWithConstructors(buf, ret, network.DefaultConstructors(c.suite))
 	if err != nil {
@@ -812,13 +1447,20 @@ func (c *StreamingConn) ReadMessage(ret interface{}) error {
 // Stream will send a request to start streaming, it returns a connection where
 // the client can continue to read values from it.
 func (c *Client) Stream(dst *network.ServerIdentity, msg interface{}) (StreamingConn, error) {
+	return c.StreamWithContext(context.Background(), dst, msg)
+}
+
+// StreamWithContext is like Stream, but gives up connecting once ctx is done.
+func (c *Client) StreamWithContext(ctx context.Context, dst *network.ServerIdentity,
+	msg interface{}) (StreamingConn, error) {
+	ctx = c.withRetryBudget(ctx)
 	buf, err := protobuf.Encode(msg)
 	if err != nil {
 		return StreamingConn{}, err
 	}
 	path := strings.Split(reflect.TypeOf(msg).String(), ".")[1]
 
-	conn, connLock, err := c.newConnIfNotExist(dst, path)
+	conn, connLock, _, err := c.newConnIfNotExist(ctx, dst, path)
 	if err != nil {
 		return StreamingConn{}, err
 	}
@@ -836,11 +1478,19 @@ func (c *Client) Stream(dst *network.ServerIdentity, msg interface{}) (Streaming
 // SendToAll sends a message to all ServerIdentities of the Roster and returns
 // all errors encountered concatenated together as a string.
 func (c *Client) SendToAll(dst *Roster, path string, buf []byte) ([][]byte, error) {
+	return c.SendToAllWithContext(context.Background(), dst, path, buf)
+}
+
+// SendToAllWithContext is like SendToAll, but gives up once ctx is done. The
+// requests don't fail over, as they are sent to every conode.
+func (c *Client) SendToAllWithContext(ctx context.Context, dst *Roster, path string,
+	buf []byte) ([][]byte, error) {
+	ctx = c.withRetryBudget(ctx)
 	msgs := make([][]byte, len(dst.List))
 	var errstrs []string
 	for i, e := range dst.List {
 		var err error
-		msgs[i], err = c.Send(e, path, buf)
+		msgs[i], _, err = c.send(ctx, e, path, buf)
 		if err != nil {
 			errstrs = append(errstrs, fmt.Sprint(e.String(), err.Error()))
 		}
@@ -852,6 +1502,57 @@ func (c *Client) SendToAll(dst *Roster, path string, buf []byte) ([][]byte, erro
 	return msgs, err
 }
 
+// SendToAny sends a message to k ServerIdentities of the Roster, random unless
+// the client has a Balancer, at the same time and returns the first reply without error, with the conode that
+// sent it. The other requests are then cancelled. If k is not positive or
+// bigger than the size of the Roster, all the conodes are asked. If all of
+// them fail, the errors are concatenated together as a string.
+func (c *Client) SendToAny(dst *Roster, k int, path string, buf []byte) ([]byte,
+	*network.ServerIdentity, error) {
+	return c.SendToAnyWithContext(context.Background(), dst, k, path, buf)
+}
+
+// SendToAnyWithContext is like SendToAny, but gives up once ctx is done.
+func (c *Client) SendToAnyWithContext(ctx context.Context, dst *Roster, k int,
+	path string, buf []byte) ([]byte, *network.ServerIdentity, error) {
+	ctx = c.withRetryBudget(ctx)
+	if len(dst.List) == 0 {
+		return nil, nil, xerrors.New("empty roster")
+	}
+	if k <= 0 || k > len(dst.List) {
+		k = len(dst.List)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type reply struct {
+		si  *network.ServerIdentity
+		buf []byte
+		err error
+	}
+	replies := make(chan reply, k)
+	for _, si := range c.order(ctx, dst.List)[:k] {
+		go func(si *network.ServerIdentity) {
+			buf, _, err := c.send(ctx, si, path, buf)
+			replies <- reply{si, buf, err}
+		}(si)
+	}
+
+	var errstrs []string
+	for i := 0; i < k; i++ {
+		r := <-replies
+		if r.err == nil {
+			return r.buf, r.si, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, xerrors.Errorf("sending: %w", ctx.Err())
+		}
+		log.Lvl2("Error while sending to node:", r.si, r.err)
+		errstrs = append(errstrs, fmt.Sprint(r.si.String(), r.err.Error()))
+	}
+	return nil, nil, xerrors.New(strings.Join(errstrs, "\n"))
+}
+
 // Close sends a close-command to all open connections and returns nil if no
 // errors occurred or all errors encountered concatenated together as a string.
 func (c *Client) Close() error {
@@ -868,6 +1569,13 @@ func (c *Client) Close() error {
 		}
 		connLock.Unlock()
 	}
+	c.stopKeepAlive()
+	if c.queue != nil {
+		c.queue.stopFlush()
+	}
+	if c.httpClient != nil {
+		c.httpClient.CloseIdleConnections()
+	}
 	var err error
 	if len(errstrs) > 0 {
 		err = xerrors.New(strings.Join(errstrs, "\n"))
@@ -881,6 +1589,7 @@ func (c *Client) closeConn(dst destination) error {
 	conn, ok := c.connections[dst]
 	if ok {
 		delete(c.connections, dst)
+		delete(c.idle, dst)
 		err := conn.WriteMessage(websocket.CloseMessage,
 			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "client closed"))
 		if err != nil {
@@ -2,6 +2,7 @@ package onet
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -9,10 +10,13 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"sort"
@@ -244,6 +248,41 @@ func TestCertificateReloader(t *testing.T) {
 	require.NotNil(t, cert)
 }
 
+func TestCertificateReloaderFunc(t *testing.T) {
+	certPath, keyPath, err := generateSelfSignedCert()
+	require.NoError(t, err)
+	defer func() {
+		os.Remove(certPath)
+		os.Remove(keyPath)
+	}()
+	cert, err := ioutil.ReadFile(certPath)
+	require.NoError(t, err)
+	key, err := ioutil.ReadFile(keyPath)
+	require.NoError(t, err)
+
+	loads := 0
+	reloader, err := NewCertificateReloaderFunc(func() ([]byte, []byte, error) {
+		loads++
+		return cert, key, nil
+	}, time.Minute)
+	require.NoError(t, err)
+	clock := NewVirtualClock(time.Now())
+	reloader.SetClock(clock)
+
+	_, err = reloader.GetCertificateFunc()(nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, loads)
+
+	// the certificate is loaded again once it is older than the refresh
+	clock.Advance(2 * time.Minute)
+	_, err = reloader.GetCertificateFunc()(nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, loads)
+	_, err = reloader.GetCertificateFunc()(nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, loads)
+}
+
 func TestGetWebHost(t *testing.T) {
 	url, err := getWSHostPort(&network.ServerIdentity{Address: "tcp://8.8.8.8"}, true)
 	require.NotNil(t, err)
@@ -287,6 +326,81 @@ func TestClient_Send(t *testing.T) {
 	require.True(t, client.Tx() > client.Rx())
 }
 
+func TestClient_SendWithContext(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, _, _ := local.GenTree(1, false)
+	s := servers[0].Service(serviceWebSocket).(*ServiceWebSocket)
+	client := local.NewClient(serviceWebSocket)
+
+	require.NoError(t, client.SendProtobufWithContext(context.Background(),
+		servers[0].ServerIdentity, &ContextRequest{}, &SimpleResponse{}))
+
+	// a request with a deadline uses the same connection
+	dest := destination{servers[0].ServerIdentity, "ContextRequest"}
+	conn := client.connections[dest]
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	require.NoError(t, client.SendProtobufWithContext(ctx,
+		servers[0].ServerIdentity, &ContextRequest{}, &SimpleResponse{}))
+	cancel()
+	require.True(t, conn == client.connections[dest])
+
+	// the deadline is given to the handler, which is cancelled either by
+	// its deadline or by the client closing the connection
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := client.SendProtobufWithContext(ctx, servers[0].ServerIdentity,
+		&ContextRequest{Wait: true}, nil)
+	require.Error(t, err)
+	require.True(t, xerrors.Is(err, context.DeadlineExceeded))
+	require.Contains(t, <-s.ctxState, "true context")
+
+	// closing the connection cancels the handler
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+	err = client.SendProtobufWithContext(ctx, servers[0].ServerIdentity,
+		&ContextRequest{Wait: true}, nil)
+	require.Error(t, err)
+	require.True(t, xerrors.Is(err, context.Canceled))
+	require.Equal(t, "false context canceled", <-s.ctxState)
+
+	// the client can still be used
+	require.NoError(t, client.SendProtobuf(servers[0].ServerIdentity,
+		&ContextRequest{}, &SimpleResponse{}))
+}
+
+func TestClient_ParallelWithContext(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(2, false)
+	client := local.NewClient(serviceWebSocket)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := client.SendProtobufParallelWithContext(ctx, roster.List,
+		&ContextRequest{Wait: true}, nil, nil, nil)
+	require.True(t, xerrors.Is(err, context.DeadlineExceeded))
+	// with two nodes, only one is asked at a time
+	var state string
+	select {
+	case state = <-servers[0].Service(serviceWebSocket).(*ServiceWebSocket).ctxState:
+	case state = <-servers[1].Service(serviceWebSocket).(*ServiceWebSocket).ctxState:
+	}
+	// the handler is cancelled, either by its deadline or by the client
+	require.Contains(t, state, "true context")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = client.SendToAllWithContext(ctx, roster, "ContextRequest", nil)
+	require.Error(t, err)
+	_, err = client.StreamWithContext(ctx, servers[0].ServerIdentity, &ContextRequest{})
+	require.True(t, xerrors.Is(err, context.Canceled))
+}
+
 func TestClientTLS_Send(t *testing.T) {
 	cert, key, err := getSelfSignedCertificateAndKey()
 	require.Nil(t, err)
@@ -479,6 +593,7 @@ func TestMultiplePath(t *testing.T) {
 	server := hs[0]
 	defer local.CloseAll()
 	client := NewClientKeep(tSuite, dummyService3Name)
+	defer client.Close()
 	msg, err := protobuf.Encode(&DummyMsg{})
 	require.Nil(t, err)
 	path1, path2 := "path1", "path2"
@@ -510,6 +625,7 @@ func TestMultiplePathTLS(t *testing.T) {
 	server := hs[0]
 	defer local.CloseAll()
 	client := NewClientKeep(tSuite, dummyService3Name)
+	defer client.Close()
 	client.TLSClientConfig = &tls.Config{RootCAs: CAPool}
 	msg, err := protobuf.Encode(&DummyMsg{})
 	require.Nil(t, err)
@@ -1019,6 +1135,83 @@ func TestClient_SendProtobufParallel(t *testing.T) {
 	require.False(t, firstNodes[0].Equal(firstNodes[tests-1]))
 }
 
+func TestClient_Dialer(t *testing.T) {
+	local := NewTCPTest(tSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(1)
+	si := servers[0].ServerIdentity
+
+	// a test double of the network
+	var dials int
+	cl := NewClient(tSuite, serviceWebSocket)
+	d := &net.Dialer{}
+	cl.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials++
+		return d.DialContext(ctx, network, addr)
+	}
+	require.NoError(t, cl.SendProtobuf(si, &SimpleResponse{}, &SimpleResponse{}))
+	require.Equal(t, 1, dials)
+
+	// an HTTP proxy
+	var tunnels int
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodConnect, r.Method)
+		tunnels++
+		dst, err := net.Dial("tcp", r.Host)
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusOK)
+		src, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		go func() {
+			io.Copy(dst, src)
+			dst.Close()
+		}()
+		io.Copy(src, dst)
+		src.Close()
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	cl = NewClient(tSuite, serviceWebSocket)
+	cl.UseTransport(&http.Transport{Proxy: http.ProxyURL(proxyURL)})
+	require.NoError(t, cl.SendProtobuf(si, &SimpleResponse{}, &SimpleResponse{}))
+	require.Equal(t, 1, tunnels)
+}
+
+func TestClient_SendToAny(t *testing.T) {
+	l := NewLocalTest(tSuite)
+	defer l.CloseAll()
+
+	_, roster, _ := l.GenTree(3, false)
+	cl := NewClient(tSuite, serviceWebSocket)
+	defer cl.Close()
+
+	buf, err := protobuf.Encode(&SimpleResponse{})
+	require.NoError(t, err)
+	reply, si, err := cl.SendToAny(roster, 2, "SimpleResponse", buf)
+	require.NoError(t, err)
+	require.NotNil(t, si)
+	require.NoError(t, protobuf.Decode(reply, &SimpleResponse{}))
+
+	// only the last conode answers without error
+	buf, err = protobuf.Encode(&ErrorRequest{Roster: *roster, Flags: 3})
+	require.NoError(t, err)
+	_, si, err = cl.SendToAny(roster, 0, "ErrorRequest", buf)
+	require.NoError(t, err)
+	require.True(t, si.Equal(roster.List[2]))
+
+	buf, err = protobuf.Encode(&ErrorRequest{Roster: *roster, Flags: 7})
+	require.NoError(t, err)
+	_, _, err = cl.SendToAny(roster, 0, "ErrorRequest", buf)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "found in flags")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = cl.SendToAnyWithContext(ctx, roster, 0, "SimpleResponse", buf)
+	require.True(t, xerrors.Is(err, context.Canceled))
+}
+
 func TestClient_SendProtobufParallelWithDecoder(t *testing.T) {
 	l := NewLocalTest(tSuite)
 	defer l.CloseAll()
@@ -1049,6 +1242,8 @@ const serviceWebSocket = "WebSocket"
 type ServiceWebSocket struct {
 	*ServiceProcessor
 	Errors int
+	// receives the state of the context of ContextRequest
+	ctxState chan string
 }
 
 func (i *ServiceWebSocket) SimpleResponse(msg *SimpleResponse) (network.Message, error) {
@@ -1073,11 +1268,31 @@ func (i *ServiceWebSocket) ErrorRequest(msg *ErrorRequest) (network.Message, err
 	return &SimpleResponse{}, nil
 }
 
+type ContextRequest struct {
+	Wait bool
+}
+
+func (i *ServiceWebSocket) ContextRequest(ctx context.Context, msg *ContextRequest) (network.Message, error) {
+	if !msg.Wait {
+		return &SimpleResponse{}, nil
+	}
+	_, hasDeadline := ctx.Deadline()
+	select {
+	case <-ctx.Done():
+		i.ctxState <- fmt.Sprintf("%v %v", hasDeadline, ctx.Err())
+	case <-time.After(5 * time.Second):
+		i.ctxState <- "not done"
+	}
+	return nil, xerrors.New("abandoned")
+}
+
 func newServiceWebSocket(c *Context) (Service, error) {
 	s := &ServiceWebSocket{
 		ServiceProcessor: NewServiceProcessor(c),
+		ctxState:         make(chan string, 1),
 	}
-	log.ErrFatal(s.RegisterHandlers(s.SimpleResponse, s.ErrorRequest))
+	log.ErrFatal(s.RegisterHandlers(s.SimpleResponse, s.ErrorRequest,
+		s.ContextRequest))
 	return s, nil
 }
 